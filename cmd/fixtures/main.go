@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// Dump the users, orders and trades in the database in
+// EXCHANGE_DATABASE_URL to a named fixture, restore one, or list them
+func main() {
+	dir := flag.String("dir", "fixtures", "directory fixtures are kept in")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: fixtures [-dir dir] dump name | restore name | list\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	command, name := flag.Arg(0), flag.Arg(1)
+	switch {
+	case command == "list" && flag.NArg() == 1:
+		names, err := db.ListFixtures(*dir)
+		if err != nil {
+			log.Fatalf("Failed to list fixtures: %v", err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	case (command == "dump" || command == "restore") && flag.NArg() == 2:
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	ctx := context.Background()
+	database, err := db.NewDB(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close(ctx)
+
+	if command == "dump" {
+		fixture, err := database.DumpFixture(ctx, name)
+		if err != nil {
+			log.Fatalf("Failed to dump fixture: %v", err)
+		}
+		if err := db.WriteFixture(*dir, fixture); err != nil {
+			log.Fatalf("Failed to save fixture: %v", err)
+		}
+		fmt.Printf("Dumped %s\n", name)
+		return
+	}
+
+	fixture, err := db.ReadFixture(*dir, name)
+	if errors.Is(err, db.ErrFixtureNotFound) {
+		log.Fatalf("No fixture %s in %s", name, *dir)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load fixture: %v", err)
+	}
+	if err := database.RestoreFixture(ctx, fixture); err != nil {
+		log.Fatalf("Failed to restore fixture: %v", err)
+	}
+	fmt.Printf("Restored %s, dumped %s\n", name, fixture.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generate load against a running server: register synthetic users, have
+// each place and cancel random orders at a steady rate, and report the
+// throughput and latency of every kind of request
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "server to load")
+	users := flag.Int("users", 10, "synthetic users to trade as")
+	rate := flag.Float64("rate", 50, "requests per second, across all users")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	marketShare := flag.Float64("market", 0.2, "fraction of orders that take liquidity")
+	cancelShare := flag.Float64("cancel", 0.3, "fraction of requests that cancel a resting order")
+	mid := flag.Float64("price", 50000, "price orders are placed around")
+	spread := flag.Float64("spread", 0.01, "furthest resting orders are placed from the price, as a fraction of it")
+	prefix := flag.String("prefix", "loadgen", "username prefix of the synthetic users")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: loadgen [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	switch {
+	case flag.NArg() > 0:
+		flag.Usage()
+		os.Exit(2)
+	case *users < 1 || *rate <= 0 || *duration <= 0 || *mid <= 0 || *spread <= 0 || *spread >= 1:
+		log.Fatalf("users, rate, duration, price and spread must be positive, and spread below 1")
+	case *marketShare < 0 || *marketShare > 1 || *cancelShare < 0 || *cancelShare > 1:
+		log.Fatalf("market and cancel must be between 0 and 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := &http.Client{Timeout: 10 * time.Second}
+	api := strings.TrimSuffix(*baseURL, "/")
+
+	// Log everyone in before the clock starts
+	traders := make([]*trader, *users)
+	for i := range traders {
+		username := fmt.Sprintf("%s%d", *prefix, i+1)
+		token, err := signUp(ctx, client, api, username)
+		if err != nil {
+			log.Fatalf("Failed to sign up %s: %v", username, err)
+		}
+		traders[i] = &trader{
+			client:      client,
+			api:         api,
+			token:       token,
+			rand:        rand.New(rand.NewSource(time.Now().UnixNano() + int64(i))),
+			mid:         *mid,
+			spread:      *spread,
+			marketShare: *marketShare,
+			cancelShare: *cancelShare,
+		}
+	}
+	log.Printf("Signed up %d users; sending %.1f requests/s for %v", *users, *rate, *duration)
+
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+	results := newRecorder()
+	interval := max(time.Duration(float64(time.Second)*float64(*users) / *rate), time.Microsecond)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, t := range traders {
+		wg.Add(1)
+		go func(t *trader) {
+			defer wg.Done()
+			t.run(ctx, interval, results)
+		}(t)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	fmt.Printf("\n%d users for %v\n\n", *users, elapsed.Round(time.Millisecond))
+	results.report(os.Stdout, elapsed)
+}
+
+// password is every synthetic user's password
+const password = "loadgen-password"
+
+// signUp registers a user, unless it exists from an earlier run, and logs
+// it in
+func signUp(ctx context.Context, client *http.Client, api, username string) (string, error) {
+	creds := map[string]string{"username": username, "password": password}
+	status, err := call(ctx, client, http.MethodPost, api+"/register", "", creds, nil)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusCreated && status != http.StatusConflict {
+		return "", fmt.Errorf("register returned %d", status)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	status, err = call(ctx, client, http.MethodPost, api+"/login", "", creds, &login)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("login returned %d", status)
+	}
+	return login.Token, nil
+}
+
+// call sends a JSON request and decodes a successful JSON response into
+// out, if given, returning the status
+func call(ctx context.Context, client *http.Client, method, url, token string, body, out interface{}) (int, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// trader is a synthetic user placing and canceling random orders
+type trader struct {
+	client      *http.Client
+	api         string
+	token       string
+	rand        *rand.Rand
+	mid         float64
+	spread      float64
+	marketShare float64
+	cancelShare float64
+	resting     []int // IDs of the user's orders that may still be open
+}
+
+// run sends a request every interval until ctx is done. A request slower
+// than the interval delays the next one rather than overlapping it.
+func (t *trader) run(ctx context.Context, interval time.Duration, results *recorder) {
+	// Spread users' requests across the interval
+	timer := time.NewTimer(time.Duration(t.rand.Int63n(int64(interval))))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		res, err := t.act(ctx)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return
+		}
+		results.record(res)
+		timer.Reset(interval)
+	}
+}
+
+// act sends one random request
+func (t *trader) act(ctx context.Context) (result, error) {
+	if len(t.resting) > 0 && t.rand.Float64() < t.cancelShare {
+		return t.cancel(ctx)
+	}
+	return t.place(ctx, t.rand.Float64() < t.marketShare)
+}
+
+// place sends a limit order priced up to spread away from the price on its
+// side of the book, or, to take liquidity, an IOC order priced through it
+func (t *trader) place(ctx context.Context, market bool) (result, error) {
+	side := "buy"
+	if t.rand.Intn(2) == 0 {
+		side = "sell"
+	}
+	order := map[string]interface{}{
+		"type":     side,
+		"quantity": math.Round((0.001+t.rand.Float64()*0.099)*1000) / 1000,
+		"tag":      "loadgen",
+	}
+	// Buys rest below the price and sells above it
+	offset := t.rand.Float64() * t.spread
+	res := result{action: actionLimit}
+	if market {
+		offset = -2 * t.spread
+		order["time_in_force"] = "IOC"
+		res.action = actionMarket
+	}
+	if side == "buy" {
+		offset = -offset
+	}
+	order["price"] = math.Round(t.mid*(1+offset)*100) / 100
+
+	var placed struct {
+		OrderID int    `json:"order_id"`
+		Status  string `json:"status"`
+	}
+	start := time.Now()
+	status, err := call(ctx, t.client, http.MethodPost, t.api+"/orders", t.token, order, &placed)
+	res.status, res.latency = status, time.Since(start)
+	if err == nil && status == http.StatusCreated && placed.Status == "open" {
+		t.resting = append(t.resting, placed.OrderID)
+	}
+	return res, err
+}
+
+// cancel cancels a random resting order, which may have filled since
+func (t *trader) cancel(ctx context.Context) (result, error) {
+	i := t.rand.Intn(len(t.resting))
+	orderID := t.resting[i]
+	t.resting[i] = t.resting[len(t.resting)-1]
+	t.resting = t.resting[:len(t.resting)-1]
+
+	start := time.Now()
+	status, err := call(ctx, t.client, http.MethodDelete, fmt.Sprintf("%s/orders/%d", t.api, orderID), t.token, nil, nil)
+	return result{action: actionCancel, status: status, latency: time.Since(start)}, err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Actions a synthetic user takes
+const (
+	actionLimit  = "limit"  // A limit order priced away from the market, which rests
+	actionMarket = "market" // An IOC order priced through the market, which takes liquidity
+	actionCancel = "cancel" // Cancel one of the user's resting orders
+)
+
+var actions = []string{actionLimit, actionMarket, actionCancel}
+
+// result is the outcome of one request
+type result struct {
+	action  string
+	status  int // HTTP status, or 0 if the request failed
+	latency time.Duration
+}
+
+// recorder collects the results of every request
+type recorder struct {
+	mu      sync.Mutex
+	results map[string][]result
+}
+
+func newRecorder() *recorder {
+	return &recorder{results: make(map[string][]result)}
+}
+
+func (r *recorder) record(res result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[res.action] = append(r.results[res.action], res)
+}
+
+// summary is the throughput and latency of one action
+type summary struct {
+	Requests    int
+	Errors      int // Failed requests and responses other than 2xx, 409 and 429
+	RateLimited int // 429 responses
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+	Max         time.Duration
+}
+
+// summarize computes the summary of results. Latency percentiles cover
+// every response, rate limited or not.
+func summarize(results []result) summary {
+	var s summary
+	latencies := make([]time.Duration, 0, len(results))
+	for _, res := range results {
+		s.Requests++
+		switch {
+		case res.status == http.StatusTooManyRequests:
+			s.RateLimited++
+		case res.status == http.StatusConflict:
+			// A cancel losing the race with a fill
+		case res.status < 200 || res.status > 299:
+			s.Errors++
+		}
+		if res.status != 0 {
+			latencies = append(latencies, res.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.P50, s.P90, s.P99 = percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99)
+	if len(latencies) > 0 {
+		s.Max = latencies[len(latencies)-1]
+	}
+	return s
+}
+
+// percentile returns the nearest-rank percentile p, between 0 and 1, of
+// sorted durations, or zero if there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+// report writes the throughput and latency of each action over elapsed
+func (r *recorder) report(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total []result
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "action\trequests\treq/s\terrors\t429s\tp50\tp90\tp99\tmax\t")
+	row := func(name string, s summary) {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%d\t%v\t%v\t%v\t%v\t\n", name, s.Requests, float64(s.Requests)/elapsed.Seconds(),
+			s.Errors, s.RateLimited, round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+	}
+	for _, action := range actions {
+		row(action, summarize(r.results[action]))
+		total = append(total, r.results[action]...)
+	}
+	row("total", summarize(total))
+	tw.Flush()
+}
+
+// round shortens a latency for display
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v): expected %v, got %v", tt.p, tt.want, got)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("expected 0 for no latencies, got %v", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []result{
+		{action: actionCancel, status: http.StatusOK, latency: 3 * time.Millisecond},
+		{action: actionCancel, status: http.StatusConflict, latency: 1 * time.Millisecond},
+		{action: actionCancel, status: http.StatusTooManyRequests, latency: 2 * time.Millisecond},
+		{action: actionCancel, status: http.StatusInternalServerError, latency: 4 * time.Millisecond},
+		{action: actionCancel, status: 0, latency: 10 * time.Second},
+	}
+	s := summarize(results)
+	if s.Requests != 5 || s.Errors != 2 || s.RateLimited != 1 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	// The failed request has no latency to count
+	if s.P50 != 2*time.Millisecond || s.Max != 4*time.Millisecond {
+		t.Errorf("unexpected latencies %+v", s)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// Apply database migrations to the database in EXCHANGE_DATABASE_URL
+func main() {
+	to := flag.Int("to", -1, "apply migrations up to this version instead of all of them")
+	status := flag.Bool("status", false, "print the current and latest versions without migrating")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: migrate [-to version] [-status]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	database, err := db.NewDB(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close(ctx)
+
+	current, latest, err := database.MigrationVersion(ctx)
+	if err != nil {
+		log.Fatalf("Failed to get schema version: %v", err)
+	}
+	if *status {
+		fmt.Printf("Schema version %d of %d\n", current, latest)
+		return
+	}
+
+	version, err := database.MigrateTo(ctx, int32(*to), func(version int32, name string) {
+		fmt.Printf("Applying %s\n", name)
+	})
+	if err != nil {
+		log.Fatalf("Failed to migrate: %v", err)
+	}
+	if version == current {
+		fmt.Printf("Schema already at version %d\n", version)
+		return
+	}
+	fmt.Printf("Migrated schema from version %d to %d\n", current, version)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/replay"
+)
+
+// Replay a file of order commands through the matching engine and print the
+// resulting trade log
+func main() {
+	start := flag.String("start", replay.Epoch.Format(time.RFC3339), "time the simulated clock starts at, in RFC 3339")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: replay [-start time] commands.jsonl\n\nReads commands from stdin if the file is -.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	startAt, err := time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		log.Fatalf("Invalid start time: %v", err)
+	}
+
+	var in io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open commands: %v", err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err = replay.Run(in, out, startAt)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Fatalf("Failed to replay: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/instruments"
+)
+
+// flowConfig shapes the generated order flow
+type flowConfig struct {
+	Users       int
+	Orders      int           // Orders to place; cancels come on top
+	Duration    time.Duration // Span the orders are spread over
+	Price       float64       // Mid price the flow starts from
+	Volatility  float64       // Daily volatility of the mid price, e.g. 0.03 for 3%
+	MarketShare float64       // Fraction of orders that take liquidity
+	CancelShare float64       // Fraction of actions that cancel a resting order
+	Spread      float64       // Typical distance resting orders are placed from the mid, as a fraction of it
+	MedianSize  float64       // Median order quantity
+}
+
+// action is one step of generated order flow: an order placed, or one of
+// the user's resting orders canceled
+type action struct {
+	At     time.Duration // Since the flow started
+	User   int           // Index of the acting user, from 0
+	Cancel bool
+	Pick   float64 // Which resting order to cancel, in [0, 1)
+
+	Side        string
+	Price       float64
+	Quantity    float64
+	TimeInForce string
+}
+
+// flow generates order flow for one market. Orders arrive as a Poisson
+// process while the mid price follows a geometric Brownian motion; resting
+// orders cluster near the mid, order sizes are log-normal and a few users
+// place most of the orders.
+type flow struct {
+	cfg   flowConfig
+	inst  instruments.Instrument
+	rand  *rand.Rand
+	users *rand.Zipf
+	mid   float64
+	at    time.Duration
+	gap   float64 // Mean time between actions, in nanoseconds
+}
+
+// newFlow creates a flow for inst, the same for the same seed
+func newFlow(cfg flowConfig, inst instruments.Instrument, seed int64) *flow {
+	r := rand.New(rand.NewSource(seed))
+	actions := float64(cfg.Orders) / (1 - cfg.CancelShare)
+	return &flow{
+		cfg:   cfg,
+		inst:  inst,
+		rand:  r,
+		users: rand.NewZipf(r, 1.2, 1, uint64(cfg.Users-1)),
+		mid:   cfg.Price,
+		gap:   float64(cfg.Duration) / actions,
+	}
+}
+
+// next returns the next action
+func (f *flow) next() action {
+	gap := time.Duration(f.rand.ExpFloat64() * f.gap)
+	f.at = min(f.at+gap, f.cfg.Duration)
+	days := gap.Hours() / 24
+	sigma := f.cfg.Volatility
+	f.mid *= math.Exp(-sigma*sigma*days/2 + sigma*math.Sqrt(days)*f.rand.NormFloat64())
+	f.mid = min(max(f.mid, f.inst.MinPrice), f.inst.MaxPrice)
+
+	a := action{At: f.at, User: int(f.users.Uint64())}
+	if f.rand.Float64() < f.cfg.CancelShare {
+		a.Cancel = true
+		a.Pick = f.rand.Float64()
+		return a
+	}
+
+	// Buyers bid below the mid and take above it; sellers the reverse
+	a.Side, a.TimeInForce = "buy", "GTC"
+	sign := 1.0
+	if f.rand.Intn(2) == 0 {
+		a.Side, sign = "sell", -1
+	}
+	price := f.mid * (1 - sign*f.cfg.Spread*f.rand.ExpFloat64())
+	if f.rand.Float64() < f.cfg.MarketShare {
+		price = f.mid * (1 + sign*2*f.cfg.Spread)
+		a.TimeInForce = "IOC"
+	}
+	a.Price = min(max(f.inst.RoundPrice(price), f.inst.MinPrice), f.inst.MaxPrice)
+
+	quantity := f.cfg.MedianSize * math.Exp(0.8*f.rand.NormFloat64())
+	a.Quantity = min(max(roundQuantity(f.inst, quantity), f.inst.MinQuantity), f.inst.MaxQuantity)
+	return a
+}
+
+// roundQuantity rounds a quantity to the instrument's quantity precision
+func roundQuantity(inst instruments.Instrument, quantity float64) float64 {
+	scale := math.Pow10(inst.QuantityPrecision)
+	return math.Round(quantity*scale) / scale
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+)
+
+var testFlow = flowConfig{
+	Users:       10,
+	Orders:      2000,
+	Duration:    24 * time.Hour,
+	Price:       50000,
+	Volatility:  0.03,
+	MarketShare: 0.3,
+	CancelShare: 0.2,
+	Spread:      0.002,
+	MedianSize:  0.05,
+}
+
+func TestFlow(t *testing.T) {
+	inst, _ := instruments.Lookup(exchange.DefaultSymbol)
+	f := newFlow(testFlow, inst, 1)
+
+	var last time.Duration
+	var placed, cancels, taking int
+	activity := make([]int, testFlow.Users)
+	for placed < testFlow.Orders {
+		a := f.next()
+		if a.At < last || a.At > testFlow.Duration {
+			t.Fatalf("action at %v after one at %v, over %v", a.At, last, testFlow.Duration)
+		}
+		last = a.At
+		if a.User < 0 || a.User >= testFlow.Users {
+			t.Fatalf("unexpected user %d", a.User)
+		}
+		activity[a.User]++
+		if a.Cancel {
+			if a.Pick < 0 || a.Pick >= 1 {
+				t.Errorf("unexpected pick %v", a.Pick)
+			}
+			cancels++
+			continue
+		}
+		placed++
+		if err := inst.ValidateOrder(a.Price, a.Quantity); err != nil {
+			t.Fatalf("invalid order %+v: %v", a, err)
+		}
+		if a.TimeInForce == "IOC" {
+			taking++
+		}
+	}
+
+	// The shares come out about as configured, and the history spans
+	// about the whole duration
+	if cancels < 400 || cancels > 600 {
+		t.Errorf("expected about 500 cancels, got %d", cancels)
+	}
+	if taking < 500 || taking > 700 {
+		t.Errorf("expected about 600 orders taking liquidity, got %d", taking)
+	}
+	if last < 20*time.Hour {
+		t.Errorf("expected the flow to span about %v, ended at %v", testFlow.Duration, last)
+	}
+	// A few users place most of the orders
+	if activity[0] <= activity[testFlow.Users-1]*2 {
+		t.Errorf("expected the first user to be the most active, got %v", activity)
+	}
+	if f.mid < 40000 || f.mid > 60000 {
+		t.Errorf("expected the price to wander near 50000 in a day, got %v", f.mid)
+	}
+}
+
+func TestFlow_Deterministic(t *testing.T) {
+	inst, _ := instruments.Lookup(exchange.DefaultSymbol)
+	a, b := newFlow(testFlow, inst, 7), newFlow(testFlow, inst, 7)
+	for i := 0; i < 100; i++ {
+		if x, y := a.next(), b.next(); x != y {
+			t.Fatalf("action %d: %+v differs from %+v", i, x, y)
+		}
+	}
+}
+
+func TestParseMarkets(t *testing.T) {
+	if markets, err := parseMarkets(""); err != nil || len(markets) != len(instruments.All) {
+		t.Errorf("expected every market, got %v, %v", markets, err)
+	}
+	if markets, err := parseMarkets(" BTC-USD "); err != nil || len(markets) != 1 || markets[0].Symbol != "BTC-USD" {
+		t.Errorf("expected BTC-USD, got %v, %v", markets, err)
+	}
+	if _, err := parseMarkets("BTC-USD,DOGE-USD"); err == nil {
+		t.Error("expected an unknown market rejected")
+	}
+}
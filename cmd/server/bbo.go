@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/events"
+)
+
+// bboChannel carries an instrument's best bid and offer, as returned by
+// GET /bbo, each time either changes, e.g. "bbo:BTC-USD"
+func bboChannel(symbol string) string {
+	return "bbo:" + symbol
+}
+
+// bboPublisher broadcasts the best bid and offer when they change
+type bboPublisher struct {
+	current func() api.BBOView
+
+	mu   sync.Mutex
+	last api.BBOView
+}
+
+// publish broadcasts the best bid and offer if they changed since they were
+// last published, and reports whether they did. Changes deeper in the book
+// move the sequence number alone, which isn't published, and a best bid and
+// offer read before the last published is dropped.
+func (p *bboPublisher) publish() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	bbo := p.current()
+	if bbo.Seq < p.last.Seq || (bbo.Symbol == p.last.Symbol && bbo.Bid == p.last.Bid && bbo.Ask == p.last.Ask) {
+		return false
+	}
+	p.last = bbo
+	broadcastToChannel(bboChannel(bbo.Symbol), bbo)
+	return true
+}
+
+// publishBBO broadcasts the best bid and offer whenever a trade or order
+// change moves them
+func publishBBO(handler *api.Handler) {
+	p := &bboPublisher{current: handler.CurrentBBO}
+	handler.Events.Subscribe(events.TradeExecuted, func(events.Event) { p.publish() })
+	handler.Events.Subscribe(events.OrderUpdated, func(events.Event) { p.publish() })
+	p.publish()
+}
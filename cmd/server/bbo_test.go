@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/exchange"
+)
+
+func TestBBOPublisher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		clientHub.register(newWSClient(conn, map[string]bool{"bbo:BTC-USD": true}, false, 0))
+	}))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	for clientHub.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	defer removeAllClients()
+
+	bbo := api.BBOView{Symbol: "BTC-USD", Bid: exchange.Level{Price: 99, Quantity: 1}, Seq: 10}
+	p := &bboPublisher{current: func() api.BBOView { return bbo }}
+	if !p.publish() {
+		t.Error("expected the first best bid and offer to be published")
+	}
+	bbo.Seq = 11
+	if p.publish() {
+		t.Error("expected an unchanged best bid and offer not to be published")
+	}
+	bbo.Ask = exchange.Level{Price: 101, Quantity: 0.5}
+	bbo.Seq = 9
+	if p.publish() {
+		t.Error("expected a best bid and offer older than the last published not to be published")
+	}
+	bbo.Seq = 12
+	if !p.publish() {
+		t.Error("expected a changed best bid and offer to be published")
+	}
+
+	for _, want := range []api.BBOView{
+		{Symbol: "BTC-USD", Bid: exchange.Level{Price: 99, Quantity: 1}, Seq: 10},
+		bbo,
+	} {
+		_, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		wantJSON, _ := json.Marshal(wsMessage{Channel: "bbo:BTC-USD", Data: want})
+		if string(got) != string(wantJSON) {
+			t.Errorf("expected %s, got %s", wantJSON, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// connectClients registers n WebSocket clients subscribed to channel and
+// discards what they receive. They are closed when the test ends.
+func connectClients(tb testing.TB, n int, channel string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		clientHub.register(newWSClient(conn, map[string]bool{channel: true}, false, 0))
+	}))
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	var conns []*websocket.Conn
+	for i := 0; i < n; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			tb.Fatalf("Failed to connect client %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		registered := clientHub.count()
+		if registered == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("only %d of %d clients registered", registered, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	tb.Cleanup(func() {
+		removeAllClients()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		server.Close()
+	})
+}
+
+// removeAllClients closes and unregisters every client
+func removeAllClients() {
+	clientHub.do(func(clients map[*WSClient]bool) {
+		for client := range clients {
+			client.close()
+			delete(clients, client)
+		}
+	})
+}
+
+func TestBroadcastToChannel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		clientHub.register(newWSClient(conn, map[string]bool{"candles:1m": true}, false, 0))
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	for {
+		registered := clientHub.count()
+		if registered == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer func() {
+		removeAllClients()
+	}()
+
+	candle := models.Candle{Interval: "1m", OpenTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Close: 100}
+	broadcastToChannel("candles:1m", candle)
+	broadcastToChannel("candles:5m", candle) // Not subscribed
+
+	_, got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	want, _ := json.Marshal(wsMessage{Channel: "candles:1m", Data: candle})
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+// BenchmarkBroadcastToChannel measures publishing a candle update to 1000
+// subscribers. "previous" is the broadcast before encoding once and framing
+// with prepared messages: two encoding/json passes and a frame per client.
+func BenchmarkBroadcastToChannel(b *testing.B) {
+	const channel = "candles:1m"
+	connectClients(b, 1000, channel)
+	candle := models.Candle{Interval: "1m", OpenTime: time.Now(), Open: 50000, High: 50100.5, Low: 49900.25, Close: 50050, Volume: 12.5}
+
+	b.Run("previous", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := json.Marshal(wsMessage{Channel: channel, Data: candle})
+			raw, _ := json.Marshal(candle)
+			clientHub.do(func(clients map[*WSClient]bool) {
+				for client := range clients {
+					msg := data
+					if client.raw {
+						msg = raw
+					}
+					client.conn.WriteMessage(websocket.TextMessage, msg)
+				}
+			})
+		}
+	})
+	for _, name := range []string{"std", "fast"} {
+		b.Run(name, func(b *testing.B) {
+			encoder, _ = marketdata.NewEncoder(name)
+			defer func() { encoder = marketdata.FastEncoder{} }()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				broadcastToChannel(channel, candle)
+			}
+			clientHub.do(func(map[*WSClient]bool) {}) // Wait for the fan-out
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/marketdata"
+)
+
+// depthChannel carries an instrument's best price levels, e.g.
+// "depth:BTC-USD": a snapshot on subscribing, then the levels that change,
+// each with a checksum of the book clients can verify theirs against
+func depthChannel(symbol string) string {
+	return "depth:" + symbol
+}
+
+// bookDepth is the depth feed of the instrument traded, or nil until
+// publishDepth sets it up
+var bookDepth *marketdata.DepthFeed
+
+// publishDepth broadcasts the price levels that change whenever a trade or
+// order change may have moved them
+func publishDepth(handler *api.Handler) {
+	inst, _ := instruments.Lookup(exchange.DefaultSymbol)
+	feed := marketdata.NewDepthFeed(inst)
+	publish := func(events.Event) {
+		buyOrders, sellOrders, seq := handler.Exchange.SequencedOrderBook()
+		feed.Update(seq, exchange.Levels(buyOrders, marketdata.DepthLevels), exchange.Levels(sellOrders, marketdata.DepthLevels), func(update marketdata.DepthUpdate) {
+			broadcastToChannel(depthChannel(update.Symbol), update)
+		})
+	}
+	handler.Events.Subscribe(events.TradeExecuted, publish)
+	handler.Events.Subscribe(events.OrderUpdated, publish)
+	publish(events.Event{})
+	bookDepth = feed
+}
+
+// sendDepthSnapshot sends a client that subscribed to the depth channel the
+// levels it starts from. It goes through the hub after any updates already
+// being fanned out, which the client discards, and before the next update.
+func sendDepthSnapshot(client *WSClient) {
+	bookDepth.Snapshot(func(snapshot marketdata.DepthUpdate) {
+		data, err := json.Marshal(wsMessage{Channel: depthChannel(snapshot.Symbol), Data: snapshot})
+		if err != nil {
+			return
+		}
+		msg, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+		if err != nil {
+			return
+		}
+		clientHub.send(disconnectOnOverflow, func(c *WSClient) *websocket.PreparedMessage {
+			if c != client {
+				return nil
+			}
+			return msg
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestDepthChannel(t *testing.T) {
+	handler := api.NewHandler(nil, exchange.NewExchange(), nil)
+	publishDepth(handler)
+	defer func() { bookDepth = nil }()
+
+	registered := make(chan *WSClient, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := newWSClient(conn, make(map[string]bool), false, 0)
+		clientHub.register(client)
+		registered <- client
+	}))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	client := <-registered
+	defer removeAllClients()
+
+	read := func() marketdata.DepthUpdate {
+		t.Helper()
+		var msg struct {
+			Channel string                 `json:"channel"`
+			Data    marketdata.DepthUpdate `json:"data"`
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if msg.Channel != "depth:BTC-USD" {
+			t.Fatalf("unexpected channel %q", msg.Channel)
+		}
+		return msg.Data
+	}
+
+	// Subscribing sends the current levels
+	handler.Exchange.AddOrder(models.Order{ID: 1, Type: "buy", Price: 99, Quantity: 1, Status: "open"})
+	handler.Events.Publish(events.Event{Type: events.OrderUpdated})
+	handleWSRequest(context.Background(), client, []byte(`{"op":"subscribe","channel":"depth:BTC-USD"}`), nil)
+	snapshot := read()
+	for snapshot.Type != "snapshot" {
+		snapshot = read() // An update fanned out as the client subscribed
+	}
+	if snapshot.Type != "snapshot" || snapshot.Sequence != 1 || len(snapshot.Bids) != 1 || snapshot.Bids[0] != (exchange.Level{Price: 99, Quantity: 1}) {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// Then each change, checksummed
+	handler.Exchange.AddOrder(models.Order{ID: 2, Type: "sell", Price: 101, Quantity: 2, Status: "open"})
+	handler.Events.Publish(events.Event{Type: events.OrderUpdated})
+	update := read()
+	wantAsks := []exchange.Level{{Price: 101, Quantity: 2}}
+	if update.Type != "update" || update.Sequence != 2 || len(update.Bids) != 0 || len(update.Asks) != 1 || update.Asks[0] != wantAsks[0] {
+		t.Fatalf("unexpected update %+v", update)
+	}
+	if update.Checksum != marketdata.Checksum(instruments.All[0], snapshot.Bids, wantAsks) {
+		t.Error("expected the checksum of the book after the update")
+	}
+}
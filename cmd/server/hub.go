@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// overflowPolicy is what happens to a client whose send queue is full when
+// a message is fanned out to it
+type overflowPolicy int
+
+const (
+	// disconnectOnOverflow closes the client, which must reconnect to catch
+	// up. For messages a client can't do without, such as trades and order
+	// updates.
+	disconnectOnOverflow overflowPolicy = iota
+
+	// dropOnOverflow skips the message for the client. For snapshots, which
+	// the next one supersedes.
+	dropOnOverflow
+)
+
+// hubQueueSize is how many messages may wait to be fanned out before
+// broadcasters block
+const hubQueueSize = 1024
+
+// outbound is a message for the hub to fan out
+type outbound struct {
+	messageFor func(client *WSClient) *websocket.PreparedMessage // The message for a client, or nil to skip it
+	overflow   overflowPolicy
+}
+
+// hub owns the set of WebSocket clients and fans messages out to their send
+// queues from one goroutine. Broadcasters hand it a message and return, and
+// never wait on a client's connection or on each other.
+type hub struct {
+	clients   map[*WSClient]bool // Only accessed by run
+	broadcast chan outbound
+	calls     chan hubCall
+}
+
+// hubCall runs fn on the client set in the hub's goroutine
+type hubCall struct {
+	fn   func(clients map[*WSClient]bool)
+	done chan struct{}
+}
+
+// clientHub serves every WebSocket client
+var clientHub = startHub()
+
+// startHub returns a running hub
+func startHub() *hub {
+	h := &hub{
+		clients:   make(map[*WSClient]bool),
+		broadcast: make(chan outbound, hubQueueSize),
+		calls:     make(chan hubCall),
+	}
+	go h.run()
+	return h
+}
+
+func (h *hub) run() {
+	for {
+		select {
+		case out := <-h.broadcast:
+			for client := range h.clients {
+				if msg := out.messageFor(client); msg != nil {
+					client.enqueue(msg, out.overflow)
+				}
+			}
+		case call := <-h.calls:
+			call.fn(h.clients)
+			close(call.done)
+		}
+	}
+}
+
+// do runs fn on the client set and waits for it. Messages broadcast before
+// it is called are fanned out first.
+func (h *hub) do(fn func(clients map[*WSClient]bool)) {
+	call := hubCall{fn: fn, done: make(chan struct{})}
+	h.calls <- call
+	<-call.done
+}
+
+// send fans a message out, using messageFor to pick each client's message
+func (h *hub) send(overflow overflowPolicy, messageFor func(client *WSClient) *websocket.PreparedMessage) {
+	h.broadcast <- outbound{messageFor: messageFor, overflow: overflow}
+}
+
+// register adds a client to the set and starts writing its messages and
+// pinging it. It receives messages broadcast from when register returns.
+func (h *hub) register(client *WSClient) {
+	h.do(func(clients map[*WSClient]bool) { clients[client] = true })
+	go client.writePump()
+}
+
+// unregister removes a client from the set and closes it
+func (h *hub) unregister(client *WSClient) {
+	h.do(func(clients map[*WSClient]bool) { delete(clients, client) })
+	client.close()
+}
+
+// count returns the number of clients
+func (h *hub) count() int {
+	var n int
+	h.do(func(clients map[*WSClient]bool) { n = len(clients) })
+	return n
+}
+
+// reap closes and removes clients that were closed, e.g. for being too
+// slow, or haven't answered a ping within pongWait of now, so they stop
+// receiving broadcasts even before their read loops notice. It returns the
+// number removed.
+func (h *hub) reap(now time.Time) int {
+	reaped := 0
+	h.do(func(clients map[*WSClient]bool) {
+		for client := range clients {
+			if client.closed() || now.Sub(time.Unix(0, client.lastPong.Load())) > pongWait {
+				client.close()
+				delete(clients, client)
+				reaped++
+			}
+		}
+	})
+	return reaped
+}
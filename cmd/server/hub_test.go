@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_Reap(t *testing.T) {
+	live, _ := dialClient(t)
+	stale, _ := dialClient(t)
+	dropped, _ := dialClient(t)
+	now := time.Now()
+	stale.lastPong.Store(now.Add(-pongWait - time.Second).UnixNano())
+	dropped.close()
+	for _, client := range []*WSClient{live, stale, dropped} {
+		clientHub.register(client)
+	}
+	defer removeAllClients()
+
+	if reaped := clientHub.reap(now); reaped != 2 {
+		t.Errorf("expected 2 clients reaped, got %d", reaped)
+	}
+	if n := clientHub.count(); n != 1 || live.closed() || !stale.closed() {
+		t.Errorf("expected only the live client to remain open and registered, got %d clients", n)
+	}
+}
+
+func TestHub_SlowClientDoesNotBlockOthers(t *testing.T) {
+	slow, _ := dialClient(t)
+	fast, peer := dialClient(t)
+	defer removeAllClients()
+
+	// The slow client's write pump never runs, so its queue fills up
+	clientHub.do(func(clients map[*WSClient]bool) { clients[slow] = true })
+	clientHub.register(fast)
+	msg, _ := websocket.NewPreparedMessage(websocket.TextMessage, []byte(`{"channel":"market"}`))
+	for i := 0; i < sendQueueSize+1; i++ {
+		clientHub.send(disconnectOnOverflow, func(client *WSClient) *websocket.PreparedMessage { return msg })
+		if _, _, err := peer.ReadMessage(); err != nil {
+			t.Fatalf("Failed to read message %d: %v", i, err)
+		}
+	}
+	clientHub.do(func(map[*WSClient]bool) {}) // Wait for the last fan-out
+	if !slow.closed() || fast.closed() {
+		t.Errorf("expected only the slow client to be disconnected")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/mqtt"
+)
+
+// MQTT topics under the bridge's prefix, for each instrument
+const (
+	mqttTickerTopic = "ticker" // As returned by GET /ticker
+	mqttBBOTopic    = "bbo"    // As returned by GET /bbo
+)
+
+// mqttRefreshInterval is the time between republishing the ticker, whose
+// 24h statistics change as trades leave the window, and the best bid/offer.
+// Unchanged messages aren't sent again.
+const mqttRefreshInterval = 10 * time.Second
+
+// mqttTopic returns an instrument's topic path, e.g. "BTC-USD/ticker"
+func mqttTopic(symbol, topic string) string {
+	return symbol + "/" + topic
+}
+
+// publishMQTT mirrors the ticker and best bid/offer to an MQTT broker: the
+// ticker after each trade, the best bid/offer after each trade or order
+// change, and both every mqttRefreshInterval until ctx is done
+func publishMQTT(ctx context.Context, bridge *mqtt.Bridge, handler *api.Handler) {
+	publishTicker := func() {
+		bridge.Publish(mqttTopic(exchange.DefaultSymbol, mqttTickerTopic), handler.CurrentTicker(time.Now()))
+	}
+	publishBBO := func() {
+		bridge.Publish(mqttTopic(exchange.DefaultSymbol, mqttBBOTopic), handler.CurrentBBO())
+	}
+
+	handler.Events.Subscribe(events.TradeExecuted, func(events.Event) {
+		publishTicker()
+		publishBBO()
+	})
+	handler.Events.Subscribe(events.OrderUpdated, func(events.Event) {
+		publishBBO()
+	})
+
+	publishTicker()
+	publishBBO()
+	go func() {
+		ticker := time.NewTicker(mqttRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				publishTicker()
+				publishBBO()
+			}
+		}
+	}()
+}
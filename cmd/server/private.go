@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Private channels carry a user's own updates, and may only be subscribed to
+// by a client authenticated as them
+const (
+	ordersChannel   = "orders"   // Each change to the user's orders, from acceptance or rejection on
+	fillsChannel    = "fills"    // The user's side of each trade, as returned by GET /fills
+	balancesChannel = "balances" // The user's balances after each trade, as returned by GET /balances
+)
+
+var privateChannels = map[string]bool{ordersChannel: true, fillsChannel: true, balancesChannel: true}
+
+// sendToUser sends a channel message to the user's clients subscribed to a
+// private channel
+func sendToUser(userID int, channel string, payload interface{}) {
+	data, err := encoder.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal %s message: %v", channel, err)
+		return
+	}
+	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, marketdata.ChannelMessage(channel, data))
+	if err != nil {
+		log.Printf("Failed to prepare %s message: %v", channel, err)
+		return
+	}
+
+	clientHub.send(disconnectOnOverflow, func(client *WSClient) *websocket.PreparedMessage {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if client.userID != userID || !client.channels[channel] {
+			return nil
+		}
+		return msg
+	})
+}
+
+// userSubscribed reports whether any of the user's clients subscribed to a
+// private channel, so updates that must be loaded are only loaded if wanted
+func userSubscribed(userID int, channel string) bool {
+	subscribed := false
+	clientHub.do(func(clients map[*WSClient]bool) {
+		for client := range clients {
+			client.mu.Lock()
+			subscribed = client.userID == userID && client.channels[channel]
+			client.mu.Unlock()
+			if subscribed {
+				return
+			}
+		}
+	})
+	return subscribed
+}
+
+// subscribePrivateChannels delivers order updates, fills and balances to the
+// clients of the users they belong to
+func subscribePrivateChannels(bus *events.Bus, database *db.DB) {
+	bus.Subscribe(events.OrderUpdated, func(e events.Event) {
+		update := e.Data.(models.OrderUpdate)
+		sendToUser(update.UserID, ordersChannel, update)
+	})
+
+	bus.Subscribe(events.TradeExecuted, func(e events.Event) {
+		trade := e.Data.(models.Trade)
+		userIDs := []int{trade.BuyUserID}
+		if trade.SellUserID != trade.BuyUserID {
+			userIDs = append(userIDs, trade.SellUserID)
+		}
+
+		ctx := context.Background()
+		for _, userID := range userIDs {
+			if userSubscribed(userID, fillsChannel) {
+				sendFills(ctx, database, userID, trade.ID)
+			}
+			if userSubscribed(userID, balancesChannel) {
+				balances, err := database.GetBalances(ctx, userID)
+				if err != nil {
+					log.Printf("Failed to get balances for user %d: %v", userID, err)
+					continue
+				}
+				sendToUser(userID, balancesChannel, balances)
+			}
+		}
+	})
+}
+
+// sendFills sends the user's fills from a trade: one, or one for each side
+// of a self-trade
+func sendFills(ctx context.Context, database *db.DB, userID, tradeID int) {
+	fills, err := database.GetUserFills(ctx, userID, tradeID, 1)
+	if err != nil {
+		log.Printf("Failed to get fills for trade %d: %v", tradeID, err)
+		return
+	}
+	for _, fill := range fills {
+		if fill.TradeID != tradeID {
+			continue
+		}
+		if inst, ok := instruments.Lookup(fill.Symbol); ok {
+			fill.FeeCurrency = inst.Quote
+		}
+		sendToUser(userID, fillsChannel, fill)
+	}
+}
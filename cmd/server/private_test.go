@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestPrivateChannels(t *testing.T) {
+	registered := make(chan *WSClient, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := newWSClient(conn, make(map[string]bool), false, 0)
+		clientHub.register(client)
+		registered <- client
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	client := <-registered
+	defer removeAllClients()
+
+	authenticate := func(ctx context.Context, creds api.StreamCredentials) (api.StreamSession, error) {
+		if creds.Token != "valid" {
+			return api.StreamSession{}, errors.New("Invalid or expired token")
+		}
+		return api.StreamSession{UserID: 7, CancelOnDisconnect: creds.CancelOnDisconnect}, nil
+	}
+	expect := func(want wsMessage) {
+		t.Helper()
+		_, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("expected %s, got %s", wantJSON, got)
+		}
+	}
+	ctx := context.Background()
+
+	// Private channels need authentication
+	handleWSRequest(ctx, client, []byte(`{"op":"subscribe","channel":"orders"}`), authenticate)
+	expect(wsMessage{Channel: errorChannel, Data: map[string]string{"op": "subscribe", "channel": "orders", "error": "Authentication required"}})
+
+	handleWSRequest(ctx, client, []byte(`{"op":"auth","token":"forged"}`), authenticate)
+	expect(wsMessage{Channel: errorChannel, Data: map[string]string{"op": "auth", "channel": "", "error": "Invalid or expired token"}})
+
+	handleWSRequest(ctx, client, []byte(`{"op":"auth","token":"valid"}`), authenticate)
+	expect(wsMessage{Channel: authChannel, Data: authReply{UserID: 7}})
+
+	// Only the user's own updates are delivered
+	handleWSRequest(ctx, client, []byte(`{"op":"subscribe","channel":"orders"}`), authenticate)
+	sendToUser(8, ordersChannel, models.OrderUpdate{Event: "accepted", OrderID: 1, UserID: 8, Status: "open"})
+	sendToUser(7, fillsChannel, models.Fill{TradeID: 1, OrderID: 2}) // Not subscribed
+	update := models.OrderUpdate{Event: "canceled", OrderID: 2, UserID: 7, Status: "canceled"}
+	sendToUser(7, ordersChannel, update)
+	expect(wsMessage{Channel: ordersChannel, Data: update})
+
+	if !userSubscribed(7, ordersChannel) || userSubscribed(7, balancesChannel) || userSubscribed(8, ordersChannel) {
+		t.Error("unexpected subscriptions")
+	}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	client := newWSClient(nil, make(map[string]bool), false, 0) // Replies are only queued
+
+	authenticate := func(ctx context.Context, creds api.StreamCredentials) (api.StreamSession, error) {
+		return api.StreamSession{UserID: 7, CancelOnDisconnect: creds.CancelOnDisconnect}, nil
+	}
+	var canceledFor []int
+	cancelOrders := func(ctx context.Context, userID int) (int, error) {
+		canceledFor = append(canceledFor, userID)
+		return 2, nil
+	}
+	ctx := context.Background()
+
+	// Anonymous clients and those that didn't opt in keep their orders
+	cancelOnDisconnect(client, cancelOrders)
+	handleWSRequest(ctx, client, []byte(`{"op":"auth","token":"valid"}`), authenticate)
+	cancelOnDisconnect(client, cancelOrders)
+	if len(canceledFor) != 0 {
+		t.Fatalf("expected no orders canceled, got %v", canceledFor)
+	}
+
+	handleWSRequest(ctx, client, []byte(`{"op":"auth","token":"valid","cancel_on_disconnect":true}`), authenticate)
+	cancelOnDisconnect(client, cancelOrders)
+	if len(canceledFor) != 1 || canceledFor[0] != 7 {
+		t.Errorf("expected user 7's orders canceled, got %v", canceledFor)
+	}
+
+	// Authenticating again without it turns it off
+	handleWSRequest(ctx, client, []byte(`{"op":"auth","token":"valid"}`), authenticate)
+	cancelOnDisconnect(client, cancelOrders)
+	if len(canceledFor) != 1 {
+		t.Errorf("expected cancel-on-disconnect turned off, got %v", canceledFor)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/xtrntr/exchange/internal/api"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/journal"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// replayJournal records in the database whatever journaled matches didn't
+// reach it before the server stopped, returning the recovered trades. Each
+// step is idempotent, so entries that were fully recorded change nothing.
+func replayJournal(ctx context.Context, database *db.DB, entries []journal.Entry) ([]models.Trade, error) {
+	var recovered []models.Trade
+	for _, entry := range entries {
+		switch entry.Type {
+		case journal.OrdersMatched:
+			for i, journaled := range entry.Trades {
+				trade := journaled.Model(entry.Seq, i)
+				recorded, err := database.TradeRecorded(ctx, trade.JournalRef)
+				if err != nil {
+					return nil, err
+				}
+				if recorded {
+					continue
+				}
+				dbTrade, err := database.CreateTrade(ctx, &trade)
+				if err != nil {
+					return nil, fmt.Errorf("failed to recover trade %s: %w", trade.JournalRef, err)
+				}
+				recovered = append(recovered, *dbTrade)
+			}
+			if err := setOrderStatus(ctx, database, entry.Filled, "filled"); err != nil {
+				return nil, err
+			}
+			if err := setOrderStatus(ctx, database, entry.Canceled, "canceled"); err != nil {
+				return nil, err
+			}
+
+		case journal.OrdersCanceled:
+			// Cancels reach the database before the book, so this only
+			// repeats what is already recorded
+			if err := setOrderStatus(ctx, database, entry.Canceled, "canceled"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return recovered, nil
+}
+
+// setOrderStatus sets the status of each order
+func setOrderStatus(ctx context.Context, database *db.DB, orderIDs []int, status string) error {
+	for _, orderID := range orderIDs {
+		if err := database.UpdateOrderStatus(ctx, orderID, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBook rebuilds the order book. It starts from the latest snapshot
+// when the journal holds every entry since, refreshing from the database
+// only the orders those entries touched and those created after it, and
+// otherwise loads every open order. Orders loaded from the database rest
+// with the quantity they have left after their fills. An order that would
+// cross the book was accepted but never matched, so it was never
+// acknowledged; it is canceled rather than matched now.
+func restoreBook(ctx context.Context, database *db.DB, ex *exchange.Exchange, journ *journal.Journal, entries []journal.Entry) error {
+	resting, loaded, ok, err := loadFromSnapshot(ctx, database, journ, entries)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if loaded, err = database.GetOpenOrders(ctx); err != nil {
+			return fmt.Errorf("failed to load open orders: %w", err)
+		}
+	}
+
+	orderIDs := make([]int, len(loaded))
+	for i, order := range loaded {
+		orderIDs[i] = order.ID
+	}
+	filled, err := database.GetFilledQuantities(ctx, orderIDs)
+	if err != nil {
+		return err
+	}
+
+	var exhausted []int
+	for _, order := range loaded {
+		order.Quantity -= filled[order.ID]
+		if order.Quantity <= 1e-9 {
+			// Its last fill was recorded but not its status
+			exhausted = append(exhausted, order.ID)
+			continue
+		}
+		resting = append(resting, order)
+	}
+	if err := setOrderStatus(ctx, database, exhausted, "filled"); err != nil {
+		return err
+	}
+
+	crossed := ex.Restore(resting)
+	if err := setOrderStatus(ctx, database, crossed, "canceled"); err != nil {
+		return err
+	}
+	for _, orderID := range crossed {
+		log.Printf("Recovery: canceled order %d, which was accepted but never matched", orderID)
+	}
+
+	log.Printf("Loaded %d open orders into exchange", len(resting)-len(crossed))
+	return nil
+}
+
+// loadFromSnapshot returns the snapshot's orders that no later journal entry
+// touched, and the open orders to load from the database in their place
+// along with those created after the snapshot. Returns false if there is no
+// usable snapshot.
+func loadFromSnapshot(ctx context.Context, database *db.DB, journ *journal.Journal, entries []journal.Entry) ([]models.Order, []models.Order, bool, error) {
+	if journ == nil {
+		return nil, nil, false, nil
+	}
+	snapshot, err := database.GetLatestBookSnapshot(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if snapshot == nil || !journ.Covers(snapshot.Seq) {
+		return nil, nil, false, nil
+	}
+	var book exchange.Snapshot
+	if err := json.Unmarshal(snapshot.State, &book); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to parse book snapshot %d: %w", snapshot.ID, err)
+	}
+
+	touched := make(map[int]bool)
+	var touchedIDs []int
+	later := 0
+	for _, entry := range entries {
+		if entry.Seq <= snapshot.Seq {
+			continue
+		}
+		later++
+		for _, orderID := range entry.OrderIDs() {
+			if !touched[orderID] {
+				touched[orderID] = true
+				touchedIDs = append(touchedIDs, orderID)
+			}
+		}
+	}
+
+	var resting []models.Order
+	for _, order := range book.Orders() {
+		if !touched[order.ID] {
+			resting = append(resting, order)
+		}
+	}
+
+	refreshed, err := database.GetOrdersByIDs(ctx, touchedIDs)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var loaded []models.Order
+	for _, order := range refreshed {
+		if order.Status == "open" && order.ID <= snapshot.LastOrderID {
+			loaded = append(loaded, order)
+		}
+	}
+	created, err := database.GetOpenOrdersAfter(ctx, snapshot.LastOrderID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	loaded = append(loaded, created...)
+
+	log.Printf("Restoring order book from snapshot %d: kept %d orders, loaded %d after %d later journal entries",
+		snapshot.ID, len(resting), len(loaded), later)
+	return resting, loaded, true, nil
+}
+
+// snapshotAndCheckpoint snapshots the book, then discards the journal. The
+// checkpoint goes ahead if the snapshot fails: the journal then no longer
+// covers the older snapshot, so the next start loads every open order.
+func snapshotAndCheckpoint(ctx context.Context, handler *api.Handler, journ *journal.Journal) error {
+	if err := handler.SaveBookSnapshot(ctx); err != nil {
+		log.Printf("Failed to save book snapshot: %v", err)
+	}
+	return journ.Checkpoint()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS sets server up to serve HTTPS if cfg enables it, and returns
+// the function that serves it. With a redirect address it also returns a
+// server redirecting plain HTTP there, which answers autocert's challenges.
+func configureTLS(cfg *config.Config, server *http.Server) (serve func() error, redirect *http.Server) {
+	if !cfg.TLSEnabled() {
+		return server.ListenAndServe, nil
+	}
+
+	certFile, keyFile := cfg.TLSCertFile, cfg.TLSKeyFile
+	var redirectHandler http.Handler = redirectToHTTPS(cfg.ListenAddr)
+	if len(cfg.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		redirectHandler = manager.HTTPHandler(redirectHandler)
+	}
+	if cfg.HTTPRedirectAddr != "" {
+		redirect = &http.Server{Addr: cfg.HTTPRedirectAddr, Handler: redirectHandler, ReadHeaderTimeout: 10 * time.Second}
+	}
+	return func() error { return server.ListenAndServeTLS(certFile, keyFile) }, redirect
+}
+
+// redirectToHTTPS redirects requests to the same host and path on the HTTPS
+// server listening on listenAddr
+func redirectToHTTPS(listenAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(listenAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// hsts tells browsers to only use HTTPS for maxAge, including on subdomains
+func hsts(maxAge time.Duration) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d; includeSubDomains", int64(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
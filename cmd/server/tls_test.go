@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTLSRedirect(t *testing.T) {
+	tests := []struct {
+		listenAddr string
+		target     string
+		want       string
+	}{
+		{":443", "http://example.com/api/v1/orderbook?depth=5", "https://example.com/api/v1/orderbook?depth=5"},
+		{":8443", "http://example.com:80/health", "https://example.com:8443/health"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.listenAddr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s on %s: expected a redirect to %s, got %d to %q", tt.target, tt.listenAddr, tt.want, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestTLSHSTS(t *testing.T) {
+	handler := hsts(24 * time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("unexpected Strict-Transport-Security %q", got)
+	}
+}
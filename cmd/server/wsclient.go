@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client heartbeats and writes
+const (
+	writeWait     = 10 * time.Second  // Longest a write to a client may take
+	pongWait      = 60 * time.Second  // Longest a client may go without answering a ping
+	pingPeriod    = pongWait * 9 / 10 // How often clients are pinged, leaving time for the pong
+	sendQueueSize = 256               // Messages queued for a client before its overflow policy applies
+	reapInterval  = pingPeriod        // How often stale clients are pruned
+)
+
+type WSClient struct {
+	conn      *websocket.Conn
+	send      chan *websocket.PreparedMessage // Messages waiting to be written by writePump
+	done      chan struct{}                   // Closed once the client is closed
+	closeOnce sync.Once
+	lastPong  atomic.Int64 // Unix nanoseconds of the last pong, or of the connection
+
+	mu                 sync.Mutex      // Guards channels, userID and cancelOnDisconnect
+	channels           map[string]bool // Channels the client subscribed to, e.g. "candles:1m"
+	raw                bool            // Binance stream client: channel data is sent unwrapped and the order book is not pushed
+	userID             int             // User the client authenticated as, or 0; only they receive its private channels
+	cancelOnDisconnect bool            // Cancel the user's open orders once the client disconnects
+}
+
+// newWSClient returns a client for a connection. It receives nothing until
+// registered with the hub.
+func newWSClient(conn *websocket.Conn, channels map[string]bool, raw bool, userID int) *WSClient {
+	client := &WSClient{
+		conn:     conn,
+		send:     make(chan *websocket.PreparedMessage, sendQueueSize),
+		done:     make(chan struct{}),
+		channels: channels,
+		raw:      raw,
+		userID:   userID,
+	}
+	client.lastPong.Store(time.Now().UnixNano())
+	return client
+}
+
+// enqueue queues a message for the client without blocking. A client whose
+// queue is full isn't keeping up, so rather than hold up everyone else the
+// message is dropped or the client closed, as overflow says.
+func (c *WSClient) enqueue(msg *websocket.PreparedMessage, overflow overflowPolicy) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		if overflow == dropOnOverflow {
+			return
+		}
+		log.Printf("Disconnecting WebSocket client %s: send queue full", c.conn.RemoteAddr())
+		c.close()
+	}
+}
+
+// enqueueText prepares and queues a text message for the client, closing it
+// if its queue is full
+func (c *WSClient) enqueueText(data []byte) {
+	msg, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		log.Printf("Failed to prepare message: %v", err)
+		return
+	}
+	c.enqueue(msg, disconnectOnOverflow)
+}
+
+// close closes the connection, which ends the client's read loop and write
+// pump. It may be called more than once.
+func (c *WSClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// closed reports whether the client has been closed
+func (c *WSClient) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// writePump writes the client's queued messages and pings it, until the
+// client is closed or a write fails or times out
+func (c *WSClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WritePreparedMessage(msg); err != nil {
+				if !c.closed() {
+					log.Printf("Failed to send message: %v", err)
+				}
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// readLoop passes each message from the client to handle until the client
+// disconnects, closes or misses a pong, then unregisters it
+func (c *WSClient) readLoop(handle func(msg []byte)) {
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.lastPong.Store(time.Now().UnixNano())
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		handle(msg)
+	}
+	clientHub.unregister(c)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialClient returns the server side of a new WebSocket connection, not yet
+// registered, and the connection it was dialed from. Both are closed when the
+// test ends.
+func dialClient(t *testing.T) (*WSClient, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := newWSClient(<-accepted, make(map[string]bool), false, 0)
+	t.Cleanup(client.close)
+	return client, conn
+}
+
+func TestWSClient_Overflow(t *testing.T) {
+	msg, _ := websocket.NewPreparedMessage(websocket.TextMessage, []byte(`{}`))
+	for _, tt := range []struct {
+		overflow   overflowPolicy
+		wantClosed bool
+	}{
+		{dropOnOverflow, false},
+		{disconnectOnOverflow, true},
+	} {
+		// Nothing drains the queue, as if writes to the client had stalled
+		client, _ := dialClient(t)
+		for i := 0; i < sendQueueSize; i++ {
+			client.enqueue(msg, tt.overflow)
+		}
+		if client.closed() {
+			t.Fatal("expected a client with a full queue to stay open")
+		}
+		client.enqueue(msg, tt.overflow)
+		if client.closed() != tt.wantClosed || len(client.send) != sendQueueSize {
+			t.Errorf("policy %d: expected closed %t with a full queue, got %t with %d queued", tt.overflow, tt.wantClosed, client.closed(), len(client.send))
+		}
+	}
+}
+
+func TestWSClient_Pong(t *testing.T) {
+	client, peer := dialClient(t)
+	before := client.lastPong.Load()
+	go client.readLoop(func([]byte) {})
+
+	// The peer answers pings while it reads
+	go func() {
+		for {
+			if _, _, err := peer.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); client.lastPong.Load() == before; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pong to be recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
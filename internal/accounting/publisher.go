@@ -0,0 +1,176 @@
+// Package accounting delivers finalized trades and ledger entries to
+// back-office systems as signed, batched webhooks.
+//
+// Batches are created in an outbox table in the same transaction that
+// claims their trades and entries, so each trade and entry is in exactly one
+// batch, and a batch is posted until the receiver acknowledges it with a 2xx
+// status. A batch can be posted more than once, e.g. if the acknowledgement
+// is lost or an admin replays it, so receivers should ignore batch IDs they
+// have already processed; together that gives exactly-once processing.
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// Headers sent with each batch. The signature is the hex HMAC-SHA256, under
+// the shared secret, of the timestamp, a period and the body.
+const (
+	BatchIDHeader   = "X-Accounting-Batch-Id"
+	TimestampHeader = "X-Accounting-Timestamp" // Unix milliseconds
+	SignatureHeader = "X-Accounting-Signature"
+)
+
+// pageSize is how many stored batches are loaded at a time for delivery
+const pageSize = 100
+
+// Sign returns the signature of a batch body sent at timestamp, in Unix
+// milliseconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	return auth.Sign(secret, strconv.FormatInt(timestamp, 10)+"."+string(body))
+}
+
+// Publisher batches trades and ledger entries and posts the batches to a
+// webhook, oldest first
+type Publisher struct {
+	DB        *db.DB
+	URL       string
+	Secret    string
+	BatchSize int // Most trades, and most ledger entries, in one batch
+	Client    *http.Client
+
+	mu sync.Mutex // Serializes flushes and replays so batches are posted in order
+}
+
+// NewPublisher creates a publisher posting to url, signed with secret
+func NewPublisher(database *db.DB, url, secret string, batchSize int) *Publisher {
+	return &Publisher{
+		DB:        database,
+		URL:       url,
+		Secret:    secret,
+		BatchSize: batchSize,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// post sends one batch to the webhook
+func (p *Publisher) post(ctx context.Context, batch db.OutboxBatch) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(batch.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := time.Now().UnixMilli()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(BatchIDHeader, strconv.Itoa(batch.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(p.Secret, timestamp, batch.Payload))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post batch %d: %w", batch.ID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("accounting webhook returned status %d for batch %d", resp.StatusCode, batch.ID)
+	}
+	return nil
+}
+
+// deliver posts a batch and records the outcome
+func (p *Publisher) deliver(ctx context.Context, batch db.OutboxBatch) error {
+	postErr := p.post(ctx, batch)
+	if err := p.DB.RecordAccountingDelivery(ctx, batch.ID, postErr); err != nil {
+		return err
+	}
+	return postErr
+}
+
+// Flush batches every trade and ledger entry not yet in a batch, then posts
+// undelivered batches oldest first, stopping at the first failure so the
+// receiver sees batches in order. Returns how many batches were delivered.
+func (p *Publisher) Flush(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		batch, err := p.DB.CreateAccountingBatch(ctx, p.BatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if batch == nil {
+			break
+		}
+	}
+
+	delivered := 0
+	for {
+		batches, err := p.DB.GetUndeliveredAccountingBatches(ctx, pageSize)
+		if err != nil {
+			return delivered, err
+		}
+		if len(batches) == 0 {
+			return delivered, nil
+		}
+		for _, batch := range batches {
+			if err := p.deliver(ctx, batch); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+	}
+}
+
+// Replay posts the batches with IDs from fromID to toID inclusive again,
+// whether or not they were delivered, stopping at the first failure. A zero
+// toID replays through the latest batch. Returns how many were delivered.
+func (p *Publisher) Replay(ctx context.Context, fromID, toID int) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	replayed := 0
+	for {
+		batches, err := p.DB.GetAccountingBatches(ctx, fromID, toID, pageSize)
+		if err != nil {
+			return replayed, err
+		}
+		if len(batches) == 0 {
+			return replayed, nil
+		}
+		for _, batch := range batches {
+			if err := p.deliver(ctx, batch); err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+		fromID = batches[len(batches)-1].ID + 1
+	}
+}
+
+// Run flushes every interval until ctx is done. Failed deliveries are
+// retried on the next flush.
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if delivered, err := p.Flush(ctx); err != nil {
+				log.Printf("Failed to deliver accounting batches: %v", err)
+			} else if delivered > 0 {
+				log.Printf("Delivered %d accounting batches", delivered)
+			}
+		}
+	}
+}
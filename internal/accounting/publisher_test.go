@@ -0,0 +1,58 @@
+package accounting
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+func TestPublisher_Post(t *testing.T) {
+	var got http.Header
+	var body []byte
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	p := NewPublisher(nil, server.URL, "secret", 100)
+	batch := db.OutboxBatch{ID: 7, Payload: []byte(`{"batch_id": 7}`)}
+	if err := p.post(context.Background(), batch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != string(batch.Payload) {
+		t.Errorf("expected payload as body, got %s", body)
+	}
+	if got.Get(BatchIDHeader) != "7" {
+		t.Errorf("expected batch ID 7, got %q", got.Get(BatchIDHeader))
+	}
+	timestamp, err := strconv.ParseInt(got.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp %q", got.Get(TimestampHeader))
+	}
+	if got.Get(SignatureHeader) != Sign("secret", timestamp, body) {
+		t.Errorf("signature doesn't verify: %q", got.Get(SignatureHeader))
+	}
+
+	status = http.StatusInternalServerError
+	if err := p.post(context.Background(), batch); err == nil {
+		t.Error("expected an error for a non-2xx status")
+	}
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("secret", 1700000000000, []byte(`{}`))
+	if signature == Sign("secret", 1700000000001, []byte(`{}`)) {
+		t.Error("expected the timestamp to be signed")
+	}
+	if signature == Sign("other", 1700000000000, []byte(`{}`)) {
+		t.Error("expected the secret to change the signature")
+	}
+}
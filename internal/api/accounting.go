@@ -0,0 +1,71 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// GetAccountingBatches lists accounting batches and their delivery state,
+// starting at batch ID from_id. Page through with from_id set to the last
+// id + 1.
+func (h *Handler) GetAccountingBatches(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fromID := 0
+	if v := query.Get("from_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "from_id must be a non-negative integer")
+			return
+		}
+		fromID = id
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	batches, err := h.DB.GetAccountingBatches(r.Context(), fromID, 0, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve accounting batches")
+		return
+	}
+	writeJSON(w, http.StatusOK, batches)
+}
+
+// ReplayAccountingBatches posts a range of accounting batches to the
+// webhook again, e.g. for batches the receiver missed. Omitting
+// to_batch_id replays through the latest batch.
+func (h *Handler) ReplayAccountingBatches(w http.ResponseWriter, r *http.Request) {
+	if h.Accounting == nil {
+		writeError(w, http.StatusServiceUnavailable, "Accounting webhook not configured")
+		return
+	}
+
+	var req batchReplayRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.ToBatchID > 0 && req.ToBatchID < req.FromBatchID {
+		writeError(w, http.StatusBadRequest, "Invalid batch range")
+		return
+	}
+
+	replayed, err := h.Accounting.Replay(r.Context(), req.FromBatchID, req.ToBatchID)
+	if err != nil {
+		log.Printf("Accounting replay from batch %d stopped after %d batches: %v", req.FromBatchID, replayed, err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"code":     statusCode(http.StatusBadGateway),
+			"error":    "Replay failed",
+			"replayed": replayed,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"replayed": replayed})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/journal"
+)
+
+// GetBalances returns the user's balances from the ledger
+func (h *Handler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	balances, err := h.DB.GetBalances(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve balances")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, balances)
+}
+
+// GetProfile returns the user's account
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := h.Store.GetUserByID(r.Context(), userID)
+	if errors.Is(err, db.ErrUserNotFound) {
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profileResponse{
+		ID:             user.ID,
+		Username:       user.Username,
+		Role:           user.Role,
+		KYCTier:        user.KYCTier,
+		ServiceAccount: user.ServiceAccount,
+		CreatedAt:      user.CreatedAt,
+	})
+}
+
+// ChangePassword changes the user's password given their current one. Every
+// other session is revoked, so only the request's own token keeps working.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req passwordChangeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	sessionID, _ := r.Context().Value("session_id").(int)
+	err := h.AuthService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword, sessionID)
+	var weak *auth.WeakPasswordError
+	switch {
+	case errors.Is(err, auth.ErrWrongPassword):
+		writeCodedError(w, http.StatusForbidden, codeWrongPassword, "Current password is incorrect")
+		return
+	case errors.As(err, &weak):
+		writeWeakPassword(w, weak)
+		return
+	case errors.Is(err, auth.ErrServiceAccount):
+		writeError(w, http.StatusForbidden, "Service accounts have no password")
+		return
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messageResponse{Message: "Password changed"})
+}
+
+// ChangeUsername renames the user's account. The old username is kept in
+// the account's history and becomes available to others.
+func (h *Handler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req usernameRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.AuthService.ChangeUsername(r.Context(), userID, req.Username)
+	switch {
+	case errors.Is(err, db.ErrUsernameTaken):
+		writeCodedError(w, http.StatusConflict, codeUsernameTaken, "Username already taken")
+		return
+	case errors.Is(err, auth.ErrUsernameReserved):
+		writeCodedError(w, http.StatusConflict, codeUsernameReserved, "Username is reserved")
+		return
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to change username")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userResponse{ID: user.ID, Username: user.Username})
+}
+
+// GetUsernameChanges returns a user's username history for audit
+func (h *Handler) GetUsernameChanges(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	changes, err := h.DB.GetUsernameChanges(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve username changes")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// MergeAccounts folds a duplicate account into another. The source's orders
+// and trades are re-attributed to the target, including orders resting on
+// the book, and its balances are moved with ledger entries. The source can
+// no longer log in.
+func (h *Handler) MergeAccounts(w http.ResponseWriter, r *http.Request) {
+	var req mergeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.SourceUserID == req.TargetUserID {
+		writeError(w, http.StatusBadRequest, "Cannot merge an account into itself")
+		return
+	}
+
+	merge, err := h.DB.MergeAccounts(r.Context(), req.SourceUserID, req.TargetUserID)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case errors.Is(err, db.ErrAccountMerged):
+		writeError(w, http.StatusConflict, "Account already merged")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to merge accounts")
+		return
+	}
+
+	// Orders resting on every market now belong to the target. The merge is
+	// committed, so a market that's shut down only leaves its orders with
+	// the source until they're reloaded from the database.
+	moved, err := h.Markets.ReassignOrders(req.SourceUserID, req.TargetUserID)
+	if err != nil {
+		log.Printf("Merge %d: failed to move resting orders: %v", merge.ID, err)
+	}
+	if len(moved) > 0 {
+		h.appendJournal(journal.Entry{Type: journal.OrdersUpdated, Updated: moved})
+		log.Printf("Merge %d: moved %d resting orders from user %d to user %d", merge.ID, len(moved), req.SourceUserID, req.TargetUserID)
+	}
+
+	writeJSON(w, http.StatusOK, merge)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+)
+
+// StampReceipt records when a request arrived so latency can be measured
+// from HTTP receipt. It should be the first middleware on the router.
+func (h *Handler) StampReceipt(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "received_at", time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminAuthMiddleware requires the configured admin token in the
+// X-Admin-Token header. The token names no user, so changes made with it
+// are audited as admin requests from the client's IP.
+func (h *Handler) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.AdminToken == "" {
+			writeError(w, http.StatusForbidden, "Admin API disabled")
+			return
+		}
+		token := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+		ctx := db.WithActor(r.Context(), db.Actor{Source: db.SourceAdmin, IP: clientIP(r)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetSLOStatus reports order acknowledgement latency against its SLO and
+// how it breaks down across the stages of handling an order
+func (h *Handler) GetSLOStatus(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"order_ack_latency": h.Latency.Status(now),
+		"order_stages":      h.Stages.Status(now),
+	})
+}
+
+// PauseMatching stops the matching engine. Orders are accepted and queued,
+// and cancels are still processed, until matching is resumed.
+func (h *Handler) PauseMatching(w http.ResponseWriter, r *http.Request) {
+	if !h.Exchange.Pause() {
+		writeError(w, http.StatusConflict, "Matching already paused")
+		return
+	}
+	log.Printf("Matching paused by admin")
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Matching paused"})
+}
+
+// ResumeMatching restarts the matching engine, matching queued orders in
+// arrival order and recording the resulting trades
+func (h *Handler) ResumeMatching(w http.ResponseWriter, r *http.Request) {
+	if paused, _, _ := h.Exchange.PauseState(); !paused {
+		writeError(w, http.StatusConflict, "Matching not paused")
+		return
+	}
+
+	trades, filledOrderIDs, canceledOrderIDs, processed := h.Exchange.Resume()
+	if err := h.recordMatches(r.Context(), trades, filledOrderIDs, canceledOrderIDs); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("Matching resumed by admin: %d queued orders produced %d trades", processed, len(trades))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":          "Matching resumed",
+		"orders_processed": processed,
+		"trades":           len(trades),
+	})
+}
+
+// GetEngineStats reports the matching engine's resting orders, memory
+// estimates, buffer pool use and match timing, how many commands each
+// market has queued, and the process heap
+func (h *Handler) GetEngineStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"engine": h.Exchange.Stats(),
+		"queues": h.Markets.QueueLengths(),
+		"runtime": map[string]interface{}{
+			"heap_alloc_bytes":  mem.HeapAlloc,
+			"heap_objects":      mem.HeapObjects,
+			"total_alloc_bytes": mem.TotalAlloc,
+			"num_gc":            mem.NumGC,
+			"gc_pause_total_ns": mem.PauseTotalNs,
+		},
+	})
+}
+
+// SetMarketState opens, halts or moves the market to post-only or a call
+// auction and announces the change to WebSocket clients. An auction with a
+// duration is uncrossed automatically once it elapses.
+func (h *Handler) SetMarketState(w http.ResponseWriter, r *http.Request) {
+	var req marketStateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	state := exchange.MarketState(req.State)
+	var until time.Time
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 || state != exchange.MarketAuction {
+			writeError(w, http.StatusBadRequest, "Duration must be a positive duration such as '5m', and only applies to auctions")
+			return
+		}
+		until = time.Now().Add(duration)
+	}
+
+	var status exchange.MarketStatus
+	var err error
+	if state == exchange.MarketAuction {
+		status, err = h.Exchange.StartAuction(req.Reason, until)
+	} else {
+		status, err = h.Exchange.SetMarketState(state, req.Reason)
+	}
+	if errors.Is(err, exchange.ErrMarketTransition) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"code":   codeMarketTransition,
+			"error":  "Market can't move from " + string(status.State) + " to " + string(state),
+			"market": status,
+		})
+		return
+	}
+	log.Printf("Market moved to %s by admin: %s", state, req.Reason)
+	h.Events.Publish(events.Event{Type: events.MarketStateChanged, Data: status})
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// GetStatus reports whether the exchange is accepting and matching orders
+func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	paused, since, queued := h.Exchange.PauseState()
+
+	market := h.Exchange.MarketStatus()
+	response := statusResponse{
+		Market:       market,
+		Auction:      h.indicativeAuction(market),
+		Matching:     "running",
+		QueuedOrders: queued,
+		Status:       "ok",
+	}
+	if paused {
+		response.Matching = "paused"
+		response.PausedSince = &since
+	}
+	if h.draining.Load() {
+		response.Status = "shutting_down"
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// channelSettings is a channel's broadcast settings as shown to admins
+type channelSettings struct {
+	SnapshotIntervalMs int64 `json:"snapshot_interval_ms"`
+	MaxDepth           int   `json:"max_depth"`
+	ConflationMs       int64 `json:"conflation_ms"`
+}
+
+func newChannelSettings(s config.ChannelSettings) channelSettings {
+	return channelSettings{
+		SnapshotIntervalMs: s.SnapshotInterval.Milliseconds(),
+		MaxDepth:           s.MaxDepth,
+		ConflationMs:       s.Conflation.Milliseconds(),
+	}
+}
+
+// GetChannelSettings returns the broadcast settings of every WebSocket channel
+func (h *Handler) GetChannelSettings(w http.ResponseWriter, r *http.Request) {
+	response := make(map[string]channelSettings)
+	for channel, s := range h.Channels.All() {
+		response[channel] = newChannelSettings(s)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// UpdateChannelSettings changes a channel's broadcast settings. They take
+// effect immediately; omitted fields keep their current values.
+func (h *Handler) UpdateChannelSettings(w http.ResponseWriter, r *http.Request) {
+	channel := chi.URLParam(r, "channel")
+	if _, ok := h.Channels.All()[channel]; !ok {
+		writeError(w, http.StatusNotFound, "Unknown channel")
+		return
+	}
+
+	var req channelSettingsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	settings := h.Channels.Get(channel)
+	if req.SnapshotIntervalMs != nil {
+		settings.SnapshotInterval = time.Duration(*req.SnapshotIntervalMs) * time.Millisecond
+	}
+	if req.MaxDepth != nil {
+		settings.MaxDepth = *req.MaxDepth
+	}
+	if req.ConflationMs != nil {
+		settings.Conflation = time.Duration(*req.ConflationMs) * time.Millisecond
+	}
+	if err := h.Channels.Set(channel, settings); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid settings: "+err.Error())
+		return
+	}
+	log.Printf("Channel %s settings changed by admin: %+v", channel, settings)
+
+	writeJSON(w, http.StatusOK, newChannelSettings(settings))
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// userInfo is a user as shown to admins, without credentials
+type userInfo struct {
+	ID         int       `json:"id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"`
+	KYCTier    int       `json:"kyc_tier"`
+	Suspended  bool      `json:"suspended"`
+	MergedInto int       `json:"merged_into,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	ServiceAccount bool `json:"service_account"`
+}
+
+func newUserInfo(user *models.User) userInfo {
+	return userInfo{
+		ID:         user.ID,
+		Username:   user.Username,
+		Role:       user.Role,
+		KYCTier:    user.KYCTier,
+		Suspended:  user.Suspended,
+		MergedInto: user.MergedInto,
+		CreatedAt:  user.CreatedAt,
+
+		ServiceAccount: user.ServiceAccount,
+	}
+}
+
+// ListUsers returns a page of all users
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r.URL.Query(), db.IsValidUserSort)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	users, err := h.DB.ListUsers(r.Context(), page)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	infos := make([]userInfo, len(users))
+	for i := range users {
+		infos[i] = newUserInfo(&users[i])
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// GetUserOrdersAdmin returns any user's orders, with the same filters and
+// paging as GET /orders
+func (h *Handler) GetUserOrdersAdmin(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	filter, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r.URL.Query(), db.IsValidOrderSort)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.Store.GetUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve orders")
+		return
+	}
+
+	orders, err := h.Store.GetUserOrders(r.Context(), userID, filter, page)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve orders")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orders)
+}
+
+// ForceCancelOrder cancels any user's open order
+func (h *Handler) ForceCancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(r.Context(), orderID)
+	if err == nil {
+		err = h.DB.CancelOrder(r.Context(), orderID, order.UserID)
+	}
+	var notOpen *db.OrderNotOpenError
+	switch {
+	case errors.As(err, &notOpen):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"code":     codeOrderNotOpen,
+			"error":    "Order already " + notOpen.Status,
+			"order_id": orderID,
+			"status":   notOpen.Status,
+		})
+		return
+	case errors.Is(err, db.ErrOrderNotFound):
+		writeCodedError(w, http.StatusNotFound, codeOrderNotFound, "Order not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to cancel order")
+		return
+	}
+
+	if h.unbookOrders(r.Context(), orderID) == 0 {
+		log.Printf("Order %d not found in order book", orderID)
+	}
+	log.Printf("Admin %v force-canceled order %d of user %d", r.Context().Value("user_id"), orderID, order.UserID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":  "Order canceled",
+		"order_id": orderID,
+		"user_id":  order.UserID,
+		"status":   "canceled",
+	})
+}
+
+// SuspendUser suspends an account and cancels its open orders. Suspended
+// users can't log in, and their tokens and API keys stop working.
+func (h *Handler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if adminID, _ := r.Context().Value("user_id").(int); adminID == userID {
+		writeError(w, http.StatusBadRequest, "Cannot suspend your own account")
+		return
+	}
+
+	orderIDs, err := h.DB.SuspendUser(r.Context(), userID)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+
+	h.unbookOrders(r.Context(), orderIDs...)
+	log.Printf("Admin %v suspended user %d, canceling %d orders", r.Context().Value("user_id"), userID, len(orderIDs))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":         userID,
+		"suspended":       true,
+		"canceled_orders": orderIDs,
+	})
+}
+
+// UnsuspendUser lifts an account's suspension
+func (h *Handler) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = h.DB.UnsuspendUser(r.Context(), userID)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to unsuspend user")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":   userID,
+		"suspended": false,
+	})
+}
+
+// SetUserRole grants or revokes a role. It's served to the operator token
+// rather than to admins so the first admin can be created.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req roleRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.DB.SetUserRole(r.Context(), userID, req.Role)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to set role")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserInfo(user))
+}
+
+// GetOrderLimits returns a user's per-order limits
+func (h *Handler) GetOrderLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if _, err := h.DB.GetUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve order limits")
+		return
+	}
+
+	limits, err := h.DB.GetOrderLimits(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve order limits")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, limits)
+}
+
+// UpdateOrderLimits replaces a user's per-order limits. Zero lifts a limit.
+// Orders already open aren't affected.
+func (h *Handler) UpdateOrderLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var limits models.OrderLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if limits.MaxOrderNotional < 0 || limits.MaxOrderQuantity < 0 || limits.MaxOpenOrders < 0 {
+		writeError(w, http.StatusBadRequest, "Limits cannot be negative")
+		return
+	}
+
+	if _, err := h.DB.GetUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to save order limits")
+		return
+	}
+
+	if err := h.DB.SaveOrderLimits(r.Context(), userID, limits); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save order limits")
+		return
+	}
+	log.Printf("Admin %v set order limits for user %d: %+v", r.Context().Value("user_id"), userID, limits)
+
+	writeJSON(w, http.StatusOK, limits)
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// maxSignedBody is the largest request body a signed request may have
+const maxSignedBody = 1 << 20
+
+// signedPayload returns the string a client signs: the raw query string with
+// the signature parameter removed, followed by the raw request body, without
+// its signature parameter if it's a form. The body is restored so handlers
+// can still decode it. Bodies above maxSignedBody fail with a
+// *http.MaxBytesError.
+func signedPayload(w http.ResponseWriter, r *http.Request) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBody))
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	payload := string(body)
+	if isFormBody(r) {
+		payload = withoutSignature(payload)
+	}
+	return withoutSignature(r.URL.RawQuery) + payload, nil
+}
+
+// withoutSignature removes the signature parameter from URL-encoded parameters
+func withoutSignature(params string) string {
+	var kept []string
+	for _, param := range strings.Split(params, "&") {
+		if param != "" && !strings.HasPrefix(param, "signature=") {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// isFormBody reports whether a request's body is URL-encoded parameters
+func isFormBody(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// authenticateAPIKey verifies a signed API-key request and passes it on with
+// the key owner's user_id and the key's api_key_scopes in the context
+func (h *Handler) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	payload, err := signedPayload(w, r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeCodedError(w, http.StatusRequestEntityTooLarge, codeInvalidBody, "Request body too large")
+		return
+	}
+	if err != nil {
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	query := r.URL.Query()
+	signature := r.Header.Get("X-SIGNATURE")
+	if signature == "" {
+		signature = query.Get("signature")
+	}
+	if signature == "" {
+		writeError(w, http.StatusUnauthorized, "Signature required")
+		return
+	}
+
+	apiKey, err := h.AuthService.VerifyRequest(r.Context(), r.Header.Get("X-API-KEY"), signature, payload,
+		query.Get("timestamp"), query.Get("recvWindow"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid API key request: "+err.Error())
+		return
+	}
+	if scope := auth.RequiredScope(r.Method); !slices.Contains(apiKey.Scopes, scope) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", scope))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), "api_key_scopes", apiKey.Scopes)
+	h.serveAsUser(w, r.WithContext(ctx), next, apiKey.UserID)
+}
+
+// RequireScope rejects API-key requests whose key lacks a scope, on top of
+// the one the request's method needs. It must run after JWTAuthMiddleware;
+// requests with a token have every scope.
+func (h *Handler) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, ok := r.Context().Value("api_key_scopes").([]string); ok && !slices.Contains(scopes, scope) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// managesAPIKeys reports whether a request may create, change or revoke the
+// user's API keys, writing an error if not. Keys are managed with a token:
+// a request signed with an API key could otherwise mint a key with scopes
+// its own key lacks.
+func managesAPIKeys(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value("api_key_scopes").([]string); ok {
+		writeError(w, http.StatusForbidden, "API keys can't be managed with an API key")
+		return false
+	}
+	if serviceAccount, _ := r.Context().Value("service_account").(bool); serviceAccount {
+		writeError(w, http.StatusForbidden, "Service account keys are managed by admins")
+		return false
+	}
+	return true
+}
+
+// apiKeyRequest is the body of a new API key
+type apiKeyRequest struct {
+	Label  string   `json:"label" validate:"max=64"`
+	Scopes []string `json:"scopes"` // Defaults to read and trade
+
+	CancelOnDisconnect bool `json:"cancel_on_disconnect"`
+}
+
+// CreateAPIKey issues a new API key; the secret is only returned here
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !managesAPIKeys(w, r) {
+		return
+	}
+	h.issueAPIKey(w, r, userID)
+}
+
+// issueAPIKey creates an API key for a user from an apiKeyRequest body
+func (h *Handler) issueAPIKey(w http.ResponseWriter, r *http.Request, userID int) {
+	var req apiKeyRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope %q (must be one of %s)", scope, strings.Join(auth.Scopes, ", ")))
+			return
+		}
+	}
+
+	apiKey, err := h.AuthService.CreateAPIKey(r.Context(), userID, req.Label, req.Scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	if req.CancelOnDisconnect {
+		if _, err := h.DB.SetAPIKeyCancelOnDisconnect(r.Context(), apiKey.ID, userID, true); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		apiKey.CancelOnDisconnect = true
+	}
+
+	writeJSON(w, http.StatusCreated, apiKey)
+}
+
+// ListAPIKeys lists the user's active API keys
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keys, err := h.DB.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve API keys")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// apiKeySettingsRequest is the body of PUT /api-keys/{id}
+type apiKeySettingsRequest struct {
+	CancelOnDisconnect *bool `json:"cancel_on_disconnect" validate:"required"`
+}
+
+// UpdateAPIKey changes the settings of one of the user's API keys
+func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !managesAPIKeys(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+	var req apiKeySettingsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	apiKey, err := h.DB.SetAPIKeyCancelOnDisconnect(r.Context(), id, userID, *req.CancelOnDisconnect)
+	if errors.Is(err, db.ErrAPIKeyNotFound) {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update API key")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiKey)
+}
+
+// RevokeAPIKey revokes one of the user's API keys
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !managesAPIKeys(w, r) {
+		return
+	}
+	h.revokeAPIKey(w, r, "id", userID)
+}
+
+// revokeAPIKey revokes the user's API key whose ID is the named URL parameter
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request, param string, userID int) {
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = h.DB.RevokeAPIKey(r.Context(), id, userID)
+	if errors.Is(err, db.ErrAPIKeyNotFound) {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messageResponse{Message: "API key revoked"})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+)
+
+// uncross ends the auction on the matching goroutine, so no order arrives
+// mid-uncross, then records its trades and announces the reopening. Ties
+// between uncrossing prices are broken towards the last traded price.
+func (h *Handler) uncross(ctx context.Context, reason string) (exchange.AuctionResult, exchange.MarketStatus, error) {
+	reference := h.Ticker.Stats(time.Now()).LastPrice
+	var result exchange.AuctionResult
+	var status exchange.MarketStatus
+	var err error
+	if doErr := h.Markets.Do(exchange.DefaultSymbol, func(ex *exchange.Exchange) {
+		result, status, err = ex.Uncross(reference, reason)
+	}); doErr != nil {
+		return result, status, doErr
+	}
+	if err != nil {
+		return result, status, err
+	}
+
+	log.Printf("Auction uncrossed at %g for %g (%d trades): %s", result.Price, result.Volume, len(result.Trades), reason)
+	h.Events.Publish(events.Event{Type: events.MarketStateChanged, Data: status})
+	return result, status, h.recordMatches(ctx, result.Trades, result.Filled, result.Canceled)
+}
+
+// UncrossAuction ends the call auction now, trading every crossing order at
+// the uncrossing price and opening the market
+func (h *Handler) UncrossAuction(w http.ResponseWriter, r *http.Request) {
+	result, status, err := h.uncross(r.Context(), "uncrossed by admin")
+	if errors.Is(err, exchange.ErrMarketTransition) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"code":   codeMarketTransition,
+			"error":  "Market isn't in an auction",
+			"market": status,
+		})
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"auction": result,
+		"trades":  len(result.Trades),
+		"market":  status,
+	})
+}
+
+// RunAuctions uncrosses a scheduled auction once its end has passed,
+// checking every interval until ctx is done
+func (h *Handler) RunAuctions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			status := h.Exchange.MarketStatus()
+			if status.State != exchange.MarketAuction || status.Until == nil || now.Before(*status.Until) {
+				continue
+			}
+			_, _, err := h.uncross(ctx, "scheduled auction end")
+			if err != nil && !errors.Is(err, exchange.ErrMarketTransition) && ctx.Err() == nil {
+				log.Printf("Failed to uncross auction: %v", err)
+			}
+		}
+	}
+}
+
+// auctionStatus is the price and quantity an auction would uncross at now
+type auctionStatus struct {
+	IndicativePrice  float64 `json:"indicative_price"`  // Zero if the book doesn't cross
+	IndicativeVolume float64 `json:"indicative_volume"` // Quantity that would trade
+}
+
+// indicativeAuction returns the auction's indicative uncrossing, or nil if
+// the market isn't in an auction
+func (h *Handler) indicativeAuction(market exchange.MarketStatus) *auctionStatus {
+	if market.State != exchange.MarketAuction {
+		return nil
+	}
+	price, volume := h.Exchange.IndicativeAuction(h.Ticker.Stats(time.Now()).LastPrice)
+	return &auctionStatus{IndicativePrice: price, IndicativeVolume: volume}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// GetAuditLog returns the recorded changes to orders and trades, oldest
+// first, optionally narrowed to one entity, actor or action and a time range
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.AuditFilter{
+		EntityType: query.Get("entity_type"),
+		Action:     query.Get("action"),
+	}
+	switch filter.EntityType {
+	case "", "order", "trade":
+	default:
+		writeError(w, http.StatusBadRequest, "Entity type must be 'order' or 'trade'")
+		return
+	}
+
+	ids := map[string]*int{"entity_id": &filter.EntityID, "actor_id": &filter.ActorID}
+	for name, id := range ids {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, name+" must be a positive integer")
+				return
+			}
+			*id = n
+		}
+	}
+	if filter.EntityID != 0 && filter.EntityType == "" {
+		writeError(w, http.StatusBadRequest, "entity_id requires entity_type")
+		return
+	}
+
+	var err error
+	if filter.Since, filter.Until, err = parseTimeRange(query); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	var fromID int64
+	if v := query.Get("from_id"); v != "" {
+		fromID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || fromID < 0 {
+			writeError(w, http.StatusBadRequest, "from_id must be a non-negative integer")
+			return
+		}
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	entries, err := h.DB.GetAuditLog(r.Context(), filter, fromID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/journal"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/pricefeed"
+	"github.com/xtrntr/exchange/internal/risk"
+)
+
+// maxBatchSize bounds the number of orders placed or canceled in one batch
+const maxBatchSize = 20
+
+// batchResult is the outcome of one item of a batch, in submission order
+type batchResult struct {
+	OrderID int    `json:"order_id,omitempty"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"` // Why the item was rejected, as in error responses
+	Error   string `json:"error,omitempty"`
+	Field   string `json:"field,omitempty"`
+}
+
+// rejectedResult is a batch item rejected with err
+func rejectedResult(status int, err error) batchResult {
+	resp := newErrorResponse(status, err)
+	return batchResult{Status: "rejected", Code: resp.Code, Error: resp.Error, Field: resp.Field}
+}
+
+// PlaceOrdersBatch places up to maxBatchSize orders. Each order is validated
+// and risk checked on its own; the accepted orders are then matched in
+// submission order as one step, so no other order can interleave with them.
+func (h *Handler) PlaceOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var reqs []orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, "Batch must contain 1 to 20 orders")
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load preferences")
+		return
+	}
+
+	results := make([]batchResult, len(reqs))
+	var orders []models.Order
+	var holds []*risk.Reservation // Reservations of the accepted orders
+	h.snapshotMu.RLock()
+	for i := range reqs {
+		req := &reqs[i]
+		req.applyPreferences(prefs)
+		if err := req.validate(); err != nil {
+			results[i] = rejectedResult(http.StatusBadRequest, err)
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+		if req.needsConfirmation(prefs) {
+			results[i] = batchResult{Status: "rejected", Code: codeConfirmationNeeded, Error: "Order notional above confirmation threshold"}
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+
+		var bandErr *pricefeed.BandError
+		if errors.As(h.checkPriceBand(req.Symbol, req.Price), &bandErr) {
+			results[i] = batchResult{Status: "rejected", Code: codePriceOutOfBand, Error: bandErr.Error()}
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+
+		err := h.checkOrderLimits(r.Context(), userID, req.Price, req.Quantity)
+		var orderLimitErr *risk.OrderLimitError
+		if errors.As(err, &orderLimitErr) {
+			results[i] = batchResult{Status: "rejected", Code: orderLimitErr.Limit, Error: orderLimitMessages[orderLimitErr.Limit]}
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+		if err != nil {
+			results[i] = rejectedResult(http.StatusInternalServerError, err)
+			continue
+		}
+
+		// Earlier orders in the batch hold their notional already
+		hold, err := h.checkRisk(r.Context(), userID, req.Price*req.Quantity)
+		var limitErr *risk.LimitError
+		if errors.As(err, &limitErr) {
+			results[i] = batchResult{Status: "rejected", Code: codeDailyNotionalLimit, Error: "Daily notional limit exceeded"}
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+		if err != nil {
+			results[i] = rejectedResult(http.StatusInternalServerError, err)
+			continue
+		}
+
+		var throttled *exchange.ThrottledError
+		if errors.As(h.admitOrder(r.Context(), userID), &throttled) {
+			hold.Release()
+			results[i] = batchResult{Status: "rejected", Code: codeThrottled, Error: throttled.Error()}
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+
+		order := req.order(userID)
+		dbOrder, err := h.DB.CreateOrder(r.Context(), &order)
+		if errors.Is(err, db.ErrDuplicateClientOrderID) {
+			hold.Release()
+			results[i] = rejectedResult(http.StatusConflict, errClientOrderIDTaken)
+			h.publishRejection(userID, *req, results[i].Code, results[i].Error)
+			continue
+		}
+		if err != nil {
+			hold.Release()
+			results[i] = batchResult{Status: "rejected", Code: statusCode(http.StatusInternalServerError), Error: "Failed to create order"}
+			continue
+		}
+		hold.Assign(dbOrder.ID)
+		holds = append(holds, hold)
+		h.appendJournal(journal.Entry{Type: journal.OrderAccepted, OrderID: dbOrder.ID})
+		h.publishOrderUpdate("accepted", *dbOrder, 0)
+		orders = append(orders, *dbOrder)
+		results[i] = batchResult{OrderID: dbOrder.ID, Status: "open"}
+	}
+
+	// Match the accepted orders together
+	trades, filledOrderIDs, canceledOrderIDs, matchErr := h.Markets.MatchOrders(orders)
+	h.snapshotMu.RUnlock()
+	for range orders {
+		h.recordAckLatency(r.Context())
+	}
+	if err := h.recordMatches(r.Context(), trades, filledOrderIDs, canceledOrderIDs); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if matchErr != nil {
+		for _, hold := range holds {
+			hold.Release()
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to match orders")
+		return
+	}
+
+	for i := range results {
+		if results[i].OrderID == 0 {
+			continue
+		}
+		if slices.Contains(filledOrderIDs, results[i].OrderID) {
+			results[i].Status = "filled"
+		} else if slices.Contains(canceledOrderIDs, results[i].OrderID) {
+			results[i].Status = "canceled"
+		}
+	}
+
+	writeJSON(w, http.StatusOK, batchResponse{Results: results})
+}
+
+// CancelOrdersBatch cancels up to maxBatchSize orders by ID and removes the
+// canceled ones from the book as one step. Each ID gets its own result, with
+// the same semantics as cancelling it alone.
+func (h *Handler) CancelOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var orderIDs []int
+	if err := json.NewDecoder(r.Body).Decode(&orderIDs); err != nil {
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if len(orderIDs) == 0 || len(orderIDs) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, "Batch must contain 1 to 20 order IDs")
+		return
+	}
+
+	results := make([]batchResult, len(orderIDs))
+	var canceled []int
+	for i, orderID := range orderIDs {
+		results[i] = batchResult{OrderID: orderID}
+
+		err := h.DB.CancelOrder(r.Context(), orderID, userID)
+		var notOpen *db.OrderNotOpenError
+		switch {
+		case errors.As(err, &notOpen):
+			// Repeating a cancel succeeds, as for a single order
+			results[i].Status = notOpen.Status
+			if notOpen.Status != "canceled" {
+				results[i].Code = codeOrderNotOpen
+				results[i].Error = "Order already " + notOpen.Status
+			}
+		case errors.Is(err, db.ErrOrderNotFound):
+			results[i].Status = "rejected"
+			results[i].Code = codeOrderNotFound
+			results[i].Error = "Order not found"
+		case err != nil:
+			results[i].Status = "rejected"
+			results[i].Code = statusCode(http.StatusInternalServerError)
+			results[i].Error = "Failed to cancel order"
+		default:
+			results[i].Status = "canceled"
+			canceled = append(canceled, orderID)
+		}
+	}
+
+	// Remove all of them from the order book at once
+	if removed := h.unbookOrders(r.Context(), canceled...); removed != len(canceled) {
+		// Log if orders weren't in book (non-fatal, as DB is source of truth)
+		log.Printf("%d of %d canceled orders not found in order book", len(canceled)-removed, len(canceled))
+	}
+
+	writeJSON(w, http.StatusOK, batchResponse{Results: results})
+}
@@ -0,0 +1,937 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/pricefeed"
+	"github.com/xtrntr/exchange/internal/risk"
+)
+
+// Binance error codes returned by the compatibility API
+const (
+	binanceErrUnknown          = -1000
+	binanceErrTooManyOrders    = -1015
+	binanceErrTimestamp        = -1021
+	binanceErrSignature        = -1022
+	binanceErrIllegalParam     = -1100
+	binanceErrMandatoryParam   = -1102
+	binanceErrInvalidSymbol    = -1121
+	binanceErrNewOrderRejected = -2010
+	binanceErrCancelRejected   = -2011
+	binanceErrNoSuchOrder      = -2013
+	binanceErrAPIKeyFormat     = -2014
+	binanceErrRejectedAPIKey   = -2015
+)
+
+// binanceDefaultLimit and binanceMaxLimit bound list endpoints like Binance does
+const (
+	binanceDefaultLimit = 500
+	binanceMaxLimit     = 1000
+)
+
+// BinanceRouter returns a router exposing a subset of the Binance spot REST
+// API (/api/v3) on top of this exchange, so bots written against Binance can
+// trade here unchanged. Signed endpoints authenticate with the X-MBX-APIKEY
+// header and the same HMAC signature scheme as /api-keys.
+func (h *Handler) BinanceRouter() chi.Router {
+	r := chi.NewRouter()
+
+	// Market data
+	r.Group(func(r chi.Router) {
+		r.Use(h.RateLimit)
+		r.Get("/ping", h.binancePing)
+		r.Get("/time", h.binanceTime)
+		r.Get("/exchangeInfo", h.binanceExchangeInfo)
+		r.Get("/depth", h.binanceDepth)
+		r.Get("/trades", h.binanceTrades)
+		r.Get("/klines", h.binanceKlines)
+		r.Get("/ticker/24hr", h.binanceTicker24hr)
+		r.Get("/ticker/price", h.binanceTickerPrice)
+	})
+
+	// Signed trading endpoints
+	r.Group(func(r chi.Router) {
+		r.Use(h.binanceAuthMiddleware)
+		r.Use(h.RateLimit)
+		r.With(h.RouteToLeader, h.RejectWhileDraining, h.RejectWhileHalted).Post("/order", h.binanceNewOrder)
+		r.Get("/order", h.binanceQueryOrder)
+		r.With(h.RouteToLeader).Delete("/order", h.binanceCancelOrder)
+		r.Get("/openOrders", h.binanceOpenOrders)
+		r.Get("/myTrades", h.binanceMyTrades)
+	})
+	return r
+}
+
+// writeBinanceError writes an error in Binance's {"code","msg"} format
+func writeBinanceError(w http.ResponseWriter, status, code int, msg string) {
+	writeJSON(w, status, map[string]interface{}{"code": code, "msg": msg})
+}
+
+// BinanceSymbol converts a symbol like "BTC-USD" to Binance's "BTCUSD"
+func BinanceSymbol(symbol string) string {
+	return strings.ReplaceAll(symbol, "-", "")
+}
+
+// fromBinanceSymbol converts a Binance symbol back to a listed symbol
+func fromBinanceSymbol(symbol string) (string, bool) {
+	for _, inst := range instruments.All {
+		if strings.EqualFold(symbol, BinanceSymbol(inst.Symbol)) {
+			return inst.Symbol, true
+		}
+	}
+	return "", false
+}
+
+// binanceDecimal formats a number the way Binance does, as a fixed-point string
+func binanceDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', 8, 64)
+}
+
+// binanceOrderStatus maps an order status and filled quantity to Binance's order status
+func binanceOrderStatus(status string, executed float64) string {
+	switch status {
+	case "filled":
+		return "FILLED"
+	case "canceled":
+		return "CANCELED"
+	}
+	if executed > 0 {
+		return "PARTIALLY_FILLED"
+	}
+	return "NEW"
+}
+
+// isBuyerMaker reports whether the buy side of a trade was resting on the book
+func isBuyerMaker(trade models.Trade) bool {
+	return trade.TakerSide == "sell"
+}
+
+// binanceLimit parses the limit parameter of list endpoints
+func binanceLimit(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return binanceDefaultLimit, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 || limit > binanceMaxLimit {
+		return 0, false
+	}
+	return limit, true
+}
+
+// binanceSymbolParam reads and validates a required symbol parameter,
+// writing the error response if it is missing or unknown
+func binanceSymbolParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	v := r.FormValue("symbol")
+	if v == "" {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrMandatoryParam, "Mandatory parameter 'symbol' was not sent, was empty/null, or malformed.")
+		return "", false
+	}
+	symbol, ok := fromBinanceSymbol(v)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrInvalidSymbol, "Invalid symbol.")
+		return "", false
+	}
+	return symbol, true
+}
+
+// binanceStatsSymbolParam reads the symbol parameter of candles and ticker
+// statistics, which are only kept for the default market, writing the error
+// response for any other symbol. An optional symbol defaults to it.
+func binanceStatsSymbolParam(w http.ResponseWriter, r *http.Request, required bool) (string, bool) {
+	if !required && r.FormValue("symbol") == "" {
+		return exchange.DefaultSymbol, true
+	}
+	symbol, ok := binanceSymbolParam(w, r)
+	if ok && symbol != exchange.DefaultSymbol {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrInvalidSymbol, "Invalid symbol.")
+		return "", false
+	}
+	return symbol, ok
+}
+
+func (h *Handler) binancePing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (h *Handler) binanceTime(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int64{"serverTime": time.Now().UnixMilli()})
+}
+
+func (h *Handler) binanceExchangeInfo(w http.ResponseWriter, r *http.Request) {
+	symbols := make([]map[string]interface{}, 0, len(instruments.All))
+	for _, inst := range instruments.All {
+		symbols = append(symbols, map[string]interface{}{
+			"symbol":              BinanceSymbol(inst.Symbol),
+			"status":              "TRADING",
+			"baseAsset":           inst.Base,
+			"baseAssetPrecision":  inst.QuantityPrecision,
+			"quoteAsset":          inst.Quote,
+			"quoteAssetPrecision": inst.PricePrecision,
+			"orderTypes":          []string{"LIMIT"},
+			"permissions":         []string{"SPOT"},
+			"filters": []map[string]interface{}{
+				{
+					"filterType": "PRICE_FILTER",
+					"minPrice":   binanceDecimal(inst.MinPrice),
+					"maxPrice":   binanceDecimal(inst.MaxPrice),
+					"tickSize":   binanceDecimal(math.Pow10(-inst.PricePrecision)),
+				},
+				{
+					"filterType": "LOT_SIZE",
+					"minQty":     binanceDecimal(inst.MinQuantity),
+					"maxQty":     binanceDecimal(inst.MaxQuantity),
+					"stepSize":   binanceDecimal(math.Pow10(-inst.QuantityPrecision)),
+				},
+			},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"timezone":   "UTC",
+		"serverTime": time.Now().UnixMilli(),
+		"rateLimits": []interface{}{},
+		"symbols":    symbols,
+	})
+}
+
+// binanceDepth returns the order book aggregated into price levels
+func (h *Handler) binanceDepth(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := binanceSymbolParam(w, r)
+	if !ok {
+		return
+	}
+	ex, ok := h.Markets.Exchange(symbol)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrInvalidSymbol, "Invalid symbol.")
+		return
+	}
+	limit, ok := binanceLimit(r)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'limit'.")
+		return
+	}
+
+	// Responses are reused until the book changes
+	if response, ok := h.depth.get(symbol, ex.Sequence(), limit); ok {
+		writeEncoded(w, http.StatusOK, response)
+		return
+	}
+	buyOrders, sellOrders, seq := ex.SequencedOrderBook()
+	response, _ := json.Marshal(map[string]interface{}{
+		"lastUpdateId": seq,
+		"bids":         aggregateLevels(buyOrders, limit),
+		"asks":         aggregateLevels(sellOrders, limit),
+	})
+	h.depth.put(symbol, seq, limit, response)
+	writeEncoded(w, http.StatusOK, response)
+}
+
+// depthCache holds encoded depth responses by limit for one version of each
+// market's book
+type depthCache struct {
+	mu    sync.Mutex
+	books map[string]*depthBook
+}
+
+// depthBook is the responses cached for a market's book at one version
+type depthBook struct {
+	version   uint64
+	responses map[int][]byte
+}
+
+// get returns the response for a limit if it was encoded at this version
+func (c *depthCache) get(symbol string, version uint64, limit int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	book, ok := c.books[symbol]
+	if !ok || version != book.version {
+		return nil, false
+	}
+	response, ok := book.responses[limit]
+	return response, ok
+}
+
+// put stores a response, discarding those of older versions of the book
+func (c *depthCache) put(symbol string, version uint64, limit int, response []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	book, ok := c.books[symbol]
+	if ok && version < book.version {
+		return
+	}
+	if !ok || version > book.version {
+		if c.books == nil {
+			c.books = make(map[string]*depthBook)
+		}
+		book = &depthBook{version: version, responses: make(map[int][]byte)}
+		c.books[symbol] = book
+	}
+	book.responses[limit] = response
+}
+
+// aggregateLevels sums the displayed quantity at each price of a sorted book
+// side into at most limit [price, quantity] pairs
+func aggregateLevels(orders []models.Order, limit int) [][2]string {
+	levels := [][2]string{}
+	for _, level := range exchange.Levels(orders, limit) {
+		levels = append(levels, [2]string{binanceDecimal(level.Price), binanceDecimal(level.Quantity)})
+	}
+	return levels
+}
+
+// binanceTrades returns the most recent public trades, oldest first
+func (h *Handler) binanceTrades(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := binanceSymbolParam(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := binanceLimit(r)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'limit'.")
+		return
+	}
+
+	// GetRecentTrades is newest first
+	trades, err := h.DB.GetRecentTrades(r.Context(), symbol, 0, limit)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve trades")
+		return
+	}
+
+	response := make([]map[string]interface{}, 0, len(trades))
+	for i := len(trades) - 1; i >= 0; i-- {
+		t := trades[i]
+		response = append(response, map[string]interface{}{
+			"id":           t.ID,
+			"price":        binanceDecimal(t.Price),
+			"qty":          binanceDecimal(t.Quantity),
+			"quoteQty":     binanceDecimal(t.Price * t.Quantity),
+			"time":         t.ExecutedAt.UnixMilli(),
+			"isBuyerMaker": t.TakerSide == "sell",
+			"isBestMatch":  true,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// binanceKlines returns candles as Binance kline arrays. Quote volume, trade
+// counts and taker volumes aren't tracked and are reported as zero.
+func (h *Handler) binanceKlines(w http.ResponseWriter, r *http.Request) {
+	if _, ok := binanceStatsSymbolParam(w, r, true); !ok {
+		return
+	}
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	width, ok := marketdata.Intervals[interval]
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid interval.")
+		return
+	}
+	limit, ok := binanceLimit(r)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'limit'.")
+		return
+	}
+
+	end := time.Now().UTC()
+	if v := query.Get("endTime"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'endTime'.")
+			return
+		}
+		end = time.UnixMilli(ms).UTC()
+	}
+	start := end.Add(-time.Duration(limit) * width)
+	if v := query.Get("startTime"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'startTime'.")
+			return
+		}
+		start = time.UnixMilli(ms).UTC()
+	}
+
+	candles, err := h.DB.GetCandles(r.Context(), interval, marketdata.BucketStart(start, width), end)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve klines")
+		return
+	}
+	if len(candles) > limit {
+		candles = candles[:limit]
+	}
+
+	klines := make([][]interface{}, 0, len(candles))
+	for _, c := range candles {
+		klines = append(klines, []interface{}{
+			c.OpenTime.UnixMilli(),
+			binanceDecimal(c.Open),
+			binanceDecimal(c.High),
+			binanceDecimal(c.Low),
+			binanceDecimal(c.Close),
+			binanceDecimal(c.Volume),
+			c.OpenTime.Add(width).UnixMilli() - 1,
+			binanceDecimal(0),
+			0,
+			binanceDecimal(0),
+			binanceDecimal(0),
+			"0",
+		})
+	}
+	writeJSON(w, http.StatusOK, klines)
+}
+
+// binanceTicker24hr returns the ticker's rolling statistics and the best
+// prices on the book
+func (h *Handler) binanceTicker24hr(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := binanceStatsSymbolParam(w, r, false)
+	if !ok {
+		return
+	}
+	ex, ok := h.Markets.Exchange(symbol)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrInvalidSymbol, "Invalid symbol.")
+		return
+	}
+	now := time.Now()
+	stats := h.Ticker.Stats(now)
+	bid, ask := ex.BestPrices()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":             BinanceSymbol(symbol),
+		"priceChange":        binanceDecimal(stats.PriceChange),
+		"priceChangePercent": strconv.FormatFloat(stats.PriceChangePercent, 'f', 3, 64),
+		"lastPrice":          binanceDecimal(stats.LastPrice),
+		"bidPrice":           binanceDecimal(bid),
+		"askPrice":           binanceDecimal(ask),
+		"openPrice":          binanceDecimal(stats.LastPrice - stats.PriceChange),
+		"highPrice":          binanceDecimal(stats.High),
+		"lowPrice":           binanceDecimal(stats.Low),
+		"volume":             binanceDecimal(stats.Volume),
+		"openTime":           now.Add(-24 * time.Hour).UnixMilli(),
+		"closeTime":          now.UnixMilli(),
+		"count":              stats.TradeCount,
+	})
+}
+
+// binanceTickerPrice returns the last traded price
+func (h *Handler) binanceTickerPrice(w http.ResponseWriter, r *http.Request) {
+	symbol, ok := binanceStatsSymbolParam(w, r, false)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"symbol": BinanceSymbol(symbol),
+		"price":  binanceDecimal(h.Ticker.Stats(time.Now()).LastPrice),
+	})
+}
+
+// binanceAuthMiddleware verifies Binance-style signed requests: the key in
+// X-MBX-APIKEY and timestamp, recvWindow and signature parameters in the
+// query string or a form body
+func (h *Handler) binanceAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-MBX-APIKEY")
+		if key == "" {
+			writeBinanceError(w, http.StatusUnauthorized, binanceErrAPIKeyFormat, "API-key format invalid.")
+			return
+		}
+
+		payload, err := signedPayload(w, r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeBinanceError(w, http.StatusRequestEntityTooLarge, binanceErrIllegalParam, "Request body too large.")
+			return
+		}
+		if err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid request body.")
+			return
+		}
+
+		// The signed parameters may be in the query string or a form body
+		if err := r.ParseForm(); err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid request body.")
+			return
+		}
+		timestamp, recvWindow := r.Form.Get("timestamp"), r.Form.Get("recvWindow")
+		if err := auth.CheckTimestamp(timestamp, recvWindow, time.Now()); err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrTimestamp, "Timestamp for this request is outside of the recvWindow.")
+			return
+		}
+
+		apiKey, err := h.AuthService.VerifyRequest(r.Context(), key, r.Form.Get("signature"), payload, timestamp, recvWindow)
+		if err != nil {
+			writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Signature for this request is not valid.")
+			return
+		}
+		userID := apiKey.UserID
+		if !slices.Contains(apiKey.Scopes, auth.RequiredScope(r.Method)) {
+			writeBinanceError(w, http.StatusUnauthorized, binanceErrRejectedAPIKey, "Invalid API-key, IP, or permissions for action.")
+			return
+		}
+		if _, err := h.AuthService.ActiveUser(r.Context(), userID); err != nil {
+			writeBinanceError(w, http.StatusUnauthorized, binanceErrRejectedAPIKey, "Invalid API-key, IP, or permissions for action.")
+			return
+		}
+
+		// Add user_id to context
+		ctx := context.WithValue(r.Context(), "user_id", userID)
+		ctx = db.WithActor(ctx, db.Actor{UserID: userID, Source: db.SourceAPI, IP: clientIP(r)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// binanceOrder formats an order as a Binance order response, given the
+// quantity it has traded and the quote value of its fills
+func binanceOrder(order *models.Order, executed, executedQuote float64) map[string]interface{} {
+	return map[string]interface{}{
+		"symbol":              BinanceSymbol(order.Symbol),
+		"orderId":             order.ID,
+		"clientOrderId":       order.ClientOrderID,
+		"price":               binanceDecimal(order.Price),
+		"origQty":             binanceDecimal(order.Quantity),
+		"executedQty":         binanceDecimal(executed),
+		"cummulativeQuoteQty": binanceDecimal(executedQuote),
+		"status":              binanceOrderStatus(order.Status, executed),
+		"timeInForce":         binanceTimeInForce(order.TimeInForce),
+		"type":                binanceOrderType(order.PostOnly),
+		"side":                strings.ToUpper(order.Type),
+		"time":                order.CreatedAt.UnixMilli(),
+		"isWorking":           order.Status == "open",
+		"icebergQty":          binanceDecimal(order.DisplayQuantity),
+	}
+}
+
+// binanceTimeInForce defaults orders placed before time in force was recorded to GTC
+func binanceTimeInForce(tif string) string {
+	if tif == "" {
+		return "GTC"
+	}
+	return tif
+}
+
+// binanceOrderType reports post-only orders as LIMIT_MAKER
+func binanceOrderType(postOnly bool) string {
+	if postOnly {
+		return "LIMIT_MAKER"
+	}
+	return "LIMIT"
+}
+
+// binanceNewOrder places a limit order. newClientOrderId is stored as the
+// order's client order ID.
+func (h *Handler) binanceNewOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Unauthorized.")
+		return
+	}
+
+	symbol, ok := binanceSymbolParam(w, r)
+	if !ok {
+		return
+	}
+
+	side := strings.ToLower(r.FormValue("side"))
+	if side != "buy" && side != "sell" {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Side must be BUY or SELL.")
+		return
+	}
+	orderType := r.FormValue("type")
+	if orderType != "LIMIT" && orderType != "LIMIT_MAKER" {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, "Only LIMIT and LIMIT_MAKER orders are supported.")
+		return
+	}
+	tif := r.FormValue("timeInForce")
+	if tif == "" {
+		tif = "GTC"
+	}
+	if tif != "GTC" && tif != "IOC" && tif != "FOK" {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid timeInForce.")
+		return
+	}
+	if orderType == "LIMIT_MAKER" && tif != "GTC" {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "LIMIT_MAKER orders must be GTC.")
+		return
+	}
+	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
+	if err != nil || price <= 0 {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid price.")
+		return
+	}
+	quantity, err := strconv.ParseFloat(r.FormValue("quantity"), 64)
+	if err != nil || quantity <= 0 {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid quantity.")
+		return
+	}
+	instrument, _ := instruments.Lookup(symbol)
+	if err := instrument.ValidateOrder(price, quantity); err != nil {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, "Filter failure: "+err.Error()+".")
+		return
+	}
+	var icebergQty float64
+	if v := r.FormValue("icebergQty"); v != "" {
+		icebergQty, err = strconv.ParseFloat(v, 64)
+		if err != nil || icebergQty <= 0 {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Invalid icebergQty.")
+			return
+		}
+		if tif != "GTC" {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Iceberg orders must be GTC.")
+			return
+		}
+		if err := instrument.ValidateDisplayQuantity(icebergQty, quantity); err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, "Filter failure: "+err.Error()+".")
+			return
+		}
+	}
+	clientOrderID := r.FormValue("newClientOrderId")
+	if len(clientOrderID) > 64 {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "newClientOrderId too long.")
+		return
+	}
+
+	var bandErr *pricefeed.BandError
+	if errors.As(h.checkPriceBand(symbol, price), &bandErr) {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, bandErr.Error()+".")
+		return
+	}
+
+	var orderLimitErr *risk.OrderLimitError
+	if err := h.checkOrderLimits(r.Context(), userID, price, quantity); errors.As(err, &orderLimitErr) {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, orderLimitMessages[orderLimitErr.Limit]+".")
+		return
+	} else if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, err.Error())
+		return
+	}
+
+	var limitErr *risk.LimitError
+	hold, err := h.checkRisk(r.Context(), userID, price*quantity)
+	if errors.As(err, &limitErr) {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, "Daily notional limit exceeded.")
+		return
+	} else if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, err.Error())
+		return
+	}
+
+	dbOrder, trades, err := h.submitOrder(r.Context(), models.Order{
+		UserID:   userID,
+		Symbol:   symbol,
+		Type:     side,
+		Price:    price,
+		Quantity: quantity,
+		Status:   "open",
+
+		ClientOrderID: clientOrderID,
+
+		TimeInForce: tif,
+		PostOnly:    orderType == "LIMIT_MAKER",
+
+		DisplayQuantity: icebergQty,
+	}, hold)
+	var throttled *exchange.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		writeBinanceError(w, http.StatusTooManyRequests, binanceErrTooManyOrders, "Too many new orders.")
+		return
+	}
+	if errors.Is(err, errClientOrderIDTaken) {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNewOrderRejected, "Duplicate order sent.")
+		return
+	}
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, err.Error())
+		return
+	}
+
+	var executed, executedQuote float64
+	for _, trade := range trades {
+		executed += trade.Quantity
+		executedQuote += trade.Price * trade.Quantity
+	}
+
+	response := binanceOrder(dbOrder, executed, executedQuote)
+	response["transactTime"] = time.Now().UnixMilli()
+	writeJSON(w, http.StatusOK, response)
+}
+
+// binanceOrderRef reads the orderId or origClientOrderId parameter, one of
+// which is required. The client order ID is returned only if there's no
+// order ID.
+func binanceOrderRef(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	if v := r.FormValue("orderId"); v != "" {
+		orderID, err := strconv.Atoi(v)
+		if err != nil {
+			writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'orderId'.")
+			return 0, "", false
+		}
+		return orderID, "", true
+	}
+	if clientOrderID := r.FormValue("origClientOrderId"); clientOrderID != "" {
+		return 0, clientOrderID, true
+	}
+	writeBinanceError(w, http.StatusBadRequest, binanceErrMandatoryParam, "Param 'origClientOrderId' or 'orderId' must be sent, but both were empty/null!")
+	return 0, "", false
+}
+
+// binanceFindOrder looks up one of the user's orders by ID, or by client
+// order ID if the ID is zero, falling back to the archive for closed orders
+// the archiver has moved
+func (h *Handler) binanceFindOrder(ctx context.Context, userID, orderID int, clientOrderID string) (*models.Order, error) {
+	if orderID != 0 {
+		order, err := h.DB.GetOrder(ctx, orderID, userID)
+		if errors.Is(err, db.ErrOrderNotFound) {
+			return h.DB.GetArchivedOrder(ctx, orderID, userID)
+		}
+		return order, err
+	}
+	order, err := h.DB.GetOrderByClientID(ctx, userID, clientOrderID)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		return h.DB.GetArchivedOrderByClientID(ctx, userID, clientOrderID)
+	}
+	return order, err
+}
+
+// binanceOrderWithFills formats an order with the quantity and quote value
+// it has traded. Fills of closed orders may have been archived.
+func (h *Handler) binanceOrderWithFills(ctx context.Context, order *models.Order) (map[string]interface{}, error) {
+	filled, err := h.DB.GetFilledQuantities(ctx, []int{order.ID})
+	if err != nil {
+		return nil, err
+	}
+	notionals, err := h.DB.GetFilledNotionals(ctx, []int{order.ID})
+	if err != nil {
+		return nil, err
+	}
+	executed, executedQuote := filled[order.ID], notionals[order.ID]
+	if order.Status != "open" {
+		archived, archivedQuote, err := h.DB.GetArchivedFills(ctx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		executed += archived
+		executedQuote += archivedQuote
+	}
+	return binanceOrder(order, executed, executedQuote), nil
+}
+
+func (h *Handler) binanceQueryOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Unauthorized.")
+		return
+	}
+	orderID, clientOrderID, ok := binanceOrderRef(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.binanceFindOrder(r.Context(), userID, orderID, clientOrderID)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNoSuchOrder, "Order does not exist.")
+		return
+	}
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve order")
+		return
+	}
+	response, err := h.binanceOrderWithFills(r.Context(), order)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve order")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) binanceCancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Unauthorized.")
+		return
+	}
+	orderID, clientOrderID, ok := binanceOrderRef(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.binanceFindOrder(r.Context(), userID, orderID, clientOrderID)
+	if err == nil {
+		err = h.DB.CancelOrder(r.Context(), order.ID, userID)
+	}
+	var notOpen *db.OrderNotOpenError
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		writeBinanceError(w, http.StatusBadRequest, binanceErrNoSuchOrder, "Unknown order sent.")
+		return
+	case errors.As(err, &notOpen):
+		writeBinanceError(w, http.StatusBadRequest, binanceErrCancelRejected, "Order already "+notOpen.Status+".")
+		return
+	case err != nil:
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to cancel order")
+		return
+	}
+	h.unbookOrders(r.Context(), order.ID)
+
+	order.Status = "canceled"
+	response, err := h.binanceOrderWithFills(r.Context(), order)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve order")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) binanceOpenOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Unauthorized.")
+		return
+	}
+
+	orders, err := h.DB.GetUserOrders(r.Context(), userID, db.OrderFilter{Status: "open"}, db.Page{Limit: db.MaxPageLimit})
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve orders")
+		return
+	}
+	orderIDs := make([]int, len(orders))
+	for i, order := range orders {
+		orderIDs[i] = order.ID
+	}
+	filled, err := h.DB.GetFilledQuantities(r.Context(), orderIDs)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve orders")
+		return
+	}
+	notionals, err := h.DB.GetFilledNotionals(r.Context(), orderIDs)
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve orders")
+		return
+	}
+
+	response := make([]map[string]interface{}, 0, len(orders))
+	for i := range orders {
+		response = append(response, binanceOrder(&orders[i], filled[orders[i].ID], notionals[orders[i].ID]))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) binanceMyTrades(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeBinanceError(w, http.StatusUnauthorized, binanceErrSignature, "Unauthorized.")
+		return
+	}
+	symbol, ok := binanceSymbolParam(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := binanceLimit(r)
+	if !ok {
+		writeBinanceError(w, http.StatusBadRequest, binanceErrIllegalParam, "Illegal characters found in parameter 'limit'.")
+		return
+	}
+
+	trades, err := h.DB.GetUserTrades(r.Context(), userID, db.TradeFilter{Symbol: symbol}, db.Page{Limit: limit, Sort: "executed_at", Desc: true})
+	if err != nil {
+		writeBinanceError(w, http.StatusInternalServerError, binanceErrUnknown, "Failed to retrieve trades")
+		return
+	}
+
+	// Binance lists trades oldest first
+	response := make([]map[string]interface{}, 0, len(trades))
+	for i := len(trades) - 1; i >= 0; i-- {
+		t := trades[i]
+		isBuyer := t.Side == "buy"
+		orderID, commission := t.SellOrderID, t.SellFee
+		if isBuyer {
+			orderID, commission = t.BuyOrderID, t.BuyFee
+		}
+		response = append(response, map[string]interface{}{
+			"symbol":          BinanceSymbol(symbol),
+			"id":              t.ID,
+			"orderId":         orderID,
+			"price":           binanceDecimal(t.Price),
+			"qty":             binanceDecimal(t.Quantity),
+			"quoteQty":        binanceDecimal(t.Price * t.Quantity),
+			"commission":      binanceDecimal(commission),
+			"commissionAsset": "USD",
+			"time":            t.ExecutedAt.UnixMilli(),
+			"isBuyer":         isBuyer,
+			"isMaker":         t.Side != t.TakerSide,
+			"isBestMatch":     true,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// BinanceTradeStream is the name of the Binance trade stream, e.g. "btcusd@trade"
+func BinanceTradeStream(symbol string) string {
+	return strings.ToLower(BinanceSymbol(symbol)) + "@trade"
+}
+
+// BinanceKlineStream is the name of a Binance kline stream, e.g. "btcusd@kline_1m"
+func BinanceKlineStream(symbol, interval string) string {
+	return strings.ToLower(BinanceSymbol(symbol)) + "@kline_" + interval
+}
+
+// BinanceTradeEvent formats a trade on a market as a Binance trade stream
+// event
+func BinanceTradeEvent(symbol string, trade models.Trade) map[string]interface{} {
+	return map[string]interface{}{
+		"e": "trade",
+		"E": time.Now().UnixMilli(),
+		"s": BinanceSymbol(symbol),
+		"t": trade.ID,
+		"p": binanceDecimal(trade.Price),
+		"q": binanceDecimal(trade.Quantity),
+		"b": trade.BuyOrderID,
+		"a": trade.SellOrderID,
+		"T": trade.ExecutedAt.UnixMilli(),
+		"m": isBuyerMaker(trade),
+		"M": true,
+	}
+}
+
+// BinanceKlineEvent formats a candle update on a market as a Binance kline
+// stream event
+func BinanceKlineEvent(symbol string, candle models.Candle) map[string]interface{} {
+	width := marketdata.Intervals[candle.Interval]
+	closeTime := candle.OpenTime.Add(width)
+	symbol = BinanceSymbol(symbol)
+	return map[string]interface{}{
+		"e": "kline",
+		"E": time.Now().UnixMilli(),
+		"s": symbol,
+		"k": map[string]interface{}{
+			"t": candle.OpenTime.UnixMilli(),
+			"T": closeTime.UnixMilli() - 1,
+			"s": symbol,
+			"i": candle.Interval,
+			"o": binanceDecimal(candle.Open),
+			"c": binanceDecimal(candle.Close),
+			"h": binanceDecimal(candle.High),
+			"l": binanceDecimal(candle.Low),
+			"v": binanceDecimal(candle.Volume),
+			"x": !time.Now().Before(closeTime),
+		},
+	}
+}
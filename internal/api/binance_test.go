@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestAggregateLevels(t *testing.T) {
+	bids := []models.Order{
+		{Price: 101, Quantity: 1},
+		{Price: 101, Quantity: 0.5},
+		{Price: 100, Quantity: 2},
+		{Price: 99, Quantity: 3},
+	}
+
+	assert.Equal(t, [][2]string{
+		{"101.00000000", "1.50000000"},
+		{"100.00000000", "2.00000000"},
+		{"99.00000000", "3.00000000"},
+	}, aggregateLevels(bids, 10))
+	assert.Equal(t, [][2]string{
+		{"101.00000000", "1.50000000"},
+		{"100.00000000", "2.00000000"},
+	}, aggregateLevels(bids, 2))
+	assert.Empty(t, aggregateLevels(nil, 10))
+
+	// Iceberg orders count only their displayed quantity
+	assert.Equal(t, [][2]string{{"101.00000000", "1.25000000"}},
+		aggregateLevels([]models.Order{{Price: 101, Quantity: 1}, {Price: 101, Quantity: 5, DisplayQuantity: 0.25}}, 10))
+}
+
+func TestBinanceOrderStatus(t *testing.T) {
+	assert.Equal(t, "NEW", binanceOrderStatus("open", 0))
+	assert.Equal(t, "PARTIALLY_FILLED", binanceOrderStatus("open", 0.5))
+	assert.Equal(t, "FILLED", binanceOrderStatus("filled", 1))
+	assert.Equal(t, "CANCELED", binanceOrderStatus("canceled", 0.5))
+}
+
+func TestFromBinanceSymbol(t *testing.T) {
+	symbol, ok := fromBinanceSymbol("BTCUSD")
+	assert.True(t, ok)
+	assert.Equal(t, "BTC-USD", symbol)
+
+	_, ok = fromBinanceSymbol("ETHUSD")
+	assert.False(t, ok)
+	assert.Equal(t, "btcusd@kline_1m", BinanceKlineStream("BTC-USD", "1m"))
+}
+
+func TestBinanceMarketDataSymbols(t *testing.T) {
+	// Only listed symbols with market data are served
+	for _, path := range []string{
+		"/api/v3/depth?symbol=ETHUSD",
+		"/api/v3/klines?symbol=ETHUSD&interval=1m",
+		"/api/v3/ticker/24hr?symbol=ETHUSD",
+		"/api/v3/ticker/price?symbol=ETHUSD",
+	} {
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), `"code":-1121`, path)
+	}
+
+	// Tickers default to the market their statistics are kept for
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest("GET", "/api/v3/ticker/price", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"symbol":"BTCUSD"`)
+
+	// Stream events name the market they're on
+	assert.Equal(t, "BTCUSD", BinanceTradeEvent("BTC-USD", models.Trade{})["s"])
+	event := BinanceKlineEvent("BTC-USD", models.Candle{Interval: "1m"})
+	assert.Equal(t, "BTCUSD", event["s"])
+	assert.Equal(t, "BTCUSD", event["k"].(map[string]interface{})["s"])
+}
+
+func TestDepthCache(t *testing.T) {
+	var cache depthCache
+	_, ok := cache.get("BTC-USD", 0, 100)
+	assert.False(t, ok)
+
+	cache.put("BTC-USD", 1, 100, []byte("a"))
+	cache.put("BTC-USD", 1, 5, []byte("b"))
+	response, ok := cache.get("BTC-USD", 1, 100)
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(response))
+
+	// Each market's book is cached apart
+	_, ok = cache.get("ETH-USD", 1, 100)
+	assert.False(t, ok)
+	cache.put("ETH-USD", 7, 100, []byte("d"))
+	response, ok = cache.get("BTC-USD", 1, 100)
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(response))
+
+	// A newer version replaces every cached limit
+	cache.put("BTC-USD", 2, 5, []byte("c"))
+	_, ok = cache.get("BTC-USD", 2, 100)
+	assert.False(t, ok)
+	_, ok = cache.get("BTC-USD", 1, 5)
+	assert.False(t, ok)
+}
+
+func TestSignedPayload(t *testing.T) {
+	// Binance signs the query string followed by the body, leaving out the
+	// signature wherever it's sent
+	r := httptest.NewRequest("POST", "/api/v3/order?symbol=BTCUSD&signature=abc", strings.NewReader("side=BUY&timestamp=1&signature=def"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	payload, err := signedPayload(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, "symbol=BTCUSDside=BUY&timestamp=1", payload)
+
+	// The body can still be read by the handler
+	assert.NoError(t, r.ParseForm())
+	assert.Equal(t, "BUY", r.Form.Get("side"))
+
+	r = httptest.NewRequest("POST", "/api/v3/order", strings.NewReader(strings.Repeat("a", maxSignedBody+1)))
+	_, err = signedPayload(httptest.NewRecorder(), r)
+	var tooLarge *http.MaxBytesError
+	assert.ErrorAs(t, err, &tooLarge)
+}
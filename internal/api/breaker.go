@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// checkCircuitBreaker is an events.Handler that halts the market, or moves
+// it to an auction, when a trade trips the circuit breaker
+func (h *Handler) checkCircuitBreaker(e events.Event) {
+	trade, ok := e.Data.(models.Trade)
+	if !ok {
+		return
+	}
+	trip, tripped := h.Breaker.Observe(trade)
+	if !tripped {
+		return
+	}
+
+	settings := h.Breaker.Settings()
+	reason := fmt.Sprintf("Circuit breaker: price moved %.2f%% from %g to %g within %v",
+		trip.Move*100, trip.Reference, trip.Price, settings.Window)
+	var status exchange.MarketStatus
+	var err error
+	if settings.Action == string(exchange.MarketAuction) {
+		var until time.Time
+		if settings.Duration > 0 {
+			until = time.Now().Add(settings.Duration)
+		}
+		status, err = h.Exchange.StartAuction(reason, until)
+	} else {
+		status, err = h.Exchange.SetMarketState(exchange.MarketHalted, reason)
+	}
+	h.Events.Publish(events.Event{Type: events.CircuitBreakerTripped, Data: trip})
+	if err != nil {
+		// Already halted or in an auction, e.g. by a trip moments earlier
+		log.Printf("%s; market left %s: %v", reason, status.State, err)
+		return
+	}
+	log.Printf("%s; market moved to %s", reason, status.State)
+	h.Events.Publish(events.Event{Type: events.MarketStateChanged, Data: status})
+}
+
+// circuitBreakerView is the circuit breaker's settings as shown to admins
+type circuitBreakerView struct {
+	Move       float64                 `json:"move"`
+	WindowMs   int64                   `json:"window_ms"`
+	Action     string                  `json:"action"`
+	DurationMs int64                   `json:"duration_ms"`
+	LastTrip   *marketdata.BreakerTrip `json:"last_trip,omitempty"`
+}
+
+func (h *Handler) circuitBreakerView() circuitBreakerView {
+	settings := h.Breaker.Settings()
+	return circuitBreakerView{
+		Move:       settings.Move,
+		WindowMs:   settings.Window.Milliseconds(),
+		Action:     settings.Action,
+		DurationMs: settings.Duration.Milliseconds(),
+		LastTrip:   h.Breaker.LastTrip(),
+	}
+}
+
+// GetCircuitBreaker returns the circuit breaker's settings and latest trip
+func (h *Handler) GetCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.circuitBreakerView())
+}
+
+// UpdateCircuitBreaker changes the circuit breaker's settings; a move of
+// zero disables it. Reopening a market it halted is done through
+// SetMarketState or UncrossAuction.
+func (h *Handler) UpdateCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	var req circuitBreakerRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	settings := h.Breaker.Settings()
+	if req.Move != nil {
+		settings.Move = *req.Move
+	}
+	if req.WindowMs != nil {
+		settings.Window = time.Duration(*req.WindowMs) * time.Millisecond
+	}
+	if req.Action != nil {
+		settings.Action = *req.Action
+	}
+	if req.DurationMs != nil {
+		settings.Duration = time.Duration(*req.DurationMs) * time.Millisecond
+	}
+	if err := h.Breaker.Set(settings); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid settings: "+err.Error())
+		return
+	}
+	log.Printf("Circuit breaker settings changed by admin: %+v", settings)
+
+	writeJSON(w, http.StatusOK, h.circuitBreakerView())
+}
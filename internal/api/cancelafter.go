@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// cancelAllAfterRequest is the body of POST /cancel-all-after
+type cancelAllAfterRequest struct {
+	Timeout int `json:"timeout" validate:"min=0,max=3600000"` // Milliseconds until the orders are canceled, up to an hour; 0 disarms
+}
+
+// CancelAllAfter arms the user's dead man's switch: unless it's set again
+// within the timeout, all of the user's open orders are canceled. A zero
+// timeout disarms it.
+func (h *Handler) CancelAllAfter(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req cancelAllAfterRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	now := time.Now()
+	deadline := h.CancelTimers.Set(userID, time.Duration(req.Timeout)*time.Millisecond, now)
+	writeJSON(w, http.StatusOK, newCancelAllAfterResponse(now, deadline))
+}
+
+// GetCancelAllAfter returns when the user's dead man's switch fires, if
+// it's armed
+func (h *Handler) GetCancelAllAfter(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	deadline, _ := h.CancelTimers.Deadline(userID)
+	writeJSON(w, http.StatusOK, newCancelAllAfterResponse(time.Now(), deadline))
+}
+
+// newCancelAllAfterResponse describes a dead man's switch firing at
+// deadline, or disarmed if it's zero
+func newCancelAllAfterResponse(now, deadline time.Time) cancelAllAfterResponse {
+	resp := cancelAllAfterResponse{CurrentTime: now}
+	if !deadline.IsZero() {
+		resp.TriggerTime = &deadline
+	}
+	return resp
+}
+
+// fireCancelTimer cancels the open orders of a user whose dead man's switch
+// ran out. Nothing is canceled while the server is shutting down.
+func (h *Handler) fireCancelTimer(userID int) {
+	if h.draining.Load() {
+		return
+	}
+	canceled, err := h.cancelAllOrdersFor(context.Background(), userID, "cancel_all_after")
+	if err != nil {
+		log.Printf("Failed to cancel orders of user %d after their timer ran out: %v", userID, err)
+		return
+	}
+	log.Printf("Canceled %d orders of user %d after their timer ran out", canceled, userID)
+}
+
+// cancelAllOrdersFor cancels all of a user's open orders on the system's
+// behalf, announcing why, and returns how many it canceled
+func (h *Handler) cancelAllOrdersFor(ctx context.Context, userID int, reason string) (int, error) {
+	ctx = db.WithActor(ctx, db.Actor{UserID: userID, Source: db.SourceSystem})
+	orderIDs, err := h.DB.CancelOrders(db.WithCancelReason(ctx, reason), userID, db.OrderFilter{})
+	if err != nil {
+		return 0, err
+	}
+	if removed := h.unbookOrdersFor(ctx, reason, orderIDs...); removed != len(orderIDs) {
+		log.Printf("%d of %d canceled orders not found in order book", len(orderIDs)-removed, len(orderIDs))
+	}
+	return len(orderIDs), nil
+}
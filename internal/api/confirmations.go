@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// confirmationWindow is how long an order held for confirmation can be confirmed
+const confirmationWindow = 30 * time.Second
+
+var (
+	errConfirmationNotFound = errors.New("confirmation not found")
+	errConfirmationExpired  = errors.New("confirmation expired")
+)
+
+// pendingConfirmation is an order above its user's confirmation threshold,
+// held until they confirm it
+type pendingConfirmation struct {
+	userID    int
+	req       orderRequest
+	expiresAt time.Time
+}
+
+// confirmations holds orders awaiting confirmation by ID. The zero value is
+// ready to use.
+type confirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+// hold stores an order until now+confirmationWindow, returning its ID and
+// expiry. Expired orders are dropped.
+func (c *confirmations) hold(userID int, req orderRequest, now time.Time) (string, time.Time, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate confirmation id: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	expiresAt := now.Add(confirmationWindow)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]pendingConfirmation)
+	}
+	for pendingID, p := range c.pending {
+		if !now.Before(p.expiresAt) {
+			delete(c.pending, pendingID)
+		}
+	}
+	c.pending[id] = pendingConfirmation{userID: userID, req: req, expiresAt: expiresAt}
+	return id, expiresAt, nil
+}
+
+// take removes and returns the user's order held under id. Each order can
+// only be confirmed once.
+func (c *confirmations) take(id string, userID int, now time.Time) (orderRequest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[id]
+	if !ok || p.userID != userID {
+		return orderRequest{}, errConfirmationNotFound
+	}
+	delete(c.pending, id)
+	if !now.Before(p.expiresAt) {
+		return orderRequest{}, errConfirmationExpired
+	}
+	return p.req, nil
+}
+
+// ConfirmOrder places an order held for confirmation by PlaceOrder, if it's
+// confirmed within confirmationWindow. Risk limits are checked again, since
+// they may have changed while the order was held.
+func (h *Handler) ConfirmOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := h.confirmations.take(chi.URLParam(r, "id"), userID, time.Now())
+	switch {
+	case errors.Is(err, errConfirmationNotFound):
+		writeError(w, http.StatusNotFound, "Confirmation not found")
+		return
+	case errors.Is(err, errConfirmationExpired):
+		writeError(w, http.StatusGone, "Confirmation expired; place the order again")
+		return
+	}
+
+	h.placeOrder(w, r, userID, req)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultTopTraders is how many top traders the dashboard lists unless
+// asked for more or fewer
+const defaultTopTraders = 10
+
+// statusRecorder remembers the status a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Hijack hands the connection over for WebSocket streams
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// CountResponses counts each response's status for the dashboard's error
+// rates. It should come straight after StampReceipt.
+func (h *Handler) CountResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			h.Errors.Record(status, time.Now())
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// GetDashboard gives operators an overview of the exchange: its users,
+// each market's open orders and last 24 hours of trading, the users who
+// traded most over the last 24 hours and the API's error rates. "limit"
+// chooses how many top traders are listed.
+func (h *Handler) GetDashboard(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = defaultTopTraders
+	}
+
+	now := time.Now()
+	since := now.Add(-24 * time.Hour)
+	users, err := h.DB.GetUserCounts(r.Context(), since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count users")
+		return
+	}
+	markets, err := h.DB.GetMarketOverviews(r.Context(), since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve markets")
+		return
+	}
+	traders, asOf, err := h.DB.GetTopTraders(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve top traders")
+		return
+	}
+
+	response := map[string]interface{}{
+		"users":       users,
+		"markets":     markets,
+		"top_traders": traders,
+		"errors":      h.Errors.Status(now),
+	}
+	if !asOf.IsZero() {
+		response["top_traders_as_of"] = asOf
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/validate"
+)
+
+// Codes identifying why a request failed, sent as "code" in error responses
+// so clients can branch on them rather than on messages. An error without a
+// more specific code has its status's, e.g. "not_found" for a 404.
+const (
+	codeInvalidBody        = "invalid_body"          // The body isn't valid JSON of the expected shape
+	codeValidationFailed   = "validation_failed"     // Body fields break their rules; see "violations"
+	codeInvalidField       = "invalid_field"         // A request field or parameter is invalid; see "field"
+	codeUnknownSymbol      = "unknown_symbol"        // The symbol isn't listed
+	codeInvalidSide        = "invalid_side"          // The side isn't "buy" or "sell"
+	codeInvalidPrice       = "invalid_price"         // The price isn't positive
+	codeInvalidQuantity    = "invalid_quantity"      // The quantity isn't positive
+	codeInvalidTimeInForce = "invalid_time_in_force" // The time in force isn't supported, or doesn't suit the order
+	codeInvalidExpiry      = "invalid_expiry"        // The expiry is missing, past or not allowed
+	codeInvalidToken       = "invalid_token"         // The token is invalid or expired
+	codeRateLimited        = "rate_limited"          // The client's request budget is spent
+	codeThrottled          = "throttled"             // The account's or IP's order budget is spent
+	codeMarketHalted       = "market_halted"         // The market isn't accepting orders
+	codeShuttingDown       = "shutting_down"         // The server is draining before shutdown
+	codeLeaderUnavailable  = "leader_unavailable"    // The matching leader's region can't be reached
+	codeOrderNotFound      = "order_not_found"
+	codeOrderNotOpen       = "order_not_open"        // The order already filled or was canceled
+	codeClientOrderIDTaken = "client_order_id_taken" // Another of the user's orders has the client order ID
+	codeUserNotFound       = "user_not_found"
+	codeTransferNotPending = "transfer_not_pending" // The transfer was already reviewed
+	codeInsufficientFunds  = "insufficient_funds"   // The balance can't cover the request
+	codePoolLiquidity      = "pool_liquidity"       // The lending pool has too little that isn't borrowed
+	codeBorrowLimit        = "borrow_limit"         // The borrow would take the user past their borrowing capacity
+	codeNothingOwed        = "nothing_owed"         // The user owes nothing in the asset to repay
+	codeDailyNotionalLimit = "daily_notional_limit" // The order could take the user past their daily limit
+	codePriceOutOfBand     = "price_out_of_band"    // The price is too far from the index price
+	codeConfirmationNeeded = "confirmation_required"
+	codeWeakPassword       = "weak_password"
+	codeWrongPassword      = "wrong_password"
+	codeUsernameTaken      = "username_taken"
+	codeUsernameReserved   = "username_reserved"
+	codeMarketTransition   = "invalid_market_transition" // The market can't move to the requested state
+)
+
+// apiError is a request error with its code and, if one field is at fault,
+// the field's name as the client sent it
+type apiError struct {
+	Code    string
+	Field   string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// newFieldError returns an error for an invalid request field
+func newFieldError(code, field, message string) *apiError {
+	return &apiError{Code: code, Field: field, Message: message}
+}
+
+// errClientOrderIDTaken rejects an order whose client order ID another of
+// the user's orders already has
+var errClientOrderIDTaken = newFieldError(codeClientOrderIDTaken, "client_order_id", "Client order ID already used")
+
+// fieldCodes are the codes of request fields whose violations have a more
+// specific code than invalid_field, for responses reporting a single error
+var fieldCodes = map[string]string{
+	"type":          codeInvalidSide,
+	"side":          codeInvalidSide,
+	"price":         codeInvalidPrice,
+	"quantity":      codeInvalidQuantity,
+	"time_in_force": codeInvalidTimeInForce,
+}
+
+// validationError is a request body whose fields break their declared rules
+type validationError struct {
+	Violations []validate.Violation
+}
+
+func (e *validationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validateRequest checks req against its fields' rules, returning a
+// *validationError listing every violation
+func validateRequest(req interface{}) error {
+	if violations := validate.Struct(req); len(violations) > 0 {
+		return &validationError{Violations: violations}
+	}
+	return nil
+}
+
+// decodeRequest decodes a JSON body into dst, a pointer to a struct, and
+// checks it against its fields' rules. It writes a 400 for a malformed body
+// and a 422 listing every violation, returning false if it wrote either.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return false
+	}
+	if err := validateRequest(dst); err != nil {
+		writeValidationError(w, err.(*validationError))
+		return false
+	}
+	return true
+}
+
+// writeValidationError writes a 422 listing every violation of a request
+func writeValidationError(w http.ResponseWriter, err *validationError) {
+	writeJSON(w, http.StatusUnprocessableEntity, validationResponse{
+		Code:       codeValidationFailed,
+		Error:      "Request validation failed",
+		Violations: err.Violations,
+	})
+}
+
+// statusCode returns the generic code for an HTTP status, e.g.
+// "internal_server_error" for a 500
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// writeCodedError writes a JSON error response with a specific code
+func writeCodedError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorResponse{Code: code, Error: message})
+}
+
+// writeAPIError writes err as a JSON error response, with its code and field
+// if it's an *apiError and the status's code otherwise. A *validationError
+// is written as a 422 listing every violation instead.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		writeValidationError(w, validationErr)
+		return
+	}
+	writeJSON(w, status, newErrorResponse(status, err))
+}
+
+// newErrorResponse describes err as a single error. A *validationError is
+// coded by its first violation.
+func newErrorResponse(status int, err error) errorResponse {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return errorResponse{Code: apiErr.Code, Error: apiErr.Message, Field: apiErr.Field}
+	}
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		first := validationErr.Violations[0]
+		code, ok := fieldCodes[first.Field]
+		if !ok {
+			code = codeInvalidField
+		}
+		return errorResponse{Code: code, Error: validationErr.Error(), Field: first.Field}
+	}
+	return errorResponse{Code: statusCode(status), Error: err.Error()}
+}
+
+// errorCode returns the code of err, or the status's if it has none
+func errorCode(status int, err error) string {
+	return newErrorResponse(status, err).Code
+}
+
+// invalidOrder wraps an error from validating an order against its
+// instrument. Values the instrument doesn't accept are coded by field and
+// rule, e.g. "price_out_of_range" or "quantity_precision".
+func invalidOrder(err error) error {
+	message := "Invalid order: " + err.Error()
+	var fieldErr *instruments.FieldError
+	if !errors.As(err, &fieldErr) {
+		return errors.New(message)
+	}
+	if fieldErr.Precision {
+		return newFieldError(fieldErr.Field+"_precision", fieldErr.Field, message)
+	}
+	return newFieldError(fieldErr.Field+"_out_of_range", fieldErr.Field, message)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ExpireOrders cancels the GTD orders that have expired by now. They are
+// taken off the book before the database is updated so they can't trade in
+// between, and an order the database fails to cancel is caught by the next
+// sweep. Returns the IDs of the orders canceled.
+func (h *Handler) ExpireOrders(ctx context.Context, now time.Time) ([]int, error) {
+	if _, err := h.Markets.ExpireOrders(now); err != nil {
+		return nil, err
+	}
+	orderIDs, err := h.DB.ExpireOrders(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	h.unbookOrdersFor(ctx, "expired", orderIDs...)
+	return orderIDs, nil
+}
+
+// RunExpiry cancels expired GTD orders every interval until ctx is done
+func (h *Handler) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := h.ExpireOrders(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to expire orders: %v", err)
+			}
+		}
+	}
+}
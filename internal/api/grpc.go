@@ -0,0 +1,470 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/api/tradingpb"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/pricefeed"
+	"github.com/xtrntr/exchange/internal/ratelimit"
+	"github.com/xtrntr/exchange/internal/risk"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain is the ErrorInfo domain of the codes gRPC errors carry
+const grpcErrorDomain = "exchange"
+
+// codedError returns a gRPC status error carrying the REST error code as an
+// ErrorInfo reason, with the field at fault, if any, in its metadata
+func codedError(c codes.Code, code, field, message string) error {
+	st := status.New(c, message)
+	info := &errdetails.ErrorInfo{Reason: code, Domain: grpcErrorDomain}
+	if field != "" {
+		info.Metadata = map[string]string{"field": field}
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcTradeBuffer is how many trades a trade stream may fall behind by
+// before it is closed
+const grpcTradeBuffer = 256
+
+// grpcDefaultDepth is the number of price levels per side an order book
+// stream sends when the request doesn't ask for a depth
+const grpcDefaultDepth = 20
+
+// grpcBookInterval is how often order book streams check the book's
+// version, so changes within an interval are sent as one book
+const grpcBookInterval = 50 * time.Millisecond
+
+// Metadata keys carrying credentials on gRPC calls, mirroring the REST headers
+const (
+	grpcAuthorizationKey = "authorization"
+	grpcAPIKeyKey        = "x-api-key"
+	grpcTimestampKey     = "x-timestamp"
+	grpcRecvWindowKey    = "x-recv-window"
+	grpcSignatureKey     = "x-signature"
+)
+
+// GRPCServer returns a gRPC server for the trading service, sharing the
+// handler's engine, authentication and rate limits with the REST API.
+// Order entry needs the trade scope and streams the read scope. Streams end
+// once the handler starts draining, so a graceful stop only waits for
+// order entry in flight.
+func (h *Handler) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(h.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(h.grpcStreamAuth),
+	)
+	server := grpc.NewServer(opts...)
+	tradingpb.RegisterTradingServer(server, newTradingService(h))
+	return server
+}
+
+// grpcCredentials reads the credentials sent in a call's metadata
+func grpcCredentials(ctx context.Context) StreamCredentials {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return StreamCredentials{
+		Token:      strings.TrimPrefix(get(grpcAuthorizationKey), "Bearer "),
+		APIKey:     get(grpcAPIKeyKey),
+		Signature:  get(grpcSignatureKey),
+		Timestamp:  get(grpcTimestampKey),
+		RecvWindow: get(grpcRecvWindowKey),
+	}
+}
+
+// grpcAuthenticate authenticates a call with the given scope and charges it
+// to the user's budget, returning a context carrying the user's ID and
+// attributing the call's changes to the user in the audit log
+func (h *Handler) grpcAuthenticate(ctx context.Context, scope string, limiter *ratelimit.Limiter) (context.Context, error) {
+	session, err := h.authenticate(ctx, grpcCredentials(ctx), scope)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	userID := session.UserID
+	if ok, _ := limiter.Allow(fmt.Sprintf("user:%d", userID), time.Now()); !ok {
+		return nil, codedError(codes.ResourceExhausted, codeRateLimited, "", "Rate limit exceeded")
+	}
+	actor := db.Actor{UserID: userID, Source: db.SourceGRPC}
+	if p, ok := peer.FromContext(ctx); ok {
+		actor.IP, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	ctx = db.WithActor(ctx, actor)
+	return context.WithValue(ctx, "user_id", userID), nil
+}
+
+// grpcUnaryAuth authenticates order entry calls, stamping when they were
+// received so their acknowledgement latency is recorded like REST orders
+func (h *Handler) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = context.WithValue(ctx, "received_at", time.Now())
+	ctx, err := h.grpcAuthenticate(ctx, auth.ScopeTrade, h.OrderLimiter)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticatedStream is a server stream whose context carries the user
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcStreamAuth authenticates market data streams
+func (h *Handler) grpcStreamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := h.grpcAuthenticate(stream.Context(), auth.ScopeRead, h.ReadLimiter)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// tradingService implements the gRPC trading service on a handler
+type tradingService struct {
+	tradingpb.UnimplementedTradingServer
+	h *Handler
+
+	mu     sync.Mutex
+	trades map[chan *tradingpb.Trade]struct{} // Trade streams, closed if they fall behind
+}
+
+// newTradingService creates the trading service, feeding trade streams
+// from the handler's events
+func newTradingService(h *Handler) *tradingService {
+	s := &tradingService{h: h, trades: make(map[chan *tradingpb.Trade]struct{})}
+	h.Events.Subscribe(events.TradeExecuted, func(e events.Event) {
+		s.publishTrade(protoTrade(e.Data.(models.Trade)))
+	})
+	return s
+}
+
+// publishTrade sends a trade to every trade stream without blocking the
+// matching path, closing streams whose buffer is full
+func (s *tradingService) publishTrade(trade *tradingpb.Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.trades {
+		select {
+		case ch <- trade:
+		default:
+			delete(s.trades, ch)
+			close(ch)
+		}
+	}
+}
+
+// PlaceOrder validates, risk checks and submits an order as POST /orders does
+func (s *tradingService) PlaceOrder(ctx context.Context, in *tradingpb.PlaceOrderRequest) (*tradingpb.PlaceOrderResponse, error) {
+	h := s.h
+	userID := ctx.Value("user_id").(int)
+	if err := s.checkAcceptingOrders(ctx); err != nil {
+		return nil, err
+	}
+
+	req := orderRequest{
+		Symbol:          in.Symbol,
+		Price:           in.Price,
+		Quantity:        in.Quantity,
+		Tag:             in.Tag,
+		PostOnly:        in.PostOnly,
+		Confirm:         in.Confirm,
+		DisplayQuantity: in.DisplayQuantity,
+	}
+	switch in.Side {
+	case tradingpb.Side_SIDE_BUY:
+		req.Type = "buy"
+	case tradingpb.Side_SIDE_SELL:
+		req.Type = "sell"
+	}
+	if in.TimeInForce != tradingpb.TimeInForce_TIME_IN_FORCE_UNSPECIFIED {
+		req.TimeInForce = strings.TrimPrefix(in.TimeInForce.String(), "TIME_IN_FORCE_")
+	}
+	if in.ExpiresAt != nil {
+		expiresAt := in.ExpiresAt.AsTime()
+		req.ExpiresAt = &expiresAt
+	}
+
+	prefs, err := h.DB.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to load preferences")
+	}
+	req.applyPreferences(prefs)
+	if err := req.validate(); err != nil {
+		resp := newErrorResponse(http.StatusBadRequest, err)
+		h.publishRejection(userID, req, resp.Code, resp.Error)
+		return nil, codedError(codes.InvalidArgument, resp.Code, resp.Field, resp.Error)
+	}
+	if req.needsConfirmation(prefs) {
+		h.publishRejection(userID, req, codeConfirmationNeeded, "Order notional above confirmation threshold")
+		return nil, codedError(codes.FailedPrecondition, codeConfirmationNeeded, "", "Order notional above confirmation threshold; resend with confirm set")
+	}
+	hold, err := s.checkRiskLimits(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	order, trades, err := h.submitOrder(ctx, req.order(userID), hold)
+	var throttled *exchange.ThrottledError
+	if errors.As(err, &throttled) {
+		h.publishRejection(userID, req, codeThrottled, throttled.Error())
+		return nil, codedError(codes.ResourceExhausted, codeThrottled, "", throttled.Error())
+	}
+	if errors.Is(err, errClientOrderIDTaken) {
+		return nil, codedError(codes.AlreadyExists, codeClientOrderIDTaken, "client_order_id", err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &tradingpb.PlaceOrderResponse{Order: protoOrder(*order), Trades: []*tradingpb.Trade{}}
+	for _, trade := range trades {
+		resp.Trades = append(resp.Trades, protoTrade(trade))
+	}
+	return resp, nil
+}
+
+// checkRiskLimits applies the same price band, order size and daily
+// notional limits as REST order entry, announcing rejections. Returns the
+// order's reservation against the daily limit.
+func (s *tradingService) checkRiskLimits(ctx context.Context, userID int, req orderRequest) (*risk.Reservation, error) {
+	h := s.h
+	var bandErr *pricefeed.BandError
+	if errors.As(h.checkPriceBand(req.Symbol, req.Price), &bandErr) {
+		h.publishRejection(userID, req, codePriceOutOfBand, bandErr.Error())
+		return nil, codedError(codes.InvalidArgument, codePriceOutOfBand, "price", bandErr.Error())
+	}
+
+	err := h.checkOrderLimits(ctx, userID, req.Price, req.Quantity)
+	var orderLimitErr *risk.OrderLimitError
+	if errors.As(err, &orderLimitErr) {
+		message := orderLimitMessages[orderLimitErr.Limit]
+		h.publishRejection(userID, req, orderLimitErr.Limit, message)
+		return nil, codedError(codes.PermissionDenied, orderLimitErr.Limit, "", message)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	hold, err := h.checkRisk(ctx, userID, req.Price*req.Quantity)
+	var limitErr *risk.LimitError
+	if errors.As(err, &limitErr) {
+		h.publishRejection(userID, req, codeDailyNotionalLimit, "Daily notional limit exceeded")
+		return nil, codedError(codes.PermissionDenied, codeDailyNotionalLimit, "", "Daily notional limit exceeded")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return hold, nil
+}
+
+// checkAcceptingOrders refuses orders while the server is draining or the
+// market is halted, and orders that would have to be forwarded to the
+// matching leader in another region, which gRPC clients connect to directly
+func (s *tradingService) checkAcceptingOrders(ctx context.Context) error {
+	h := s.h
+	if h.draining.Load() {
+		return codedError(codes.Unavailable, codeShuttingDown, "", "Server is shutting down")
+	}
+	if h.Exchange.MarketStatus().State == exchange.MarketHalted {
+		return codedError(codes.Unavailable, codeMarketHalted, "", "Market halted")
+	}
+	if h.Router == nil {
+		return nil
+	}
+	leader, err := h.Router.Leader.Leader(ctx)
+	if err != nil {
+		return codedError(codes.Unavailable, codeLeaderUnavailable, "", "Matching leader unavailable")
+	}
+	if leader.Name != h.Router.Local {
+		return status.Errorf(codes.Unavailable, "Matching leader is in region %s", leader.Name)
+	}
+	return nil
+}
+
+// CancelOrder cancels an open order as DELETE /orders/{id} does
+func (s *tradingService) CancelOrder(ctx context.Context, in *tradingpb.CancelOrderRequest) (*tradingpb.CancelOrderResponse, error) {
+	h := s.h
+	userID := ctx.Value("user_id").(int)
+	orderID := int(in.OrderId)
+
+	err := h.DB.CancelOrder(ctx, orderID, userID)
+	var notOpen *db.OrderNotOpenError
+	switch {
+	case errors.As(err, &notOpen) && notOpen.Status == "canceled":
+		return &tradingpb.CancelOrderResponse{OrderId: in.OrderId, Status: notOpen.Status}, nil
+	case errors.As(err, &notOpen):
+		return nil, codedError(codes.FailedPrecondition, codeOrderNotOpen, "", "Order already "+notOpen.Status)
+	case errors.Is(err, db.ErrOrderNotFound):
+		return nil, codedError(codes.NotFound, codeOrderNotFound, "", "Order not found")
+	case err != nil:
+		return nil, status.Error(codes.Internal, "Failed to cancel order")
+	}
+
+	h.unbookOrders(ctx, orderID)
+	return &tradingpb.CancelOrderResponse{OrderId: in.OrderId, Status: "canceled"}, nil
+}
+
+// StreamOrderBook sends the book on subscribing and again whenever its
+// version changes
+func (s *tradingService) StreamOrderBook(in *tradingpb.StreamOrderBookRequest, stream tradingpb.Trading_StreamOrderBookServer) error {
+	symbol, err := streamSymbol(in.Symbol)
+	if err != nil {
+		return err
+	}
+	depth := int(in.Depth)
+	if depth == 0 {
+		depth = grpcDefaultDepth
+	}
+
+	ticker := time.NewTicker(grpcBookInterval)
+	defer ticker.Stop()
+
+	sent := false
+	var version uint64
+	for {
+		if !sent || s.h.Exchange.Version() != version {
+			bids, asks, current := s.h.Exchange.VersionedOrderBook()
+			book := &tradingpb.OrderBook{
+				Symbol:  symbol,
+				Bids:    protoLevels(exchange.Levels(bids, depth)),
+				Asks:    protoLevels(exchange.Levels(asks, depth)),
+				Version: current,
+			}
+			if err := stream.Send(book); err != nil {
+				return err
+			}
+			sent, version = true, current
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.h.drainedChan():
+			return status.Error(codes.Unavailable, "Server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+// StreamTrades sends each trade as it executes
+func (s *tradingService) StreamTrades(in *tradingpb.StreamTradesRequest, stream tradingpb.Trading_StreamTradesServer) error {
+	if _, err := streamSymbol(in.Symbol); err != nil {
+		return err
+	}
+
+	trades := make(chan *tradingpb.Trade, grpcTradeBuffer)
+	s.mu.Lock()
+	s.trades[trades] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.trades[trades]; ok {
+			delete(s.trades, trades)
+			close(trades)
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.h.drainedChan():
+			return status.Error(codes.Unavailable, "Server is shutting down")
+		case trade, ok := <-trades:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "Stream fell behind")
+			}
+			if err := stream.Send(trade); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamSymbol checks the symbol a stream is for, defaulting to BTC-USD
+func streamSymbol(symbol string) (string, error) {
+	if symbol == "" {
+		return exchange.DefaultSymbol, nil
+	}
+	if _, ok := instruments.Lookup(symbol); !ok {
+		return "", codedError(codes.InvalidArgument, codeUnknownSymbol, "symbol", "Unknown symbol")
+	}
+	return symbol, nil
+}
+
+// protoSide converts "buy" or "sell" to a gRPC side
+func protoSide(side string) tradingpb.Side {
+	if side == "buy" {
+		return tradingpb.Side_SIDE_BUY
+	}
+	return tradingpb.Side_SIDE_SELL
+}
+
+func protoOrder(order models.Order) *tradingpb.Order {
+	o := &tradingpb.Order{
+		Id:              int64(order.ID),
+		Symbol:          order.Symbol,
+		Side:            protoSide(order.Type),
+		Price:           order.Price,
+		Quantity:        order.Quantity,
+		Status:          order.Status,
+		Tag:             order.Tag,
+		TimeInForce:     tradingpb.TimeInForce(tradingpb.TimeInForce_value["TIME_IN_FORCE_"+order.TimeInForce]),
+		PostOnly:        order.PostOnly,
+		DisplayQuantity: order.DisplayQuantity,
+		CreatedAt:       timestamppb.New(order.CreatedAt),
+	}
+	if order.ExpiresAt != nil {
+		o.ExpiresAt = timestamppb.New(*order.ExpiresAt)
+	}
+	return o
+}
+
+func protoTrade(trade models.Trade) *tradingpb.Trade {
+	return &tradingpb.Trade{
+		Id:         int64(trade.ID),
+		Symbol:     exchange.DefaultSymbol,
+		Price:      trade.Price,
+		Quantity:   trade.Quantity,
+		TakerSide:  protoSide(trade.TakerSide),
+		ExecutedAt: timestamppb.New(trade.ExecutedAt),
+	}
+}
+
+func protoLevels(levels []exchange.Level) []*tradingpb.PriceLevel {
+	out := make([]*tradingpb.PriceLevel, len(levels))
+	for i, level := range levels {
+		out[i] = &tradingpb.PriceLevel{Price: level.Price, Quantity: level.Quantity}
+	}
+	return out
+}
@@ -3,28 +3,128 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
-	"sort"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/accounting"
 	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/config"
 	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
 	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/journal"
+	"github.com/xtrntr/exchange/internal/lending"
+	"github.com/xtrntr/exchange/internal/marketdata"
 	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/monitor"
+	"github.com/xtrntr/exchange/internal/pricefeed"
+	"github.com/xtrntr/exchange/internal/ratelimit"
+	"github.com/xtrntr/exchange/internal/reporting"
+	"github.com/xtrntr/exchange/internal/rewards"
+	"github.com/xtrntr/exchange/internal/risk"
+	"github.com/xtrntr/exchange/internal/routing"
+	"github.com/xtrntr/exchange/internal/settlement"
+	"github.com/xtrntr/exchange/internal/statements"
+	"github.com/xtrntr/exchange/internal/webhooks"
 )
 
 // Handler contains dependencies for HTTP handlers
 type Handler struct {
 	DB          *db.DB
+	Store       db.Store // Orders, trades and users; DB unless replaced, e.g. by memdb in tests
 	Exchange    *exchange.Exchange
+	Markets     *exchange.Registry // Matches new orders on a goroutine per market; Exchange is DefaultSymbol's engine
 	AuthService *auth.AuthService
+	Events      *events.Bus                 // Receives trade events after they are persisted
+	Ticker      *marketdata.Ticker          // Rolling 24h statistics fed from trade events
+	Prices      *marketdata.ReferencePrices // VWAP and TWAP benchmarks fed from trade events
+	Risk        *risk.Engine                // Pre-trade limits fed from trade events
+	Breaker     *marketdata.CircuitBreaker  // Halts the market on rapid price moves, fed from trade events
+	Fees        config.FeeSchedule          // Fee rates charged on fills
+	Latency     *monitor.LatencyMonitor     // Order acknowledgement latency SLO
+	Stages      *monitor.StageMonitor       // Where order latency goes between receipt and recording the match
+	Errors      *monitor.ErrorMonitor       // Response statuses, for the dashboard's error rates
+	AdminToken  string                      // Required by admin endpoints; empty disables them
+	Channels    *marketdata.Channels        // Live WebSocket broadcast settings
+	Journal     *journal.Journal            // Records engine activity for crash recovery; nil disables it
+	Encoder     marketdata.Encoder          // Encodes order book responses
+	Accounting  *accounting.Publisher       // Delivers trades and ledger entries to back-office systems; nil disables it
+	Router      *routing.Router             // Sends order entry to the matching leader's region; nil serves it locally
+	Rewards     *rewards.Accruer            // Accrues rewards on balances; nil disables the rewards program
+	Lending     *lending.Accruer            // Accrues interest in the lending pools; nil disables lending
+	Reporter    *reporting.Reporter         // Writes daily trade reports for regulators; nil disables them
+	Settler     *settlement.Settler         // Calculates daily settlement prices
+	Statements  *statements.Generator       // Generates daily account statements; nil disables generating them on demand
+	IndexPrices *pricefeed.Ingester         // Reference prices from an external feed; nil disables the price band
+	PriceBand   pricefeed.Band              // How far from the index price orders may be priced
+	Resolver    webhooks.Resolver           // Resolves webhook hosts to check they're public
+
+	InstantTransfers bool // Completes deposits and withdrawals without an admin's approval
+
+	OrderLimiter *ratelimit.Limiter // Budget for requests that change state
+	ReadLimiter  *ratelimit.Limiter // Budget for read requests
+	Throttle     *exchange.Throttle // Budget for orders the engine takes
+
+	// CancelTimers are users' dead man's switches, set with POST /cancel-all-after
+	CancelTimers *exchange.CancelTimers
+
+	draining  atomic.Bool   // Set on shutdown to stop accepting new orders
+	drainOnce sync.Once     // Creates drained
+	drained   chan struct{} // Closed on shutdown to end streams
+
+	// snapshotMu is held for reading from creating an order until the
+	// engine has it, and for writing while the book is snapshotted, so every
+	// order created before a snapshot is in it
+	snapshotMu sync.RWMutex
+
+	depth depthCache // Encoded Binance depth responses for the current books
+
+	confirmations confirmations // Orders held until their users confirm them
 }
 
 // NewHandler creates a new handler
 func NewHandler(db *db.DB, ex *exchange.Exchange, authService *auth.AuthService) *Handler {
-	return &Handler{DB: db, Exchange: ex, AuthService: authService}
+	h := &Handler{
+		DB:          db,
+		Store:       db,
+		Exchange:    ex,
+		AuthService: authService,
+		Events:      events.NewBus(),
+		Ticker:      marketdata.NewTicker(24 * time.Hour),
+		Prices:      marketdata.NewReferencePrices(),
+		Risk:        risk.NewEngine(config.Default().DailyNotionalLimits),
+		Breaker:     marketdata.NewCircuitBreaker(config.Default().CircuitBreaker),
+		Fees:        config.Default().Fees,
+		Latency:     monitor.NewLatencyMonitor(config.Default().AckLatencyThreshold, 0.99, monitor.LogNotifier{}),
+		Stages:      monitor.NewStageMonitor(config.Default().AckLatencyThreshold),
+		Errors:      monitor.NewErrorMonitor(),
+		Channels:    marketdata.NewChannels(config.Default().Channels),
+		Encoder:     marketdata.FastEncoder{},
+		Resolver:    net.DefaultResolver,
+	}
+	h.Markets = exchange.NewRegistry(exchange.DefaultQueueSize)
+	h.Markets.Add(exchange.DefaultSymbol, ex)
+	h.SetRateLimits(config.Default().OrderRateLimit, config.Default().ReadRateLimit)
+	h.SetThrottles(config.Default().AccountThrottle, config.Default().IPThrottle)
+	h.CancelTimers = exchange.NewCancelTimers(h.fireCancelTimer)
+	h.Events.Subscribe(events.TradeExecuted, h.Ticker.OnTrade)
+	h.Events.Subscribe(events.TradeExecuted, h.Prices.OnTrade)
+	h.Events.Subscribe(events.TradeExecuted, h.Risk.OnTrade)
+	h.Events.Subscribe(events.OrderUpdated, h.Risk.OnOrderUpdate)
+	h.Events.Subscribe(events.TradeExecuted, h.checkCircuitBreaker)
+	return h
 }
 
 // writeJSON writes a JSON response with consistent formatting
@@ -37,62 +137,259 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
-// writeError writes a JSON error response with consistent formatting
+// writeEncoded writes a response already encoded as JSON
+func writeEncoded(w http.ResponseWriter, status int, response []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// writeError writes a JSON error response with consistent formatting and
+// the generic code for its status
 func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+	writeJSON(w, status, errorResponse{Code: statusCode(status), Error: message})
 }
 
-// Register handles user registration
-func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+// checkRisk returns a *risk.LimitError if an order of the given notional
+// could take the user past their daily limit, and otherwise reserves the
+// notional for the order. The caller must submit the order with the
+// reservation or release it.
+func (h *Handler) checkRisk(ctx context.Context, userID int, notional float64) (*risk.Reservation, error) {
+	user, err := h.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load user")
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
-		return
+	return h.Risk.Reserve(userID, user.KYCTier, notional, time.Now())
+}
+
+// checkAmendRisk returns a *risk.LimitError if amending an order so that
+// notional is left of it could take the user past their daily limit, and
+// otherwise reserves the increase. The caller must assign the reservation
+// to the amended order or release it.
+func (h *Handler) checkAmendRisk(ctx context.Context, userID, orderID int, notional float64) (*risk.Reservation, error) {
+	user, err := h.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load user")
+	}
+	return h.Risk.ReserveAmend(userID, user.KYCTier, orderID, notional, time.Now())
+}
+
+// checkOrderLimits returns a *risk.OrderLimitError if an order breaks the
+// user's per-order limits. Orders already created count as open.
+func (h *Handler) checkOrderLimits(ctx context.Context, userID int, price, quantity float64) error {
+	limits, err := h.DB.GetOrderLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("Failed to load order limits")
+	}
+	openOrders := 0
+	if limits.MaxOpenOrders > 0 {
+		if openOrders, err = h.DB.CountOpenOrders(ctx, userID); err != nil {
+			return fmt.Errorf("Failed to count open orders")
+		}
+	}
+	return risk.CheckOrderLimits(*limits, price, quantity, openOrders)
+}
+
+// checkAmendLimits returns a *risk.OrderLimitError if an order amended to
+// price and quantity breaks the user's per-order limits. The order is
+// already open, so amending it doesn't count against the open-order limit.
+func (h *Handler) checkAmendLimits(ctx context.Context, userID int, price, quantity float64) error {
+	limits, err := h.DB.GetOrderLimits(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("Failed to load order limits")
+	}
+	limits.MaxOpenOrders = 0
+	return risk.CheckOrderLimits(*limits, price, quantity, 0)
+}
+
+// writeOrderLimitError writes the response rejecting an order that breaks one
+// of the user's per-order limits
+func writeOrderLimitError(w http.ResponseWriter, err *risk.OrderLimitError) {
+	writeJSON(w, http.StatusForbidden, orderLimitResponse{
+		Code:  err.Limit,
+		Error: orderLimitMessages[err.Limit],
+		Limit: err.Max,
+		Value: err.Value,
+	})
+}
+
+// writeNotionalLimitError writes the response rejecting an order that could
+// take the user past their daily limit
+func writeNotionalLimitError(w http.ResponseWriter, err *risk.LimitError) {
+	writeJSON(w, http.StatusForbidden, notionalLimitResponse{
+		Code:      codeDailyNotionalLimit,
+		Error:     "Daily notional limit exceeded",
+		Limit:     err.Limit,
+		Remaining: err.Remaining,
+		Reserved:  err.Reserved,
+		Used:      err.Used,
+	})
+}
+
+// checkPriceBand returns a *pricefeed.BandError if an order is priced too
+// far from its market's index price
+func (h *Handler) checkPriceBand(symbol string, price float64) error {
+	if h.IndexPrices == nil {
+		return nil
+	}
+	return h.IndexPrices.Check(h.PriceBand, symbol, price, time.Now())
+}
+
+// orderLimitMessages describe each per-order limit being broken
+var orderLimitMessages = map[string]string{
+	risk.LimitOrderNotional: "Order notional above limit",
+	risk.LimitOrderQuantity: "Order quantity above limit",
+	risk.LimitOpenOrders:    "Too many open orders",
+}
+
+// checkRiskLimits rejects an order if it's priced outside the band around
+// the index price, breaks the user's per-order limits or could take them
+// past their daily limit, writing the error response. Returns the order's
+// reservation against the daily limit, or false if the order must not
+// proceed.
+func (h *Handler) checkRiskLimits(w http.ResponseWriter, r *http.Request, userID int, req orderRequest) (*risk.Reservation, bool) {
+	var bandErr *pricefeed.BandError
+	if errors.As(h.checkPriceBand(req.Symbol, req.Price), &bandErr) {
+		h.publishRejection(userID, req, codePriceOutOfBand, bandErr.Error())
+		writeAPIError(w, http.StatusBadRequest, newFieldError(codePriceOutOfBand, "price", bandErr.Error()))
+		return nil, false
+	}
+
+	err := h.checkOrderLimits(r.Context(), userID, req.Price, req.Quantity)
+	var orderLimitErr *risk.OrderLimitError
+	if errors.As(err, &orderLimitErr) {
+		h.publishRejection(userID, req, orderLimitErr.Limit, orderLimitMessages[orderLimitErr.Limit])
+		writeOrderLimitError(w, orderLimitErr)
+		return nil, false
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	hold, err := h.checkRisk(r.Context(), userID, req.Price*req.Quantity)
+	var limitErr *risk.LimitError
+	if errors.As(err, &limitErr) {
+		h.publishRejection(userID, req, codeDailyNotionalLimit, "Daily notional limit exceeded")
+		writeNotionalLimitError(w, limitErr)
+		return nil, false
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return nil, false
 	}
+	return hold, true
+}
+
+// StartDraining makes the handler reject new and amended orders so the server
+// can shut down once in-flight requests finish. Cancels are still accepted.
+func (h *Handler) StartDraining() {
+	if !h.draining.Swap(true) {
+		close(h.drainedChan())
+	}
+}
 
-	if req.Username == "" || req.Password == "" {
-		writeError(w, http.StatusBadRequest, "Username and password required")
+// drainedChan returns a channel closed once the server starts shutting down
+func (h *Handler) drainedChan() chan struct{} {
+	h.drainOnce.Do(func() { h.drained = make(chan struct{}) })
+	return h.drained
+}
+
+// RejectWhileDraining responds 503 to requests that could create trades once
+// the server has started shutting down
+func (h *Handler) RejectWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.draining.Load() {
+			w.Header().Set("Connection", "close")
+			writeCodedError(w, http.StatusServiceUnavailable, codeShuttingDown, "Server is shutting down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RejectWhileHalted responds 503 to requests that place or amend orders
+// while the market is halted. Cancels aren't affected.
+func (h *Handler) RejectWhileHalted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Exchange.MarketStatus().State == exchange.MarketHalted {
+			writeCodedError(w, http.StatusServiceUnavailable, codeMarketHalted, "Market halted")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeWeakPassword rejects a password that doesn't meet the password policy,
+// naming the requirement it misses in auth's words
+func writeWeakPassword(w http.ResponseWriter, weak *auth.WeakPasswordError) {
+	message := weak.Error()
+	writeCodedError(w, http.StatusBadRequest, codeWeakPassword, strings.ToUpper(message[:1])+message[1:])
+}
+
+// Register handles user registration
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
+	// Unavailable usernames and weak passwords get a stable code clients
+	// can match on
 	user, err := h.AuthService.Register(r.Context(), req.Username, req.Password)
-	if err != nil {
+	var weak *auth.WeakPasswordError
+	switch {
+	case errors.As(err, &weak):
+		writeWeakPassword(w, weak)
+		return
+	case errors.Is(err, db.ErrUsernameTaken):
+		writeCodedError(w, http.StatusConflict, codeUsernameTaken, "Username already taken")
+		return
+	case errors.Is(err, auth.ErrUsernameReserved):
+		writeCodedError(w, http.StatusConflict, codeUsernameReserved, "Username is reserved")
+		return
+	case err != nil:
 		writeError(w, http.StatusInternalServerError, "Failed to register user")
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]interface{}{
-		"id":       user.ID,
-		"username": user.Username,
-	})
+	writeJSON(w, http.StatusCreated, userResponse{ID: user.ID, Username: user.Username})
 }
 
 // Login handles user login
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+	var req credentials
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	token, err := h.AuthService.Login(r.Context(), req.Username, req.Password)
+	client := auth.Client{IP: clientIP(r), UserAgent: r.UserAgent()}
+	token, err := h.AuthService.LoginFrom(r.Context(), req.Username, req.Password, client)
+	if errors.Is(err, auth.ErrServiceAccount) {
+		writeError(w, http.StatusForbidden, "Service accounts can't log in; use an API key")
+		return
+	}
+	if errors.Is(err, auth.ErrAccountSuspended) {
+		writeError(w, http.StatusForbidden, "Account suspended")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+	writeJSON(w, http.StatusOK, tokenResponse{Token: token})
 }
 
-// JWTAuthMiddleware verifies JWT tokens
+// JWTAuthMiddleware verifies JWT tokens, or signed API-key requests when an
+// X-API-KEY header is present
 func (h *Handler) JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-KEY") != "" {
+			h.authenticateAPIKey(w, r, next)
+			return
+		}
+
 		tokenString := r.Header.Get("Authorization")
 		if tokenString == "" {
 			writeError(w, http.StatusUnauthorized, "Authorization header required")
@@ -104,18 +401,186 @@ func (h *Handler) JWTAuthMiddleware(next http.Handler) http.Handler {
 			tokenString = tokenString[7:]
 		}
 
-		userID, err := h.AuthService.GetUserFromToken(tokenString)
+		claims, err := h.AuthService.ParseToken(tokenString)
+		if err != nil {
+			writeCodedError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+			return
+		}
+		if claims.ImpersonatorID != 0 {
+			h.serveImpersonated(w, r, next, claims)
+			return
+		}
+		err = h.AuthService.CheckSession(r.Context(), claims)
+		if errors.Is(err, auth.ErrSessionEnded) {
+			writeError(w, http.StatusUnauthorized, "Session ended")
+			return
+		}
 		if err != nil {
-			writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+			writeError(w, http.StatusInternalServerError, "Failed to check session")
 			return
 		}
 
-		// Add user_id to context
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		ctx := context.WithValue(r.Context(), "session_id", claims.LoginSessionID)
+		h.serveAsUser(w, r.WithContext(ctx), next, claims.UserID)
 	})
 }
 
+// serveAsUser serves an authenticated request if the account is still
+// usable, adding user_id, role and service_account to the context and
+// attributing its changes to the user in the audit log
+func (h *Handler) serveAsUser(w http.ResponseWriter, r *http.Request, next http.Handler, userID int) {
+	user, err := h.AuthService.ActiveUser(r.Context(), userID)
+	switch {
+	case errors.Is(err, auth.ErrAccountSuspended):
+		writeError(w, http.StatusForbidden, "Account suspended")
+		return
+	case errors.Is(err, db.ErrAccountMerged):
+		writeError(w, http.StatusForbidden, "Account merged")
+		return
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), "user_id", user.ID)
+	ctx = context.WithValue(ctx, "role", user.Role)
+	ctx = context.WithValue(ctx, "service_account", user.ServiceAccount)
+	ctx = db.WithActor(ctx, db.Actor{UserID: user.ID, Source: db.SourceAPI, IP: clientIP(r)})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireRole rejects requests whose user doesn't have the given role. It
+// must run after JWTAuthMiddleware. Changes made by admins are audited as
+// admin requests.
+func (h *Handler) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userRole, _ := r.Context().Value("role").(string); userRole != role {
+				writeError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			ctx := r.Context()
+			if role == "admin" {
+				actor := db.ActorFrom(ctx)
+				actor.Source = db.SourceAdmin
+				ctx = db.WithActor(ctx, actor)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// orderRequest is the body of a new order
+type orderRequest struct {
+	Symbol        string  `json:"symbol,omitempty"` // Defaults to BTC-USD
+	Type          string  `json:"type" validate:"required,oneof=buy sell"`
+	Price         float64 `json:"price" validate:"required,gt=0"`
+	Quantity      float64 `json:"quantity" validate:"required,gt=0"`
+	Tag           string  `json:"tag,omitempty" validate:"max=64"`
+	ClientOrderID string  `json:"client_order_id,omitempty" validate:"max=64"` // The client's own ID, unique among the user's orders
+	TimeInForce   string  `json:"time_in_force,omitempty" validate:"oneof=GTC GTD IOC FOK"`
+	PostOnly      *bool   `json:"post_only,omitempty"` // Nil if omitted, so the user's default applies
+	Confirm       bool    `json:"confirm,omitempty"`   // Required above the user's confirmation threshold
+
+	DisplayQuantity float64    `json:"display_quantity,omitempty" validate:"gt=0"`         // Makes the order an iceberg showing only this much
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`                               // When a GTD order is canceled if still open
+	LifetimeMS      int        `json:"lifetime_ms,omitempty" validate:"min=100,max=60000"` // Takes the order off the book this many milliseconds after it rests
+}
+
+// restsOnBook reports whether a time in force leaves unfilled quantity on
+// the book
+func restsOnBook(timeInForce string) bool {
+	return timeInForce == "GTC" || timeInForce == "GTD"
+}
+
+// applyPreferences fills in fields omitted from the request with the user's
+// defaults. Default post-only only applies to orders that rest on the book.
+func (req *orderRequest) applyPreferences(prefs *models.Preferences) {
+	if req.TimeInForce == "" {
+		req.TimeInForce = prefs.DefaultTimeInForce
+	}
+	if req.PostOnly == nil {
+		postOnly := prefs.DefaultPostOnly && restsOnBook(req.TimeInForce)
+		req.PostOnly = &postOnly
+	}
+}
+
+// needsConfirmation reports whether the order's notional is above the user's
+// confirmation threshold and the request doesn't confirm it
+func (req *orderRequest) needsConfirmation(prefs *models.Preferences) bool {
+	return prefs.ConfirmNotionalAbove > 0 && req.Price*req.Quantity > prefs.ConfirmNotionalAbove && !req.Confirm
+}
+
+// validate checks an order request's fields against their rules, then
+// against its instrument, defaulting the symbol and time in force if none
+// is given
+func (req *orderRequest) validate() error {
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+	if req.Symbol == "" {
+		req.Symbol = exchange.DefaultSymbol
+	}
+	instrument, ok := instruments.Lookup(req.Symbol)
+	if !ok {
+		return newFieldError(codeUnknownSymbol, "symbol", "Unknown symbol")
+	}
+	if err := instrument.ValidateOrder(req.Price, req.Quantity); err != nil {
+		return invalidOrder(err)
+	}
+	if req.TimeInForce == "" {
+		req.TimeInForce = "GTC"
+	}
+	if req.TimeInForce == "GTD" && req.ExpiresAt == nil {
+		return newFieldError(codeInvalidExpiry, "expires_at", "GTD orders need an expiry")
+	}
+	if req.TimeInForce != "GTD" && req.ExpiresAt != nil {
+		return newFieldError(codeInvalidExpiry, "expires_at", "Only GTD orders can have an expiry")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return newFieldError(codeInvalidExpiry, "expires_at", "Expiry must be in the future")
+	}
+	if req.PostOnly != nil && *req.PostOnly && !restsOnBook(req.TimeInForce) {
+		return newFieldError(codeInvalidTimeInForce, "post_only", "Post-only orders must be GTC or GTD")
+	}
+	if req.LifetimeMS != 0 && req.TimeInForce != "GTC" {
+		return newFieldError(codeInvalidTimeInForce, "lifetime_ms", "Orders with a lifetime must be GTC")
+	}
+	if req.DisplayQuantity != 0 {
+		if !restsOnBook(req.TimeInForce) {
+			return newFieldError(codeInvalidTimeInForce, "display_quantity", "Iceberg orders must be GTC or GTD")
+		}
+		if err := instrument.ValidateDisplayQuantity(req.DisplayQuantity, req.Quantity); err != nil {
+			return invalidOrder(err)
+		}
+	}
+	return nil
+}
+
+// order builds the open order placed by a validated request
+func (req orderRequest) order(userID int) models.Order {
+	return models.Order{
+		UserID:   userID,
+		Symbol:   req.Symbol,
+		Type:     req.Type,
+		Price:    req.Price,
+		Quantity: req.Quantity,
+		Status:   "open",
+		Tag:      req.Tag,
+
+		ClientOrderID: req.ClientOrderID,
+		TimeInForce:   req.TimeInForce,
+		PostOnly:      req.PostOnly != nil && *req.PostOnly,
+
+		DisplayQuantity: req.DisplayQuantity,
+		ExpiresAt:       req.ExpiresAt,
+		Lifetime:        time.Duration(req.LifetimeMS) * time.Millisecond,
+	}
+}
+
 // PlaceOrder handles order placement and matching
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(int)
@@ -124,69 +589,400 @@ func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Type     string  `json:"type"`
-		Price    float64 `json:"price"`
-		Quantity float64 `json:"quantity"`
-	}
+	var req orderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+		writeCodedError(w, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load preferences")
 		return
 	}
+	req.applyPreferences(prefs)
 
 	// Validate input
-	if req.Type != "buy" && req.Type != "sell" {
-		writeError(w, http.StatusBadRequest, "Type must be 'buy' or 'sell'")
+	if err := req.validate(); err != nil {
+		h.publishRejection(userID, req, errorCode(http.StatusBadRequest, err), err.Error())
+		writeAPIError(w, http.StatusBadRequest, err)
 		return
 	}
-	if req.Price <= 0 || req.Quantity <= 0 {
-		writeError(w, http.StatusBadRequest, "Price and quantity must be positive")
+	if req.needsConfirmation(prefs) {
+		id, expiresAt, err := h.confirmations.hold(userID, req, time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to hold order for confirmation")
+			return
+		}
+		h.publishRejection(userID, req, codeConfirmationNeeded, "Order notional above confirmation threshold")
+		writeJSON(w, http.StatusBadRequest, confirmationRequiredResponse{
+			Code:                 codeConfirmationNeeded,
+			ConfirmNotionalAbove: prefs.ConfirmNotionalAbove,
+			ConfirmationID:       id,
+			Error:                "Order notional above confirmation threshold; resend with \"confirm\": true or confirm it",
+			ExpiresAt:            expiresAt,
+			Notional:             req.Price * req.Quantity,
+		})
 		return
 	}
 
-	// Create order
-	order := models.Order{
-		UserID:   userID,
-		Type:     req.Type,
-		Price:    req.Price,
-		Quantity: req.Quantity,
-		Status:   "open",
+	h.placeOrder(w, r, userID, req)
+}
+
+// placeOrder risk checks and submits a validated order, writing the response
+func (h *Handler) placeOrder(w http.ResponseWriter, r *http.Request, userID int, req orderRequest) {
+	hold, ok := h.checkRiskLimits(w, r, userID, req)
+	if !ok {
+		return
 	}
 
-	// Save order to database
-	dbOrder, err := h.DB.CreateOrder(r.Context(), &order)
+	dbOrder, _, err := h.submitOrder(r.Context(), req.order(userID), hold)
+	var throttled *exchange.ThrottledError
+	if errors.As(err, &throttled) {
+		h.publishRejection(userID, req, codeThrottled, throttled.Error())
+		writeThrottled(w, throttled)
+		return
+	}
+	if errors.Is(err, errClientOrderIDTaken) {
+		h.publishRejection(userID, req, codeClientOrderIDTaken, err.Error())
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create order")
+		writeAPIError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	message := "Order placed"
+	if paused, _, _ := h.Exchange.PauseState(); paused {
+		message = "Order queued; matching is paused"
+	}
+
+	writeJSON(w, http.StatusCreated, orderStatusResponse{Message: message, OrderID: dbOrder.ID, Status: dbOrder.Status})
+}
+
+// submitOrder saves a validated order, matches it against the book and
+// records the resulting trades. The returned order's status is updated if
+// matching filled or canceled it. Orders over the engine throttle are
+// rejected with a *exchange.ThrottledError before they're saved. The
+// order's reservation against the daily limit is released if it fails.
+func (h *Handler) submitOrder(ctx context.Context, order models.Order, hold *risk.Reservation) (*models.Order, []models.Trade, error) {
+	start, ok := ctx.Value("received_at").(time.Time)
+	if !ok {
+		start = time.Now()
+	}
+	if err := h.admitOrder(ctx, order.UserID); err != nil {
+		hold.Release()
+		return nil, nil, err
+	}
+	h.snapshotMu.RLock()
+	dbOrder, err := h.DB.CreateOrder(ctx, &order)
+	if errors.Is(err, db.ErrDuplicateClientOrderID) {
+		h.snapshotMu.RUnlock()
+		hold.Release()
+		return nil, nil, errClientOrderIDTaken
+	}
+	if err != nil {
+		h.snapshotMu.RUnlock()
+		hold.Release()
+		return nil, nil, fmt.Errorf("Failed to create order")
+	}
+	hold.Assign(dbOrder.ID)
+
 	// Try to match order
-	trades, filledOrderIDs := h.Exchange.MatchOrder(*dbOrder)
+	h.appendJournal(journal.Entry{Type: journal.OrderAccepted, OrderID: dbOrder.ID})
+	h.publishOrderUpdate("accepted", *dbOrder, 0)
+	accepted := time.Now()
+	trades, filledOrderIDs, canceledOrderIDs, err := h.Markets.MatchOrder(*dbOrder)
+	h.snapshotMu.RUnlock()
+	if err != nil {
+		hold.Release()
+		return nil, nil, fmt.Errorf("Failed to match order")
+	}
+	matched := time.Now()
+	h.recordAckLatency(ctx)
+
+	if err := h.recordMatches(ctx, trades, filledOrderIDs, canceledOrderIDs); err != nil {
+		return nil, nil, err
+	}
+	persisted := time.Now()
+	h.Stages.Record(monitor.StageAccept, accepted.Sub(start), persisted)
+	h.Stages.Record(monitor.StageMatch, matched.Sub(accepted), persisted)
+	h.Stages.Record(monitor.StagePersist, persisted.Sub(matched), persisted)
+	if slices.Contains(filledOrderIDs, dbOrder.ID) {
+		dbOrder.Status = "filled"
+	} else if slices.Contains(canceledOrderIDs, dbOrder.ID) {
+		dbOrder.Status = "canceled"
+	}
+	return dbOrder, trades, nil
+}
+
+// recordAckLatency records the time since the request was received as the
+// acknowledgement latency of an order the engine has just accepted
+func (h *Handler) recordAckLatency(ctx context.Context) {
+	if received, ok := ctx.Value("received_at").(time.Time); ok {
+		now := time.Now()
+		h.Latency.Record(now.Sub(received), now)
+	}
+}
+
+// applyFees sets the fee charged to each side of a trade: the taker rate on
+// the side that crossed the book and the maker rate on the resting side
+func (h *Handler) applyFees(trade *models.Trade) {
+	notional := trade.Price * trade.Quantity
+	if trade.TakerSide == "buy" {
+		trade.BuyFee = notional * h.Fees.Taker
+		trade.SellFee = notional * h.Fees.Maker
+	} else {
+		trade.BuyFee = notional * h.Fees.Maker
+		trade.SellFee = notional * h.Fees.Taker
+	}
+}
+
+// appendJournal writes an entry to the engine journal, if there is one, and
+// returns it as written. Failures are logged rather than returned since the
+// database remains the primary record.
+func (h *Handler) appendJournal(entry journal.Entry) journal.Entry {
+	if h.Journal == nil {
+		return entry
+	}
+	entry, err := h.Journal.Append(entry)
+	if err != nil {
+		log.Printf("Failed to journal %s: %v", entry.Type, err)
+	}
+	return entry
+}
+
+// unbookOrders removes canceled orders from the order book, journaling the
+// removal and announcing the cancellations, and returns how many were resting
+func (h *Handler) unbookOrders(ctx context.Context, orderIDs ...int) int {
+	return h.unbookOrdersFor(ctx, "", orderIDs...)
+}
+
+// unbookOrdersFor is unbookOrders announcing why the orders were canceled,
+// e.g. "expired"
+func (h *Handler) unbookOrdersFor(ctx context.Context, reason string, orderIDs ...int) int {
+	if len(orderIDs) == 0 {
+		return 0
+	}
+	removed, err := h.Markets.RemoveOrders(orderIDs)
+	if err != nil {
+		// The database is the source of truth; a book that can't be
+		// reached is rebuilt from it on restart
+		log.Printf("Failed to remove orders %v from the order book: %v", orderIDs, err)
+	}
+	h.appendJournal(journal.Entry{Type: journal.OrdersCanceled, Canceled: orderIDs})
+	h.publishOrderChanges(ctx, orderIDs, reason)
+	return removed
+}
+
+// recordMatches persists the trades and the filled and canceled orders
+// produced by the matching engine. The match is journaled first so it can
+// be recovered if the server stops before the database is up to date. The
+// changes are audited as the engine's, whichever request triggered them.
+func (h *Handler) recordMatches(ctx context.Context, trades []models.Trade, filledOrderIDs, canceledOrderIDs []int) error {
+	ctx = db.WithActor(ctx, db.Actor{Source: db.SourceEngine})
+	for i := range trades {
+		h.applyFees(&trades[i])
+	}
+	if len(trades) > 0 || len(filledOrderIDs) > 0 || len(canceledOrderIDs) > 0 {
+		entry := journal.Entry{Type: journal.OrdersMatched, Filled: filledOrderIDs, Canceled: canceledOrderIDs}
+		for _, trade := range trades {
+			entry.Trades = append(entry.Trades, journal.NewTrade(trade))
+		}
+		if entry = h.appendJournal(entry); entry.Seq != 0 {
+			for i := range trades {
+				trades[i].JournalRef = journal.TradeRef(entry.Seq, i)
+			}
+		}
+	}
 
 	// Save trades to database
 	for _, trade := range trades {
-		_, err := h.DB.CreateTrade(r.Context(), &trade)
+		dbTrade, err := h.DB.CreateTrade(ctx, &trade)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to record trade")
-			return
+			return fmt.Errorf("Failed to record trade")
 		}
+		// Owners and the engine's sequence number aren't stored with the
+		// trade, so carry them over for subscribers
+		dbTrade.BuyUserID, dbTrade.SellUserID = trade.BuyUserID, trade.SellUserID
+		dbTrade.Sequence = trade.Sequence
+		h.Events.Publish(events.Event{Type: events.TradeExecuted, Data: *dbTrade})
 	}
 
 	// Update filled orders
 	for _, orderID := range filledOrderIDs {
-		if err := h.DB.UpdateOrderStatus(r.Context(), orderID, "filled"); err != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to update order status")
+		if err := h.DB.UpdateOrderStatus(ctx, orderID, "filled"); err != nil {
+			return fmt.Errorf("Failed to update order status")
+		}
+	}
+
+	// Cancel orders whose time in force or post-only instruction stopped
+	// them resting on the book, or whose lifetime ran out
+	for _, orderID := range canceledOrderIDs {
+		if err := h.DB.UpdateOrderStatus(ctx, orderID, "canceled"); err != nil {
+			return fmt.Errorf("Failed to update order status")
+		}
+	}
+	changed := slices.Concat(filledOrderIDs, canceledOrderIDs)
+	for _, trade := range trades {
+		changed = append(changed, trade.BuyOrderID, trade.SellOrderID)
+	}
+	h.publishOrderChanges(ctx, changed, "")
+	return nil
+}
+
+// AmendOrder changes the price and/or quantity of an open order
+func (h *Handler) AmendOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	var req amendRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	// Omitted fields are left unchanged, but at least one must be supplied
+	if req.Price == 0 && req.Quantity == 0 {
+		writeError(w, http.StatusBadRequest, "Price or quantity required")
+		return
+	}
+
+	if req.Price != 0 {
+		var bandErr *pricefeed.BandError
+		if errors.As(h.checkPriceBand(exchange.DefaultSymbol, req.Price), &bandErr) {
+			writeAPIError(w, http.StatusBadRequest, newFieldError(codePriceOutOfBand, "price", bandErr.Error()))
 			return
 		}
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]interface{}{
-		"message":  "Order placed",
-		"order_id": dbOrder.ID,
+	// The amended order must keep to the user's per-order limits, with
+	// omitted fields as they are
+	order, err := h.DB.GetOrder(r.Context(), orderID, userID)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		writeError(w, http.StatusBadRequest, "Failed to amend order: order not found or not owned by user")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load order")
+		return
+	}
+	price, quantity := order.Price, order.Quantity
+	if req.Price != 0 {
+		price = req.Price
+	}
+	if req.Quantity != 0 {
+		quantity = req.Quantity
+	}
+	err = h.checkAmendLimits(r.Context(), userID, price, quantity)
+	var orderLimitErr *risk.OrderLimitError
+	if errors.As(err, &orderLimitErr) {
+		writeOrderLimitError(w, orderLimitErr)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Amending up needs the increase to fit in the user's daily limit
+	filled, err := h.DB.GetFilledQuantities(r.Context(), []int{orderID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load filled quantity")
+		return
+	}
+	hold, err := h.checkAmendRisk(r.Context(), userID, orderID, price*math.Max(quantity-filled[orderID], 0))
+	var limitErr *risk.LimitError
+	if errors.As(err, &limitErr) {
+		writeNotionalLimitError(w, limitErr)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var throttled *exchange.ThrottledError
+	if errors.As(h.admitOrder(r.Context(), userID), &throttled) {
+		hold.Release()
+		writeThrottled(w, throttled)
+		return
+	}
+
+	// Amend order in database
+	dbOrder, err := h.DB.AmendOrder(r.Context(), orderID, userID, req.Price, req.Quantity)
+	if err != nil {
+		hold.Release()
+		writeError(w, http.StatusBadRequest, "Failed to amend order: "+err.Error())
+		return
+	}
+	hold.Assign(orderID)
+
+	// What has been recorded as filled is reported with the amend
+	filled, err = h.DB.GetFilledQuantities(r.Context(), []int{orderID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load filled quantity")
+		return
+	}
+
+	// Re-check the amended order against the book. The book holds what's
+	// left to fill, so a resized order rests with its new total less what
+	// the engine has matched, including fills not recorded yet; a price-only
+	// amend leaves it as it is.
+	total := 0.0
+	if req.Quantity != 0 {
+		total = dbOrder.Quantity
+	}
+	trades, filledOrderIDs, canceledOrderIDs, found, err := h.Markets.AmendOrderTotal(dbOrder.Symbol, orderID, dbOrder.Price, total, order.Quantity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to amend order")
+		return
+	}
+	if !found {
+		// Log if order wasn't in book (non-fatal, as DB is source of truth)
+		log.Printf("Order %d not found in order book", orderID)
+	}
+	h.appendJournal(journal.Entry{Type: journal.OrdersUpdated, Updated: []int{orderID}})
+	h.publishOrderUpdate("amended", *dbOrder, filled[orderID])
+
+	if err := h.recordMatches(r.Context(), trades, filledOrderIDs, canceledOrderIDs); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := "open"
+	for _, id := range filledOrderIDs {
+		if id == orderID {
+			status = "filled"
+		}
+	}
+	if slices.Contains(canceledOrderIDs, orderID) {
+		status = "canceled"
+	}
+
+	writeJSON(w, http.StatusOK, orderAmendedResponse{
+		Message:  "Order amended",
+		OrderID:  dbOrder.ID,
+		Price:    dbOrder.Price,
+		Quantity: dbOrder.Quantity,
+		Status:   status,
+		Trades:   len(trades),
+
+		FilledQuantity:    filled[orderID],
+		RemainingQuantity: dbOrder.Quantity - filled[orderID],
 	})
 }
 
-// GetUserOrders retrieves a user's orders
+// GetUserOrders retrieves a page of the user's orders, filtered by the query string
 func (h *Handler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(int)
 	if !ok {
@@ -194,7 +990,18 @@ func (h *Handler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := h.DB.GetUserOrders(r.Context(), userID)
+	filter, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r.URL.Query(), db.IsValidOrderSort)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orders, err := h.Store.GetUserOrders(r.Context(), userID, filter, page)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to retrieve orders")
 		return
@@ -203,61 +1010,206 @@ func (h *Handler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, orders)
 }
 
+// GetOrder returns one of the user's orders with its fills and how much of
+// it is still to fill
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := h.Store.GetOrder(r.Context(), orderID, userID)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		writeCodedError(w, http.StatusNotFound, codeOrderNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+	fills, err := h.Store.GetOrderFills(r.Context(), orderID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve fills")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newOrderDetail(*order, fills))
+}
+
+// GetOrderByClientID returns the user's order with a client order ID, as
+// GetOrder does
+func (h *Handler) GetOrderByClientID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	order, err := h.Store.GetOrderByClientID(r.Context(), userID, chi.URLParam(r, "cid"))
+	if errors.Is(err, db.ErrOrderNotFound) {
+		writeCodedError(w, http.StatusNotFound, codeOrderNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+	fills, err := h.Store.GetOrderFills(r.Context(), order.ID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve fills")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newOrderDetail(*order, fills))
+}
+
 // GetOrderBook retrieves the current order book
 func (h *Handler) GetOrderBook(w http.ResponseWriter, r *http.Request) {
-	// Get open orders directly from database
-	orders, err := h.DB.GetOpenOrders(r.Context())
+	// Get open orders directly from database, or its replica. Changes reach
+	// it after the engine, so the sequence number read afterwards covers
+	// every change the orders reflect.
+	orders, err := h.Store.GetBookOrders(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to retrieve order book")
 		return
 	}
+	book := marketdata.NewOrderBook(orders, 0)
+	book.Seq = h.Exchange.Sequence()
+
+	response, err := h.Encoder.Marshal(book)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode order book")
+		return
+	}
+	writeEncoded(w, http.StatusOK, response)
+}
+
+// GetUserTrades retrieves a page of the user's trade history, filtered by the
+// query string, with the user's side, role and fee on each trade. With
+// since_id, the page is the trades after that trade ID in execution order.
+func (h *Handler) GetUserTrades(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter, err := parseTradeFilter(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r.URL.Query(), db.IsValidTradeSort)
+	if err == nil && r.URL.Query().Has("since_id") {
+		page, err = inExecutionOrder(page)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
 
-	// Separate into buy and sell orders
-	var buyOrders, sellOrders []models.Order
-	for _, order := range orders {
-		if order.Type == "buy" {
-			buyOrders = append(buyOrders, order)
-		} else {
-			sellOrders = append(sellOrders, order)
+	trades, err := h.Store.GetUserTradeHistory(r.Context(), userID, filter, page)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve trades")
+		return
+	}
+	for i := range trades {
+		if inst, ok := instruments.Lookup(trades[i].Symbol); ok {
+			trades[i].FeeCurrency = inst.Quote
 		}
 	}
 
-	// Sort orders appropriately
-	sort.Slice(buyOrders, func(i, j int) bool {
-		if buyOrders[i].Price == buyOrders[j].Price {
-			return buyOrders[i].CreatedAt.Before(buyOrders[j].CreatedAt)
+	writeJSON(w, http.StatusOK, trades)
+}
+
+// GetUserFills retrieves the user's fills, one per execution, starting at
+// trade ID from_id. Page through with from_id set to the last trade_id + 1.
+func (h *Handler) GetUserFills(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	fromID := 0
+	if v := query.Get("from_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "from_id must be a non-negative integer")
+			return
 		}
-		return buyOrders[i].Price > buyOrders[j].Price
-	})
+		fromID = id
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
 
-	sort.Slice(sellOrders, func(i, j int) bool {
-		if sellOrders[i].Price == sellOrders[j].Price {
-			return sellOrders[i].CreatedAt.Before(sellOrders[j].CreatedAt)
+	fills, err := h.Store.GetUserFills(r.Context(), userID, fromID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve fills")
+		return
+	}
+	for i := range fills {
+		if inst, ok := instruments.Lookup(fills[i].Symbol); ok {
+			fills[i].FeeCurrency = inst.Quote
 		}
-		return sellOrders[i].Price < sellOrders[j].Price
-	})
+	}
+	if fills == nil {
+		fills = []models.Fill{}
+	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"buy_orders":  buyOrders,
-		"sell_orders": sellOrders,
-	})
+	writeJSON(w, http.StatusOK, fills)
 }
 
-// GetUserTrades retrieves a user's trade history
-func (h *Handler) GetUserTrades(w http.ResponseWriter, r *http.Request) {
+// defaultVolumeWindow is the lookback of GET /account/volume without a window
+const defaultVolumeWindow = "30d"
+
+// GetUserVolume returns the user's maker and taker volume and trade counts
+// by instrument over a window, for users optimizing their fees
+func (h *Handler) GetUserVolume(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(int)
 	if !ok {
 		writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	trades, err := h.DB.GetUserTrades(r.Context(), userID)
+	query := r.URL.Query()
+	symbol := query.Get("symbol")
+	if _, ok := instruments.Lookup(symbol); symbol != "" && !ok {
+		writeCodedError(w, http.StatusBadRequest, codeUnknownSymbol, "Unknown symbol")
+		return
+	}
+	window := query.Get("window")
+	if window == "" {
+		window = defaultVolumeWindow
+	}
+	lookback, err := parseWindow(window)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	since := time.Now().Add(-lookback)
+	breakdowns, err := h.DB.GetUserVolume(r.Context(), userID, symbol, since)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve trades")
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve volume")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, trades)
+	writeJSON(w, http.StatusOK, volumeResponse{Since: since, Symbols: breakdowns, Window: window})
 }
 
 // CancelOrder cancels an open order
@@ -276,20 +1228,113 @@ func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Cancel order in database
-	err = h.DB.CancelOrder(r.Context(), orderID, userID)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Failed to cancel order: "+err.Error())
+	// Cancel order in database. Cancels are idempotent: repeating a cancel
+	// succeeds, and cancelling a filled order reports its final status.
+	err = h.Store.CancelOrder(r.Context(), orderID, userID)
+	var notOpen *db.OrderNotOpenError
+	switch {
+	case errors.As(err, &notOpen) && notOpen.Status == "canceled":
+		writeJSON(w, http.StatusOK, orderStatusResponse{Message: "Order already canceled", OrderID: orderID, Status: notOpen.Status})
+		return
+	case errors.As(err, &notOpen):
+		writeJSON(w, http.StatusConflict, orderConflictResponse{Code: codeOrderNotOpen, Error: "Order already " + notOpen.Status, OrderID: orderID, Status: notOpen.Status})
+		return
+	case errors.Is(err, db.ErrOrderNotFound):
+		writeCodedError(w, http.StatusNotFound, codeOrderNotFound, "Order not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to cancel order")
 		return
 	}
 
 	// Remove from order book
-	if !h.Exchange.RemoveOrder(orderID) {
+	if h.unbookOrders(r.Context(), orderID) == 0 {
 		// Log if order wasn't in book (non-fatal, as DB is source of truth)
 		log.Printf("Order %d not found in order book", orderID)
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"message": "Order canceled"})
+	writeJSON(w, http.StatusOK, orderStatusResponse{Message: "Order canceled", OrderID: orderID, Status: "canceled"})
+}
+
+// CancelOrdersBulk cancels all of the user's open orders matching a filter
+func (h *Handler) CancelOrdersBulk(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req cancelBulkRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if req.MaxPrice > 0 && req.MinPrice > req.MaxPrice {
+		writeError(w, http.StatusBadRequest, "Min price must not exceed max price")
+		return
+	}
+
+	filter := db.OrderFilter{
+		Tag:      req.Tag,
+		Symbol:   req.Symbol,
+		Type:     req.Side,
+		MinPrice: req.MinPrice,
+		MaxPrice: req.MaxPrice,
+	}
+	if filter.IsEmpty() {
+		writeError(w, http.StatusBadRequest, "At least one filter required")
+		return
+	}
+
+	// Cancel orders in database
+	orderIDs, err := h.DB.CancelOrders(r.Context(), userID, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to cancel orders")
+		return
+	}
+
+	// Remove all of them from the order book at once
+	if removed := h.unbookOrders(r.Context(), orderIDs...); removed != len(orderIDs) {
+		// Log if orders weren't in book (non-fatal, as DB is source of truth)
+		log.Printf("%d of %d canceled orders not found in order book", len(orderIDs)-removed, len(orderIDs))
+	}
+
+	writeJSON(w, http.StatusOK, ordersCanceledResponse{Canceled: len(orderIDs), OrderIDs: orderIDs})
+}
+
+// CancelAllOrders cancels every open order of the user, optionally only those
+// for one symbol and/or side, in one database statement and one engine step
+func (h *Handler) CancelAllOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.OrderFilter{
+		Symbol: query.Get("symbol"),
+		Type:   query.Get("side"),
+	}
+	if filter.Type != "" && filter.Type != "buy" && filter.Type != "sell" {
+		writeError(w, http.StatusBadRequest, "Side must be 'buy' or 'sell'")
+		return
+	}
+
+	// Cancel orders in database
+	orderIDs, err := h.DB.CancelOrders(r.Context(), userID, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to cancel orders")
+		return
+	}
+
+	// Remove all of them from the order book at once
+	if removed := h.unbookOrders(r.Context(), orderIDs...); removed != len(orderIDs) {
+		// Log if orders weren't in book (non-fatal, as DB is source of truth)
+		log.Printf("%d of %d canceled orders not found in order book", len(orderIDs)-removed, len(orderIDs))
+	}
+
+	writeJSON(w, http.StatusOK, ordersCanceledResponse{Canceled: len(orderIDs), OrderIDs: orderIDs})
 }
 
 // GetAllTrades retrieves all trades in the system
@@ -302,7 +1347,7 @@ func (h *Handler) GetAllTrades(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all trades from database
-	trades, err := h.DB.GetAllTrades(r.Context())
+	trades, err := h.Store.GetAllTrades(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to retrieve trades")
 		return
@@ -310,3 +1355,42 @@ func (h *Handler) GetAllTrades(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, trades)
 }
+
+// GetRecentTrades returns the latest public trades in a symbol, newest
+// first. Older pages are fetched with before_id set to the last trade ID of
+// the previous page.
+func (h *Handler) GetRecentTrades(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	symbol := query.Get("symbol")
+	if symbol == "" {
+		symbol = exchange.DefaultSymbol
+	}
+	if _, ok := instruments.Lookup(symbol); !ok {
+		writeCodedError(w, http.StatusBadRequest, codeUnknownSymbol, "Unknown symbol")
+		return
+	}
+	beforeID := 0
+	if v := query.Get("before_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			writeError(w, http.StatusBadRequest, "before_id must be a positive integer")
+			return
+		}
+		beforeID = id
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	trades, err := h.Store.GetRecentTrades(r.Context(), symbol, beforeID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve trades")
+		return
+	}
+	writeJSON(w, http.StatusOK, trades)
+}
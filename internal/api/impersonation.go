@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+)
+
+// defaultImpersonationMinutes is how long an impersonation session lasts
+// when the request doesn't say
+const defaultImpersonationMinutes = 30
+
+// serveImpersonated serves a read-only request made with an impersonation
+// token as the impersonated user. The admin must still be an admin, and the
+// request is recorded in the session's audit log before it is served.
+func (h *Handler) serveImpersonated(w http.ResponseWriter, r *http.Request, next http.Handler, claims *auth.TokenClaims) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusForbidden, "Impersonation is read-only")
+		return
+	}
+	admin, err := h.AuthService.ActiveUser(r.Context(), claims.ImpersonatorID)
+	if err != nil || admin.Role != "admin" {
+		writeCodedError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	err = h.DB.RecordImpersonationRequest(r.Context(), claims.SessionID, r.Method, r.URL.Path)
+	switch {
+	case errors.Is(err, db.ErrImpersonationEnded):
+		writeError(w, http.StatusUnauthorized, "Impersonation session ended")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to record impersonation request")
+		return
+	}
+
+	// The admin sees what the user sees, without the user's role
+	asUser := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "role", "user")
+		ctx = context.WithValue(ctx, "impersonator_id", claims.ImpersonatorID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+	h.serveAsUser(w, r, asUser, claims.UserID)
+}
+
+// GetSupportAccess returns until when the user has let support view their
+// account, and every impersonation session opened on it
+func (h *Handler) GetSupportAccess(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	until, err := h.DB.GetSupportAccess(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve support access")
+		return
+	}
+	sessions, err := h.DB.GetImpersonationSessions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve impersonation sessions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, supportAccessResponse{supportAccess: supportAccess{AccessUntil: until}, Sessions: sessions})
+}
+
+// GrantSupportAccess lets support view the user's account for a number of
+// hours, replacing any earlier grant
+func (h *Handler) GrantSupportAccess(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req supportAccessRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	until, err := h.DB.SetSupportAccess(r.Context(), userID, time.Duration(req.Hours)*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to grant support access")
+		return
+	}
+	log.Printf("User %d granted support access until %v", userID, until)
+	writeJSON(w, http.StatusOK, supportAccess{AccessUntil: until})
+}
+
+// RevokeSupportAccess withdraws the user's grant of support access, ending
+// any impersonation sessions in progress
+func (h *Handler) RevokeSupportAccess(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if _, err := h.DB.SetSupportAccess(r.Context(), userID, 0); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke support access")
+		return
+	}
+	log.Printf("User %d revoked support access", userID)
+	writeJSON(w, http.StatusOK, supportAccess{})
+}
+
+// ImpersonateUser issues a read-only token for viewing a user's account as
+// they see it, if they have granted support access. A reason is required
+// and recorded with the session, which the user can see.
+func (h *Handler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+	if adminID == userID {
+		writeError(w, http.StatusBadRequest, "Cannot impersonate your own account")
+		return
+	}
+
+	var req impersonationRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "Reason required")
+		return
+	}
+	if req.Minutes == 0 {
+		req.Minutes = defaultImpersonationMinutes
+	}
+
+	session, err := h.DB.StartImpersonation(r.Context(), adminID, userID, req.Reason, time.Duration(req.Minutes)*time.Minute)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		writeCodedError(w, http.StatusNotFound, codeUserNotFound, "User not found")
+		return
+	case errors.Is(err, db.ErrNoSupportAccess):
+		writeError(w, http.StatusForbidden, "User has not granted support access")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	token, err := h.AuthService.ImpersonationToken(session)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	log.Printf("Admin %d started impersonation session %d for user %d until %v: %s", adminID, session.ID, userID, session.ExpiresAt, session.Reason)
+	h.Events.Publish(events.Event{Type: events.ImpersonationStarted, Data: *session})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":   token,
+		"session": session,
+	})
+}
+
+// GetImpersonations returns the impersonation sessions opened on a user's
+// account and the requests made in them, for audit
+func (h *Handler) GetImpersonations(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	sessions, err := h.DB.GetImpersonationSessions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve impersonation sessions")
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
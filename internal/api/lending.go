@@ -0,0 +1,288 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/lending"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// GetLendingPools returns each lending pool with what's lent to and
+// borrowed from it and the rates lenders earn and borrowers pay
+func (h *Handler) GetLendingPools(w http.ResponseWriter, r *http.Request) {
+	if h.Lending == nil {
+		writeError(w, http.StatusNotFound, "Lending is not enabled")
+		return
+	}
+
+	pools, err := h.lendingPools(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve lending pools")
+		return
+	}
+
+	response := make([]lendingPoolResponse, 0, len(pools))
+	for _, asset := range h.Lending.Terms.Assets() {
+		pool, rate := pools[asset], h.Lending.Terms.Rates[asset]
+		item := lendingPoolResponse{
+			Asset:      asset,
+			Available:  math.Max(pool.Supplied-pool.Borrowed, 0),
+			BorrowRate: rate,
+			Borrowed:   pool.Borrowed,
+			SupplyRate: lending.SupplyRate(pool, rate),
+			Supplied:   pool.Supplied,
+		}
+		if pool.Supplied > 0 {
+			item.Utilization = pool.Borrowed / pool.Supplied
+		}
+		response = append(response, item)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// lendingPools returns the pool of each asset that has had anything lent
+func (h *Handler) lendingPools(r *http.Request) (map[string]models.LendingPool, error) {
+	pools, err := h.DB.GetLendingPools(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	byAsset := make(map[string]models.LendingPool, len(pools))
+	for _, pool := range pools {
+		byAsset[pool.Asset] = pool
+	}
+	return byAsset, nil
+}
+
+// GetLendingAccount returns what the user has lent and owes with the
+// interest earned and charged, the value of their collateral and debt, and
+// how much more they may borrow
+func (h *Handler) GetLendingAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if h.Lending == nil {
+		writeError(w, http.StatusNotFound, "Lending is not enabled")
+		return
+	}
+
+	positions, err := h.DB.GetUserLendingPositions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve lending account")
+		return
+	}
+	balances, err := h.DB.GetBalances(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve lending account")
+		return
+	}
+	pools, err := h.lendingPools(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve lending account")
+		return
+	}
+
+	limit := h.borrowLimit()
+	collateral, debt := limit.Values(balances, positions)
+	capacity := math.Max(limit.Capacity(balances, positions), 0)
+	response := lendingAccountResponse{
+		Borrowable:        []models.Balance{},
+		BorrowingCapacity: capacity,
+		CollateralValue:   collateral,
+		DebtValue:         debt,
+		LTV:               limit.LTV,
+		Positions:         positions,
+		ValueAsset:        instruments.All[0].Quote,
+	}
+	// What may be borrowed of each asset is limited by the pool too
+	for _, asset := range h.Lending.Terms.Assets() {
+		price, ok := limit.Prices[asset]
+		if !ok {
+			continue
+		}
+		pool := pools[asset]
+		amount := math.Min(capacity/price, math.Max(pool.Supplied-pool.Borrowed, 0))
+		response.Borrowable = append(response.Borrowable, models.Balance{Asset: asset, Amount: math.Floor(amount*1e8) / 1e8})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// writeBorrowLimitError writes the response rejecting a borrow, or taking
+// funds out, that the user's borrowing capacity doesn't allow
+func writeBorrowLimitError(w http.ResponseWriter, status int, err *db.BorrowLimitError, message string) {
+	writeJSON(w, status, borrowLimitResponse{
+		Capacity: err.Capacity,
+		Code:     codeBorrowLimit,
+		Error:    message,
+		Value:    err.Value,
+	})
+}
+
+// borrowLimit returns the limit on what users may owe, valuing assets in
+// the quote asset at the index price if there's one and otherwise at the
+// last trade. With lending disabled nothing may be owed, so users still
+// owing can't take out what they hold.
+func (h *Handler) borrowLimit() db.BorrowLimit {
+	quote := instruments.All[0].Quote
+	prices := map[string]float64{quote: 1}
+	for _, inst := range instruments.All {
+		if inst.Quote != quote {
+			continue
+		}
+		if h.IndexPrices != nil {
+			if index, ok := h.IndexPrices.Latest(inst.Symbol); ok {
+				prices[inst.Base] = index.Price
+				continue
+			}
+		}
+		// The ticker follows the one instrument traded
+		if inst.Symbol == exchange.DefaultSymbol {
+			if last := h.Ticker.Stats(time.Now()).LastPrice; last > 0 {
+				prices[inst.Base] = last
+			}
+		}
+	}
+	if h.Lending == nil {
+		return db.BorrowLimit{Prices: prices}
+	}
+	return db.BorrowLimit{LTV: h.Lending.Terms.LTV, Prices: prices}
+}
+
+// GetLendingHistory returns the user's latest lending movements, newest
+// first
+func (h *Handler) GetLendingHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if h.Lending == nil {
+		writeError(w, http.StatusNotFound, "Lending is not enabled")
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	movements, err := h.DB.GetLendingMovements(r.Context(), userID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve lending history")
+		return
+	}
+	writeJSON(w, http.StatusOK, movements)
+}
+
+// Lend moves funds from the user's balance into an asset's lending pool,
+// where they earn interest from borrowers
+func (h *Handler) Lend(w http.ResponseWriter, r *http.Request) {
+	h.moveLending(w, r, db.LendingLend)
+}
+
+// RedeemLending withdraws what the user has lent, with the interest it
+// earned, back to their balance, as far as the pool has it unborrowed
+func (h *Handler) RedeemLending(w http.ResponseWriter, r *http.Request) {
+	h.moveLending(w, r, db.LendingRedeem)
+}
+
+// Borrow moves funds from an asset's lending pool to the user's balance,
+// up to their borrowing capacity. What's owed accrues interest hourly.
+func (h *Handler) Borrow(w http.ResponseWriter, r *http.Request) {
+	h.moveLending(w, r, db.LendingBorrow)
+}
+
+// Repay pays down what the user owes in an asset from their balance, or
+// all of it if the amount is more
+func (h *Handler) Repay(w http.ResponseWriter, r *http.Request) {
+	h.moveLending(w, r, db.LendingRepay)
+}
+
+func (h *Handler) moveLending(w http.ResponseWriter, r *http.Request, kind string) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if h.Lending == nil {
+		writeError(w, http.StatusNotFound, "Lending is not enabled")
+		return
+	}
+
+	var req lendingRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if _, ok := h.Lending.Terms.Rates[req.Asset]; !ok {
+		writeAPIError(w, http.StatusBadRequest, newFieldError(codeInvalidField, "asset", "Asset can't be lent"))
+		return
+	}
+
+	var position *models.LendingPosition
+	var err error
+	switch kind {
+	case db.LendingLend:
+		position, err = h.DB.Lend(r.Context(), userID, req.Asset, req.Amount)
+	case db.LendingRedeem:
+		position, err = h.DB.RedeemLending(r.Context(), userID, req.Asset, req.Amount, h.borrowLimit())
+	case db.LendingBorrow:
+		position, err = h.DB.Borrow(r.Context(), userID, req.Asset, req.Amount, h.borrowLimit())
+	case db.LendingRepay:
+		position, err = h.DB.Repay(r.Context(), userID, req.Asset, req.Amount)
+	}
+
+	var insufficient *db.InsufficientBalanceError
+	var liquidity *db.PoolLiquidityError
+	var limitErr *db.BorrowLimitError
+	switch {
+	case errors.As(err, &insufficient):
+		message := "Insufficient balance"
+		if kind == db.LendingRedeem {
+			message = "More than lent"
+		}
+		writeJSON(w, http.StatusBadRequest, insufficientBalanceResponse{
+			Asset:     insufficient.Asset,
+			Available: insufficient.Available,
+			Code:      codeInsufficientFunds,
+			Error:     message,
+		})
+		return
+	case errors.As(err, &liquidity):
+		writeJSON(w, http.StatusBadRequest, poolLiquidityResponse{
+			Asset:     liquidity.Asset,
+			Available: liquidity.Available,
+			Code:      codePoolLiquidity,
+			Error:     "Insufficient liquidity in the lending pool",
+		})
+		return
+	case errors.As(err, &limitErr):
+		message := "Borrow above borrowing capacity"
+		if kind == db.LendingRedeem {
+			message = "Owed above borrowing capacity"
+		}
+		writeBorrowLimitError(w, http.StatusBadRequest, limitErr, message)
+		return
+	case errors.Is(err, db.ErrNothingOwed):
+		writeCodedError(w, http.StatusBadRequest, codeNothingOwed, "Nothing owed")
+		return
+	case errors.Is(err, db.ErrNoPrice):
+		writeError(w, http.StatusServiceUnavailable, "No price to value the borrow at")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to "+kind)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, position)
+}
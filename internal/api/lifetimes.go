@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ExpireLifetimes cancels the orders the engine took off the book for
+// outliving their lifetime by its clock. Orders also expire as the engine
+// matches, so this only catches those nothing traded against. Returns the
+// IDs of the orders canceled.
+func (h *Handler) ExpireLifetimes(ctx context.Context) ([]int, error) {
+	// Orders taken off the books are recorded even if a market couldn't be
+	// reached
+	orderIDs, expireErr := h.Markets.ExpireLifetimes()
+	if err := h.recordMatches(ctx, nil, nil, orderIDs); err != nil {
+		return nil, err
+	}
+	return orderIDs, expireErr
+}
+
+// RunLifetimes cancels orders that outlived their lifetime every interval
+// until ctx is done
+func (h *Handler) RunLifetimes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.ExpireLifetimes(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to expire orders: %v", err)
+			}
+		}
+	}
+}
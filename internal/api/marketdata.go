@@ -0,0 +1,286 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// maxCandles bounds the default lookback when no start time is given
+const maxCandles = 1000
+
+// GetCandles returns OHLCV candles for an interval and time range
+func (h *Handler) GetCandles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "1m"
+	}
+	width, ok := marketdata.Intervals[interval]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Interval must be one of 1m, 5m, 1h, 1d")
+		return
+	}
+
+	end := time.Now().UTC()
+	if v := query.Get("end"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid end time")
+			return
+		}
+		end = t
+	}
+
+	start := end.Add(-maxCandles * width)
+	if v := query.Get("start"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid start time")
+			return
+		}
+		start = t
+	}
+
+	if !start.Before(end) {
+		writeError(w, http.StatusBadRequest, "Start must be before end")
+		return
+	}
+
+	candles, err := h.DB.GetCandles(r.Context(), interval, marketdata.BucketStart(start, width), end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve candles")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, candles)
+}
+
+// TickerView is the last price, best bid/ask and rolling 24h statistics of
+// an instrument
+type TickerView struct {
+	Symbol  string  `json:"symbol"`
+	BestBid float64 `json:"best_bid"`
+	BestAsk float64 `json:"best_ask"`
+	marketdata.TickerStats
+}
+
+// CurrentTicker returns the ticker as of now
+func (h *Handler) CurrentTicker(now time.Time) TickerView {
+	bid, ask := h.Exchange.BestPrices()
+	return TickerView{
+		Symbol:      exchange.DefaultSymbol,
+		BestBid:     bid,
+		BestAsk:     ask,
+		TickerStats: h.Ticker.Stats(now),
+	}
+}
+
+// GetTicker returns the last price, best bid/ask and rolling 24h statistics
+func (h *Handler) GetTicker(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.CurrentTicker(time.Now()))
+}
+
+// defaultStatsWindow is the lookback of market statistics when none is given
+const defaultStatsWindow = "24h"
+
+// marketStatsView is one market's trading over a window, from its hourly
+// rollups, and since its engine started
+type marketStatsView struct {
+	Symbol   string                   `json:"symbol"`
+	Trades   int                      `json:"trades"`
+	Volume   float64                  `json:"volume"`
+	Notional float64                  `json:"notional"`
+	Hourly   []models.MarketStatsHour `json:"hourly"`
+	Engine   exchange.MarketVolume    `json:"engine"` // Since the engine started
+}
+
+// marketStatsResponse is every market's statistics over the hours since Since
+type marketStatsResponse struct {
+	Window  string            `json:"window"`
+	Since   time.Time         `json:"since"`
+	Markets []marketStatsView `json:"markets"`
+}
+
+// GetMarketStats returns each market's trade count, volume and notional
+// value over a window of complete hours, hour by hour and in total,
+// alongside the totals matched since its engine started
+func (h *Handler) GetMarketStats(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultStatsWindow
+	}
+	lookback, err := parseWindow(window)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	since := marketdata.BucketStart(time.Now(), time.Hour).Add(-lookback)
+	hours, err := h.DB.GetMarketStats(r.Context(), since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve market stats")
+		return
+	}
+
+	markets := make([]marketStatsView, 0, len(instruments.All))
+	for _, inst := range instruments.All {
+		view := marketStatsView{Symbol: inst.Symbol, Hourly: []models.MarketStatsHour{}}
+		for _, hour := range hours {
+			if hour.Symbol != inst.Symbol {
+				continue
+			}
+			view.Trades += hour.Trades
+			view.Volume += hour.Volume
+			view.Notional += hour.Notional
+			view.Hourly = append(view.Hourly, hour)
+		}
+		if ex, ok := h.Markets.Exchange(inst.Symbol); ok {
+			view.Engine = ex.Volume()
+		}
+		markets = append(markets, view)
+	}
+
+	writeJSON(w, http.StatusOK, marketStatsResponse{Window: window, Since: since, Markets: markets})
+}
+
+// defaultReferenceWindow is the window of reference prices when none is given
+const defaultReferenceWindow = "1h"
+
+// referencePriceView is a benchmark price of an instrument
+type referencePriceView struct {
+	Symbol string `json:"symbol"`
+	marketdata.ReferencePrice
+}
+
+// GetVWAP returns the volume-weighted average price over a rolling window,
+// for measuring execution quality against
+func (h *Handler) GetVWAP(w http.ResponseWriter, r *http.Request) {
+	h.writeReferencePrice(w, r, h.Prices.VWAP)
+}
+
+// GetTWAP returns the time-weighted average of the last traded price over a
+// rolling window
+func (h *Handler) GetTWAP(w http.ResponseWriter, r *http.Request) {
+	h.writeReferencePrice(w, r, h.Prices.TWAP)
+}
+
+// GetIndexPrice returns an instrument's latest price on the external price
+// feed, which orders must be priced near when a price band is set
+func (h *Handler) GetIndexPrice(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		symbol = exchange.DefaultSymbol
+	}
+	if _, ok := instruments.Lookup(symbol); !ok {
+		writeCodedError(w, http.StatusBadRequest, codeUnknownSymbol, "Unknown symbol")
+		return
+	}
+	if h.IndexPrices == nil {
+		writeError(w, http.StatusNotFound, "No price feed configured")
+		return
+	}
+	price, ok := h.IndexPrices.Latest(symbol)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No index price yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, price)
+}
+
+// writeReferencePrice writes the reference price over the requested window
+func (h *Handler) writeReferencePrice(w http.ResponseWriter, r *http.Request, price func(string, time.Time) (marketdata.ReferencePrice, bool)) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultReferenceWindow
+	}
+	ref, ok := price(window, time.Now().UTC())
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Window must be one of 1m, 5m, 15m, 1h, 4h, 24h")
+		return
+	}
+	writeJSON(w, http.StatusOK, referencePriceView{Symbol: exchange.DefaultSymbol, ReferencePrice: ref})
+}
+
+// BBOView is the best bid and offer of an instrument, with the quantity the
+// book shows at each. An empty side is zero.
+type BBOView struct {
+	Symbol string         `json:"symbol"`
+	Bid    exchange.Level `json:"bid"`
+	Ask    exchange.Level `json:"ask"`
+	Seq    uint64         `json:"seq"` // Engine sequence number of the last change to the book
+}
+
+// CurrentBBO returns the best bid and offer
+func (h *Handler) CurrentBBO() BBOView {
+	bid, ask, seq := h.Exchange.SequencedTopOfBook()
+	return BBOView{Symbol: exchange.DefaultSymbol, Bid: bid, Ask: ask, Seq: seq}
+}
+
+// GetBBO returns the best bid and offer, without the rest of the book
+func (h *Handler) GetBBO(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.CurrentBBO())
+}
+
+// instrumentInfo describes an instrument in the ccxt market structure
+type instrumentInfo struct {
+	Symbol    string  `json:"symbol"`
+	Base      string  `json:"base"`
+	Quote     string  `json:"quote"`
+	Active    bool    `json:"active"`
+	Maker     float64 `json:"maker"`
+	Taker     float64 `json:"taker"`
+	Precision struct {
+		Price  int `json:"price"`
+		Amount int `json:"amount"`
+	} `json:"precision"`
+	Limits struct {
+		Amount minMax `json:"amount"`
+		Price  minMax `json:"price"`
+	} `json:"limits"`
+}
+
+// minMax is an inclusive range in the ccxt limits structure
+type minMax struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// GetExchangeInfo describes the listed instruments, their precisions and
+// limits, and the fee schedule, in a shape ccxt-style clients can load as
+// markets. Precisions are numbers of decimal places and fees are fractions
+// of notional.
+func (h *Handler) GetExchangeInfo(w http.ResponseWriter, r *http.Request) {
+	symbols := make([]instrumentInfo, 0, len(instruments.All))
+	for _, inst := range instruments.All {
+		info := instrumentInfo{
+			Symbol: inst.Symbol,
+			Base:   inst.Base,
+			Quote:  inst.Quote,
+			Active: true,
+			Maker:  h.Fees.Maker,
+			Taker:  h.Fees.Taker,
+		}
+		info.Precision.Price = inst.PricePrecision
+		info.Precision.Amount = inst.QuantityPrecision
+		info.Limits.Amount = minMax{Min: inst.MinQuantity, Max: inst.MaxQuantity}
+		info.Limits.Price = minMax{Min: inst.MinPrice, Max: inst.MaxPrice}
+		symbols = append(symbols, info)
+	}
+
+	writeJSON(w, http.StatusOK, exchangeInfoResponse{
+		Fees: feesInfo{Trading: tradingFees{
+			Maker:      h.Fees.Maker,
+			Percentage: true,
+			Taker:      h.Fees.Taker,
+			TierBased:  false,
+		}},
+		ServerTime: time.Now().UnixMilli(),
+		Symbols:    symbols,
+	})
+}
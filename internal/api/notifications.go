@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/mail"
+)
+
+// GetNotificationPreferences returns what the user is notified of
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	prefs, err := h.DB.GetNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve notification preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// UpdateNotificationPreferences changes what the user is notified of and the
+// address emailed notifications go to. Omitted fields keep their current
+// values.
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req notificationPreferencesRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	// A bare address only, so it can go straight into a To header
+	if req.Email != nil && *req.Email != "" {
+		if addr, err := mail.ParseAddress(*req.Email); err != nil || addr.Name != "" || addr.Address != *req.Email {
+			writeAPIError(w, http.StatusBadRequest, newFieldError(codeInvalidField, "email", "Email must be a plain address, e.g. alice@example.com"))
+			return
+		}
+	}
+
+	prefs, err := h.DB.GetNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve notification preferences")
+		return
+	}
+	if req.Email != nil {
+		prefs.Email = *req.Email
+	}
+	if req.Fills != nil {
+		prefs.Fills = *req.Fills
+	}
+	if req.Expiries != nil {
+		prefs.Expiries = *req.Expiries
+	}
+	if req.NewLogins != nil {
+		prefs.NewLogins = *req.NewLogins
+	}
+
+	if err := h.DB.SaveNotificationPreferences(r.Context(), userID, *prefs); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save notification preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
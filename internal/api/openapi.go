@@ -0,0 +1,508 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/xtrntr/exchange/internal/marketdata"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// APIVersion prefixes the versioned REST routes, e.g. /v1/orders. The
+// unprefixed routes are kept for existing clients.
+const APIVersion = "v1"
+
+// parameter documents a path or query parameter
+type parameter struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // "string", "integer" or "number"
+	Description string
+}
+
+// operation documents one endpoint of the versioned API
+type operation struct {
+	ID       string // operationId, which clients generate method names from
+	Method   string
+	Path     string // Relative to the version prefix
+	Summary  string
+	Tag      string
+	Auth     bool // Requires a JWT or a signed API key request
+	Params   []parameter
+	Request  interface{} // Zero value of the body type, or nil for no body
+	Status   int         // Success status
+	Response interface{} // Zero value of the success body type
+
+	// Errors has the bodies of errors with more than an error message, by
+	// status. Other errors are errorResponse.
+	Errors map[int][]interface{}
+}
+
+// Parameters shared by several operations
+var (
+	idParam              = parameter{Name: "id", In: "path", Type: "integer", Description: "Order ID"}
+	symbolParam          = parameter{Name: "symbol", In: "query", Type: "string", Description: "Instrument, e.g. BTC-USD"}
+	limitParam           = parameter{Name: "limit", In: "query", Type: "integer", Description: "Most results to return"}
+	transferStatusParam  = parameter{Name: "status", In: "query", Type: "string", Description: "\"pending\", \"completed\" or \"rejected\""}
+	formatParam          = parameter{Name: "format", In: "query", Type: "string", Description: "\"json\" (default) or \"csv\""}
+	referenceWindowParam = parameter{Name: "window", In: "query", Type: "string", Description: "1m, 5m, 15m, 1h (default), 4h or 24h"}
+	pageParams           = []parameter{
+		limitParam,
+		{Name: "offset", In: "query", Type: "integer", Description: "Results to skip"},
+		{Name: "after", In: "query", Type: "integer", Description: "ID of the last result of the previous page, to continue after it"},
+		{Name: "sort", In: "query", Type: "string", Description: "Field to sort by"},
+		{Name: "order", In: "query", Type: "string", Description: "\"asc\" or \"desc\""},
+		{Name: "since", In: "query", Type: "string", Description: "Unix seconds or RFC 3339 time"},
+		{Name: "until", In: "query", Type: "string", Description: "Unix seconds or RFC 3339 time"},
+		{Name: "tag", In: "query", Type: "string", Description: "Order tag"},
+		symbolParam,
+		{Name: "type", In: "query", Type: "string", Description: "\"buy\" or \"sell\""},
+	}
+)
+
+// operations documents the public and user endpoints. Admin endpoints,
+// which take the admin token or an admin's JWT, aren't part of the document.
+var operations = []operation{
+	// Public
+	{ID: "register", Method: "POST", Path: "/register", Summary: "Register a user", Tag: "Accounts",
+		Request: credentials{}, Status: http.StatusCreated, Response: userResponse{},
+		Errors: map[int][]interface{}{http.StatusConflict: {errorResponse{}}}},
+	{ID: "login", Method: "POST", Path: "/login", Summary: "Log in and get a JWT", Tag: "Accounts",
+		Request: credentials{}, Status: http.StatusOK, Response: tokenResponse{}},
+	{ID: "getCandles", Method: "GET", Path: "/candles", Summary: "Get OHLCV candles", Tag: "Market data",
+		Params: []parameter{
+			{Name: "interval", In: "query", Type: "string", Description: "1m (default), 5m, 1h or 1d"},
+			{Name: "start", In: "query", Type: "string", Description: "Unix seconds or RFC 3339 time"},
+			{Name: "end", In: "query", Type: "string", Description: "Unix seconds or RFC 3339 time"},
+		},
+		Status: http.StatusOK, Response: []models.Candle{}},
+	{ID: "getTicker", Method: "GET", Path: "/ticker", Summary: "Get the ticker", Tag: "Market data",
+		Status: http.StatusOK, Response: TickerView{}},
+	{ID: "getBBO", Method: "GET", Path: "/bbo", Summary: "Get the best bid and offer", Tag: "Market data",
+		Status: http.StatusOK, Response: BBOView{}},
+	{ID: "getVWAP", Method: "GET", Path: "/prices/vwap", Summary: "Get the volume-weighted average price", Tag: "Market data",
+		Params: []parameter{referenceWindowParam}, Status: http.StatusOK, Response: referencePriceView{}},
+	{ID: "getTWAP", Method: "GET", Path: "/prices/twap", Summary: "Get the time-weighted average price", Tag: "Market data",
+		Params: []parameter{referenceWindowParam}, Status: http.StatusOK, Response: referencePriceView{}},
+	{ID: "getIndexPrice", Method: "GET", Path: "/prices/index", Summary: "Get the index price from the external price feed", Tag: "Market data",
+		Params: []parameter{symbolParam}, Status: http.StatusOK, Response: models.IndexPrice{}},
+	{ID: "getExchangeInfo", Method: "GET", Path: "/exchangeInfo", Summary: "List instruments and fees", Tag: "Market data",
+		Status: http.StatusOK, Response: exchangeInfoResponse{}},
+	{ID: "getRecentTrades", Method: "GET", Path: "/trades/recent", Summary: "List recent trades", Tag: "Market data",
+		Params: []parameter{symbolParam, {Name: "before_id", In: "query", Type: "integer", Description: "Only trades with lower IDs, to page back"}, limitParam},
+		Status: http.StatusOK, Response: []models.PublicTrade{}},
+	{ID: "getStatus", Method: "GET", Path: "/status", Summary: "Get the server and market status", Tag: "Market data",
+		Status: http.StatusOK, Response: statusResponse{}},
+	{ID: "getSettlements", Method: "GET", Path: "/markets/{symbol}/settlements", Summary: "List daily settlement prices", Tag: "Market data",
+		Params: []parameter{{Name: "symbol", In: "path", Type: "string", Description: "Instrument, e.g. BTC-USD"}, limitParam},
+		Status: http.StatusOK, Response: []models.Settlement{},
+		Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "getMarketStats", Method: "GET", Path: "/stats/markets", Summary: "Get each market's trade count, volume and notional", Tag: "Market data",
+		Params: []parameter{{Name: "window", In: "query", Type: "string", Description: "Complete hours to cover, e.g. 24h (default) or 7d"}},
+		Status: http.StatusOK, Response: marketStatsResponse{}},
+
+	// Orders
+	{ID: "placeOrder", Method: "POST", Path: "/orders", Summary: "Place an order", Tag: "Orders", Auth: true,
+		Request: orderRequest{}, Status: http.StatusCreated, Response: orderStatusResponse{},
+		Errors: map[int][]interface{}{
+			http.StatusBadRequest: {confirmationRequiredResponse{}},
+			http.StatusConflict:   {errorResponse{}},
+			http.StatusForbidden:  {orderLimitResponse{}, notionalLimitResponse{}},
+		}},
+	{ID: "placeOrdersBatch", Method: "POST", Path: "/orders/batch", Summary: "Place up to 20 orders", Tag: "Orders", Auth: true,
+		Request: []orderRequest{}, Status: http.StatusOK, Response: batchResponse{}},
+	{ID: "confirmOrder", Method: "POST", Path: "/orders/confirm/{id}", Summary: "Confirm an order held for confirmation", Tag: "Orders", Auth: true,
+		Params: []parameter{{Name: "id", In: "path", Type: "string", Description: "Confirmation ID"}},
+		Status: http.StatusCreated, Response: orderStatusResponse{},
+		Errors: map[int][]interface{}{
+			http.StatusForbidden: {orderLimitResponse{}, notionalLimitResponse{}},
+			http.StatusNotFound:  {errorResponse{}},
+			http.StatusGone:      {errorResponse{}},
+		}},
+	{ID: "cancelOrdersBatch", Method: "DELETE", Path: "/orders/batch", Summary: "Cancel up to 20 orders by ID", Tag: "Orders", Auth: true,
+		Request: []int{}, Status: http.StatusOK, Response: batchResponse{}},
+	{ID: "cancelOrdersBulk", Method: "POST", Path: "/orders/cancel-bulk", Summary: "Cancel the open orders matching a filter", Tag: "Orders", Auth: true,
+		Request: cancelBulkRequest{}, Status: http.StatusOK, Response: ordersCanceledResponse{}},
+	{ID: "getOrders", Method: "GET", Path: "/orders", Summary: "List your orders", Tag: "Orders", Auth: true,
+		Params: append([]parameter{{Name: "status", In: "query", Type: "string", Description: "\"open\", \"filled\" or \"canceled\""}}, pageParams...),
+		Status: http.StatusOK, Response: []models.Order{}},
+	{ID: "cancelAllOrders", Method: "DELETE", Path: "/orders", Summary: "Cancel all your open orders", Tag: "Orders", Auth: true,
+		Params: []parameter{symbolParam, {Name: "side", In: "query", Type: "string", Description: "\"buy\" or \"sell\""}},
+		Status: http.StatusOK, Response: ordersCanceledResponse{}},
+	{ID: "cancelAllAfter", Method: "POST", Path: "/cancel-all-after", Summary: "Cancel all your open orders unless called again within a timeout", Tag: "Orders", Auth: true,
+		Request: cancelAllAfterRequest{}, Status: http.StatusOK, Response: cancelAllAfterResponse{}},
+	{ID: "getCancelAllAfter", Method: "GET", Path: "/cancel-all-after", Summary: "Get when your open orders will be canceled", Tag: "Orders", Auth: true,
+		Status: http.StatusOK, Response: cancelAllAfterResponse{}},
+	{ID: "getOrder", Method: "GET", Path: "/orders/{id}", Summary: "Get an order with its fills", Tag: "Orders", Auth: true,
+		Params: []parameter{idParam}, Status: http.StatusOK, Response: orderDetailResponse{},
+		Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "getOrderByClientID", Method: "GET", Path: "/orders/by-client-id/{cid}", Summary: "Get an order by its client order ID, with its fills", Tag: "Orders", Auth: true,
+		Params: []parameter{{Name: "cid", In: "path", Type: "string", Description: "Client order ID"}},
+		Status: http.StatusOK, Response: orderDetailResponse{},
+		Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "amendOrder", Method: "PUT", Path: "/orders/{id}", Summary: "Amend an open order", Tag: "Orders", Auth: true,
+		Params: []parameter{idParam}, Request: amendRequest{}, Status: http.StatusOK, Response: orderAmendedResponse{}},
+	{ID: "cancelOrder", Method: "DELETE", Path: "/orders/{id}", Summary: "Cancel an order", Tag: "Orders", Auth: true,
+		Params: []parameter{idParam}, Status: http.StatusOK, Response: orderStatusResponse{},
+		Errors: map[int][]interface{}{http.StatusConflict: {orderConflictResponse{}}}},
+	{ID: "getOrderBook", Method: "GET", Path: "/orderbook", Summary: "Get the order book", Tag: "Market data", Auth: true,
+		Status: http.StatusOK, Response: marketdata.OrderBook{}},
+
+	// Trading history
+	{ID: "getTrades", Method: "GET", Path: "/trades", Summary: "List your trades", Tag: "History", Auth: true,
+		Params: append([]parameter{{Name: "since_id", In: "query", Type: "integer", Description: "Trade ID to list the trades after, in execution order"}}, pageParams...),
+		Status: http.StatusOK, Response: []models.UserTrade{}},
+	{ID: "getFills", Method: "GET", Path: "/fills", Summary: "List your fills from a trade ID on", Tag: "History", Auth: true,
+		Params: []parameter{{Name: "from_id", In: "query", Type: "integer", Description: "First trade ID"}, limitParam},
+		Status: http.StatusOK, Response: []models.Fill{}},
+	{ID: "getVolume", Method: "GET", Path: "/account/volume", Summary: "Get your maker and taker volume", Tag: "History", Auth: true,
+		Params: []parameter{symbolParam, {Name: "window", In: "query", Type: "string", Description: "Lookback such as 24h or 30d (default)"}},
+		Status: http.StatusOK, Response: volumeResponse{}},
+	{ID: "getBalances", Method: "GET", Path: "/balances", Summary: "Get your balances", Tag: "History", Auth: true,
+		Status: http.StatusOK, Response: []models.Balance{}},
+	{ID: "getPortfolio", Method: "GET", Path: "/portfolio", Summary: "Get your positions and profit and loss", Tag: "History", Auth: true,
+		Status: http.StatusOK, Response: portfolioResponse{}},
+	{ID: "getRewards", Method: "GET", Path: "/account/rewards", Summary: "Get your rewards statement", Tag: "History", Auth: true,
+		Params: []parameter{limitParam}, Status: http.StatusOK, Response: rewardStatementResponse{},
+		Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "getStatement", Method: "GET", Path: "/account/statement", Summary: "Get your end-of-day statement", Tag: "History", Auth: true,
+		Params: []parameter{{Name: "day", In: "query", Type: "string", Description: "UTC date such as 2024-01-01 (default yesterday)"}},
+		Status: http.StatusOK, Response: statementResponse{}},
+	{ID: "listStatements", Method: "GET", Path: "/statements", Summary: "List your daily statements", Tag: "History", Auth: true,
+		Params: []parameter{limitParam, formatParam}, Status: http.StatusOK, Response: []models.Statement{}},
+	{ID: "getDailyStatement", Method: "GET", Path: "/statements/{day}", Summary: "Get your statement of a day", Tag: "History", Auth: true,
+		Params: []parameter{{Name: "day", In: "path", Type: "string", Description: "UTC date such as 2024-01-01"}, formatParam},
+		Status: http.StatusOK, Response: models.Statement{}},
+
+	// Funding
+	{ID: "deposit", Method: "POST", Path: "/deposits", Summary: "Deposit test funds", Tag: "Funding", Auth: true,
+		Request: transferRequest{}, Status: http.StatusCreated, Response: models.Transfer{}},
+	{ID: "getDeposits", Method: "GET", Path: "/deposits", Summary: "List your deposits", Tag: "Funding", Auth: true,
+		Params: []parameter{transferStatusParam, limitParam}, Status: http.StatusOK, Response: []models.Transfer{}},
+	{ID: "withdraw", Method: "POST", Path: "/withdrawals", Summary: "Withdraw funds", Tag: "Funding", Auth: true,
+		Request: transferRequest{}, Status: http.StatusCreated, Response: models.Transfer{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {insufficientBalanceResponse{}, borrowLimitResponse{}}}},
+	{ID: "getWithdrawals", Method: "GET", Path: "/withdrawals", Summary: "List your withdrawals", Tag: "Funding", Auth: true,
+		Params: []parameter{transferStatusParam, limitParam}, Status: http.StatusOK, Response: []models.Transfer{}},
+	{ID: "getLendingPools", Method: "GET", Path: "/lending/pools", Summary: "List the lending pools and their rates", Tag: "Funding", Auth: true,
+		Status: http.StatusOK, Response: []lendingPoolResponse{}, Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "getLendingAccount", Method: "GET", Path: "/lending/account", Summary: "Get what you've lent and borrowed and your borrowing capacity", Tag: "Funding", Auth: true,
+		Status: http.StatusOK, Response: lendingAccountResponse{}, Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "getLendingHistory", Method: "GET", Path: "/lending/history", Summary: "List your lending movements", Tag: "Funding", Auth: true,
+		Params: []parameter{limitParam}, Status: http.StatusOK, Response: []models.LendingMovement{},
+		Errors: map[int][]interface{}{http.StatusNotFound: {errorResponse{}}}},
+	{ID: "lend", Method: "POST", Path: "/lending/lend", Summary: "Lend to a pool", Tag: "Funding", Auth: true,
+		Request: lendingRequest{}, Status: http.StatusOK, Response: models.LendingPosition{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {insufficientBalanceResponse{}}, http.StatusNotFound: {errorResponse{}}}},
+	{ID: "redeemLending", Method: "POST", Path: "/lending/redeem", Summary: "Withdraw what you've lent", Tag: "Funding", Auth: true,
+		Request: lendingRequest{}, Status: http.StatusOK, Response: models.LendingPosition{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {insufficientBalanceResponse{}, poolLiquidityResponse{}, borrowLimitResponse{}}, http.StatusNotFound: {errorResponse{}}}},
+	{ID: "borrow", Method: "POST", Path: "/lending/borrow", Summary: "Borrow from a pool", Tag: "Funding", Auth: true,
+		Request: lendingRequest{}, Status: http.StatusOK, Response: models.LendingPosition{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {poolLiquidityResponse{}, borrowLimitResponse{}}, http.StatusNotFound: {errorResponse{}}}},
+	{ID: "repay", Method: "POST", Path: "/lending/repay", Summary: "Repay what you've borrowed", Tag: "Funding", Auth: true,
+		Request: lendingRequest{}, Status: http.StatusOK, Response: models.LendingPosition{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {insufficientBalanceResponse{}}, http.StatusNotFound: {errorResponse{}}}},
+
+	// Account
+	{ID: "createAPIKey", Method: "POST", Path: "/api-keys", Summary: "Create an API key", Tag: "Accounts", Auth: true,
+		Request: apiKeyRequest{}, Status: http.StatusCreated, Response: models.APIKey{}},
+	{ID: "listAPIKeys", Method: "GET", Path: "/api-keys", Summary: "List your API keys", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: []models.APIKey{}},
+	{ID: "updateAPIKey", Method: "PUT", Path: "/api-keys/{id}", Summary: "Change an API key's settings", Tag: "Accounts", Auth: true,
+		Params:  []parameter{{Name: "id", In: "path", Type: "integer", Description: "API key ID"}},
+		Request: apiKeySettingsRequest{}, Status: http.StatusOK, Response: models.APIKey{}},
+	{ID: "revokeAPIKey", Method: "DELETE", Path: "/api-keys/{id}", Summary: "Revoke an API key", Tag: "Accounts", Auth: true,
+		Params: []parameter{{Name: "id", In: "path", Type: "integer", Description: "API key ID"}},
+		Status: http.StatusOK, Response: messageResponse{}},
+	{ID: "listSessions", Method: "GET", Path: "/auth/sessions", Summary: "List your active login sessions", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: []models.Session{}},
+	{ID: "revokeSession", Method: "DELETE", Path: "/auth/sessions/{id}", Summary: "Revoke a login session", Tag: "Accounts", Auth: true,
+		Params: []parameter{{Name: "id", In: "path", Type: "integer", Description: "Session ID"}},
+		Status: http.StatusOK, Response: messageResponse{}},
+	{ID: "getSettings", Method: "GET", Path: "/account/settings", Summary: "Get your order defaults", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: models.Preferences{}},
+	{ID: "updateSettings", Method: "PUT", Path: "/account/settings", Summary: "Change your order defaults", Tag: "Accounts", Auth: true,
+		Request: preferencesRequest{}, Status: http.StatusOK, Response: models.Preferences{}},
+	{ID: "createWebhook", Method: "POST", Path: "/webhooks", Summary: "Register a webhook for your order fills and cancellations", Tag: "Accounts", Auth: true,
+		Request: webhookRequest{}, Status: http.StatusCreated, Response: models.Webhook{},
+		Errors: map[int][]interface{}{http.StatusConflict: {errorResponse{}}}},
+	{ID: "listWebhooks", Method: "GET", Path: "/webhooks", Summary: "List your webhooks", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: []models.Webhook{}},
+	{ID: "deleteWebhook", Method: "DELETE", Path: "/webhooks/{id}", Summary: "Delete a webhook", Tag: "Accounts", Auth: true,
+		Params: []parameter{{Name: "id", In: "path", Type: "integer", Description: "Webhook ID"}},
+		Status: http.StatusOK, Response: messageResponse{}},
+	{ID: "getWebhookDeliveries", Method: "GET", Path: "/webhooks/{id}/deliveries", Summary: "List a webhook's latest deliveries", Tag: "Accounts", Auth: true,
+		Params: []parameter{
+			{Name: "id", In: "path", Type: "integer", Description: "Webhook ID"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Deliveries to return (default 100, max 1000)"},
+		},
+		Status: http.StatusOK, Response: []models.WebhookDelivery{}},
+	{ID: "getNotificationPreferences", Method: "GET", Path: "/account/notifications", Summary: "Get what you're notified of", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: models.NotificationPreferences{}},
+	{ID: "updateNotificationPreferences", Method: "PUT", Path: "/account/notifications", Summary: "Change what you're notified of, and where", Tag: "Accounts", Auth: true,
+		Request: notificationPreferencesRequest{}, Status: http.StatusOK, Response: models.NotificationPreferences{}},
+	{ID: "getProfile", Method: "GET", Path: "/me", Summary: "Get your account", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: profileResponse{}},
+	{ID: "changePassword", Method: "PUT", Path: "/me/password", Summary: "Change your password, revoking your other sessions", Tag: "Accounts", Auth: true,
+		Request: passwordChangeRequest{}, Status: http.StatusOK, Response: messageResponse{},
+		Errors: map[int][]interface{}{http.StatusBadRequest: {errorResponse{}}, http.StatusForbidden: {errorResponse{}}}},
+	{ID: "changeUsername", Method: "PUT", Path: "/account/username", Summary: "Rename your account", Tag: "Accounts", Auth: true,
+		Request: usernameRequest{}, Status: http.StatusOK, Response: userResponse{},
+		Errors: map[int][]interface{}{http.StatusConflict: {errorResponse{}}}},
+	{ID: "getSupportAccess", Method: "GET", Path: "/account/support-access", Summary: "Get your support access grant and sessions", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: supportAccessResponse{}},
+	{ID: "grantSupportAccess", Method: "PUT", Path: "/account/support-access", Summary: "Let support view your account", Tag: "Accounts", Auth: true,
+		Request: supportAccessRequest{}, Status: http.StatusOK, Response: supportAccess{}},
+	{ID: "revokeSupportAccess", Method: "DELETE", Path: "/account/support-access", Summary: "Withdraw support access", Tag: "Accounts", Auth: true,
+		Status: http.StatusOK, Response: supportAccess{}},
+}
+
+// openAPIDocument encodes the OpenAPI document once, since it only depends
+// on the operations
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(newOpenAPIDocument(operations))
+})
+
+// GetOpenAPI serves the OpenAPI 3 document of the versioned API
+func (h *Handler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	document, err := openAPIDocument()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode OpenAPI document")
+		return
+	}
+	writeEncoded(w, http.StatusOK, document)
+}
+
+// object is a JSON object in the OpenAPI document
+type object = map[string]interface{}
+
+// newOpenAPIDocument describes operations as an OpenAPI 3.0 document, with
+// the schemas of their bodies generated from the Go types
+func newOpenAPIDocument(ops []operation) object {
+	schemas := newSchemaGenerator()
+	errorSchema := schemas.schema(reflect.TypeOf(errorResponse{}))
+	validationSchema := schemas.schema(reflect.TypeOf(validationResponse{}))
+
+	paths := object{}
+	for _, op := range ops {
+		item, ok := paths[op.Path].(object)
+		if !ok {
+			item = object{}
+			paths[op.Path] = item
+		}
+
+		responses := object{
+			strconv.Itoa(op.Status): response(op.Status, schemas.schema(reflect.TypeOf(op.Response))),
+			"default":               response(0, errorSchema),
+		}
+		for status, bodies := range op.Errors {
+			// Any error may be a plain one
+			alternatives := []object{errorSchema}
+			for _, body := range bodies {
+				if schema := schemas.schema(reflect.TypeOf(body)); schema["$ref"] != errorSchema["$ref"] {
+					alternatives = append(alternatives, schema)
+				}
+			}
+			schema := errorSchema
+			if len(alternatives) > 1 {
+				schema = object{"oneOf": alternatives}
+			}
+			responses[strconv.Itoa(status)] = response(status, schema)
+		}
+
+		o := object{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"responses":   responses,
+		}
+		if len(op.Params) > 0 {
+			var params []object
+			for _, p := range op.Params {
+				params = append(params, object{
+					"name":        p.Name,
+					"in":          p.In,
+					"description": p.Description,
+					"required":    p.In == "path",
+					"schema":      object{"type": p.Type},
+				})
+			}
+			o["parameters"] = params
+		}
+		if op.Request != nil {
+			o["requestBody"] = object{"required": true, "content": jsonContent(schemas.schema(reflect.TypeOf(op.Request)))}
+			// Bodies are checked against their fields' rules before use
+			if reflect.TypeOf(op.Request).Kind() == reflect.Struct {
+				responses[strconv.Itoa(http.StatusUnprocessableEntity)] = response(http.StatusUnprocessableEntity, validationSchema)
+			}
+		}
+		if op.Auth {
+			o["security"] = []object{{"bearerAuth": []string{}}, {"apiKey": []string{}}}
+		}
+		item[strings.ToLower(op.Method)] = o
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "Exchange API",
+			"version": APIVersion,
+			"description": "Authenticated endpoints take a JWT from /login as a bearer token, or an API key " +
+				"in X-API-KEY with the request signed in X-SIGNATURE; see the README.",
+		},
+		"servers": []object{{"url": "/" + APIVersion}},
+		"paths":   paths,
+		"components": object{
+			"schemas": schemas.components,
+			"securitySchemes": object{
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     object{"type": "apiKey", "in": "header", "name": "X-API-KEY"},
+			},
+		},
+	}
+}
+
+// response describes a response with a JSON body; status 0 is any error
+func response(status int, schema object) object {
+	description := http.StatusText(status)
+	if status == 0 {
+		description = "Error"
+	}
+	return object{"description": description, "content": jsonContent(schema)}
+}
+
+// jsonContent is the content of a JSON body with the given schema
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+// schemaGenerator builds schemas from Go types. Named structs become
+// components, referenced by name.
+type schemaGenerator struct {
+	components object
+	names      map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{components: object{}, names: make(map[reflect.Type]string)}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of values of type t, as encoding/json encodes them
+func (g *schemaGenerator) schema(t reflect.Type) object {
+	switch {
+	case t == timeType:
+		return object{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := g.schema(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			return object{"allOf": []object{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		return g.component(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.object(t)
+	}
+	return object{} // Any value
+}
+
+// component registers a named struct's schema, returning a reference to it.
+// Names are capitalized, and prefixed with the package if two types share one.
+func (g *schemaGenerator) component(t reflect.Type) object {
+	name, ok := g.names[t]
+	if !ok {
+		name = exportedName(t.Name())
+		for other := range g.names {
+			if g.names[other] == name {
+				name = exportedName(pkgName(t)) + name
+				break
+			}
+		}
+		g.names[t] = name
+		g.components[name] = g.object(t)
+	}
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// object returns the schema of a struct's JSON object, flattening embedded
+// structs. Fields without omitempty are required.
+func (g *schemaGenerator) object(t reflect.Type) object {
+	properties := object{}
+	var required []string
+	g.addFields(t, properties, &required)
+
+	schema := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the JSON fields of a struct to properties
+func (g *schemaGenerator) addFields(t reflect.Type, properties object, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// exportedName capitalizes a type name for use as a component name
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// pkgName returns the last element of a type's package path
+func pkgName(t reflect.Type) string {
+	path := t.PkgPath()
+	return path[strings.LastIndex(path, "/")+1:]
+}
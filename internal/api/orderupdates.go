@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// publishOrderUpdate pushes a change to an order to the user who placed it
+func (h *Handler) publishOrderUpdate(event string, order models.Order, filled float64) {
+	h.Events.Publish(events.Event{Type: events.OrderUpdated, Data: newOrderUpdate(event, order, filled)})
+}
+
+// newOrderUpdate describes a change to an order
+func newOrderUpdate(event string, order models.Order, filled float64) models.OrderUpdate {
+	return models.OrderUpdate{
+		Event:          event,
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Symbol:         order.Symbol,
+		Side:           order.Type,
+		Price:          order.Price,
+		Quantity:       order.Quantity,
+		FilledQuantity: filled,
+		Status:         order.Status,
+		Tag:            order.Tag,
+		ClientOrderID:  order.ClientOrderID,
+		Time:           time.Now(),
+	}
+}
+
+// publishOrderChanges pushes the orders that were just matched or canceled,
+// loading them as stored: filled and canceled orders as such, and orders
+// still open as partially filled. Canceled orders are sent with reason, if
+// any. Failures are logged since the changes themselves have been made.
+func (h *Handler) publishOrderChanges(ctx context.Context, orderIDs []int, reason string) {
+	if len(orderIDs) == 0 {
+		return
+	}
+	slices.Sort(orderIDs)
+	orderIDs = slices.Compact(orderIDs)
+
+	orders, err := h.Store.GetOrdersByIDs(ctx, orderIDs)
+	if err != nil {
+		log.Printf("Failed to load updated orders: %v", err)
+		return
+	}
+	filled, err := h.Store.GetFilledQuantities(ctx, orderIDs)
+	if err != nil {
+		log.Printf("Failed to load filled quantities: %v", err)
+		return
+	}
+	for _, order := range orders {
+		event := order.Status
+		if event == "open" {
+			event = "partially_filled"
+		}
+		update := newOrderUpdate(event, order, filled[order.ID])
+		if event == "canceled" {
+			update.Reason = reason
+		}
+		h.Events.Publish(events.Event{Type: events.OrderUpdated, Data: update})
+	}
+}
+
+// publishRejection pushes an order that was rejected before it was created
+func (h *Handler) publishRejection(userID int, req orderRequest, code, reason string) {
+	h.Events.Publish(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{
+		Event:         "rejected",
+		UserID:        userID,
+		Symbol:        req.Symbol,
+		Side:          req.Type,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		Tag:           req.Tag,
+		ClientOrderID: req.ClientOrderID,
+		Reason:        reason,
+		Code:          code,
+		Time:          time.Now(),
+	}})
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// parseTime accepts either unix seconds or an RFC 3339 timestamp
+func parseTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseTimeRange reads the optional "since" and "until" query parameters
+func parseTimeRange(query url.Values) (since, until time.Time, err error) {
+	if v := query.Get("since"); v != "" {
+		if since, err = parseTime(v); err != nil {
+			return since, until, newFieldError(codeInvalidField, "since", "Invalid since time")
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if until, err = parseTime(v); err != nil {
+			return since, until, newFieldError(codeInvalidField, "until", "Invalid until time")
+		}
+	}
+	return since, until, nil
+}
+
+// maxWindow is the longest lookback parseWindow accepts
+const maxWindow = 365 * 24 * time.Hour
+
+// parseWindow reads a lookback such as "24h" or "30d": a whole number of
+// hours or days, up to a year
+func parseWindow(value string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(value, "h"):
+		unit = time.Hour
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	default:
+		return 0, newFieldError(codeInvalidField, "window", "Window must be a number of hours or days, e.g. 24h or 30d")
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 || time.Duration(n)*unit > maxWindow {
+		return 0, newFieldError(codeInvalidField, "window", "Window must be a number of hours or days, e.g. 24h or 30d, up to 365d")
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseLimit reads the "limit" query parameter, returning 0 if it is unset
+func parseLimit(query url.Values) (int, error) {
+	v := query.Get("limit")
+	if v == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > db.MaxPageLimit {
+		return 0, newFieldError(codeInvalidField, "limit", fmt.Sprintf("Limit must be between 1 and %d", db.MaxPageLimit))
+	}
+	return limit, nil
+}
+
+// parsePage reads the "limit", "offset", "after", "sort" and "order" query
+// parameters.
+// isValidSort reports whether a sort key is accepted by the endpoint.
+func parsePage(query url.Values, isValidSort func(string) bool) (db.Page, error) {
+	var page db.Page
+	limit, err := parseLimit(query)
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, newFieldError(codeInvalidField, "offset", "Offset must be a non-negative integer")
+		}
+		page.Offset = offset
+	}
+	if v := query.Get("after"); v != "" {
+		after, err := strconv.Atoi(v)
+		if err != nil || after < 1 {
+			return page, newFieldError(codeInvalidField, "after", "After must be a positive integer")
+		}
+		page.After = after
+	}
+
+	page.Sort = query.Get("sort")
+	if !isValidSort(page.Sort) {
+		return page, newFieldError(codeInvalidField, "sort", "Unsupported sort field")
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, newFieldError(codeInvalidField, "order", "Order must be 'asc' or 'desc'")
+	}
+	return page, nil
+}
+
+// parseOrderFilter reads the order history filters from the query string
+func parseOrderFilter(query url.Values) (db.OrderFilter, error) {
+	filter := db.OrderFilter{
+		Tag:    query.Get("tag"),
+		Symbol: query.Get("symbol"),
+		Type:   query.Get("type"),
+		Status: query.Get("status"),
+	}
+	if filter.Type != "" && filter.Type != "buy" && filter.Type != "sell" {
+		return filter, newFieldError(codeInvalidSide, "type", "Type must be 'buy' or 'sell'")
+	}
+	switch filter.Status {
+	case "", "open", "filled", "canceled":
+	default:
+		return filter, newFieldError(codeInvalidField, "status", "Status must be 'open', 'filled' or 'canceled'")
+	}
+
+	var err error
+	filter.Since, filter.Until, err = parseTimeRange(query)
+	return filter, err
+}
+
+// parseTradeFilter reads the trade history filters from the query string
+func parseTradeFilter(query url.Values) (db.TradeFilter, error) {
+	filter := db.TradeFilter{
+		Tag:    query.Get("tag"),
+		Symbol: query.Get("symbol"),
+		Type:   query.Get("type"),
+	}
+	if filter.Type != "" && filter.Type != "buy" && filter.Type != "sell" {
+		return filter, newFieldError(codeInvalidSide, "type", "Type must be 'buy' or 'sell'")
+	}
+
+	if v := query.Get("since_id"); v != "" {
+		sinceID, err := strconv.Atoi(v)
+		if err != nil || sinceID < 0 {
+			return filter, newFieldError(codeInvalidField, "since_id", "since_id must be a non-negative integer")
+		}
+		filter.SinceID = sinceID
+	}
+
+	var err error
+	filter.Since, filter.Until, err = parseTimeRange(query)
+	return filter, err
+}
+
+// inExecutionOrder sorts a page of trades by trade ID, ascending, for
+// syncing with since_id: in any other order a trade recorded after a sync
+// could sort before the trades already seen and be missed
+func inExecutionOrder(page db.Page) (db.Page, error) {
+	if (page.Sort != "" && page.Sort != "id") || page.Desc {
+		return page, newFieldError(codeInvalidField, "since_id", "since_id lists trades in execution order and can't be combined with another sort or order")
+	}
+	page.Sort = "id"
+	return page, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expected    db.Page
+		expectError bool
+	}{
+		{
+			name:     "Defaults",
+			query:    "",
+			expected: db.Page{},
+		},
+		{
+			name:     "All Parameters",
+			query:    "limit=50&offset=100&after=7&sort=price&order=desc",
+			expected: db.Page{Limit: 50, Offset: 100, After: 7, Sort: "price", Desc: true},
+		},
+		{
+			name:        "Limit Too Large",
+			query:       "limit=5000",
+			expectError: true,
+		},
+		{
+			name:        "Negative Offset",
+			query:       "offset=-1",
+			expectError: true,
+		},
+		{
+			name:        "Zero After",
+			query:       "after=0",
+			expectError: true,
+		},
+		{
+			name:        "Unknown Sort",
+			query:       "sort=user_id",
+			expectError: true,
+		},
+		{
+			name:        "Invalid Order",
+			query:       "order=sideways",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			page, err := parsePage(query, db.IsValidOrderSort)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, page)
+		})
+	}
+}
+
+func TestParseOrderFilter(t *testing.T) {
+	query, _ := url.ParseQuery("status=open&type=sell&symbol=BTC-USD&since=1700000000&until=2024-01-01T00:00:00Z")
+	filter, err := parseOrderFilter(query)
+	assert.NoError(t, err)
+	assert.Equal(t, "open", filter.Status)
+	assert.Equal(t, "sell", filter.Type)
+	assert.Equal(t, "BTC-USD", filter.Symbol)
+	assert.Equal(t, int64(1700000000), filter.Since.Unix())
+	assert.Equal(t, int64(1704067200), filter.Until.Unix())
+
+	for bad, field := range map[string]string{"status=pending": "status", "type=hold": "type", "since=yesterday": "since"} {
+		query, _ := url.ParseQuery(bad)
+		_, err := parseOrderFilter(query)
+		assert.Error(t, err, bad)
+		assert.Equal(t, field, newErrorResponse(http.StatusBadRequest, err).Field, bad)
+	}
+}
+
+func TestParseTradeFilter(t *testing.T) {
+	query, _ := url.ParseQuery("type=buy&since_id=41")
+	filter, err := parseTradeFilter(query)
+	assert.NoError(t, err)
+	assert.Equal(t, "buy", filter.Type)
+	assert.Equal(t, 41, filter.SinceID)
+
+	for _, bad := range []string{"since_id=-1", "since_id=abc"} {
+		query, _ := url.ParseQuery(bad)
+		_, err := parseTradeFilter(query)
+		assert.Equal(t, "since_id", newErrorResponse(http.StatusBadRequest, err).Field, bad)
+	}
+
+	page, err := inExecutionOrder(db.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, db.Page{Limit: 10, Sort: "id"}, page)
+	_, err = inExecutionOrder(db.Page{Sort: "price"})
+	assert.Error(t, err)
+	_, err = inExecutionOrder(db.Page{Desc: true})
+	assert.Error(t, err)
+}
+
+func TestParseWindow(t *testing.T) {
+	window, err := parseWindow("24h")
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, window)
+	window, err = parseWindow("30d")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, window)
+
+	for _, bad := range []string{"", "30", "1w", "0d", "-1h", "1.5d", "366d"} {
+		_, err := parseWindow(bad)
+		assert.Error(t, err, bad)
+	}
+}
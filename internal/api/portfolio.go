@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/portfolio"
+)
+
+// GetPortfolio returns the user's balances, the exposure of their open
+// orders, and their position in each instrument they have traded with its
+// average entry price and profit and loss. Positions are marked at the last
+// trade price.
+func (h *Handler) GetPortfolio(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	balances, err := h.DB.GetBalances(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve portfolio")
+		return
+	}
+	exposure, err := h.DB.GetOrderExposure(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve portfolio")
+		return
+	}
+	fills, err := h.DB.GetAllUserFills(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve portfolio")
+		return
+	}
+
+	// The ticker follows the one instrument traded
+	marks := make(map[string]float64)
+	if last := h.Ticker.Stats(time.Now()).LastPrice; last > 0 {
+		marks[exchange.DefaultSymbol] = last
+	}
+
+	response := portfolioResponse{
+		Balances:  balances,
+		Exposure:  exposure,
+		PnLAsset:  instruments.All[0].Quote,
+		Positions: portfolio.Calculate(fills, marks),
+	}
+	for _, position := range response.Positions {
+		response.RealizedPnL += position.RealizedPnL
+		if position.UnrealizedPnL != nil {
+			response.UnrealizedPnL += *position.UnrealizedPnL
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+)
+
+// GetPreferences returns the user's order defaults
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// UpdatePreferences changes the user's order defaults. Omitted fields keep
+// their current values.
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req preferencesRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve preferences")
+		return
+	}
+	if req.DefaultTimeInForce != nil {
+		prefs.DefaultTimeInForce = *req.DefaultTimeInForce
+	}
+	if req.DefaultPostOnly != nil {
+		prefs.DefaultPostOnly = *req.DefaultPostOnly
+	}
+	if req.ConfirmNotionalAbove != nil {
+		prefs.ConfirmNotionalAbove = *req.ConfirmNotionalAbove
+	}
+
+	// Validate input
+	tif := prefs.DefaultTimeInForce
+	if tif != "GTC" && tif != "IOC" && tif != "FOK" {
+		writeError(w, http.StatusBadRequest, "Default time in force must be 'GTC', 'IOC' or 'FOK'")
+		return
+	}
+
+	if err := h.DB.SavePreferences(r.Context(), userID, *prefs); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/ratelimit"
+)
+
+// SetRateLimits replaces the order and read request budgets
+func (h *Handler) SetRateLimits(orders, reads config.RateLimit) {
+	h.OrderLimiter = ratelimit.New(orders.Rate, orders.Burst)
+	h.ReadLimiter = ratelimit.New(reads.Rate, reads.Burst)
+}
+
+// SetThrottles replaces the engine's per-account and per-IP order budgets
+func (h *Handler) SetThrottles(account, ip config.RateLimit) {
+	h.Throttle = exchange.NewThrottle(account.Rate, account.Burst, ip.Rate, ip.Burst)
+}
+
+// admitOrder charges an order or amendment to the engine throttle, by the
+// user and the IP the request came from, returning a
+// *exchange.ThrottledError if either's budget is spent
+func (h *Handler) admitOrder(ctx context.Context, userID int) error {
+	return h.Throttle.Admit(userID, db.ActorFrom(ctx).IP, time.Now())
+}
+
+// writeThrottled writes a 429 rejecting a throttled order, with a
+// Retry-After header
+func writeThrottled(w http.ResponseWriter, err *exchange.ThrottledError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	writeCodedError(w, http.StatusTooManyRequests, codeThrottled, err.Error())
+}
+
+// rateLimitKey identifies who a request is charged to: the user when
+// authenticated, otherwise the client IP
+func rateLimitKey(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(int); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the IP address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit rejects requests over budget with 429 and a Retry-After header.
+// GET requests draw from the read budget and everything else from the
+// order budget. Place it after authentication so users are keyed by ID.
+func (h *Handler) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := h.OrderLimiter
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limiter = h.ReadLimiter
+		}
+
+		if ok, retryAfter := limiter.Allow(rateLimitKey(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeCodedError(w, http.StatusTooManyRequests, codeRateLimited, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
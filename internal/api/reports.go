@@ -0,0 +1,57 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/reporting"
+)
+
+// GetTradeReports lists the latest daily trade reports, newest day first
+func (h *Handler) GetTradeReports(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	reports, err := h.DB.GetTradeReports(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve trade reports")
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// RegenerateTradeReport writes the trade report of a past UTC day again,
+// e.g. one missed while the server was down, replacing the earlier file
+func (h *Handler) RegenerateTradeReport(w http.ResponseWriter, r *http.Request) {
+	if h.Reporter == nil {
+		writeError(w, http.StatusServiceUnavailable, "Trade reporting not configured")
+		return
+	}
+
+	day, err := time.Parse(reporting.DayLayout, chi.URLParam(r, "day"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Day must be a date such as 2024-01-01")
+		return
+	}
+	if !day.AddDate(0, 0, 1).Before(time.Now()) {
+		writeError(w, http.StatusBadRequest, "Day isn't over yet")
+		return
+	}
+
+	report, err := h.Reporter.Generate(r.Context(), day)
+	if err != nil {
+		log.Printf("Failed to regenerate trade report for %s: %v", day.Format(reporting.DayLayout), err)
+		writeError(w, http.StatusInternalServerError, "Failed to generate trade report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
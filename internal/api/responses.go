@@ -0,0 +1,430 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/validate"
+)
+
+// Request and response bodies of the documented API. Each is described by
+// the OpenAPI document, so clients can be generated from it.
+
+// errorResponse is the body of every error. Errors clients need to tell
+// apart carry a stable code.
+type errorResponse struct {
+	Code  string `json:"code"`            // Why the request failed; see errors.go
+	Error string `json:"error"`           // Human-readable message
+	Field string `json:"field,omitempty"` // Request field at fault, if one is
+}
+
+// validationResponse rejects a request body whose fields break their rules,
+// listing every violation rather than only the first
+type validationResponse struct {
+	Code       string               `json:"code"` // "validation_failed"
+	Error      string               `json:"error"`
+	Violations []validate.Violation `json:"violations"`
+}
+
+// messageResponse acknowledges a request that returns nothing else
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// credentials are the body of registration and login
+type credentials struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// userResponse identifies a registered or renamed user
+type userResponse struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// profileResponse describes the authenticated user's account
+type profileResponse struct {
+	ID             int       `json:"id"`
+	Username       string    `json:"username"`
+	Role           string    `json:"role"`
+	KYCTier        int       `json:"kyc_tier"`
+	ServiceAccount bool      `json:"service_account"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// passwordChangeRequest is the body of a password change
+type passwordChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,max=100"`
+}
+
+// tokenResponse carries the JWT issued at login
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+// orderStatusResponse reports an order's status after it was placed or canceled
+type orderStatusResponse struct {
+	Message string `json:"message"`
+	OrderID int    `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+// orderDetailResponse is an order with its fills. Filled and canceled orders
+// have nothing remaining.
+type orderDetailResponse struct {
+	Order             models.Order  `json:"order"`
+	FilledQuantity    float64       `json:"filled_quantity"`
+	RemainingQuantity float64       `json:"remaining_quantity"`
+	AveragePrice      float64       `json:"average_price"` // Of the fills, or 0 if there are none
+	Fills             []models.Fill `json:"fills"`
+}
+
+func newOrderDetail(order models.Order, fills []models.Fill) orderDetailResponse {
+	detail := orderDetailResponse{Order: order, Fills: fills}
+	if detail.Fills == nil {
+		detail.Fills = []models.Fill{}
+	}
+	var notional float64
+	for i := range detail.Fills {
+		if inst, ok := instruments.Lookup(detail.Fills[i].Symbol); ok {
+			detail.Fills[i].FeeCurrency = inst.Quote
+		}
+		detail.FilledQuantity += detail.Fills[i].Quantity
+		notional += detail.Fills[i].Price * detail.Fills[i].Quantity
+	}
+	if detail.FilledQuantity > 0 {
+		detail.AveragePrice = notional / detail.FilledQuantity
+	}
+	if order.Status == "open" {
+		detail.RemainingQuantity = math.Max(order.Quantity-detail.FilledQuantity, 0)
+	}
+	return detail
+}
+
+// orderConflictResponse rejects a cancel of an order that already filled
+type orderConflictResponse struct {
+	Code    string `json:"code"` // "order_not_open"
+	Error   string `json:"error"`
+	OrderID int    `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+// orderLimitResponse rejects an order that breaks one of the user's order limits
+type orderLimitResponse struct {
+	Code  string  `json:"code"` // Which limit, e.g. "max_order_quantity"
+	Error string  `json:"error"`
+	Limit float64 `json:"limit"`
+	Value float64 `json:"value"` // The order's notional or quantity, or the open orders including it
+}
+
+// notionalLimitResponse rejects an order that would take the user past their
+// daily notional limit
+type notionalLimitResponse struct {
+	Code      string  `json:"code"` // "daily_notional_limit"
+	Error     string  `json:"error"`
+	Limit     float64 `json:"limit"`
+	Remaining float64 `json:"remaining"`
+	Reserved  float64 `json:"reserved"` // Held for the user's open orders
+	Used      float64 `json:"used"`
+}
+
+// confirmationRequiredResponse holds an order above the user's confirmation
+// threshold until it is confirmed
+type confirmationRequiredResponse struct {
+	Code                 string    `json:"code"` // "confirmation_required"
+	ConfirmNotionalAbove float64   `json:"confirm_notional_above"`
+	ConfirmationID       string    `json:"confirmation_id"`
+	Error                string    `json:"error"`
+	ExpiresAt            time.Time `json:"expires_at"`
+	Notional             float64   `json:"notional"`
+}
+
+// amendRequest is the body of an amendment. Omitted fields are left unchanged.
+type amendRequest struct {
+	Price    float64 `json:"price,omitempty" validate:"gt=0"`
+	Quantity float64 `json:"quantity,omitempty" validate:"gt=0"`
+}
+
+// orderAmendedResponse reports an order after an amendment
+type orderAmendedResponse struct {
+	Message  string  `json:"message"`
+	OrderID  int     `json:"order_id"`
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"` // The order's total, including what has filled
+	Status   string  `json:"status"`
+	Trades   int     `json:"trades"` // Trades the amendment caused
+
+	FilledQuantity    float64 `json:"filled_quantity"`    // Filled before the amendment
+	RemainingQuantity float64 `json:"remaining_quantity"` // Left to fill at the new total, before any trades the amendment caused
+}
+
+// cancelBulkRequest filters the open orders to cancel. At least one filter
+// is required.
+type cancelBulkRequest struct {
+	Tag      string  `json:"tag,omitempty"`
+	Symbol   string  `json:"symbol,omitempty"`
+	Side     string  `json:"side,omitempty" validate:"oneof=buy sell"`
+	MinPrice float64 `json:"min_price,omitempty" validate:"gt=0"`
+	MaxPrice float64 `json:"max_price,omitempty" validate:"gt=0"`
+}
+
+// ordersCanceledResponse lists the orders a bulk cancel canceled
+type ordersCanceledResponse struct {
+	Canceled int   `json:"canceled"`
+	OrderIDs []int `json:"order_ids"`
+}
+
+// cancelAllAfterResponse reports when a dead man's switch fires
+type cancelAllAfterResponse struct {
+	CurrentTime time.Time  `json:"current_time"`
+	TriggerTime *time.Time `json:"trigger_time"` // Nil when disarmed
+}
+
+// batchResponse has one result for each order of a batch, in submission order
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// volumeResponse is the user's volume by instrument over a window
+type volumeResponse struct {
+	Since   time.Time                `json:"since"`
+	Symbols []models.VolumeBreakdown `json:"symbols"`
+	Window  string                   `json:"window"`
+}
+
+// rewardStatementResponse describes the rewards program and lists the
+// rewards credited to the user
+type rewardStatementResponse struct {
+	Accruals    []models.RewardAccrual `json:"accruals"` // Newest first
+	Asset       string                 `json:"asset"`
+	PayoutAsset string                 `json:"payout_asset"`
+	Period      string                 `json:"period"` // e.g. "24h0m0s"
+	Rate        float64                `json:"rate"`   // Per year
+	Totals      []models.Balance       `json:"totals"` // All rewards credited, by payout asset
+}
+
+// statementResponse is the user's balances at the end of a day, valued at
+// that day's settlement prices
+type statementResponse struct {
+	Balances   []models.StatementBalance `json:"balances"`
+	Day        string                    `json:"day"`
+	Value      float64                   `json:"value"`       // Total of the valued balances
+	ValueAsset string                    `json:"value_asset"` // Asset values are in, e.g. "USD"
+}
+
+// statementsGeneratedResponse says how many statements of a day were
+// generated
+type statementsGeneratedResponse struct {
+	Day        string `json:"day"`
+	Statements int    `json:"statements"`
+}
+
+// portfolioResponse is the user's balances, the exposure of their open
+// orders and their positions, with the positions' total profit and loss
+type portfolioResponse struct {
+	Balances      []models.Balance       `json:"balances"`
+	Exposure      []models.OrderExposure `json:"exposure"`
+	PnLAsset      string                 `json:"pnl_asset"` // Asset profit and loss are in, e.g. "USD"
+	Positions     []models.Position      `json:"positions"`
+	RealizedPnL   float64                `json:"realized_pnl"`
+	UnrealizedPnL float64                `json:"unrealized_pnl"` // Of the positions with a mark price
+}
+
+// preferencesRequest changes the user's order defaults. Omitted fields keep
+// their current values.
+type preferencesRequest struct {
+	DefaultTimeInForce   *string  `json:"default_time_in_force,omitempty" validate:"oneof=GTC IOC FOK"`
+	DefaultPostOnly      *bool    `json:"default_post_only,omitempty"`
+	ConfirmNotionalAbove *float64 `json:"confirm_notional_above,omitempty" validate:"min=0"`
+}
+
+// notificationPreferencesRequest changes what the user is notified of.
+// Omitted fields keep their current values; an empty email stops email.
+type notificationPreferencesRequest struct {
+	Email     *string `json:"email,omitempty" validate:"max=254"`
+	Fills     *bool   `json:"fills,omitempty"`
+	Expiries  *bool   `json:"expiries,omitempty"`
+	NewLogins *bool   `json:"new_logins,omitempty"`
+}
+
+// webhookRequest registers a webhook
+type webhookRequest struct {
+	URL string `json:"url" validate:"required,max=2048"`
+}
+
+// resolveAlertRequest resolves a surveillance alert with what the admin
+// found
+type resolveAlertRequest struct {
+	Note string `json:"note" validate:"required,max=1000"`
+}
+
+// usernameRequest renames the user's account
+type usernameRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// supportAccessRequest grants support access for a number of hours
+type supportAccessRequest struct {
+	Hours int `json:"hours" validate:"required,min=1,max=72"`
+}
+
+// impersonationRequest opens an impersonation session, for up to an hour
+type impersonationRequest struct {
+	Reason  string `json:"reason" validate:"required"`
+	Minutes int    `json:"minutes,omitempty" validate:"min=1,max=60"` // Defaults to 30
+}
+
+// supportAccess is until when support may view the user's account, or null
+type supportAccess struct {
+	AccessUntil *time.Time `json:"access_until"`
+}
+
+// supportAccessResponse is the user's support access grant and every
+// impersonation session opened on their account
+type supportAccessResponse struct {
+	supportAccess
+	Sessions []models.ImpersonationSession `json:"sessions"`
+}
+
+// transferRequest deposits or withdraws an amount of an asset
+type transferRequest struct {
+	Amount float64 `json:"amount" validate:"required,gt=0,max=1e12,decimals=8"` // Test funds are capped per transfer
+	Asset  string  `json:"asset" validate:"required"`
+}
+
+// insufficientBalanceResponse rejects a withdrawal larger than the user's
+// available balance
+type insufficientBalanceResponse struct {
+	Asset     string  `json:"asset"`
+	Available float64 `json:"available"` // Balance less pending withdrawals
+	Code      string  `json:"code"`      // "insufficient_funds"
+	Error     string  `json:"error"`
+}
+
+// lendingRequest lends, withdraws, borrows or repays an amount of an asset
+type lendingRequest struct {
+	Amount float64 `json:"amount" validate:"required,gt=0,max=1e12,decimals=8"`
+	Asset  string  `json:"asset" validate:"required"`
+}
+
+// lendingPoolResponse is what's lent to and borrowed from an asset's pool,
+// and the rates on it
+type lendingPoolResponse struct {
+	Asset       string  `json:"asset"`
+	Available   float64 `json:"available"`   // Lent and not borrowed, so it can be borrowed or withdrawn
+	BorrowRate  float64 `json:"borrow_rate"` // Per year, charged on what's owed
+	Borrowed    float64 `json:"borrowed"`    // Including the interest charged
+	SupplyRate  float64 `json:"supply_rate"` // Per year, earned on what's lent at the current utilization
+	Supplied    float64 `json:"supplied"`    // Including the interest earned
+	Utilization float64 `json:"utilization"` // Fraction of what's lent that's borrowed
+}
+
+// lendingAccountResponse is what the user has lent and owes, with the
+// interest on it, and how much more they may borrow. Values are in
+// ValueAsset at the latest prices.
+type lendingAccountResponse struct {
+	Borrowable        []models.Balance         `json:"borrowable"`         // Most of each asset the user may borrow now
+	BorrowingCapacity float64                  `json:"borrowing_capacity"` // Value the user may still borrow
+	CollateralValue   float64                  `json:"collateral_value"`   // Of the user's balances and what they've lent
+	DebtValue         float64                  `json:"debt_value"`         // Of what the user owes
+	LTV               float64                  `json:"ltv"`                // Fraction of the collateral value the user may owe
+	Positions         []models.LendingPosition `json:"positions"`
+	ValueAsset        string                   `json:"value_asset"` // e.g. "USD"
+}
+
+// poolLiquidityResponse rejects borrowing or withdrawing more than a
+// lending pool has that isn't borrowed
+type poolLiquidityResponse struct {
+	Asset     string  `json:"asset"`
+	Available float64 `json:"available"` // Lent and not borrowed
+	Code      string  `json:"code"`      // "pool_liquidity"
+	Error     string  `json:"error"`
+}
+
+// borrowLimitResponse rejects a borrow above the user's borrowing capacity,
+// or taking out funds that would leave what they owe above it
+type borrowLimitResponse struct {
+	Capacity float64 `json:"capacity"` // Value the user may still borrow
+	Code     string  `json:"code"`     // "borrow_limit"
+	Error    string  `json:"error"`
+	Value    float64 `json:"value"` // Of the borrow or the funds taken out
+}
+
+// exchangeInfoResponse describes the listed instruments and fees
+type exchangeInfoResponse struct {
+	Fees       feesInfo         `json:"fees"`
+	ServerTime int64            `json:"server_time"` // Unix milliseconds
+	Symbols    []instrumentInfo `json:"symbols"`
+}
+
+// feesInfo is the fee schedule in the ccxt fees structure
+type feesInfo struct {
+	Trading tradingFees `json:"trading"`
+}
+
+// tradingFees are the maker and taker fees as fractions of notional
+type tradingFees struct {
+	Maker      float64 `json:"maker"`
+	Percentage bool    `json:"percentage"`
+	Taker      float64 `json:"taker"`
+	TierBased  bool    `json:"tier_based"`
+}
+
+// statusResponse is the public status of the server and market
+type statusResponse struct {
+	Market       exchange.MarketStatus `json:"market"`
+	Auction      *auctionStatus        `json:"auction,omitempty"` // Set while the market is in an auction
+	Matching     string                `json:"matching"`          // "running" or "paused"
+	PausedSince  *time.Time            `json:"paused_since,omitempty"`
+	QueuedOrders int                   `json:"queued_orders"` // Orders waiting for matching to resume
+	Status       string                `json:"status"`        // "ok" or "shutting_down"
+}
+
+// Bodies of admin requests, which the OpenAPI document leaves out
+
+// marketStateRequest moves the market to another state
+type marketStateRequest struct {
+	State    string `json:"state" validate:"required,oneof=open post_only halted auction"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"` // Auctions only, e.g. "5m"
+}
+
+// channelSettingsRequest changes a market data channel's settings. Omitted
+// fields keep their current values.
+type channelSettingsRequest struct {
+	SnapshotIntervalMs *int64 `json:"snapshot_interval_ms" validate:"min=0"`
+	MaxDepth           *int   `json:"max_depth" validate:"min=0"`
+	ConflationMs       *int64 `json:"conflation_ms" validate:"min=0"`
+}
+
+// circuitBreakerRequest changes the circuit breaker's settings. Omitted
+// fields keep their current values.
+type circuitBreakerRequest struct {
+	Move       *float64 `json:"move" validate:"min=0,max=1"` // Fraction of the price; zero disables the breaker
+	WindowMs   *int64   `json:"window_ms" validate:"min=0"`
+	Action     *string  `json:"action" validate:"oneof=halted auction"`
+	DurationMs *int64   `json:"duration_ms" validate:"min=0"`
+}
+
+// roleRequest changes a user's role
+type roleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// mergeRequest folds the source account into the target
+type mergeRequest struct {
+	SourceUserID int `json:"source_user_id" validate:"required,gt=0"`
+	TargetUserID int `json:"target_user_id" validate:"required,gt=0"`
+}
+
+// batchReplayRequest resends accounting batches from one through another,
+// or through the latest if to_batch_id is omitted
+type batchReplayRequest struct {
+	FromBatchID int `json:"from_batch_id" validate:"required,gt=0"`
+	ToBatchID   int `json:"to_batch_id,omitempty" validate:"min=0"`
+}
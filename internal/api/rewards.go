@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// GetRewardStatement returns the rewards program and the user's latest
+// reward accruals, with their totals
+func (h *Handler) GetRewardStatement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if h.Rewards == nil {
+		writeError(w, http.StatusNotFound, "Rewards are not enabled")
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	accruals, err := h.DB.GetRewardAccruals(r.Context(), userID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve rewards")
+		return
+	}
+	totals, err := h.DB.GetRewardTotals(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve rewards")
+		return
+	}
+
+	program := h.Rewards.Program
+	writeJSON(w, http.StatusOK, rewardStatementResponse{
+		Accruals:    accruals,
+		Asset:       program.Asset,
+		PayoutAsset: program.PayoutAsset,
+		Period:      program.Period.String(),
+		Rate:        program.Rate,
+		Totals:      totals,
+	})
+}
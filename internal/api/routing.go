@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/xtrntr/exchange/internal/routing"
+)
+
+// RouteToLeader sends order entry to the region hosting the matching leader
+// when it isn't this one. Routed responses name the leader, so clients can
+// send order entry there directly.
+func (h *Handler) RouteToLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Router == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leader, local, err := h.Router.Route(r)
+		switch {
+		case errors.Is(err, routing.ErrForwardLoop):
+			log.Printf("Refusing %s %s forwarded from %s: leader is %s", r.Method, r.URL.Path,
+				r.Header.Get(routing.ForwardedByHeader), leader.Name)
+			writeCodedError(w, http.StatusServiceUnavailable, codeLeaderUnavailable, "Matching leader unavailable")
+		case err != nil:
+			log.Printf("Failed to look up matching leader: %v", err)
+			writeCodedError(w, http.StatusServiceUnavailable, codeLeaderUnavailable, "Matching leader unavailable")
+		case local:
+			routing.Hint(w, leader)
+			next.ServeHTTP(w, r)
+		default:
+			h.Router.Send(w, r, leader)
+		}
+	})
+}
+
+// GetRouting reports this gateway's region, the matching leader and the
+// round trip of order entry forwarded to it
+func (h *Handler) GetRouting(w http.ResponseWriter, r *http.Request) {
+	if h.Router == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+
+	leader, err := h.Router.Leader.Leader(r.Context())
+	if err != nil {
+		writeCodedError(w, http.StatusServiceUnavailable, codeLeaderUnavailable, "Matching leader unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":   true,
+		"region":    h.Router.Local,
+		"leader":    leader,
+		"mode":      h.Router.Mode,
+		"forwarded": h.Router.Stats(),
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// CreateServiceAccount creates a password-less account for a bot or
+// internal service. It can only use the API with keys issued by admins.
+func (h *Handler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req usernameRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.AuthService.CreateServiceAccount(r.Context(), req.Username)
+	switch {
+	case errors.Is(err, db.ErrUsernameTaken):
+		writeCodedError(w, http.StatusConflict, codeUsernameTaken, "Username already taken")
+		return
+	case errors.Is(err, auth.ErrUsernameReserved):
+		writeCodedError(w, http.StatusConflict, codeUsernameReserved, "Username is reserved")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to create service account")
+		return
+	}
+	log.Printf("Admin %v created service account %d (%s)", r.Context().Value("user_id"), user.ID, user.Username)
+
+	writeJSON(w, http.StatusCreated, newUserInfo(user))
+}
+
+// ListServiceAccounts returns all service accounts
+func (h *Handler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.ListServiceAccounts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve service accounts")
+		return
+	}
+
+	infos := make([]userInfo, len(users))
+	for i := range users {
+		infos[i] = newUserInfo(&users[i])
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// serviceAccountID returns the ID of the service account named by the id URL
+// parameter, writing an error if there is no such service account
+func (h *Handler) serviceAccountID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound) || err == nil && !user.ServiceAccount:
+		writeError(w, http.StatusNotFound, "Service account not found")
+		return 0, false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to load service account")
+		return 0, false
+	}
+	return userID, true
+}
+
+// CreateServiceAccountKey issues an API key for a service account; the
+// secret is only returned here
+func (h *Handler) CreateServiceAccountKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+	h.issueAPIKey(w, r, userID)
+}
+
+// ListServiceAccountKeys lists a service account's active API keys
+func (h *Handler) ListServiceAccountKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.DB.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve API keys")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeServiceAccountKey revokes one of a service account's API keys
+func (h *Handler) RevokeServiceAccountKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+	h.revokeAPIKey(w, r, "keyID", userID)
+}
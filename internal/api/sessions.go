@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// ListSessions lists the user's active login sessions, marking the one the
+// request's token belongs to
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessions, err := h.DB.GetUserSessions(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve sessions")
+		return
+	}
+
+	current, _ := r.Context().Value("session_id").(int)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the user's sessions, so its token is refused
+// from then on. Revoking the current session logs the request's token out.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	err = h.DB.RevokeSession(r.Context(), id, userID)
+	if errors.Is(err, db.ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messageResponse{Message: "Session revoked"})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/settlement"
+	"github.com/xtrntr/exchange/internal/statements"
+)
+
+// GetSettlements lists an instrument's daily settlement prices, newest day first
+func (h *Handler) GetSettlements(w http.ResponseWriter, r *http.Request) {
+	symbol := chi.URLParam(r, "symbol")
+	if _, ok := instruments.Lookup(symbol); !ok {
+		writeError(w, http.StatusNotFound, "Unknown symbol")
+		return
+	}
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	settlements, err := h.DB.GetSettlements(r.Context(), symbol, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve settlements")
+		return
+	}
+	writeJSON(w, http.StatusOK, settlements)
+}
+
+// parseSettledDay parses a UTC day that is over, defaulting to yesterday
+func parseSettledDay(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		now = now.UTC().AddDate(0, 0, -1)
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	day, err := time.Parse(settlement.DayLayout, value)
+	if err != nil {
+		return time.Time{}, errors.New("Day must be a date such as 2024-01-01")
+	}
+	if !day.AddDate(0, 0, 1).Before(now) {
+		return time.Time{}, errors.New("Day isn't over yet")
+	}
+	return day, nil
+}
+
+// GetStatement returns the user's balances at the end of a UTC day, valued
+// in the quote currency at that day's settlement prices
+func (h *Handler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	day, err := parseSettledDay(r.URL.Query().Get("day"), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	balances, err := h.DB.GetBalancesAt(r.Context(), userID, day.AddDate(0, 0, 1))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve balances")
+		return
+	}
+
+	// Assets without a settlement that day aren't valued
+	prices, quote, err := statements.Prices(r.Context(), h.DB, day.Format(settlement.DayLayout))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve settlements")
+		return
+	}
+
+	response := statementResponse{Day: day.Format(settlement.DayLayout), ValueAsset: quote}
+	response.Balances, response.Value = statements.Value(balances, prices)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Settle calculates the settlement prices of a past UTC day again, e.g. one
+// missed while the server was down, replacing the earlier prices
+func (h *Handler) Settle(w http.ResponseWriter, r *http.Request) {
+	if h.Settler == nil {
+		writeError(w, http.StatusServiceUnavailable, "Settlement not configured")
+		return
+	}
+
+	day, err := parseSettledDay(chi.URLParam(r, "day"), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	settlements, err := h.Settler.Settle(r.Context(), day)
+	if err != nil {
+		log.Printf("Failed to settle %s: %v", day.Format(settlement.DayLayout), err)
+		writeError(w, http.StatusInternalServerError, "Failed to settle")
+		return
+	}
+	writeJSON(w, http.StatusOK, settlements)
+}
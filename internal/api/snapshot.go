@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SaveBookSnapshot stores a snapshot of the order book with the journal
+// sequence number and highest order ID it reflects. Orders aren't created
+// while it is taken, so each order is either in the snapshot or created
+// after it; changes to orders in it are journaled after its sequence number.
+func (h *Handler) SaveBookSnapshot(ctx context.Context) error {
+	if h.Journal == nil {
+		return errors.New("snapshots require the journal")
+	}
+
+	h.snapshotMu.Lock()
+	seq := h.Journal.Seq()
+	lastOrderID, err := h.DB.GetLastOrderID(ctx)
+	book := h.Exchange.Snapshot()
+	h.snapshotMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	state, err := json.Marshal(book)
+	if err != nil {
+		return fmt.Errorf("failed to marshal book snapshot: %w", err)
+	}
+	return h.DB.SaveBookSnapshot(ctx, seq, lastOrderID, state)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/settlement"
+	"github.com/xtrntr/exchange/internal/statements"
+)
+
+// writeStatements writes statements in the format a request asks for: JSON
+// by default, or CSV with format=csv, offered as a download named filename
+func writeStatements(w http.ResponseWriter, r *http.Request, filename string, data interface{}, list []models.Statement) {
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, data)
+	case "csv":
+		var buf bytes.Buffer
+		if err := statements.WriteCSV(&buf, list...); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to render statements")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	default:
+		writeError(w, http.StatusBadRequest, "Format must be json or csv")
+	}
+}
+
+// ListStatements lists the user's daily statements, newest day first
+func (h *Handler) ListStatements(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	list, err := h.DB.GetStatements(r.Context(), userID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve statements")
+		return
+	}
+	writeStatements(w, r, "statements.csv", list, list)
+}
+
+// GetDailyStatement returns the user's statement of one day
+func (h *Handler) GetDailyStatement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	day, err := time.Parse(settlement.DayLayout, chi.URLParam(r, "day"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Day must be a date such as 2024-01-01")
+		return
+	}
+
+	statement, err := h.DB.GetStatement(r.Context(), userID, day.Format(settlement.DayLayout))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+	if statement == nil {
+		writeError(w, http.StatusNotFound, "Statement not found")
+		return
+	}
+	writeStatements(w, r, "statement-"+statement.Day+".csv", statement, []models.Statement{*statement})
+}
+
+// GenerateStatements generates every user's statement of a past UTC day
+// again, e.g. a day missed while the server was down, replacing the earlier
+// statements
+func (h *Handler) GenerateStatements(w http.ResponseWriter, r *http.Request) {
+	if h.Statements == nil {
+		writeError(w, http.StatusServiceUnavailable, "Statements not configured")
+		return
+	}
+
+	day, err := parseSettledDay(chi.URLParam(r, "day"), time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	n, err := h.Statements.Generate(r.Context(), day)
+	if err != nil {
+		log.Printf("Failed to generate statements for %s: %v", day.Format(settlement.DayLayout), err)
+		writeError(w, http.StatusInternalServerError, "Failed to generate statements")
+		return
+	}
+	writeJSON(w, http.StatusOK, statementsGeneratedResponse{Day: day.Format(settlement.DayLayout), Statements: n})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// StreamCredentials authenticate a WebSocket connection for private
+// channels: a JWT, or an API key with its secret's signature of
+// "timestamp=<ms>", followed by "&recvWindow=<ms>" if one is given.
+// CancelOnDisconnect opts the connection into canceling the user's open
+// orders when it drops, as keys with the setting do without asking.
+type StreamCredentials struct {
+	Token      string `json:"token,omitempty"`
+	APIKey     string `json:"api_key,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	RecvWindow string `json:"recvWindow,omitempty"`
+
+	CancelOnDisconnect bool `json:"cancel_on_disconnect,omitempty"`
+}
+
+// StreamSession is who a connection is authenticated as
+type StreamSession struct {
+	UserID             int
+	CancelOnDisconnect bool // Cancel the user's open orders when the connection drops
+}
+
+// Empty reports whether no credentials were given
+func (c StreamCredentials) Empty() bool {
+	return c.Token == "" && c.APIKey == ""
+}
+
+// AuthenticateStream returns the session a WebSocket connection is
+// authenticated as. Errors are worded for the client.
+func (h *Handler) AuthenticateStream(ctx context.Context, creds StreamCredentials) (StreamSession, error) {
+	return h.authenticate(ctx, creds, auth.ScopeRead)
+}
+
+// authenticate returns the session of the user credentials sent outside of
+// an HTTP request belong to, requiring API keys to have scope.
+// Impersonation tokens are refused: their requests are audited one by one,
+// which a stream can't be.
+func (h *Handler) authenticate(ctx context.Context, creds StreamCredentials, scope string) (StreamSession, error) {
+	session := StreamSession{CancelOnDisconnect: creds.CancelOnDisconnect}
+	var userID int
+	switch {
+	case creds.Token != "":
+		claims, err := h.AuthService.ParseToken(creds.Token)
+		if err != nil {
+			return StreamSession{}, errors.New("Invalid or expired token")
+		}
+		if claims.ImpersonatorID != 0 {
+			return StreamSession{}, errors.New("Impersonation tokens can't open private streams")
+		}
+		err = h.AuthService.CheckSession(ctx, claims)
+		if errors.Is(err, auth.ErrSessionEnded) {
+			return StreamSession{}, errors.New("Session ended")
+		}
+		if err != nil {
+			return StreamSession{}, errors.New("Failed to check session")
+		}
+		userID = claims.UserID
+	case creds.APIKey != "":
+		payload := "timestamp=" + creds.Timestamp
+		if creds.RecvWindow != "" {
+			payload += "&recvWindow=" + creds.RecvWindow
+		}
+		apiKey, err := h.AuthService.VerifyRequest(ctx, creds.APIKey, creds.Signature, payload, creds.Timestamp, creds.RecvWindow)
+		if err != nil {
+			return StreamSession{}, fmt.Errorf("Invalid API key request: %v", err)
+		}
+		if !slices.Contains(apiKey.Scopes, scope) {
+			return StreamSession{}, fmt.Errorf("API key lacks the %s scope", scope)
+		}
+		userID = apiKey.UserID
+		session.CancelOnDisconnect = session.CancelOnDisconnect || apiKey.CancelOnDisconnect
+	default:
+		return StreamSession{}, errors.New("Token or API key required")
+	}
+
+	_, err := h.AuthService.ActiveUser(ctx, userID)
+	switch {
+	case errors.Is(err, auth.ErrAccountSuspended):
+		return StreamSession{}, errors.New("Account suspended")
+	case errors.Is(err, db.ErrAccountMerged):
+		return StreamSession{}, errors.New("Account merged")
+	case errors.Is(err, db.ErrUserNotFound):
+		return StreamSession{}, errors.New("Invalid or expired token")
+	case err != nil:
+		return StreamSession{}, errors.New("Failed to load user")
+	}
+	session.UserID = userID
+	return session, nil
+}
+
+// CancelOrdersOnDisconnect cancels all of a user's open orders because a
+// connection with cancel-on-disconnect dropped, returning how many it
+// canceled. Nothing is canceled while the server is shutting down: clients
+// are disconnected then, but nothing matches until it's back.
+func (h *Handler) CancelOrdersOnDisconnect(ctx context.Context, userID int) (int, error) {
+	if h.draining.Load() {
+		return 0, nil
+	}
+	return h.cancelAllOrdersFor(ctx, userID, "disconnected")
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/surveillance"
+)
+
+// ListSurveillanceAlerts returns the latest surveillance alerts, newest
+// first, optionally only those with a status or kind or on one user
+func (h *Handler) ListSurveillanceAlerts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.AlertFilter{Status: query.Get("status"), Kind: query.Get("kind")}
+	switch filter.Status {
+	case "", "open", "resolved":
+	default:
+		writeError(w, http.StatusBadRequest, "Status must be 'open' or 'resolved'")
+		return
+	}
+	switch filter.Kind {
+	case "", surveillance.KindSelfTrade, surveillance.KindOrderChurn, surveillance.KindPriceRamp:
+	default:
+		writeError(w, http.StatusBadRequest, "Kind must be 'self_trade', 'order_churn' or 'price_ramp'")
+		return
+	}
+	if v := query.Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil || userID <= 0 {
+			writeError(w, http.StatusBadRequest, "user_id must be a positive integer")
+			return
+		}
+		filter.UserID = userID
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	alerts, err := h.DB.ListSurveillanceAlerts(r.Context(), filter, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve surveillance alerts")
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+// ResolveSurveillanceAlert closes an open alert once an admin has looked
+// into it, with a note of what they found
+func (h *Handler) ResolveSurveillanceAlert(w http.ResponseWriter, r *http.Request) {
+	alertID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid alert ID")
+		return
+	}
+	var req resolveAlertRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	alert, err := h.DB.ResolveSurveillanceAlert(r.Context(), alertID, adminID, req.Note)
+	switch {
+	case errors.Is(err, db.ErrAlertNotFound):
+		writeError(w, http.StatusNotFound, "Alert not found")
+		return
+	case errors.Is(err, db.ErrAlertResolved):
+		writeError(w, http.StatusConflict, "Alert already resolved")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to resolve alert")
+		return
+	}
+
+	log.Printf("Admin %d resolved %s alert %d on user %d", adminID, alert.Kind, alert.ID, alert.UserID)
+	writeJSON(w, http.StatusOK, alert)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/instruments"
+)
+
+// Deposit credits test funds to the user's account, at once if transfers
+// are instant and otherwise once an admin approves it
+func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
+	h.requestTransfer(w, r, db.TransferDeposit)
+}
+
+// Withdraw debits funds from the user's account, at once if transfers are
+// instant and otherwise once an admin approves it. A pending withdrawal
+// holds its amount until it is reviewed. Users who owe lending pools can't
+// withdraw what's backing it.
+func (h *Handler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	h.requestTransfer(w, r, db.TransferWithdrawal)
+}
+
+func (h *Handler) requestTransfer(w http.ResponseWriter, r *http.Request, transferType string) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req transferRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !instruments.IsAsset(req.Asset) {
+		writeError(w, http.StatusBadRequest, "Unknown asset")
+		return
+	}
+
+	transfer, err := h.DB.CreateTransfer(r.Context(), userID, transferType, req.Asset, req.Amount, h.InstantTransfers, h.borrowLimit())
+	var insufficient *db.InsufficientBalanceError
+	var limitErr *db.BorrowLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		writeBorrowLimitError(w, http.StatusBadRequest, limitErr, "Owed above borrowing capacity")
+		return
+	case errors.As(err, &insufficient):
+		writeJSON(w, http.StatusBadRequest, insufficientBalanceResponse{
+			Asset:     insufficient.Asset,
+			Available: insufficient.Available,
+			Code:      codeInsufficientFunds,
+			Error:     "Insufficient balance",
+		})
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to create "+transferType)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, transfer)
+}
+
+// GetDeposits returns the user's latest deposits, newest first
+func (h *Handler) GetDeposits(w http.ResponseWriter, r *http.Request) {
+	h.getUserTransfers(w, r, db.TransferDeposit)
+}
+
+// GetWithdrawals returns the user's latest withdrawals, newest first
+func (h *Handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	h.getUserTransfers(w, r, db.TransferWithdrawal)
+}
+
+func (h *Handler) getUserTransfers(w http.ResponseWriter, r *http.Request, transferType string) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter := db.TransferFilter{UserID: userID, Type: transferType, Status: r.URL.Query().Get("status")}
+	h.writeTransfers(w, r, filter)
+}
+
+// ListTransfers returns the latest transfers of all users, newest first,
+// optionally narrowed to a status, type or user. Admins review
+// status=pending.
+func (h *Handler) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.TransferFilter{Type: query.Get("type"), Status: query.Get("status")}
+	switch filter.Type {
+	case "", db.TransferDeposit, db.TransferWithdrawal:
+	default:
+		writeError(w, http.StatusBadRequest, "Type must be 'deposit' or 'withdrawal'")
+		return
+	}
+	if v := query.Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil || userID <= 0 {
+			writeError(w, http.StatusBadRequest, "user_id must be a positive integer")
+			return
+		}
+		filter.UserID = userID
+	}
+	h.writeTransfers(w, r, filter)
+}
+
+// writeTransfers writes a page of the transfers matching filter, checking
+// its status and the limit query parameter
+func (h *Handler) writeTransfers(w http.ResponseWriter, r *http.Request, filter db.TransferFilter) {
+	switch filter.Status {
+	case "", "pending", "completed", "rejected":
+	default:
+		writeError(w, http.StatusBadRequest, "Status must be 'pending', 'completed' or 'rejected'")
+		return
+	}
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = db.DefaultPageLimit
+	}
+
+	transfers, err := h.DB.GetTransfers(r.Context(), filter, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve transfers")
+		return
+	}
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+// ApproveTransfer completes a pending deposit or withdrawal, posting it to
+// the ledger. A withdrawal the user no longer has the balance or
+// borrowing capacity for is refused.
+func (h *Handler) ApproveTransfer(w http.ResponseWriter, r *http.Request) {
+	h.reviewTransfer(w, r, true)
+}
+
+// RejectTransfer rejects a pending deposit or withdrawal, releasing the
+// amount a withdrawal held
+func (h *Handler) RejectTransfer(w http.ResponseWriter, r *http.Request) {
+	h.reviewTransfer(w, r, false)
+}
+
+func (h *Handler) reviewTransfer(w http.ResponseWriter, r *http.Request, approve bool) {
+	transferID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid transfer ID")
+		return
+	}
+	adminID, _ := r.Context().Value("user_id").(int)
+
+	transfer, err := h.DB.ReviewTransfer(r.Context(), transferID, adminID, approve, h.borrowLimit())
+	var notPending *db.TransferNotPendingError
+	var insufficient *db.InsufficientBalanceError
+	var limitErr *db.BorrowLimitError
+	switch {
+	case errors.As(err, &notPending):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"code":        codeTransferNotPending,
+			"error":       "Transfer already " + notPending.Status,
+			"transfer_id": transferID,
+			"status":      notPending.Status,
+		})
+		return
+	case errors.As(err, &insufficient):
+		writeJSON(w, http.StatusConflict, insufficientBalanceResponse{
+			Asset:     insufficient.Asset,
+			Available: insufficient.Available,
+			Code:      codeInsufficientFunds,
+			Error:     "Insufficient balance",
+		})
+		return
+	case errors.As(err, &limitErr):
+		writeBorrowLimitError(w, http.StatusConflict, limitErr, "Owed above borrowing capacity")
+		return
+	case errors.Is(err, db.ErrTransferNotFound):
+		writeError(w, http.StatusNotFound, "Transfer not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+
+	log.Printf("Admin %d %s %s %d of user %d", adminID, transfer.Status, transfer.Type, transfer.ID, transfer.UserID)
+	writeJSON(w, http.StatusOK, transfer)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/webhooks"
+)
+
+// maxWebhooks is how many webhooks a user may have at once
+const maxWebhooks = 10
+
+// defaultDeliveryLimit is how many deliveries GetWebhookDeliveries returns
+// when the request doesn't say
+const defaultDeliveryLimit = 100
+
+// CreateWebhook registers a URL the user's order fills and cancellations are
+// posted to. The signing secret is only returned here.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req webhookRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeAPIError(w, http.StatusBadRequest, newFieldError(codeInvalidField, "url", "URL must be an absolute http or https URL"))
+		return
+	}
+	// Deliveries check again when they connect, in case the host's
+	// addresses change
+	if err := webhooks.CheckHost(r.Context(), h.Resolver, u.Hostname()); errors.Is(err, webhooks.ErrForbiddenAddress) {
+		writeAPIError(w, http.StatusBadRequest, newFieldError(codeInvalidField, "url", "URL must not point at a private, loopback or link-local address"))
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusBadRequest, newFieldError(codeInvalidField, "url", "URL's host can't be resolved"))
+		return
+	}
+
+	existing, err := h.DB.ListWebhooks(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		writeError(w, http.StatusConflict, fmt.Sprintf("At most %d webhooks are allowed; delete one first", maxWebhooks))
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	webhook, err := h.DB.CreateWebhook(r.Context(), userID, req.URL, secret)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// ListWebhooks lists the user's webhooks
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	list, err := h.DB.ListWebhooks(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DeleteWebhook stops posting to one of the user's webhooks. Deliveries
+// still pending for it fail; its delivery log stays readable.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = h.DB.DeleteWebhook(r.Context(), id, userID)
+	if errors.Is(err, db.ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messageResponse{Message: "Webhook deleted"})
+}
+
+// GetWebhookDeliveries returns the latest deliveries to one of the user's
+// webhooks, newest first, with how each attempt went
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+
+	deliveries, err := h.DB.GetWebhookDeliveries(r.Context(), id, userID, limit)
+	if errors.Is(err, db.ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve webhook deliveries")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,83 @@
+// Package archive keeps the operational tables small by moving orders and
+// trades that are done with to archive tables.
+//
+// Once older than the retention period, a trade is archived when both of
+// its orders are filled or canceled, and, while trades are sent to the
+// accounting system, once it has been batched. An order is archived when
+// it is filled or canceled, older than the retention period and none of
+// its trades remain. Open orders and their trades, and the ledger, are
+// never archived.
+package archive
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// batchSize is how many rows are moved per statement, so archiving a
+// backlog doesn't hold locks on a large part of a table at once
+const batchSize = 1000
+
+// Archiver moves old orders and trades to the archive tables
+type Archiver struct {
+	DB            *db.DB
+	After         time.Duration // How old orders and trades get before they are archived
+	KeepUnbatched bool          // Don't archive trades not yet sent to accounting
+}
+
+// NewArchiver creates an archiver with a retention period
+func NewArchiver(database *db.DB, after time.Duration, keepUnbatched bool) *Archiver {
+	return &Archiver{DB: database, After: after, KeepUnbatched: keepUnbatched}
+}
+
+// Archive moves everything older than the retention period at now that is
+// done with to the archive tables, trades first so their orders follow in
+// the same pass, and returns how many orders and trades it moved
+func (a *Archiver) Archive(ctx context.Context, now time.Time) (orders, trades int, err error) {
+	before := now.Add(-a.After)
+	for {
+		n, err := a.DB.ArchiveTrades(ctx, before, batchSize, a.KeepUnbatched)
+		trades += n
+		if err != nil {
+			return orders, trades, err
+		}
+		if n < batchSize {
+			break
+		}
+	}
+	for {
+		n, err := a.DB.ArchiveOrders(ctx, before, batchSize)
+		orders += n
+		if err != nil {
+			return orders, trades, err
+		}
+		if n < batchSize {
+			break
+		}
+	}
+	return orders, trades, nil
+}
+
+// Run archives every interval until ctx is done. Failures are retried on
+// the next run.
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		orders, trades, err := a.Archive(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to archive: %v", err)
+		}
+		if orders > 0 || trades > 0 {
+			log.Printf("Archived %d orders and %d trades", orders, trades)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,99 +2,356 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/xtrntr/exchange/internal/config"
 	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
 	"github.com/xtrntr/exchange/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUsernameReserved is returned when registering a reserved username
+var ErrUsernameReserved = errors.New("username reserved")
+
+// ErrAccountSuspended is returned when a suspended account logs in or makes a request
+var ErrAccountSuspended = errors.New("account suspended")
+
+// ErrServiceAccount is returned when logging in to a service account, which
+// can only use API keys
+var ErrServiceAccount = errors.New("service account")
+
+// ErrSessionEnded is returned for a token whose login session has been
+// revoked or has expired, or that doesn't name one
+var ErrSessionEnded = errors.New("session ended")
+
+// tokenLifetime is how long a login's token and session last
+const tokenLifetime = 24 * time.Hour
+
+// signingKey signs and verifies JWTs
+const signingKey = "my-secret-key"
+
 // AuthService handles user authentication
 type AuthService struct {
-	DB *db.DB
+	DB                *db.DB
+	ReservedUsernames []string              // Can't be registered, in any letter case
+	PasswordPolicy    config.PasswordPolicy // What new passwords must meet
+	Argon2            config.Argon2Params   // Parameters new password hashes use; zero uses the defaults
+	Events            *events.Bus           // Receives a UserLoggedIn event for each login; nil publishes none
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(db *db.DB) *AuthService {
-	return &AuthService{DB: db}
+	defaults := config.Default()
+	return &AuthService{
+		DB:                db,
+		ReservedUsernames: defaults.ReservedUsernames,
+		PasswordPolicy:    defaults.PasswordPolicy,
+		Argon2:            defaults.Argon2,
+	}
 }
 
-// Register creates a new user with hashed password
-func (s *AuthService) Register(ctx context.Context, username, password string) (*models.User, error) {
-	// Validate input
-	if username == "" {
-		return nil, fmt.Errorf("username cannot be empty")
+// argon2Params returns the parameters new password hashes use
+func (s *AuthService) argon2Params() config.Argon2Params {
+	if s.Argon2 == (config.Argon2Params{}) {
+		return config.Default().Argon2
 	}
-	if password == "" {
-		return nil, fmt.Errorf("password cannot be empty")
+	return s.Argon2
+}
+
+// isReserved reports whether a username is reserved, ignoring letter case
+func (s *AuthService) isReserved(username string) bool {
+	for _, reserved := range s.ReservedUsernames {
+		if strings.EqualFold(username, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUsername checks a username being registered or changed to
+func (s *AuthService) validateUsername(username string) error {
+	if username == "" {
+		return fmt.Errorf("username cannot be empty")
 	}
 	if len(username) > 50 {
-		return nil, fmt.Errorf("username too long (max 50 characters)")
+		return fmt.Errorf("username too long (max 50 characters)")
+	}
+	if s.isReserved(username) {
+		return ErrUsernameReserved
+	}
+	return nil
+}
+
+// validatePassword checks a password being registered or changed to
+func (s *AuthService) validatePassword(password string) error {
+	if password == "" {
+		return fmt.Errorf("password cannot be empty")
 	}
 	if len(password) > 100 {
-		return nil, fmt.Errorf("password too long (max 100 characters)")
+		return fmt.Errorf("password too long (max 100 characters)")
+	}
+	return CheckPassword(s.PasswordPolicy, password)
+}
+
+// Register creates a new user with hashed password. A password that doesn't
+// meet the password policy returns a *WeakPasswordError.
+func (s *AuthService) Register(ctx context.Context, username, password string) (*models.User, error) {
+	// Validate input
+	if err := s.validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := s.validatePassword(password); err != nil {
+		return nil, err
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(password, s.argon2Params())
 	if err != nil {
 		return nil, err
 	}
 
 	// Create user in database
-	user, err := s.DB.CreateUser(ctx, username, string(hashedPassword))
+	user, err := s.DB.CreateUser(ctx, username, hashedPassword)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 	return user, nil
 }
 
+// CreateServiceAccount creates a password-less account for a bot or internal
+// service. The username rules are the same as for registering.
+func (s *AuthService) CreateServiceAccount(ctx context.Context, username string) (*models.User, error) {
+	if err := s.validateUsername(username); err != nil {
+		return nil, err
+	}
+	return s.DB.CreateServiceAccount(ctx, username)
+}
+
+// ChangePassword changes a user's password if current is their password,
+// returning ErrWrongPassword if not. The same rules apply to the new password
+// as when registering. Every session except keepSessionID is revoked, so
+// tokens issued before the change stop working.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int, current, password string, keepSessionID int) error {
+	user, err := s.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.ServiceAccount {
+		return ErrServiceAccount
+	}
+	if _, err := VerifyPassword(user.PasswordHash, current, s.argon2Params()); err != nil {
+		return err
+	}
+	if err := s.validatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(password, s.argon2Params())
+	if err != nil {
+		return err
+	}
+	err = s.DB.ChangePassword(ctx, userID, user.PasswordHash, hash, keepSessionID)
+	if errors.Is(err, db.ErrPasswordChanged) {
+		// Changed by another request, so current is no longer the password
+		return ErrWrongPassword
+	}
+	return err
+}
+
+// ChangeUsername renames a user, keeping the old name in their history. The
+// same rules apply as when registering.
+func (s *AuthService) ChangeUsername(ctx context.Context, userID int, username string) (*models.User, error) {
+	if err := s.validateUsername(username); err != nil {
+		return nil, err
+	}
+	return s.DB.ChangeUsername(ctx, userID, username)
+}
+
+// Client describes where a login comes from, as shown in its session
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
 // Login verifies credentials and generates a JWT
 func (s *AuthService) Login(ctx context.Context, username, password string) (string, error) {
+	return s.LoginFrom(ctx, username, password, Client{})
+}
+
+// LoginFrom verifies credentials and generates a JWT for a new session
+// recording the client logging in. The token is accepted until it expires or
+// its session is revoked.
+func (s *AuthService) LoginFrom(ctx context.Context, username, password string, client Client) (string, error) {
 	// Get user from database
 	user, err := s.DB.GetUserByUsername(ctx, username)
 	if err != nil {
 		return "", err
 	}
+	if user.ServiceAccount {
+		return "", ErrServiceAccount
+	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	rehash, err := VerifyPassword(user.PasswordHash, password, s.argon2Params())
+	if err != nil {
+		return "", err
+	}
+	if user.MergedInto != 0 {
+		return "", db.ErrAccountMerged
+	}
+	if user.Suspended {
+		return "", ErrAccountSuspended
+	}
+
+	// Move legacy bcrypt hashes, and hashes with old parameters, to the
+	// current ones while the password is at hand. The old hash still works
+	// if this fails, so the login goes ahead.
+	if rehash {
+		if err := s.rehashPassword(ctx, user, password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
+		}
+	}
+
+	// Checked before the session is created, as that records the IP. A
+	// failed check only costs the new-IP notification, so the login goes
+	// ahead.
+	var newIP bool
+	if s.Events != nil && client.IP != "" {
+		if newIP, err = s.DB.IsNewLoginIP(ctx, user.ID, client.IP); err != nil {
+			log.Printf("Failed to check login IP of user %d: %v", user.ID, err)
+		}
+	}
+
+	session, err := s.DB.CreateSession(ctx, user.ID, client.IP, client.UserAgent, time.Now().Add(tokenLifetime))
+	if err != nil {
 		return "", err
 	}
+	if s.Events != nil {
+		s.Events.Publish(events.Event{Type: events.UserLoggedIn, Data: models.Login{Session: *session, Username: user.Username, NewIP: newIP}})
+	}
 
 	// Generate JWT
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
+		"user_id":          user.ID,
+		"username":         user.Username,
+		"login_session_id": session.ID,
+		"exp":              session.ExpiresAt.Unix(),
 	})
 
 	// Sign token with a secret key (in production, use env variable)
-	tokenString, err := token.SignedString([]byte("my-secret-key"))
+	tokenString, err := token.SignedString([]byte(signingKey))
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
+// rehashPassword replaces a user's password hash with one using the current
+// parameters, unless the hash has changed since it was read
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) error {
+	hash, err := HashPassword(password, s.argon2Params())
+	if err != nil {
+		return err
+	}
+	return s.DB.ReplacePasswordHash(ctx, user.ID, user.PasswordHash, hash)
+}
+
+// ActiveUser loads the user a request is authenticated as, returning
+// db.ErrAccountMerged or ErrAccountSuspended if the account may no longer
+// be used. Tokens outlive both, so this is checked on every request.
+func (s *AuthService) ActiveUser(ctx context.Context, userID int) (*models.User, error) {
+	user, err := s.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MergedInto != 0 {
+		return nil, db.ErrAccountMerged
+	}
+	if user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+	return user, nil
+}
+
 // GetUserFromToken extracts user ID from JWT
 func (s *AuthService) GetUserFromToken(tokenString string) (int, error) {
+	claims, err := s.ParseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// TokenClaims are the identities a JWT carries. Login tokens name their
+// login session, while impersonation tokens name the admin using them and
+// their impersonation session.
+type TokenClaims struct {
+	UserID         int
+	LoginSessionID int
+	ImpersonatorID int // Zero unless the token is for impersonation
+	SessionID      int
+}
+
+// ParseToken verifies a JWT and returns its claims
+func (s *AuthService) ParseToken(tokenString string) (*TokenClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte("my-secret-key"), nil
+		return []byte(signingKey), nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			return 0, err
-		}
-		return int(userID), nil
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
-	return 0, err
+	userID, ok := mapClaims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("token has no user")
+	}
+	claims := &TokenClaims{UserID: int(userID)}
+	if loginSessionID, ok := mapClaims["login_session_id"].(float64); ok {
+		claims.LoginSessionID = int(loginSessionID)
+	}
+	if impersonatorID, ok := mapClaims["impersonator_id"].(float64); ok {
+		claims.ImpersonatorID = int(impersonatorID)
+		sessionID, _ := mapClaims["session_id"].(float64)
+		claims.SessionID = int(sessionID)
+	}
+	return claims, nil
+}
+
+// CheckSession returns ErrSessionEnded unless a login token's session is
+// still active. Tokens issued before sessions existed don't name one, so
+// they're refused too.
+func (s *AuthService) CheckSession(ctx context.Context, claims *TokenClaims) error {
+	if claims.LoginSessionID == 0 {
+		return ErrSessionEnded
+	}
+	active, err := s.DB.SessionActive(ctx, claims.LoginSessionID, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrSessionEnded
+	}
+	return nil
+}
+
+// ImpersonationToken generates a JWT that lets the session's admin view
+// the user's account until the session expires
+func (s *AuthService) ImpersonationToken(session *models.ImpersonationSession) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":         session.UserID,
+		"impersonator_id": session.AdminID,
+		"session_id":      session.ID,
+		"exp":             session.ExpiresAt.Unix(),
+	})
+	return token.SignedString([]byte(signingKey))
 }
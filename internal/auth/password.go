@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/xtrntr/exchange/internal/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrWrongPassword is returned when a password doesn't match its hash
+var ErrWrongPassword = errors.New("wrong password")
+
+// Password requirements a WeakPasswordError can name
+const (
+	RequireLength = "length"
+	RequireUpper  = "upper"
+	RequireLower  = "lower"
+	RequireDigit  = "digit"
+	RequireSymbol = "symbol"
+)
+
+// WeakPasswordError is returned when registering a password that doesn't
+// meet the password policy
+type WeakPasswordError struct {
+	Requirement string // Which requirement, e.g. RequireDigit
+	MinLength   int    // The policy's minimum length
+}
+
+func (e *WeakPasswordError) Error() string {
+	if e.Requirement == RequireLength {
+		return fmt.Sprintf("password must have at least %d characters", e.MinLength)
+	}
+	return "password must contain " + requiredCharacters[e.Requirement]
+}
+
+// requiredCharacters describes the characters each requirement asks for
+var requiredCharacters = map[string]string{
+	RequireUpper:  "an uppercase letter",
+	RequireLower:  "a lowercase letter",
+	RequireDigit:  "a digit",
+	RequireSymbol: "a symbol",
+}
+
+// CheckPassword returns a *WeakPasswordError if a password doesn't meet the
+// policy
+func CheckPassword(policy config.PasswordPolicy, password string) error {
+	if len([]rune(password)) < policy.MinLength {
+		return &WeakPasswordError{Requirement: RequireLength, MinLength: policy.MinLength}
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	for _, requirement := range []struct {
+		name     string
+		required bool
+		met      bool
+	}{
+		{RequireUpper, policy.RequireUpper, upper},
+		{RequireLower, policy.RequireLower, lower},
+		{RequireDigit, policy.RequireDigit, digit},
+		{RequireSymbol, policy.RequireSymbol, symbol},
+	} {
+		if requirement.required && !requirement.met {
+			return &WeakPasswordError{Requirement: requirement.name, MinLength: policy.MinLength}
+		}
+	}
+	return nil
+}
+
+// Lengths of argon2id salts and hashes, in bytes
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+// argon2Prefix starts every argon2id hash
+const argon2Prefix = "$argon2id$"
+
+// HashPassword hashes a password with argon2id and a random salt, encoded
+// with its parameters in the PHC string format:
+// $argon2id$v=19$m=19456,t=2,p=1$salt$hash
+func HashPassword(password string, params config.Argon2Params) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, keyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against its hash, an argon2id hash from
+// HashPassword or a legacy bcrypt hash. It returns ErrWrongPassword if the
+// password doesn't match, and whether a matching password should be hashed
+// again: for a bcrypt hash, or an argon2id hash with parameters other than
+// params.
+func VerifyPassword(hash, password string, params config.Argon2Params) (rehash bool, err error) {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrWrongPassword
+		}
+		return err == nil, err
+	}
+
+	// $argon2id$v=19$m=...,t=...,p=...$salt$hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false, errors.New("unsupported argon2id hash")
+	}
+	hashParams, err := config.ParseArgon2Params(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id hash parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hashParams.Time, hashParams.Memory, hashParams.Threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(key, want) != 1 {
+		return false, ErrWrongPassword
+	}
+	return hashParams != params, nil
+}
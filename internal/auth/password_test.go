@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPassword(t *testing.T) {
+	policy := config.PasswordPolicy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		password string
+		want     string // Requirement not met, or empty
+	}{
+		{"Ab1!", RequireLength},
+		{"ab1!ab1!", RequireUpper},
+		{"AB1!AB1!", RequireLower},
+		{"Abc!Abc!", RequireDigit},
+		{"Abc1Abc1", RequireSymbol},
+		{"Abc1 Abc1", ""},
+		{"Ünïcødé1!", ""},
+	}
+	for _, tt := range tests {
+		err := CheckPassword(policy, tt.password)
+		var weak *WeakPasswordError
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%q: unexpected error %v", tt.password, err)
+		case tt.want != "" && (!errors.As(err, &weak) || weak.Requirement != tt.want):
+			t.Errorf("%q: expected requirement %s, got %v", tt.password, tt.want, err)
+		}
+	}
+
+	// Length counts characters, not bytes
+	if err := CheckPassword(config.PasswordPolicy{MinLength: 4}, "üüü"); err == nil {
+		t.Error("expected 3 characters to be too short")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	params := config.Argon2Params{Memory: 64, Time: 1, Threads: 1}
+	hash, err := HashPassword("correct horse", params)
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+	if other, _ := HashPassword("correct horse", params); other == hash {
+		t.Error("expected each hash to have its own salt")
+	}
+
+	if rehash, err := VerifyPassword(hash, "correct horse", params); err != nil || rehash {
+		t.Errorf("expected a match without rehash, got %v, %v", rehash, err)
+	}
+	if _, err := VerifyPassword(hash, "wrong horse", params); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword, got %v", err)
+	}
+	// The hash's own parameters verify it; other current ones ask for a rehash
+	if rehash, err := VerifyPassword(hash, "correct horse", config.Argon2Params{Memory: 128, Time: 1, Threads: 1}); err != nil || !rehash {
+		t.Errorf("expected a match with rehash, got %v, %v", rehash, err)
+	}
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if rehash, err := VerifyPassword(string(legacy), "correct horse", params); err != nil || !rehash {
+		t.Errorf("expected a bcrypt match with rehash, got %v, %v", rehash, err)
+	}
+	if _, err := VerifyPassword(string(legacy), "wrong horse", params); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword for bcrypt, got %v", err)
+	}
+
+	for _, corrupt := range []string{"$argon2id$v=19$m=64,t=1,p=1$salt", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=64,t=1,p=1$!!$aGFzaA", ""} {
+		if _, err := VerifyPassword(corrupt, "correct horse", params); err == nil || errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%q: expected a hash error, got %v", corrupt, err)
+		}
+	}
+}
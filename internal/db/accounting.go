@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// OutboxBatch is an accounting batch stored for delivery, with its
+// serialized models.AccountingBatch payload and delivery state
+type OutboxBatch struct {
+	ID            int        `json:"id"`
+	Payload       []byte     `json:"-"`
+	Trades        int        `json:"trades"`
+	LedgerEntries int        `json:"ledger_entries"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"` // Nil until the receiver acknowledges it
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// outboxBatchColumns is the column list scanned by scanOutboxBatch
+const outboxBatchColumns = "id, payload, trades, ledger_entries, created_at, delivered_at, attempts, COALESCE(last_error, '')"
+
+func scanOutboxBatch(row pgx.Row, batch *OutboxBatch) error {
+	return row.Scan(&batch.ID, &batch.Payload, &batch.Trades, &batch.LedgerEntries, &batch.CreatedAt, &batch.DeliveredAt, &batch.Attempts, &batch.LastError)
+}
+
+// accountingTrade returns a trade of an instrument as reported to back-office
+// systems. The trade must carry its owners.
+func accountingTrade(trade models.Trade, symbol string) models.AccountingTrade {
+	return models.AccountingTrade{
+		ID:          trade.ID,
+		Symbol:      symbol,
+		BuyOrderID:  trade.BuyOrderID,
+		SellOrderID: trade.SellOrderID,
+		BuyUserID:   trade.BuyUserID,
+		SellUserID:  trade.SellUserID,
+		Price:       trade.Price,
+		Quantity:    trade.Quantity,
+		BuyFee:      trade.BuyFee,
+		SellFee:     trade.SellFee,
+		TakerSide:   trade.TakerSide,
+		ExecutedAt:  trade.ExecutedAt,
+	}
+}
+
+// CreateAccountingBatch claims up to limit trades and up to limit ledger
+// entries not yet in a batch, oldest first, and stores them as a new batch.
+// Claiming and storing happen in one transaction, so each trade and entry
+// is in exactly one batch. Returns nil if there is nothing to batch.
+func (db *DB) CreateAccountingBatch(ctx context.Context, limit int) (*OutboxBatch, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	payload := models.AccountingBatch{Trades: []models.AccountingTrade{}, LedgerEntries: []models.LedgerEntry{}}
+	err = tx.QueryRow(ctx,
+		"INSERT INTO accounting_batches (payload, trades, ledger_entries) VALUES ('{}', 0, 0) RETURNING id, created_at").
+		Scan(&payload.ID, &payload.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accounting batch: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE trades AS t SET accounting_batch_id = $1
+		FROM orders b, orders s
+		WHERE b.id = t.buy_order_id AND s.id = t.sell_order_id AND t.id IN (
+			SELECT id FROM trades WHERE accounting_batch_id IS NULL ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+tradeColumns+", b.symbol, b.user_id, s.user_id",
+		payload.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim trades: %w", err)
+	}
+	for rows.Next() {
+		var trade models.Trade
+		var symbol string
+		if err := scanTrade(rows, &trade, &symbol, &trade.BuyUserID, &trade.SellUserID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		payload.Trades = append(payload.Trades, accountingTrade(trade, symbol))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trade rows: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `
+		UPDATE ledger_entries SET accounting_batch_id = $1
+		WHERE id IN (
+			SELECT id FROM ledger_entries WHERE accounting_batch_id IS NULL ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(user_id, 0), account, asset, amount, kind, reference, created_at`,
+		payload.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim ledger entries: %w", err)
+	}
+	for rows.Next() {
+		var entry models.LedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Account, &entry.Asset, &entry.Amount, &entry.Kind, &entry.Reference, &entry.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		payload.LedgerEntries = append(payload.LedgerEntries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger entry rows: %w", err)
+	}
+
+	if len(payload.Trades) == 0 && len(payload.LedgerEntries) == 0 {
+		return nil, nil
+	}
+	sort.Slice(payload.Trades, func(i, j int) bool { return payload.Trades[i].ID < payload.Trades[j].ID })
+	sort.Slice(payload.LedgerEntries, func(i, j int) bool { return payload.LedgerEntries[i].ID < payload.LedgerEntries[j].ID })
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accounting batch: %w", err)
+	}
+	batch := &OutboxBatch{}
+	err = scanOutboxBatch(tx.QueryRow(ctx,
+		"UPDATE accounting_batches SET payload = $2, trades = $3, ledger_entries = $4 WHERE id = $1 RETURNING "+outboxBatchColumns,
+		payload.ID, data, len(payload.Trades), len(payload.LedgerEntries)), batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store accounting batch: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return batch, nil
+}
+
+// GetUndeliveredAccountingBatches retrieves up to limit batches the
+// receiver hasn't acknowledged, oldest first
+func (db *DB) GetUndeliveredAccountingBatches(ctx context.Context, limit int) ([]OutboxBatch, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.queryOutboxBatches(ctx,
+		"SELECT "+outboxBatchColumns+" FROM accounting_batches WHERE delivered_at IS NULL ORDER BY id LIMIT $1", limit)
+}
+
+// GetAccountingBatches retrieves up to limit batches with IDs from fromID
+// to toID inclusive, oldest first. A zero toID has no upper bound.
+func (db *DB) GetAccountingBatches(ctx context.Context, fromID, toID, limit int) ([]OutboxBatch, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.queryOutboxBatches(ctx,
+		"SELECT "+outboxBatchColumns+" FROM accounting_batches WHERE id >= $1 AND ($2 = 0 OR id <= $2) ORDER BY id LIMIT $3",
+		fromID, toID, limit)
+}
+
+func (db *DB) queryOutboxBatches(ctx context.Context, query string, args ...interface{}) ([]OutboxBatch, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounting batches: %w", err)
+	}
+	defer rows.Close()
+
+	batches := []OutboxBatch{}
+	for rows.Next() {
+		var batch OutboxBatch
+		if err := scanOutboxBatch(rows, &batch); err != nil {
+			return nil, fmt.Errorf("failed to scan accounting batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounting batch rows: %w", err)
+	}
+	return batches, nil
+}
+
+// RecordAccountingDelivery counts a delivery attempt, marking the batch
+// delivered if it succeeded or keeping the error if it failed. A batch stays
+// delivered once it has been acknowledged, even if a later replay fails.
+func (db *DB) RecordAccountingDelivery(ctx context.Context, batchID int, deliveryErr error) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var errMsg *string
+	if deliveryErr != nil {
+		msg := deliveryErr.Error()
+		errMsg = &msg
+	}
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE accounting_batches SET
+			attempts = attempts + 1,
+			last_error = $2,
+			delivered_at = CASE WHEN $2::TEXT IS NULL THEN COALESCE(delivered_at, CURRENT_TIMESTAMP) ELSE delivered_at END
+		WHERE id = $1`,
+		batchID, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to record accounting delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrUserNotFound is returned when an account doesn't exist
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrAccountMerged is returned when an account has already been merged into another
+var ErrAccountMerged = errors.New("account already merged")
+
+// ErrPasswordChanged is returned when a user's password hash changed while
+// their password was being changed
+var ErrPasswordChanged = errors.New("password changed concurrently")
+
+// ChangePassword replaces a user's password hash, if it is still oldHash,
+// and revokes all their sessions other than keepSessionID
+func (db *DB) ChangePassword(ctx context.Context, userID int, oldHash, newHash string, keepSessionID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		"UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2",
+		userID, oldHash, newHash)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasswordChanged
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL",
+		userID, keepSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ChangeUsername renames a user and records the old name for audit
+func (db *DB) ChangeUsername(ctx context.Context, userID int, username string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldUsername string
+	err = tx.QueryRow(ctx, "SELECT username FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&oldUsername)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	user := &models.User{}
+	err = scanUser(tx.QueryRow(ctx,
+		"UPDATE users SET username = $1 WHERE id = $2 RETURNING "+userColumns,
+		username, userID), user)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to change username: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO username_changes (user_id, old_username, new_username) VALUES ($1, $2, $3)",
+		userID, oldUsername, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record username change: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return user, nil
+}
+
+// GetUsernameChanges returns a user's past usernames, oldest first
+func (db *DB) GetUsernameChanges(ctx context.Context, userID int) ([]models.UsernameChange, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT old_username, new_username, changed_at FROM username_changes WHERE user_id = $1 ORDER BY id",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get username changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []models.UsernameChange{}
+	for rows.Next() {
+		var change models.UsernameChange
+		if err := rows.Scan(&change.OldUsername, &change.NewUsername, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan username change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating username change rows: %w", err)
+	}
+	return changes, nil
+}
+
+// MergeAccounts folds a duplicate account into another in one transaction.
+// The source's orders, and with them its trades, are re-attributed to the
+// target, its balances are moved with ledger entries of kind "merge", its API
+// keys are revoked and it is marked as merged so it can no longer log in.
+func (db *DB) MergeAccounts(ctx context.Context, sourceUserID, targetUserID int) (*models.AccountMerge, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if sourceUserID == targetUserID {
+		return nil, fmt.Errorf("cannot merge an account into itself")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock both accounts, in ID order to avoid deadlocking with a concurrent merge
+	rows, err := tx.Query(ctx,
+		"SELECT id, COALESCE(merged_into, 0) FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE",
+		sourceUserID, targetUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	found := 0
+	for rows.Next() {
+		var id, mergedInto int
+		if err := rows.Scan(&id, &mergedInto); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if mergedInto != 0 {
+			rows.Close()
+			return nil, ErrAccountMerged
+		}
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	if found != 2 {
+		return nil, ErrUserNotFound
+	}
+
+	rows, err = tx.Query(ctx, "UPDATE orders SET user_id = $1 WHERE user_id = $2 RETURNING id", targetUserID, sourceUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move orders: %w", err)
+	}
+	orderIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to move orders: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE trades SET
+			buyer_user_id = CASE WHEN buyer_user_id = $2 THEN $1 ELSE buyer_user_id END,
+			seller_user_id = CASE WHEN seller_user_id = $2 THEN $1 ELSE seller_user_id END
+		WHERE buyer_user_id = $2 OR seller_user_id = $2`, targetUserID, sourceUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move trades: %w", err)
+	}
+	err = audit(ctx, tx, "order.reassigned", "order", orderIDs,
+		map[string]interface{}{"user_id": sourceUserID}, map[string]interface{}{"user_id": targetUserID})
+	if err != nil {
+		return nil, err
+	}
+
+	merge := &models.AccountMerge{
+		SourceUserID: sourceUserID,
+		TargetUserID: targetUserID,
+		OrdersMoved:  len(orderIDs),
+	}
+	err = tx.QueryRow(ctx,
+		"INSERT INTO account_merges (source_user_id, target_user_id, orders_moved) VALUES ($1, $2, $3) RETURNING id, merged_at",
+		sourceUserID, targetUserID, merge.OrdersMoved).Scan(&merge.ID, &merge.MergedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record merge: %w", err)
+	}
+
+	merge.Balances, err = getBalances(ctx, tx, sourceUserID)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.LedgerEntry
+	for _, balance := range merge.Balances {
+		entries = append(entries,
+			models.LedgerEntry{UserID: sourceUserID, Asset: balance.Asset, Amount: -balance.Amount},
+			models.LedgerEntry{UserID: targetUserID, Asset: balance.Asset, Amount: balance.Amount},
+		)
+	}
+	if err := postEntries(ctx, tx, "merge", fmt.Sprintf("merge:%d", merge.ID), entries); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+		sourceUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke api keys: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE users SET merged_into = $1 WHERE id = $2", targetUserID, sourceUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark account merged: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return merge, nil
+}
+
+// ListUsers returns a page of all users, in ID order by default
+func (db *DB) ListUsers(ctx context.Context, page Page) ([]models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := page.appendTo("SELECT "+userColumns+" FROM users WHERE TRUE", nil, userSortColumns)
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	return users, nil
+}
+
+// ListServiceAccounts returns all service accounts in ID order
+func (db *DB) ListServiceAccounts(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE service_account ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	return users, nil
+}
+
+// SetUserRole changes a user's role
+func (db *DB) SetUserRole(ctx context.Context, userID int, role string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	user := &models.User{}
+	err := scanUser(db.Pool.QueryRow(ctx,
+		"UPDATE users SET role = $1 WHERE id = $2 RETURNING "+userColumns,
+		role, userID), user)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user role: %w", err)
+	}
+	return user, nil
+}
+
+// SuspendUser suspends an account and cancels its open orders in one
+// transaction, returning the IDs of the canceled orders. Suspending an
+// already suspended account cancels nothing new and succeeds.
+func (db *DB) SuspendUser(ctx context.Context, userID int) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		"UPDATE users SET suspended_at = COALESCE(suspended_at, CURRENT_TIMESTAMP) WHERE id = $1",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suspend user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	orderIDs, err := cancelOrders(ctx, tx, "order.canceled", "UPDATE orders SET status = 'canceled' WHERE user_id = $1 AND status = 'open'", userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.queueOrderEvents(ctx, tx, "canceled", orderIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return orderIDs, nil
+}
+
+// UnsuspendUser lifts an account's suspension. Orders canceled by the
+// suspension stay canceled.
+func (db *DB) UnsuspendUser(ctx context.Context, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, "UPDATE users SET suspended_at = NULL WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrAPIKeyNotFound is returned when an API key doesn't exist, is revoked, or belongs to another user
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// CreateAPIKey stores a new API key for a user
+func (db *DB) CreateAPIKey(ctx context.Context, userID int, key, secret, label string, scopes []string) (*models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	apiKey := &models.APIKey{}
+	err := db.Pool.QueryRow(ctx,
+		"INSERT INTO api_keys (user_id, api_key, secret, label, scopes) VALUES ($1, $2, $3, $4, $5) RETURNING id, user_id, api_key, secret, label, scopes, created_at, cancel_on_disconnect",
+		userID, key, secret, label, scopes).Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Key, &apiKey.Secret, &apiKey.Label, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.CancelOnDisconnect)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// GetAPIKey retrieves an active API key, including its secret, by its public key
+func (db *DB) GetAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	apiKey := &models.APIKey{}
+	err := retry(ctx, func() error {
+		return db.Pool.QueryRow(ctx,
+			"SELECT id, user_id, api_key, secret, label, scopes, created_at, cancel_on_disconnect FROM api_keys WHERE api_key = $1 AND revoked_at IS NULL",
+			key).Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Key, &apiKey.Secret, &apiKey.Label, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.CancelOnDisconnect)
+	})
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// ListAPIKeys retrieves a user's active API keys without their secrets
+func (db *DB) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, user_id, api_key, label, scopes, created_at, cancel_on_disconnect FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var apiKey models.APIKey
+		if err := rows.Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Key, &apiKey.Label, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.CancelOnDisconnect); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, apiKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api key rows: %w", err)
+	}
+	return keys, nil
+}
+
+// SetAPIKeyCancelOnDisconnect sets whether one of the user's API keys
+// cancels their open orders when a WebSocket connection it authenticated
+// drops, returning the key without its secret
+func (db *DB) SetAPIKeyCancelOnDisconnect(ctx context.Context, id, userID int, enabled bool) (*models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	apiKey := &models.APIKey{}
+	err := db.Pool.QueryRow(ctx,
+		"UPDATE api_keys SET cancel_on_disconnect = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL RETURNING id, user_id, api_key, label, scopes, created_at, cancel_on_disconnect",
+		id, userID, enabled).Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Key, &apiKey.Label, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.CancelOnDisconnect)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update api key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// RevokeAPIKey revokes one of the user's API keys
+func (db *DB) RevokeAPIKey(ctx context.Context, id, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ArchiveTrades moves up to limit of the oldest trades executed before a
+// time to trades_archive, returning how many it moved. Only trades whose
+// orders are both filled or canceled are moved, so an open order's fills
+// stay with it, and with keepUnbatched only those the accounting
+// integration has batched.
+func (db *DB) ArchiveTrades(ctx context.Context, before time.Time, limit int, keepUnbatched bool) (int, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		WITH moved AS (
+			DELETE FROM trades WHERE (id, executed_at) IN (
+				SELECT t.id, t.executed_at FROM trades t
+				JOIN orders b ON b.id = t.buy_order_id
+				JOIN orders s ON s.id = t.sell_order_id
+				WHERE t.executed_at < $1 AND b.status IN ('filled', 'canceled') AND s.status IN ('filled', 'canceled')
+					AND (NOT $3 OR t.accounting_batch_id IS NOT NULL)
+				ORDER BY t.executed_at, t.id
+				LIMIT $2
+				FOR UPDATE OF t SKIP LOCKED
+			)
+			RETURNING *
+		)
+		INSERT INTO trades_archive SELECT * FROM moved`, before, limit, keepUnbatched)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive trades: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// archivedOrderColumns are the columns of orders kept in orders_archive,
+// named because columns added to both since don't line up
+const archivedOrderColumns = "id, user_id, symbol, type, price, quantity, status, created_at, tag, time_in_force, post_only, display_quantity, expires_at, client_order_id"
+
+// ArchiveOrders moves up to limit of the filled and canceled orders created
+// before a time that no trade in trades refers to, oldest first, to
+// orders_archive, returning how many it moved
+func (db *DB) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		WITH moved AS (
+			DELETE FROM orders WHERE id IN (
+				SELECT o.id FROM orders o
+				WHERE o.created_at < $1 AND o.status IN ('filled', 'canceled')
+					AND NOT EXISTS (SELECT 1 FROM trades t WHERE t.buy_order_id = o.id)
+					AND NOT EXISTS (SELECT 1 FROM trades t WHERE t.sell_order_id = o.id)
+				ORDER BY o.id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		INSERT INTO orders_archive (`+archivedOrderColumns+`) SELECT `+archivedOrderColumns+` FROM moved`, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive orders: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// archivedOrderSelect selects archived orders for scanOrder. The archive
+// has no lifetimes; orders are only archived once closed.
+const archivedOrderSelect = "SELECT id, user_id, symbol, type, price, quantity, status, created_at, tag, time_in_force, post_only, display_quantity, expires_at, COALESCE(client_order_id, ''), 0 FROM orders_archive"
+
+// GetArchivedOrder retrieves one of the user's orders from orders_archive
+func (db *DB) GetArchivedOrder(ctx context.Context, orderID, userID int) (*models.Order, error) {
+	return db.getArchivedOrder(ctx, " WHERE id = $1 AND user_id = $2", orderID, userID)
+}
+
+// GetArchivedOrderByClientID retrieves the user's latest order with a client
+// order ID from orders_archive. Client order IDs are only unique among the
+// orders not yet archived, so several archived orders may share one.
+func (db *DB) GetArchivedOrderByClientID(ctx context.Context, userID int, clientOrderID string) (*models.Order, error) {
+	return db.getArchivedOrder(ctx, " WHERE user_id = $1 AND client_order_id = $2 ORDER BY id DESC LIMIT 1", userID, clientOrderID)
+}
+
+func (db *DB) getArchivedOrder(ctx context.Context, where string, args ...interface{}) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	order := &models.Order{}
+	err := scanOrder(db.Pool.QueryRow(ctx, archivedOrderSelect+where, args...), order)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archived order: %w", err)
+	}
+	return order, nil
+}
+
+// GetArchivedFills returns the quantity and quote value an order traded in
+// the fills moved to trades_archive
+func (db *DB) GetArchivedFills(ctx context.Context, orderID int) (quantity, notional float64, err error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(quantity), 0), COALESCE(SUM(price * quantity), 0) FROM trades_archive
+		WHERE buy_order_id = $1 OR sell_order_id = $1`, orderID).Scan(&quantity, &notional)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get archived fills: %w", err)
+	}
+	return quantity, notional, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Sources of changes recorded in the audit log
+const (
+	SourceAPI    = "api"    // A user's REST request
+	SourceGRPC   = "grpc"   // A user's gRPC call
+	SourceAdmin  = "admin"  // An admin request
+	SourceEngine = "engine" // The matching engine, e.g. fills
+	SourceSystem = "system" // Background jobs such as order expiry, and recovery
+)
+
+// Actor is who made a change, as recorded in the audit log
+type Actor struct {
+	UserID int // Zero for the engine, the system and admin token requests
+	Source string
+	IP     string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context attributing the changes made with it to actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor changes made with ctx are attributed to,
+// which is the system unless WithActor says otherwise
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Source: SourceSystem}
+}
+
+// Order states recorded by status changes
+var (
+	openState     = map[string]interface{}{"status": "open"}
+	canceledState = map[string]interface{}{"status": "canceled"}
+)
+
+// audit records the same change to each of the entities in tx, attributed
+// to the actor in ctx. A nil before or after state is stored as NULL.
+func audit(ctx context.Context, tx pgx.Tx, action, entityType string, entityIDs []int, before, after interface{}) error {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+	beforeJSON, err := auditState(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditState(after)
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFrom(ctx)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO audit_log (actor_id, source, source_ip, action, entity_type, entity_id, before, after)
+		SELECT NULLIF($1::int, 0), $2::text, NULLIF($3::text, ''), $4::text, $5::text, id, $7::jsonb, $8::jsonb
+		FROM unnest($6::bigint[]) AS id`,
+		actor.UserID, actor.Source, actor.IP, action, entityType, entityIDs, beforeJSON, afterJSON)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// auditState encodes an entity's state for the audit log, or returns nil
+// for no state
+func auditState(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit state: %w", err)
+	}
+	return data, nil
+}
+
+// GetAuditLog retrieves up to limit audit entries matching the filter from
+// an entry ID on, oldest first
+func (db *DB) GetAuditLog(ctx context.Context, filter AuditFilter, fromID int64, limit int) ([]models.AuditEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := filter.appendWhere(`
+		SELECT id, COALESCE(actor_id, 0), source, COALESCE(source_ip, ''), action, entity_type, entity_id, before, after, created_at
+		FROM audit_log WHERE id >= $1`, []interface{}{fromID})
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Source, &entry.SourceIP, &entry.Action,
+			&entry.EntityType, &entry.EntityID, &entry.Before, &entry.After, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit log rows: %w", err)
+	}
+	return entries, nil
+}
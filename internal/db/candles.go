@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// UpsertCandle folds a single trade into the candle starting at openTime,
+// creating the candle if this is the first trade in the interval. The
+// merge happens in SQL so concurrent trades can't lose updates.
+func (db *DB) UpsertCandle(ctx context.Context, interval string, openTime time.Time, price, quantity float64) (*models.Candle, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	candle := &models.Candle{}
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO candles (resolution, open_time, open, high, low, close, volume)
+		VALUES ($1, $2, $3, $3, $3, $3, $4)
+		ON CONFLICT (resolution, open_time) DO UPDATE SET
+			high = GREATEST(candles.high, EXCLUDED.high),
+			low = LEAST(candles.low, EXCLUDED.low),
+			close = EXCLUDED.close,
+			volume = candles.volume + EXCLUDED.volume
+		RETURNING resolution, open_time, open, high, low, close, volume`,
+		interval, openTime, price, quantity).Scan(
+		&candle.Interval, &candle.OpenTime, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert candle: %w", err)
+	}
+	return candle, nil
+}
+
+// GetCandles retrieves candles for an interval whose open time falls in [start, end), oldest first
+func (db *DB) GetCandles(ctx context.Context, interval string, start, end time.Time) ([]models.Candle, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		SELECT resolution, open_time, open, high, low, close, volume
+		FROM candles
+		WHERE resolution = $1 AND open_time >= $2 AND open_time < $3
+		ORDER BY open_time ASC`,
+		interval, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []models.Candle
+	for rows.Next() {
+		var candle models.Candle
+		if err := rows.Scan(&candle.Interval, &candle.OpenTime, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume); err != nil {
+			return nil, fmt.Errorf("failed to scan candle: %w", err)
+		}
+		candles = append(candles, candle)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating candle rows: %w", err)
+	}
+	return candles, nil
+}
+
+// SetDailyClose sets the close of the daily candle opening at openTime, if
+// anything traded that day
+func (db *DB) SetDailyClose(ctx context.Context, openTime time.Time, price float64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, "UPDATE candles SET close = $2 WHERE resolution = '1d' AND open_time = $1", openTime, price)
+	if err != nil {
+		return fmt.Errorf("failed to set daily close: %w", err)
+	}
+	return nil
+}
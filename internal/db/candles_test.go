@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDB_UpsertCandle(t *testing.T) {
+	requireDB(t)
+	_, err := testDB.Pool.Exec(context.Background(), "TRUNCATE TABLE candles")
+	if err != nil {
+		t.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	openTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	trades := []struct {
+		price    float64
+		quantity float64
+	}{
+		{100, 1},
+		{105, 0.5},
+		{95, 0.25},
+		{101, 0.25},
+	}
+
+	for _, tr := range trades {
+		if _, err := testDB.UpsertCandle(context.Background(), "1m", openTime, tr.price, tr.quantity); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	candles, err := testDB.GetCandles(context.Background(), "1m", openTime, openTime.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candles) != 1 {
+		t.Fatalf("expected 1 candle, got %d", len(candles))
+	}
+
+	c := candles[0]
+	if c.Open != 100 || c.High != 105 || c.Low != 95 || c.Close != 101 || c.Volume != 2 {
+		t.Errorf("unexpected candle: %+v", c)
+	}
+}
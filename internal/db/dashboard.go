@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// GetUserCounts counts all users, those registered after since and those
+// suspended, and those who traded as of the last trader volume refresh
+func (db *DB) GetUserCounts(ctx context.Context, since time.Time) (models.UserCounts, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var counts models.UserCounts
+	err := db.reader().QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE created_at > $1), COUNT(*) FILTER (WHERE suspended_at IS NOT NULL),
+			(SELECT COUNT(*) FROM trader_volume_24h)
+		FROM users`,
+		since).Scan(&counts.Total, &counts.New, &counts.Suspended, &counts.Traded)
+	if err != nil {
+		return counts, fmt.Errorf("failed to count users: %w", err)
+	}
+	return counts, nil
+}
+
+// GetMarketOverviews returns each market's open orders and its trading
+// after since, in symbol order. Markets with neither are left out.
+func (db *DB) GetMarketOverviews(ctx context.Context, since time.Time) ([]models.MarketOverview, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		WITH open AS (
+			SELECT symbol, COUNT(*) FILTER (WHERE type = 'buy') AS buys, COUNT(*) FILTER (WHERE type = 'sell') AS sells
+			FROM orders WHERE status = 'open'
+			GROUP BY symbol
+		), traded AS (
+			SELECT symbol, COUNT(*) AS trades, SUM(quantity) AS volume, SUM(price * quantity) AS notional
+			FROM trades WHERE executed_at > $1 AND symbol IS NOT NULL
+			GROUP BY symbol
+		)
+		SELECT COALESCE(o.symbol, t.symbol), COALESCE(o.buys, 0), COALESCE(o.sells, 0),
+			COALESCE(t.trades, 0), COALESCE(t.volume, 0), COALESCE(t.notional, 0)
+		FROM open o FULL JOIN traded t ON t.symbol = o.symbol
+		ORDER BY 1`,
+		since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market overviews: %w", err)
+	}
+	defer rows.Close()
+
+	markets := []models.MarketOverview{}
+	for rows.Next() {
+		var m models.MarketOverview
+		if err := rows.Scan(&m.Symbol, &m.OpenBuys, &m.OpenSells, &m.Trades, &m.Volume, &m.Notional); err != nil {
+			return nil, fmt.Errorf("failed to scan market overview: %w", err)
+		}
+		m.OpenOrders = m.OpenBuys + m.OpenSells
+		markets = append(markets, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating market overview rows: %w", err)
+	}
+	return markets, nil
+}
+
+// GetTopTraders returns the limit users who traded the most quote value in
+// the last 24 hours, most first, as of when the trader volume was last
+// refreshed. The time is zero if no one had traded.
+func (db *DB) GetTopTraders(ctx context.Context, limit int) ([]models.TraderVolume, time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		SELECT v.user_id, u.username, v.trades, v.volume, v.notional, v.as_of
+		FROM trader_volume_24h v JOIN users u ON u.id = v.user_id
+		ORDER BY v.notional DESC, v.user_id
+		LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get top traders: %w", err)
+	}
+	defer rows.Close()
+
+	traders := []models.TraderVolume{}
+	var asOf time.Time
+	for rows.Next() {
+		var t models.TraderVolume
+		if err := rows.Scan(&t.UserID, &t.Username, &t.Trades, &t.Volume, &t.Notional, &asOf); err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to scan trader volume: %w", err)
+		}
+		traders = append(traders, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("error iterating trader volume rows: %w", err)
+	}
+	return traders, asOf, nil
+}
+
+// RefreshTraderVolume recalculates each user's last 24 hours of trading
+// for GetTopTraders, without blocking readers
+func (db *DB) RefreshTraderVolume(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY trader_volume_24h"); err != nil {
+		return fmt.Errorf("failed to refresh trader volume: %w", err)
+	}
+	return nil
+}
@@ -2,70 +2,304 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/instruments"
 	"github.com/xtrntr/exchange/internal/models"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// orderColumns is the column list scanned by scanOrder
+const orderColumns = "id, user_id, symbol, type, price, quantity, status, created_at, tag, time_in_force, post_only, display_quantity, expires_at, COALESCE(client_order_id, ''), lifetime_ms"
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row pgx.Row, order *models.Order) error {
+	var lifetimeMS int64
+	if err := row.Scan(&order.ID, &order.UserID, &order.Symbol, &order.Type, &order.Price, &order.Quantity, &order.Status, &order.CreatedAt, &order.Tag, &order.TimeInForce, &order.PostOnly, &order.DisplayQuantity, &order.ExpiresAt, &order.ClientOrderID, &lifetimeMS); err != nil {
+		return err
+	}
+	order.Lifetime = time.Duration(lifetimeMS) * time.Millisecond
+	return nil
+}
+
+// tradeColumns is the column list scanned by scanTrade, for queries aliasing trades as "t"
+const tradeColumns = "t.id, t.buy_order_id, t.sell_order_id, t.price, t.quantity, t.executed_at, COALESCE(t.taker_side, ''), t.buy_fee, t.sell_fee"
+
+// scanTrade scans a row selected with tradeColumns, followed by any extra destinations
+func scanTrade(row pgx.Row, trade *models.Trade, extra ...interface{}) error {
+	dest := []interface{}{&trade.ID, &trade.BuyOrderID, &trade.SellOrderID, &trade.Price, &trade.Quantity, &trade.ExecutedAt, &trade.TakerSide, &trade.BuyFee, &trade.SellFee}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// ErrUsernameTaken is returned when a username is already registered, in any letter case
+var ErrUsernameTaken = errors.New("username already taken")
+
+// ErrDuplicateClientOrderID is returned when a client order ID is already
+// used by another of the user's orders
+var ErrDuplicateClientOrderID = errors.New("client order ID already used")
+
+// ErrOrderNotFound is returned when an order doesn't exist or belongs to another user
+var ErrOrderNotFound = errors.New("order not found or not owned by user")
+
+// ErrTradeRecorded is returned when recording a trade whose journal
+// reference has already been recorded
+var ErrTradeRecorded = errors.New("trade already recorded")
+
+// userColumns is the column list scanned by scanUser
+const userColumns = "id, username, password_hash, created_at, kyc_tier, COALESCE(merged_into, 0), role, suspended_at IS NOT NULL, service_account"
+
+// scanUser scans a row selected with userColumns
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.KYCTier, &user.MergedInto, &user.Role, &user.Suspended, &user.ServiceAccount)
+}
+
+// OrderNotOpenError is returned when an order has already reached a terminal state
+type OrderNotOpenError struct {
+	OrderID int
+	Status  string // Final status, "filled" or "canceled"
+}
+
+func (e *OrderNotOpenError) Error() string {
+	return fmt.Sprintf("order not open (status: %s)", e.Status)
+}
+
 // DB wraps a PostgreSQL connection pool
 type DB struct {
 	Pool *pgxpool.Pool
+
+	// Replica is a read replica of Pool's database that reads allowed to lag
+	// behind it are served from, taking them off the primary: GetBookOrders,
+	// GetRecentTrades, GetCandles, GetUserOrders, GetUserTrades and
+	// GetUserTradeHistory. Nil serves every read from Pool.
+	Replica *pgxpool.Pool
+
+	// Outbox is whether order events and trades are written to the outbox
+	// for streaming, in the same transaction as each change
+	Outbox bool
+
+	// Timeout bounds each operation, so a slow database can't hold up a
+	// request indefinitely; zero doesn't. Migrations, loading the book and
+	// trades on startup, and batch jobs over whole tables aren't bounded,
+	// as they take longer the more data there is.
+	Timeout time.Duration
 }
 
-// NewDB initializes a new database connection pool
+// reader returns the pool to serve reads that may lag from
+func (db *DB) reader() *pgxpool.Pool {
+	if db.Replica != nil {
+		return db.Replica
+	}
+	return db.Pool
+}
+
+// withTimeout bounds an operation by Timeout, if set
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.Timeout)
+}
+
+// NewDB initializes a new database connection pool with pgx's default
+// settings
 func NewDB(ctx context.Context, connString string) (*DB, error) {
-	pool, err := pgxpool.New(ctx, connString)
+	return NewDBWithPool(ctx, connString, config.DBPool{})
+}
+
+// NewDBWithPool initializes a new database connection pool with the given
+// settings. It waits for the database to accept a connection, retrying
+// transient errors with backoff, as it may still be starting.
+func NewDBWithPool(ctx context.Context, connString string, settings config.DBPool) (*DB, error) {
+	pool, err := newPool(ctx, connString, settings)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+		return nil, err
 	}
-
 	return &DB{Pool: pool}, nil
 }
 
-// Close closes the database connection pool
+// ConnectReplica connects to a read replica of the database, with the same
+// pool settings as the primary, and serves reads that may lag from it
+func (db *DB) ConnectReplica(ctx context.Context, connString string, settings config.DBPool) error {
+	pool, err := newPool(ctx, connString, settings)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	db.Replica = pool
+	return nil
+}
+
+// newPool creates a connection pool and waits for the database to accept a
+// connection
+func newPool(ctx context.Context, connString string, settings config.DBPool) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+	if settings.MaxConns > 0 {
+		poolConfig.MaxConns = settings.MaxConns
+	}
+	if settings.MinConns > 0 {
+		poolConfig.MinConns = settings.MinConns
+	}
+	if settings.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = settings.HealthCheckPeriod
+	}
+	if settings.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(settings.StatementTimeout.Milliseconds(), 10)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	if err := retry(ctx, func() error { return pool.Ping(ctx) }); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return pool, nil
+}
+
+// Close closes the database connection pools
 func (db *DB) Close(ctx context.Context) error {
 	db.Pool.Close()
+	if db.Replica != nil {
+		db.Replica.Close()
+	}
 	return nil
 }
 
 // CreateUser inserts a new user
 func (db *DB) CreateUser(ctx context.Context, username, passwordHash string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	user := &models.User{}
-	err := db.Pool.QueryRow(ctx,
-		"INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id, username, password_hash, created_at",
-		username, passwordHash).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	err := scanUser(db.Pool.QueryRow(ctx,
+		"INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING "+userColumns,
+		username, passwordHash), user)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return nil, ErrUsernameTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 	return user, nil
 }
 
-// GetUserByUsername retrieves a user by username
+// CreateServiceAccount inserts a service account. It has no password hash,
+// so no password can log in to it.
+func (db *DB) CreateServiceAccount(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	user := &models.User{}
+	err := scanUser(db.Pool.QueryRow(ctx,
+		"INSERT INTO users (username, password_hash, service_account) VALUES ($1, '', TRUE) RETURNING "+userColumns,
+		username), user)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+	return user, nil
+}
+
+// ReplacePasswordHash changes a user's password hash if it is still oldHash,
+// so a rehash can't overwrite a hash changed in the meantime
+func (db *DB) ReplacePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx,
+		"UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2",
+		userID, oldHash, newHash)
+	if err != nil {
+		return fmt.Errorf("failed to replace password hash: %w", err)
+	}
+	return nil
+}
+
+// GetUserByUsername retrieves a user by username, ignoring letter case
 func (db *DB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	user := &models.User{}
-	err := db.Pool.QueryRow(ctx,
-		"SELECT id, username, password_hash, created_at FROM users WHERE username = $1",
-		username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	err := retry(ctx, func() error {
+		return scanUser(db.Pool.QueryRow(ctx,
+			"SELECT "+userColumns+" FROM users WHERE LOWER(username) = LOWER($1)",
+			username), user)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return user, nil
 }
 
-// CreateOrder inserts a new order
-func (db *DB) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
-	// Validate order
+// GetUserByID retrieves a user by ID
+func (db *DB) GetUserByID(ctx context.Context, userID int) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	user := &models.User{}
+	err := retry(ctx, func() error {
+		return scanUser(db.Pool.QueryRow(ctx,
+			"SELECT "+userColumns+" FROM users WHERE id = $1",
+			userID), user)
+	})
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// ValidateOrder checks an order before it is created, filling in the default
+// symbol and time in force
+func ValidateOrder(order *models.Order) error {
 	if order.Type != "buy" && order.Type != "sell" {
-		return nil, fmt.Errorf("type must be 'buy' or 'sell'")
+		return fmt.Errorf("type must be 'buy' or 'sell'")
 	}
 	if order.Price <= 0 {
-		return nil, fmt.Errorf("price must be positive")
+		return fmt.Errorf("price must be positive")
 	}
 	if order.Quantity <= 0 {
-		return nil, fmt.Errorf("quantity must be positive")
+		return fmt.Errorf("quantity must be positive")
+	}
+	if order.Symbol == "" {
+		order.Symbol = instruments.DefaultSymbol
+	}
+	if len(order.Tag) > 64 {
+		return fmt.Errorf("tag too long (max 64 characters)")
+	}
+	if order.TimeInForce == "" {
+		order.TimeInForce = "GTC"
+	}
+	return nil
+}
+
+// CreateOrder inserts a new order
+func (db *DB) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if err := ValidateOrder(order); err != nil {
+		return nil, err
 	}
 
 	// Verify user exists
@@ -78,31 +312,85 @@ func (db *DB) CreateOrder(ctx context.Context, order *models.Order) (*models.Ord
 		return nil, fmt.Errorf("user not found")
 	}
 
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	newOrder := &models.Order{}
-	err = db.Pool.QueryRow(ctx,
-		"INSERT INTO orders (user_id, type, price, quantity, status) VALUES ($1, $2, $3, $4, $5) RETURNING id, user_id, type, price, quantity, status, created_at",
-		order.UserID, order.Type, order.Price, order.Quantity, order.Status).Scan(
-		&newOrder.ID, &newOrder.UserID, &newOrder.Type, &newOrder.Price, &newOrder.Quantity, &newOrder.Status, &newOrder.CreatedAt)
+	err = scanOrder(tx.QueryRow(ctx,
+		"INSERT INTO orders (user_id, symbol, type, price, quantity, status, tag, time_in_force, post_only, display_quantity, expires_at, client_order_id, lifetime_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13) RETURNING "+orderColumns,
+		order.UserID, order.Symbol, order.Type, order.Price, order.Quantity, order.Status, order.Tag, order.TimeInForce, order.PostOnly, order.DisplayQuantity, order.ExpiresAt, order.ClientOrderID, order.Lifetime.Milliseconds()), newOrder)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return nil, ErrDuplicateClientOrderID
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
+	if err := audit(ctx, tx, "order.created", "order", []int{newOrder.ID}, nil, newOrder); err != nil {
+		return nil, err
+	}
+	if err := db.queueOrderEvents(ctx, tx, "accepted", []int{newOrder.ID}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return newOrder, nil
 }
 
-// UpdateOrderStatus updates an order's status
+// UpdateOrderStatus updates an order's status. Setting the status it
+// already has, e.g. when replaying the journal, changes nothing.
 func (db *DB) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
-	_, err := db.Pool.Exec(ctx, "UPDATE orders SET status = $1 WHERE id = $2", status, orderID)
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row so the previous status is the one replaced
+	var previous string
+	err = tx.QueryRow(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&previous)
+	if err == pgx.ErrNoRows || previous == status {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE orders SET status = $1 WHERE id = $2", status, orderID); err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
+	err = audit(ctx, tx, "order."+status, "order", []int{orderID},
+		map[string]interface{}{"status": previous}, map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+	if err := db.queueOrderEvents(ctx, tx, status, []int{orderID}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-// GetUserOrders retrieves all orders for a user
-func (db *DB) GetUserOrders(ctx context.Context, userID int) ([]models.Order, error) {
-	rows, err := db.Pool.Query(ctx,
-		"SELECT id, user_id, type, price, quantity, status, created_at FROM orders WHERE user_id = $1",
-		userID)
+// GetUserOrders retrieves a page of a user's orders matching the filter
+func (db *DB) GetUserOrders(ctx context.Context, userID int, filter OrderFilter, page Page) ([]models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := filter.appendWhere("SELECT "+orderColumns+" FROM orders WHERE user_id = $1", []interface{}{userID})
+	query, args = page.appendTo(query, args, orderSortColumns)
+
+	rows, err := db.reader().Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user orders: %w", err)
 	}
@@ -111,7 +399,7 @@ func (db *DB) GetUserOrders(ctx context.Context, userID int) ([]models.Order, er
 	var orders []models.Order
 	for rows.Next() {
 		var order models.Order
-		if err := rows.Scan(&order.ID, &order.UserID, &order.Type, &order.Price, &order.Quantity, &order.Status, &order.CreatedAt); err != nil {
+		if err := scanOrder(rows, &order); err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
 		orders = append(orders, order)
@@ -119,26 +407,225 @@ func (db *DB) GetUserOrders(ctx context.Context, userID int) ([]models.Order, er
 	return orders, nil
 }
 
-// CreateTrade inserts a new trade
+// GetOrder retrieves one of the user's orders
+func (db *DB) GetOrder(ctx context.Context, orderID, userID int) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	order := &models.Order{}
+	err := scanOrder(db.Pool.QueryRow(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1 AND user_id = $2",
+		orderID, userID), order)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return order, nil
+}
+
+// GetOrderByClientID retrieves the user's order with a client order ID
+func (db *DB) GetOrderByClientID(ctx context.Context, userID int, clientOrderID string) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	order := &models.Order{}
+	err := scanOrder(db.Pool.QueryRow(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE user_id = $1 AND client_order_id = $2",
+		userID, clientOrderID), order)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return order, nil
+}
+
+// GetOrderByID retrieves an order regardless of its owner
+func (db *DB) GetOrderByID(ctx context.Context, orderID int) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	order := &models.Order{}
+	err := scanOrder(db.Pool.QueryRow(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1",
+		orderID), order)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return order, nil
+}
+
+// GetFilledQuantities returns the quantity traded so far by each of the
+// given orders. Orders without trades are omitted.
+func (db *DB) GetFilledQuantities(ctx context.Context, orderIDs []int) (map[int]float64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getFilledQuantities(ctx, db.Pool, orderIDs)
+}
+
+func getFilledQuantities(ctx context.Context, q querier, orderIDs []int) (map[int]float64, error) {
+	rows, err := q.Query(ctx, `
+		SELECT order_id, SUM(quantity) FROM (
+			SELECT buy_order_id AS order_id, quantity FROM trades WHERE buy_order_id = ANY($1)
+			UNION ALL
+			SELECT sell_order_id AS order_id, quantity FROM trades WHERE sell_order_id = ANY($1)
+		) fills GROUP BY order_id`, orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filled quantities: %w", err)
+	}
+	defer rows.Close()
+
+	filled := make(map[int]float64)
+	for rows.Next() {
+		var orderID int
+		var quantity float64
+		if err := rows.Scan(&orderID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan filled quantity: %w", err)
+		}
+		filled[orderID] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating filled quantity rows: %w", err)
+	}
+	return filled, nil
+}
+
+// GetFilledNotionals returns the quote value, price × quantity summed over
+// the fills, traded so far by each of the given orders. Orders without
+// trades are omitted.
+func (db *DB) GetFilledNotionals(ctx context.Context, orderIDs []int) (map[int]float64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT order_id, SUM(price * quantity) FROM (
+			SELECT buy_order_id AS order_id, price, quantity FROM trades WHERE buy_order_id = ANY($1)
+			UNION ALL
+			SELECT sell_order_id AS order_id, price, quantity FROM trades WHERE sell_order_id = ANY($1)
+		) fills GROUP BY order_id`, orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filled notionals: %w", err)
+	}
+	defer rows.Close()
+
+	notionals := make(map[int]float64)
+	for rows.Next() {
+		var orderID int
+		var notional float64
+		if err := rows.Scan(&orderID, &notional); err != nil {
+			return nil, fmt.Errorf("failed to scan filled notional: %w", err)
+		}
+		notionals[orderID] = notional
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating filled notional rows: %w", err)
+	}
+	return notionals, nil
+}
+
+// CreateTrade inserts a new trade, recording the users on each side and the
+// symbol from its orders, and posts it to the ledger
 func (db *DB) CreateTrade(ctx context.Context, trade *models.Trade) (*models.Trade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Journal references can't be unique across the partitions of trades,
+	// so recording each one is serialized instead
+	if trade.JournalRef != "" {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", trade.JournalRef); err != nil {
+			return nil, fmt.Errorf("failed to lock journal reference: %w", err)
+		}
+		var recorded bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM trades WHERE journal_ref = $1)", trade.JournalRef).Scan(&recorded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check trade: %w", err)
+		}
+		if recorded {
+			return nil, ErrTradeRecorded
+		}
+	}
+
 	newTrade := &models.Trade{}
-	err := db.Pool.QueryRow(ctx,
-		"INSERT INTO trades (buy_order_id, sell_order_id, price, quantity) VALUES ($1, $2, $3, $4) RETURNING id, buy_order_id, sell_order_id, price, quantity, executed_at",
-		trade.BuyOrderID, trade.SellOrderID, trade.Price, trade.Quantity).Scan(
-		&newTrade.ID, &newTrade.BuyOrderID, &newTrade.SellOrderID, &newTrade.Price, &newTrade.Quantity, &newTrade.ExecutedAt)
+	var symbol string
+	err = scanTrade(tx.QueryRow(ctx, `
+		INSERT INTO trades AS t (buy_order_id, sell_order_id, price, quantity, taker_side, buy_fee, sell_fee, journal_ref,
+			buyer_user_id, seller_user_id, symbol)
+		SELECT b.id, s.id, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, ''), b.user_id, s.user_id, b.symbol
+		FROM orders b, orders s WHERE b.id = $1 AND s.id = $2
+		RETURNING `+tradeColumns+", t.buyer_user_id, t.seller_user_id, t.symbol",
+		trade.BuyOrderID, trade.SellOrderID, trade.Price, trade.Quantity, trade.TakerSide, trade.BuyFee, trade.SellFee, trade.JournalRef),
+		newTrade, &newTrade.BuyUserID, &newTrade.SellUserID, &symbol)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create trade: %w", err)
 	}
+
+	if err := postTrade(ctx, tx, newTrade, symbol); err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, tx, "trade.executed", "trade", []int{newTrade.ID}, nil, newTrade); err != nil {
+		return nil, err
+	}
+	if err := db.queueTrade(ctx, tx, *newTrade); err != nil {
+		return nil, err
+	}
+	if err := queuePartialFillDeliveries(ctx, tx, newTrade); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return newTrade, nil
 }
 
-// GetUserTrades retrieves all trades for a user
-func (db *DB) GetUserTrades(ctx context.Context, userID int) ([]models.Trade, error) {
-	rows, err := db.Pool.Query(ctx,
-		"SELECT t.id, t.buy_order_id, t.sell_order_id, t.price, t.quantity, t.executed_at "+
-			"FROM trades t JOIN orders o ON t.buy_order_id = o.id OR t.sell_order_id = o.id "+
-			"WHERE o.user_id = $1",
-		userID)
+// TradeRecorded reports whether a trade with the given journal reference
+// has been recorded
+func (db *DB) TradeRecorded(ctx context.Context, journalRef string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var recorded bool
+	err := db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM trades WHERE journal_ref = $1)", journalRef).Scan(&recorded)
+	if err != nil {
+		return false, fmt.Errorf("failed to check trade: %w", err)
+	}
+	return recorded, nil
+}
+
+// userTradesFrom selects the trades of user $1 found by the user columns of
+// trades, joined to the user's order on each side they were on as "o". A
+// self-trade is joined to both of its orders.
+const userTradesFrom = `
+	FROM trades t
+	CROSS JOIN LATERAL (VALUES (t.buy_order_id, t.buyer_user_id), (t.sell_order_id, t.seller_user_id)) AS side (order_id, user_id)
+	JOIN orders o ON o.id = side.order_id
+	WHERE (t.buyer_user_id = $1 OR t.seller_user_id = $1) AND side.user_id = $1`
+
+// GetUserTrades retrieves a page of a user's trades matching the filter
+func (db *DB) GetUserTrades(ctx context.Context, userID int, filter TradeFilter, page Page) ([]models.Trade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := filter.appendWhere("SELECT "+tradeColumns+", o.tag, o.type"+userTradesFrom, []interface{}{userID})
+	query, args = page.appendTo(query, args, tradeSortColumns)
+
+	rows, err := db.reader().Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user trades: %w", err)
 	}
@@ -147,16 +634,57 @@ func (db *DB) GetUserTrades(ctx context.Context, userID int) ([]models.Trade, er
 	var trades []models.Trade
 	for rows.Next() {
 		var trade models.Trade
-		if err := rows.Scan(&trade.ID, &trade.BuyOrderID, &trade.SellOrderID, &trade.Price, &trade.Quantity, &trade.ExecutedAt); err != nil {
+		if err := scanTrade(rows, &trade, &trade.Tag, &trade.Side); err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// GetUserTradeHistory retrieves a page of a user's trades matching the
+// filter, each with the user's side, role and fee. A self-trade is listed
+// once for each side.
+func (db *DB) GetUserTradeHistory(ctx context.Context, userID int, filter TradeFilter, page Page) ([]models.UserTrade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := filter.appendWhere(`
+		SELECT t.id, o.id, o.symbol, o.type,
+			CASE WHEN o.type = t.taker_side THEN 'taker' ELSE 'maker' END,
+			t.price, t.quantity,
+			CASE WHEN o.id = t.buy_order_id THEN t.buy_fee ELSE t.sell_fee END,
+			o.tag, t.executed_at`+userTradesFrom, []interface{}{userID})
+	query, args = page.appendTo(query, args, tradeSortColumns)
+
+	rows, err := db.reader().Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user trade history: %w", err)
+	}
+	defer rows.Close()
+
+	trades := []models.UserTrade{}
+	for rows.Next() {
+		var trade models.UserTrade
+		if err := rows.Scan(&trade.ID, &trade.OrderID, &trade.Symbol, &trade.Side, &trade.Role,
+			&trade.Price, &trade.Quantity, &trade.Fee, &trade.Tag, &trade.ExecutedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan trade: %w", err)
 		}
 		trades = append(trades, trade)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trade rows: %w", err)
+	}
 	return trades, nil
 }
 
-// CancelOrder cancels an order if it belongs to the user and is open
+// CancelOrder cancels an order if it belongs to the user and is open.
+// Returns ErrOrderNotFound for unknown orders and an *OrderNotOpenError
+// carrying the final status for orders that are already filled or canceled.
 func (db *DB) CancelOrder(ctx context.Context, orderID, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -170,13 +698,13 @@ func (db *DB) CancelOrder(ctx context.Context, orderID, userID int) error {
 		orderID, userID).Scan(&status)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return fmt.Errorf("order not found or not owned by user")
+			return ErrOrderNotFound
 		}
 		return fmt.Errorf("failed to get order: %w", err)
 	}
 
 	if status != "open" {
-		return fmt.Errorf("order not open")
+		return &OrderNotOpenError{OrderID: orderID, Status: status}
 	}
 
 	tag, err := tx.Exec(ctx,
@@ -189,6 +717,12 @@ func (db *DB) CancelOrder(ctx context.Context, orderID, userID int) error {
 	if tag.RowsAffected() == 0 {
 		return fmt.Errorf("order not found, not owned by user, or not open")
 	}
+	if err := audit(ctx, tx, "order.canceled", "order", []int{orderID}, openState, canceledState); err != nil {
+		return err
+	}
+	if err := db.queueOrderEvents(ctx, tx, "canceled", []int{orderID}); err != nil {
+		return err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -197,47 +731,224 @@ func (db *DB) CancelOrder(ctx context.Context, orderID, userID int) error {
 	return nil
 }
 
-// GetOpenOrders retrieves all open orders from the database
-func (db *DB) GetOpenOrders(ctx context.Context) ([]models.Order, error) {
-	rows, err := db.Pool.Query(ctx, `
-		SELECT id, user_id, type, price, quantity, status, created_at
-		FROM orders
-		WHERE status = 'open'
-		ORDER BY created_at ASC
-	`)
+// CancelOrders cancels every open order of the user matching the filter in a
+// single statement and returns the IDs of the canceled orders
+func (db *DB) CancelOrders(ctx context.Context, userID int, filter OrderFilter) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query, args := filter.appendWhere("UPDATE orders SET status = 'canceled' WHERE user_id = $1 AND status = 'open'", []interface{}{userID})
+	orderIDs, err := cancelOrders(ctx, tx, "order.canceled", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.queueOrderEvents(ctx, tx, "canceled", orderIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return orderIDs, nil
+}
+
+// ExpireOrders cancels every open GTD order that has expired by now and
+// returns the IDs of the canceled orders
+func (db *DB) ExpireOrders(ctx context.Context, now time.Time) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	orderIDs, err := cancelOrders(ctx, tx, "order.expired", "UPDATE orders SET status = 'canceled' WHERE status = 'open' AND expires_at <= $1", now)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.queueOrderEvents(WithCancelReason(ctx, "expired"), tx, "canceled", orderIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return orderIDs, nil
+}
+
+// cancelOrders runs an update canceling open orders, records the
+// cancellations in the audit log as action and returns their IDs
+func cancelOrders(ctx context.Context, tx pgx.Tx, action, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(ctx, query+" RETURNING id", args...)
 	if err != nil {
+		return nil, fmt.Errorf("failed to cancel orders: %w", err)
+	}
+
+	orderIDs := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan order id: %w", err)
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to cancel orders: %w", err)
+	}
+
+	if err := audit(ctx, tx, action, "order", orderIDs, openState, canceledState); err != nil {
 		return nil, err
 	}
+	return orderIDs, nil
+}
+
+// openOrdersBatch is how many open orders GetOpenOrders reads per query
+const openOrdersBatch = 1000
+
+// GetOpenOrders retrieves all open orders from the database, by symbol and
+// then in price-time order. They are read in batches, each continuing from
+// the last order of the one before along the book index, so no query holds
+// the whole book.
+func (db *DB) GetOpenOrders(ctx context.Context) ([]models.Order, error) {
+	return db.getOpenOrders(ctx, db.Pool)
+}
+
+// GetBookOrders retrieves all open orders like GetOpenOrders, but from the
+// replica if there is one, for displaying the book rather than rebuilding it
+func (db *DB) GetBookOrders(ctx context.Context) ([]models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.getOpenOrders(ctx, db.reader())
+}
+
+// getOpenOrders reads every open order from a pool in batches
+func (db *DB) getOpenOrders(ctx context.Context, pool *pgxpool.Pool) ([]models.Order, error) {
+	var orders []models.Order
+	for {
+		batch, err := db.getOpenOrdersBatch(ctx, pool, orders)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, batch...)
+		if len(batch) < openOrdersBatch {
+			return orders, nil
+		}
+	}
+}
+
+// getOpenOrdersBatch reads the batch of open orders after the last of those
+// read
+func (db *DB) getOpenOrdersBatch(ctx context.Context, pool *pgxpool.Pool, read []models.Order) ([]models.Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders WHERE status = 'open'"
+	args := []interface{}{openOrdersBatch}
+	if len(read) > 0 {
+		last := read[len(read)-1]
+		query += " AND (symbol, price, created_at, id) > ($2::varchar, $3::numeric, $4::timestamp, $5::integer)"
+		args = append(args, last.Symbol, last.Price, last.CreatedAt, last.ID)
+	}
+	rows, err := pool.Query(ctx, query+" ORDER BY symbol, price, created_at, id LIMIT $1", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open orders: %w", err)
+	}
 	defer rows.Close()
 
 	var orders []models.Order
 	for rows.Next() {
 		var order models.Order
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Type,
-			&order.Price,
-			&order.Quantity,
-			&order.Status,
-			&order.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
 		orders = append(orders, order)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order rows: %w", err)
+	}
+	return orders, nil
+}
+
+// GetOrdersByIDs retrieves the given orders regardless of owner, oldest
+// first. Unknown IDs are ignored.
+func (db *DB) GetOrdersByIDs(ctx context.Context, orderIDs []int) ([]models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = ANY($1) ORDER BY created_at ASC",
+		orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order rows: %w", err)
+	}
+	return orders, nil
+}
+
+// GetOpenOrdersAfter retrieves open orders with IDs above the given one,
+// oldest first
+func (db *DB) GetOpenOrdersAfter(ctx context.Context, orderID int) ([]models.Order, error) {
+	rows, err := db.Pool.Query(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE status = 'open' AND id > $1 ORDER BY created_at ASC",
+		orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
 	}
+	defer rows.Close()
 
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order rows: %w", err)
+	}
 	return orders, nil
 }
 
+// GetLastOrderID returns the highest order ID, or zero if there are no orders
+func (db *DB) GetLastOrderID(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var orderID int
+	if err := db.Pool.QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM orders").Scan(&orderID); err != nil {
+		return 0, fmt.Errorf("failed to get last order ID: %w", err)
+	}
+	return orderID, nil
+}
+
 // GetAllTrades retrieves all trades from the database
 func (db *DB) GetAllTrades(ctx context.Context) ([]models.Trade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	rows, err := db.Pool.Query(ctx,
-		"SELECT id, buy_order_id, sell_order_id, price, quantity, executed_at FROM trades ORDER BY executed_at DESC")
+		"SELECT "+tradeColumns+" FROM trades t ORDER BY t.executed_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all trades: %w", err)
 	}
@@ -246,7 +957,7 @@ func (db *DB) GetAllTrades(ctx context.Context) ([]models.Trade, error) {
 	var trades []models.Trade
 	for rows.Next() {
 		var trade models.Trade
-		if err := rows.Scan(&trade.ID, &trade.BuyOrderID, &trade.SellOrderID, &trade.Price, &trade.Quantity, &trade.ExecutedAt); err != nil {
+		if err := scanTrade(rows, &trade); err != nil {
 			return nil, fmt.Errorf("failed to scan trade: %w", err)
 		}
 		trades = append(trades, trade)
@@ -258,3 +969,339 @@ func (db *DB) GetAllTrades(ctx context.Context) ([]models.Trade, error) {
 
 	return trades, nil
 }
+
+// GetRecentTrades retrieves up to limit trades in a symbol, newest first,
+// with IDs below beforeID unless it is zero
+func (db *DB) GetRecentTrades(ctx context.Context, symbol string, beforeID, limit int) ([]models.PublicTrade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		SELECT t.id, t.symbol, t.price, t.quantity, COALESCE(t.taker_side, ''), t.executed_at
+		FROM trades t
+		WHERE t.symbol = $1 AND ($2::integer = 0 OR t.id < $2)
+		ORDER BY t.id DESC
+		LIMIT $3`, symbol, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades := []models.PublicTrade{}
+	for rows.Next() {
+		var trade models.PublicTrade
+		if err := rows.Scan(&trade.ID, &trade.Symbol, &trade.Price, &trade.Quantity, &trade.TakerSide, &trade.ExecutedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trades rows: %w", err)
+	}
+	return trades, nil
+}
+
+// AmendOrder updates the price and/or quantity of an open order owned by the user.
+// A zero price or quantity leaves that field unchanged.
+func (db *DB) AmendOrder(ctx context.Context, orderID, userID int, price, quantity float64) (*models.Order, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if price < 0 {
+		return nil, fmt.Errorf("price must be positive")
+	}
+	if quantity < 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row for update to prevent racing with cancels and fills
+	order := &models.Order{}
+	err = scanOrder(tx.QueryRow(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		orderID, userID), order)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("order not found or not owned by user")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.Status != "open" {
+		return nil, fmt.Errorf("order not open")
+	}
+
+	// The quantity is the order's total, so it can't drop to what's
+	// already filled
+	if quantity > 0 {
+		filled, err := getFilledQuantities(ctx, tx, []int{orderID})
+		if err != nil {
+			return nil, err
+		}
+		if quantity <= filled[orderID] {
+			return nil, fmt.Errorf("quantity must be above the %g already filled", filled[orderID])
+		}
+	}
+
+	before := map[string]interface{}{"price": order.Price, "quantity": order.Quantity}
+	if price > 0 {
+		order.Price = price
+	}
+	if quantity > 0 {
+		order.Quantity = quantity
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE orders SET price = $1, quantity = $2 WHERE id = $3",
+		order.Price, order.Quantity, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to amend order: %w", err)
+	}
+	after := map[string]interface{}{"price": order.Price, "quantity": order.Quantity}
+	if err := audit(ctx, tx, "order.amended", "order", []int{orderID}, before, after); err != nil {
+		return nil, err
+	}
+	if err := db.queueOrderEvents(ctx, tx, "amended", []int{orderID}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return order, nil
+}
+
+// GetTradesSince retrieves trades executed after the given time, oldest first
+func (db *DB) GetTradesSince(ctx context.Context, since time.Time) ([]models.Trade, error) {
+	rows, err := db.Pool.Query(ctx,
+		"SELECT "+tradeColumns+" FROM trades t WHERE t.executed_at > $1 ORDER BY t.executed_at ASC, t.id ASC",
+		since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []models.Trade
+	for rows.Next() {
+		var trade models.Trade
+		if err := scanTrade(rows, &trade); err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trades = append(trades, trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trades rows: %w", err)
+	}
+	return trades, nil
+}
+
+// GetLastTrade retrieves the most recent trade, or nil if there are none
+func (db *DB) GetLastTrade(ctx context.Context) (*models.Trade, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	trade := &models.Trade{}
+	err := scanTrade(db.Pool.QueryRow(ctx,
+		"SELECT "+tradeColumns+" FROM trades t ORDER BY t.executed_at DESC, t.id DESC LIMIT 1"), trade)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last trade: %w", err)
+	}
+	return trade, nil
+}
+
+// UserFill is one side of a trade attributed to the order's owner
+type UserFill struct {
+	UserID     int
+	Notional   float64 // Price times quantity
+	ExecutedAt time.Time
+}
+
+// GetUserFillsSince retrieves each user's fills executed after the given time, oldest first
+func (db *DB) GetUserFillsSince(ctx context.Context, since time.Time) ([]UserFill, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT DISTINCT o.user_id, t.id, t.price * t.quantity, t.executed_at "+
+			"FROM trades t JOIN orders o ON t.buy_order_id = o.id OR t.sell_order_id = o.id "+
+			"WHERE t.executed_at > $1 ORDER BY t.executed_at ASC, t.id ASC",
+		since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user fills: %w", err)
+	}
+	defer rows.Close()
+
+	var fills []UserFill
+	for rows.Next() {
+		var fill UserFill
+		var tradeID int
+		if err := rows.Scan(&fill.UserID, &tradeID, &fill.Notional, &fill.ExecutedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan fill: %w", err)
+		}
+		fills = append(fills, fill)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fill rows: %w", err)
+	}
+	return fills, nil
+}
+
+// GetUserVolume sums the user's fills executed after since by instrument and
+// role, in symbol order. An empty symbol includes every instrument.
+func (db *DB) GetUserVolume(ctx context.Context, userID int, symbol string, since time.Time) ([]models.VolumeBreakdown, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT o.symbol, o.type = t.taker_side, COUNT(*), SUM(t.quantity), SUM(t.price * t.quantity)`+userTradesFrom+`
+		AND ($2 = '' OR t.symbol = $2) AND t.executed_at > $3
+		GROUP BY 1, 2
+		ORDER BY 1`, userID, symbol, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user volume: %w", err)
+	}
+	defer rows.Close()
+
+	breakdowns := []models.VolumeBreakdown{}
+	for rows.Next() {
+		var sym string
+		var taker bool
+		var volume models.Volume
+		if err := rows.Scan(&sym, &taker, &volume.Trades, &volume.Quantity, &volume.Notional); err != nil {
+			return nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		if len(breakdowns) == 0 || breakdowns[len(breakdowns)-1].Symbol != sym {
+			breakdowns = append(breakdowns, models.VolumeBreakdown{Symbol: sym})
+		}
+		breakdown := &breakdowns[len(breakdowns)-1]
+		if taker {
+			breakdown.Taker = volume
+		} else {
+			breakdown.Maker = volume
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating volume rows: %w", err)
+	}
+
+	for i := range breakdowns {
+		if total := breakdowns[i].Maker.Notional + breakdowns[i].Taker.Notional; total > 0 {
+			breakdowns[i].MakerShare = breakdowns[i].Maker.Notional / total
+		}
+	}
+	return breakdowns, nil
+}
+
+// userFillsQuery selects the fills of user $1 with trade IDs from $2
+// onwards; append userFillsOrder to list them oldest first
+const userFillsQuery = `
+	SELECT t.id, o.id, o.symbol, o.type,
+		CASE WHEN o.type = t.taker_side THEN 'taker' ELSE 'maker' END,
+		t.price, t.quantity,
+		CASE WHEN o.id = t.buy_order_id THEN t.buy_fee ELSE t.sell_fee END,
+		o.tag, t.executed_at` + userTradesFrom + `
+	AND t.id >= $2`
+
+const userFillsOrder = `
+	ORDER BY t.id ASC, o.id ASC`
+
+// GetUserFills retrieves the user's fills of up to limit trades with IDs
+// from fromID onwards, oldest first. A self-trade yields a fill for each
+// side; the limit counts trades, so both are on the same page.
+func (db *DB) GetUserFills(ctx context.Context, userID, fromID, limit int) ([]models.Fill, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.queryFills(ctx, userFillsQuery+`
+		AND t.id IN (
+			SELECT id FROM trades
+			WHERE (buyer_user_id = $1 OR seller_user_id = $1) AND id >= $2
+			ORDER BY id LIMIT $3)`+userFillsOrder, userID, fromID, limit)
+}
+
+// GetAllUserFills retrieves every fill of the user, oldest first
+func (db *DB) GetAllUserFills(ctx context.Context, userID int) ([]models.Fill, error) {
+	return db.queryFills(ctx, userFillsQuery+userFillsOrder, userID, 0)
+}
+
+// GetOrderFills retrieves the fills of one of the user's orders, oldest first
+func (db *DB) GetOrderFills(ctx context.Context, orderID, userID int) ([]models.Fill, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.queryFills(ctx, `
+		SELECT t.id, o.id, o.symbol, o.type,
+			CASE WHEN o.type = t.taker_side THEN 'taker' ELSE 'maker' END,
+			t.price, t.quantity,
+			CASE WHEN o.id = t.buy_order_id THEN t.buy_fee ELSE t.sell_fee END,
+			o.tag, t.executed_at`+userTradesFrom+`
+		AND o.id = $2
+		ORDER BY t.id ASC`, userID, orderID)
+}
+
+func (db *DB) queryFills(ctx context.Context, query string, args ...interface{}) ([]models.Fill, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user fills: %w", err)
+	}
+	defer rows.Close()
+
+	var fills []models.Fill
+	for rows.Next() {
+		var fill models.Fill
+		if err := rows.Scan(&fill.TradeID, &fill.OrderID, &fill.Symbol, &fill.Side, &fill.Role,
+			&fill.Price, &fill.Quantity, &fill.Fee, &fill.Tag, &fill.ExecutedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan fill: %w", err)
+		}
+		fills = append(fills, fill)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fill rows: %w", err)
+	}
+	return fills, nil
+}
+
+// GetOrderExposure returns the unfilled quantity and notional of the user's
+// open orders on each side of each instrument
+func (db *DB) GetOrderExposure(ctx context.Context, userID int) ([]models.OrderExposure, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT o.symbol, o.type, COUNT(*),
+			SUM(o.quantity - COALESCE(f.filled, 0)),
+			SUM(o.price * (o.quantity - COALESCE(f.filled, 0)))
+		FROM orders o
+		LEFT JOIN LATERAL (
+			SELECT SUM(quantity) AS filled FROM trades WHERE buy_order_id = o.id OR sell_order_id = o.id
+		) f ON TRUE
+		WHERE o.user_id = $1 AND o.status = 'open'
+		GROUP BY o.symbol, o.type
+		ORDER BY o.symbol, o.type`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order exposure: %w", err)
+	}
+	defer rows.Close()
+
+	exposures := []models.OrderExposure{}
+	for rows.Next() {
+		var e models.OrderExposure
+		if err := rows.Scan(&e.Symbol, &e.Side, &e.Orders, &e.Quantity, &e.Notional); err != nil {
+			return nil, fmt.Errorf("failed to scan order exposure: %w", err)
+		}
+		exposures = append(exposures, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order exposure rows: %w", err)
+	}
+	return exposures, nil
+}
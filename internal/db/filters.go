@@ -0,0 +1,311 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// DefaultPageLimit is the page size used when none is requested
+const DefaultPageLimit = 100
+
+// MaxPageLimit caps the page size a client can request
+const MaxPageLimit = 1000
+
+// OrderFilter narrows the orders selected by GetUserOrders and CancelOrders;
+// zero values match everything
+type OrderFilter struct {
+	Tag      string
+	Symbol   string
+	Type     string    // "buy" or "sell"
+	Status   string    // "open", "filled" or "canceled"
+	MinPrice float64   // Inclusive
+	MaxPrice float64   // Inclusive
+	Since    time.Time // Created at or after, inclusive
+	Until    time.Time // Created before, exclusive
+}
+
+// IsEmpty reports whether the filter matches every order
+func (f OrderFilter) IsEmpty() bool {
+	return f == OrderFilter{}
+}
+
+// Matches reports whether an order meets the filter's conditions
+func (f OrderFilter) Matches(order models.Order) bool {
+	return (f.Tag == "" || order.Tag == f.Tag) &&
+		(f.Symbol == "" || order.Symbol == f.Symbol) &&
+		(f.Type == "" || order.Type == f.Type) &&
+		(f.Status == "" || order.Status == f.Status) &&
+		(f.MinPrice <= 0 || order.Price >= f.MinPrice) &&
+		(f.MaxPrice <= 0 || order.Price <= f.MaxPrice) &&
+		(f.Since.IsZero() || !order.CreatedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || order.CreatedAt.Before(f.Until))
+}
+
+// appendWhere adds the filter's conditions to a query whose arguments are args
+func (f OrderFilter) appendWhere(query string, args []interface{}) (string, []interface{}) {
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		query += fmt.Sprintf(" AND tag = $%d", len(args))
+	}
+	if f.Symbol != "" {
+		args = append(args, f.Symbol)
+		query += fmt.Sprintf(" AND symbol = $%d", len(args))
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		query += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if f.MinPrice > 0 {
+		args = append(args, f.MinPrice)
+		query += fmt.Sprintf(" AND price >= $%d", len(args))
+	}
+	if f.MaxPrice > 0 {
+		args = append(args, f.MaxPrice)
+		query += fmt.Sprintf(" AND price <= $%d", len(args))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return query, args
+}
+
+// TradeFilter narrows the trades returned by GetUserTrades; zero values match
+// everything. Tag, Symbol and Type apply to the user's side of the trade.
+type TradeFilter struct {
+	Tag     string
+	Symbol  string
+	Type    string    // "buy" or "sell"
+	Since   time.Time // Executed at or after, inclusive
+	Until   time.Time // Executed before, exclusive
+	SinceID int       // Trade IDs after this, exclusive; 0 doesn't filter
+}
+
+// Matches reports whether a trade, filling the user's order, meets the
+// filter's conditions
+func (f TradeFilter) Matches(order models.Order, trade models.Trade) bool {
+	return (f.Tag == "" || order.Tag == f.Tag) &&
+		(f.Symbol == "" || order.Symbol == f.Symbol) &&
+		(f.Type == "" || order.Type == f.Type) &&
+		(f.Since.IsZero() || !trade.ExecutedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || trade.ExecutedAt.Before(f.Until)) &&
+		trade.ID > f.SinceID
+}
+
+// appendWhere adds the filter's conditions to a trades query joined to the
+// user's orders as "o"
+func (f TradeFilter) appendWhere(query string, args []interface{}) (string, []interface{}) {
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		query += fmt.Sprintf(" AND o.tag = $%d", len(args))
+	}
+	if f.Symbol != "" {
+		args = append(args, f.Symbol)
+		query += fmt.Sprintf(" AND o.symbol = $%d", len(args))
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		query += fmt.Sprintf(" AND o.type = $%d", len(args))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		query += fmt.Sprintf(" AND t.executed_at >= $%d", len(args))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until)
+		query += fmt.Sprintf(" AND t.executed_at < $%d", len(args))
+	}
+	if f.SinceID > 0 {
+		args = append(args, f.SinceID)
+		query += fmt.Sprintf(" AND t.id > $%d", len(args))
+	}
+	return query, args
+}
+
+// AuditFilter narrows the entries returned by GetAuditLog; zero values match
+// everything
+type AuditFilter struct {
+	EntityType string // "order" or "trade"
+	EntityID   int
+	ActorID    int
+	Action     string
+	Since      time.Time // Recorded at or after, inclusive
+	Until      time.Time // Recorded before, exclusive
+}
+
+// appendWhere adds the filter's conditions to a query whose arguments are args
+func (f AuditFilter) appendWhere(query string, args []interface{}) (string, []interface{}) {
+	if f.EntityType != "" {
+		args = append(args, f.EntityType)
+		query += fmt.Sprintf(" AND entity_type = $%d", len(args))
+	}
+	if f.EntityID != 0 {
+		args = append(args, f.EntityID)
+		query += fmt.Sprintf(" AND entity_id = $%d", len(args))
+	}
+	if f.ActorID != 0 {
+		args = append(args, f.ActorID)
+		query += fmt.Sprintf(" AND actor_id = $%d", len(args))
+	}
+	if f.Action != "" {
+		args = append(args, f.Action)
+		query += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return query, args
+}
+
+// TransferFilter narrows the transfers returned by GetTransfers; zero values
+// match everything
+type TransferFilter struct {
+	UserID int
+	Type   string // "deposit" or "withdrawal"
+	Status string // "pending", "completed" or "rejected"
+}
+
+// appendWhere adds the filter's conditions to a query whose arguments are args
+func (f TransferFilter) appendWhere(query string, args []interface{}) (string, []interface{}) {
+	if f.UserID != 0 {
+		args = append(args, f.UserID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		query += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	return query, args
+}
+
+// Page selects a window of rows and their ordering. After continues from
+// the last row of a previous page with the same sort, so deep pages are read
+// from the index instead of skipping Offset rows; a self-trade listed for
+// both sides counts as one row for it.
+type Page struct {
+	Limit  int    // Rows to return; 0 means DefaultPageLimit
+	Offset int    // Rows to skip
+	After  int    // ID of the row to continue after; 0 starts at the first
+	Sort   string // Sort key such as "created_at" or "price"; empty means time order
+	Desc   bool   // Sort descending instead of ascending
+}
+
+// sortColumns maps accepted sort keys to columns; the empty key is the default
+type sortColumns struct {
+	table  string // Table the rows come from, aliased like the columns, to look up the row to continue after
+	id     string // ID column used as a tie-breaker
+	byName map[string]string
+}
+
+// orderSortColumns lists the sort keys accepted for orders
+var orderSortColumns = sortColumns{
+	table: "orders",
+	id:    "id",
+	byName: map[string]string{
+		"":           "created_at",
+		"created_at": "created_at",
+		"price":      "price",
+		"quantity":   "quantity",
+	},
+}
+
+// tradeSortColumns lists the sort keys accepted for trades
+var tradeSortColumns = sortColumns{
+	table: "trades t",
+	id:    "t.id",
+	byName: map[string]string{
+		"":            "t.executed_at",
+		"executed_at": "t.executed_at",
+		"id":          "t.id", // Execution order
+		"price":       "t.price",
+		"quantity":    "t.quantity",
+	},
+}
+
+// userSortColumns lists the sort keys accepted for users
+var userSortColumns = sortColumns{
+	table: "users",
+	id:    "id",
+	byName: map[string]string{
+		"":           "id",
+		"created_at": "created_at",
+		"username":   "LOWER(username)",
+	},
+}
+
+// IsValidOrderSort reports whether key is an accepted sort key for orders
+func IsValidOrderSort(key string) bool {
+	_, ok := orderSortColumns.byName[key]
+	return ok
+}
+
+// IsValidTradeSort reports whether key is an accepted sort key for trades
+func IsValidTradeSort(key string) bool {
+	_, ok := tradeSortColumns.byName[key]
+	return ok
+}
+
+// IsValidUserSort reports whether key is an accepted sort key for users
+func IsValidUserSort(key string) bool {
+	_, ok := userSortColumns.byName[key]
+	return ok
+}
+
+// limit returns the number of rows to return, with the default and cap applied
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(p.Limit, MaxPageLimit)
+}
+
+// Window returns the bounds of the page within n sorted rows, for slicing
+func (p Page) Window(n int) (start, end int) {
+	start = min(max(p.Offset, 0), n)
+	return start, min(start+p.limit(), n)
+}
+
+// appendTo adds ORDER BY, LIMIT and OFFSET clauses to a query ending in its
+// WHERE clause, and the condition continuing after p.After. The ID is used
+// as a tie-breaker so pages are stable when sort values repeat. An After row
+// that doesn't exist gives an empty page.
+func (p Page) appendTo(query string, args []interface{}, columns sortColumns) (string, []interface{}) {
+	column, ok := columns.byName[p.Sort]
+	if !ok {
+		column = columns.byName[""]
+	}
+
+	direction, after := "ASC", ">"
+	if p.Desc {
+		direction, after = "DESC", "<"
+	}
+	if p.After != 0 {
+		args = append(args, p.After)
+		query += fmt.Sprintf(" AND (%[1]s, %[2]s) %[3]s (SELECT %[1]s, %[2]s FROM %[4]s WHERE %[2]s = $%[5]d)",
+			column, columns.id, after, columns.table, len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s", column, direction, columns.id, direction)
+
+	args = append(args, p.limit(), p.Offset)
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return query, args
+}
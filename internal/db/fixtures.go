@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fixtureTables are the tables a fixture holds, in the order they're
+// restored, each dumped by the query selecting its rows as JSON. Trades are
+// dumped without their accounting batch, whose batches aren't kept, so
+// restored trades are batched again. The ledger is kept for balances to
+// match the trades.
+var fixtureTables = []struct {
+	Name  string
+	Query string
+}{
+	{"users", "SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM users t"},
+	{"orders", "SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM orders t"},
+	{"trades", "SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'accounting_batch_id' ORDER BY t.id), '[]') FROM trades t"},
+	{"ledger_entries", "SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM ledger_entries t"},
+}
+
+// ErrFixtureNotFound is returned when no fixture has the requested name
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// ErrFixtureSchema is returned when restoring a fixture dumped from a
+// database at another schema version, whose rows may not fit the tables
+var ErrFixtureSchema = errors.New("fixture was dumped at another schema version")
+
+// fixtureName is what a fixture may be called, as its file is named after it
+var fixtureName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Fixture is a named snapshot of the users, orders and trades in the
+// database, for tests and demos to reset to a known state
+type Fixture struct {
+	Name          string                     `json:"name"`
+	SchemaVersion int32                      `json:"schema_version"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	Tables        map[string]json.RawMessage `json:"tables"` // Rows of each table, as JSON objects by column
+}
+
+// DumpFixture snapshots the fixture tables as they are at one point in time
+func (db *DB) DumpFixture(ctx context.Context, name string) (*Fixture, error) {
+	if !fixtureName.MatchString(name) {
+		return nil, fmt.Errorf("invalid fixture name %q: use letters, digits, - and _", name)
+	}
+	version, _, err := db.MigrationVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	fixture := &Fixture{Name: name, SchemaVersion: version, CreatedAt: time.Now().UTC(), Tables: make(map[string]json.RawMessage)}
+	for _, table := range fixtureTables {
+		var rows []byte
+		if err := tx.QueryRow(ctx, table.Query).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("failed to dump %s: %w", table.Name, err)
+		}
+		fixture.Tables[table.Name] = rows
+	}
+	return fixture, nil
+}
+
+// RestoreFixture replaces the fixture tables' rows with the fixture's,
+// keeping their IDs, and clears every table referring to them, like
+// sessions and API keys. ID sequences continue after the restored rows.
+// Book snapshots are discarded, so a server started afterwards loads the
+// fixture's open orders.
+func (db *DB) RestoreFixture(ctx context.Context, fixture *Fixture) error {
+	version, _, err := db.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if fixture.SchemaVersion != version {
+		return fmt.Errorf("%w: %s is at version %d, the database %d", ErrFixtureSchema, fixture.Name, fixture.SchemaVersion, version)
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	names := make([]string, len(fixtureTables))
+	for i, table := range fixtureTables {
+		names[i] = table.Name
+	}
+	if _, err := tx.Exec(ctx, "TRUNCATE TABLE "+strings.Join(names, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+		return fmt.Errorf("failed to clear tables: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM book_snapshots"); err != nil {
+		return fmt.Errorf("failed to delete book snapshots: %w", err)
+	}
+
+	for _, table := range fixtureTables {
+		rows, ok := fixture.Tables[table.Name]
+		if !ok {
+			continue
+		}
+		// Table names come from fixtureTables, never the fixture
+		_, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %[1]s SELECT * FROM jsonb_populate_recordset(NULL::%[1]s, $1)", table.Name), rows)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table.Name, err)
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %[1]s", table.Name))
+		if err != nil {
+			return fmt.Errorf("failed to reset %s IDs: %w", table.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// WriteFixture saves a fixture to dir as <name>.json, replacing any of
+// the same name
+func WriteFixture(dir string, fixture *Fixture) error {
+	data, err := json.Marshal(fixture)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fixture.Name+".json"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// ReadFixture loads the fixture called name from dir, returning
+// ErrFixtureNotFound if there isn't one
+func ReadFixture(dir, name string) (*Fixture, error) {
+	if !fixtureName.MatchString(name) {
+		return nil, ErrFixtureNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFixtureNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	fixture := &Fixture{}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", name, err)
+	}
+	return fixture, nil
+}
+
+// ListFixtures returns the names of the fixtures in dir, in order
+func ListFixtures(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, path := range paths {
+		if name := strings.TrimSuffix(filepath.Base(path), ".json"); fixtureName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
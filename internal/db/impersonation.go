@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrNoSupportAccess is returned when impersonating a user who hasn't
+// granted support access, or whose grant has expired
+var ErrNoSupportAccess = errors.New("support access not granted")
+
+// ErrImpersonationEnded is returned for a session that has expired or whose
+// user has revoked support access
+var ErrImpersonationEnded = errors.New("impersonation session ended")
+
+// SetSupportAccess lets support impersonate a user for the given duration
+// from now, replacing any earlier grant. A zero duration revokes access,
+// ending any sessions in progress. Returns when access ends, or nil if
+// revoked.
+func (db *DB) SetSupportAccess(ctx context.Context, userID int, duration time.Duration) (*time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var until *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE users SET support_access_until =
+			CASE WHEN $2::INT > 0 THEN CURRENT_TIMESTAMP + $2::INT * INTERVAL '1 second' END
+		WHERE id = $1 RETURNING support_access_until`,
+		userID, int(duration.Seconds())).Scan(&until)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set support access: %w", err)
+	}
+	return until, nil
+}
+
+// GetSupportAccess returns when a user's grant of support access ends, or
+// nil if there is none in effect
+func (db *DB) GetSupportAccess(ctx context.Context, userID int) (*time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var until *time.Time
+	err := db.Pool.QueryRow(ctx,
+		"SELECT CASE WHEN support_access_until > CURRENT_TIMESTAMP THEN support_access_until END FROM users WHERE id = $1",
+		userID).Scan(&until)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get support access: %w", err)
+	}
+	return until, nil
+}
+
+// StartImpersonation opens a session for an admin to view a user's account.
+// It lasts for duration, or until the user's grant of support access ends
+// if that is sooner. Returns ErrNoSupportAccess if the user hasn't granted it.
+func (db *DB) StartImpersonation(ctx context.Context, adminID, userID int, reason string, duration time.Duration) (*models.ImpersonationSession, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	session := &models.ImpersonationSession{Requests: []models.ImpersonationRequest{}}
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO impersonation_sessions (admin_id, user_id, reason, expires_at)
+		SELECT $1, id, $3, LEAST(CURRENT_TIMESTAMP + $4::INT * INTERVAL '1 second', support_access_until)
+		FROM users WHERE id = $2 AND support_access_until > CURRENT_TIMESTAMP
+		RETURNING id, admin_id, user_id, reason, created_at, expires_at`,
+		adminID, userID, reason, int(duration.Seconds())).
+		Scan(&session.ID, &session.AdminID, &session.UserID, &session.Reason, &session.CreatedAt, &session.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check user: %w", err)
+		}
+		if !exists {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrNoSupportAccess
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start impersonation: %w", err)
+	}
+	return session, nil
+}
+
+// RecordImpersonationRequest records a request made in a session, returning
+// ErrImpersonationEnded without recording it if the session has expired or
+// the user has revoked support access
+func (db *DB) RecordImpersonationRequest(ctx context.Context, sessionID int, method, path string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO impersonation_requests (session_id, method, path)
+		SELECT s.id, $2, $3 FROM impersonation_sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.expires_at > CURRENT_TIMESTAMP AND u.support_access_until > CURRENT_TIMESTAMP`,
+		sessionID, method, path)
+	if err != nil {
+		return fmt.Errorf("failed to record impersonation request: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrImpersonationEnded
+	}
+	return nil
+}
+
+// GetImpersonationSessions returns the sessions opened on a user's account,
+// newest first, each with the requests made in it
+func (db *DB) GetImpersonationSessions(ctx context.Context, userID int) ([]models.ImpersonationSession, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, admin_id, user_id, reason, created_at, expires_at FROM impersonation_sessions WHERE user_id = $1 ORDER BY id DESC",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.ImpersonationSession{}
+	index := make(map[int]int)
+	var ids []int
+	for rows.Next() {
+		session := models.ImpersonationSession{Requests: []models.ImpersonationRequest{}}
+		if err := rows.Scan(&session.ID, &session.AdminID, &session.UserID, &session.Reason, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan impersonation session: %w", err)
+		}
+		index[session.ID] = len(sessions)
+		ids = append(ids, session.ID)
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating impersonation session rows: %w", err)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	rows, err = db.Pool.Query(ctx,
+		"SELECT session_id, method, path, requested_at FROM impersonation_requests WHERE session_id = ANY($1) ORDER BY id",
+		ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation requests: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID int
+		var request models.ImpersonationRequest
+		if err := rows.Scan(&sessionID, &request.Method, &request.Path, &request.RequestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan impersonation request: %w", err)
+		}
+		session := &sessions[index[sessionID]]
+		session.Requests = append(session.Requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating impersonation request rows: %w", err)
+	}
+	return sessions, nil
+}
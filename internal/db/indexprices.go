@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// SaveIndexPrices records index prices ingested from a feed
+func (db *DB) SaveIndexPrices(ctx context.Context, prices []models.IndexPrice) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, price := range prices {
+		_, err := tx.Exec(ctx, "INSERT INTO index_prices (symbol, source, price, observed_at) VALUES ($1, $2, $3, $4)",
+			price.Symbol, price.Source, price.Price, price.ObservedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save index price: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetLatestIndexPrice returns an instrument's most recently observed index
+// price, or nil if none has been ingested
+func (db *DB) GetLatestIndexPrice(ctx context.Context, symbol string) (*models.IndexPrice, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	price := &models.IndexPrice{}
+	err := db.Pool.QueryRow(ctx, `
+		SELECT symbol, source, price, observed_at FROM index_prices
+		WHERE symbol = $1 ORDER BY observed_at DESC, id DESC LIMIT 1`, symbol,
+	).Scan(&price.Symbol, &price.Source, &price.Price, &price.ObservedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index price: %w", err)
+	}
+	return price, nil
+}
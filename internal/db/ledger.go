@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// FeesAccount is the system account trading fees are credited to
+const FeesAccount = "fees"
+
+// querier is implemented by both the pool and transactions
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// postEntries records a balanced set of ledger entries under one reference.
+// Entries for system accounts leave UserID zero; zero amounts are skipped.
+func postEntries(ctx context.Context, tx pgx.Tx, kind, reference string, entries []models.LedgerEntry) error {
+	totals := make(map[string]float64)
+	for _, entry := range entries {
+		totals[entry.Asset] += entry.Amount
+	}
+	for asset, total := range totals {
+		if math.Abs(total) > 1e-8 {
+			return fmt.Errorf("unbalanced ledger entries for %s: %s nets to %f", reference, asset, total)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Amount == 0 {
+			continue
+		}
+		account := entry.Account
+		if account == "" {
+			account = "user"
+		}
+		_, err := tx.Exec(ctx,
+			"INSERT INTO ledger_entries (user_id, account, asset, amount, kind, reference) VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)",
+			entry.UserID, account, entry.Asset, entry.Amount, kind, reference)
+		if err != nil {
+			return fmt.Errorf("failed to post ledger entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// postTrade posts a trade to the ledger: the buyer receives the base asset
+// and pays the notional plus their fee, the seller receives the notional
+// less their fee, and the fees account receives both fees
+func postTrade(ctx context.Context, tx pgx.Tx, trade *models.Trade, symbol string) error {
+	instrument, ok := instruments.Lookup(symbol)
+	if !ok {
+		return fmt.Errorf("unknown symbol %q", symbol)
+	}
+
+	notional := trade.Price * trade.Quantity
+	return postEntries(ctx, tx, "trade", fmt.Sprintf("trade:%d", trade.ID), []models.LedgerEntry{
+		{UserID: trade.BuyUserID, Asset: instrument.Base, Amount: trade.Quantity},
+		{UserID: trade.BuyUserID, Asset: instrument.Quote, Amount: -(notional + trade.BuyFee)},
+		{UserID: trade.SellUserID, Asset: instrument.Base, Amount: -trade.Quantity},
+		{UserID: trade.SellUserID, Asset: instrument.Quote, Amount: notional - trade.SellFee},
+		{Account: FeesAccount, Asset: instrument.Quote, Amount: trade.BuyFee + trade.SellFee},
+	})
+}
+
+// GetBalances returns a user's non-zero balances, ordered by asset
+func (db *DB) GetBalances(ctx context.Context, userID int) ([]models.Balance, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getBalances(ctx, db.Pool, userID)
+}
+
+func getBalances(ctx context.Context, q querier, userID int) ([]models.Balance, error) {
+	rows, err := q.Query(ctx,
+		"SELECT asset, SUM(amount) FROM ledger_entries WHERE user_id = $1 GROUP BY asset HAVING SUM(amount) <> 0 ORDER BY asset",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []models.Balance{}
+	for rows.Next() {
+		var balance models.Balance
+		if err := rows.Scan(&balance.Asset, &balance.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating balance rows: %w", err)
+	}
+	return balances, nil
+}
+
+// GetBalancesAt returns a user's non-zero balances from the entries posted
+// before a time, ordered by asset
+func (db *DB) GetBalancesAt(ctx context.Context, userID int, at time.Time) ([]models.Balance, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT asset, SUM(amount) FROM ledger_entries WHERE user_id = $1 AND created_at < $2 GROUP BY asset HAVING SUM(amount) <> 0 ORDER BY asset",
+		userID, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []models.Balance{}
+	for rows.Next() {
+		var balance models.Balance
+		if err := rows.Scan(&balance.Asset, &balance.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating balance rows: %w", err)
+	}
+	return balances, nil
+}
+
+// GetLedgerEntries returns the entries posted under a reference
+func (db *DB) GetLedgerEntries(ctx context.Context, reference string) ([]models.LedgerEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, COALESCE(user_id, 0), account, asset, amount, kind, reference, created_at "+
+			"FROM ledger_entries WHERE reference = $1 ORDER BY id",
+		reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.LedgerEntry
+	for rows.Next() {
+		var entry models.LedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Account, &entry.Asset, &entry.Amount, &entry.Kind, &entry.Reference, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger entry rows: %w", err)
+	}
+	return entries, nil
+}
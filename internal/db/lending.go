@@ -0,0 +1,477 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// LendingAccount is the system account lent funds are held in and borrowed
+// funds paid out of. Its balance in an asset is what's been lent to the
+// asset's pool less what's owed to it.
+const LendingAccount = "lending"
+
+// Lending movements, each posted to the ledger as its kind
+const (
+	LendingLend   = "lend"   // Into the pool from the lender's balance
+	LendingRedeem = "redeem" // Out of the pool back to the lender
+	LendingBorrow = "borrow" // Out of the pool to the borrower
+	LendingRepay  = "repay"  // Into the pool from the borrower's balance
+)
+
+// ErrNothingOwed is returned when repaying an asset the user owes nothing in
+var ErrNothingOwed = errors.New("nothing owed")
+
+// ErrNoPrice is returned when borrowing an asset there's no price to value
+// the borrow at
+var ErrNoPrice = errors.New("no price to value the asset at")
+
+// PoolLiquidityError is returned when borrowing or withdrawing more of an
+// asset than its pool holds, the rest being lent out
+type PoolLiquidityError struct {
+	Asset     string
+	Available float64 // Lent to the pool and not borrowed
+}
+
+func (e *PoolLiquidityError) Error() string {
+	return fmt.Sprintf("insufficient %s in the lending pool (available: %f)", e.Asset, e.Available)
+}
+
+// BorrowLimitError is returned when a borrow would take what a user owes
+// past their borrowing limit, or taking funds out would leave it past it
+type BorrowLimitError struct {
+	Capacity float64 // Value the user may still borrow
+	Value    float64 // Value of the borrow or of the funds taken out
+}
+
+func (e *BorrowLimitError) Error() string {
+	return fmt.Sprintf("borrow of %f above borrowing capacity %f", e.Value, e.Capacity)
+}
+
+// BorrowLimit caps what users may owe at LTV of the value of what they
+// hold: their balances and what they've lent. Assets are valued at Prices,
+// in the quote asset; those without a price count for nothing.
+type BorrowLimit struct {
+	LTV    float64 // Fraction of the value held that may be owed, below 1
+	Prices map[string]float64
+}
+
+// Capacity returns the value a user with balances and lending positions may
+// still borrow. Borrowed funds count towards what they hold once borrowed,
+// so with an LTV of 0.5 a user holding 1,000 may borrow 1,000 more. It's
+// negative for a user owing more than the limit, as prices move.
+func (l BorrowLimit) Capacity(balances []models.Balance, positions []models.LendingPosition) float64 {
+	held, owed := l.Values(balances, positions)
+	return (held*l.LTV - owed) / (1 - l.LTV)
+}
+
+// Values returns the value of what a user with balances and lending
+// positions holds, and of what they owe
+func (l BorrowLimit) Values(balances []models.Balance, positions []models.LendingPosition) (held, owed float64) {
+	for _, balance := range balances {
+		held += balance.Amount * l.Prices[balance.Asset]
+	}
+	for _, position := range positions {
+		held += position.Supplied * l.Prices[position.Asset]
+		owed += position.Borrowed * l.Prices[position.Asset]
+	}
+	return held, owed
+}
+
+const lendingPositionColumns = "user_id, asset, supplied, borrowed, interest_earned, interest_charged, updated_at"
+
+func scanLendingPosition(row pgx.Row, p *models.LendingPosition) error {
+	return row.Scan(&p.UserID, &p.Asset, &p.Supplied, &p.Borrowed, &p.InterestEarned, &p.InterestCharged, &p.UpdatedAt)
+}
+
+// getLendingPositions returns positions matching a condition, ordered by
+// user and asset
+func getLendingPositions(ctx context.Context, q querier, where string, args ...interface{}) ([]models.LendingPosition, error) {
+	rows, err := q.Query(ctx, "SELECT "+lendingPositionColumns+" FROM lending_positions WHERE "+where+" ORDER BY user_id, asset", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lending positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := []models.LendingPosition{}
+	for rows.Next() {
+		var position models.LendingPosition
+		if err := scanLendingPosition(rows, &position); err != nil {
+			return nil, fmt.Errorf("failed to scan lending position: %w", err)
+		}
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lending position rows: %w", err)
+	}
+	return positions, nil
+}
+
+// GetUserLendingPositions returns a user's lending positions, by asset
+func (db *DB) GetUserLendingPositions(ctx context.Context, userID int) ([]models.LendingPosition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getLendingPositions(ctx, db.Pool, "user_id = $1", userID)
+}
+
+// GetLendingPositions returns every user's position in an asset's pool
+// that has anything lent or owed, by user
+func (db *DB) GetLendingPositions(ctx context.Context, asset string) ([]models.LendingPosition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getLendingPositions(ctx, db.Pool, "asset = $1 AND (supplied > 0 OR borrowed > 0)", asset)
+}
+
+// GetLendingPools returns what's lent to and owed to each asset's pool, by
+// asset
+func (db *DB) GetLendingPools(ctx context.Context) ([]models.LendingPool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, "SELECT asset, SUM(supplied), SUM(borrowed) FROM lending_positions GROUP BY asset ORDER BY asset")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lending pools: %w", err)
+	}
+	defer rows.Close()
+
+	pools := []models.LendingPool{}
+	for rows.Next() {
+		var pool models.LendingPool
+		if err := rows.Scan(&pool.Asset, &pool.Supplied, &pool.Borrowed); err != nil {
+			return nil, fmt.Errorf("failed to scan lending pool: %w", err)
+		}
+		pools = append(pools, pool)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lending pool rows: %w", err)
+	}
+	return pools, nil
+}
+
+// Lend moves amount of asset from the user's balance into the asset's
+// lending pool. Returns an *InsufficientBalanceError if it exceeds their
+// balance less pending withdrawals.
+func (db *DB) Lend(ctx context.Context, userID int, asset string, amount float64) (*models.LendingPosition, error) {
+	return db.moveLending(ctx, userID, LendingLend, asset, amount, func(tx pgx.Tx, position *models.LendingPosition) (float64, error) {
+		return amount, checkAvailable(ctx, tx, userID, asset, amount, 0)
+	})
+}
+
+// RedeemLending withdraws amount of what the user has lent to an asset's
+// pool back to their balance. Returns an *InsufficientBalanceError if it's
+// more than they've lent, a *PoolLiquidityError if it's more than the pool
+// has that isn't borrowed, and a *BorrowLimitError if the user owes more
+// than limit allows.
+func (db *DB) RedeemLending(ctx context.Context, userID int, asset string, amount float64, limit BorrowLimit) (*models.LendingPosition, error) {
+	return db.moveLending(ctx, userID, LendingRedeem, asset, amount, func(tx pgx.Tx, position *models.LendingPosition) (float64, error) {
+		if amount-position.Supplied > 1e-9 {
+			return 0, &InsufficientBalanceError{Asset: asset, Available: position.Supplied}
+		}
+		if err := checkPoolLiquidity(ctx, tx, asset, amount); err != nil {
+			return 0, err
+		}
+		// What's lent and the balance it's redeemed to both count towards
+		// what's held, so this only refuses users already past the limit
+		return amount, checkBorrowCapacity(ctx, tx, userID, asset, 0, limit)
+	})
+}
+
+// Borrow moves amount of asset from its lending pool to the user's
+// balance. Returns a *PoolLiquidityError if it's more than the pool has
+// that isn't borrowed, ErrNoPrice if the asset has no price in limit, and a
+// *BorrowLimitError if it's more than the user's borrowing capacity.
+func (db *DB) Borrow(ctx context.Context, userID int, asset string, amount float64, limit BorrowLimit) (*models.LendingPosition, error) {
+	return db.moveLending(ctx, userID, LendingBorrow, asset, amount, func(tx pgx.Tx, position *models.LendingPosition) (float64, error) {
+		if err := checkPoolLiquidity(ctx, tx, asset, amount); err != nil {
+			return 0, err
+		}
+		price, ok := limit.Prices[asset]
+		if !ok {
+			return 0, ErrNoPrice
+		}
+		balances, err := getBalances(ctx, tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		positions, err := getLendingPositions(ctx, tx, "user_id = $1", userID)
+		if err != nil {
+			return 0, err
+		}
+		capacity := limit.Capacity(balances, positions)
+		if value := amount * price; value-capacity > 1e-9 {
+			return 0, &BorrowLimitError{Capacity: math.Max(capacity, 0), Value: value}
+		}
+		return amount, nil
+	})
+}
+
+// Repay moves amount of asset from the user's balance into its lending
+// pool, paying down what they owe, or all of it if amount is more. Returns
+// ErrNothingOwed if they owe nothing and an *InsufficientBalanceError if
+// the repayment exceeds their balance less pending withdrawals.
+func (db *DB) Repay(ctx context.Context, userID int, asset string, amount float64) (*models.LendingPosition, error) {
+	return db.moveLending(ctx, userID, LendingRepay, asset, amount, func(tx pgx.Tx, position *models.LendingPosition) (float64, error) {
+		if position.Borrowed <= 0 {
+			return 0, ErrNothingOwed
+		}
+		amount = math.Min(amount, position.Borrowed)
+		return amount, checkAvailable(ctx, tx, userID, asset, amount, 0)
+	})
+}
+
+// moveLending records a movement into or out of an asset's lending pool,
+// posts it to the ledger and updates the user's position, all in one
+// transaction. check is called with the user's position and the pool
+// locked, and returns the amount to move or why it can't be.
+func (db *DB) moveLending(ctx context.Context, userID int, kind, asset string, amount float64,
+	check func(tx pgx.Tx, position *models.LendingPosition) (float64, error)) (*models.LendingPosition, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user, as transfers do, then the pool, so redeeming and
+	// borrowing can't together take more than it holds
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "lending:"+asset); err != nil {
+		return nil, fmt.Errorf("failed to lock lending pool: %w", err)
+	}
+
+	position := &models.LendingPosition{UserID: userID, Asset: asset}
+	err = scanLendingPosition(tx.QueryRow(ctx,
+		"SELECT "+lendingPositionColumns+" FROM lending_positions WHERE user_id = $1 AND asset = $2", userID, asset), position)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to get lending position: %w", err)
+	}
+	if amount, err = check(tx, position); err != nil {
+		return nil, err
+	}
+
+	var movementID int
+	err = tx.QueryRow(ctx, "INSERT INTO lending_movements (user_id, asset, kind, amount) VALUES ($1, $2, $3, $4) RETURNING id",
+		userID, asset, kind, amount).Scan(&movementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record lending movement: %w", err)
+	}
+
+	// Lending and repaying take from the user's balance, the others add to it
+	var received, supplied, borrowed float64
+	switch kind {
+	case LendingLend:
+		received, supplied = -amount, amount
+	case LendingRedeem:
+		received, supplied = amount, -amount
+	case LendingBorrow:
+		received, borrowed = amount, amount
+	case LendingRepay:
+		received, borrowed = -amount, -amount
+	}
+	err = postEntries(ctx, tx, kind, fmt.Sprintf("%s:%d", kind, movementID), []models.LedgerEntry{
+		{UserID: userID, Asset: asset, Amount: received},
+		{Account: LendingAccount, Asset: asset, Amount: -received},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Amounts left within rounding of zero are cleared, so a position can be
+	// closed out
+	updated := &models.LendingPosition{}
+	err = scanLendingPosition(tx.QueryRow(ctx, `
+		INSERT INTO lending_positions (user_id, asset, supplied, borrowed) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, asset) DO UPDATE SET
+			supplied = CASE WHEN lending_positions.supplied + $3 < 0.000000005 THEN 0 ELSE lending_positions.supplied + $3 END,
+			borrowed = CASE WHEN lending_positions.borrowed + $4 < 0.000000005 THEN 0 ELSE lending_positions.borrowed + $4 END,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING `+lendingPositionColumns,
+		userID, asset, supplied, borrowed), updated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update lending position: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// checkBorrowCapacity returns a *BorrowLimitError if taking amount of asset
+// out of what a user holds would leave them owing more than limit allows.
+// Users who owe nothing may take out anything.
+func checkBorrowCapacity(ctx context.Context, tx pgx.Tx, userID int, asset string, amount float64, limit BorrowLimit) error {
+	positions, err := getLendingPositions(ctx, tx, "user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(positions, func(p models.LendingPosition) bool { return p.Borrowed > 0 }) {
+		return nil
+	}
+	balances, err := getBalances(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Each unit of value taken out lowers what may be owed by LTV of it
+	capacity := limit.Capacity(balances, positions)
+	value := amount * limit.Prices[asset]
+	if capacity-value*limit.LTV/(1-limit.LTV) < -1e-9 {
+		return &BorrowLimitError{Capacity: math.Max(capacity, 0), Value: value}
+	}
+	return nil
+}
+
+// checkPoolLiquidity returns a *PoolLiquidityError if amount is more than
+// an asset's pool holds that isn't borrowed
+func checkPoolLiquidity(ctx context.Context, tx pgx.Tx, asset string, amount float64) error {
+	var available float64
+	err := tx.QueryRow(ctx, "SELECT COALESCE(SUM(supplied - borrowed), 0) FROM lending_positions WHERE asset = $1", asset).Scan(&available)
+	if err != nil {
+		return fmt.Errorf("failed to get lending pool liquidity: %w", err)
+	}
+	if amount-available > 1e-9 {
+		return &PoolLiquidityError{Asset: asset, Available: available}
+	}
+	return nil
+}
+
+// GetLendingMovements returns a user's latest lending movements, newest
+// first
+func (db *DB) GetLendingMovements(ctx context.Context, userID, limit int) ([]models.LendingMovement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, user_id, asset, kind, amount, created_at FROM lending_movements WHERE user_id = $1 ORDER BY id DESC LIMIT $2",
+		userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lending movements: %w", err)
+	}
+	defer rows.Close()
+
+	movements := []models.LendingMovement{}
+	for rows.Next() {
+		var m models.LendingMovement
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Asset, &m.Kind, &m.Amount, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan lending movement: %w", err)
+		}
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lending movement rows: %w", err)
+	}
+	return movements, nil
+}
+
+// GetLastLendingAccrual returns the latest hour interest in asset was
+// accrued for, or the zero time if none was
+func (db *DB) GetLastLendingAccrual(ctx context.Context, asset string) (time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var hour *time.Time
+	err := db.Pool.QueryRow(ctx, "SELECT MAX(hour) FROM lending_accruals WHERE asset = $1", asset).Scan(&hour)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last lending accrual: %w", err)
+	}
+	if hour == nil {
+		return time.Time{}, nil
+	}
+	return *hour, nil
+}
+
+// LendingInterest works out an hour's interest on an asset's pool from the
+// positions with anything lent or owed: each borrower's charge and each
+// lender's earnings, which must add up to the same
+type LendingInterest func(positions []models.LendingPosition) (charges, earnings map[int]float64)
+
+// AccrueLendingInterest records an hour's interest on the asset's pool:
+// each borrower's charge is added to what they owe and each lender's
+// earnings to what they've lent, all in one transaction. The pool is locked
+// as lending movements lock it, and interest is worked out from the
+// positions read under the lock, so a movement can't change them in
+// between. Returns false, changing nothing, if the hour was already
+// accrued.
+//
+// Interest isn't posted to the ledger. The lending account's balance is
+// what's lent less what's owed, and as charges and earnings add up to the
+// same, accruing raises both by as much and leaves it unchanged; users'
+// balances only move when interest is repaid or redeemed, which is posted.
+func (db *DB) AccrueLendingInterest(ctx context.Context, asset string, hour time.Time, rate float64, interest LendingInterest) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "lending:"+asset); err != nil {
+		return false, fmt.Errorf("failed to lock lending pool: %w", err)
+	}
+	positions, err := getLendingPositions(ctx, tx, "asset = $1 AND (supplied > 0 OR borrowed > 0)", asset)
+	if err != nil {
+		return false, err
+	}
+	charges, earnings := interest(positions)
+
+	var borrowed, charged, earned float64
+	for _, position := range positions {
+		borrowed += position.Borrowed
+	}
+	for _, charge := range charges {
+		charged += charge
+	}
+	for _, earning := range earnings {
+		earned += earning
+	}
+	if math.Abs(charged-earned) > 1e-8 {
+		return false, fmt.Errorf("unbalanced lending interest for %s at %s: %f charged, %f earned", asset, hour, charged, earned)
+	}
+
+	tag, err := tx.Exec(ctx,
+		"INSERT INTO lending_accruals (asset, hour, rate, borrowed, interest) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (asset, hour) DO NOTHING",
+		asset, hour, rate, borrowed, charged)
+	if err != nil {
+		return false, fmt.Errorf("failed to record lending accrual: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	for userID, charge := range charges {
+		_, err := tx.Exec(ctx,
+			"UPDATE lending_positions SET borrowed = borrowed + $3, interest_charged = interest_charged + $3 WHERE user_id = $1 AND asset = $2",
+			userID, asset, charge)
+		if err != nil {
+			return false, fmt.Errorf("failed to charge lending interest: %w", err)
+		}
+	}
+	for userID, earning := range earnings {
+		_, err := tx.Exec(ctx,
+			"UPDATE lending_positions SET supplied = supplied + $3, interest_earned = interest_earned + $3 WHERE user_id = $1 AND asset = $2",
+			userID, asset, earning)
+		if err != nil {
+			return false, fmt.Errorf("failed to credit lending interest: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
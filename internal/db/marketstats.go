@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// RollupMarketStats totals each market's trades by the hour they executed
+// in, for the hours in [from, to), replacing any earlier rollup of those
+// hours. Returns the number of market hours rolled up.
+func (db *DB) RollupMarketStats(ctx context.Context, from, to time.Time) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO market_stats_hourly (symbol, hour, trades, volume, notional)
+		SELECT symbol, date_trunc('hour', executed_at), COUNT(*), SUM(quantity), SUM(price * quantity)
+		FROM trades
+		WHERE executed_at >= $1 AND executed_at < $2 AND symbol IS NOT NULL
+		GROUP BY symbol, date_trunc('hour', executed_at)
+		ON CONFLICT (symbol, hour) DO UPDATE SET trades = EXCLUDED.trades, volume = EXCLUDED.volume,
+			notional = EXCLUDED.notional, rolled_up_at = CURRENT_TIMESTAMP`,
+		from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll up market stats: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetLatestMarketStatsHour returns the latest hour any market's trading was
+// rolled up for, or the zero time if none has been
+func (db *DB) GetLatestMarketStatsHour(ctx context.Context) (time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var hour *time.Time
+	if err := db.Pool.QueryRow(ctx, "SELECT MAX(hour) FROM market_stats_hourly").Scan(&hour); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest market stats hour: %w", err)
+	}
+	if hour == nil {
+		return time.Time{}, nil
+	}
+	return *hour, nil
+}
+
+// GetMarketStats returns the hourly rollups of every market for the hours
+// starting at or after since, oldest first. Hours without trades have no
+// rollup.
+func (db *DB) GetMarketStats(ctx context.Context, since time.Time) ([]models.MarketStatsHour, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		SELECT symbol, hour, trades, volume, notional
+		FROM market_stats_hourly
+		WHERE hour >= $1
+		ORDER BY hour, symbol`,
+		since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []models.MarketStatsHour{}
+	for rows.Next() {
+		var hour models.MarketStatsHour
+		if err := rows.Scan(&hour.Symbol, &hour.Hour, &hour.Trades, &hour.Volume, &hour.Notional); err != nil {
+			return nil, fmt.Errorf("failed to scan market stats: %w", err)
+		}
+		stats = append(stats, hour)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating market stats rows: %w", err)
+	}
+	return stats, nil
+}
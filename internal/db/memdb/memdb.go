@@ -0,0 +1,466 @@
+// Package memdb is an in-memory db.Store, so code that reads and writes
+// orders, trades and users can be unit tested without PostgreSQL. It
+// follows the queries of db.DB, but keeps none of the records they write
+// alongside, such as ledger entries, audit entries or outbox events.
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Store keeps orders, trades and users in memory. IDs are assigned from 1
+// in the order records are created.
+type Store struct {
+	mu     sync.Mutex
+	users  []models.User
+	orders []models.Order
+	trades []models.Trade
+
+	// Now timestamps new records; time.Now unless replaced
+	Now func() time.Time
+}
+
+var _ db.Store = (*Store)(nil)
+
+// New returns an empty store
+func New() *Store {
+	return &Store{Now: time.Now}
+}
+
+// CreateOrder validates and stores an order
+func (s *Store) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
+	if err := db.ValidateOrder(order); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user(order.UserID) == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	newOrder := *order
+	newOrder.ID = len(s.orders) + 1
+	newOrder.CreatedAt = s.Now()
+	s.orders = append(s.orders, newOrder)
+	return &newOrder, nil
+}
+
+// GetOrder returns one of a user's orders, or db.ErrOrderNotFound
+func (s *Store) GetOrder(ctx context.Context, orderID, userID int) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := s.order(orderID)
+	if order == nil || order.UserID != userID {
+		return nil, db.ErrOrderNotFound
+	}
+	found := *order
+	return &found, nil
+}
+
+// GetOrderByID returns any user's order, or db.ErrOrderNotFound
+func (s *Store) GetOrderByID(ctx context.Context, orderID int) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := s.order(orderID)
+	if order == nil {
+		return nil, db.ErrOrderNotFound
+	}
+	found := *order
+	return &found, nil
+}
+
+// GetOrderByClientID returns the user's order with a client order ID, or
+// db.ErrOrderNotFound
+func (s *Store) GetOrderByClientID(ctx context.Context, userID int, clientOrderID string) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, order := range s.orders {
+		if order.UserID == userID && clientOrderID != "" && order.ClientOrderID == clientOrderID {
+			return &order, nil
+		}
+	}
+	return nil, db.ErrOrderNotFound
+}
+
+// GetOrdersByIDs returns the orders with the given IDs, oldest first;
+// unknown IDs are skipped
+func (s *Store) GetOrdersByIDs(ctx context.Context, orderIDs []int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.orders {
+		if slices.Contains(orderIDs, order.ID) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortStableFunc(orders, func(a, b models.Order) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return orders, nil
+}
+
+// GetUserOrders returns a page of a user's orders matching filter
+func (s *Store) GetUserOrders(ctx context.Context, userID int, filter db.OrderFilter, page db.Page) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	compare := func(a, b models.Order) int {
+		var c int
+		switch page.Sort {
+		case "price":
+			c = cmp.Compare(a.Price, b.Price)
+		case "quantity":
+			c = cmp.Compare(a.Quantity, b.Quantity)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		return direction(page, cmp.Or(c, cmp.Compare(a.ID, b.ID)))
+	}
+	after := s.order(page.After)
+	if page.After != 0 && after == nil {
+		return nil, nil
+	}
+
+	var orders []models.Order
+	for _, order := range s.orders {
+		if order.UserID == userID && filter.Matches(order) && (after == nil || compare(order, *after) > 0) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortStableFunc(orders, compare)
+	start, end := page.Window(len(orders))
+	if start == end {
+		return nil, nil
+	}
+	return orders[start:end], nil
+}
+
+// GetOpenOrders returns every open order, by symbol and then in price-time
+// order
+func (s *Store) GetOpenOrders(ctx context.Context) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var orders []models.Order
+	for _, order := range s.orders {
+		if order.Status == "open" {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortStableFunc(orders, func(a, b models.Order) int {
+		return cmp.Or(strings.Compare(a.Symbol, b.Symbol), cmp.Compare(a.Price, b.Price), a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return orders, nil
+}
+
+// GetBookOrders returns every open order, like GetOpenOrders
+func (s *Store) GetBookOrders(ctx context.Context) ([]models.Order, error) {
+	return s.GetOpenOrders(ctx)
+}
+
+// UpdateOrderStatus sets an order's status; unknown orders are ignored
+func (s *Store) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if order := s.order(orderID); order != nil {
+		order.Status = status
+	}
+	return nil
+}
+
+// CancelOrder cancels one of the user's open orders. Returns
+// db.ErrOrderNotFound for unknown orders and a *db.OrderNotOpenError for
+// those already filled or canceled.
+func (s *Store) CancelOrder(ctx context.Context, orderID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := s.order(orderID)
+	if order == nil || order.UserID != userID {
+		return db.ErrOrderNotFound
+	}
+	if order.Status != "open" {
+		return &db.OrderNotOpenError{OrderID: orderID, Status: order.Status}
+	}
+	order.Status = "canceled"
+	return nil
+}
+
+// CreateTrade stores a trade
+func (s *Store) CreateTrade(ctx context.Context, trade *models.Trade) (*models.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newTrade := *trade
+	newTrade.ID = len(s.trades) + 1
+	newTrade.ExecutedAt = s.Now()
+	s.trades = append(s.trades, newTrade)
+	return &newTrade, nil
+}
+
+// GetAllTrades returns every trade, newest first
+func (s *Store) GetAllTrades(ctx context.Context) ([]models.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var trades []models.Trade
+	for i := len(s.trades) - 1; i >= 0; i-- {
+		trades = append(trades, s.trades[i])
+	}
+	slices.SortStableFunc(trades, func(a, b models.Trade) int { return b.ExecutedAt.Compare(a.ExecutedAt) })
+	return trades, nil
+}
+
+// GetRecentTrades returns up to limit trades in symbol before trade
+// beforeID, or the latest if it is zero, newest first
+func (s *Store) GetRecentTrades(ctx context.Context, symbol string, beforeID, limit int) ([]models.PublicTrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trades := []models.PublicTrade{}
+	for i := len(s.trades) - 1; i >= 0 && len(trades) < limit; i-- {
+		trade := s.trades[i]
+		buy := s.order(trade.BuyOrderID)
+		if buy == nil || buy.Symbol != symbol || (beforeID != 0 && trade.ID >= beforeID) {
+			continue
+		}
+		trades = append(trades, models.PublicTrade{
+			ID:         trade.ID,
+			Symbol:     buy.Symbol,
+			Price:      trade.Price,
+			Quantity:   trade.Quantity,
+			TakerSide:  trade.TakerSide,
+			ExecutedAt: trade.ExecutedAt,
+		})
+	}
+	return trades, nil
+}
+
+// GetUserTradeHistory returns a page of the trades filling a user's orders
+// matching filter, once for each of the user's orders a trade fills
+func (s *Store) GetUserTradeHistory(ctx context.Context, userID int, filter db.TradeFilter, page db.Page) ([]models.UserTrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trades := []models.UserTrade{}
+	for _, trade := range s.trades {
+		for _, orderID := range []int{trade.BuyOrderID, trade.SellOrderID} {
+			order := s.order(orderID)
+			if order == nil || order.UserID != userID || !filter.Matches(*order, trade) {
+				continue
+			}
+			userTrade := models.UserTrade{
+				ID:         trade.ID,
+				OrderID:    order.ID,
+				Symbol:     order.Symbol,
+				Side:       order.Type,
+				Role:       "maker",
+				Price:      trade.Price,
+				Quantity:   trade.Quantity,
+				Fee:        trade.SellFee,
+				Tag:        order.Tag,
+				ExecutedAt: trade.ExecutedAt,
+			}
+			if order.Type == trade.TakerSide {
+				userTrade.Role = "taker"
+			}
+			if order.ID == trade.BuyOrderID {
+				userTrade.Fee = trade.BuyFee
+			}
+			trades = append(trades, userTrade)
+		}
+	}
+	compare := func(a, b models.UserTrade) int {
+		var c int
+		switch page.Sort {
+		case "price":
+			c = cmp.Compare(a.Price, b.Price)
+		case "quantity":
+			c = cmp.Compare(a.Quantity, b.Quantity)
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		default:
+			c = a.ExecutedAt.Compare(b.ExecutedAt)
+		}
+		return direction(page, cmp.Or(c, cmp.Compare(a.ID, b.ID)))
+	}
+	if page.After != 0 {
+		if page.After < 1 || page.After > len(s.trades) {
+			return []models.UserTrade{}, nil
+		}
+		after := s.trades[page.After-1]
+		cursor := models.UserTrade{ID: after.ID, Price: after.Price, Quantity: after.Quantity, ExecutedAt: after.ExecutedAt}
+		trades = slices.DeleteFunc(trades, func(trade models.UserTrade) bool { return compare(trade, cursor) <= 0 })
+	}
+	slices.SortStableFunc(trades, compare)
+	start, end := page.Window(len(trades))
+	return trades[start:end], nil
+}
+
+// GetFilledQuantities returns the quantity traded so far by each of the
+// given orders, omitting orders without trades
+func (s *Store) GetFilledQuantities(ctx context.Context, orderIDs []int) (map[int]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filled := make(map[int]float64)
+	for _, trade := range s.trades {
+		for _, orderID := range []int{trade.BuyOrderID, trade.SellOrderID} {
+			if slices.Contains(orderIDs, orderID) {
+				filled[orderID] += trade.Quantity
+			}
+		}
+	}
+	return filled, nil
+}
+
+// GetOrderFills returns the fills of one of the user's orders, oldest first
+func (s *Store) GetOrderFills(ctx context.Context, orderID, userID int) ([]models.Fill, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fills(userID, func(trade models.Trade, order models.Order) bool { return order.ID == orderID }), nil
+}
+
+// GetUserFills returns the user's fills of up to limit trades with IDs from
+// fromID onwards, oldest first. A self-trade yields a fill for each side;
+// the limit counts trades, so both are returned together.
+func (s *Store) GetUserFills(ctx context.Context, userID, fromID, limit int) ([]models.Fill, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fills := s.fills(userID, func(trade models.Trade, order models.Order) bool { return trade.ID >= fromID })
+	trades := 0
+	for i, fill := range fills {
+		if i == 0 || fill.TradeID != fills[i-1].TradeID {
+			trades++
+		}
+		if trades > limit {
+			return fills[:i], nil
+		}
+	}
+	return fills, nil
+}
+
+// CreateUser stores a user, returning db.ErrUsernameTaken if the username is
+// registered in any letter case
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return nil, db.ErrUsernameTaken
+		}
+	}
+	user := models.User{
+		ID:           len(s.users) + 1,
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    s.Now(),
+		Role:         "user",
+	}
+	s.users = append(s.users, user)
+	return &user, nil
+}
+
+// GetUserByID returns a user, or db.ErrUserNotFound
+func (s *Store) GetUserByID(ctx context.Context, userID int) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.user(userID)
+	if user == nil {
+		return nil, db.ErrUserNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+// GetUserByUsername returns a user by username, ignoring letter case. Like
+// db.DB, an unknown username is an error wrapping pgx.ErrNoRows.
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get user: %w", pgx.ErrNoRows)
+}
+
+// order returns the stored order with an ID, or nil; callers must hold s.mu
+func (s *Store) order(orderID int) *models.Order {
+	if orderID < 1 || orderID > len(s.orders) {
+		return nil
+	}
+	return &s.orders[orderID-1]
+}
+
+// user returns the stored user with an ID, or nil; callers must hold s.mu
+func (s *Store) user(userID int) *models.User {
+	if userID < 1 || userID > len(s.users) {
+		return nil
+	}
+	return &s.users[userID-1]
+}
+
+// fills returns the fills of the user's orders that match, by trade and
+// then order ID; callers must hold s.mu
+func (s *Store) fills(userID int, match func(models.Trade, models.Order) bool) []models.Fill {
+	var fills []models.Fill
+	for _, trade := range s.trades {
+		orderIDs := []int{trade.BuyOrderID, trade.SellOrderID}
+		slices.Sort(orderIDs)
+		for _, orderID := range orderIDs {
+			order := s.order(orderID)
+			if order == nil || order.UserID != userID || !match(trade, *order) {
+				continue
+			}
+			fill := models.Fill{
+				TradeID:    trade.ID,
+				OrderID:    order.ID,
+				Symbol:     order.Symbol,
+				Side:       order.Type,
+				Role:       "maker",
+				Price:      trade.Price,
+				Quantity:   trade.Quantity,
+				Fee:        trade.SellFee,
+				Tag:        order.Tag,
+				ExecutedAt: trade.ExecutedAt,
+			}
+			if order.Type == trade.TakerSide {
+				fill.Role = "taker"
+			}
+			if order.ID == trade.BuyOrderID {
+				fill.Fee = trade.BuyFee
+			}
+			fills = append(fills, fill)
+		}
+	}
+	return fills
+}
+
+// direction applies a page's sort direction to a comparison
+func direction(page db.Page, c int) int {
+	if page.Desc {
+		return -c
+	}
+	return c
+}
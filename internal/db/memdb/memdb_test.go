@@ -0,0 +1,162 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestStore_Users(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	user, err := s.CreateUser(ctx, "Alice", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, "user", user.Role)
+	_, err = s.CreateUser(ctx, "alice", "hash")
+	assert.ErrorIs(t, err, db.ErrUsernameTaken)
+
+	found, err := s.GetUserByUsername(ctx, "ALICE")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+	_, err = s.GetUserByUsername(ctx, "bob")
+	assert.True(t, errors.Is(err, pgx.ErrNoRows))
+	_, err = s.GetUserByID(ctx, 2)
+	assert.ErrorIs(t, err, db.ErrUserNotFound)
+}
+
+func TestStore_Orders(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	_, err := s.CreateOrder(ctx, &models.Order{UserID: 1, Symbol: "BTC-USD", Type: "buy", Price: 100, Quantity: 1, Status: "open"})
+	assert.Error(t, err, "expected an order for an unknown user to be refused")
+	user, _ := s.CreateUser(ctx, "alice", "hash")
+	_, err = s.CreateOrder(ctx, &models.Order{UserID: user.ID, Symbol: "BTC-USD", Type: "hold", Price: 100, Quantity: 1, Status: "open"})
+	assert.Error(t, err, "expected an invalid order to be refused")
+
+	for _, price := range []float64{102, 100, 101} {
+		_, err := s.CreateOrder(ctx, &models.Order{UserID: user.ID, Symbol: "BTC-USD", Type: "buy", Price: price, Quantity: 1, Status: "open"})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.UpdateOrderStatus(ctx, 2, "canceled"))
+
+	orders, err := s.GetUserOrders(ctx, user.ID, db.OrderFilter{}, db.Page{Sort: "price", Desc: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3, 2}, orderIDs(orders))
+	orders, _ = s.GetUserOrders(ctx, user.ID, db.OrderFilter{Status: "open"}, db.Page{Limit: 1, Offset: 1})
+	assert.Equal(t, []int{3}, orderIDs(orders))
+	orders, _ = s.GetUserOrders(ctx, user.ID, db.OrderFilter{}, db.Page{Sort: "price", Desc: true, After: 1})
+	assert.Equal(t, []int{3, 2}, orderIDs(orders))
+	orders, _ = s.GetUserOrders(ctx, user.ID, db.OrderFilter{}, db.Page{After: 99})
+	assert.Empty(t, orders)
+	open, _ := s.GetOpenOrders(ctx)
+	assert.Equal(t, []int{3, 1}, orderIDs(open))
+
+	_, err = s.GetOrder(ctx, 1, user.ID+1)
+	assert.ErrorIs(t, err, db.ErrOrderNotFound)
+	order, err := s.GetOrderByID(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "canceled", order.Status)
+	orders, _ = s.GetOrdersByIDs(ctx, []int{3, 1, 99})
+	assert.Equal(t, []int{1, 3}, orderIDs(orders))
+
+	tagged, _ := s.CreateOrder(ctx, &models.Order{UserID: user.ID, Symbol: "BTC-USD", Type: "sell", Price: 110, Quantity: 1, Status: "open", ClientOrderID: "bot-1"})
+	order, err = s.GetOrderByClientID(ctx, user.ID, "bot-1")
+	assert.NoError(t, err)
+	assert.Equal(t, tagged.ID, order.ID)
+	_, err = s.GetOrderByClientID(ctx, user.ID+1, "bot-1")
+	assert.ErrorIs(t, err, db.ErrOrderNotFound)
+
+	// Cancels only apply to the owner's open orders
+	assert.NoError(t, s.CancelOrder(ctx, tagged.ID, user.ID))
+	var notOpen *db.OrderNotOpenError
+	if assert.ErrorAs(t, s.CancelOrder(ctx, tagged.ID, user.ID), &notOpen) {
+		assert.Equal(t, "canceled", notOpen.Status)
+	}
+	assert.ErrorIs(t, s.CancelOrder(ctx, 1, user.ID+1), db.ErrOrderNotFound)
+}
+
+func TestStore_Trades(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	alice, _ := s.CreateUser(ctx, "alice", "hash")
+	bob, _ := s.CreateUser(ctx, "bob", "hash")
+	buy, _ := s.CreateOrder(ctx, &models.Order{UserID: alice.ID, Symbol: "BTC-USD", Type: "buy", Price: 100, Quantity: 2, Status: "open"})
+	sell, _ := s.CreateOrder(ctx, &models.Order{UserID: bob.ID, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 2, Status: "filled"})
+	for i := 0; i < 2; i++ {
+		_, err := s.CreateTrade(ctx, &models.Trade{BuyOrderID: buy.ID, SellOrderID: sell.ID, Price: 100, Quantity: 1, TakerSide: "sell", BuyFee: 0.1, SellFee: 0.2})
+		assert.NoError(t, err)
+	}
+
+	recent, err := s.GetRecentTrades(ctx, "BTC-USD", 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, recent, 2) {
+		assert.Equal(t, 2, recent[0].ID)
+	}
+	recent, _ = s.GetRecentTrades(ctx, "BTC-USD", 2, 10)
+	assert.Len(t, recent, 1)
+	recent, _ = s.GetRecentTrades(ctx, "ETH-USD", 0, 10)
+	assert.Empty(t, recent)
+
+	fills, err := s.GetUserTradeHistory(ctx, alice.ID, db.TradeFilter{}, db.Page{})
+	assert.NoError(t, err)
+	if assert.Len(t, fills, 2) {
+		assert.Equal(t, "maker", fills[0].Role)
+		assert.Equal(t, 0.1, fills[0].Fee)
+	}
+	after, _ := s.GetUserTradeHistory(ctx, alice.ID, db.TradeFilter{}, db.Page{After: fills[0].ID})
+	assert.Equal(t, fills[1:], after)
+	since, _ := s.GetUserTradeHistory(ctx, alice.ID, db.TradeFilter{SinceID: fills[0].ID}, db.Page{Sort: "id"})
+	assert.Equal(t, fills[1:], since)
+	fills, _ = s.GetUserTradeHistory(ctx, bob.ID, db.TradeFilter{Type: "buy"}, db.Page{})
+	assert.Empty(t, fills)
+
+	filled, err := s.GetFilledQuantities(ctx, []int{buy.ID, 99})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]float64{buy.ID: 2}, filled)
+	orderFills, err := s.GetOrderFills(ctx, sell.ID, bob.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, orderFills, 2) {
+		assert.Equal(t, "taker", orderFills[0].Role)
+		assert.Equal(t, 0.2, orderFills[0].Fee)
+	}
+	orderFills, _ = s.GetOrderFills(ctx, sell.ID, alice.ID)
+	assert.Empty(t, orderFills)
+	orderFills, _ = s.GetUserFills(ctx, alice.ID, 2, 10)
+	if assert.Len(t, orderFills, 1) {
+		assert.Equal(t, 2, orderFills[0].TradeID)
+	}
+	orderFills, _ = s.GetUserFills(ctx, alice.ID, 0, 1)
+	assert.Len(t, orderFills, 1)
+
+	// A page holds both fills of a self-trade
+	selfBuy, _ := s.CreateOrder(ctx, &models.Order{UserID: alice.ID, Symbol: "BTC-USD", Type: "buy", Price: 100, Quantity: 1, Status: "filled"})
+	selfSell, _ := s.CreateOrder(ctx, &models.Order{UserID: alice.ID, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 1, Status: "filled"})
+	_, err = s.CreateTrade(ctx, &models.Trade{BuyOrderID: selfBuy.ID, SellOrderID: selfSell.ID, Price: 100, Quantity: 1, TakerSide: "sell"})
+	assert.NoError(t, err)
+	orderFills, _ = s.GetUserFills(ctx, alice.ID, 3, 1)
+	if assert.Len(t, orderFills, 2) {
+		assert.Equal(t, orderFills[0].TradeID, orderFills[1].TradeID)
+	}
+}
+
+func orderIDs(orders []models.Order) []int {
+	var ids []int
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/tern/v2/migrate"
+	"github.com/xtrntr/exchange/migrations"
+)
+
+// versionTable records the version of the latest migration applied
+const versionTable = "schema_version"
+
+// MigrationApplied describes a migration run by MigrateTo
+type MigrationApplied func(version int32, name string)
+
+// withMigrator runs fn with a migrator holding the migrations, on a
+// connection of its own
+func (db *DB) withMigrator(ctx context.Context, fn func(*migrate.Migrator) error) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	migrator, err := migrate.NewMigrator(ctx, conn.Conn(), versionTable)
+	if err != nil {
+		return fmt.Errorf("failed to create migrator: %w", err)
+	}
+	if err := migrator.LoadMigrations(migrations.FS); err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return fn(migrator)
+}
+
+// MigrationVersion returns the version of the latest migration applied and
+// of the latest migration there is
+func (db *DB) MigrationVersion(ctx context.Context) (current, latest int32, err error) {
+	err = db.withMigrator(ctx, func(migrator *migrate.Migrator) error {
+		current, err = migrator.GetCurrentVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		latest = int32(len(migrator.Migrations))
+		return nil
+	})
+	return current, latest, err
+}
+
+// MigrateTo applies the migrations after the current version up to target,
+// each in its own transaction, calling applied before each one, and then
+// creates the trades partitions of the current and coming months. A
+// negative target applies every migration. Concurrent callers wait on a
+// lock, so each migration is applied once. Migrations can't be reverted, so
+// a target below the current version fails.
+func (db *DB) MigrateTo(ctx context.Context, target int32, applied MigrationApplied) (int32, error) {
+	var version int32
+	err := db.withMigrator(ctx, func(migrator *migrate.Migrator) error {
+		if target < 0 {
+			target = int32(len(migrator.Migrations))
+		}
+		if applied != nil {
+			migrator.OnStart = func(sequence int32, name, _, _ string) { applied(sequence, name) }
+		}
+		if err := migrator.MigrateTo(ctx, target); err != nil {
+			return fmt.Errorf("failed to migrate: %w", err)
+		}
+		var err error
+		if version, err = migrator.GetCurrentVersion(ctx); err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return version, err
+	}
+	if _, err := db.CreateTradePartitions(ctx, time.Now()); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// Migrate applies every migration not yet applied, returning the version
+func (db *DB) Migrate(ctx context.Context) (int32, error) {
+	return db.MigrateTo(ctx, -1, nil)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// DefaultNotificationPreferences are used for users who haven't saved any:
+// notified of everything, though not by email until they give an address
+var DefaultNotificationPreferences = models.NotificationPreferences{Fills: true, Expiries: true, NewLogins: true}
+
+// GetNotificationPreferences retrieves what a user is notified of, or
+// DefaultNotificationPreferences if they haven't saved any
+func (db *DB) GetNotificationPreferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	prefs := &models.NotificationPreferences{}
+	err := db.Pool.QueryRow(ctx,
+		"SELECT email, fills, expiries, new_logins FROM notification_preferences WHERE user_id = $1",
+		userID).Scan(&prefs.Email, &prefs.Fills, &prefs.Expiries, &prefs.NewLogins)
+	if err == pgx.ErrNoRows {
+		defaults := DefaultNotificationPreferences
+		return &defaults, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// SaveNotificationPreferences creates or replaces what a user is notified of
+func (db *DB) SaveNotificationPreferences(ctx context.Context, userID int, prefs models.NotificationPreferences) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO notification_preferences (user_id, email, fills, expiries, new_logins)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email = EXCLUDED.email,
+			fills = EXCLUDED.fills,
+			expiries = EXCLUDED.expiries,
+			new_logins = EXCLUDED.new_logins,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, prefs.Email, prefs.Fills, prefs.Expiries, prefs.NewLogins)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	return nil
+}
+
+// IsNewLoginIP reports whether a user has logged in before, but never from
+// ip. Call it before creating the session of the login being checked.
+func (db *DB) IsNewLoginIP(ctx context.Context, userID int, ip string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var loggedIn, seen bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sessions WHERE user_id = $1),
+			EXISTS (SELECT 1 FROM sessions WHERE user_id = $1 AND ip = $2)`,
+		userID, ip).Scan(&loggedIn, &seen)
+	if err != nil {
+		return false, fmt.Errorf("failed to check login IP: %w", err)
+	}
+	return loggedIn && !seen, nil
+}
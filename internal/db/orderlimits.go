@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// GetOrderLimits retrieves a user's per-order limits, or zero (unlimited)
+// limits if none are set
+func (db *DB) GetOrderLimits(ctx context.Context, userID int) (*models.OrderLimits, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	limits := &models.OrderLimits{}
+	err := db.Pool.QueryRow(ctx,
+		"SELECT max_order_notional, max_order_quantity, max_open_orders FROM user_order_limits WHERE user_id = $1",
+		userID).Scan(&limits.MaxOrderNotional, &limits.MaxOrderQuantity, &limits.MaxOpenOrders)
+	if err == pgx.ErrNoRows {
+		return &models.OrderLimits{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order limits: %w", err)
+	}
+	return limits, nil
+}
+
+// SaveOrderLimits creates or replaces a user's per-order limits
+func (db *DB) SaveOrderLimits(ctx context.Context, userID int, limits models.OrderLimits) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO user_order_limits (user_id, max_order_notional, max_order_quantity, max_open_orders)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			max_order_notional = EXCLUDED.max_order_notional,
+			max_order_quantity = EXCLUDED.max_order_quantity,
+			max_open_orders = EXCLUDED.max_open_orders,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, limits.MaxOrderNotional, limits.MaxOrderQuantity, limits.MaxOpenOrders)
+	if err != nil {
+		return fmt.Errorf("failed to save order limits: %w", err)
+	}
+	return nil
+}
+
+// CountOpenOrders returns how many of the user's orders are open
+func (db *DB) CountOpenOrders(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.Pool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = 'open'",
+		userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count open orders: %w", err)
+	}
+	return count, nil
+}
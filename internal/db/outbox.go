@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Outbox topics. Order events go to OrdersTopic followed by the event, e.g.
+// "orders.canceled".
+const (
+	OrdersTopic = "orders" // models.OrderEvent
+	TradesTopic = "trades" // models.AccountingTrade
+)
+
+// OutboxEvent is an order event or trade waiting to be streamed, with its
+// JSON payload
+type OutboxEvent struct {
+	ID        int64
+	Topic     string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// queueEvent writes v, encoded as JSON, to the outbox under topic in tx
+func queueEvent(ctx context.Context, tx pgx.Tx, topic string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox event: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO outbox_events (topic, payload) VALUES ($1, $2)", topic, data); err != nil {
+		return fmt.Errorf("failed to queue outbox event: %w", err)
+	}
+	return nil
+}
+
+type cancelReasonKey struct{}
+
+// WithCancelReason returns a context recording why the orders canceled with
+// it were canceled, e.g. "disconnected", in their events
+func WithCancelReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, cancelReasonKey{}, reason)
+}
+
+// CancelReasonFrom returns the reason WithCancelReason recorded in ctx, or
+// "" if none
+func CancelReasonFrom(ctx context.Context) string {
+	reason, _ := ctx.Value(cancelReasonKey{}).(string)
+	return reason
+}
+
+// queueOrderEvents writes an event for each of the orders, as they stand in
+// tx, to the outbox if it is enabled, and queues deliveries of the events
+// webhooks are sent to the owners' webhooks
+func (db *DB) queueOrderEvents(ctx context.Context, tx pgx.Tx, event string, orderIDs []int) error {
+	if (!db.Outbox && !WebhookEvents[event]) || len(orderIDs) == 0 {
+		return nil
+	}
+	orderEvents, err := getOrderEvents(ctx, tx, event, orderIDs)
+	if err != nil {
+		return err
+	}
+	for _, e := range orderEvents {
+		if db.Outbox {
+			if err := queueEvent(ctx, tx, OrdersTopic+"."+event, e); err != nil {
+				return err
+			}
+		}
+		if WebhookEvents[event] {
+			if err := queueWebhookDeliveries(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getOrderEvents describes an event for each of the orders as they stand in
+// tx. Canceled orders carry the reason in ctx, if any.
+func getOrderEvents(ctx context.Context, tx pgx.Tx, event string, orderIDs []int) ([]models.OrderEvent, error) {
+	rows, err := tx.Query(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = ANY($1) ORDER BY id", orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order rows: %w", err)
+	}
+
+	filled, err := getFilledQuantities(ctx, tx, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var reason string
+	if event == "canceled" {
+		reason = CancelReasonFrom(ctx)
+	}
+	now := time.Now()
+	orderEvents := make([]models.OrderEvent, 0, len(orders))
+	for _, order := range orders {
+		orderEvents = append(orderEvents, models.OrderEvent{
+			OrderUpdate: models.OrderUpdate{
+				Event:          event,
+				OrderID:        order.ID,
+				UserID:         order.UserID,
+				Symbol:         order.Symbol,
+				Side:           order.Type,
+				Price:          order.Price,
+				Quantity:       order.Quantity,
+				FilledQuantity: filled[order.ID],
+				Status:         order.Status,
+				Tag:            order.Tag,
+				ClientOrderID:  order.ClientOrderID,
+				Reason:         reason,
+				Time:           now,
+			},
+			UserID: order.UserID,
+		})
+	}
+	return orderEvents, nil
+}
+
+// queueTrade writes a trade to the outbox in tx if it is enabled
+func (db *DB) queueTrade(ctx context.Context, tx pgx.Tx, trade models.Trade) error {
+	if !db.Outbox {
+		return nil
+	}
+	var symbol string
+	err := tx.QueryRow(ctx,
+		"SELECT b.symbol, b.user_id, s.user_id FROM orders b, orders s WHERE b.id = $1 AND s.id = $2",
+		trade.BuyOrderID, trade.SellOrderID).Scan(&symbol, &trade.BuyUserID, &trade.SellUserID)
+	if err != nil {
+		return fmt.Errorf("failed to get trade orders: %w", err)
+	}
+	return queueEvent(ctx, tx, TradesTopic, accountingTrade(trade, symbol))
+}
+
+// GetUndeliveredOutboxEvents retrieves up to limit events that haven't been
+// delivered, oldest first
+func (db *DB) GetUndeliveredOutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, topic, payload, created_at FROM outbox_events WHERE delivered_at IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		var event OutboxEvent
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox event rows: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventsDelivered records that the events have been delivered
+func (db *DB) MarkOutboxEventsDelivered(ctx context.Context, ids []int64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx,
+		"UPDATE outbox_events SET delivered_at = CURRENT_TIMESTAMP WHERE id = ANY($1) AND delivered_at IS NULL", ids)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox events delivered: %w", err)
+	}
+	return nil
+}
+
+// PruneOutboxEvents deletes events delivered before a time, returning how
+// many were deleted
+func (db *DB) PruneOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM outbox_events WHERE delivered_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
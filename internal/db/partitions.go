@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TradePartitionsAhead is how many months after the current one
+// CreateTradePartitions prepares, so trades never wait on a new partition
+const TradePartitionsAhead = 3
+
+// tradePartitionName names the partition holding the trades of a month
+func tradePartitionName(month time.Time) string {
+	return fmt.Sprintf("trades_%04d_%02d", month.Year(), int(month.Month()))
+}
+
+// CreateTradePartitions creates the monthly partitions of trades for the
+// month containing now and the TradePartitionsAhead months after it, moving
+// any of their trades out of the default partition, and returns the names
+// of those it created. It does nothing before trades is partitioned.
+func (db *DB) CreateTradePartitions(ctx context.Context, now time.Time) ([]string, error) {
+	var partitioned bool
+	err := db.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'trades'::regclass)").Scan(&partitioned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check trades partitioning: %w", err)
+	}
+	if !partitioned {
+		return nil, nil
+	}
+
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var created []string
+	for i := 0; i <= TradePartitionsAhead; i++ {
+		ok, err := db.createTradePartition(ctx, month.AddDate(0, i, 0))
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created = append(created, tradePartitionName(month.AddDate(0, i, 0)))
+		}
+	}
+	return created, nil
+}
+
+// createTradePartition creates the partition of the month starting at
+// start unless it exists, reporting whether it did. Trades of the month
+// already in the default partition are moved into it before it is attached,
+// as the default partition can't hold trades of an attached month.
+func (db *DB) createTradePartition(ctx context.Context, start time.Time) (bool, error) {
+	name := tradePartitionName(start)
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize with other servers creating the same partition
+	if _, err := tx.Exec(ctx, "LOCK TABLE trades_default IN EXCLUSIVE MODE"); err != nil {
+		return false, fmt.Errorf("failed to lock default trades partition: %w", err)
+	}
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	table := pgx.Identifier{name}.Sanitize()
+	end := start.AddDate(0, 1, 0)
+	if _, err := tx.Exec(ctx, "CREATE TABLE "+table+" (LIKE trades INCLUDING DEFAULTS INCLUDING CONSTRAINTS)"); err != nil {
+		return false, fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+	_, err = tx.Exec(ctx, `
+		WITH moved AS (DELETE FROM trades_default WHERE executed_at >= $1 AND executed_at < $2 RETURNING *)
+		INSERT INTO `+table+` SELECT * FROM moved`, start, end)
+	if err != nil {
+		return false, fmt.Errorf("failed to move trades into partition %s: %w", name, err)
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("ALTER TABLE trades ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+		table, start.Format(time.DateOnly), end.Format(time.DateOnly)))
+	if err != nil {
+		return false, fmt.Errorf("failed to attach partition %s: %w", name, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// DefaultPreferences are used for users who haven't saved any
+var DefaultPreferences = models.Preferences{DefaultTimeInForce: "GTC"}
+
+// GetPreferences retrieves a user's order defaults, or DefaultPreferences if none are saved
+func (db *DB) GetPreferences(ctx context.Context, userID int) (*models.Preferences, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	prefs := &models.Preferences{}
+	err := db.Pool.QueryRow(ctx,
+		"SELECT default_time_in_force, default_post_only, confirm_notional_above FROM user_preferences WHERE user_id = $1",
+		userID).Scan(&prefs.DefaultTimeInForce, &prefs.DefaultPostOnly, &prefs.ConfirmNotionalAbove)
+	if err == pgx.ErrNoRows {
+		defaults := DefaultPreferences
+		return &defaults, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// SavePreferences creates or replaces a user's order defaults
+func (db *DB) SavePreferences(ctx context.Context, userID int, prefs models.Preferences) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO user_preferences (user_id, default_time_in_force, default_post_only, confirm_notional_above)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			default_time_in_force = EXCLUDED.default_time_in_force,
+			default_post_only = EXCLUDED.default_post_only,
+			confirm_notional_above = EXCLUDED.confirm_notional_above,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, prefs.DefaultTimeInForce, prefs.DefaultPostOnly, prefs.ConfirmNotionalAbove)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// GetTradesBetween returns the trades executed from start until end, with
+// both accounts, in execution order
+func (db *DB) GetTradesBetween(ctx context.Context, start, end time.Time) ([]models.ReportedTrade, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+tradeColumns+`, b.symbol, b.user_id, s.user_id, bu.username, su.username
+		FROM trades t
+		JOIN orders b ON b.id = t.buy_order_id
+		JOIN orders s ON s.id = t.sell_order_id
+		JOIN users bu ON bu.id = b.user_id
+		JOIN users su ON su.id = s.user_id
+		WHERE t.executed_at >= $1 AND t.executed_at < $2
+		ORDER BY t.executed_at, t.id`,
+		start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades := []models.ReportedTrade{}
+	for rows.Next() {
+		var trade models.Trade
+		var reported models.ReportedTrade
+		err := scanTrade(rows, &trade, &reported.Symbol, &reported.BuyUserID, &reported.SellUserID, &reported.BuyUsername, &reported.SellUsername)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		reported.ID = trade.ID
+		reported.BuyOrderID = trade.BuyOrderID
+		reported.SellOrderID = trade.SellOrderID
+		reported.Price = trade.Price
+		reported.Quantity = trade.Quantity
+		reported.BuyFee = trade.BuyFee
+		reported.SellFee = trade.SellFee
+		reported.TakerSide = trade.TakerSide
+		reported.ExecutedAt = trade.ExecutedAt
+		trades = append(trades, reported)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trade rows: %w", err)
+	}
+	return trades, nil
+}
+
+// tradeReportColumns is the column list scanned by scanTradeReport
+const tradeReportColumns = "to_char(day, 'YYYY-MM-DD'), name, trades, generated_at"
+
+func scanTradeReport(row pgx.Row, report *models.TradeReport) error {
+	return row.Scan(&report.Day, &report.Name, &report.Trades, &report.GeneratedAt)
+}
+
+// SaveTradeReport records a generated trade report, replacing any earlier
+// report for the same day
+func (db *DB) SaveTradeReport(ctx context.Context, report *models.TradeReport) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO trade_reports (day, name, trades) VALUES ($1::date, $2, $3)
+		ON CONFLICT (day) DO UPDATE SET name = EXCLUDED.name, trades = EXCLUDED.trades, generated_at = CURRENT_TIMESTAMP
+		RETURNING generated_at`,
+		report.Day, report.Name, report.Trades).Scan(&report.GeneratedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save trade report: %w", err)
+	}
+	return nil
+}
+
+// GetTradeReport returns the report generated for a day, or nil if there is none
+func (db *DB) GetTradeReport(ctx context.Context, day string) (*models.TradeReport, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	report := &models.TradeReport{}
+	err := scanTradeReport(db.Pool.QueryRow(ctx, "SELECT "+tradeReportColumns+" FROM trade_reports WHERE day = $1::date", day), report)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade report: %w", err)
+	}
+	return report, nil
+}
+
+// GetTradeReports returns the latest trade reports, newest day first
+func (db *DB) GetTradeReports(ctx context.Context, limit int) ([]models.TradeReport, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, "SELECT "+tradeReportColumns+" FROM trade_reports ORDER BY day DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.TradeReport{}
+	for rows.Next() {
+		var report models.TradeReport
+		if err := scanTradeReport(rows, &report); err != nil {
+			return nil, fmt.Errorf("failed to scan trade report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trade report rows: %w", err)
+	}
+	return reports, nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Retries of transient connection errors
+const (
+	retryAttempts   = 6
+	retryBackoff    = 100 * time.Millisecond // Before the first retry, doubling after each
+	maxRetryBackoff = 2 * time.Second
+)
+
+// isTransient reports whether an error is a failure to reach the database
+// that may clear up, from before a statement was sent, so retrying can't
+// apply it twice
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, and a server still starting up
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P03"
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || pgconn.SafeToRetry(err)
+}
+
+// retry runs op until it succeeds, fails with an error that isn't transient,
+// or has run retryAttempts times, backing off between attempts. Lookups made
+// on every request, like loading the user, go through it so a brief outage
+// doesn't fail them.
+func retry(ctx context.Context, op func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt == retryAttempts || !isTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
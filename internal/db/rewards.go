@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// RewardsAccount is the system account rewards are paid from
+const RewardsAccount = "rewards"
+
+// SnapshotBalances records the balance in asset of every user who has held
+// it, including balances that have gone back to zero. Returns how many
+// balances were recorded.
+func (db *DB) SnapshotBalances(ctx context.Context, asset string, takenAt time.Time) (int, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO balance_snapshots (user_id, asset, amount, taken_at)
+		SELECT user_id, asset, SUM(amount), $2
+		FROM ledger_entries
+		WHERE user_id IS NOT NULL AND asset = $1
+		GROUP BY user_id, asset`,
+		asset, takenAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snapshot balances: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetBalanceSnapshots returns each user's snapshots in asset taken from
+// start until end, in time order, preceded by their latest snapshot before
+// start, which is their balance at the start
+func (db *DB) GetBalanceSnapshots(ctx context.Context, asset string, start, end time.Time) (map[int][]models.BalanceSnapshot, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT user_id, amount, taken_at FROM (
+			SELECT user_id, amount, taken_at FROM balance_snapshots
+			WHERE asset = $1 AND taken_at >= $2 AND taken_at < $3
+			UNION ALL
+			(SELECT DISTINCT ON (user_id) user_id, amount, taken_at FROM balance_snapshots
+			 WHERE asset = $1 AND taken_at < $2
+			 ORDER BY user_id, taken_at DESC)
+		) s
+		ORDER BY user_id, taken_at`,
+		asset, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := make(map[int][]models.BalanceSnapshot)
+	for rows.Next() {
+		snapshot := models.BalanceSnapshot{Asset: asset}
+		if err := rows.Scan(&snapshot.UserID, &snapshot.Amount, &snapshot.TakenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan balance snapshot: %w", err)
+		}
+		snapshots[snapshot.UserID] = append(snapshots[snapshot.UserID], snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating balance snapshot rows: %w", err)
+	}
+	return snapshots, nil
+}
+
+// PruneBalanceSnapshots deletes snapshots in asset taken before a time,
+// except each user's latest one, which is still their balance at that time
+func (db *DB) PruneBalanceSnapshots(ctx context.Context, asset string, before time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		DELETE FROM balance_snapshots b
+		WHERE asset = $1 AND taken_at < $2
+		AND EXISTS (
+			SELECT 1 FROM balance_snapshots later
+			WHERE later.user_id = b.user_id AND later.asset = b.asset
+			AND later.taken_at > b.taken_at AND later.taken_at < $2
+		)`,
+		asset, before)
+	if err != nil {
+		return fmt.Errorf("failed to prune balance snapshots: %w", err)
+	}
+	return nil
+}
+
+// GetLastRewardPeriodEnd returns the end of the latest period rewards in
+// asset were accrued for, or the zero time if none were
+func (db *DB) GetLastRewardPeriodEnd(ctx context.Context, asset string) (time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var end *time.Time
+	err := db.Pool.QueryRow(ctx, "SELECT MAX(period_end) FROM reward_periods WHERE asset = $1", asset).Scan(&end)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last reward period: %w", err)
+	}
+	if end == nil {
+		return time.Time{}, nil
+	}
+	return *end, nil
+}
+
+// CreditRewards records the accrual period from start to end for asset and
+// credits each accrual to its user from the rewards account, all in one
+// transaction. Returns false, crediting nothing, if the period was already
+// accrued.
+func (db *DB) CreditRewards(ctx context.Context, asset string, start, end time.Time, accruals []models.RewardAccrual) (bool, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var periodID int
+	err = tx.QueryRow(ctx,
+		"INSERT INTO reward_periods (asset, period_start, period_end, users) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (asset, period_end) DO NOTHING RETURNING id",
+		asset, start, end, len(accruals)).Scan(&periodID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record reward period: %w", err)
+	}
+
+	for _, accrual := range accruals {
+		var id int
+		err := tx.QueryRow(ctx,
+			"INSERT INTO reward_accruals (period_id, user_id, asset, payout_asset, period_start, period_end, average_balance, rate, amount) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+			periodID, accrual.UserID, asset, accrual.PayoutAsset, start, end, accrual.AverageBalance, accrual.Rate, accrual.Amount).Scan(&id)
+		if err != nil {
+			return false, fmt.Errorf("failed to record reward accrual: %w", err)
+		}
+		err = postEntries(ctx, tx, "reward", fmt.Sprintf("reward:%d", id), []models.LedgerEntry{
+			{UserID: accrual.UserID, Asset: accrual.PayoutAsset, Amount: accrual.Amount},
+			{Account: RewardsAccount, Asset: accrual.PayoutAsset, Amount: -accrual.Amount},
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// GetRewardAccruals returns a user's latest reward accruals, newest first
+func (db *DB) GetRewardAccruals(ctx context.Context, userID, limit int) ([]models.RewardAccrual, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, user_id, asset, payout_asset, period_start, period_end, average_balance, rate, amount, created_at "+
+			"FROM reward_accruals WHERE user_id = $1 ORDER BY id DESC LIMIT $2",
+		userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reward accruals: %w", err)
+	}
+	defer rows.Close()
+
+	accruals := []models.RewardAccrual{}
+	for rows.Next() {
+		var a models.RewardAccrual
+		err := rows.Scan(&a.ID, &a.UserID, &a.Asset, &a.PayoutAsset, &a.PeriodStart, &a.PeriodEnd,
+			&a.AverageBalance, &a.Rate, &a.Amount, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reward accrual: %w", err)
+		}
+		accruals = append(accruals, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reward accrual rows: %w", err)
+	}
+	return accruals, nil
+}
+
+// GetRewardTotals returns the total rewards credited to a user in each
+// payout asset, ordered by asset
+func (db *DB) GetRewardTotals(ctx context.Context, userID int) ([]models.Balance, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT payout_asset, SUM(amount) FROM reward_accruals WHERE user_id = $1 GROUP BY payout_asset ORDER BY payout_asset",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reward totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []models.Balance{}
+	for rows.Next() {
+		var total models.Balance
+		if err := rows.Scan(&total.Asset, &total.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan reward total: %w", err)
+		}
+		totals = append(totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reward total rows: %w", err)
+	}
+	return totals, nil
+}
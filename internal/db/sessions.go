@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrSessionNotFound is returned when a session doesn't exist, has ended, or
+// belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession starts a session for a user logging in from ip with
+// userAgent, lasting until expiresAt
+func (db *DB) CreateSession(ctx context.Context, userID int, ip, userAgent string, expiresAt time.Time) (*models.Session, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	session := &models.Session{UserID: userID, IP: ip, UserAgent: userAgent, ExpiresAt: expiresAt}
+	err := db.Pool.QueryRow(ctx,
+		"INSERT INTO sessions (user_id, ip, user_agent, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		userID, ip, userAgent, expiresAt).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, nil
+}
+
+// SessionActive reports whether a user's session has neither expired nor
+// been revoked
+func (db *DB) SessionActive(ctx context.Context, sessionID, userID int) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := retry(ctx, func() error {
+		return db.Pool.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP)`,
+			sessionID, userID).Scan(&active)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
+
+// GetUserSessions returns a user's active sessions, newest first
+func (db *DB) GetUserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_id, ip, user_agent, created_at, expires_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY id DESC`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.IP, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session rows: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of a user's active sessions, so its token is no
+// longer accepted
+func (db *DB) RevokeSession(ctx context.Context, sessionID, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`,
+		sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// settlementColumns is the column list scanned by scanSettlement
+const settlementColumns = "symbol, to_char(day, 'YYYY-MM-DD'), price, method, volume, trades, calculated_at"
+
+func scanSettlement(row pgx.Row, settlement *models.Settlement) error {
+	return row.Scan(&settlement.Symbol, &settlement.Day, &settlement.Price, &settlement.Method,
+		&settlement.Volume, &settlement.Trades, &settlement.CalculatedAt)
+}
+
+// SaveSettlement records a settlement price, replacing any earlier
+// settlement of the instrument for the same day
+func (db *DB) SaveSettlement(ctx context.Context, settlement *models.Settlement) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO settlements (symbol, day, price, method, volume, trades) VALUES ($1, $2::date, $3, $4, $5, $6)
+		ON CONFLICT (symbol, day) DO UPDATE SET price = EXCLUDED.price, method = EXCLUDED.method,
+			volume = EXCLUDED.volume, trades = EXCLUDED.trades, calculated_at = CURRENT_TIMESTAMP
+		RETURNING calculated_at`,
+		settlement.Symbol, settlement.Day, settlement.Price, settlement.Method, settlement.Volume, settlement.Trades,
+	).Scan(&settlement.CalculatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save settlement: %w", err)
+	}
+	return nil
+}
+
+// getSettlement returns the first settlement matching a condition on the
+// instrument's settlements, or nil if there is none
+func (db *DB) getSettlement(ctx context.Context, where string, args ...interface{}) (*models.Settlement, error) {
+	settlement := &models.Settlement{}
+	err := scanSettlement(db.Pool.QueryRow(ctx, "SELECT "+settlementColumns+" FROM settlements WHERE "+where, args...), settlement)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settlement: %w", err)
+	}
+	return settlement, nil
+}
+
+// GetSettlement returns an instrument's settlement for a day, or nil if it
+// hasn't been settled
+func (db *DB) GetSettlement(ctx context.Context, symbol, day string) (*models.Settlement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.getSettlement(ctx, "symbol = $1 AND day = $2::date", symbol, day)
+}
+
+// GetPreviousSettlement returns an instrument's latest settlement before a
+// day, or nil if there is none
+func (db *DB) GetPreviousSettlement(ctx context.Context, symbol, day string) (*models.Settlement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.getSettlement(ctx, "symbol = $1 AND day < $2::date ORDER BY day DESC LIMIT 1", symbol, day)
+}
+
+// GetSettlements returns an instrument's latest settlements, newest day first
+func (db *DB) GetSettlements(ctx context.Context, symbol string, limit int) ([]models.Settlement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT "+settlementColumns+" FROM settlements WHERE symbol = $1 ORDER BY day DESC LIMIT $2", symbol, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settlements: %w", err)
+	}
+	defer rows.Close()
+
+	settlements := []models.Settlement{}
+	for rows.Next() {
+		var settlement models.Settlement
+		if err := scanSettlement(rows, &settlement); err != nil {
+			return nil, fmt.Errorf("failed to scan settlement: %w", err)
+		}
+		settlements = append(settlements, settlement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating settlement rows: %w", err)
+	}
+	return settlements, nil
+}
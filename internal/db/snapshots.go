@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// keptSnapshots is how many of the latest book snapshots are kept
+const keptSnapshots = 5
+
+// BookSnapshot is a serialized order book, the journal sequence number it
+// reflects and the highest order ID created before it
+type BookSnapshot struct {
+	ID          int
+	Seq         int64
+	LastOrderID int
+	State       []byte
+	CreatedAt   time.Time
+}
+
+// SaveBookSnapshot stores a snapshot of the order book and prunes all but
+// the latest few
+func (db *DB) SaveBookSnapshot(ctx context.Context, seq int64, lastOrderID int, state []byte) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "INSERT INTO book_snapshots (seq, last_order_id, state) VALUES ($1, $2, $3)", seq, lastOrderID, state); err != nil {
+		return fmt.Errorf("failed to save book snapshot: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM book_snapshots WHERE id NOT IN (
+			SELECT id FROM book_snapshots ORDER BY id DESC LIMIT $1
+		)`, keptSnapshots)
+	if err != nil {
+		return fmt.Errorf("failed to prune book snapshots: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetLatestBookSnapshot retrieves the most recent snapshot, or nil if there are none
+func (db *DB) GetLatestBookSnapshot(ctx context.Context) (*BookSnapshot, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	snapshot := &BookSnapshot{}
+	err := db.Pool.QueryRow(ctx,
+		"SELECT id, seq, last_order_id, state, created_at FROM book_snapshots ORDER BY id DESC LIMIT 1").
+		Scan(&snapshot.ID, &snapshot.Seq, &snapshot.LastOrderID, &snapshot.State, &snapshot.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// DeleteBookSnapshots discards every book snapshot, for the next start to
+// load the book from the open orders instead, e.g. after orders were
+// written without going through the server
+func (db *DB) DeleteBookSnapshots(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, "DELETE FROM book_snapshots"); err != nil {
+		return fmt.Errorf("failed to delete book snapshots: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// GetLedgerUserIDs returns the users with ledger entries posted before a
+// time, i.e. everyone who had an account balance by then, ordered by ID
+func (db *DB) GetLedgerUserIDs(ctx context.Context, before time.Time) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT DISTINCT user_id FROM ledger_entries WHERE user_id IS NOT NULL AND created_at < $1 ORDER BY user_id", before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	return userIDs, nil
+}
+
+// SaveStatement stores a user's statement, replacing any earlier statement
+// of the same day, and sets when it was generated
+func (db *DB) SaveStatement(ctx context.Context, statement *models.Statement) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	content, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to encode statement: %w", err)
+	}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO statements (user_id, day, statement) VALUES ($1, $2::date, $3)
+		ON CONFLICT (user_id, day) DO UPDATE SET statement = EXCLUDED.statement, generated_at = CURRENT_TIMESTAMP
+		RETURNING generated_at`,
+		statement.UserID, statement.Day, content,
+	).Scan(&statement.GeneratedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save statement: %w", err)
+	}
+	return nil
+}
+
+// scanStatement decodes a stored statement
+func scanStatement(row pgx.Row, statement *models.Statement) error {
+	var userID int
+	var content []byte
+	var generatedAt time.Time
+	if err := row.Scan(&userID, &content, &generatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, statement); err != nil {
+		return fmt.Errorf("invalid stored statement: %w", err)
+	}
+	statement.UserID, statement.GeneratedAt = userID, generatedAt
+	return nil
+}
+
+// GetStatement returns a user's statement for a day, or nil if none was
+// generated
+func (db *DB) GetStatement(ctx context.Context, userID int, day string) (*models.Statement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	statement := &models.Statement{}
+	err := scanStatement(db.Pool.QueryRow(ctx,
+		"SELECT user_id, statement, generated_at FROM statements WHERE user_id = $1 AND day = $2::date", userID, day), statement)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statement: %w", err)
+	}
+	return statement, nil
+}
+
+// GetStatements returns a user's latest statements, newest day first
+func (db *DB) GetStatements(ctx context.Context, userID, limit int) ([]models.Statement, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT user_id, statement, generated_at FROM statements WHERE user_id = $1 ORDER BY day DESC LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statements: %w", err)
+	}
+	defer rows.Close()
+
+	statements := []models.Statement{}
+	for rows.Next() {
+		var statement models.Statement
+		if err := scanStatement(rows, &statement); err != nil {
+			return nil, fmt.Errorf("failed to scan statement: %w", err)
+		}
+		statements = append(statements, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating statement rows: %w", err)
+	}
+	return statements, nil
+}
+
+// StatementsGenerated reports whether any statement of a day was generated
+func (db *DB) StatementsGenerated(ctx context.Context, day string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM statements WHERE day = $1::date)", day).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check statements: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// OrderStore persists orders
+type OrderStore interface {
+	CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error)
+	GetOrder(ctx context.Context, orderID, userID int) (*models.Order, error)
+	GetOrderByID(ctx context.Context, orderID int) (*models.Order, error)
+	GetOrderByClientID(ctx context.Context, userID int, clientOrderID string) (*models.Order, error)
+	GetOrdersByIDs(ctx context.Context, orderIDs []int) ([]models.Order, error)
+	GetUserOrders(ctx context.Context, userID int, filter OrderFilter, page Page) ([]models.Order, error)
+	GetOpenOrders(ctx context.Context) ([]models.Order, error)
+	GetBookOrders(ctx context.Context) ([]models.Order, error)
+	UpdateOrderStatus(ctx context.Context, orderID int, status string) error
+	CancelOrder(ctx context.Context, orderID, userID int) error
+}
+
+// TradeStore persists trades
+type TradeStore interface {
+	CreateTrade(ctx context.Context, trade *models.Trade) (*models.Trade, error)
+	GetAllTrades(ctx context.Context) ([]models.Trade, error)
+	GetRecentTrades(ctx context.Context, symbol string, beforeID, limit int) ([]models.PublicTrade, error)
+	GetUserTradeHistory(ctx context.Context, userID int, filter TradeFilter, page Page) ([]models.UserTrade, error)
+	GetFilledQuantities(ctx context.Context, orderIDs []int) (map[int]float64, error)
+	GetOrderFills(ctx context.Context, orderID, userID int) ([]models.Fill, error)
+	GetUserFills(ctx context.Context, userID, fromID, limit int) ([]models.Fill, error)
+}
+
+// UserStore persists user accounts
+type UserStore interface {
+	CreateUser(ctx context.Context, username, passwordHash string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID int) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+}
+
+// Store persists orders, trades and users. DB stores them in PostgreSQL;
+// memdb keeps them in memory for tests that don't need a database.
+type Store interface {
+	OrderStore
+	TradeStore
+	UserStore
+}
+
+var _ Store = (*DB)(nil)
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrAlertNotFound is returned for unknown surveillance alerts
+var ErrAlertNotFound = errors.New("surveillance alert not found")
+
+// ErrAlertResolved is returned when resolving an alert already resolved
+var ErrAlertResolved = errors.New("surveillance alert already resolved")
+
+// AlertFilter narrows the surveillance alerts listed. Zero values match
+// every alert.
+type AlertFilter struct {
+	Status string
+	Kind   string
+	UserID int
+}
+
+// alertColumns is the column list scanned by scanAlert, from
+// surveillance_alerts a joined to users u
+const alertColumns = `a.id, a.user_id, u.username, a.kind, a.symbol, a.hour, a.description, a.details, a.status,
+	a.note, a.resolved_by, a.resolved_at, a.created_at`
+
+func scanAlert(row pgx.Row, alert *models.SurveillanceAlert) error {
+	return row.Scan(&alert.ID, &alert.UserID, &alert.Username, &alert.Kind, &alert.Symbol, &alert.Hour, &alert.Description,
+		&alert.Details, &alert.Status, &alert.Note, &alert.ResolvedBy, &alert.ResolvedAt, &alert.CreatedAt)
+}
+
+// GetOrderChurn returns, for each user who placed, canceled or amended
+// orders from start until end, how many orders they placed, how many they
+// canceled within quickCancel of placing them, and how many amendments
+// they made
+func (db *DB) GetOrderChurn(ctx context.Context, start, end time.Time, quickCancel time.Duration) ([]models.OrderChurn, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.reader().Query(ctx, `
+		WITH placed AS (
+			SELECT user_id, COUNT(*) AS n FROM orders
+			WHERE created_at >= $1 AND created_at < $2
+			GROUP BY user_id
+		), changed AS (
+			SELECT a.actor_id AS user_id,
+				COUNT(*) FILTER (WHERE a.action = 'order.canceled' AND a.created_at - o.created_at < make_interval(secs => $3)) AS quick_cancels,
+				COUNT(*) FILTER (WHERE a.action = 'order.amended') AS amends
+			FROM audit_log a JOIN orders o ON o.id = a.entity_id AND o.user_id = a.actor_id
+			WHERE a.created_at >= $1 AND a.created_at < $2 AND a.entity_type = 'order'
+				AND a.action IN ('order.canceled', 'order.amended')
+			GROUP BY a.actor_id
+		)
+		SELECT COALESCE(p.user_id, c.user_id), COALESCE(p.n, 0), COALESCE(c.quick_cancels, 0), COALESCE(c.amends, 0)
+		FROM placed p FULL JOIN changed c ON c.user_id = p.user_id
+		ORDER BY 1`,
+		start, end, quickCancel.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order churn: %w", err)
+	}
+	defer rows.Close()
+
+	churn := []models.OrderChurn{}
+	for rows.Next() {
+		var c models.OrderChurn
+		if err := rows.Scan(&c.UserID, &c.Placed, &c.QuickCancels, &c.Amends); err != nil {
+			return nil, fmt.Errorf("failed to scan order churn: %w", err)
+		}
+		churn = append(churn, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order churn rows: %w", err)
+	}
+	return churn, nil
+}
+
+// GetLatestSurveillanceHour returns the latest hour surveillance scanned, or
+// the zero time if it hasn't scanned any
+func (db *DB) GetLatestSurveillanceHour(ctx context.Context) (time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var hour *time.Time
+	if err := db.Pool.QueryRow(ctx, "SELECT MAX(hour) FROM surveillance_scans").Scan(&hour); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest surveillance hour: %w", err)
+	}
+	if hour == nil {
+		return time.Time{}, nil
+	}
+	return *hour, nil
+}
+
+// SaveSurveillanceScan records that an hour was scanned and the alerts it
+// raised, skipping alerts already raised for the hour. Returns how many
+// alerts were new.
+func (db *DB) SaveSurveillanceScan(ctx context.Context, hour time.Time, alerts []models.SurveillanceAlert) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	raised := 0
+	for _, alert := range alerts {
+		details, err := json.Marshal(alert.Details)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal alert details: %w", err)
+		}
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO surveillance_alerts (user_id, kind, symbol, hour, description, details)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id, kind, symbol, hour) DO NOTHING`,
+			alert.UserID, alert.Kind, alert.Symbol, hour, alert.Description, details)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save surveillance alert: %w", err)
+		}
+		raised += int(tag.RowsAffected())
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO surveillance_scans (hour, alerts) VALUES ($1, $2)
+		ON CONFLICT (hour) DO UPDATE SET alerts = EXCLUDED.alerts, scanned_at = CURRENT_TIMESTAMP`,
+		hour, len(alerts))
+	if err != nil {
+		return 0, fmt.Errorf("failed to save surveillance scan: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return raised, nil
+}
+
+// ListSurveillanceAlerts returns the latest limit alerts matching filter,
+// newest first
+func (db *DB) ListSurveillanceAlerts(ctx context.Context, filter AlertFilter, limit int) ([]models.SurveillanceAlert, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+alertColumns+`
+		FROM surveillance_alerts a JOIN users u ON u.id = a.user_id
+		WHERE ($1 = '' OR a.status = $1) AND ($2 = '' OR a.kind = $2) AND ($3 = 0 OR a.user_id = $3)
+		ORDER BY a.id DESC
+		LIMIT $4`,
+		filter.Status, filter.Kind, filter.UserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list surveillance alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.SurveillanceAlert{}
+	for rows.Next() {
+		var alert models.SurveillanceAlert
+		if err := scanAlert(rows, &alert); err != nil {
+			return nil, fmt.Errorf("failed to scan surveillance alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating surveillance alert rows: %w", err)
+	}
+	return alerts, nil
+}
+
+// ResolveSurveillanceAlert marks an open alert resolved by an admin, with a
+// note of what they found. Returns ErrAlertNotFound for unknown alerts and
+// ErrAlertResolved for alerts already resolved.
+func (db *DB) ResolveSurveillanceAlert(ctx context.Context, id, adminID int, note string) (*models.SurveillanceAlert, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	alert := &models.SurveillanceAlert{}
+	err := scanAlert(db.Pool.QueryRow(ctx, `
+		UPDATE surveillance_alerts a SET status = 'resolved', note = $3, resolved_by = NULLIF($2, 0), resolved_at = CURRENT_TIMESTAMP
+		FROM users u
+		WHERE a.id = $1 AND a.status = 'open' AND u.id = a.user_id
+		RETURNING `+alertColumns,
+		id, adminID, note), alert)
+	if err == nil {
+		return alert, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to resolve surveillance alert: %w", err)
+	}
+
+	var exists bool
+	if err := db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM surveillance_alerts WHERE id = $1)", id).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get surveillance alert: %w", err)
+	}
+	if !exists {
+		return nil, ErrAlertNotFound
+	}
+	return nil, ErrAlertResolved
+}
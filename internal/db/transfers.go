@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// CustodyAccount is the system account deposits are credited from and
+// withdrawals debited to. It stands for funds held outside the exchange.
+const CustodyAccount = "custody"
+
+// Transfer types
+const (
+	TransferDeposit    = "deposit"
+	TransferWithdrawal = "withdrawal"
+)
+
+// ErrTransferNotFound is returned for unknown transfers
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// TransferNotPendingError is returned when reviewing a transfer that was
+// already reviewed
+type TransferNotPendingError struct {
+	TransferID int
+	Status     string // "completed" or "rejected"
+}
+
+func (e *TransferNotPendingError) Error() string {
+	return fmt.Sprintf("transfer not pending (status: %s)", e.Status)
+}
+
+// InsufficientBalanceError is returned when a withdrawal is larger than the
+// user's available balance
+type InsufficientBalanceError struct {
+	Asset     string
+	Available float64 // Balance less pending withdrawals
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("insufficient %s balance (available: %f)", e.Asset, e.Available)
+}
+
+const transferColumns = "id, user_id, type, asset, amount, status, COALESCE(reviewed_by, 0), created_at, completed_at"
+
+func scanTransfer(row pgx.Row, t *models.Transfer) error {
+	return row.Scan(&t.ID, &t.UserID, &t.Type, &t.Asset, &t.Amount, &t.Status, &t.ReviewedBy, &t.CreatedAt, &t.CompletedAt)
+}
+
+// CreateTransfer records a deposit or withdrawal for a user. An instant
+// transfer completes at once; otherwise it is pending until an admin
+// reviews it. Pending withdrawals hold their amount, so a withdrawal is
+// refused with an *InsufficientBalanceError if it exceeds the balance less
+// the user's other pending withdrawals, and with a *BorrowLimitError if
+// the user owes anything and it would leave them owing more than limit
+// allows. Returns ErrUserNotFound for unknown users.
+func (db *DB) CreateTransfer(ctx context.Context, userID int, transferType, asset string, amount float64, instant bool, limit BorrowLimit) (*models.Transfer, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	if transferType == TransferWithdrawal {
+		if err := checkAvailable(ctx, tx, userID, asset, amount, 0); err != nil {
+			return nil, err
+		}
+		if err := checkBorrowCapacity(ctx, tx, userID, asset, amount, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	transfer := &models.Transfer{}
+	err = scanTransfer(tx.QueryRow(ctx,
+		"INSERT INTO transfers (user_id, type, asset, amount, status) VALUES ($1, $2, $3, $4, 'pending') RETURNING "+transferColumns,
+		userID, transferType, asset, amount), transfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer: %w", err)
+	}
+	if instant {
+		if transfer, err = completeTransfer(ctx, tx, transfer, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return transfer, nil
+}
+
+// ReviewTransfer approves or rejects a pending transfer on behalf of an
+// admin. Approving completes it, posting it to the ledger; a withdrawal is
+// checked against the user's balance and borrowing limit again first.
+// Returns ErrTransferNotFound for unknown transfers and a
+// *TransferNotPendingError for transfers already reviewed.
+func (db *DB) ReviewTransfer(ctx context.Context, transferID, adminID int, approve bool, limit BorrowLimit) (*models.Transfer, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user before the transfer, in the same order as CreateTransfer
+	var userID int
+	err = tx.QueryRow(ctx, "SELECT user_id FROM transfers WHERE id = $1", transferID).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	transfer := &models.Transfer{}
+	err = scanTransfer(tx.QueryRow(ctx, "SELECT "+transferColumns+" FROM transfers WHERE id = $1 FOR UPDATE", transferID), transfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	if transfer.Status != "pending" {
+		return nil, &TransferNotPendingError{TransferID: transferID, Status: transfer.Status}
+	}
+
+	if approve {
+		if transfer.Type == TransferWithdrawal {
+			if err := checkAvailable(ctx, tx, userID, transfer.Asset, transfer.Amount, transferID); err != nil {
+				return nil, err
+			}
+			if err := checkBorrowCapacity(ctx, tx, userID, transfer.Asset, transfer.Amount, limit); err != nil {
+				return nil, err
+			}
+		}
+		transfer, err = completeTransfer(ctx, tx, transfer, adminID)
+	} else {
+		transfer = &models.Transfer{}
+		err = scanTransfer(tx.QueryRow(ctx,
+			"UPDATE transfers SET status = 'rejected', reviewed_by = $2 WHERE id = $1 RETURNING "+transferColumns,
+			transferID, adminID), transfer)
+		if err != nil {
+			err = fmt.Errorf("failed to reject transfer: %w", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return transfer, nil
+}
+
+// lockUser locks a user's row, serializing the user's transfers so pending
+// withdrawals can't together exceed their balance
+func lockUser(ctx context.Context, tx pgx.Tx, userID int) error {
+	var id int
+	err := tx.QueryRow(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	return nil
+}
+
+// checkAvailable returns an *InsufficientBalanceError if amount exceeds the
+// user's balance in asset less their pending withdrawals other than the
+// transfer excludeID
+func checkAvailable(ctx context.Context, tx pgx.Tx, userID int, asset string, amount float64, excludeID int) error {
+	var available float64
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE((SELECT SUM(amount) FROM ledger_entries WHERE user_id = $1 AND asset = $2), 0)
+			- COALESCE((SELECT SUM(amount) FROM transfers
+				WHERE user_id = $1 AND asset = $2 AND type = 'withdrawal' AND status = 'pending' AND id <> $3), 0)`,
+		userID, asset, excludeID).Scan(&available)
+	if err != nil {
+		return fmt.Errorf("failed to get available balance: %w", err)
+	}
+	if amount-available > 1e-9 {
+		return &InsufficientBalanceError{Asset: asset, Available: available}
+	}
+	return nil
+}
+
+// completeTransfer posts a pending transfer to the ledger against the
+// custody account and marks it completed, reviewed by adminID if non-zero
+func completeTransfer(ctx context.Context, tx pgx.Tx, transfer *models.Transfer, adminID int) (*models.Transfer, error) {
+	amount := transfer.Amount
+	if transfer.Type == TransferWithdrawal {
+		amount = -amount
+	}
+	err := postEntries(ctx, tx, transfer.Type, fmt.Sprintf("%s:%d", transfer.Type, transfer.ID), []models.LedgerEntry{
+		{UserID: transfer.UserID, Asset: transfer.Asset, Amount: amount},
+		{Account: CustodyAccount, Asset: transfer.Asset, Amount: -amount},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completed := &models.Transfer{}
+	err = scanTransfer(tx.QueryRow(ctx,
+		"UPDATE transfers SET status = 'completed', reviewed_by = NULLIF($2, 0), completed_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+transferColumns,
+		transfer.ID, adminID), completed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete transfer: %w", err)
+	}
+	return completed, nil
+}
+
+// GetTransfers retrieves up to limit transfers matching the filter, newest
+// first
+func (db *DB) GetTransfers(ctx context.Context, filter TransferFilter, limit int) ([]models.Transfer, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query, args := filter.appendWhere("SELECT "+transferColumns+" FROM transfers WHERE TRUE", nil)
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []models.Transfer{}
+	for rows.Next() {
+		var transfer models.Transfer
+		if err := scanTransfer(rows, &transfer); err != nil {
+			return nil, fmt.Errorf("failed to scan transfer: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transfer rows: %w", err)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrWebhookNotFound is returned when a webhook doesn't exist, is deleted,
+// or belongs to another user
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookEvents are the order events delivered to webhooks. Deliveries are
+// queued in the same transaction as the change they describe.
+var WebhookEvents = map[string]bool{"partially_filled": true, "filled": true, "canceled": true}
+
+// DueWebhookDelivery is a pending delivery whose next attempt is due, with
+// where to post it and the secret to sign it with
+type DueWebhookDelivery struct {
+	ID        int64
+	WebhookID int
+	URL       string
+	Secret    string
+	Event     string
+	Payload   []byte
+	Attempts  int // Made so far
+}
+
+// CreateWebhook registers a webhook for a user
+func (db *DB) CreateWebhook(ctx context.Context, userID int, url, secret string) (*models.Webhook, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	webhook := &models.Webhook{UserID: userID, URL: url, Secret: secret}
+	err := db.Pool.QueryRow(ctx,
+		"INSERT INTO webhooks (user_id, url, secret) VALUES ($1, $2, $3) RETURNING id, created_at",
+		userID, url, secret).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// ListWebhooks retrieves a user's webhooks without their secrets
+func (db *DB) ListWebhooks(ctx context.Context, userID int) ([]models.Webhook, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx,
+		"SELECT id, user_id, url, created_at FROM webhooks WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook rows: %w", err)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook stops posting to one of a user's webhooks, failing the
+// deliveries still pending for it
+func (db *DB) DeleteWebhook(ctx context.Context, id, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		"UPDATE webhooks SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = 'failed', error = 'Webhook deleted', next_attempt_at = NULL
+		WHERE webhook_id = $1 AND status = 'pending'`,
+		id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel webhook deliveries: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// QueueWebhookDeliveries queues payload, an event about one of the user's
+// orders, for delivery to each of the user's webhooks, returning how many
+// deliveries were queued
+func (db *DB) QueueWebhookDeliveries(ctx context.Context, userID int, event string, payload []byte) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3 FROM webhooks WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID, event, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// queueWebhookDeliveries queues an order event for delivery to each of its
+// owner's webhooks in tx
+func queueWebhookDeliveries(ctx context.Context, tx pgx.Tx, e models.OrderEvent) error {
+	payload, err := json.Marshal(e.OrderUpdate)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order update: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3 FROM webhooks WHERE user_id = $1 AND revoked_at IS NULL`,
+		e.UserID, e.Event, payload)
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// queuePartialFillDeliveries queues partially_filled deliveries in tx for
+// the orders of a trade that it leaves open, if their owners have webhooks.
+// Orders the trade fills are delivered when their status is updated.
+func queuePartialFillDeliveries(ctx context.Context, tx pgx.Tx, trade *models.Trade) error {
+	var hooked bool
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM webhooks WHERE user_id IN ($1, $2) AND revoked_at IS NULL)",
+		trade.BuyUserID, trade.SellUserID).Scan(&hooked)
+	if err != nil {
+		return fmt.Errorf("failed to check webhooks: %w", err)
+	}
+	if !hooked {
+		return nil
+	}
+
+	orderEvents, err := getOrderEvents(ctx, tx, "partially_filled", []int{trade.BuyOrderID, trade.SellOrderID})
+	if err != nil {
+		return err
+	}
+	for _, e := range orderEvents {
+		if e.Status != "open" || e.FilledQuantity >= e.Quantity {
+			continue
+		}
+		if err := queueWebhookDeliveries(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDueWebhookDeliveries returns up to limit pending deliveries due by now
+// with IDs after afterID, oldest first
+func (db *DB) GetDueWebhookDeliveries(ctx context.Context, now time.Time, afterID int64, limit int) ([]DueWebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.attempts
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND d.id > $2
+		ORDER BY d.id
+		LIMIT $3`,
+		now, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records a delivery's successful attempt, answered
+// with responseCode
+func (db *DB) MarkWebhookDelivered(ctx context.Context, id int64, responseCode int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, response_code = $2,
+			error = '', next_attempt_at = NULL, delivered_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, responseCode)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery %d delivered: %w", id, err)
+	}
+	return nil
+}
+
+// MarkWebhookAttemptFailed records a delivery's failed attempt, answered
+// with responseCode if it was answered at all, to be retried at retryAt. A
+// zero retryAt gives up on the delivery.
+func (db *DB) MarkWebhookAttemptFailed(ctx context.Context, id int64, responseCode int, message string, retryAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	status, next := "pending", &retryAt
+	if retryAt.IsZero() {
+		status, next = "failed", nil
+	}
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, response_code = $3,
+			error = $4, next_attempt_at = $5
+		WHERE id = $1`,
+		id, status, responseCode, message, next)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery %d attempt: %w", id, err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries to one of a
+// user's webhooks, deleted or not, newest first
+func (db *DB) GetWebhookDeliveries(ctx context.Context, webhookID, userID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var owned bool
+	err := db.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1 AND user_id = $2)",
+		webhookID, userID).Scan(&owned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if !owned {
+		return nil, ErrWebhookNotFound
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt_at, created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2`,
+		webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.Error, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+	return deliveries, nil
+}
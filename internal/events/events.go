@@ -0,0 +1,55 @@
+package events
+
+import "sync"
+
+// Event types published on the bus
+const (
+	TradeExecuted = "trade_executed" // Data: models.Trade
+	CandleUpdated = "candle_updated" // Data: models.Candle
+	OrderUpdated  = "order_updated"  // Data: models.OrderUpdate
+
+	MarketStateChanged    = "market_state_changed"    // Data: exchange.MarketStatus
+	CircuitBreakerTripped = "circuit_breaker_tripped" // Data: marketdata.BreakerTrip
+
+	ImpersonationStarted = "impersonation_started" // Data: models.ImpersonationSession
+	UserLoggedIn         = "user_logged_in"        // Data: models.Login
+)
+
+// Event is a notification about something that happened in the exchange
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// Handler consumes an event
+type Handler func(Event)
+
+// Bus is a simple in-process publish/subscribe dispatcher. Handlers run
+// synchronously in the publisher's goroutine, in subscription order.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers a handler for an event type
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish delivers an event to every handler subscribed to its type
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
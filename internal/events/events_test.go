@@ -0,0 +1,21 @@
+package events
+
+import "testing"
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe(TradeExecuted, func(e Event) { got = append(got, "first:"+e.Data.(string)) })
+	bus.Subscribe(TradeExecuted, func(e Event) { got = append(got, "second:"+e.Data.(string)) })
+	bus.Subscribe(CandleUpdated, func(e Event) { got = append(got, "candle") })
+
+	bus.Publish(Event{Type: TradeExecuted, Data: "t1"})
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(got))
+	}
+	if got[0] != "first:t1" || got[1] != "second:t1" {
+		t.Errorf("handlers not called in subscription order: %v", got)
+	}
+}
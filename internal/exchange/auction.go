@@ -0,0 +1,172 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// AuctionResult is the outcome of uncrossing the book at the end of an
+// auction
+type AuctionResult struct {
+	Price    float64        `json:"price"`  // Uncrossing price; zero if the book didn't cross
+	Volume   float64        `json:"volume"` // Quantity traded at it
+	Trades   []models.Trade `json:"-"`
+	Filled   []int          `json:"-"`
+	Canceled []int          `json:"-"`
+}
+
+// StartAuction moves the market to a call auction, in which orders rest on
+// the book without matching until Uncross. A non-zero until is when the
+// auction is scheduled to be uncrossed. Returns an error wrapping
+// ErrMarketTransition if the market can't move to an auction.
+func (e *Exchange) StartAuction(reason string, until time.Time) (MarketStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status, err := e.setMarketState(MarketAuction, reason)
+	if err == nil && !until.IsZero() {
+		e.market.Until = &until
+		status = e.market
+	}
+	return status, err
+}
+
+// IndicativeAuction returns the price and volume the book would uncross at
+// now, or zeros if it doesn't cross. Ties are broken towards reference,
+// typically the last traded price.
+func (e *Exchange) IndicativeAuction(reference float64) (price, volume float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uncrossingPrice(e.BuyOrders, e.SellOrders, reference)
+}
+
+// Uncross ends an auction: every order that crosses the uncrossing price
+// trades at it, and the market opens. The uncrossing price is the one that
+// trades the most quantity, then leaves the least unmatched at it, then is
+// closest to reference, then is lowest. Orders trade in price-time priority,
+// each trade's taker being the side of the later order. Returns an error
+// wrapping ErrMarketTransition if the market isn't in an auction.
+func (e *Exchange) Uncross(reference float64, reason string) (AuctionResult, MarketStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	if e.market.State != MarketAuction {
+		return AuctionResult{}, e.market, fmt.Errorf("%w: %s isn't an auction", ErrMarketTransition, e.market.State)
+	}
+	e.version++
+
+	var result AuctionResult
+	result.Price, result.Volume = uncrossingPrice(e.BuyOrders, e.SellOrders, reference)
+	if result.Volume > 0 {
+		s := e.scratch.get()
+		defer e.scratch.put(s)
+		e.uncrossAt(s, result.Price)
+		result.Trades, result.Filled, result.Canceled = s.results()
+		e.volume.add(result.Trades)
+		e.cleanupOrderBook()
+	}
+
+	e.market = MarketStatus{State: MarketOpen, Since: e.now(), Reason: reason}
+	return result, e.market, nil
+}
+
+// uncrossAt trades the orders crossing price at it, appending the trades
+// and filled orders to s; callers must hold e.mu
+func (e *Exchange) uncrossAt(s *matchScratch, price float64) {
+	b, sl := 0, 0
+	for b < len(e.BuyOrders) && sl < len(e.SellOrders) {
+		buy, sell := &e.BuyOrders[b], &e.SellOrders[sl]
+		if buy.Price < price || sell.Price > price {
+			break
+		}
+
+		quantity := math.Min(buy.Quantity, sell.Quantity)
+		takerSide := "sell"
+		if buy.ID > sell.ID {
+			takerSide = "buy"
+		}
+		s.trades = append(s.trades, models.Trade{
+			BuyOrderID:  buy.ID,
+			SellOrderID: sell.ID,
+			BuyUserID:   buy.UserID,
+			SellUserID:  sell.UserID,
+			Price:       price,
+			Quantity:    quantity,
+			TakerSide:   takerSide,
+			Sequence:    e.nextSequence(),
+		})
+
+		buy.Quantity -= quantity
+		sell.Quantity -= quantity
+		if buy.Quantity <= quantityTolerance {
+			buy.Quantity = 0
+			buy.Status = "filled"
+			s.filled = append(s.filled, buy.ID)
+			b++
+		}
+		if sell.Quantity <= quantityTolerance {
+			sell.Quantity = 0
+			sell.Status = "filled"
+			s.filled = append(s.filled, sell.ID)
+			sl++
+		}
+	}
+}
+
+// uncrossingPrice finds the price that trades the most quantity between
+// buys, best first, and sells, best first, and that quantity. Only the
+// orders' prices need be considered, as the quantity traded only changes at
+// them.
+func uncrossingPrice(buys, sells []models.Order, reference float64) (price, volume float64) {
+	prices := make([]float64, 0, len(buys)+len(sells))
+	for _, order := range buys {
+		prices = append(prices, order.Price)
+	}
+	for _, order := range sells {
+		prices = append(prices, order.Price)
+	}
+	sort.Float64s(prices)
+
+	// Supply at a price is the quantity offered at or below it, so it grows
+	// with the price; demand is the quantity bid at or above it
+	supply := make([]float64, len(prices))
+	var total float64
+	next := 0
+	for i, p := range prices {
+		for next < len(sells) && sells[next].Price <= p {
+			total += sells[next].Quantity
+			next++
+		}
+		supply[i] = total
+	}
+	demand := make([]float64, len(prices))
+	total, next = 0, 0
+	for i := len(prices) - 1; i >= 0; i-- {
+		for next < len(buys) && buys[next].Price >= prices[i] {
+			total += buys[next].Quantity
+			next++
+		}
+		demand[i] = total
+	}
+
+	var imbalance float64
+	for i, p := range prices {
+		traded := math.Min(supply[i], demand[i])
+		if traded <= quantityTolerance {
+			continue
+		}
+		surplus := math.Abs(demand[i] - supply[i])
+		better := traded > volume+quantityTolerance
+		if !better && math.Abs(traded-volume) <= quantityTolerance {
+			better = surplus < imbalance-quantityTolerance ||
+				(math.Abs(surplus-imbalance) <= quantityTolerance && reference > 0 && math.Abs(p-reference) < math.Abs(price-reference))
+		}
+		if better {
+			price, volume, imbalance = p, traded, surplus
+		}
+	}
+	return price, volume
+}
@@ -0,0 +1,111 @@
+package exchange
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestExchange_Auction(t *testing.T) {
+	ex := NewExchange()
+	ex.SetInvariantCheck(func(err error) { t.Errorf("unexpected violation: %v", err) })
+	ex.SetMarketState(MarketHalted, "")
+
+	until := time.Now().Add(time.Minute)
+	status, err := ex.StartAuction("reopening", until)
+	if err != nil || status.State != MarketAuction || status.Until == nil || !status.Until.Equal(until) {
+		t.Fatalf("expected an auction until %v, got %+v, err %v", until, status, err)
+	}
+	if _, err := ex.SetMarketState(MarketOpen, ""); !errors.Is(err, ErrMarketTransition) {
+		t.Errorf("expected an auction to open only by uncrossing, got %v", err)
+	}
+
+	// Crossing orders rest instead of matching; IOC orders can't rest
+	now := time.Now()
+	orders := []models.Order{
+		{ID: 1, Type: "buy", Price: 102, Quantity: 1, Status: "open", CreatedAt: now},
+		{ID: 2, Type: "buy", Price: 101, Quantity: 2, Status: "open", CreatedAt: now.Add(time.Second)},
+		{ID: 3, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: now.Add(2 * time.Second)},
+		{ID: 4, Type: "sell", Price: 100, Quantity: 1.5, Status: "open", CreatedAt: now.Add(3 * time.Second)},
+		{ID: 5, Type: "sell", Price: 101, Quantity: 1, Status: "open", CreatedAt: now.Add(4 * time.Second)},
+		{ID: 6, Type: "sell", Price: 103, Quantity: 1, Status: "open", CreatedAt: now.Add(5 * time.Second)},
+	}
+	for _, order := range orders {
+		if trades, _, _ := ex.MatchOrder(order); len(trades) != 0 {
+			t.Fatalf("expected no trades during the auction, got %+v", trades)
+		}
+	}
+	if _, _, canceled := ex.MatchOrder(models.Order{ID: 7, Type: "buy", Price: 105, Quantity: 1, Status: "open", TimeInForce: "IOC"}); len(canceled) != 1 {
+		t.Errorf("expected the IOC order canceled, got %v", canceled)
+	}
+
+	// At 101, 3 is bid and 2.5 offered, the most that can trade
+	price, volume := ex.IndicativeAuction(0)
+	if price != 101 || volume != 2.5 {
+		t.Fatalf("expected 2.5 to trade at 101, got %v at %v", volume, price)
+	}
+
+	result, status, err := ex.Uncross(0, "auction over")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.State != MarketOpen || status.Until != nil {
+		t.Errorf("expected the market open, got %+v", status)
+	}
+	if result.Price != 101 || result.Volume != 2.5 || len(result.Trades) != 3 {
+		t.Fatalf("expected 3 trades of 2.5 at 101, got %+v", result)
+	}
+	var traded float64
+	for _, trade := range result.Trades {
+		if trade.Price != 101 {
+			t.Errorf("expected every trade at 101, got %+v", trade)
+		}
+		traded += trade.Quantity
+	}
+	if math.Abs(traded-2.5) > quantityTolerance {
+		t.Errorf("expected 2.5 traded, got %v", traded)
+	}
+	// The first trade pairs the best bid with the best offer, which came later
+	if first := result.Trades[0]; first.BuyOrderID != 1 || first.SellOrderID != 4 || first.TakerSide != "sell" {
+		t.Errorf("unexpected first trade %+v", first)
+	}
+	if len(result.Filled) != 3 {
+		t.Errorf("expected orders 1, 4 and 5 filled, got %v", result.Filled)
+	}
+
+	// Order 2 keeps the half it didn't trade
+	buys, sells := ex.GetOrderBook()
+	if len(buys) != 2 || buys[0].ID != 2 || buys[0].Quantity != 0.5 || len(sells) != 1 || sells[0].ID != 6 {
+		t.Errorf("unexpected book after uncrossing: buys %+v sells %+v", buys, sells)
+	}
+
+	if _, _, err := ex.Uncross(0, ""); !errors.Is(err, ErrMarketTransition) {
+		t.Errorf("expected ErrMarketTransition uncrossing an open market, got %v", err)
+	}
+}
+
+func TestUncrossingPrice(t *testing.T) {
+	buys := []models.Order{{ID: 1, Type: "buy", Price: 101, Quantity: 1}, {ID: 2, Type: "buy", Price: 100, Quantity: 1}}
+
+	// 1 can trade at 100 or 101, with nothing left over at either
+	sells := []models.Order{{ID: 3, Type: "sell", Price: 100, Quantity: 1}}
+	if price, volume := uncrossingPrice(buys[:1], sells, 0); price != 100 || volume != 1 {
+		t.Errorf("expected the lowest price without a reference, got %v at %v", volume, price)
+	}
+	if price, _ := uncrossingPrice(buys[:1], sells, 105); price != 101 {
+		t.Errorf("expected the price closest to the reference, got %v", price)
+	}
+
+	// At 100, 2 is bid against 1 offered; at 101 the imbalance is smaller
+	if price, volume := uncrossingPrice(buys, sells, 0); price != 101 || volume != 1 {
+		t.Errorf("expected the smaller imbalance at 101, got %v at %v", volume, price)
+	}
+
+	// A book that doesn't cross has no price
+	if price, volume := uncrossingPrice(buys[1:], []models.Order{{ID: 4, Type: "sell", Price: 101, Quantity: 1}}, 0); price != 0 || volume != 0 {
+		t.Errorf("expected no uncrossing price, got %v at %v", volume, price)
+	}
+}
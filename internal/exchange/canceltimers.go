@@ -0,0 +1,81 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+// CancelTimers are per-user dead man's switches: each armed timer calls
+// fire with its user once its timeout passes without being rearmed, for the
+// user's open orders to be canceled
+type CancelTimers struct {
+	fire func(userID int)
+
+	mu     sync.Mutex
+	timers map[int]*cancelTimer
+}
+
+// cancelTimer is one user's armed timer
+type cancelTimer struct {
+	timer    *time.Timer
+	deadline time.Time
+}
+
+// NewCancelTimers creates a set of timers calling fire, on its own
+// goroutine, for each user whose timer runs out
+func NewCancelTimers(fire func(userID int)) *CancelTimers {
+	return &CancelTimers{fire: fire, timers: make(map[int]*cancelTimer)}
+}
+
+// Set arms userID's timer to fire after timeout, replacing any armed
+// before, and returns when it will. A zero timeout disarms it, returning
+// the zero time.
+func (c *CancelTimers) Set(userID int, timeout time.Duration, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.timers[userID]; ok {
+		t.timer.Stop()
+		delete(c.timers, userID)
+	}
+	if timeout <= 0 {
+		return time.Time{}
+	}
+
+	t := &cancelTimer{deadline: now.Add(timeout)}
+	t.timer = time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		current := c.timers[userID] == t
+		if current {
+			delete(c.timers, userID)
+		}
+		c.mu.Unlock()
+		// A timer stopped too late to keep it from running was replaced
+		if current {
+			c.fire(userID)
+		}
+	})
+	c.timers[userID] = t
+	return t.deadline
+}
+
+// Deadline returns when userID's timer fires, or false if it isn't armed
+func (c *CancelTimers) Deadline(userID int) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.timers[userID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.deadline, true
+}
+
+// Stop disarms every timer, so none fires after it returns
+func (c *CancelTimers) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for userID, t := range c.timers {
+		t.timer.Stop()
+		delete(c.timers, userID)
+	}
+}
@@ -0,0 +1,52 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancelTimers(t *testing.T) {
+	fired := make(chan int, 4)
+	timers := NewCancelTimers(func(userID int) { fired <- userID })
+	now := time.Now()
+
+	if deadline := timers.Set(1, 20*time.Millisecond, now); !deadline.Equal(now.Add(20 * time.Millisecond)) {
+		t.Errorf("unexpected deadline %v", deadline)
+	}
+	timers.Set(2, time.Hour, now)
+	timers.Set(3, 20*time.Millisecond, now)
+
+	// Rearming pushes the deadline back; a zero timeout disarms
+	timers.Set(2, 10*time.Millisecond, now)
+	if deadline := timers.Set(3, 0, now); !deadline.IsZero() {
+		t.Errorf("expected a disarmed timer to have no deadline, got %v", deadline)
+	}
+	if _, ok := timers.Deadline(3); ok {
+		t.Error("expected user 3's timer to be disarmed")
+	}
+
+	got := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case userID := <-fired:
+			got[userID] = true
+		case <-time.After(time.Second):
+			t.Fatalf("expected timers to fire, got %v", got)
+		}
+	}
+	if !got[1] || !got[2] {
+		t.Errorf("expected users 1 and 2's timers to fire, got %v", got)
+	}
+	if _, ok := timers.Deadline(1); ok {
+		t.Error("expected a fired timer to be disarmed")
+	}
+
+	// Stopped timers never fire
+	timers.Set(4, 10*time.Millisecond, now)
+	timers.Stop()
+	select {
+	case userID := <-fired:
+		t.Errorf("expected no more timers to fire, got user %d", userID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
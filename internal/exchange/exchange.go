@@ -2,13 +2,46 @@ package exchange
 
 import (
 	"sort"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/instruments"
 	"github.com/xtrntr/exchange/internal/models"
 )
 
+// DefaultSymbol is the trading pair matched by the exchange
+const DefaultSymbol = instruments.DefaultSymbol
+
 // Exchange manages the order book and matching engine
 type Exchange struct {
 	BuyOrders  []models.Order
 	SellOrders []models.Order
+
+	// mu serializes access to the book so that matching, cancels and
+	// amendments from concurrent HTTP handlers are applied atomically
+	mu sync.Mutex
+
+	paused   bool
+	pausedAt time.Time
+	queue    []models.Order // Orders received while paused, in arrival order
+
+	market MarketStatus // Whether orders are accepted and matched
+
+	scratch scratchBuffer // Buffers reused by the matching loop
+
+	lifetimes lifetimes // When orders placed with a lifetime come off the book
+
+	timer matchTimer // Time new orders spend waiting for and matching against the book
+
+	volume MarketVolume // Trades matched since the engine started
+
+	version uint64 // Incremented whenever the book or queue may have changed
+
+	sequence uint64 // Number of the last change to the book or trade, see Sequence
+
+	now func() time.Time // Clock stamping time priority and state changes
+
+	onViolation func(error) // Called with invariant violations; nil skips the checks
 }
 
 // NewExchange creates a new exchange
@@ -16,11 +49,76 @@ func NewExchange() *Exchange {
 	return &Exchange{
 		BuyOrders:  []models.Order{},
 		SellOrders: []models.Order{},
+		market:     MarketStatus{State: MarketOpen, Since: time.Now()},
+		now:        time.Now,
+		sequence:   uint64(time.Now().UnixMicro()),
 	}
 }
 
+// Sequence returns the number of the last change to the book or trade. Each
+// change and each trade takes the next number, so market data stamped with
+// them can be ordered and gaps detected. Numbering starts from the time the
+// exchange was created, in microseconds, so it keeps increasing across
+// restarts unless they come faster than changes are made.
+func (e *Exchange) Sequence() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sequence
+}
+
+// nextSequence numbers a change to the book or a trade; callers must hold e.mu
+func (e *Exchange) nextSequence() uint64 {
+	e.sequence++
+	return e.sequence
+}
+
+// SetClock replaces the clock the exchange reads when an order loses time
+// priority and when matching is paused or the market changes state, so a
+// replay produces the same book whenever it runs
+func (e *Exchange) SetClock(now func() time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.now = now
+	e.market.Since = now()
+}
+
 // AddOrder adds an order to the order book
 func (e *Exchange) AddOrder(order models.Order) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+	e.nextSequence()
+	e.addOrder(order)
+}
+
+// Restore rebuilds the book from resting orders, adding them in creation
+// order. An order that would cross the book can't have been resting, so it
+// is left out and its ID returned.
+func (e *Exchange) Restore(orders []models.Order) []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+	e.nextSequence()
+
+	orders = append([]models.Order(nil), orders...)
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreatedAt.Before(orders[j].CreatedAt) })
+
+	var crossed []int
+	for _, order := range orders {
+		if e.crossingQuantity(order) > 0 {
+			crossed = append(crossed, order.ID)
+			continue
+		}
+		e.addOrder(order)
+	}
+	return crossed
+}
+
+// addOrder inserts an order keeping price-time priority; callers must hold e.mu
+func (e *Exchange) addOrder(order models.Order) {
+	e.lifetimes.track(order, e.now())
 	if order.Type == "buy" {
 		e.BuyOrders = append(e.BuyOrders, order)
 		// Sort buy orders: highest price first, then earliest time
@@ -42,10 +140,138 @@ func (e *Exchange) AddOrder(order models.Order) {
 	}
 }
 
-// MatchOrder attempts to match a new order, returns trades
-func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int) {
-	var trades []models.Trade
-	var filledOrderIDs []int
+// MatchOrder attempts to match a new order. Returns the trades, the IDs of
+// filled orders, and the IDs of canceled orders: the order's if its time in
+// force or post-only instruction canceled it instead of resting it, and
+// those taken off the book for outliving their lifetime. While matching is
+// paused the order is queued instead and nothing is returned.
+func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int, []int) {
+	start := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	defer e.timer.observe(start, time.Now())
+	e.version++
+	if e.paused {
+		e.queue = append(e.queue, newOrder)
+		return nil, nil, nil
+	}
+	return e.matchOrder(newOrder)
+}
+
+// MatchOrders matches a batch of new orders in the given order as one step,
+// so no other order can interleave with the batch. While matching is paused
+// the orders are queued instead.
+func (e *Exchange) MatchOrders(orders []models.Order) ([]models.Trade, []int, []int) {
+	start := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	defer e.timer.observe(start, time.Now())
+	e.version++
+	if e.paused {
+		e.queue = append(e.queue, orders...)
+		return nil, nil, nil
+	}
+	return e.matchAll(orders)
+}
+
+// matchAll matches orders one after another; callers must hold e.mu
+func (e *Exchange) matchAll(orders []models.Order) ([]models.Trade, []int, []int) {
+	s := e.scratch.get()
+	defer e.scratch.put(s)
+	for _, order := range orders {
+		e.matchInto(s, order)
+	}
+	return s.results()
+}
+
+// Pause stops matching. New orders are queued until Resume while cancels
+// and amendments still apply. Returns false if already paused.
+func (e *Exchange) Pause() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.paused {
+		return false
+	}
+	e.paused = true
+	e.pausedAt = e.now()
+	return true
+}
+
+// Resume restarts matching and uncrosses the book in one step by matching
+// the queued orders in arrival order. Returns the resulting trades, the IDs
+// of filled and canceled orders, and the number of queued orders processed.
+func (e *Exchange) Resume() ([]models.Trade, []int, []int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+
+	queued := e.queue
+	e.paused = false
+	e.pausedAt = time.Time{}
+	e.queue = nil
+
+	trades, filledOrderIDs, canceledOrderIDs := e.matchAll(queued)
+	return trades, filledOrderIDs, canceledOrderIDs, len(queued)
+}
+
+// PauseState reports whether matching is paused, since when, and how many
+// orders are waiting
+func (e *Exchange) PauseState() (paused bool, since time.Time, queued int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.paused, e.pausedAt, len(e.queue)
+}
+
+// matchOrder runs the matching loop for an incoming order; callers must hold e.mu
+func (e *Exchange) matchOrder(newOrder models.Order) ([]models.Trade, []int, []int) {
+	s := e.scratch.get()
+	defer e.scratch.put(s)
+	e.matchInto(s, newOrder)
+	return s.results()
+}
+
+// matchInto matches an incoming order, appending the trades and the IDs of
+// filled and canceled orders to s; callers must hold e.mu
+func (e *Exchange) matchInto(s *matchScratch, newOrder models.Order) {
+	// Orders past their lifetime come off the book before anything can
+	// trade against them, and are reported canceled
+	s.canceled = append(s.canceled, e.expireLifetimes(e.now())...)
+
+	// During an auction orders rest without matching until the book is
+	// uncrossed, except those whose time in force doesn't let them rest
+	if e.market.State == MarketAuction {
+		if newOrder.TimeInForce == "IOC" || newOrder.TimeInForce == "FOK" {
+			s.canceled = append(s.canceled, newOrder.ID)
+			return
+		}
+		e.nextSequence()
+		e.addOrder(newOrder)
+		return
+	}
+
+	// Post-only orders must not take liquidity and fill-or-kill orders must
+	// fill completely, so either is canceled untouched if it can't comply.
+	// Unless the market is open, every order is post-only.
+	postOnly := newOrder.PostOnly || e.market.State != MarketOpen
+	available := e.crossingQuantity(newOrder)
+	if (postOnly && available > 0) || (newOrder.TimeInForce == "FOK" && available < newOrder.Quantity) {
+		s.canceled = append(s.canceled, newOrder.ID)
+		return
+	}
+
+	// Measure the match if checking invariants
+	var quantity, restingBefore float64
+	tradesBefore := len(s.trades)
+	if e.onViolation != nil {
+		quantity = newOrder.Quantity
+		restingBefore = sideQuantity(e.SellOrders)
+		if newOrder.Type == "sell" {
+			restingBefore = sideQuantity(e.BuyOrders)
+		}
+	}
 
 	if newOrder.Type == "buy" {
 		// Match against sell orders
@@ -54,18 +280,24 @@ func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int) {
 				continue
 			}
 			if e.SellOrders[i].Price <= newOrder.Price {
-				// Calculate trade quantity
-				tradeQty := min(newOrder.Quantity, e.SellOrders[i].Quantity)
+				// Calculate trade quantity; iceberg orders trade one
+				// displayed slice at a time
+				visible := VisibleQuantity(e.SellOrders[i])
+				tradeQty := min(newOrder.Quantity, visible)
 				tradePrice := e.SellOrders[i].Price // Use sell price for simplicity
 
 				// Create trade
 				trade := models.Trade{
 					BuyOrderID:  newOrder.ID,
 					SellOrderID: e.SellOrders[i].ID,
+					BuyUserID:   newOrder.UserID,
+					SellUserID:  e.SellOrders[i].UserID,
 					Price:       tradePrice,
 					Quantity:    tradeQty,
+					TakerSide:   newOrder.Type,
+					Sequence:    e.nextSequence(),
 				}
-				trades = append(trades, trade)
+				s.trades = append(s.trades, trade)
 
 				// Update quantities
 				newOrder.Quantity -= tradeQty
@@ -73,11 +305,17 @@ func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int) {
 
 				// Mark orders as filled if quantity is 0
 				if newOrder.Quantity <= 0 {
-					filledOrderIDs = append(filledOrderIDs, newOrder.ID)
+					s.filled = append(s.filled, newOrder.ID)
 				}
 				if e.SellOrders[i].Quantity <= 0 {
-					filledOrderIDs = append(filledOrderIDs, e.SellOrders[i].ID)
+					s.filled = append(s.filled, e.SellOrders[i].ID)
 					e.SellOrders[i].Status = "filled"
+				} else if e.SellOrders[i].DisplayQuantity > 0 && tradeQty >= visible {
+					// The displayed slice was taken, so the next one
+					// loses priority to the other orders at this price
+					e.SellOrders[i].CreatedAt = e.now()
+					requeueAtPrice(e.SellOrders, i)
+					i--
 				}
 			}
 			if newOrder.Quantity <= 0 {
@@ -91,26 +329,37 @@ func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int) {
 				continue
 			}
 			if e.BuyOrders[i].Price >= newOrder.Price {
-				tradeQty := min(newOrder.Quantity, e.BuyOrders[i].Quantity)
+				visible := VisibleQuantity(e.BuyOrders[i])
+				tradeQty := min(newOrder.Quantity, visible)
 				tradePrice := e.BuyOrders[i].Price // Use buy price for simplicity
 
 				trade := models.Trade{
 					BuyOrderID:  e.BuyOrders[i].ID,
 					SellOrderID: newOrder.ID,
+					BuyUserID:   e.BuyOrders[i].UserID,
+					SellUserID:  newOrder.UserID,
 					Price:       tradePrice,
 					Quantity:    tradeQty,
+					TakerSide:   newOrder.Type,
+					Sequence:    e.nextSequence(),
 				}
-				trades = append(trades, trade)
+				s.trades = append(s.trades, trade)
 
 				newOrder.Quantity -= tradeQty
 				e.BuyOrders[i].Quantity -= tradeQty
 
 				if newOrder.Quantity <= 0 {
-					filledOrderIDs = append(filledOrderIDs, newOrder.ID)
+					s.filled = append(s.filled, newOrder.ID)
 				}
 				if e.BuyOrders[i].Quantity <= 0 {
-					filledOrderIDs = append(filledOrderIDs, e.BuyOrders[i].ID)
+					s.filled = append(s.filled, e.BuyOrders[i].ID)
 					e.BuyOrders[i].Status = "filled"
+				} else if e.BuyOrders[i].DisplayQuantity > 0 && tradeQty >= visible {
+					// The displayed slice was taken, so the next one
+					// loses priority to the other orders at this price
+					e.BuyOrders[i].CreatedAt = e.now()
+					requeueAtPrice(e.BuyOrders, i)
+					i--
 				}
 			}
 			if newOrder.Quantity <= 0 {
@@ -121,37 +370,182 @@ func (e *Exchange) MatchOrder(newOrder models.Order) ([]models.Trade, []int) {
 
 	// Update order book: remove filled orders
 	e.cleanupOrderBook()
+	e.volume.add(s.trades[tradesBefore:])
 
-	// Add remaining new order to book if not fully filled
+	if e.onViolation != nil {
+		restingAfter := sideQuantity(e.SellOrders)
+		if newOrder.Type == "sell" {
+			restingAfter = sideQuantity(e.BuyOrders)
+		}
+		e.checkFill(newOrder, quantity, newOrder.Quantity, s.trades[tradesBefore:], restingBefore, restingAfter)
+	}
+
+	// Add remaining new order to book if not fully filled, unless its time
+	// in force cancels the remainder
 	if newOrder.Quantity > 0 && newOrder.Status == "open" {
-		e.AddOrder(newOrder)
+		if newOrder.TimeInForce == "IOC" || newOrder.TimeInForce == "FOK" {
+			s.canceled = append(s.canceled, newOrder.ID)
+		} else {
+			e.nextSequence()
+			e.addOrder(newOrder)
+		}
 	}
+}
 
-	return trades, filledOrderIDs
+// VisibleQuantity returns how much of an order the book shows: all of it,
+// or the displayed slice of an iceberg order. Each slice is replenished
+// from the hidden reserve as it trades.
+func VisibleQuantity(order models.Order) float64 {
+	if order.DisplayQuantity > 0 {
+		return min(order.Quantity, order.DisplayQuantity)
+	}
+	return order.Quantity
 }
 
-// cleanupOrderBook removes filled orders
-func (e *Exchange) cleanupOrderBook() {
-	var newBuyOrders []models.Order
-	for _, order := range e.BuyOrders {
-		if order.Status == "open" && order.Quantity > 0 {
-			newBuyOrders = append(newBuyOrders, order)
+// requeueAtPrice moves orders[i] of a sorted book side behind the other
+// orders at its price
+func requeueAtPrice(orders []models.Order, i int) {
+	order := orders[i]
+	j := i
+	for j+1 < len(orders) && orders[j+1].Price == order.Price {
+		j++
+	}
+	copy(orders[i:j], orders[i+1:j+1])
+	orders[j] = order
+}
+
+// crossingQuantity returns the resting quantity an incoming order could
+// trade against at its limit price, hidden iceberg quantity included;
+// callers must hold e.mu
+func (e *Exchange) crossingQuantity(newOrder models.Order) float64 {
+	var total float64
+	if newOrder.Type == "buy" {
+		for _, order := range e.SellOrders {
+			if order.Status == "open" && order.Price <= newOrder.Price {
+				total += order.Quantity
+			}
+		}
+	} else {
+		for _, order := range e.BuyOrders {
+			if order.Status == "open" && order.Price >= newOrder.Price {
+				total += order.Quantity
+			}
 		}
 	}
-	e.BuyOrders = newBuyOrders
+	return total
+}
+
+// cleanupOrderBook removes filled orders, compacting each side in place
+// so matching doesn't reallocate the book
+func (e *Exchange) cleanupOrderBook() {
+	e.BuyOrders = compactOpen(e.BuyOrders)
+	e.SellOrders = compactOpen(e.SellOrders)
+}
 
-	var newSellOrders []models.Order
-	for _, order := range e.SellOrders {
+// compactOpen keeps the open orders with quantity left, reusing the slice
+func compactOpen(orders []models.Order) []models.Order {
+	open := orders[:0]
+	for _, order := range orders {
 		if order.Status == "open" && order.Quantity > 0 {
-			newSellOrders = append(newSellOrders, order)
+			open = append(open, order)
 		}
 	}
-	e.SellOrders = newSellOrders
+	clear(orders[len(open):])
+	return open
 }
 
-// GetOrderBook returns the current order book
+// GetOrderBook returns a copy of the current order book
 func (e *Exchange) GetOrderBook() ([]models.Order, []models.Order) {
-	return e.BuyOrders, e.SellOrders
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buyOrders := append([]models.Order(nil), e.BuyOrders...)
+	sellOrders := append([]models.Order(nil), e.SellOrders...)
+	return buyOrders, sellOrders
+}
+
+// VersionedOrderBook returns a copy of the current order book and its
+// version, which changes whenever the book may have
+func (e *Exchange) VersionedOrderBook() ([]models.Order, []models.Order, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buyOrders := append([]models.Order(nil), e.BuyOrders...)
+	sellOrders := append([]models.Order(nil), e.SellOrders...)
+	return buyOrders, sellOrders, e.version
+}
+
+// SequencedOrderBook returns a copy of the current order book and the
+// sequence number of the last change to it
+func (e *Exchange) SequencedOrderBook() ([]models.Order, []models.Order, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buyOrders := append([]models.Order(nil), e.BuyOrders...)
+	sellOrders := append([]models.Order(nil), e.SellOrders...)
+	return buyOrders, sellOrders, e.sequence
+}
+
+// Version returns the book's version without copying it
+func (e *Exchange) Version() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.version
+}
+
+// BestPrices returns the best bid and ask prices, or zero for an empty side
+func (e *Exchange) BestPrices() (bid, ask float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.BuyOrders) > 0 {
+		bid = e.BuyOrders[0].Price
+	}
+	if len(e.SellOrders) > 0 {
+		ask = e.SellOrders[0].Price
+	}
+	return bid, ask
+}
+
+// Level is a price and the quantity the book shows at it
+type Level struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+}
+
+// TopOfBook returns the best bid and ask levels, zero for an empty side.
+// Iceberg orders count only their displayed quantity.
+func (e *Exchange) TopOfBook() (bid, ask Level) {
+	bid, ask, _ = e.SequencedTopOfBook()
+	return bid, ask
+}
+
+// SequencedTopOfBook returns the best bid and ask levels like TopOfBook, and
+// the sequence number of the last change to the book
+func (e *Exchange) SequencedTopOfBook() (bid, ask Level, seq uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return topLevel(e.BuyOrders), topLevel(e.SellOrders), e.sequence
+}
+
+// topLevel sums the displayed quantity at the best price of a sorted side
+func topLevel(orders []models.Order) Level {
+	if levels := Levels(orders, 1); len(levels) > 0 {
+		return levels[0]
+	}
+	return Level{}
+}
+
+// Levels sums the displayed quantity at each price of a sorted book side
+// into at most depth levels, best first. Zero depth returns every level.
+func Levels(orders []models.Order, depth int) []Level {
+	levels := []Level{}
+	for _, order := range orders {
+		if n := len(levels); n == 0 || order.Price != levels[n-1].Price {
+			if depth > 0 && n == depth {
+				break
+			}
+			levels = append(levels, Level{Price: order.Price})
+		}
+		levels[len(levels)-1].Quantity += VisibleQuantity(order)
+	}
+	return levels
 }
 
 // min returns the smaller of two float64 values
@@ -164,19 +558,230 @@ func min(a, b float64) float64 {
 
 // RemoveOrder removes an order from the order book by ID
 func (e *Exchange) RemoveOrder(orderID int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+	_, ok := e.removeOrder(orderID)
+	if ok {
+		e.nextSequence()
+	}
+	return ok
+}
+
+// removeOrder removes an order by ID and returns it; callers must hold e.mu
+func (e *Exchange) removeOrder(orderID int) (models.Order, bool) {
 	// Try removing from buy orders
 	for i, order := range e.BuyOrders {
 		if order.ID == orderID {
 			e.BuyOrders = append(e.BuyOrders[:i], e.BuyOrders[i+1:]...)
-			return true
+			return order, true
 		}
 	}
 	// Try removing from sell orders
 	for i, order := range e.SellOrders {
 		if order.ID == orderID {
 			e.SellOrders = append(e.SellOrders[:i], e.SellOrders[i+1:]...)
-			return true
+			return order, true
+		}
+	}
+	// Try removing from orders queued while paused
+	for i, order := range e.queue {
+		if order.ID == orderID {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			return order, true
+		}
+	}
+	return models.Order{}, false
+}
+
+// AmendOrder changes the price and/or quantity of a resting order.
+// A zero price or quantity leaves that field unchanged. Reducing the
+// quantity at the same price keeps the order's place in the queue; a price
+// change or a quantity increase loses time priority and the order is
+// re-run through the matcher as if newly placed. Returns the resulting
+// trades, the IDs of filled orders, the IDs of canceled orders, and false
+// if the order is not resting. The order is canceled if it would cross
+// while the market isn't open, or if it's post-only.
+func (e *Exchange) AmendOrder(orderID int, price, quantity float64) ([]models.Trade, []int, []int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+	return e.amendOrder(orderID, price, quantity)
+}
+
+// AmendOrderTotal amends a resting order as AmendOrder does, given its total
+// quantity before and after the amend rather than what's left of it. The
+// order is left with the new total less what it has executed, worked out
+// from what's left of it under the lock, so fills the caller hasn't
+// recorded yet count. A zero total leaves the quantity unchanged. An order
+// that has already executed the new total is taken off the book and
+// returned as canceled.
+func (e *Exchange) AmendOrderTotal(orderID int, price, total, previousTotal float64) ([]models.Trade, []int, []int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+
+	quantity := 0.0
+	if total > 0 {
+		order, ok := e.findOrder(orderID)
+		if !ok {
+			return nil, nil, nil, false
+		}
+		quantity = total - (previousTotal - order.Quantity)
+		if quantity <= quantityTolerance {
+			e.removeOrder(orderID)
+			e.nextSequence()
+			return nil, nil, []int{orderID}, true
+		}
+	}
+	return e.amendOrder(orderID, price, quantity)
+}
+
+// findOrder returns a resting or queued order by ID; callers must hold e.mu
+func (e *Exchange) findOrder(orderID int) (models.Order, bool) {
+	for _, orders := range [][]models.Order{e.BuyOrders, e.SellOrders, e.queue} {
+		for _, order := range orders {
+			if order.ID == orderID {
+				return order, true
+			}
 		}
 	}
-	return false
-} 
\ No newline at end of file
+	return models.Order{}, false
+}
+
+// amendOrder amends a resting or queued order as AmendOrder describes;
+// callers must hold e.mu
+func (e *Exchange) amendOrder(orderID int, price, quantity float64) ([]models.Trade, []int, []int, bool) {
+	// Queued orders are amended in place, moving to the back of the queue
+	// if they lose priority
+	for i := range e.queue {
+		if e.queue[i].ID != orderID {
+			continue
+		}
+		order := e.queue[i]
+		keepPriority := (price == 0 || price == order.Price) && (quantity == 0 || quantity <= order.Quantity)
+		if price > 0 {
+			order.Price = price
+		}
+		if quantity > 0 {
+			order.Quantity = quantity
+		}
+		if keepPriority {
+			e.queue[i] = order
+		} else {
+			order.CreatedAt = e.now()
+			e.queue = append(append(e.queue[:i], e.queue[i+1:]...), order)
+		}
+		return nil, nil, nil, true
+	}
+
+	order, ok := e.removeOrder(orderID)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	keepPriority := (price == 0 || price == order.Price) && (quantity == 0 || quantity <= order.Quantity)
+	if price > 0 {
+		order.Price = price
+	}
+	if quantity > 0 {
+		order.Quantity = quantity
+	}
+
+	if keepPriority {
+		e.nextSequence()
+		e.addOrder(order)
+		return nil, nil, nil, true
+	}
+
+	// The order is matched as if newly placed, so a post-only order that
+	// would now cross is canceled as a new one would be. Leaving the book is
+	// a change of its own, whatever matching does next.
+	e.nextSequence()
+	order.CreatedAt = e.now()
+	if e.paused {
+		e.queue = append(e.queue, order)
+		return nil, nil, nil, true
+	}
+	trades, filledOrderIDs, canceledOrderIDs := e.matchOrder(order)
+	return trades, filledOrderIDs, canceledOrderIDs, true
+}
+
+// ReassignOrders moves every resting or queued order of one user to
+// another, keeping their place in the book. Returns the IDs of the orders
+// moved.
+func (e *Exchange) ReassignOrders(fromUserID, toUserID int) []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+
+	var moved []int
+	for _, orders := range [][]models.Order{e.BuyOrders, e.SellOrders, e.queue} {
+		for i := range orders {
+			if orders[i].UserID == fromUserID {
+				orders[i].UserID = toUserID
+				moved = append(moved, orders[i].ID)
+			}
+		}
+	}
+	if len(moved) > 0 {
+		e.nextSequence()
+	}
+	return moved
+}
+
+// RemoveOrders removes every order with one of the given IDs from the book
+// in a single step, so no incoming order can match against a partially
+// cancelled set. Returns the number of orders removed.
+func (e *Exchange) RemoveOrders(orderIDs []int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+	e.version++
+
+	removed := 0
+	for _, orderID := range orderIDs {
+		if _, ok := e.removeOrder(orderID); ok {
+			removed++
+		}
+	}
+	if removed > 0 {
+		e.nextSequence()
+	}
+	return removed
+}
+
+// ExpireOrders removes every resting or queued GTD order that has expired by
+// now in a single step. Returns the IDs of the orders removed.
+func (e *Exchange) ExpireOrders(now time.Time) []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+
+	var expired []int
+	keep := func(orders []models.Order) []models.Order {
+		kept := orders[:0]
+		for _, order := range orders {
+			if order.ExpiresAt != nil && !order.ExpiresAt.After(now) {
+				expired = append(expired, order.ID)
+				continue
+			}
+			kept = append(kept, order)
+		}
+		return kept
+	}
+	e.BuyOrders = keep(e.BuyOrders)
+	e.SellOrders = keep(e.SellOrders)
+	e.queue = keep(e.queue)
+
+	// Sweeps usually find nothing, so only bump the version if they don't
+	if len(expired) > 0 {
+		e.version++
+		e.nextSequence()
+	}
+	return expired
+}
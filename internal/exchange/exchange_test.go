@@ -1,6 +1,10 @@
 package exchange
 
 import (
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
@@ -180,11 +184,16 @@ func TestExchange_MatchOrder(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			trades, filled := ex.MatchOrder(tt.order)
+			trades, filled, _ := ex.MatchOrder(tt.order)
 
 			if len(trades) != tt.expectTrades {
 				t.Errorf("expected %d trades, got %d", tt.expectTrades, len(trades))
 			}
+			for _, trade := range trades {
+				if trade.TakerSide != tt.order.Type {
+					t.Errorf("expected taker side %q, got %q", tt.order.Type, trade.TakerSide)
+				}
+			}
 
 			if len(filled) != len(tt.expectFilled) {
 				t.Errorf("expected %d filled orders, got %d", len(tt.expectFilled), len(filled))
@@ -206,6 +215,132 @@ func TestExchange_MatchOrder(t *testing.T) {
 	}
 }
 
+func TestExchange_TimeInForce(t *testing.T) {
+	tests := []struct {
+		name           string
+		order          models.Order
+		expectTrades   int
+		expectCanceled bool
+		expectResting  bool
+	}{
+		{
+			name:          "GTCRestsRemainder",
+			order:         models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 2, Status: "open"},
+			expectTrades:  1,
+			expectResting: true,
+		},
+		{
+			name:           "IOCCancelsRemainder",
+			order:          models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 2, Status: "open", TimeInForce: "IOC"},
+			expectTrades:   1,
+			expectCanceled: true,
+		},
+		{
+			name:           "FOKKilledIfNotFillable",
+			order:          models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 2, Status: "open", TimeInForce: "FOK"},
+			expectCanceled: true,
+		},
+		{
+			name:         "FOKFillsCompletely",
+			order:        models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 1, Status: "open", TimeInForce: "FOK"},
+			expectTrades: 1,
+		},
+		{
+			name:           "PostOnlyCanceledIfCrossing",
+			order:          models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 1, Status: "open", PostOnly: true},
+			expectCanceled: true,
+		},
+		{
+			name:          "PostOnlyRestsIfNotCrossing",
+			order:         models.Order{ID: 10, Type: "buy", Price: 99, Quantity: 1, Status: "open", PostOnly: true},
+			expectResting: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := NewExchange()
+			ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+			trades, _, canceled := ex.MatchOrder(tt.order)
+			if len(trades) != tt.expectTrades {
+				t.Errorf("expected %d trades, got %d", tt.expectTrades, len(trades))
+			}
+			if got := len(canceled) == 1 && canceled[0] == tt.order.ID; got != tt.expectCanceled {
+				t.Errorf("expected canceled %v, got %v", tt.expectCanceled, canceled)
+			}
+			if got := len(ex.BuyOrders) == 1; got != tt.expectResting {
+				t.Errorf("expected resting %v, got %+v", tt.expectResting, ex.BuyOrders)
+			}
+			// A killed or rejected order leaves the book untouched
+			if tt.expectTrades == 0 && (len(ex.SellOrders) != 1 || ex.SellOrders[0].Quantity != 1) {
+				t.Errorf("expected resting sell order untouched, got %+v", ex.SellOrders)
+			}
+		})
+	}
+}
+
+func TestExchange_IcebergOrder(t *testing.T) {
+	ex := NewExchange()
+	start := time.Now()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 5, DisplayQuantity: 2, Status: "open", CreatedAt: start})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: start.Add(time.Second)})
+
+	// Only the displayed slice shows
+	if got := VisibleQuantity(ex.SellOrders[0]); got != 2 {
+		t.Errorf("expected 2 visible, got %v", got)
+	}
+
+	// Part of a slice keeps priority and the slice is replenished
+	trades, _, _ := ex.MatchOrder(models.Order{ID: 10, Type: "buy", Price: 100, Quantity: 0.5, Status: "open"})
+	if len(trades) != 1 || trades[0].SellOrderID != 1 {
+		t.Fatalf("expected a trade with the iceberg, got %+v", trades)
+	}
+	if ex.SellOrders[0].ID != 1 || VisibleQuantity(ex.SellOrders[0]) != 2 {
+		t.Errorf("expected the iceberg first with 2 visible, got %+v", ex.SellOrders)
+	}
+
+	// Taking a whole slice sends the next one behind order 2, and the
+	// incoming order trades through the hidden reserve one slice at a time
+	trades, filled, _ := ex.MatchOrder(models.Order{ID: 11, Type: "buy", Price: 100, Quantity: 4, Status: "open"})
+	var got []string
+	for _, trade := range trades {
+		got = append(got, fmt.Sprintf("%d:%g", trade.SellOrderID, trade.Quantity))
+	}
+	if expected := []string{"1:2", "2:1", "1:1"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected trades %v, got %v", expected, got)
+	}
+	if len(filled) != 2 || len(ex.SellOrders) != 1 || ex.SellOrders[0].Quantity != 1.5 {
+		t.Errorf("expected 1.5 of the iceberg left, got %+v (filled %v)", ex.SellOrders, filled)
+	}
+}
+
+func TestExchange_TopOfBook(t *testing.T) {
+	ex := NewExchange()
+	if bid, ask := ex.TopOfBook(); bid != (Level{}) || ask != (Level{}) {
+		t.Errorf("expected empty levels, got %+v, %+v", bid, ask)
+	}
+
+	now := time.Now()
+	ex.AddOrder(models.Order{ID: 1, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: now})
+	ex.AddOrder(models.Order{ID: 2, Type: "buy", Price: 100, Quantity: 0.5, Status: "open", CreatedAt: now})
+	ex.AddOrder(models.Order{ID: 3, Type: "buy", Price: 100, Quantity: 4, DisplayQuantity: 0.25, Status: "open", CreatedAt: now})
+	ex.AddOrder(models.Order{ID: 4, Type: "sell", Price: 101, Quantity: 2, Status: "open", CreatedAt: now})
+
+	bid, ask := ex.TopOfBook()
+	if bid != (Level{Price: 100, Quantity: 0.75}) || ask != (Level{Price: 101, Quantity: 2}) {
+		t.Errorf("unexpected levels %+v, %+v", bid, ask)
+	}
+
+	buyOrders, _ := ex.GetOrderBook()
+	if levels := Levels(buyOrders, 0); !reflect.DeepEqual(levels, []Level{{Price: 100, Quantity: 0.75}, {Price: 99, Quantity: 1}}) {
+		t.Errorf("unexpected bid levels %+v", levels)
+	}
+	if levels := Levels(buyOrders, 1); len(levels) != 1 {
+		t.Errorf("expected 1 level, got %+v", levels)
+	}
+}
+
 func TestExchange_RemoveOrder(t *testing.T) {
 	ex := NewExchange()
 
@@ -329,3 +464,544 @@ func TestExchange_GetOrderBook(t *testing.T) {
 		t.Error("sell orders not sorted by price (lowest first)")
 	}
 }
+
+func TestExchange_AmendOrder(t *testing.T) {
+	newBook := func() *Exchange {
+		ex := NewExchange()
+		orders := []models.Order{
+			{ID: 1, Type: "buy", Price: 50000, Quantity: 0.1, Status: "open", CreatedAt: time.Now().Add(-2 * time.Second)},
+			{ID: 2, Type: "buy", Price: 50000, Quantity: 0.2, Status: "open", CreatedAt: time.Now().Add(-time.Second)},
+			{ID: 3, Type: "sell", Price: 51000, Quantity: 0.3, Status: "open", CreatedAt: time.Now()},
+		}
+		for _, order := range orders {
+			ex.AddOrder(order)
+		}
+		return ex
+	}
+
+	tests := []struct {
+		name          string
+		orderID       int
+		price         float64
+		quantity      float64
+		expectFound   bool
+		expectTrades  int
+		expectFirstID int // ID of the best bid after the amendment
+	}{
+		{
+			name:          "ReduceQuantityKeepsPriority",
+			orderID:       1,
+			quantity:      0.05,
+			expectFound:   true,
+			expectFirstID: 1,
+		},
+		{
+			name:          "IncreaseQuantityLosesPriority",
+			orderID:       1,
+			quantity:      0.5,
+			expectFound:   true,
+			expectFirstID: 2,
+		},
+		{
+			name:          "RepriceToBetterLevel",
+			orderID:       1,
+			price:         50000.5,
+			expectFound:   true,
+			expectFirstID: 1,
+		},
+		{
+			name:          "RepriceThroughSpreadMatches",
+			orderID:       2,
+			price:         51000,
+			expectFound:   true,
+			expectTrades:  1,
+			expectFirstID: 1,
+		},
+		{
+			name:        "NonExistentOrder",
+			orderID:     999,
+			price:       1,
+			expectFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := newBook()
+			trades, _, _, found := ex.AmendOrder(tt.orderID, tt.price, tt.quantity)
+			if found != tt.expectFound {
+				t.Fatalf("expected found=%v, got %v", tt.expectFound, found)
+			}
+			if len(trades) != tt.expectTrades {
+				t.Errorf("expected %d trades, got %d", tt.expectTrades, len(trades))
+			}
+			if tt.expectFirstID != 0 && ex.BuyOrders[0].ID != tt.expectFirstID {
+				t.Errorf("expected order %d at top of book, got %d", tt.expectFirstID, ex.BuyOrders[0].ID)
+			}
+		})
+	}
+}
+
+func TestExchange_AmendPostOnly(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "buy", Price: 50000, Quantity: 0.1, Status: "open", PostOnly: true, CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 51000, Quantity: 0.1, Status: "open", CreatedAt: time.Now()})
+
+	// Repricing without crossing keeps the order post-only
+	if _, _, canceled, _ := ex.AmendOrder(1, 50500, 0); len(canceled) != 0 {
+		t.Fatalf("expected no cancellations, got %v", canceled)
+	}
+	if !ex.BuyOrders[0].PostOnly {
+		t.Errorf("expected the amended order to stay post-only")
+	}
+
+	// Repricing through the spread cancels it rather than taking liquidity
+	trades, _, canceled, found := ex.AmendOrder(1, 51000, 0)
+	if !found || len(trades) != 0 {
+		t.Fatalf("expected no trades, got %d (found=%v)", len(trades), found)
+	}
+	if !reflect.DeepEqual(canceled, []int{1}) {
+		t.Errorf("expected order 1 canceled, got %v", canceled)
+	}
+	if len(ex.BuyOrders) != 0 || len(ex.SellOrders) != 1 {
+		t.Errorf("expected only the sell order to rest, got %d bids and %d asks", len(ex.BuyOrders), len(ex.SellOrders))
+	}
+}
+
+func TestExchange_AmendOrderTotal(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 5, Status: "open", CreatedAt: time.Now()})
+	ex.MatchOrder(models.Order{ID: 2, Type: "buy", Price: 100, Quantity: 2, Status: "open"})
+
+	// Repricing leaves what's left of the order as it is
+	if _, _, _, found := ex.AmendOrderTotal(1, 101, 0, 5); !found || ex.SellOrders[0].Quantity != 3 {
+		t.Fatalf("expected 3 left after repricing, got %+v (found=%v)", ex.SellOrders, found)
+	}
+
+	// Resizing leaves the new total less what has executed
+	if _, _, _, found := ex.AmendOrderTotal(1, 101, 4, 5); !found || ex.SellOrders[0].Quantity != 2 {
+		t.Fatalf("expected 2 left after resizing, got %+v (found=%v)", ex.SellOrders, found)
+	}
+
+	// An order that has executed its new total comes off the book
+	_, _, canceled, found := ex.AmendOrderTotal(1, 101, 2, 4)
+	if !found || !reflect.DeepEqual(canceled, []int{1}) || len(ex.SellOrders) != 0 {
+		t.Errorf("expected order 1 canceled, got %v with %d asks (found=%v)", canceled, len(ex.SellOrders), found)
+	}
+	if _, _, _, found := ex.AmendOrderTotal(1, 101, 4, 5); found {
+		t.Error("expected an order off the book not found")
+	}
+}
+
+func TestExchange_RemoveOrders(t *testing.T) {
+	ex := NewExchange()
+	orders := []models.Order{
+		{ID: 1, Type: "buy", Price: 50000, Quantity: 0.1, Status: "open", CreatedAt: time.Now()},
+		{ID: 2, Type: "buy", Price: 49000, Quantity: 0.1, Status: "open", CreatedAt: time.Now()},
+		{ID: 3, Type: "sell", Price: 51000, Quantity: 0.1, Status: "open", CreatedAt: time.Now()},
+	}
+	for _, order := range orders {
+		ex.AddOrder(order)
+	}
+
+	removed := ex.RemoveOrders([]int{1, 3, 999})
+	if removed != 2 {
+		t.Errorf("expected 2 orders removed, got %d", removed)
+	}
+	if len(ex.BuyOrders) != 1 || ex.BuyOrders[0].ID != 2 {
+		t.Errorf("expected only order 2 to remain on the buy side, got %+v", ex.BuyOrders)
+	}
+	if len(ex.SellOrders) != 0 {
+		t.Errorf("expected empty sell side, got %+v", ex.SellOrders)
+	}
+}
+
+func TestExchange_ExpireOrders(t *testing.T) {
+	ex := NewExchange()
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+	ex.AddOrder(models.Order{ID: 1, Type: "buy", Price: 100, Quantity: 1, Status: "open", TimeInForce: "GTD", ExpiresAt: &soon})
+	ex.AddOrder(models.Order{ID: 2, Type: "buy", Price: 99, Quantity: 1, Status: "open"})
+	ex.AddOrder(models.Order{ID: 3, Type: "sell", Price: 101, Quantity: 1, Status: "open", TimeInForce: "GTD", ExpiresAt: &later})
+	ex.Pause()
+	ex.MatchOrder(models.Order{ID: 4, Type: "sell", Price: 102, Quantity: 1, Status: "open", TimeInForce: "GTD", ExpiresAt: &soon})
+
+	if expired := ex.ExpireOrders(now); len(expired) != 0 {
+		t.Errorf("expected nothing to expire yet, got %v", expired)
+	}
+	version := ex.Version()
+	expired := ex.ExpireOrders(soon)
+	if !reflect.DeepEqual(expired, []int{1, 4}) {
+		t.Errorf("expected orders 1 and 4 to expire, got %v", expired)
+	}
+	if len(ex.BuyOrders) != 1 || ex.BuyOrders[0].ID != 2 || len(ex.SellOrders) != 1 || len(ex.queue) != 0 {
+		t.Errorf("expected orders 2 and 3 to remain, got %+v %+v %+v", ex.BuyOrders, ex.SellOrders, ex.queue)
+	}
+	if ex.Version() == version {
+		t.Errorf("expected expiring orders to change the version")
+	}
+}
+
+func TestExchange_Restore(t *testing.T) {
+	ex := NewExchange()
+	base := time.Now()
+
+	// Order 3 was accepted after order 1 and crosses it, so it never matched
+	crossed := ex.Restore([]models.Order{
+		{ID: 3, Type: "buy", Price: 101, Quantity: 1, Status: "open", CreatedAt: base.Add(2 * time.Second)},
+		{ID: 1, Type: "sell", Price: 100, Quantity: 0.4, Status: "open", CreatedAt: base},
+		{ID: 2, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: base.Add(time.Second)},
+	})
+	if len(crossed) != 1 || crossed[0] != 3 {
+		t.Errorf("expected order 3 left out as crossed, got %v", crossed)
+	}
+	if len(ex.SellOrders) != 1 || ex.SellOrders[0].ID != 1 || ex.SellOrders[0].Quantity != 0.4 {
+		t.Errorf("expected order 1 resting with its remaining quantity, got %+v", ex.SellOrders)
+	}
+	if len(ex.BuyOrders) != 1 || ex.BuyOrders[0].ID != 2 {
+		t.Errorf("expected only order 2 on the buy side, got %+v", ex.BuyOrders)
+	}
+}
+
+func TestExchange_MatchOrders(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	// The second order rests first and the third crosses it within the batch
+	trades, filled, _ := ex.MatchOrders([]models.Order{
+		{ID: 2, Type: "buy", Price: 100, Quantity: 0.4, Status: "open", CreatedAt: time.Now()},
+		{ID: 3, Type: "buy", Price: 90, Quantity: 1, Status: "open", CreatedAt: time.Now()},
+		{ID: 4, Type: "sell", Price: 90, Quantity: 0.5, Status: "open", CreatedAt: time.Now()},
+	})
+	if len(trades) != 2 {
+		t.Fatalf("expected 2 trades, got %d", len(trades))
+	}
+	if trades[0].BuyOrderID != 2 || trades[0].SellOrderID != 1 {
+		t.Errorf("expected order 2 to match order 1 first, got %+v", trades[0])
+	}
+	if trades[1].BuyOrderID != 3 || trades[1].SellOrderID != 4 || trades[1].Price != 90 {
+		t.Errorf("expected order 4 to match resting order 3 at 90, got %+v", trades[1])
+	}
+	if len(filled) != 2 || filled[0] != 2 || filled[1] != 4 {
+		t.Errorf("expected orders 2 and 4 filled, got %v", filled)
+	}
+
+	// While paused the whole batch is queued
+	ex.Pause()
+	trades, _, _ = ex.MatchOrders([]models.Order{
+		{ID: 5, Type: "buy", Price: 100, Quantity: 0.1, Status: "open", CreatedAt: time.Now()},
+		{ID: 6, Type: "buy", Price: 100, Quantity: 0.1, Status: "open", CreatedAt: time.Now()},
+	})
+	if len(trades) != 0 {
+		t.Errorf("expected no trades while paused, got %d", len(trades))
+	}
+	if _, _, queued := ex.PauseState(); queued != 2 {
+		t.Errorf("expected 2 queued orders, got %d", queued)
+	}
+}
+
+func TestExchange_ReassignOrders(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, UserID: 1, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 2, UserID: 2, Type: "buy", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 3, UserID: 1, Type: "sell", Price: 101, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	if moved := ex.ReassignOrders(1, 2); len(moved) != 2 {
+		t.Errorf("expected 2 orders moved, got %v", moved)
+	}
+	if ex.BuyOrders[1].ID != 1 || ex.BuyOrders[1].UserID != 2 || ex.SellOrders[0].UserID != 2 {
+		t.Errorf("expected orders reassigned in place, got %+v %+v", ex.BuyOrders, ex.SellOrders)
+	}
+
+	// Trades against moved orders are attributed to the new owner
+	trades, _, _ := ex.MatchOrder(models.Order{ID: 4, UserID: 3, Type: "buy", Price: 101, Quantity: 1, Status: "open"})
+	if len(trades) != 1 || trades[0].SellUserID != 2 {
+		t.Errorf("expected a trade against user 2, got %+v", trades)
+	}
+}
+
+func TestExchange_PauseResume(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	if !ex.Pause() {
+		t.Fatalf("expected pause to succeed")
+	}
+	if ex.Pause() {
+		t.Errorf("expected second pause to report already paused")
+	}
+
+	// Crossing orders queue without matching
+	trades, _, _ := ex.MatchOrder(models.Order{ID: 2, Type: "buy", Price: 101, Quantity: 0.5, Status: "open"})
+	if len(trades) != 0 {
+		t.Fatalf("expected no trades while paused, got %d", len(trades))
+	}
+	ex.MatchOrder(models.Order{ID: 3, Type: "buy", Price: 102, Quantity: 0.5, Status: "open"})
+	ex.MatchOrder(models.Order{ID: 4, Type: "buy", Price: 103, Quantity: 0.5, Status: "open"})
+
+	paused, since, queued := ex.PauseState()
+	if !paused || since.IsZero() || queued != 3 {
+		t.Fatalf("expected paused with 3 queued, got %v %v %d", paused, since, queued)
+	}
+
+	// Cancels and amendments still apply to queued orders
+	if !ex.RemoveOrder(3) {
+		t.Errorf("expected queued order to be cancelable")
+	}
+	if _, _, _, ok := ex.AmendOrder(4, 0, 0.25); !ok {
+		t.Errorf("expected queued order to be amendable")
+	}
+
+	// Resume matches the queue in arrival order
+	trades, filled, _, processed := ex.Resume()
+	if processed != 2 {
+		t.Errorf("expected 2 queued orders processed, got %d", processed)
+	}
+	if len(trades) != 2 || trades[0].BuyOrderID != 2 || trades[1].BuyOrderID != 4 || trades[1].Quantity != 0.25 {
+		t.Fatalf("unexpected trades: %+v", trades)
+	}
+	if len(filled) != 2 {
+		t.Errorf("expected orders 2 and 4 filled, got %v", filled)
+	}
+
+	buys, sells := ex.GetOrderBook()
+	if len(buys) != 0 || len(sells) != 1 || sells[0].Quantity != 0.25 {
+		t.Errorf("unexpected book after resume: %v %v", buys, sells)
+	}
+	if paused, _, _ := ex.PauseState(); paused {
+		t.Errorf("expected matching to be running")
+	}
+}
+
+func TestExchange_Stats(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 101, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 3, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	for i := 0; i < 3; i++ {
+		ex.MatchOrder(models.Order{ID: 10 + i, Type: "buy", Price: 100, Quantity: 0.1, Status: "open", CreatedAt: time.Now()})
+	}
+
+	stats := ex.Stats()
+	if len(stats.Symbols) != 1 {
+		t.Fatalf("expected one symbol, got %+v", stats.Symbols)
+	}
+	symbol := stats.Symbols[0]
+	if symbol.Symbol != DefaultSymbol || symbol.BuyOrders != 1 || symbol.SellOrders != 2 || symbol.QueuedOrders != 0 {
+		t.Errorf("unexpected order counts: %+v", symbol)
+	}
+	if symbol.Capacity < 3 || symbol.EstimatedBytes < int64(symbol.Capacity)*orderSize {
+		t.Errorf("expected memory estimate to cover allocated slots, got %+v", symbol)
+	}
+	if stats.Pool.Gets != 3 || stats.Pool.Puts != 3 || stats.Pool.Allocs > stats.Pool.Gets {
+		t.Errorf("unexpected pool stats: %+v", stats.Pool)
+	}
+	if stats.Timing.Matches != 3 {
+		t.Errorf("expected 3 timed matches, got %+v", stats.Timing)
+	}
+	if volume := ex.Volume(); volume.Trades != 3 || math.Abs(volume.Volume-0.3) > 1e-9 || math.Abs(volume.Notional-30) > 1e-9 {
+		t.Errorf("expected 3 trades of 0.3 for 30, got %+v", volume)
+	}
+}
+
+func TestExchange_Lifetime(t *testing.T) {
+	ex := NewExchange()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ex.SetClock(func() time.Time { return now })
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", Lifetime: time.Millisecond, CreatedAt: now})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 101, Quantity: 1, Status: "open", Lifetime: time.Hour, CreatedAt: now})
+	now = now.Add(2 * time.Millisecond)
+
+	// An expired quote is canceled rather than traded against, as a change
+	// to the book of its own
+	sequence := ex.Sequence()
+	trades, filled, canceled := ex.MatchOrder(models.Order{ID: 3, Type: "buy", Price: 101, Quantity: 1, Status: "open", TimeInForce: "IOC", CreatedAt: now})
+	if len(trades) != 1 || trades[0].SellOrderID != 2 {
+		t.Errorf("expected a trade against order 2, got %+v", trades)
+	}
+	if !reflect.DeepEqual(canceled, []int{1}) {
+		t.Errorf("expected order 1 canceled, got %v", canceled)
+	}
+	if !reflect.DeepEqual(filled, []int{3, 2}) {
+		t.Errorf("expected orders 3 and 2 filled, got %v", filled)
+	}
+	if got := ex.Sequence(); got != sequence+2 {
+		t.Errorf("expected the expiry and the trade numbered, got sequence %d after %d", got, sequence)
+	}
+
+	// Lifetimes run from when the order was placed, so a restored order
+	// keeps its deadline
+	ex.AddOrder(models.Order{ID: 4, Type: "buy", Price: 90, Quantity: 1, Status: "open", Lifetime: time.Second, CreatedAt: now.Add(-500 * time.Millisecond)})
+	if expired := ex.ExpireLifetimes(); len(expired) != 0 {
+		t.Errorf("expected nothing expired yet, got %v", expired)
+	}
+	before := ex.Version()
+	now = now.Add(500 * time.Millisecond)
+	if expired := ex.ExpireLifetimes(); !reflect.DeepEqual(expired, []int{4}) {
+		t.Errorf("expected order 4 expired, got %v", expired)
+	}
+	if ex.Version() == before {
+		t.Error("expected expiry to change the version")
+	}
+	if buys, _ := ex.GetOrderBook(); len(buys) != 0 {
+		t.Errorf("expected an empty book, got %+v", buys)
+	}
+}
+
+func TestExchange_ScratchBufferBounded(t *testing.T) {
+	var buf scratchBuffer
+	s := buf.get()
+	s.trades = make([]models.Trade, 0, maxPooledTrades+1)
+	buf.put(s)
+	if buf.discarded.Load() != 1 || buf.puts.Load() != 0 {
+		t.Errorf("expected oversized buffers discarded, got %d discarded, %d put", buf.discarded.Load(), buf.puts.Load())
+	}
+
+	// The same buffers serve every match until they're discarded
+	s = buf.get()
+	buf.put(s)
+	if buf.get() != s || buf.allocs.Load() != 2 {
+		t.Errorf("expected the buffers reused, got %d allocations", buf.allocs.Load())
+	}
+
+	// Results are copies, so reusing the buffers doesn't change them
+	s.trades = append(s.trades, models.Trade{BuyOrderID: 1})
+	s.filled = append(s.filled, 1)
+	s.canceled = append(s.canceled, 2, 3)
+	trades, filled, canceled := s.results()
+	buf.put(s)
+	s = buf.get()
+	s.trades = append(s.trades, models.Trade{BuyOrderID: 4})
+	s.filled = append(s.filled, 4)
+	if trades[0].BuyOrderID != 1 || !reflect.DeepEqual(filled, []int{1}) || !reflect.DeepEqual(canceled, []int{2, 3}) {
+		t.Errorf("expected results independent of the buffers, got %+v, %v, %v", trades, filled, canceled)
+	}
+
+	// Appending to the filled IDs doesn't overwrite the canceled ones
+	_ = append(filled, 9)
+	if canceled[0] != 2 {
+		t.Errorf("expected canceled IDs unchanged, got %v", canceled)
+	}
+}
+
+func TestExchange_Snapshot(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 101, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.Pause()
+	ex.MatchOrder(models.Order{ID: 3, Type: "buy", Price: 101, Quantity: 0.5, Status: "open", CreatedAt: time.Now()})
+
+	snapshot := ex.Snapshot()
+	if len(snapshot.BuyOrders) != 1 || len(snapshot.SellOrders) != 1 || len(snapshot.Queued) != 1 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	// The snapshot is a copy, and restoring it rebuilds the same book
+	ex.Resume()
+	if snapshot.SellOrders[0].Quantity != 1 {
+		t.Errorf("expected snapshot unaffected by matching, got %+v", snapshot.SellOrders[0])
+	}
+	restored := NewExchange()
+	if crossed := restored.Restore(snapshot.Orders()); len(crossed) != 1 || crossed[0] != 3 {
+		t.Errorf("expected queued crossing order 3 left out, got %v", crossed)
+	}
+	if len(restored.BuyOrders) != 1 || len(restored.SellOrders) != 1 || restored.SellOrders[0].Quantity != 1 {
+		t.Errorf("unexpected restored book: %+v %+v", restored.BuyOrders, restored.SellOrders)
+	}
+}
+
+func TestExchange_Version(t *testing.T) {
+	ex := NewExchange()
+	_, _, before := ex.VersionedOrderBook()
+	ex.AddOrder(models.Order{ID: 1, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	if ex.Version() == before {
+		t.Error("expected adding an order to change the version")
+	}
+
+	before = ex.Version()
+	ex.GetOrderBook()
+	if ex.Version() != before {
+		t.Error("expected reading the book to leave the version unchanged")
+	}
+	ex.RemoveOrder(1)
+	if ex.Version() == before {
+		t.Error("expected removing an order to change the version")
+	}
+}
+
+func TestExchange_Sequence(t *testing.T) {
+	ex := NewExchange()
+	now := time.Now()
+	start := ex.Sequence()
+	if start < uint64(now.Add(-time.Minute).UnixMicro()) {
+		t.Errorf("expected numbering to start from the time, got %d", start)
+	}
+
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: now})
+	ex.AddOrder(models.Order{ID: 2, Type: "sell", Price: 101, Quantity: 1, Status: "open", CreatedAt: now})
+	if ex.Sequence() != start+2 {
+		t.Errorf("expected each added order to take a number, got %d after %d", ex.Sequence(), start)
+	}
+
+	// Each trade takes the next number, then the rest of the order resting
+	trades, _, _ := ex.MatchOrder(models.Order{ID: 3, Type: "buy", Price: 101, Quantity: 3, Status: "open", CreatedAt: now})
+	if len(trades) != 2 || trades[0].Sequence != start+3 || trades[1].Sequence != start+4 {
+		t.Fatalf("expected trades numbered in turn, got %+v", trades)
+	}
+	buys, _, seq := ex.SequencedOrderBook()
+	if len(buys) != 1 || seq != start+5 {
+		t.Errorf("expected the resting order to take a number, got %d", seq)
+	}
+
+	// Operations that leave the book as it was don't
+	ex.MatchOrder(models.Order{ID: 4, Type: "sell", Price: 99, Quantity: 1, Status: "open", CreatedAt: now, PostOnly: true})
+	ex.RemoveOrder(99)
+	ex.ExpireOrders(now)
+	if _, _, seq := ex.SequencedTopOfBook(); seq != start+5 {
+		t.Errorf("expected no change to take a number, got %d", seq)
+	}
+	ex.RemoveOrder(3)
+	if ex.Sequence() != start+6 {
+		t.Errorf("expected removing an order to take a number, got %d", ex.Sequence())
+	}
+}
+
+// BenchmarkExchange_MatchOrder measures a buy that takes two resting sells,
+// the common shape of a match. The book is topped up between matches
+// outside the timer. AfterGC collects garbage between matches, as a busy
+// server does, so buffers that don't survive a collection are reallocated.
+func BenchmarkExchange_MatchOrder(b *testing.B) {
+	for _, gc := range []bool{false, true} {
+		name := "Steady"
+		if gc {
+			name = "AfterGC"
+		}
+		b.Run(name, func(b *testing.B) {
+			ex := NewExchange()
+			now := time.Now()
+			for id := 1; id <= 100; id++ {
+				ex.AddOrder(models.Order{ID: id, Type: "sell", Price: 100 + float64(id), Quantity: 1, Status: "open", CreatedAt: now})
+			}
+			id := 1000
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				ex.AddOrder(models.Order{ID: id + 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: now})
+				ex.AddOrder(models.Order{ID: id + 2, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: now})
+				if gc {
+					runtime.GC()
+					runtime.GC()
+				}
+				id += 3
+				b.StartTimer()
+
+				if trades, _, _ := ex.MatchOrder(models.Order{ID: id, Type: "buy", Price: 100, Quantity: 2, Status: "open", CreatedAt: now}); len(trades) != 2 {
+					b.Fatalf("expected 2 trades, got %d", len(trades))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrInvariant is wrapped by every invariant violation the engine reports
+var ErrInvariant = errors.New("engine invariant violated")
+
+// quantityTolerance absorbs floating point error when comparing quantities
+const quantityTolerance = 1e-9
+
+// SetInvariantCheck makes the exchange check its invariants after every
+// operation that changes the book: the book isn't crossed outside an
+// auction, each side is in price-time order and holds only open orders of
+// its side with quantity left, and each match fills the incoming order by
+// the quantity it trades and takes that quantity from the book. onViolation is called with each
+// violation, wrapping ErrInvariant, while the exchange is locked; it may
+// panic. Nil, the default, disables the checks, which scan the whole book.
+func (e *Exchange) SetInvariantCheck(onViolation func(error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onViolation = onViolation
+}
+
+// CheckInvariants checks the book's invariants now, whether or not checks
+// are enabled
+func (e *Exchange) CheckInvariants() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.checkBook()
+}
+
+// checkInvariants reports a violation of the book's invariants if checks are
+// enabled; callers must hold e.mu
+func (e *Exchange) checkInvariants() {
+	if e.onViolation == nil {
+		return
+	}
+	if err := e.checkBook(); err != nil {
+		e.onViolation(err)
+	}
+}
+
+// checkBook checks the book's invariants; callers must hold e.mu
+func (e *Exchange) checkBook() error {
+	if err := checkSide(e.BuyOrders, "buy"); err != nil {
+		return err
+	}
+	if err := checkSide(e.SellOrders, "sell"); err != nil {
+		return err
+	}
+	if e.market.State != MarketAuction && len(e.BuyOrders) > 0 && len(e.SellOrders) > 0 && e.BuyOrders[0].Price >= e.SellOrders[0].Price {
+		return fmt.Errorf("%w: book crossed, best bid %v of order %d at or above best ask %v of order %d",
+			ErrInvariant, e.BuyOrders[0].Price, e.BuyOrders[0].ID, e.SellOrders[0].Price, e.SellOrders[0].ID)
+	}
+	return nil
+}
+
+// checkSide checks that one side of the book holds open orders of that side
+// with quantity left, best price first and then earliest
+func checkSide(orders []models.Order, side string) error {
+	for i, order := range orders {
+		if order.Type != side || order.Status != "open" || order.Quantity <= 0 {
+			return fmt.Errorf("%w: %s order %d on the %s side of the book with %v left", ErrInvariant, order.Status, order.ID, side, order.Quantity)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := orders[i-1]
+		better := order.Price > prev.Price
+		if side == "sell" {
+			better = order.Price < prev.Price
+		}
+		if better || (order.Price == prev.Price && order.CreatedAt.Before(prev.CreatedAt)) {
+			return fmt.Errorf("%w: %s order %d at %v is queued behind order %d at %v", ErrInvariant, side, order.ID, order.Price, prev.ID, prev.Price)
+		}
+	}
+	return nil
+}
+
+// checkFill checks a match of an incoming order that had quantity to begin
+// with and remaining left after trades, given the quantity resting on the
+// other side of the book before and after; callers must hold e.mu
+func (e *Exchange) checkFill(order models.Order, quantity, remaining float64, trades []models.Trade, restingBefore, restingAfter float64) {
+	var traded float64
+	for _, trade := range trades {
+		crosses := trade.Price <= order.Price
+		taker := trade.BuyOrderID
+		if order.Type == "sell" {
+			crosses, taker = trade.Price >= order.Price, trade.SellOrderID
+		}
+		if trade.Quantity <= 0 || !crosses || taker != order.ID || trade.TakerSide != order.Type {
+			e.onViolation(fmt.Errorf("%w: order %d made trade %+v", ErrInvariant, order.ID, trade))
+			return
+		}
+		traded += trade.Quantity
+	}
+	if math.Abs(quantity-remaining-traded) > quantityTolerance {
+		e.onViolation(fmt.Errorf("%w: order %d filled %v but traded %v", ErrInvariant, order.ID, quantity-remaining, traded))
+		return
+	}
+	if math.Abs(restingBefore-restingAfter-traded) > quantityTolerance {
+		e.onViolation(fmt.Errorf("%w: order %d traded %v but took %v from the book", ErrInvariant, order.ID, traded, restingBefore-restingAfter))
+	}
+}
+
+// sideQuantity sums the quantity of the open orders of one side of the book
+func sideQuantity(orders []models.Order) float64 {
+	var total float64
+	for _, order := range orders {
+		if order.Status == "open" {
+			total += order.Quantity
+		}
+	}
+	return total
+}
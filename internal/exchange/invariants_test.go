@@ -0,0 +1,111 @@
+package exchange
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// TestExchange_InvariantsHold runs random sequences of operations with
+// invariant checks enabled
+func TestExchange_InvariantsHold(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		ex := NewExchange()
+		clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		ex.SetClock(func() time.Time { return clock })
+		var violation error
+		ex.SetInvariantCheck(func(err error) {
+			if violation == nil {
+				violation = err
+			}
+		})
+
+		nextID := 0
+		for step := 0; step < 500 && violation == nil; step++ {
+			clock = clock.Add(time.Millisecond)
+			switch op := rng.Intn(10); {
+			case op < 6:
+				nextID++
+				order := models.Order{
+					ID:        nextID,
+					UserID:    rng.Intn(5) + 1,
+					Type:      []string{"buy", "sell"}[rng.Intn(2)],
+					Price:     float64(95 + rng.Intn(11)),
+					Quantity:  float64(rng.Intn(20)+1) / 4,
+					Status:    "open",
+					CreatedAt: clock,
+				}
+				switch rng.Intn(6) {
+				case 0:
+					order.TimeInForce = "IOC"
+				case 1:
+					order.TimeInForce = "FOK"
+				case 2:
+					order.PostOnly = true
+				case 3:
+					order.DisplayQuantity = 0.5
+				}
+				ex.MatchOrder(order)
+			case op < 8 && nextID > 0:
+				ex.AmendOrder(rng.Intn(nextID)+1, float64(95+rng.Intn(11)), float64(rng.Intn(20)+1)/4)
+			case op < 9 && nextID > 0:
+				ex.RemoveOrder(rng.Intn(nextID) + 1)
+			default:
+				if !ex.Pause() {
+					ex.Resume()
+				}
+			}
+		}
+		ex.Resume()
+		if violation != nil {
+			t.Fatalf("seed %d: %v", seed, violation)
+		}
+	}
+}
+
+func TestExchange_InvariantViolations(t *testing.T) {
+	var violations []error
+	ex := NewExchange()
+	ex.SetInvariantCheck(func(err error) { violations = append(violations, err) })
+
+	now := time.Now()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: now})
+	if len(violations) != 0 {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+
+	// Adding bypasses matching, so a crossing order crosses the book
+	ex.AddOrder(models.Order{ID: 2, Type: "buy", Price: 101, Quantity: 1, Status: "open", CreatedAt: now})
+	if len(violations) != 1 || !errors.Is(violations[0], ErrInvariant) {
+		t.Fatalf("expected a crossed book to be reported, got %v", violations)
+	}
+	ex.RemoveOrder(2)
+
+	// Time priority broken at a price
+	ex.SellOrders = append(ex.SellOrders, models.Order{ID: 3, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: now.Add(-time.Second)})
+	if err := ex.CheckInvariants(); !errors.Is(err, ErrInvariant) {
+		t.Errorf("expected out of order orders to be reported, got %v", err)
+	}
+	ex.SellOrders = ex.SellOrders[:1]
+
+	// An order on the wrong side
+	ex.BuyOrders = append(ex.BuyOrders, models.Order{ID: 4, Type: "sell", Price: 90, Quantity: 1, Status: "open", CreatedAt: now})
+	if err := ex.CheckInvariants(); !errors.Is(err, ErrInvariant) {
+		t.Errorf("expected an order on the wrong side to be reported, got %v", err)
+	}
+	ex.BuyOrders = nil
+
+	// A match that doesn't take what it trades from the book
+	violations = nil
+	ex.mu.Lock()
+	ex.checkFill(models.Order{ID: 5, Type: "buy", Price: 100}, 1, 0,
+		[]models.Trade{{BuyOrderID: 5, SellOrderID: 1, Price: 100, Quantity: 1, TakerSide: "buy"}}, 1, 0.5)
+	ex.mu.Unlock()
+	if len(violations) != 1 {
+		t.Errorf("expected a mismatched fill to be reported, got %v", violations)
+	}
+}
@@ -0,0 +1,85 @@
+package exchange
+
+import (
+	"sort"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// lifetimes tracks when orders placed with a lifetime are due to come off
+// the book
+type lifetimes struct {
+	deadlines map[int]time.Time // By order ID
+	next      time.Time         // Earliest deadline; zero if there are none
+}
+
+// track starts an order's lifetime when it first rests on the book, from
+// when it was placed, or from now if it has no creation time. An order
+// re-booked by an amendment keeps its deadline.
+func (l *lifetimes) track(order models.Order, now time.Time) {
+	if order.Lifetime <= 0 {
+		return
+	}
+	if _, ok := l.deadlines[order.ID]; ok {
+		return
+	}
+	if l.deadlines == nil {
+		l.deadlines = make(map[int]time.Time)
+	}
+	if !order.CreatedAt.IsZero() {
+		now = order.CreatedAt
+	}
+	deadline := now.Add(order.Lifetime)
+	l.deadlines[order.ID] = deadline
+	if l.next.IsZero() || deadline.Before(l.next) {
+		l.next = deadline
+	}
+}
+
+// ExpireLifetimes takes every order that has outlived its lifetime by the
+// exchange's clock off the book in a single step. Returns the IDs of the
+// orders removed.
+func (e *Exchange) ExpireLifetimes() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.checkInvariants()
+
+	// Sweeps usually find nothing, so only bump the version if they don't
+	expired := e.expireLifetimes(e.now())
+	if len(expired) > 0 {
+		e.version++
+	}
+	return expired
+}
+
+// expireLifetimes removes the orders whose lifetime has run out by now as a
+// single numbered change, forgetting deadlines of orders that already left
+// the book, and returns the IDs of those removed in order; callers must
+// hold e.mu
+func (e *Exchange) expireLifetimes(now time.Time) []int {
+	l := &e.lifetimes
+	if l.next.IsZero() || l.next.After(now) {
+		return nil
+	}
+
+	var expired []int
+	l.next = time.Time{}
+	for orderID, deadline := range l.deadlines {
+		if deadline.After(now) {
+			if l.next.IsZero() || deadline.Before(l.next) {
+				l.next = deadline
+			}
+			continue
+		}
+		delete(l.deadlines, orderID)
+		if _, ok := e.removeOrder(orderID); ok {
+			expired = append(expired, orderID)
+		}
+	}
+	if len(expired) > 0 {
+		e.nextSequence()
+	}
+	sort.Ints(expired)
+	return expired
+}
@@ -0,0 +1,88 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MarketState controls which orders the market accepts and whether they match
+type MarketState string
+
+const (
+	// MarketOpen accepts and matches orders
+	MarketOpen MarketState = "open"
+	// MarketPostOnly accepts orders but doesn't match them: every order is
+	// treated as post-only, so orders that would cross are canceled
+	MarketPostOnly MarketState = "post_only"
+	// MarketHalted rejects new orders and amendments and doesn't match;
+	// cancels still apply
+	MarketHalted MarketState = "halted"
+	// MarketAuction is a call auction: orders rest on the book without
+	// matching, even if they cross it, until it is uncrossed at a single
+	// price and the market opens
+	MarketAuction MarketState = "auction"
+)
+
+// ErrMarketTransition is returned when the market can't move to a state
+// from its current one
+var ErrMarketTransition = errors.New("invalid market state transition")
+
+// marketTransitions lists the states each state may move to. A halted
+// market reopens through post-only so the book can rebuild before matching
+// resumes, or through an auction. An auction's book may be crossed, so it
+// only ends by uncrossing, which opens the market.
+var marketTransitions = map[MarketState][]MarketState{
+	MarketOpen:     {MarketPostOnly, MarketHalted, MarketAuction},
+	MarketPostOnly: {MarketOpen, MarketHalted, MarketAuction},
+	MarketHalted:   {MarketPostOnly, MarketAuction},
+	MarketAuction:  {},
+}
+
+// ParseMarketState validates a market state name
+func ParseMarketState(value string) (MarketState, error) {
+	state := MarketState(value)
+	if _, ok := marketTransitions[state]; !ok {
+		return "", fmt.Errorf("unknown market state %q", value)
+	}
+	return state, nil
+}
+
+// MarketStatus is the market's state, when it was entered and why
+type MarketStatus struct {
+	State  MarketState `json:"state"`
+	Since  time.Time   `json:"since"`
+	Reason string      `json:"reason,omitempty"`
+	Until  *time.Time  `json:"until,omitempty"` // When an auction is scheduled to uncross
+}
+
+// MarketStatus returns the market's current state
+func (e *Exchange) MarketStatus() MarketStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.market
+}
+
+// SetMarketState moves the market to a new state, returning the new status.
+// Returns an error wrapping ErrMarketTransition if the move isn't allowed,
+// including to the current state.
+func (e *Exchange) SetMarketState(state MarketState, reason string) (MarketStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setMarketState(state, reason)
+}
+
+// setMarketState moves the market to a new state if allowed; callers must
+// hold e.mu
+func (e *Exchange) setMarketState(state MarketState, reason string) (MarketStatus, error) {
+	allowed := false
+	for _, next := range marketTransitions[e.market.State] {
+		allowed = allowed || next == state
+	}
+	if !allowed {
+		return e.market, fmt.Errorf("%w: %s to %s", ErrMarketTransition, e.market.State, state)
+	}
+
+	e.market = MarketStatus{State: state, Since: e.now(), Reason: reason}
+	return e.market, nil
+}
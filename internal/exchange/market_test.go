@@ -0,0 +1,81 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestExchange_SetMarketState(t *testing.T) {
+	ex := NewExchange()
+	if state := ex.MarketStatus().State; state != MarketOpen {
+		t.Fatalf("expected a new market to be open, got %s", state)
+	}
+
+	steps := []struct {
+		state       MarketState
+		expectError bool
+	}{
+		{state: MarketOpen, expectError: true},
+		{state: MarketHalted},
+		{state: MarketOpen, expectError: true}, // Halted markets reopen through post-only
+		{state: MarketPostOnly},
+		{state: MarketOpen},
+		{state: MarketPostOnly},
+		{state: MarketHalted},
+	}
+	for _, step := range steps {
+		status, err := ex.SetMarketState(step.state, "test")
+		if step.expectError {
+			if !errors.Is(err, ErrMarketTransition) {
+				t.Errorf("to %s: expected ErrMarketTransition, got %v", step.state, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("to %s: unexpected error: %v", step.state, err)
+		}
+		if status.State != step.state || status.Reason != "test" || status.Since.IsZero() {
+			t.Errorf("to %s: unexpected status %+v", step.state, status)
+		}
+	}
+
+	if _, err := ParseMarketState("closed"); err == nil {
+		t.Errorf("expected error for unknown state")
+	}
+}
+
+func TestExchange_PostOnlyMarket(t *testing.T) {
+	ex := NewExchange()
+	ex.AddOrder(models.Order{ID: 1, Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	ex.SetMarketState(MarketPostOnly, "")
+
+	// Crossing orders are canceled instead of matching; others rest
+	trades, _, canceled := ex.MatchOrder(models.Order{ID: 2, Type: "buy", Price: 101, Quantity: 1, Status: "open"})
+	if len(trades) != 0 || len(canceled) != 1 || canceled[0] != 2 {
+		t.Fatalf("expected crossing order canceled, got trades %+v canceled %v", trades, canceled)
+	}
+	_, _, canceled = ex.MatchOrder(models.Order{ID: 3, Type: "buy", Price: 99, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	if len(canceled) != 0 {
+		t.Fatalf("expected resting order accepted, got canceled %v", canceled)
+	}
+
+	// So are amendments that would cross
+	trades, _, canceled, ok := ex.AmendOrder(3, 100, 0)
+	if !ok || len(trades) != 0 || len(canceled) != 1 || canceled[0] != 3 {
+		t.Fatalf("expected amended order canceled, got trades %+v canceled %v", trades, canceled)
+	}
+	buyOrders, _ := ex.GetOrderBook()
+	if len(buyOrders) != 0 {
+		t.Errorf("expected no resting buy orders, got %+v", buyOrders)
+	}
+
+	// Matching resumes once the market opens
+	ex.SetMarketState(MarketOpen, "")
+	trades, _, _ = ex.MatchOrder(models.Order{ID: 4, Type: "buy", Price: 100, Quantity: 1, Status: "open"})
+	if len(trades) != 1 {
+		t.Errorf("expected 1 trade once open, got %d", len(trades))
+	}
+}
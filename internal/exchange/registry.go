@@ -0,0 +1,321 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ErrUnknownMarket is returned for a symbol the registry has no engine for
+var ErrUnknownMarket = errors.New("unknown market")
+
+// ErrRegistryClosed is returned for commands sent after the registry closed
+var ErrRegistryClosed = errors.New("market registry closed")
+
+// DefaultQueueSize is the number of commands a market queues before
+// senders wait
+const DefaultQueueSize = 1024
+
+// marketLoop runs one market's engine on its own goroutine, applying
+// commands in the order they were queued
+type marketLoop struct {
+	ex       *Exchange
+	commands chan func()
+	quit     chan struct{} // Closed when the registry closes
+	done     chan struct{}
+}
+
+func (l *marketLoop) run() {
+	defer close(l.done)
+	for {
+		select {
+		case command := <-l.commands:
+			command()
+		case <-l.quit:
+			// Finish the commands queued before the registry closed
+			for {
+				select {
+				case command := <-l.commands:
+					command()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Registry holds an engine per market, each matched on its own goroutine
+// from its own command queue, so a busy book doesn't delay matching in
+// another
+type Registry struct {
+	queueSize int
+
+	mu      sync.RWMutex
+	markets map[string]*marketLoop
+	closed  bool
+}
+
+// NewRegistry creates an empty registry whose markets queue up to
+// queueSize commands
+func NewRegistry(queueSize int) *Registry {
+	return &Registry{queueSize: queueSize, markets: make(map[string]*marketLoop)}
+}
+
+// Add starts matching a market on ex. It replaces no existing market:
+// adding a symbol twice returns an error.
+func (r *Registry) Add(symbol string, ex *Exchange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRegistryClosed
+	}
+	if _, ok := r.markets[symbol]; ok {
+		return fmt.Errorf("market %s already registered", symbol)
+	}
+	loop := &marketLoop{ex: ex, commands: make(chan func(), r.queueSize), quit: make(chan struct{}), done: make(chan struct{})}
+	r.markets[symbol] = loop
+	go loop.run()
+	return nil
+}
+
+// Exchange returns a market's engine, for reads that don't need to queue
+// behind matching
+func (r *Registry) Exchange(symbol string) (*Exchange, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	loop, ok := r.markets[symbol]
+	if !ok {
+		return nil, false
+	}
+	return loop.ex, true
+}
+
+// Symbols lists the registered markets in alphabetical order
+func (r *Registry) Symbols() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	symbols := make([]string, 0, len(r.markets))
+	for symbol := range r.markets {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Do runs fn on a market's goroutine after the commands queued before it,
+// and waits for it to finish. Returns ErrRegistryClosed, without running
+// fn, if the registry closes first.
+func (r *Registry) Do(symbol string, fn func(*Exchange)) error {
+	r.mu.RLock()
+	closed := r.closed
+	loop, ok := r.markets[symbol]
+	r.mu.RUnlock()
+	if closed {
+		return ErrRegistryClosed
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownMarket, symbol)
+	}
+
+	// The lock isn't held while waiting for room in the queue, so a full
+	// queue doesn't hold up Add or Close
+	finished := make(chan struct{})
+	command := func() {
+		defer close(finished)
+		fn(loop.ex)
+	}
+	select {
+	case loop.commands <- command:
+	case <-loop.quit:
+		return ErrRegistryClosed
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-loop.done:
+		// The loop stopped; it ran the command only if it finished first
+		select {
+		case <-finished:
+			return nil
+		default:
+			return ErrRegistryClosed
+		}
+	}
+}
+
+// doAll runs fn on every market in turn, in alphabetical order, returning
+// the first error
+func (r *Registry) doAll(fn func(*Exchange)) error {
+	var firstErr error
+	for _, symbol := range r.Symbols() {
+		if err := r.Do(symbol, fn); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// MatchOrder matches a new order on its symbol's market, with the results
+// of Exchange.MatchOrder
+func (r *Registry) MatchOrder(order models.Order) ([]models.Trade, []int, []int, error) {
+	var trades []models.Trade
+	var filled, canceled []int
+	err := r.Do(order.Symbol, func(ex *Exchange) {
+		trades, filled, canceled = ex.MatchOrder(order)
+	})
+	return trades, filled, canceled, err
+}
+
+// AmendOrder amends a resting order on its symbol's market, with the
+// results of Exchange.AmendOrder
+func (r *Registry) AmendOrder(symbol string, orderID int, price, quantity float64) ([]models.Trade, []int, []int, bool, error) {
+	var trades []models.Trade
+	var filled, canceled []int
+	var found bool
+	err := r.Do(symbol, func(ex *Exchange) {
+		trades, filled, canceled, found = ex.AmendOrder(orderID, price, quantity)
+	})
+	return trades, filled, canceled, found, err
+}
+
+// AmendOrderTotal amends a resting order on its symbol's market by its
+// total quantity, with the results of Exchange.AmendOrderTotal
+func (r *Registry) AmendOrderTotal(symbol string, orderID int, price, total, previousTotal float64) ([]models.Trade, []int, []int, bool, error) {
+	var trades []models.Trade
+	var filled, canceled []int
+	var found bool
+	err := r.Do(symbol, func(ex *Exchange) {
+		trades, filled, canceled, found = ex.AmendOrderTotal(orderID, price, total, previousTotal)
+	})
+	return trades, filled, canceled, found, err
+}
+
+// RemoveOrders takes canceled orders off whichever markets they rest on,
+// returning how many were resting
+func (r *Registry) RemoveOrders(orderIDs []int) (int, error) {
+	removed := 0
+	err := r.doAll(func(ex *Exchange) {
+		removed += ex.RemoveOrders(orderIDs)
+	})
+	return removed, err
+}
+
+// ReassignOrders moves every order of one user resting or queued on any
+// market to another, returning the IDs of the orders moved. Markets that
+// did move orders have them returned alongside any error.
+func (r *Registry) ReassignOrders(fromUserID, toUserID int) ([]int, error) {
+	var moved []int
+	err := r.doAll(func(ex *Exchange) {
+		moved = append(moved, ex.ReassignOrders(fromUserID, toUserID)...)
+	})
+	return moved, err
+}
+
+// ExpireOrders takes the GTD orders that have expired by now off every
+// market, returning their IDs
+func (r *Registry) ExpireOrders(now time.Time) ([]int, error) {
+	var expired []int
+	err := r.doAll(func(ex *Exchange) {
+		expired = append(expired, ex.ExpireOrders(now)...)
+	})
+	return expired, err
+}
+
+// ExpireLifetimes takes the orders that have outlived their lifetime off
+// every market, returning their IDs. Markets that did expire orders have
+// them returned alongside any error.
+func (r *Registry) ExpireLifetimes() ([]int, error) {
+	var expired []int
+	err := r.doAll(func(ex *Exchange) {
+		expired = append(expired, ex.ExpireLifetimes()...)
+	})
+	return expired, err
+}
+
+// MatchOrders matches a batch of new orders, each market's orders as one
+// step on that market's goroutine. Markets are matched concurrently and
+// their results combined in the order each market first appears in the
+// batch. Nothing is matched if any order's market is unknown.
+func (r *Registry) MatchOrders(orders []models.Order) ([]models.Trade, []int, []int, error) {
+	var symbols []string
+	bySymbol := make(map[string][]models.Order)
+	for _, order := range orders {
+		if _, ok := r.Exchange(order.Symbol); !ok {
+			return nil, nil, nil, fmt.Errorf("%w: %s", ErrUnknownMarket, order.Symbol)
+		}
+		if _, ok := bySymbol[order.Symbol]; !ok {
+			symbols = append(symbols, order.Symbol)
+		}
+		bySymbol[order.Symbol] = append(bySymbol[order.Symbol], order)
+	}
+
+	type result struct {
+		trades           []models.Trade
+		filled, canceled []int
+		err              error
+	}
+	results := make([]result, len(symbols))
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &results[i]
+			res.err = r.Do(symbol, func(ex *Exchange) {
+				res.trades, res.filled, res.canceled = ex.MatchOrders(bySymbol[symbol])
+			})
+		}()
+	}
+	wg.Wait()
+
+	// Markets that did match must have their results recorded, so they are
+	// returned alongside the first error
+	var trades []models.Trade
+	var filled, canceled []int
+	var err error
+	for _, res := range results {
+		if res.err != nil && err == nil {
+			err = res.err
+		}
+		trades = append(trades, res.trades...)
+		filled = append(filled, res.filled...)
+		canceled = append(canceled, res.canceled...)
+	}
+	return trades, filled, canceled, err
+}
+
+// QueueLengths reports how many commands each market has waiting
+func (r *Registry) QueueLengths() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lengths := make(map[string]int, len(r.markets))
+	for symbol, loop := range r.markets {
+		lengths[symbol] = len(loop.commands)
+	}
+	return lengths
+}
+
+// Close stops accepting commands and waits for every market to finish the
+// ones already queued
+func (r *Registry) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	for _, loop := range r.markets {
+		close(loop.quit)
+	}
+	r.mu.Unlock()
+
+	for _, loop := range r.markets {
+		<-loop.done
+	}
+}
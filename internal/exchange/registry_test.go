@@ -0,0 +1,187 @@
+package exchange
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestRegistry_MatchOrder(t *testing.T) {
+	r := NewRegistry(DefaultQueueSize)
+	defer r.Close()
+	btc, eth := NewExchange(), NewExchange()
+	if err := r.Add("BTC-USD", btc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Add("ETH-USD", eth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Add("ETH-USD", NewExchange()); err == nil {
+		t.Errorf("expected error adding a market twice, got nil")
+	}
+
+	btc.AddOrder(models.Order{ID: 1, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	trades, filled, _, err := r.MatchOrder(models.Order{ID: 2, Symbol: "BTC-USD", Type: "buy", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	if err != nil || len(trades) != 1 || len(filled) != 2 {
+		t.Fatalf("expected one trade filling both orders, got %v, %v, err %v", trades, filled, err)
+	}
+
+	// Each market only sees its own orders
+	if _, _, _, err := r.MatchOrder(models.Order{ID: 3, Symbol: "ETH-USD", Type: "buy", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buys, _ := eth.GetOrderBook(); len(buys) != 1 {
+		t.Errorf("expected the ETH order to rest on the ETH book, got %v", buys)
+	}
+	if buys, _ := btc.GetOrderBook(); len(buys) != 0 {
+		t.Errorf("expected the BTC book to be empty, got %v", buys)
+	}
+
+	if _, _, _, err := r.MatchOrder(models.Order{ID: 4, Symbol: "DOGE-USD", Type: "buy", Price: 1, Quantity: 1}); !errors.Is(err, ErrUnknownMarket) {
+		t.Errorf("expected ErrUnknownMarket, got %v", err)
+	}
+	if symbols := r.Symbols(); len(symbols) != 2 || symbols[0] != "BTC-USD" || symbols[1] != "ETH-USD" {
+		t.Errorf("expected both symbols, got %v", symbols)
+	}
+}
+
+func TestRegistry_MarketsIndependent(t *testing.T) {
+	r := NewRegistry(DefaultQueueSize)
+	defer r.Close()
+	r.Add("BTC-USD", NewExchange())
+	r.Add("ETH-USD", NewExchange())
+
+	// A BTC command that hasn't finished doesn't hold up ETH
+	release := make(chan struct{})
+	go r.Do("BTC-USD", func(*Exchange) { <-release })
+	done := make(chan error)
+	go func() {
+		_, _, _, err := r.MatchOrder(models.Order{ID: 1, Symbol: "ETH-USD", Type: "buy", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ETH match waited for BTC")
+	}
+	close(release)
+}
+
+func TestRegistry_MatchOrders(t *testing.T) {
+	r := NewRegistry(DefaultQueueSize)
+	btc, eth := NewExchange(), NewExchange()
+	r.Add("BTC-USD", btc)
+	r.Add("ETH-USD", eth)
+
+	orders := []models.Order{
+		{ID: 1, Symbol: "ETH-USD", Type: "sell", Price: 10, Quantity: 1, Status: "open", CreatedAt: time.Now()},
+		{ID: 2, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()},
+		{ID: 3, Symbol: "ETH-USD", Type: "buy", Price: 10, Quantity: 1, Status: "open", CreatedAt: time.Now()},
+	}
+	trades, filled, _, err := r.MatchOrders(orders)
+	if err != nil || len(trades) != 1 || len(filled) != 2 {
+		t.Fatalf("expected the ETH orders to trade, got %v, %v, err %v", trades, filled, err)
+	}
+	if _, sells := btc.GetOrderBook(); len(sells) != 1 {
+		t.Errorf("expected the BTC order to rest, got %v", sells)
+	}
+
+	if _, _, _, err := r.MatchOrders(append(orders, models.Order{ID: 4, Symbol: "DOGE-USD"})); !errors.Is(err, ErrUnknownMarket) {
+		t.Errorf("expected ErrUnknownMarket, got %v", err)
+	}
+
+	r.Close()
+	if _, _, _, err := r.MatchOrder(orders[0]); !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("expected ErrRegistryClosed, got %v", err)
+	}
+}
+
+func TestRegistry_CloseWithFullQueue(t *testing.T) {
+	r := NewRegistry(1)
+	r.Add("BTC-USD", NewExchange())
+
+	// Hold the market's goroutine and fill its queue, so the next command
+	// waits for room
+	running, release := make(chan struct{}), make(chan struct{})
+	go r.Do("BTC-USD", func(*Exchange) {
+		close(running)
+		<-release
+	})
+	<-running
+	go r.Do("BTC-USD", func(*Exchange) {})
+	time.Sleep(10 * time.Millisecond)
+	blocked := make(chan error, 1)
+	go func() { blocked <- r.Do("BTC-USD", func(*Exchange) {}) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// Adding a market and closing don't wait on the full queue
+	if err := r.Add("ETH-USD", NewExchange()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, ErrRegistryClosed) {
+			t.Errorf("expected ErrRegistryClosed for the waiting command, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting command not released by Close")
+	}
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked")
+	}
+
+	if err := r.Do("BTC-USD", func(*Exchange) {}); !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("expected ErrRegistryClosed, got %v", err)
+	}
+}
+
+func TestRegistry_RemoveOrders(t *testing.T) {
+	r := NewRegistry(DefaultQueueSize)
+	defer r.Close()
+	btc, eth := NewExchange(), NewExchange()
+	r.Add("BTC-USD", btc)
+	r.Add("ETH-USD", eth)
+	btc.AddOrder(models.Order{ID: 1, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	eth.AddOrder(models.Order{ID: 2, Symbol: "ETH-USD", Type: "sell", Price: 10, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	removed, err := r.RemoveOrders([]int{1, 2, 3})
+	if err != nil || removed != 2 {
+		t.Fatalf("expected both resting orders removed, got %d, err %v", removed, err)
+	}
+	if _, sells := eth.GetOrderBook(); len(sells) != 0 {
+		t.Errorf("expected the ETH book to be empty, got %v", sells)
+	}
+}
+
+func TestRegistry_ReassignOrders(t *testing.T) {
+	r := NewRegistry(DefaultQueueSize)
+	defer r.Close()
+	btc, eth := NewExchange(), NewExchange()
+	r.Add("BTC-USD", btc)
+	r.Add("ETH-USD", eth)
+	btc.AddOrder(models.Order{ID: 1, UserID: 1, Symbol: "BTC-USD", Type: "sell", Price: 100, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	eth.AddOrder(models.Order{ID: 2, UserID: 1, Symbol: "ETH-USD", Type: "sell", Price: 10, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+	eth.AddOrder(models.Order{ID: 3, UserID: 3, Symbol: "ETH-USD", Type: "buy", Price: 9, Quantity: 1, Status: "open", CreatedAt: time.Now()})
+
+	moved, err := r.ReassignOrders(1, 2)
+	if err != nil || !reflect.DeepEqual(moved, []int{1, 2}) {
+		t.Fatalf("expected orders 1 and 2 moved, got %v, err %v", moved, err)
+	}
+	if _, sells := eth.GetOrderBook(); len(sells) != 1 || sells[0].UserID != 2 {
+		t.Errorf("expected the ETH order to belong to user 2, got %v", sells)
+	}
+}
@@ -0,0 +1,30 @@
+package exchange
+
+import "github.com/xtrntr/exchange/internal/models"
+
+// Snapshot is a copy of the engine's resting and queued orders, each with
+// the quantity it has left
+type Snapshot struct {
+	BuyOrders  []models.Order `json:"buy_orders"`
+	SellOrders []models.Order `json:"sell_orders"`
+	Queued     []models.Order `json:"queued"`
+}
+
+// Orders returns every order in the snapshot
+func (s Snapshot) Orders() []models.Order {
+	orders := make([]models.Order, 0, len(s.BuyOrders)+len(s.SellOrders)+len(s.Queued))
+	orders = append(orders, s.BuyOrders...)
+	orders = append(orders, s.SellOrders...)
+	return append(orders, s.Queued...)
+}
+
+// Snapshot copies the book and the orders queued while paused in one step
+func (e *Exchange) Snapshot() Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Snapshot{
+		BuyOrders:  append([]models.Order(nil), e.BuyOrders...),
+		SellOrders: append([]models.Order(nil), e.SellOrders...),
+		Queued:     append([]models.Order(nil), e.queue...),
+	}
+}
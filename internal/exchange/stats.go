@@ -0,0 +1,198 @@
+package exchange
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// maxPooledTrades bounds the buffers kept for reuse, so one large sweep of
+// the book doesn't pin its memory for the life of the process
+const maxPooledTrades = 1024
+
+// matchScratch holds the buffers a match appends its results to. They are
+// reused across matches and the results copied out at the end, so a match
+// allocates its results once instead of on every append.
+type matchScratch struct {
+	trades   []models.Trade
+	filled   []int
+	canceled []int
+}
+
+// results copies out what the match produced, returning nil for empty
+// results. The filled and canceled IDs share one allocation.
+func (s *matchScratch) results() ([]models.Trade, []int, []int) {
+	var trades []models.Trade
+	if len(s.trades) > 0 {
+		trades = append(make([]models.Trade, 0, len(s.trades)), s.trades...)
+	}
+	if len(s.filled)+len(s.canceled) == 0 {
+		return trades, nil, nil
+	}
+	ids := make([]int, 0, len(s.filled)+len(s.canceled))
+	ids = append(append(ids, s.filled...), s.canceled...)
+	filled, canceled := ids[:len(s.filled):len(s.filled)], ids[len(s.filled):]
+	if len(filled) == 0 {
+		filled = nil
+	}
+	if len(canceled) == 0 {
+		canceled = nil
+	}
+	return trades, filled, canceled
+}
+
+// scratchBuffer is the engine's one set of match buffers. Every match runs
+// under the engine lock, so one set serves them all and, unlike a
+// sync.Pool, isn't dropped by garbage collection. It counts its use.
+type scratchBuffer struct {
+	s         *matchScratch
+	gets      atomic.Uint64
+	allocs    atomic.Uint64
+	puts      atomic.Uint64
+	discarded atomic.Uint64
+}
+
+// get returns the buffers, allocating them if there are none; callers
+// must hold the engine lock until they put them back
+func (b *scratchBuffer) get() *matchScratch {
+	b.gets.Add(1)
+	if b.s == nil {
+		b.allocs.Add(1)
+		b.s = &matchScratch{}
+	}
+	return b.s
+}
+
+// put empties the buffers for reuse, or drops them if they grew past
+// maxPooledTrades
+func (b *scratchBuffer) put(s *matchScratch) {
+	if cap(s.trades) > maxPooledTrades || cap(s.filled) > 2*maxPooledTrades || cap(s.canceled) > maxPooledTrades {
+		b.discarded.Add(1)
+		b.s = nil
+		return
+	}
+	s.trades = s.trades[:0]
+	s.filled = s.filled[:0]
+	s.canceled = s.canceled[:0]
+	b.puts.Add(1)
+}
+
+// PoolStats counts how match buffers were obtained. Gets served without an
+// allocation reused the engine's buffers.
+type PoolStats struct {
+	Gets      uint64 `json:"gets"`
+	Allocs    uint64 `json:"allocs"`
+	Puts      uint64 `json:"puts"`
+	Discarded uint64 `json:"discarded"` // Too large to keep for reuse
+}
+
+// matchTimer accumulates how long matches waited for the book and ran for
+type matchTimer struct {
+	matches  atomic.Uint64
+	lockWait atomic.Int64 // Nanoseconds
+	running  atomic.Int64 // Nanoseconds
+}
+
+// observe records a match that asked for the book at start, got it at
+// locked and finished now
+func (t *matchTimer) observe(start, locked time.Time) {
+	t.matches.Add(1)
+	t.lockWait.Add(int64(locked.Sub(start)))
+	t.running.Add(int64(time.Since(locked)))
+}
+
+// MatchTiming breaks down the time spent matching new orders since the
+// engine started into waiting for the book and running the matching loop
+type MatchTiming struct {
+	Matches        uint64  `json:"matches"`
+	LockWaitNs     int64   `json:"lock_wait_ns"`
+	MatchNs        int64   `json:"match_ns"`
+	MeanLockWaitUs float64 `json:"mean_lock_wait_us"`
+	MeanMatchUs    float64 `json:"mean_match_us"`
+}
+
+func (t *matchTimer) timing() MatchTiming {
+	timing := MatchTiming{Matches: t.matches.Load(), LockWaitNs: t.lockWait.Load(), MatchNs: t.running.Load()}
+	if timing.Matches > 0 {
+		timing.MeanLockWaitUs = float64(timing.LockWaitNs) / float64(timing.Matches) / 1e3
+		timing.MeanMatchUs = float64(timing.MatchNs) / float64(timing.Matches) / 1e3
+	}
+	return timing
+}
+
+// MarketVolume totals the trades a market's engine has matched since it
+// started
+type MarketVolume struct {
+	Trades   int64   `json:"trades"`
+	Volume   float64 `json:"volume"`   // Base quantity traded
+	Notional float64 `json:"notional"` // Quote value traded
+}
+
+// add counts trades into the totals
+func (v *MarketVolume) add(trades []models.Trade) {
+	for _, trade := range trades {
+		v.Trades++
+		v.Volume += trade.Quantity
+		v.Notional += trade.Price * trade.Quantity
+	}
+}
+
+// Volume returns the trades matched since the engine started
+func (e *Exchange) Volume() MarketVolume {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.volume
+}
+
+// SymbolStats describes one symbol's book and roughly how much memory it holds
+type SymbolStats struct {
+	Symbol         string `json:"symbol"`
+	BuyOrders      int    `json:"buy_orders"`
+	SellOrders     int    `json:"sell_orders"`
+	QueuedOrders   int    `json:"queued_orders"`
+	Capacity       int    `json:"capacity"`        // Order slots allocated across both sides and the queue
+	EstimatedBytes int64  `json:"estimated_bytes"` // Allocated slots plus the strings the orders reference
+}
+
+// EngineStats reports the engine's resting orders and allocation behaviour
+type EngineStats struct {
+	Symbols []SymbolStats `json:"symbols"`
+	Pool    PoolStats     `json:"pool"`
+	Timing  MatchTiming   `json:"timing"`
+}
+
+// orderSize is the size of an order held by value in the book
+const orderSize = int64(unsafe.Sizeof(models.Order{}))
+
+// Stats reports the engine's resting order counts, memory estimates and
+// match buffer pool use and timing
+func (e *Exchange) Stats() EngineStats {
+	e.mu.Lock()
+	symbol := SymbolStats{
+		Symbol:       DefaultSymbol,
+		BuyOrders:    len(e.BuyOrders),
+		SellOrders:   len(e.SellOrders),
+		QueuedOrders: len(e.queue),
+		Capacity:     cap(e.BuyOrders) + cap(e.SellOrders) + cap(e.queue),
+	}
+	symbol.EstimatedBytes = int64(symbol.Capacity) * orderSize
+	for _, orders := range [][]models.Order{e.BuyOrders, e.SellOrders, e.queue} {
+		for _, order := range orders {
+			symbol.EstimatedBytes += int64(len(order.Symbol) + len(order.Type) + len(order.Status) + len(order.Tag) + len(order.TimeInForce))
+		}
+	}
+	e.mu.Unlock()
+
+	return EngineStats{
+		Symbols: []SymbolStats{symbol},
+		Pool: PoolStats{
+			Gets:      e.scratch.gets.Load(),
+			Allocs:    e.scratch.allocs.Load(),
+			Puts:      e.scratch.puts.Load(),
+			Discarded: e.scratch.discarded.Load(),
+		},
+		Timing: e.timer.timing(),
+	}
+}
@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/ratelimit"
+)
+
+// ErrThrottled is matched by a *ThrottledError
+var ErrThrottled = errors.New("throttled")
+
+// ThrottledError rejects a message sent faster than its account's or IP's
+// budget allows
+type ThrottledError struct {
+	Scope      string        // "account" or "ip", whichever budget is spent
+	RetryAfter time.Duration // How long until the budget allows another message
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("Too many orders from this %s; retry after %s", e.Scope, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+// Throttle budgets the messages the engine takes from each account and each
+// client IP, so one client sending orders as fast as it can doesn't starve
+// everyone else's of matching. A budget with a zero rate is unlimited.
+type Throttle struct {
+	accounts *ratelimit.Limiter
+	ips      *ratelimit.Limiter
+}
+
+// NewThrottle creates a throttle allowing each account accountRate messages
+// per second with bursts of accountBurst, and each IP likewise
+func NewThrottle(accountRate float64, accountBurst int, ipRate float64, ipBurst int) *Throttle {
+	return &Throttle{
+		accounts: ratelimit.New(accountRate, accountBurst),
+		ips:      ratelimit.New(ipRate, ipBurst),
+	}
+}
+
+// Admit charges a message to userID's and ip's budgets, returning a
+// *ThrottledError if either is spent. An empty ip is only charged to the
+// account. A message the account's budget rejects isn't charged to the IP.
+func (t *Throttle) Admit(userID int, ip string, now time.Time) error {
+	if ok, retryAfter := t.accounts.Allow(fmt.Sprintf("user:%d", userID), now); !ok {
+		return &ThrottledError{Scope: "account", RetryAfter: retryAfter}
+	}
+	if ip == "" {
+		return nil
+	}
+	if ok, retryAfter := t.ips.Allow("ip:"+ip, now); !ok {
+		return &ThrottledError{Scope: "ip", RetryAfter: retryAfter}
+	}
+	return nil
+}
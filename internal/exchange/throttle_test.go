@@ -0,0 +1,51 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestThrottle_Admit(t *testing.T) {
+	throttle := NewThrottle(2, 2, 10, 3)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if err := throttle.Admit(1, "10.0.0.1", now); err != nil {
+			t.Fatalf("message %d: expected the burst to be admitted, got %v", i, err)
+		}
+	}
+	err := throttle.Admit(1, "10.0.0.1", now)
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected the account to be throttled, got %v", err)
+	}
+	if throttled.Scope != "account" || throttled.RetryAfter != 500*time.Millisecond {
+		t.Errorf("unexpected throttle %+v", throttled)
+	}
+
+	// Another account behind the same IP spends the IP's last message
+	if err := throttle.Admit(2, "10.0.0.1", now); err != nil {
+		t.Fatalf("expected another account to be admitted, got %v", err)
+	}
+	if err := throttle.Admit(3, "10.0.0.1", now); !errors.As(err, &throttled) || throttled.Scope != "ip" {
+		t.Errorf("expected the IP to be throttled, got %v", err)
+	}
+	if err := throttle.Admit(3, "", now); err != nil {
+		t.Errorf("expected a message without an IP to be charged to the account only, got %v", err)
+	}
+
+	// Budgets refill
+	if err := throttle.Admit(1, "10.0.0.2", now.Add(500*time.Millisecond)); err != nil {
+		t.Errorf("expected a refilled budget to admit, got %v", err)
+	}
+}
+
+func TestThrottle_Disabled(t *testing.T) {
+	throttle := NewThrottle(0, 0, 0, 0)
+	for i := 0; i < 100; i++ {
+		if err := throttle.Admit(1, "10.0.0.1", time.Now()); err != nil {
+			t.Fatalf("expected a zero-rate throttle to admit everything, got %v", err)
+		}
+	}
+}
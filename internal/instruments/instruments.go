@@ -0,0 +1,119 @@
+// Package instruments lists the symbols the exchange trades and the orders
+// each accepts. It imports nothing of the exchange, so the engine, the
+// database and the API can all look instruments up.
+package instruments
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultSymbol is the trading pair orders are placed in when they don't
+// name one
+const DefaultSymbol = "BTC-USD"
+
+// Instrument describes a tradable symbol and the orders it accepts
+type Instrument struct {
+	Symbol            string
+	Base              string  // Asset being bought or sold, e.g. "BTC"
+	Quote             string  // Asset prices are quoted in, e.g. "USD"
+	PricePrecision    int     // Decimal places allowed in prices
+	QuantityPrecision int     // Decimal places allowed in quantities
+	MinQuantity       float64 // Smallest order quantity
+	MaxQuantity       float64 // Largest order quantity
+	MinPrice          float64
+	MaxPrice          float64
+}
+
+// All lists the symbols the exchange trades. Precisions and maxima
+// follow the orders table, which stores prices as DECIMAL(10,2) and
+// quantities as DECIMAL(10,8).
+var All = []Instrument{
+	{
+		Symbol:            DefaultSymbol,
+		Base:              "BTC",
+		Quote:             "USD",
+		PricePrecision:    2,
+		QuantityPrecision: 8,
+		MinQuantity:       0.00000001,
+		MaxQuantity:       99.99999999,
+		MinPrice:          0.01,
+		MaxPrice:          99999999.99,
+	},
+}
+
+// Lookup returns the instrument for a symbol
+func Lookup(symbol string) (Instrument, bool) {
+	for _, inst := range All {
+		if inst.Symbol == symbol {
+			return inst, true
+		}
+	}
+	return Instrument{}, false
+}
+
+// IsAsset reports whether an asset is the base or quote of a listed
+// instrument
+func IsAsset(asset string) bool {
+	for _, inst := range All {
+		if inst.Base == asset || inst.Quote == asset {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldError is an order value an instrument doesn't accept
+type FieldError struct {
+	Field     string // "price", "quantity" or "display_quantity"
+	Precision bool   // Set if the value has too many decimal places, rather than being out of range
+	Message   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// ValidateOrder checks a price and quantity against the instrument's limits
+// and precisions, returning a *FieldError if either breaks them
+func (inst Instrument) ValidateOrder(price, quantity float64) error {
+	if price < inst.MinPrice || price > inst.MaxPrice {
+		return &FieldError{Field: "price", Message: fmt.Sprintf("price must be between %g and %g", inst.MinPrice, inst.MaxPrice)}
+	}
+	if quantity < inst.MinQuantity || quantity > inst.MaxQuantity {
+		return &FieldError{Field: "quantity", Message: fmt.Sprintf("quantity must be between %g and %g", inst.MinQuantity, inst.MaxQuantity)}
+	}
+	if !hasPrecision(price, inst.PricePrecision) {
+		return &FieldError{Field: "price", Precision: true, Message: fmt.Sprintf("price allows at most %d decimal places", inst.PricePrecision)}
+	}
+	if !hasPrecision(quantity, inst.QuantityPrecision) {
+		return &FieldError{Field: "quantity", Precision: true, Message: fmt.Sprintf("quantity allows at most %d decimal places", inst.QuantityPrecision)}
+	}
+	return nil
+}
+
+// ValidateDisplayQuantity checks an iceberg order's displayed quantity, which
+// must be a valid quantity smaller than the whole order, returning a
+// *FieldError if it isn't
+func (inst Instrument) ValidateDisplayQuantity(display, quantity float64) error {
+	if display < inst.MinQuantity || display >= quantity {
+		return &FieldError{Field: "display_quantity", Message: fmt.Sprintf("display quantity must be at least %g and less than the quantity", inst.MinQuantity)}
+	}
+	if !hasPrecision(display, inst.QuantityPrecision) {
+		return &FieldError{Field: "display_quantity", Precision: true, Message: fmt.Sprintf("display quantity allows at most %d decimal places", inst.QuantityPrecision)}
+	}
+	return nil
+}
+
+// RoundPrice rounds a price to the instrument's price precision
+func (inst Instrument) RoundPrice(price float64) float64 {
+	scale := math.Pow10(inst.PricePrecision)
+	return math.Round(price*scale) / scale
+}
+
+// hasPrecision reports whether v has at most the given number of decimal
+// places, allowing for floating-point error
+func hasPrecision(v float64, decimals int) bool {
+	scaled := v * math.Pow10(decimals)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
+}
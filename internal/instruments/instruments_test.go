@@ -0,0 +1,77 @@
+package instruments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInstrument_ValidateOrder(t *testing.T) {
+	inst, ok := Lookup(DefaultSymbol)
+	if !ok {
+		t.Fatalf("expected %s to be listed", DefaultSymbol)
+	}
+
+	tests := []struct {
+		name            string
+		price           float64
+		quantity        float64
+		expectField     string // Empty if the order is valid
+		expectPrecision bool
+	}{
+		{"Valid", 50000.25, 0.12345678, "", false},
+		{"SmallestOrder", 0.01, 0.00000001, "", false},
+		{"TooManyPriceDecimals", 50000.255, 1, "price", true},
+		{"TooManyQuantityDecimals", 50000, 0.123456789, "quantity", true},
+		{"PriceTooHigh", 100000000, 1, "price", false},
+		{"QuantityTooLarge", 50000, 100, "quantity", false},
+		{"ZeroQuantity", 50000, 0, "quantity", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := inst.ValidateOrder(tt.price, tt.quantity)
+			if tt.expectField == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("expected a field error, got %v", err)
+			}
+			if fieldErr.Field != tt.expectField || fieldErr.Precision != tt.expectPrecision {
+				t.Errorf("expected field %s (precision %v), got %+v", tt.expectField, tt.expectPrecision, fieldErr)
+			}
+		})
+	}
+
+	if _, ok := Lookup("ETH-USD"); ok {
+		t.Errorf("expected ETH-USD to be unlisted")
+	}
+}
+
+func TestInstrument_ValidateDisplayQuantity(t *testing.T) {
+	inst, _ := Lookup(DefaultSymbol)
+	if err := inst.ValidateDisplayQuantity(0.1, 1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, display := range []float64{1, 2, 0.000000001, 0.123456789} {
+		if err := inst.ValidateDisplayQuantity(display, 1); err == nil {
+			t.Errorf("expected an error for display quantity %g", display)
+		}
+	}
+}
+
+func TestIsAsset(t *testing.T) {
+	for _, asset := range []string{"BTC", "USD"} {
+		if !IsAsset(asset) {
+			t.Errorf("expected %s to be an asset", asset)
+		}
+	}
+	for _, asset := range []string{"", "btc", "BTC-USD", "ETH"} {
+		if IsAsset(asset) {
+			t.Errorf("expected %q not to be an asset", asset)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Entry types
+const (
+	OrderAccepted  = "order_accepted"  // Order was handed to the engine
+	OrdersMatched  = "orders_matched"  // Trades, Filled and Canceled resulted from a match
+	OrdersCanceled = "orders_canceled" // Canceled were removed from the book
+	OrdersUpdated  = "orders_updated"  // Updated changed in place, e.g. amended or moved to another account
+	checkpoint     = "checkpoint"      // Everything before was recorded in the database
+)
+
+// Entry is one event in the journal
+type Entry struct {
+	Seq      int64     `json:"seq"`
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	OrderID  int       `json:"order_id,omitempty"`
+	Trades   []Trade   `json:"trades,omitempty"`
+	Filled   []int     `json:"filled,omitempty"`
+	Canceled []int     `json:"canceled,omitempty"`
+	Updated  []int     `json:"updated,omitempty"`
+}
+
+// OrderIDs returns every order the entry refers to
+func (e Entry) OrderIDs() []int {
+	var ids []int
+	if e.OrderID != 0 {
+		ids = append(ids, e.OrderID)
+	}
+	for _, trade := range e.Trades {
+		ids = append(ids, trade.BuyOrderID, trade.SellOrderID)
+	}
+	ids = append(ids, e.Filled...)
+	ids = append(ids, e.Canceled...)
+	return append(ids, e.Updated...)
+}
+
+// Trade is a journaled trade, with the fees that models.Trade keeps out of JSON
+type Trade struct {
+	BuyOrderID  int     `json:"buy_order_id"`
+	SellOrderID int     `json:"sell_order_id"`
+	Price       float64 `json:"price"`
+	Quantity    float64 `json:"quantity"`
+	TakerSide   string  `json:"taker_side"`
+	BuyFee      float64 `json:"buy_fee"`
+	SellFee     float64 `json:"sell_fee"`
+}
+
+// NewTrade converts an engine trade for the journal
+func NewTrade(trade models.Trade) Trade {
+	return Trade{
+		BuyOrderID:  trade.BuyOrderID,
+		SellOrderID: trade.SellOrderID,
+		Price:       trade.Price,
+		Quantity:    trade.Quantity,
+		TakerSide:   trade.TakerSide,
+		BuyFee:      trade.BuyFee,
+		SellFee:     trade.SellFee,
+	}
+}
+
+// Model converts a journaled trade back, referenced as the i-th trade of
+// the entry with sequence number seq
+func (t Trade) Model(seq int64, i int) models.Trade {
+	return models.Trade{
+		BuyOrderID:  t.BuyOrderID,
+		SellOrderID: t.SellOrderID,
+		Price:       t.Price,
+		Quantity:    t.Quantity,
+		TakerSide:   t.TakerSide,
+		BuyFee:      t.BuyFee,
+		SellFee:     t.SellFee,
+		JournalRef:  TradeRef(seq, i),
+	}
+}
+
+// TradeRef identifies the i-th trade of the entry with sequence number seq
+func TradeRef(seq int64, i int) string {
+	return fmt.Sprintf("%d:%d", seq, i)
+}
+
+// Journal records what the matching engine did in an append-only file, so
+// that after a crash the database can be brought up to date with matches
+// the server didn't finish recording. Each append is synced to disk before
+// it returns.
+type Journal struct {
+	mu    sync.Mutex
+	file  *os.File
+	seq   int64 // Sequence number of the last entry
+	since int64 // Sequence number of the last checkpoint
+	fresh bool  // No checkpoint was found, so earlier entries may be lost
+}
+
+// Open opens or creates a journal, returning the entries written since its
+// last checkpoint. A torn final line, left by a crash mid-write, is dropped.
+// A new journal numbers entries from the current time in microseconds, so
+// sequence numbers, and the trade references derived from them, don't
+// repeat if the file is deleted.
+func Open(path string) (*Journal, []Entry, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &Journal{file: file, seq: time.Now().UnixMicro(), fresh: true}
+	entries, end, err := j.read()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to truncate torn journal entry: %w", err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to seek journal: %w", err)
+	}
+	return j, entries, nil
+}
+
+// read parses the journal from the start, returning the entries after the
+// last checkpoint and the offset just past the last complete entry
+func (j *Journal) read() ([]Entry, int64, error) {
+	reader := bufio.NewReader(j.file)
+	var entries []Entry
+	var end int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is a torn write
+			return entries, end, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read journal: %w", err)
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return nil, 0, fmt.Errorf("corrupt journal entry at offset %d: %w", end, err)
+		}
+		end += int64(len(line))
+		j.seq = entry.Seq
+		if entry.Type == checkpoint {
+			j.since, j.fresh = entry.Seq, false
+			entries = nil
+			continue
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Append writes an entry, assigning its sequence number and time, and
+// returns it as written
+func (j *Journal) Append(entry Entry) (Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.Seq = j.seq + 1
+	entry.At = time.Now()
+	if err := j.write(entry); err != nil {
+		return entry, err
+	}
+	j.seq = entry.Seq
+	return entry, nil
+}
+
+// write appends an entry and syncs it; callers must hold j.mu
+func (j *Journal) write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Seq returns the sequence number of the last entry written
+func (j *Journal) Seq() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Covers reports whether the journal holds every entry written after seq,
+// i.e. no checkpoint since seq discarded any
+func (j *Journal) Covers(seq int64) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return !j.fresh && seq >= j.since
+}
+
+// Checkpoint discards the journal once everything in it has been recorded
+// in the database, keeping the sequence so trade references stay unique
+func (j *Journal) Checkpoint() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate journal: %w", err)
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek journal: %w", err)
+	}
+	if err := j.write(Entry{Seq: j.seq, Type: checkpoint, At: time.Now()}); err != nil {
+		return err
+	}
+	j.since, j.fresh = j.seq, false
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
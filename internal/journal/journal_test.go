@@ -0,0 +1,115 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestJournal_AppendAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, entries, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected a new journal to be empty, got %d entries", len(entries))
+	}
+
+	accepted, err := j.Append(Entry{Type: OrderAccepted, OrderID: 2})
+	if err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	trade := models.Trade{BuyOrderID: 2, SellOrderID: 1, Price: 100, Quantity: 0.5, TakerSide: "buy", BuyFee: 0.1, SellFee: 0.05}
+	matched, err := j.Append(Entry{Type: OrdersMatched, Trades: []Trade{NewTrade(trade)}, Filled: []int{2}})
+	if err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if matched.Seq != accepted.Seq+1 || matched.At.IsZero() {
+		t.Errorf("unexpected entry numbering: %d then %d", accepted.Seq, matched.Seq)
+	}
+	j.Close()
+
+	// A torn final write is dropped
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	file.WriteString(`{"seq":99,"type":"orders_can`)
+	file.Close()
+
+	j, entries, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Type != OrdersMatched {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	got := entries[1].Trades[0].Model(entries[1].Seq, 0)
+	if got.BuyFee != 0.1 || got.SellFee != 0.05 || got.JournalRef != TradeRef(matched.Seq, 0) {
+		t.Errorf("unexpected trade: %+v", got)
+	}
+
+	// Appends continue after the last complete entry
+	canceled, err := j.Append(Entry{Type: OrdersCanceled, Canceled: []int{1}})
+	if err != nil || canceled.Seq != matched.Seq+1 {
+		t.Fatalf("expected seq %d, got %d (%v)", matched.Seq+1, canceled.Seq, err)
+	}
+	j.Close()
+	_, entries, _ = Open(path)
+	if len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(entries))
+	}
+}
+
+func TestJournal_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, _, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	last, _ := j.Append(Entry{Type: OrderAccepted, OrderID: 1})
+	if err := j.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	j.Close()
+
+	// Entries before the checkpoint are gone but the sequence continues
+	j, entries, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries after checkpoint, got %+v", entries)
+	}
+	next, _ := j.Append(Entry{Type: OrderAccepted, OrderID: 2})
+	if next.Seq != last.Seq+1 {
+		t.Errorf("expected seq %d, got %d", last.Seq+1, next.Seq)
+	}
+
+	// Only what follows the checkpoint is still covered
+	if !j.Covers(last.Seq) || !j.Covers(next.Seq) || j.Covers(last.Seq-1) {
+		t.Errorf("expected the journal to cover entries from seq %d", last.Seq)
+	}
+	j.Close()
+
+	// A new journal covers nothing, since earlier entries may be lost
+	j, _, _ = Open(filepath.Join(t.TempDir(), "journal"))
+	if j.Covers(j.Seq()) {
+		t.Error("expected a new journal not to cover its starting sequence")
+	}
+	j.Close()
+}
+
+func TestEntry_OrderIDs(t *testing.T) {
+	entry := Entry{
+		Type:     OrdersMatched,
+		Trades:   []Trade{{BuyOrderID: 2, SellOrderID: 1}},
+		Filled:   []int{1},
+		Canceled: []int{3},
+		Updated:  []int{4},
+	}
+	ids := entry.OrderIDs()
+	if len(ids) != 5 || ids[0] != 2 || ids[1] != 1 || ids[4] != 4 {
+		t.Errorf("unexpected order IDs: %v", ids)
+	}
+}
@@ -0,0 +1,174 @@
+// Package lending accrues interest in the lending pools that fund margin.
+//
+// Users lend an asset to its pool, and others borrow it against what they
+// hold, through the ledger via the lending system account. Every hour each
+// borrower is charged the asset's annual rate, prorated, on what they owe,
+// which is added to their debt. The interest is shared among the asset's
+// lenders in proportion to what they've lent, and added to it, so lenders
+// earn the rate times the share of the pool that's borrowed. Each hour is
+// accrued once, so accruing again after a restart is safe, and hours
+// missed while the server was down are accrued when it comes back. Interest
+// is worked out with the pool locked against lending and borrowing.
+package lending
+
+import (
+	"context"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// year is the period rates are quoted over
+const year = 365 * 24 * time.Hour
+
+// Period is how often interest accrues
+const Period = time.Hour
+
+// Terms are what the lending pools charge and how much may be borrowed
+type Terms struct {
+	Rates map[string]float64 // Interest per year borrowers pay, as a fraction of what they owe, by asset; only these assets can be lent
+	LTV   float64            // Fraction of the value users hold that they may owe
+}
+
+// Assets returns the assets that can be lent and borrowed, in order
+func (t Terms) Assets() []string {
+	assets := make([]string, 0, len(t.Rates))
+	for asset := range t.Rates {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	return assets
+}
+
+// Interest returns the interest owed on a debt for one period at an annual
+// rate, rounded down to the ledger's 8 decimal places
+func Interest(owed, rate float64) float64 {
+	interest := owed * rate * float64(Period) / float64(year)
+	return math.Floor(interest*1e8) / 1e8
+}
+
+// SupplyRate returns what lenders earn a year on a pool at a borrow rate,
+// as a fraction of what's lent: the rate on the share that's borrowed
+func SupplyRate(pool models.LendingPool, rate float64) float64 {
+	if pool.Supplied <= 0 {
+		return 0
+	}
+	return rate * pool.Borrowed / pool.Supplied
+}
+
+// Share splits interest among lenders in proportion to what they've lent,
+// rounded down to 8 decimal places, with what rounding leaves over going to
+// the largest lender so the shares add up to the interest
+func Share(interest float64, positions []models.LendingPosition) map[int]float64 {
+	var supplied float64
+	largest := -1
+	for i, position := range positions {
+		supplied += position.Supplied
+		if position.Supplied > 0 && (largest < 0 || position.Supplied > positions[largest].Supplied) {
+			largest = i
+		}
+	}
+	shares := make(map[int]float64)
+	if interest <= 0 || largest < 0 {
+		return shares
+	}
+
+	var shared float64
+	for _, position := range positions {
+		if position.Supplied <= 0 {
+			continue
+		}
+		share := math.Floor(interest*position.Supplied/supplied*1e8) / 1e8
+		shares[position.UserID] += share
+		shared += share
+	}
+	lender := positions[largest].UserID
+	shares[lender] = math.Round((shares[lender]+interest-shared)*1e8) / 1e8
+	return shares
+}
+
+// Accruer charges borrowers interest hourly and shares it among lenders
+type Accruer struct {
+	DB    *db.DB
+	Terms Terms
+}
+
+// NewAccruer creates an accruer for the pools on terms
+func NewAccruer(database *db.DB, terms Terms) *Accruer {
+	return &Accruer{DB: database, Terms: terms}
+}
+
+// Accrue accrues interest for each hour that ended by now and hasn't been
+// accrued, in every asset, oldest first, starting with the latest hour the
+// first time. Returns how many hours were accrued.
+func (a *Accruer) Accrue(ctx context.Context, now time.Time) (int, error) {
+	end := now.Truncate(Period)
+	accrued := 0
+	for _, asset := range a.Terms.Assets() {
+		last, err := a.DB.GetLastLendingAccrual(ctx, asset)
+		if err != nil {
+			return accrued, err
+		}
+		if last.IsZero() {
+			last = end.Add(-2 * Period)
+		}
+		for hour := last.Add(Period); !hour.After(end.Add(-Period)); hour = hour.Add(Period) {
+			ok, err := a.accrueHour(ctx, asset, hour)
+			if err != nil {
+				return accrued, err
+			}
+			if ok {
+				accrued++
+			}
+		}
+	}
+	return accrued, nil
+}
+
+// accrueHour charges interest on what's owed in asset for the hour starting
+// at hour. Every accrued hour is recorded, with or without interest.
+func (a *Accruer) accrueHour(ctx context.Context, asset string, hour time.Time) (bool, error) {
+	rate := a.Terms.Rates[asset]
+	return a.DB.AccrueLendingInterest(ctx, asset, hour, rate, func(positions []models.LendingPosition) (map[int]float64, map[int]float64) {
+		return Charges(positions, rate)
+	})
+}
+
+// Charges returns the hour's interest each borrower in an asset's pool is
+// charged at rate, and each lender's share of it
+func Charges(positions []models.LendingPosition, rate float64) (charges, earnings map[int]float64) {
+	charges = make(map[int]float64)
+	var interest float64
+	for _, position := range positions {
+		if charge := Interest(position.Borrowed, rate); charge > 0 {
+			charges[position.UserID] = charge
+			interest += charge
+		}
+	}
+	lenders := slices.DeleteFunc(slices.Clone(positions), func(p models.LendingPosition) bool { return p.Supplied <= 0 })
+	return charges, Share(interest, lenders)
+}
+
+// Run accrues interest every interval until ctx is done. Failures are
+// retried on the next tick.
+func (a *Accruer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if accrued, err := a.Accrue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to accrue lending interest: %v", err)
+		} else if accrued > 0 {
+			log.Printf("Accrued %d hours of lending interest", accrued)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
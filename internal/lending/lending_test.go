@@ -0,0 +1,64 @@
+package lending
+
+import (
+	"math"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestInterest(t *testing.T) {
+	// 8,760 owed at 10% a year is 876 a year, 0.1 an hour
+	if got := Interest(8760, 0.1); math.Abs(got-0.1) > 1e-9 {
+		t.Errorf("expected 0.1, got %v", got)
+	}
+	if got := Interest(1, 0.05); got != 0.0000057 {
+		t.Errorf("expected interest rounded down to 8 places, got %v", got)
+	}
+	if got := Interest(0, 0.1); got != 0 {
+		t.Errorf("expected no interest on nothing owed, got %v", got)
+	}
+}
+
+func TestSupplyRate(t *testing.T) {
+	if got := SupplyRate(models.LendingPool{Supplied: 1000, Borrowed: 250}, 0.08); got != 0.02 {
+		t.Errorf("expected a quarter of the rate, got %v", got)
+	}
+	if got := SupplyRate(models.LendingPool{}, 0.08); got != 0 {
+		t.Errorf("expected nothing earned on an empty pool, got %v", got)
+	}
+}
+
+func TestShare(t *testing.T) {
+	positions := []models.LendingPosition{
+		{UserID: 1, Supplied: 100},
+		{UserID: 2, Supplied: 200},
+		{UserID: 3, Borrowed: 50},
+		{UserID: 4, Supplied: 0.5},
+	}
+	shares := Share(0.00000301, positions)
+	if _, ok := shares[3]; ok {
+		t.Errorf("expected nothing for a borrower who hasn't lent, got %v", shares)
+	}
+	var total float64
+	for _, share := range shares {
+		total += share
+	}
+	if math.Abs(total-0.00000301) > 1e-12 {
+		t.Errorf("expected the shares to add up to the interest, got %v", shares)
+	}
+	if shares[1] != 0.000001 || shares[2] < 0.000002 || shares[4] != 0 {
+		t.Errorf("expected shares in proportion to what's lent, the remainder to the largest lender, got %v", shares)
+	}
+
+	if shares := Share(1, []models.LendingPosition{{UserID: 3, Borrowed: 50}}); len(shares) != 0 {
+		t.Errorf("expected no shares without lenders, got %v", shares)
+	}
+}
+
+func TestTerms_Assets(t *testing.T) {
+	terms := Terms{Rates: map[string]float64{"USD": 0.08, "BTC": 0.03}}
+	if assets := terms.Assets(); len(assets) != 2 || assets[0] != "BTC" || assets[1] != "USD" {
+		t.Errorf("expected BTC and USD, got %v", assets)
+	}
+}
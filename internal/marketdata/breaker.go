@@ -0,0 +1,112 @@
+package marketdata
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// BreakerTrip describes a price move that tripped the circuit breaker
+type BreakerTrip struct {
+	Price     float64   `json:"price"`     // Price of the trade that tripped it
+	Reference float64   `json:"reference"` // Price within the window it moved furthest from
+	Move      float64   `json:"move"`      // Fraction it moved by
+	At        time.Time `json:"at"`
+}
+
+// CircuitBreaker watches the trade stream for the price moving further
+// than its settings allow within their window. The lowest and highest
+// prices in the window are kept in monotonic queues, so each trade is
+// checked in constant time however many trades the window holds.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	settings config.CircuitBreaker
+	lows     []priceEntry // Increasing prices; the first is the window's lowest
+	highs    []priceEntry // Decreasing prices; the first is the window's highest
+	lastTrip *BreakerTrip
+}
+
+// NewCircuitBreaker creates a breaker with the given settings, which must
+// be valid
+func NewCircuitBreaker(settings config.CircuitBreaker) *CircuitBreaker {
+	return &CircuitBreaker{settings: settings}
+}
+
+// Settings returns the breaker's settings
+func (b *CircuitBreaker) Settings() config.CircuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.settings
+}
+
+// Set validates and applies new settings. Prices traded before the change
+// no longer count towards a move.
+func (b *CircuitBreaker) Set(settings config.CircuitBreaker) error {
+	if err := config.ValidateCircuitBreaker(settings); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.settings = settings
+	b.lows, b.highs = nil, nil
+	return nil
+}
+
+// LastTrip returns the latest trip, or nil if the breaker hasn't tripped
+func (b *CircuitBreaker) LastTrip() *BreakerTrip {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lastTrip == nil {
+		return nil
+	}
+	trip := *b.lastTrip
+	return &trip
+}
+
+// Observe checks a trade's price against those traded within the window
+// before it, returning the trip if it moved too far. Tripping forgets the
+// window, so trading after the market reopens is measured afresh. Trades
+// must be observed in execution order.
+func (b *CircuitBreaker) Observe(trade models.Trade) (BreakerTrip, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.settings.Move <= 0 {
+		return BreakerTrip{}, false
+	}
+
+	cutoff := trade.ExecutedAt.Add(-b.settings.Window)
+	for len(b.lows) > 0 && !b.lows[0].at.After(cutoff) {
+		b.lows = b.lows[1:]
+	}
+	for len(b.highs) > 0 && !b.highs[0].at.After(cutoff) {
+		b.highs = b.highs[1:]
+	}
+
+	trip := BreakerTrip{Price: trade.Price, At: trade.ExecutedAt}
+	if len(b.lows) > 0 {
+		for _, reference := range []float64{b.lows[0].price, b.highs[0].price} {
+			if move := math.Abs(trade.Price-reference) / reference; move > trip.Move {
+				trip.Move, trip.Reference = move, reference
+			}
+		}
+	}
+	if trip.Move > b.settings.Move {
+		b.lows, b.highs = nil, nil
+		b.lastTrip = &trip
+		return trip, true
+	}
+
+	entry := priceEntry{price: trade.Price, at: trade.ExecutedAt}
+	for len(b.lows) > 0 && b.lows[len(b.lows)-1].price >= entry.price {
+		b.lows = b.lows[:len(b.lows)-1]
+	}
+	b.lows = append(b.lows, entry)
+	for len(b.highs) > 0 && b.highs[len(b.highs)-1].price <= entry.price {
+		b.highs = b.highs[:len(b.highs)-1]
+	}
+	b.highs = append(b.highs, entry)
+	return BreakerTrip{}, false
+}
@@ -0,0 +1,55 @@
+package marketdata
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(config.CircuitBreaker{Move: 0.1, Window: time.Minute, Action: "auction"})
+	at := func(seconds int, price float64) models.Trade {
+		return models.Trade{Price: price, Quantity: 1, ExecutedAt: start.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	// Moves within 10% of every price in the window don't trip it, even as
+	// they add up to more
+	for _, trade := range []models.Trade{at(0, 100), at(10, 105), at(20, 109), at(70, 115), at(80, 120)} {
+		if trip, ok := breaker.Observe(trade); ok {
+			t.Fatalf("unexpected trip at %v: %+v", trade.ExecutedAt, trip)
+		}
+	}
+
+	// 107 is more than 10% below the window's high of 120
+	trip, ok := breaker.Observe(at(90, 107))
+	if !ok {
+		t.Fatal("expected the breaker to trip")
+	}
+	if trip.Price != 107 || trip.Reference != 120 || math.Abs(trip.Move-13.0/120) > 1e-9 {
+		t.Errorf("unexpected trip %+v", trip)
+	}
+	if last := breaker.LastTrip(); last == nil || *last != trip {
+		t.Errorf("expected last trip %+v, got %+v", trip, last)
+	}
+
+	// Tripping forgets the window, so reopening at the new price doesn't
+	// trip it again
+	if _, ok := breaker.Observe(at(100, 100)); ok {
+		t.Error("expected the window to be forgotten after tripping")
+	}
+
+	// A disabled breaker never trips
+	if err := breaker.Set(config.CircuitBreaker{Window: time.Minute, Action: "halted"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := breaker.Observe(at(110, 200)); ok {
+		t.Error("expected a disabled breaker not to trip")
+	}
+	if err := breaker.Set(config.CircuitBreaker{Move: 0.1, Action: "halted"}); err == nil {
+		t.Error("expected an error for settings without a window")
+	}
+}
@@ -0,0 +1,62 @@
+package marketdata
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Intervals maps the supported candle interval names to their widths
+var Intervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// intervalOrder lists the interval names from finest to coarsest
+var intervalOrder = []string{"1m", "5m", "1h", "1d"}
+
+// BucketStart returns the open time of the candle containing t
+func BucketStart(t time.Time, width time.Duration) time.Time {
+	return t.UTC().Truncate(width)
+}
+
+// CandleService aggregates executed trades into OHLCV candles
+type CandleService struct {
+	DB     *db.DB
+	Events *events.Bus
+}
+
+// NewCandleService creates a candle service and subscribes it to trade events
+func NewCandleService(db *db.DB, bus *events.Bus) *CandleService {
+	s := &CandleService{DB: db, Events: bus}
+	bus.Subscribe(events.TradeExecuted, func(e events.Event) {
+		trade, ok := e.Data.(models.Trade)
+		if !ok {
+			return
+		}
+		if err := s.RecordTrade(context.Background(), trade); err != nil {
+			log.Printf("Failed to record trade %d in candles: %v", trade.ID, err)
+		}
+	})
+	return s
+}
+
+// RecordTrade folds a trade into the candle of every interval and
+// publishes the updated candles
+func (s *CandleService) RecordTrade(ctx context.Context, trade models.Trade) error {
+	for _, name := range intervalOrder {
+		openTime := BucketStart(trade.ExecutedAt, Intervals[name])
+		candle, err := s.DB.UpsertCandle(ctx, name, openTime, trade.Price, trade.Quantity)
+		if err != nil {
+			return err
+		}
+		s.Events.Publish(events.Event{Type: events.CandleUpdated, Data: *candle})
+	}
+	return nil
+}
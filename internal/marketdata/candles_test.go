@@ -0,0 +1,29 @@
+package marketdata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	ts := time.Date(2024, 3, 15, 13, 47, 29, 500, time.UTC)
+
+	tests := []struct {
+		interval string
+		expected time.Time
+	}{
+		{"1m", time.Date(2024, 3, 15, 13, 47, 0, 0, time.UTC)},
+		{"5m", time.Date(2024, 3, 15, 13, 45, 0, 0, time.UTC)},
+		{"1h", time.Date(2024, 3, 15, 13, 0, 0, 0, time.UTC)},
+		{"1d", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			got := BucketStart(ts, Intervals[tt.interval])
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
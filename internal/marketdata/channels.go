@@ -0,0 +1,134 @@
+package marketdata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+)
+
+// Channels holds the live broadcast settings of each WebSocket channel.
+// Admins can change them while the server runs.
+type Channels struct {
+	mu       sync.RWMutex
+	settings map[string]config.ChannelSettings
+	changed  chan struct{}
+}
+
+// NewChannels creates channel settings starting from the given values
+func NewChannels(settings map[string]config.ChannelSettings) *Channels {
+	c := &Channels{settings: make(map[string]config.ChannelSettings), changed: make(chan struct{}, 1)}
+	for channel, s := range settings {
+		c.settings[channel] = s
+	}
+	return c
+}
+
+// Get returns a channel's settings
+func (c *Channels) Get(channel string) config.ChannelSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settings[channel]
+}
+
+// All returns a copy of every channel's settings
+func (c *Channels) All() map[string]config.ChannelSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	all := make(map[string]config.ChannelSettings, len(c.settings))
+	for channel, s := range c.settings {
+		all[channel] = s
+	}
+	return all
+}
+
+// Set validates and applies a channel's settings
+func (c *Channels) Set(channel string, settings config.ChannelSettings) error {
+	if err := config.ValidateChannel(channel, settings); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.settings[channel] = settings
+	c.mu.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Changed is signalled after settings change, so a broadcast loop can pick
+// up a new interval without waiting out the old one. It has one slot, so
+// only one loop should wait on it.
+func (c *Channels) Changed() <-chan struct{} {
+	return c.changed
+}
+
+// pendingUpdate is the latest update for a key, waiting out a conflation window
+type pendingUpdate struct {
+	channel string
+	payload interface{}
+}
+
+// Conflator merges updates published within a channel's conflation window,
+// sending only the latest update for each key when the window closes.
+// Without a window, updates are sent as they are published.
+type Conflator struct {
+	mu       sync.Mutex
+	channels *Channels
+	setting  string // Channel whose settings apply, e.g. config.CandlesChannel
+	send     func(channel string, payload interface{})
+	pending  map[string]pendingUpdate
+	order    []string // Pending keys in first-published order
+	timer    *time.Timer
+}
+
+// NewConflator creates a conflator using the settings of one channel
+func NewConflator(channels *Channels, setting string, send func(channel string, payload interface{})) *Conflator {
+	return &Conflator{channels: channels, setting: setting, send: send, pending: make(map[string]pendingUpdate)}
+}
+
+// Publish sends an update on a channel, or holds it until the conflation
+// window closes. An update replaces any pending update with the same key,
+// so keys should identify what is updated, e.g. a candle's open time.
+func (c *Conflator) Publish(channel, key string, payload interface{}) {
+	window := c.channels.Get(c.setting).Conflation
+
+	c.mu.Lock()
+	if window <= 0 && c.timer == nil {
+		c.mu.Unlock()
+		c.send(channel, payload)
+		return
+	}
+
+	key = channel + "|" + key
+	if _, ok := c.pending[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.pending[key] = pendingUpdate{channel: channel, payload: payload}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(window, c.Flush)
+	}
+	c.mu.Unlock()
+}
+
+// Flush sends every pending update now
+func (c *Conflator) Flush() {
+	c.mu.Lock()
+	updates := make([]pendingUpdate, 0, len(c.order))
+	for _, key := range c.order {
+		updates = append(updates, c.pending[key])
+	}
+	c.pending = make(map[string]pendingUpdate)
+	c.order = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+
+	for _, update := range updates {
+		c.send(update.channel, update.payload)
+	}
+}
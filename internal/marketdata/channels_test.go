@@ -0,0 +1,76 @@
+package marketdata
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+)
+
+func TestChannels_Set(t *testing.T) {
+	channels := NewChannels(config.Default().Channels)
+
+	if err := channels.Set(config.OrderBookChannel, config.ChannelSettings{SnapshotInterval: time.Second, MaxDepth: 20}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := channels.Get(config.OrderBookChannel); got.MaxDepth != 20 || got.SnapshotInterval != time.Second {
+		t.Errorf("unexpected settings: %+v", got)
+	}
+	select {
+	case <-channels.Changed():
+	default:
+		t.Error("expected a change notification")
+	}
+
+	if err := channels.Set(config.CandlesChannel, config.ChannelSettings{MaxDepth: 5}); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if got := channels.All()[config.CandlesChannel]; got != (config.ChannelSettings{}) {
+		t.Errorf("invalid settings applied: %+v", got)
+	}
+}
+
+func TestConflator_Publish(t *testing.T) {
+	channels := NewChannels(config.Default().Channels)
+
+	var mu sync.Mutex
+	var sent []string
+	conflator := NewConflator(channels, config.CandlesChannel, func(channel string, payload interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, channel+"="+payload.(string))
+	})
+
+	// Without a window every update is sent
+	conflator.Publish("candles:1m", "0", "a")
+	conflator.Publish("candles:1m", "0", "b")
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 updates sent, got %v", sent)
+	}
+
+	// With one, only the latest update per key is sent when it closes
+	sent = nil
+	channels.Set(config.CandlesChannel, config.ChannelSettings{Conflation: time.Hour})
+	conflator.Publish("candles:1m", "0", "a")
+	conflator.Publish("candles:5m", "0", "x")
+	conflator.Publish("candles:1m", "0", "b")
+	conflator.Publish("candles:1m", "60", "c")
+	mu.Lock()
+	if len(sent) != 0 {
+		t.Errorf("expected updates held, got %v", sent)
+	}
+	mu.Unlock()
+
+	conflator.Flush()
+	expected := []string{"candles:1m=b", "candles:5m=x", "candles:1m=c"}
+	if len(sent) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, sent)
+	}
+	for i := range expected {
+		if sent[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, sent)
+			break
+		}
+	}
+}
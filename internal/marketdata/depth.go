@@ -0,0 +1,158 @@
+package marketdata
+
+import (
+	"hash/crc32"
+	"strconv"
+	"sync"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+)
+
+// DepthLevels is how many price levels of each side the depth channel
+// publishes
+const DepthLevels = 25
+
+// ChecksumLevels is how many of the best levels of each side the depth
+// checksum covers
+const ChecksumLevels = 10
+
+// DepthUpdate is a message of the depth channel: a snapshot of the best
+// price levels of each side, or the levels that changed since the previous
+// message. In updates a level with zero quantity has left the book, or
+// dropped below the published levels.
+type DepthUpdate struct {
+	Symbol   string           `json:"symbol"`
+	Type     string           `json:"type"`     // "snapshot" or "update"
+	Sequence uint64           `json:"sequence"` // Increases by one with each update
+	Seq      uint64           `json:"seq"`      // Engine sequence number of the last change the levels reflect
+	Bids     []exchange.Level `json:"bids"`
+	Asks     []exchange.Level `json:"asks"`
+	Checksum uint32           `json:"checksum"` // Checksum of the levels once the message is applied
+}
+
+// Checksum returns the CRC-32 (IEEE) of the best ChecksumLevels levels of
+// each side. The checksummed string takes the levels in turn, best bid,
+// best ask, second bid, second ask and so on, continuing with the longer
+// side once the other runs out, and joins each level's price and quantity,
+// formatted with the instrument's decimal places, with ":", e.g.
+// "49999.50:0.50000000:50000.00:1.25000000".
+func Checksum(inst instruments.Instrument, bids, asks []exchange.Level) uint32 {
+	var b []byte
+	appendLevel := func(level exchange.Level) {
+		if len(b) > 0 {
+			b = append(b, ':')
+		}
+		b = strconv.AppendFloat(b, level.Price, 'f', inst.PricePrecision, 64)
+		b = append(b, ':')
+		b = strconv.AppendFloat(b, level.Quantity, 'f', inst.QuantityPrecision, 64)
+	}
+	for i := 0; i < ChecksumLevels; i++ {
+		if i < len(bids) {
+			appendLevel(bids[i])
+		}
+		if i < len(asks) {
+			appendLevel(asks[i])
+		}
+	}
+	return crc32.ChecksumIEEE(b)
+}
+
+// DiffLevels returns the levels of next whose quantity differs from prev,
+// and a zero-quantity level for each price of prev that isn't in next. Both
+// sides are sorted best first by the same order.
+func DiffLevels(prev, next []exchange.Level) []exchange.Level {
+	quantities := make(map[float64]float64, len(prev))
+	for _, level := range prev {
+		quantities[level.Price] = level.Quantity
+	}
+	changed := []exchange.Level{}
+	for _, level := range next {
+		if quantity, ok := quantities[level.Price]; !ok || quantity != level.Quantity {
+			changed = append(changed, level)
+		}
+		delete(quantities, level.Price)
+	}
+	for _, level := range prev {
+		if _, ok := quantities[level.Price]; ok {
+			changed = append(changed, exchange.Level{Price: level.Price})
+		}
+	}
+	return changed
+}
+
+// DepthFeed tracks the depth last published for an instrument, turning each
+// new state of the book into an update
+type DepthFeed struct {
+	inst instruments.Instrument
+
+	mu       sync.Mutex
+	sequence uint64
+	seq      uint64 // Engine sequence number of the levels recorded
+	bids     []exchange.Level
+	asks     []exchange.Level
+}
+
+// NewDepthFeed returns a feed of an instrument's depth, starting from an
+// empty book
+func NewDepthFeed(inst instruments.Instrument) *DepthFeed {
+	return &DepthFeed{inst: inst, bids: []exchange.Level{}, asks: []exchange.Level{}}
+}
+
+// Update records the book's best levels as of engine sequence number seq,
+// at most DepthLevels per side, and returns the update from the previous
+// ones. It returns false if none changed, or if the levels recorded are of a
+// later book, so a book read before another but recorded after it is
+// dropped. Calls are serialized with each other and with Snapshot, and
+// publish, if given, is called with the update before they are released, so
+// updates are published in sequence.
+func (f *DepthFeed) Update(seq uint64, bids, asks []exchange.Level, publish func(DepthUpdate)) (DepthUpdate, bool) {
+	bids, asks = bids[:min(len(bids), DepthLevels)], asks[:min(len(asks), DepthLevels)]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seq < f.seq {
+		return DepthUpdate{}, false
+	}
+	f.seq = seq
+	update := DepthUpdate{
+		Symbol: f.inst.Symbol,
+		Type:   "update",
+		Seq:    seq,
+		Bids:   DiffLevels(f.bids, bids),
+		Asks:   DiffLevels(f.asks, asks),
+	}
+	if len(update.Bids) == 0 && len(update.Asks) == 0 {
+		return DepthUpdate{}, false
+	}
+	f.sequence++
+	f.bids = append([]exchange.Level{}, bids...)
+	f.asks = append([]exchange.Level{}, asks...)
+	update.Sequence = f.sequence
+	update.Checksum = Checksum(f.inst, f.bids, f.asks)
+	if publish != nil {
+		publish(update)
+	}
+	return update, true
+}
+
+// Snapshot returns the levels last recorded, as of the latest update's
+// sequence. Like Update, it calls publish, if given, before another update
+// can be made.
+func (f *DepthFeed) Snapshot(publish func(DepthUpdate)) DepthUpdate {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	snapshot := DepthUpdate{
+		Symbol:   f.inst.Symbol,
+		Type:     "snapshot",
+		Sequence: f.sequence,
+		Seq:      f.seq,
+		Bids:     append([]exchange.Level{}, f.bids...),
+		Asks:     append([]exchange.Level{}, f.asks...),
+		Checksum: Checksum(f.inst, f.bids, f.asks),
+	}
+	if publish != nil {
+		publish(snapshot)
+	}
+	return snapshot
+}
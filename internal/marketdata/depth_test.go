@@ -0,0 +1,114 @@
+package marketdata
+
+import (
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+)
+
+var testInstrument = instruments.All[0]
+
+func TestChecksum(t *testing.T) {
+	bids := []exchange.Level{{Price: 99.5, Quantity: 0.5}, {Price: 99, Quantity: 2}}
+	asks := []exchange.Level{{Price: 100, Quantity: 1.25}}
+	want := crc32.ChecksumIEEE([]byte("99.50:0.50000000:100.00:1.25000000:99.00:2.00000000"))
+	if got := Checksum(testInstrument, bids, asks); got != want {
+		t.Errorf("expected %d, got %d", want, got)
+	}
+
+	// Only the best ChecksumLevels levels count
+	var deep []exchange.Level
+	for i := 0; i < ChecksumLevels+5; i++ {
+		deep = append(deep, exchange.Level{Price: float64(100 - i), Quantity: 1})
+	}
+	deeper := append(append([]exchange.Level{}, deep...), exchange.Level{Price: 1, Quantity: 1})
+	if Checksum(testInstrument, deep, nil) != Checksum(testInstrument, deeper, nil) {
+		t.Error("expected levels past ChecksumLevels not to change the checksum")
+	}
+}
+
+func TestDiffLevels(t *testing.T) {
+	prev := []exchange.Level{{Price: 101, Quantity: 1}, {Price: 100, Quantity: 2}, {Price: 99, Quantity: 3}}
+	next := []exchange.Level{{Price: 102, Quantity: 4}, {Price: 101, Quantity: 1}, {Price: 100, Quantity: 1.5}}
+	want := []exchange.Level{{Price: 102, Quantity: 4}, {Price: 100, Quantity: 1.5}, {Price: 99}}
+	if got := DiffLevels(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := DiffLevels(next, next); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
+
+// applyLevels applies changed levels to a client's side of the book, as a
+// client maintaining the book would
+func applyLevels(side []exchange.Level, changes []exchange.Level, bids bool) []exchange.Level {
+	quantities := make(map[float64]float64)
+	for _, level := range side {
+		quantities[level.Price] = level.Quantity
+	}
+	for _, level := range changes {
+		if level.Quantity == 0 {
+			delete(quantities, level.Price)
+		} else {
+			quantities[level.Price] = level.Quantity
+		}
+	}
+	side = side[:0]
+	for price, quantity := range quantities {
+		side = append(side, exchange.Level{Price: price, Quantity: quantity})
+	}
+	sort.Slice(side, func(i, j int) bool {
+		if bids {
+			return side[i].Price > side[j].Price
+		}
+		return side[i].Price < side[j].Price
+	})
+	return side
+}
+
+func TestDepthFeed(t *testing.T) {
+	feed := NewDepthFeed(testInstrument)
+	var bids, asks []exchange.Level
+	var sequence uint64
+
+	books := [][2][]exchange.Level{
+		{{{Price: 99, Quantity: 1}}, {{Price: 101, Quantity: 2}}},
+		{{{Price: 100, Quantity: 0.5}, {Price: 99, Quantity: 1}}, {{Price: 101, Quantity: 1.5}}},
+		{{{Price: 99, Quantity: 1}}, {}},
+	}
+	for i, book := range books {
+		var published DepthUpdate
+		update, ok := feed.Update(uint64(10*i+10), book[0], book[1], func(u DepthUpdate) { published = u })
+		if !ok || !reflect.DeepEqual(update, published) {
+			t.Fatalf("book %d: expected an update to be published", i)
+		}
+		if update.Sequence != sequence+1 {
+			t.Errorf("book %d: expected sequence %d, got %d", i, sequence+1, update.Sequence)
+		}
+		sequence = update.Sequence
+		if update.Seq != uint64(10*i+10) {
+			t.Errorf("book %d: expected engine sequence %d, got %d", i, 10*i+10, update.Seq)
+		}
+
+		// A client applying the updates ends up with the same book
+		bids, asks = applyLevels(bids, update.Bids, true), applyLevels(asks, update.Asks, false)
+		if Checksum(testInstrument, bids, asks) != update.Checksum {
+			t.Errorf("book %d: checksum mismatch after applying %+v", i, update)
+		}
+	}
+
+	if _, ok := feed.Update(35, books[2][0], books[2][1], nil); ok {
+		t.Error("expected an unchanged book not to produce an update")
+	}
+	if _, ok := feed.Update(20, books[1][0], books[1][1], nil); ok {
+		t.Error("expected a book older than the one recorded to be dropped")
+	}
+	snapshot := feed.Snapshot(nil)
+	if snapshot.Type != "snapshot" || snapshot.Sequence != sequence || snapshot.Seq != 35 || !reflect.DeepEqual(snapshot.Bids, bids) || len(snapshot.Asks) != 0 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+}
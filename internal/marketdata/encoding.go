@@ -0,0 +1,374 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Encoder marshals market data for publishing. Every encoder produces the
+// same JSON as encoding/json.
+type Encoder interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// NewEncoder returns the encoder with the given name: "fast" or "std"
+func NewEncoder(name string) (Encoder, error) {
+	switch name {
+	case "fast":
+		return FastEncoder{}, nil
+	case "std":
+		return StdEncoder{}, nil
+	}
+	return nil, fmt.Errorf("unknown encoder %q", name)
+}
+
+// StdEncoder marshals with encoding/json
+type StdEncoder struct{}
+
+// Marshal implements Encoder
+func (StdEncoder) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// FastEncoder marshals the hot market data types (OrderBook, models.Candle,
+// models.Trade and models.PublicTrade) with hand-written encoders into pooled buffers, avoiding
+// reflection and intermediate allocations. Other values fall back to
+// encoding/json.
+type FastEncoder struct{}
+
+// maxPooledBuffer bounds the encode buffers kept for reuse
+const maxPooledBuffer = 1 << 20
+
+var bufferPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, 4096)
+	return &b
+}}
+
+// Marshal implements Encoder
+func (FastEncoder) Marshal(v interface{}) ([]byte, error) {
+	e := encodeState{}
+	buf := bufferPool.Get().(*[]byte)
+	e.b = (*buf)[:0]
+
+	switch v := v.(type) {
+	case OrderBook:
+		e.orderBook(v)
+	case *OrderBook:
+		e.orderBook(*v)
+	case models.Candle:
+		e.candle(v)
+	case models.Trade:
+		e.trade(v)
+	case models.PublicTrade:
+		e.publicTrade(v)
+	default:
+		bufferPool.Put(buf)
+		return json.Marshal(v)
+	}
+
+	data := append([]byte(nil), e.b...)
+	if cap(e.b) <= maxPooledBuffer {
+		*buf = e.b
+		bufferPool.Put(buf)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return data, nil
+}
+
+// ChannelMessage wraps data already encoded as JSON in a WebSocket channel
+// message, {"channel": ..., "data": ...}
+func ChannelMessage(channel string, data []byte) []byte {
+	b := make([]byte, 0, len(channel)+len(data)+24)
+	b = append(b, `{"channel":`...)
+	b = appendString(b, channel)
+	b = append(b, `,"data":`...)
+	b = append(b, data...)
+	return append(b, '}')
+}
+
+// OrderBook is the order book as published to clients, each side sorted
+// best price first and then by time
+type OrderBook struct {
+	BuyOrders  []models.Order `json:"buy_orders"`
+	SellOrders []models.Order `json:"sell_orders"`
+	Seq        uint64         `json:"seq"` // Engine sequence number of the last change the book reflects
+}
+
+// NewOrderBook splits open orders into sorted sides, limited to maxDepth
+// orders per side unless it is zero. Iceberg orders show only their
+// displayed quantity, and client order IDs are left out as they're private
+// to the user who placed the order.
+func NewOrderBook(orders []models.Order, maxDepth int) OrderBook {
+	var book OrderBook
+	for _, order := range orders {
+		order.ClientOrderID = ""
+		if order.DisplayQuantity > 0 {
+			order.Quantity = exchange.VisibleQuantity(order)
+			order.DisplayQuantity = 0
+		}
+		if order.Type == "buy" {
+			book.BuyOrders = append(book.BuyOrders, order)
+		} else {
+			book.SellOrders = append(book.SellOrders, order)
+		}
+	}
+
+	sort.Slice(book.BuyOrders, func(i, j int) bool {
+		if book.BuyOrders[i].Price == book.BuyOrders[j].Price {
+			return book.BuyOrders[i].CreatedAt.Before(book.BuyOrders[j].CreatedAt)
+		}
+		return book.BuyOrders[i].Price > book.BuyOrders[j].Price
+	})
+	sort.Slice(book.SellOrders, func(i, j int) bool {
+		if book.SellOrders[i].Price == book.SellOrders[j].Price {
+			return book.SellOrders[i].CreatedAt.Before(book.SellOrders[j].CreatedAt)
+		}
+		return book.SellOrders[i].Price < book.SellOrders[j].Price
+	})
+
+	if maxDepth > 0 {
+		book.BuyOrders = book.BuyOrders[:min(len(book.BuyOrders), maxDepth)]
+		book.SellOrders = book.SellOrders[:min(len(book.SellOrders), maxDepth)]
+	}
+	return book
+}
+
+// encodeState appends JSON to b, keeping the first error
+type encodeState struct {
+	b   []byte
+	err error
+}
+
+func (e *encodeState) orderBook(book OrderBook) {
+	e.b = append(e.b, `{"buy_orders":`...)
+	e.orders(book.BuyOrders)
+	e.b = append(e.b, `,"sell_orders":`...)
+	e.orders(book.SellOrders)
+	e.b = append(e.b, `,"seq":`...)
+	e.b = strconv.AppendUint(e.b, book.Seq, 10)
+	e.b = append(e.b, '}')
+}
+
+func (e *encodeState) orders(orders []models.Order) {
+	if orders == nil {
+		e.b = append(e.b, "null"...)
+		return
+	}
+	e.b = append(e.b, '[')
+	for i := range orders {
+		if i > 0 {
+			e.b = append(e.b, ',')
+		}
+		e.order(&orders[i])
+	}
+	e.b = append(e.b, ']')
+}
+
+// order encodes an order under its Go field names, since models.Order has
+// no JSON tags
+func (e *encodeState) order(o *models.Order) {
+	e.b = append(e.b, `{"ID":`...)
+	e.b = strconv.AppendInt(e.b, int64(o.ID), 10)
+	e.b = append(e.b, `,"UserID":`...)
+	e.b = strconv.AppendInt(e.b, int64(o.UserID), 10)
+	e.b = append(e.b, `,"Symbol":`...)
+	e.b = appendString(e.b, o.Symbol)
+	e.b = append(e.b, `,"Type":`...)
+	e.b = appendString(e.b, o.Type)
+	e.b = append(e.b, `,"Price":`...)
+	e.float(o.Price)
+	e.b = append(e.b, `,"Quantity":`...)
+	e.float(o.Quantity)
+	e.b = append(e.b, `,"Status":`...)
+	e.b = appendString(e.b, o.Status)
+	e.b = append(e.b, `,"CreatedAt":`...)
+	e.time(o.CreatedAt)
+	e.b = append(e.b, `,"Tag":`...)
+	e.b = appendString(e.b, o.Tag)
+	if o.ClientOrderID != "" {
+		e.b = append(e.b, `,"ClientOrderID":`...)
+		e.b = appendString(e.b, o.ClientOrderID)
+	}
+	e.b = append(e.b, `,"TimeInForce":`...)
+	e.b = appendString(e.b, o.TimeInForce)
+	e.b = append(e.b, `,"PostOnly":`...)
+	e.b = strconv.AppendBool(e.b, o.PostOnly)
+	if o.DisplayQuantity != 0 {
+		e.b = append(e.b, `,"DisplayQuantity":`...)
+		e.float(o.DisplayQuantity)
+	}
+	if o.ExpiresAt != nil {
+		e.b = append(e.b, `,"ExpiresAt":`...)
+		e.time(*o.ExpiresAt)
+	}
+	e.b = append(e.b, '}')
+}
+
+func (e *encodeState) candle(c models.Candle) {
+	e.b = append(e.b, `{"interval":`...)
+	e.b = appendString(e.b, c.Interval)
+	e.b = append(e.b, `,"open_time":`...)
+	e.time(c.OpenTime)
+	e.b = append(e.b, `,"open":`...)
+	e.float(c.Open)
+	e.b = append(e.b, `,"high":`...)
+	e.float(c.High)
+	e.b = append(e.b, `,"low":`...)
+	e.float(c.Low)
+	e.b = append(e.b, `,"close":`...)
+	e.float(c.Close)
+	e.b = append(e.b, `,"volume":`...)
+	e.float(c.Volume)
+	e.b = append(e.b, '}')
+}
+
+func (e *encodeState) trade(t models.Trade) {
+	e.b = append(e.b, `{"id":`...)
+	e.b = strconv.AppendInt(e.b, int64(t.ID), 10)
+	e.b = append(e.b, `,"buy_order_id":`...)
+	e.b = strconv.AppendInt(e.b, int64(t.BuyOrderID), 10)
+	e.b = append(e.b, `,"sell_order_id":`...)
+	e.b = strconv.AppendInt(e.b, int64(t.SellOrderID), 10)
+	e.b = append(e.b, `,"price":`...)
+	e.float(t.Price)
+	e.b = append(e.b, `,"quantity":`...)
+	e.float(t.Quantity)
+	e.b = append(e.b, `,"executed_at":`...)
+	e.time(t.ExecutedAt)
+	e.b = append(e.b, `,"taker_side":`...)
+	e.b = appendString(e.b, t.TakerSide)
+	if t.Tag != "" {
+		e.b = append(e.b, `,"tag":`...)
+		e.b = appendString(e.b, t.Tag)
+	}
+	if t.Side != "" {
+		e.b = append(e.b, `,"side":`...)
+		e.b = appendString(e.b, t.Side)
+	}
+	if t.Sequence != 0 {
+		e.b = append(e.b, `,"seq":`...)
+		e.b = strconv.AppendUint(e.b, t.Sequence, 10)
+	}
+	e.b = append(e.b, '}')
+}
+
+func (e *encodeState) publicTrade(t models.PublicTrade) {
+	e.b = append(e.b, `{"id":`...)
+	e.b = strconv.AppendInt(e.b, int64(t.ID), 10)
+	e.b = append(e.b, `,"symbol":`...)
+	e.b = appendString(e.b, t.Symbol)
+	e.b = append(e.b, `,"price":`...)
+	e.float(t.Price)
+	e.b = append(e.b, `,"quantity":`...)
+	e.float(t.Quantity)
+	e.b = append(e.b, `,"taker_side":`...)
+	e.b = appendString(e.b, t.TakerSide)
+	e.b = append(e.b, `,"executed_at":`...)
+	e.time(t.ExecutedAt)
+	if t.Sequence != 0 {
+		e.b = append(e.b, `,"seq":`...)
+		e.b = strconv.AppendUint(e.b, t.Sequence, 10)
+	}
+	e.b = append(e.b, '}')
+}
+
+// float formats like encoding/json: plain decimals, switching to exponents
+// for very small or large magnitudes
+func (e *encodeState) float(f float64) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		if e.err == nil {
+			e.err = &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		e.b = append(e.b, '0')
+		return
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	e.b = strconv.AppendFloat(e.b, f, format, -1, 64)
+	if format == 'e' {
+		// Trim a leading zero from the exponent, e.g. 1e-07 to 1e-7
+		n := len(e.b)
+		if n >= 4 && e.b[n-4] == 'e' && e.b[n-3] == '-' && e.b[n-2] == '0' {
+			e.b[n-2] = e.b[n-1]
+			e.b = e.b[:n-1]
+		}
+	}
+}
+
+func (e *encodeState) time(t time.Time) {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		if e.err == nil {
+			e.err = fmt.Errorf("json: error calling MarshalJSON for type time.Time: year outside of range [0,9999]")
+		}
+	}
+	e.b = append(e.b, '"')
+	e.b = t.AppendFormat(e.b, time.RFC3339Nano)
+	e.b = append(e.b, '"')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString quotes s like encoding/json, including its HTML escaping
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,146 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestFastEncoder_MatchesStd(t *testing.T) {
+	at := time.Date(2024, 3, 15, 13, 47, 29, 123456789, time.FixedZone("SGT", 8*3600))
+	values := []interface{}{
+		OrderBook{},
+		OrderBook{BuyOrders: []models.Order{}},
+		OrderBook{
+			BuyOrders: []models.Order{
+				{ID: 1, UserID: 7, Symbol: "BTC-USD", Type: "buy", Price: 50000.5, Quantity: 0.00000012, Status: "open", CreatedAt: at, TimeInForce: "GTC"},
+				{ID: 2, Type: "buy", Price: 1e21, Quantity: 123456789.125, Status: "open", Tag: `<"quoted" & \back>` + "\n\t\x01 é\xff", PostOnly: true},
+			},
+			SellOrders: []models.Order{{ID: 3, Type: "sell", Price: 0, Quantity: -1e-7, Status: "open"}},
+		},
+		&OrderBook{SellOrders: []models.Order{{ID: 4, Price: 100}}},
+		OrderBook{SellOrders: []models.Order{{ID: 5, Price: 100, Quantity: 2, DisplayQuantity: 0.25}}},
+		OrderBook{BuyOrders: []models.Order{{ID: 7, Price: 98, Quantity: 1, Tag: "grid", ClientOrderID: `my-"order"-1`}}},
+		OrderBook{BuyOrders: []models.Order{{ID: 6, Price: 99, Quantity: 1, TimeInForce: "GTD", ExpiresAt: &at}}, Seq: 1710481649123456},
+		models.Candle{Interval: "1m", OpenTime: at.UTC(), Open: 100, High: 101.25, Low: 99.999999, Close: 100.1, Volume: 3},
+		models.Trade{ID: 9, BuyOrderID: 1, SellOrderID: 3, Price: 100, Quantity: 0.5, ExecutedAt: at, TakerSide: "buy", BuyFee: 1},
+		models.Trade{ID: 10, Tag: "grid", Side: "sell", Sequence: 42},
+		models.PublicTrade{ID: 11, Symbol: "BTC-USD", Price: 50000.25, Quantity: 0.001, TakerSide: "sell", ExecutedAt: at},
+		models.PublicTrade{ID: 12, Sequence: 43},
+		map[string]int{"fallback": 1},
+	}
+
+	for i, v := range values {
+		t.Run(fmt.Sprintf("%d_%T", i, v), func(t *testing.T) {
+			want, err := StdEncoder{}.Marshal(v)
+			if err != nil {
+				t.Fatalf("std encoder failed: %v", err)
+			}
+			got, err := FastEncoder{}.Marshal(v)
+			if err != nil {
+				t.Fatalf("fast encoder failed: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("encodings differ:\nfast: %s\nstd:  %s", got, want)
+			}
+		})
+	}
+}
+
+func TestFastEncoder_Errors(t *testing.T) {
+	if _, err := (FastEncoder{}).Marshal(models.Candle{Close: math.NaN()}); err == nil {
+		t.Error("expected an error for NaN")
+	}
+	if _, err := (FastEncoder{}).Marshal(models.Trade{ExecutedAt: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)}); err == nil {
+		t.Error("expected an error for a time outside JSON's range")
+	}
+
+	// A failed encode doesn't leave anything behind in pooled buffers
+	got, _ := FastEncoder{}.Marshal(models.Trade{ID: 1})
+	want, _ := json.Marshal(models.Trade{ID: 1})
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestChannelMessage(t *testing.T) {
+	candle := models.Candle{Interval: "1m", Close: 100}
+	data, _ := FastEncoder{}.Marshal(candle)
+	want, _ := json.Marshal(struct {
+		Channel string      `json:"channel"`
+		Data    interface{} `json:"data"`
+	}{"candles:1m", candle})
+	if got := ChannelMessage("candles:1m", data); string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestNewOrderBook(t *testing.T) {
+	now := time.Now()
+	book := NewOrderBook([]models.Order{
+		{ID: 1, Type: "buy", Price: 99, CreatedAt: now},
+		{ID: 2, Type: "sell", Price: 102, CreatedAt: now},
+		{ID: 3, Type: "buy", Price: 100, CreatedAt: now.Add(time.Second)},
+		{ID: 4, Type: "buy", Price: 100, CreatedAt: now, ClientOrderID: "mine"},
+		{ID: 5, Type: "sell", Price: 101, Quantity: 3, DisplayQuantity: 0.5, CreatedAt: now},
+	}, 2)
+	if len(book.BuyOrders) != 2 || book.BuyOrders[0].ID != 4 || book.BuyOrders[1].ID != 3 {
+		t.Errorf("expected bids 4, 3 best first, got %+v", book.BuyOrders)
+	}
+	if len(book.SellOrders) != 2 || book.SellOrders[0].ID != 5 {
+		t.Errorf("expected asks 5, 2 best first, got %+v", book.SellOrders)
+	}
+	if iceberg := book.SellOrders[0]; iceberg.Quantity != 0.5 || iceberg.DisplayQuantity != 0 {
+		t.Errorf("expected only the displayed 0.5 of the iceberg, got %+v", iceberg)
+	}
+	if id := book.BuyOrders[0].ClientOrderID; id != "" {
+		t.Errorf("expected the client order ID left out of the public book, got %q", id)
+	}
+}
+
+// benchmarkBook returns a book with the given number of orders per side
+func benchmarkBook(depth int) OrderBook {
+	var orders []models.Order
+	now := time.Now()
+	for i := 0; i < depth; i++ {
+		orders = append(orders,
+			models.Order{ID: 2 * i, UserID: i, Symbol: "BTC-USD", Type: "buy", Price: 50000 - float64(i)*0.5, Quantity: 0.125, Status: "open", CreatedAt: now, TimeInForce: "GTC"},
+			models.Order{ID: 2*i + 1, UserID: i, Symbol: "BTC-USD", Type: "sell", Price: 50001 + float64(i)*0.5, Quantity: 0.25, Status: "open", CreatedAt: now, TimeInForce: "GTC"},
+		)
+	}
+	return NewOrderBook(orders, 0)
+}
+
+func BenchmarkEncodeOrderBook(b *testing.B) {
+	book := benchmarkBook(100)
+	for name, encoder := range map[string]Encoder{"std": StdEncoder{}, "fast": FastEncoder{}} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := encoder.Marshal(book); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeCandle(b *testing.B) {
+	candle := models.Candle{Interval: "1m", OpenTime: time.Now(), Open: 50000, High: 50100.5, Low: 49900.25, Close: 50050, Volume: 12.5}
+	for name, encoder := range map[string]Encoder{"std": StdEncoder{}, "fast": FastEncoder{}} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := encoder.Marshal(candle)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ChannelMessage("candles:1m", data)
+			}
+		})
+	}
+}
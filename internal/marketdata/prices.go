@@ -0,0 +1,173 @@
+package marketdata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// ReferenceWindows maps the supported reference price window names to their
+// lengths
+var ReferenceWindows = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// ReferencePrice is a benchmark price over a rolling window. Price is zero
+// if nothing has traded yet, and for VWAP if nothing traded in the window.
+type ReferencePrice struct {
+	Window     string    `json:"window"`
+	Price      float64   `json:"price"`
+	Volume     float64   `json:"volume"`      // Quantity traded in the window
+	TradeCount int       `json:"trade_count"` // Trades in the window
+	AsOf       time.Time `json:"as_of"`
+}
+
+// priceEntry is a trade held in a reference window
+type priceEntry struct {
+	price    float64
+	quantity float64
+	at       time.Time
+}
+
+// referenceWindow maintains the volume- and time-weighted average prices of
+// one rolling window as trades arrive and leave it
+type referenceWindow struct {
+	length   time.Duration
+	entries  []priceEntry // Trades in the window, oldest first
+	notional float64
+	volume   float64
+	// area is the sum, over each trade in the window but the last, of its
+	// price times the seconds until the next trade
+	area float64
+	// before is the price of the last trade to leave the window, which
+	// prevailed at its start; zero if none has
+	before float64
+}
+
+func (w *referenceWindow) add(entry priceEntry) {
+	if n := len(w.entries); n > 0 {
+		last := w.entries[n-1]
+		w.area += last.price * entry.at.Sub(last.at).Seconds()
+	}
+	w.entries = append(w.entries, entry)
+	w.notional += entry.price * entry.quantity
+	w.volume += entry.quantity
+}
+
+// evict drops trades that have left the window ending at now
+func (w *referenceWindow) evict(now time.Time) {
+	cutoff := now.Add(-w.length)
+	for len(w.entries) > 0 && !w.entries[0].at.After(cutoff) {
+		old := w.entries[0]
+		w.entries = w.entries[1:]
+		w.notional -= old.price * old.quantity
+		w.volume -= old.quantity
+		if len(w.entries) > 0 {
+			w.area -= old.price * w.entries[0].at.Sub(old.at).Seconds()
+		}
+		w.before = old.price
+	}
+	if len(w.entries) == 0 {
+		// Avoid floating-point drift accumulating across empty windows
+		w.notional, w.volume, w.area = 0, 0, 0
+	}
+}
+
+// vwap returns the volume-weighted average price of the trades in the window
+func (w *referenceWindow) vwap() float64 {
+	if w.volume <= 0 {
+		return 0
+	}
+	return w.notional / w.volume
+}
+
+// twap returns the average over the window ending at now of the last traded
+// price, weighted by how long each price stood. Until a trade has left the
+// window its start is the first trade's time.
+func (w *referenceWindow) twap(now time.Time) float64 {
+	if len(w.entries) == 0 {
+		return w.before
+	}
+	first, last := w.entries[0], w.entries[len(w.entries)-1]
+	sum := w.area + last.price*now.Sub(last.at).Seconds()
+	covered := now.Sub(first.at).Seconds()
+	if w.before > 0 {
+		sum += w.before * first.at.Sub(now.Add(-w.length)).Seconds()
+		covered = w.length.Seconds()
+	}
+	if covered <= 0 {
+		return last.price
+	}
+	return sum / covered
+}
+
+// ReferencePrices maintains VWAP and TWAP benchmark prices over each of
+// ReferenceWindows incrementally from the trade stream
+type ReferencePrices struct {
+	mu      sync.Mutex
+	windows map[string]*referenceWindow
+}
+
+// NewReferencePrices creates reference prices for every window in
+// ReferenceWindows
+func NewReferencePrices() *ReferencePrices {
+	p := &ReferencePrices{windows: make(map[string]*referenceWindow, len(ReferenceWindows))}
+	for name, length := range ReferenceWindows {
+		p.windows[name] = &referenceWindow{length: length}
+	}
+	return p
+}
+
+// OnTrade is an events.Handler feeding executed trades into the prices
+func (p *ReferencePrices) OnTrade(e events.Event) {
+	if trade, ok := e.Data.(models.Trade); ok {
+		p.AddTrade(trade)
+	}
+}
+
+// AddTrade records a trade; trades must be added in execution order
+func (p *ReferencePrices) AddTrade(trade models.Trade) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := priceEntry{price: trade.Price, quantity: trade.Quantity, at: trade.ExecutedAt}
+	for _, w := range p.windows {
+		w.add(entry)
+		w.evict(trade.ExecutedAt)
+	}
+}
+
+// VWAP returns the volume-weighted average price over the named window
+// ending at now, or false if the window isn't supported
+func (p *ReferencePrices) VWAP(window string, now time.Time) (ReferencePrice, bool) {
+	return p.price(window, now, func(w *referenceWindow) float64 { return w.vwap() })
+}
+
+// TWAP returns the time-weighted average price over the named window ending
+// at now, or false if the window isn't supported
+func (p *ReferencePrices) TWAP(window string, now time.Time) (ReferencePrice, bool) {
+	return p.price(window, now, func(w *referenceWindow) float64 { return w.twap(now) })
+}
+
+func (p *ReferencePrices) price(window string, now time.Time, average func(*referenceWindow) float64) (ReferencePrice, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.windows[window]
+	if !ok {
+		return ReferencePrice{}, false
+	}
+	w.evict(now)
+	return ReferencePrice{
+		Window:     window,
+		Price:      average(w),
+		Volume:     w.volume,
+		TradeCount: len(w.entries),
+		AsOf:       now,
+	}, true
+}
@@ -0,0 +1,70 @@
+package marketdata
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestReferencePrices(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prices := NewReferencePrices()
+	for _, trade := range []models.Trade{
+		{Price: 100, Quantity: 1, ExecutedAt: start},
+		{Price: 110, Quantity: 3, ExecutedAt: start.Add(20 * time.Minute)},
+		{Price: 90, Quantity: 1, ExecutedAt: start.Add(40 * time.Minute)},
+	} {
+		prices.AddTrade(trade)
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		expectVWAP float64
+		expectTWAP float64
+		expectCnt  int
+	}{
+		{
+			// 100 for 20m, 110 for 20m, 90 for 10m
+			name:       "WindowNotFull",
+			now:        start.Add(50 * time.Minute),
+			expectVWAP: 104, expectTWAP: 102, expectCnt: 3,
+		},
+		{
+			// The first trade has left; its price stood for the first 10m
+			name:       "FirstTradeEvicted",
+			now:        start.Add(70 * time.Minute),
+			expectVWAP: 105, expectTWAP: (100*10 + 110*20 + 90*30) / 60.0, expectCnt: 2,
+		},
+		{
+			// The last price stood for the whole window
+			name:       "WindowEmpty",
+			now:        start.Add(3 * time.Hour),
+			expectVWAP: 0, expectTWAP: 90, expectCnt: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vwap, ok := prices.VWAP("1h", tt.now)
+			if !ok {
+				t.Fatalf("expected 1h window to be supported")
+			}
+			twap, _ := prices.TWAP("1h", tt.now)
+			if math.Abs(vwap.Price-tt.expectVWAP) > 1e-9 {
+				t.Errorf("expected VWAP %v, got %v", tt.expectVWAP, vwap.Price)
+			}
+			if math.Abs(twap.Price-tt.expectTWAP) > 1e-9 {
+				t.Errorf("expected TWAP %v, got %v", tt.expectTWAP, twap.Price)
+			}
+			if vwap.TradeCount != tt.expectCnt || twap.TradeCount != tt.expectCnt {
+				t.Errorf("expected %d trades, got %d and %d", tt.expectCnt, vwap.TradeCount, twap.TradeCount)
+			}
+		})
+	}
+
+	if _, ok := prices.VWAP("2h", start); ok {
+		t.Errorf("expected 2h window to be unsupported")
+	}
+}
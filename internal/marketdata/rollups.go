@@ -0,0 +1,67 @@
+package marketdata
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+// maxRollupCatchUp bounds how far back rollups are calculated when none
+// have been, or after the server was down
+const maxRollupCatchUp = 7 * 24 * time.Hour
+
+// StatsRoller persists hourly rollups of each market's trade count, volume
+// and notional value
+type StatsRoller struct {
+	DB *db.DB
+}
+
+// NewStatsRoller creates a roller writing to database
+func NewStatsRoller(database *db.DB) *StatsRoller {
+	return &StatsRoller{DB: database}
+}
+
+// rollupRange returns the hours due to be rolled up at now, given the
+// latest hour already rolled up: from that hour, again, in case trades were
+// recorded after it was, through the last complete hour
+func rollupRange(latest, now time.Time) (from, to time.Time) {
+	to = BucketStart(now, time.Hour)
+	from = to.Add(-maxRollupCatchUp)
+	if latest.After(from) {
+		from = latest.UTC()
+	}
+	return from, to
+}
+
+// RollDue rolls up the complete hours not yet rolled up at now
+func (s *StatsRoller) RollDue(ctx context.Context, now time.Time) error {
+	latest, err := s.DB.GetLatestMarketStatsHour(ctx)
+	if err != nil {
+		return err
+	}
+	from, to := rollupRange(latest, now)
+	if !from.Before(to) {
+		return nil
+	}
+	_, err = s.DB.RollupMarketStats(ctx, from, to)
+	return err
+}
+
+// Run rolls up each hour once it is over, checking every interval until ctx
+// is done. Failures are retried on the next check.
+func (s *StatsRoller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.RollDue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to roll up market stats: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
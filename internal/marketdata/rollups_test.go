@@ -0,0 +1,30 @@
+package marketdata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupRange(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC)
+	hour := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		latest   time.Time
+		from, to time.Time
+	}{
+		{"nothing rolled up", time.Time{}, hour.Add(-maxRollupCatchUp), hour},
+		{"previous hour rolled up", hour.Add(-time.Hour), hour.Add(-time.Hour), hour},
+		{"down for a while", hour.Add(-5 * time.Hour), hour.Add(-5 * time.Hour), hour},
+		{"down for longer than the catch-up", hour.Add(-30 * 24 * time.Hour), hour.Add(-maxRollupCatchUp), hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := rollupRange(tt.latest, now)
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("expected [%v, %v), got [%v, %v)", tt.from, tt.to, from, to)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package marketdata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// TickerStats summarizes trading over the ticker's rolling window
+type TickerStats struct {
+	LastPrice          float64 `json:"last_price"`
+	High               float64 `json:"high_24h"`
+	Low                float64 `json:"low_24h"`
+	Volume             float64 `json:"volume_24h"`
+	PriceChange        float64 `json:"price_change"`
+	PriceChangePercent float64 `json:"price_change_percent"`
+	TradeCount         int     `json:"trade_count_24h"`
+}
+
+// tickEntry is a trade held in the rolling window
+type tickEntry struct {
+	seq      int
+	price    float64
+	quantity float64
+	at       time.Time
+}
+
+// Ticker maintains rolling statistics incrementally as trades arrive.
+// High and low are tracked with monotonic queues so evicting old trades
+// never requires rescanning the window.
+type Ticker struct {
+	mu        sync.Mutex
+	window    time.Duration
+	nextSeq   int
+	entries   []tickEntry // Trades in the window, oldest first
+	maxQueue  []tickEntry // Decreasing prices; front is the window high
+	minQueue  []tickEntry // Increasing prices; front is the window low
+	volume    float64
+	lastPrice float64
+}
+
+// NewTicker creates a ticker over a rolling window, typically 24 hours
+func NewTicker(window time.Duration) *Ticker {
+	return &Ticker{window: window}
+}
+
+// OnTrade is an events.Handler feeding executed trades into the ticker
+func (t *Ticker) OnTrade(e events.Event) {
+	if trade, ok := e.Data.(models.Trade); ok {
+		t.AddTrade(trade)
+	}
+}
+
+// AddTrade records a trade, evicting those that have left the window it
+// ends, so the window stays bounded even if Stats is never read; trades
+// must be added in execution order
+func (t *Ticker) AddTrade(trade models.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := tickEntry{seq: t.nextSeq, price: trade.Price, quantity: trade.Quantity, at: trade.ExecutedAt}
+	t.nextSeq++
+
+	t.entries = append(t.entries, entry)
+	t.volume += entry.quantity
+	t.lastPrice = entry.price
+
+	for len(t.maxQueue) > 0 && t.maxQueue[len(t.maxQueue)-1].price <= entry.price {
+		t.maxQueue = t.maxQueue[:len(t.maxQueue)-1]
+	}
+	t.maxQueue = append(t.maxQueue, entry)
+
+	for len(t.minQueue) > 0 && t.minQueue[len(t.minQueue)-1].price >= entry.price {
+		t.minQueue = t.minQueue[:len(t.minQueue)-1]
+	}
+	t.minQueue = append(t.minQueue, entry)
+
+	t.evict(trade.ExecutedAt)
+}
+
+// evict drops trades that have left the window; callers must hold t.mu
+func (t *Ticker) evict(now time.Time) {
+	cutoff := now.Add(-t.window)
+	for len(t.entries) > 0 && !t.entries[0].at.After(cutoff) {
+		old := t.entries[0]
+		t.entries = t.entries[1:]
+		t.volume -= old.quantity
+		if len(t.maxQueue) > 0 && t.maxQueue[0].seq == old.seq {
+			t.maxQueue = t.maxQueue[1:]
+		}
+		if len(t.minQueue) > 0 && t.minQueue[0].seq == old.seq {
+			t.minQueue = t.minQueue[1:]
+		}
+	}
+	if len(t.entries) == 0 {
+		// Avoid floating-point drift accumulating across empty windows
+		t.volume = 0
+	}
+}
+
+// Stats returns the statistics for the window ending at now
+func (t *Ticker) Stats(now time.Time) TickerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.evict(now)
+
+	stats := TickerStats{LastPrice: t.lastPrice, TradeCount: len(t.entries)}
+	if len(t.entries) == 0 {
+		return stats
+	}
+
+	open := t.entries[0].price
+	stats.High = t.maxQueue[0].price
+	stats.Low = t.minQueue[0].price
+	stats.Volume = t.volume
+	stats.PriceChange = t.lastPrice - open
+	stats.PriceChangePercent = stats.PriceChange / open * 100
+	return stats
+}
@@ -0,0 +1,95 @@
+package marketdata
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestTicker_Stats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticker := NewTicker(time.Hour)
+
+	trades := []models.Trade{
+		{Price: 100, Quantity: 1, ExecutedAt: start},
+		{Price: 120, Quantity: 2, ExecutedAt: start.Add(10 * time.Minute)},
+		{Price: 90, Quantity: 1, ExecutedAt: start.Add(20 * time.Minute)},
+		{Price: 110, Quantity: 0.5, ExecutedAt: start.Add(30 * time.Minute)},
+	}
+	for _, trade := range trades {
+		ticker.AddTrade(trade)
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		expectHigh float64
+		expectLow  float64
+		expectVol  float64
+		expectPct  float64
+		expectCnt  int
+	}{
+		{
+			name:       "AllTradesInWindow",
+			now:        start.Add(40 * time.Minute),
+			expectHigh: 120, expectLow: 90, expectVol: 4.5, expectPct: 10, expectCnt: 4,
+		},
+		{
+			name:       "FirstTradeEvicted",
+			now:        start.Add(65 * time.Minute),
+			expectHigh: 120, expectLow: 90, expectVol: 3.5, expectPct: -100.0 / 12, expectCnt: 3,
+		},
+		{
+			name:       "HighEvicted",
+			now:        start.Add(75 * time.Minute),
+			expectHigh: 110, expectLow: 90, expectVol: 1.5, expectPct: 200.0 / 9, expectCnt: 2,
+		},
+		{
+			name:      "WindowEmpty",
+			now:       start.Add(3 * time.Hour),
+			expectCnt: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := ticker.Stats(tt.now)
+			if stats.LastPrice != 110 {
+				t.Errorf("expected last price 110, got %v", stats.LastPrice)
+			}
+			if stats.TradeCount != tt.expectCnt {
+				t.Errorf("expected %d trades, got %d", tt.expectCnt, stats.TradeCount)
+			}
+			if stats.High != tt.expectHigh || stats.Low != tt.expectLow {
+				t.Errorf("expected high/low %v/%v, got %v/%v", tt.expectHigh, tt.expectLow, stats.High, stats.Low)
+			}
+			if math.Abs(stats.Volume-tt.expectVol) > 1e-9 {
+				t.Errorf("expected volume %v, got %v", tt.expectVol, stats.Volume)
+			}
+			if math.Abs(stats.PriceChangePercent-tt.expectPct) > 1e-9 {
+				t.Errorf("expected change %v%%, got %v%%", tt.expectPct, stats.PriceChangePercent)
+			}
+		})
+	}
+}
+
+func TestTicker_EvictsOnTrade(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticker := NewTicker(time.Hour)
+
+	// A day of trades a minute apart, with no reads in between
+	for i := 0; i < 24*60; i++ {
+		ticker.AddTrade(models.Trade{Price: float64(100 + i%7), Quantity: 1, ExecutedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if len(ticker.entries) != 60 {
+		t.Errorf("expected the last hour of trades held, got %d", len(ticker.entries))
+	}
+	if len(ticker.maxQueue) > 60 || len(ticker.minQueue) > 60 {
+		t.Errorf("expected the queues bounded by the window, got %d and %d", len(ticker.maxQueue), len(ticker.minQueue))
+	}
+	if stats := ticker.Stats(start.Add(24*time.Hour - time.Minute)); stats.Volume != 60 || stats.TradeCount != 60 {
+		t.Errorf("expected an hour of volume, got %+v", stats)
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User represents a registered user
 type User struct {
@@ -8,17 +11,69 @@ type User struct {
 	Username     string
 	PasswordHash string
 	CreatedAt    time.Time
+	KYCTier      int    // Verification level; higher tiers get larger trading limits
+	MergedInto   int    // ID of the account this one was merged into, or 0
+	Role         string // "user" or "admin"
+	Suspended    bool   // Suspended accounts can't log in or use the API
+
+	ServiceAccount bool // Has no password and can only use the API with keys
 }
 
 // Order represents a buy or sell order
 type Order struct {
 	ID        int
 	UserID    int
+	Symbol    string    // Trading pair, e.g. "BTC-USD"
 	Type      string    // "buy" or "sell"
 	Price     float64   // Price in USD
 	Quantity  float64   // Quantity in BTC
 	Status    string    // "open", "filled", "canceled"
 	CreatedAt time.Time // Used for time priority
+	Tag       string    // Optional client-supplied strategy label
+
+	// ClientOrderID is the client's own ID for the order, unique among the
+	// user's orders; empty if none was given
+	ClientOrderID string `json:",omitempty"`
+
+	TimeInForce string // "GTC" (default), "GTD", "IOC" or "FOK"
+	PostOnly    bool   // Canceled instead of taking liquidity if it would cross the book
+
+	// DisplayQuantity makes a resting order an iceberg: the book shows at
+	// most this much of it and hides the rest. Zero shows the whole order.
+	DisplayQuantity float64 `json:",omitempty"`
+
+	// Lifetime is how long a GTC order may rest before the engine takes it
+	// off the book; zero rests it until filled or canceled
+	Lifetime time.Duration `json:"-"`
+
+	// ExpiresAt is when a GTD order is canceled if still open; nil for
+	// other orders
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// OrderUpdate is a change to an order, pushed to the user who placed it
+type OrderUpdate struct {
+	Event          string    `json:"event"`              // "accepted", "partially_filled", "filled", "amended", "canceled" or "rejected"
+	OrderID        int       `json:"order_id,omitempty"` // Zero for orders rejected before they were created
+	UserID         int       `json:"-"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	Price          float64   `json:"price"`
+	Quantity       float64   `json:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	Status         string    `json:"status,omitempty"` // Status after the change; empty for rejected orders
+	Tag            string    `json:"tag,omitempty"`
+	ClientOrderID  string    `json:"client_order_id,omitempty"`
+	Reason         string    `json:"reason,omitempty"` // Why the order was rejected, "expired" for a GTD order canceled on expiry, "disconnected" for one canceled on disconnect, or "cancel_all_after" for one canceled by a dead man's switch
+	Code           string    `json:"code,omitempty"`   // Machine-readable reason, as in error responses
+	Time           time.Time `json:"time"`
+}
+
+// OrderEvent is a change to an order as streamed to downstream services,
+// with its owner
+type OrderEvent struct {
+	OrderUpdate
+	UserID int `json:"user_id"`
 }
 
 // Trade represents an executed trade
@@ -26,7 +81,482 @@ type Trade struct {
 	ID          int       `json:"id"`
 	BuyOrderID  int       `json:"buy_order_id"`
 	SellOrderID int       `json:"sell_order_id"`
+	BuyUserID   int       `json:"-"` // Owners of each side, set by the matching engine
+	SellUserID  int       `json:"-"`
+	Price       float64   `json:"price"`
+	Quantity    float64   `json:"quantity"`
+	ExecutedAt  time.Time `json:"executed_at"`
+	TakerSide   string    `json:"taker_side"` // Side of the incoming order that crossed the book
+	BuyFee      float64   `json:"-"`          // Fees charged to each side, in the quote currency
+	SellFee     float64   `json:"-"`
+	Tag         string    `json:"tag,omitempty"`  // Tag of the requesting user's order, in per-user views
+	Side        string    `json:"side,omitempty"` // Side of the requesting user's order, in per-user views
+	JournalRef  string    `json:"-"`              // Engine journal reference, so recovery can tell if the trade was recorded
+	Sequence    uint64    `json:"seq,omitempty"`  // Engine sequence number, set by the matching engine
+}
+
+// PublicTrade is a trade as published to everyone, without the orders on
+// each side
+type PublicTrade struct {
+	ID         int       `json:"id"`
+	Symbol     string    `json:"symbol"`
+	Price      float64   `json:"price"`
+	Quantity   float64   `json:"quantity"`
+	TakerSide  string    `json:"taker_side"` // Side of the incoming order that crossed the book
+	ExecutedAt time.Time `json:"executed_at"`
+	Sequence   uint64    `json:"seq,omitempty"` // Engine sequence number, in live trades only
+}
+
+// Fill is one side of an executed trade, as seen by the user who owns the order
+type Fill struct {
+	TradeID     int       `json:"trade_id"`
+	OrderID     int       `json:"order_id"`
+	Symbol      string    `json:"symbol"`
+	Side        string    `json:"side"` // "buy" or "sell"
+	Role        string    `json:"role"` // "maker" if the order was resting on the book, otherwise "taker"
+	Price       float64   `json:"price"`
+	Quantity    float64   `json:"quantity"`
+	Fee         float64   `json:"fee"`
+	FeeCurrency string    `json:"fee_currency"`
+	Tag         string    `json:"tag,omitempty"`
+	ExecutedAt  time.Time `json:"executed_at"`
+}
+
+// UserTrade is a trade as seen by the user who owns one side of it. Unlike
+// Trade, it names only the user's own order and fee, not the counterparty's.
+type UserTrade struct {
+	ID          int       `json:"id"`
+	OrderID     int       `json:"order_id"`
+	Symbol      string    `json:"symbol"`
+	Side        string    `json:"side"` // "buy" or "sell"
+	Role        string    `json:"role"` // "maker" if the order was resting on the book, otherwise "taker"
+	Price       float64   `json:"price"`
+	Quantity    float64   `json:"quantity"`
+	Fee         float64   `json:"fee"`
+	FeeCurrency string    `json:"fee_currency"`
+	Tag         string    `json:"tag,omitempty"`
+	ExecutedAt  time.Time `json:"executed_at"`
+}
+
+// Volume is a user's trading in one role over a period
+type Volume struct {
+	Trades   int     `json:"trades"`
+	Quantity float64 `json:"quantity"`
+	Notional float64 `json:"notional"` // Price × quantity, in the quote currency
+}
+
+// VolumeBreakdown splits a user's trading in one instrument into the fills
+// where their order was resting on the book (maker) and where it crossed it
+// (taker). A self-trade counts in both.
+type VolumeBreakdown struct {
+	Symbol     string  `json:"symbol"`
+	Maker      Volume  `json:"maker"`
+	Taker      Volume  `json:"taker"`
+	MakerShare float64 `json:"maker_share"` // Maker fraction of the notional
+}
+
+// Candle is an OHLCV bar aggregated from trades over a fixed interval
+type Candle struct {
+	Interval string    `json:"interval"`  // "1m", "5m", "1h" or "1d"
+	OpenTime time.Time `json:"open_time"` // Start of the interval
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"` // Quantity traded in BTC
+}
+
+// APIKey is a credential for signing API requests. The secret is only
+// revealed when the key is created.
+type APIKey struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Key       string    `json:"api_key"`
+	Secret    string    `json:"secret,omitempty"`
+	Label     string    `json:"label"`
+	Scopes    []string  `json:"scopes"` // Any of "read", "trade" and "withdraw"
+	CreatedAt time.Time `json:"created_at"`
+
+	// CancelOnDisconnect cancels the user's open orders when a WebSocket
+	// connection the key authenticated drops
+	CancelOnDisconnect bool `json:"cancel_on_disconnect"`
+}
+
+// Webhook is a URL the user's order fills and cancellations are posted to,
+// signed with its secret. The secret is only revealed when it's registered.
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an order update posted, or waiting to be posted, to a
+// webhook
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         string          `json:"event"`   // The order update's event, e.g. "filled"
+	Payload       json.RawMessage `json:"payload"` // The body posted
+	Status        string          `json:"status"`  // "pending", "delivered" or "failed" once out of attempts
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"` // The status the webhook last replied with
+	Error         string          `json:"error,omitempty"`         // Why the last attempt failed
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Session is a login, which the token it issued authenticates as until it
+// expires or is revoked
+type Session struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"` // The session of the request listing it
+}
+
+// Login is a successful login, with the session it started
+type Login struct {
+	Session
+	Username string
+	NewIP    bool // The user has logged in before, but never from this IP
+}
+
+// NotificationPreferences are what a user is notified of, and where
+type NotificationPreferences struct {
+	Email     string `json:"email"`      // Address emailed notifications go to; empty sends none by email
+	Fills     bool   `json:"fills"`      // Orders filling, in part or in full
+	Expiries  bool   `json:"expiries"`   // GTD orders canceled on expiry
+	NewLogins bool   `json:"new_logins"` // Logins from an IP the user hasn't logged in from before
+}
+
+// Preferences are a user's defaults for fields omitted from new orders
+type Preferences struct {
+	DefaultTimeInForce   string  `json:"default_time_in_force"`  // "GTC", "IOC" or "FOK"
+	DefaultPostOnly      bool    `json:"default_post_only"`      // Applies to GTC orders only
+	ConfirmNotionalAbove float64 `json:"confirm_notional_above"` // Orders above this notional need "confirm": true; 0 disables
+}
+
+// OrderLimits cap each of a user's orders, as set by admins. Zero means unlimited.
+type OrderLimits struct {
+	MaxOrderNotional float64 `json:"max_order_notional"` // Price × quantity of one order
+	MaxOrderQuantity float64 `json:"max_order_quantity"`
+	MaxOpenOrders    int     `json:"max_open_orders"` // Including the order being placed
+}
+
+// LedgerEntry is one side of a movement of an asset. Entries sharing a
+// reference sum to zero per asset.
+type LedgerEntry struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id,omitempty"` // 0 for system accounts
+	Account   string    `json:"account"`           // "user", or a system account such as "fees"
+	Asset     string    `json:"asset"`
+	Amount    float64   `json:"amount"` // Positive credits the account, negative debits it
+	Kind      string    `json:"kind"`   // "trade", "merge", "reward", "deposit", "withdrawal", or a lending movement such as "lend"
+	Reference string    `json:"reference"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Balance is the sum of a user's ledger entries in one asset
+type Balance struct {
+	Asset  string  `json:"asset"`
+	Amount float64 `json:"amount"`
+}
+
+// Transfer is a deposit of funds into a user's account, or a withdrawal out
+// of it. Transfers that need an admin's approval are pending until reviewed;
+// the ledger only changes once they complete.
+type Transfer struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Type        string     `json:"type"` // "deposit" or "withdrawal"
+	Asset       string     `json:"asset"`
+	Amount      float64    `json:"amount"`
+	Status      string     `json:"status"`                // "pending", "completed" or "rejected"
+	ReviewedBy  int        `json:"reviewed_by,omitempty"` // Admin who approved or rejected it
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Position is a user's holding of an instrument's base asset built up by
+// trading, with its profit and loss in the quote asset by the average cost
+// method. Deposits and withdrawals aren't part of it.
+type Position struct {
+	Symbol            string   `json:"symbol"`
+	Asset             string   `json:"asset"`
+	Quantity          float64  `json:"quantity"`            // Bought less sold; negative is short
+	AverageEntryPrice float64  `json:"average_entry_price"` // Of the open quantity; 0 when flat
+	MarkPrice         *float64 `json:"mark_price,omitempty"`
+	RealizedPnL       float64  `json:"realized_pnl"` // From closed quantity, net of fees
+	UnrealizedPnL     *float64 `json:"unrealized_pnl,omitempty"`
+	Fees              float64  `json:"fees"`
+}
+
+// OrderExposure is the quantity a user's open orders on one side of an
+// instrument could still trade
+type OrderExposure struct {
+	Symbol   string  `json:"symbol"`
+	Side     string  `json:"side"` // "buy" or "sell"
+	Orders   int     `json:"orders"`
+	Quantity float64 `json:"quantity"` // Unfilled
+	Notional float64 `json:"notional"` // Unfilled quantity × price, in the quote asset
+}
+
+// BalanceSnapshot is a user's balance in one asset at a point in time, for
+// time-weighting balances
+type BalanceSnapshot struct {
+	UserID  int       `json:"user_id"`
+	Asset   string    `json:"asset"`
+	Amount  float64   `json:"amount"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// RewardAccrual is a reward credited to a user for holding a balance over
+// one accrual period
+type RewardAccrual struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"-"`
+	Asset          string    `json:"asset"`        // Asset whose balance earned the reward
+	PayoutAsset    string    `json:"payout_asset"` // Asset the reward was credited in
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	AverageBalance float64   `json:"average_balance"` // Time-weighted over the period
+	Rate           float64   `json:"rate"`            // Per year
+	Amount         float64   `json:"amount"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// LendingPosition is a user's stake in the lending pool of an asset: what
+// they've lent to it and what they owe it, each including interest
+type LendingPosition struct {
+	UserID          int       `json:"-"`
+	Asset           string    `json:"asset"`
+	Supplied        float64   `json:"supplied"`         // Lent, plus interest earned, which can be withdrawn
+	Borrowed        float64   `json:"borrowed"`         // Owed, plus interest accrued, which is repaid
+	InterestEarned  float64   `json:"interest_earned"`  // All interest earned by lending
+	InterestCharged float64   `json:"interest_charged"` // All interest accrued on borrowing
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// LendingPool is the state of the lending pool of an asset
+type LendingPool struct {
+	Asset    string  `json:"asset"`
+	Supplied float64 `json:"supplied"` // Lent by all lenders
+	Borrowed float64 `json:"borrowed"` // Owed by all borrowers
+}
+
+// LendingMovement is a user lending to or withdrawing from the lending pool
+// of an asset, or borrowing from or repaying it
+type LendingMovement struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	Asset     string    `json:"asset"`
+	Kind      string    `json:"kind"` // "lend", "redeem", "borrow" or "repay"
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UsernameChange records a user renaming their account
+type UsernameChange struct {
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// ImpersonationSession is an admin viewing a user's account as the user
+// sees it, with the user's consent, and the requests made while doing so
+type ImpersonationSession struct {
+	ID        int                    `json:"id"`
+	AdminID   int                    `json:"admin_id"`
+	UserID    int                    `json:"user_id"`
+	Reason    string                 `json:"reason"`
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	Requests  []ImpersonationRequest `json:"requests"`
+}
+
+// ImpersonationRequest is a request made with an impersonation token
+type ImpersonationRequest struct {
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// AccountMerge records a duplicate account being folded into another
+type AccountMerge struct {
+	ID           int       `json:"id"`
+	SourceUserID int       `json:"source_user_id"`
+	TargetUserID int       `json:"target_user_id"`
+	OrdersMoved  int       `json:"orders_moved"`
+	Balances     []Balance `json:"balances_moved"`
+	MergedAt     time.Time `json:"merged_at"`
+}
+
+// AccountingTrade is a finalized trade as reported to back-office systems,
+// with both owners and fees
+type AccountingTrade struct {
+	ID          int       `json:"id"`
+	Symbol      string    `json:"symbol"`
+	BuyOrderID  int       `json:"buy_order_id"`
+	SellOrderID int       `json:"sell_order_id"`
+	BuyUserID   int       `json:"buy_user_id"`
+	SellUserID  int       `json:"sell_user_id"`
 	Price       float64   `json:"price"`
 	Quantity    float64   `json:"quantity"`
+	BuyFee      float64   `json:"buy_fee"`
+	SellFee     float64   `json:"sell_fee"`
+	TakerSide   string    `json:"taker_side"`
 	ExecutedAt  time.Time `json:"executed_at"`
 }
+
+// ReportedTrade is a trade as reported to regulators, with both accounts
+type ReportedTrade struct {
+	AccountingTrade
+	BuyUsername  string `json:"buy_username"`
+	SellUsername string `json:"sell_username"`
+}
+
+// TradeReport is a daily trade report written to the reporting destination
+type TradeReport struct {
+	Day         string    `json:"day"`  // UTC date, e.g. "2024-01-01"
+	Name        string    `json:"name"` // File name at the destination
+	Trades      int       `json:"trades"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Settlement is the official price of an instrument at the end of a UTC
+// day, which statements value balances at
+type Settlement struct {
+	Symbol       string    `json:"symbol"`
+	Day          string    `json:"day"` // UTC date, e.g. "2024-01-01"
+	Price        float64   `json:"price"`
+	Method       string    `json:"method"` // "vwap", "last_trade" or "previous"
+	Volume       float64   `json:"volume"` // Quantity the price was calculated from
+	Trades       int       `json:"trades"` // Number of trades the price was calculated from
+	CalculatedAt time.Time `json:"calculated_at"`
+}
+
+// IndexPrice is an instrument's reference price on an external feed
+type IndexPrice struct {
+	Symbol     string    `json:"symbol"`
+	Source     string    `json:"source"` // Feed the price came from, e.g. "coinbase"
+	Price      float64   `json:"price"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// SurveillanceAlert flags an account whose trading in an hour looks
+// abusive, for an admin to look into
+type SurveillanceAlert struct {
+	ID          int                `json:"id"`
+	UserID      int                `json:"user_id"`
+	Username    string             `json:"username"`
+	Kind        string             `json:"kind"`             // "self_trade", "order_churn" or "price_ramp"
+	Symbol      string             `json:"symbol,omitempty"` // Empty for alerts across markets
+	Hour        time.Time          `json:"hour"`             // Start of the hour the activity was in
+	Description string             `json:"description"`
+	Details     map[string]float64 `json:"details"` // The measurements that raised the alert
+	Status      string             `json:"status"`  // "open" or "resolved"
+	Note        string             `json:"note,omitempty"`
+	ResolvedBy  *int               `json:"resolved_by,omitempty"`
+	ResolvedAt  *time.Time         `json:"resolved_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// OrderChurn is how much a user placed, quickly canceled and amended
+// orders in a period
+type OrderChurn struct {
+	UserID       int
+	Placed       int
+	QuickCancels int // Canceled by the user soon after they were placed
+	Amends       int
+}
+
+// UserCounts is how many users the exchange has
+type UserCounts struct {
+	Total     int `json:"total"`
+	New       int `json:"new_24h"`    // Registered in the last 24 hours
+	Traded    int `json:"traded_24h"` // Traded in the last 24 hours, as of the top traders
+	Suspended int `json:"suspended"`
+}
+
+// MarketOverview is one market's open orders and last 24 hours of trading
+type MarketOverview struct {
+	Symbol     string  `json:"symbol"`
+	OpenOrders int     `json:"open_orders"`
+	OpenBuys   int     `json:"open_buys"`
+	OpenSells  int     `json:"open_sells"`
+	Trades     int     `json:"trades_24h"`
+	Volume     float64 `json:"volume_24h"`   // Base quantity traded
+	Notional   float64 `json:"notional_24h"` // Quote value traded
+}
+
+// TraderVolume is one user's trading over the last 24 hours. Both sides of
+// a self-trade count.
+type TraderVolume struct {
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	Trades   int     `json:"trades"`
+	Volume   float64 `json:"volume"`
+	Notional float64 `json:"notional"`
+}
+
+// MarketStatsHour is one market's trading in an hour
+type MarketStatsHour struct {
+	Symbol   string    `json:"symbol"`
+	Hour     time.Time `json:"hour"` // Start of the hour, UTC
+	Trades   int       `json:"trades"`
+	Volume   float64   `json:"volume"`   // Base quantity traded
+	Notional float64   `json:"notional"` // Quote value traded
+}
+
+// Statement is a user's account statement for a UTC day: the trades they
+// made and the fees they paid that day, and their balances at its end valued
+// at the day's settlement prices
+type Statement struct {
+	UserID      int                `json:"-"`
+	Day         string             `json:"day"`    // UTC date, e.g. "2024-01-01"
+	Trades      []UserTrade        `json:"trades"` // Oldest first
+	Fees        []Balance          `json:"fees"`   // Fees paid, by asset
+	Balances    []StatementBalance `json:"balances"`
+	Value       float64            `json:"value"`       // Total of the valued balances
+	ValueAsset  string             `json:"value_asset"` // Asset values are in, e.g. "USD"
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// StatementBalance is a balance on a statement. Price and value are omitted
+// for assets without a settlement price that day.
+type StatementBalance struct {
+	Amount float64  `json:"amount"`
+	Asset  string   `json:"asset"`
+	Price  *float64 `json:"price,omitempty"`
+	Value  *float64 `json:"value,omitempty"`
+}
+
+// AccountingBatch is a batch of trades and ledger entries delivered to
+// back-office systems. Every trade and entry appears in exactly one batch.
+type AccountingBatch struct {
+	ID            int               `json:"batch_id"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Trades        []AccountingTrade `json:"trades"`
+	LedgerEntries []LedgerEntry     `json:"ledger_entries"`
+}
+
+// AuditEntry is a recorded change to an order or trade, with who made it
+// and from where
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	ActorID    int                    `json:"actor_id,omitempty"` // Zero for the engine and the system
+	Source     string                 `json:"source"`             // "api", "grpc", "admin", "engine" or "system"
+	SourceIP   string                 `json:"source_ip,omitempty"`
+	Action     string                 `json:"action"`      // e.g. "order.created", "order.canceled" or "trade.executed"
+	EntityType string                 `json:"entity_type"` // "order" or "trade"
+	EntityID   int                    `json:"entity_id"`
+	Before     map[string]interface{} `json:"before"` // Nil when the entity was created
+	After      map[string]interface{} `json:"after"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
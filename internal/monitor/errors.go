@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// errorBuckets is how many minutes of responses are kept, enough for the
+// long window
+const errorBuckets = int(LongWindow / time.Minute)
+
+// errorBucket counts the responses sent in one minute
+type errorBucket struct {
+	minute       int64 // Minutes since the Unix epoch
+	requests     int
+	clientErrors int
+	serverErrors int
+}
+
+// ErrorWindow summarises responses over a rolling window
+type ErrorWindow struct {
+	Window       string `json:"window"`
+	Requests     int    `json:"requests"`
+	ClientErrors int    `json:"client_errors"` // 4xx responses
+	ServerErrors int    `json:"server_errors"` // 5xx responses
+	// ErrorRate is the fraction of requests answered with a 5xx. Client
+	// errors are the client's fault, so they don't count.
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ErrorMonitor counts HTTP responses by the minute to report error rates
+type ErrorMonitor struct {
+	mu      sync.Mutex
+	buckets [errorBuckets]errorBucket
+}
+
+// NewErrorMonitor creates a monitor with no responses counted
+func NewErrorMonitor() *ErrorMonitor {
+	return &ErrorMonitor{}
+}
+
+// Record counts a response with status sent at now
+func (m *ErrorMonitor) Record(status int, now time.Time) {
+	minute := now.Unix() / 60
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &m.buckets[minute%int64(errorBuckets)]
+	if b.minute != minute {
+		*b = errorBucket{minute: minute}
+	}
+	b.requests++
+	switch {
+	case status >= 500:
+		b.serverErrors++
+	case status >= 400:
+		b.clientErrors++
+	}
+}
+
+// Status returns the responses over the short and long windows ending at
+// now. Windows are whole minutes, so include up to a minute more.
+func (m *ErrorMonitor) Status(now time.Time) []ErrorWindow {
+	minute := now.Unix() / 60
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	windows := []ErrorWindow{{Window: "5m"}, {Window: "1h"}}
+	for i, span := range []time.Duration{ShortWindow, LongWindow} {
+		w := &windows[i]
+		for _, b := range m.buckets {
+			if b.minute > minute-int64(span/time.Minute) && b.minute <= minute {
+				w.Requests += b.requests
+				w.ClientErrors += b.clientErrors
+				w.ServerErrors += b.serverErrors
+			}
+		}
+		if w.Requests > 0 {
+			w.ErrorRate = float64(w.ServerErrors) / float64(w.Requests)
+		}
+	}
+	return windows
+}
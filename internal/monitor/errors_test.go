@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorMonitor_Status(t *testing.T) {
+	m := NewErrorMonitor()
+	now := time.Date(2024, 1, 2, 3, 4, 30, 0, time.UTC)
+
+	// Half an hour ago only counts towards the long window
+	m.Record(500, now.Add(-30*time.Minute))
+	m.Record(200, now.Add(-30*time.Minute))
+	for i := 0; i < 8; i++ {
+		m.Record(200, now.Add(-time.Minute))
+	}
+	m.Record(404, now)
+	m.Record(503, now)
+
+	status := m.Status(now)
+	short, long := status[0], status[1]
+	if short.Window != "5m" || short.Requests != 10 || short.ClientErrors != 1 || short.ServerErrors != 1 || short.ErrorRate != 0.1 {
+		t.Errorf("unexpected short window %+v", short)
+	}
+	if long.Window != "1h" || long.Requests != 12 || long.ServerErrors != 2 {
+		t.Errorf("unexpected long window %+v", long)
+	}
+
+	// A minute's bucket is reused an hour later
+	m.Record(200, now.Add(30*time.Minute))
+	status = m.Status(now.Add(30 * time.Minute))
+	if long := status[1]; long.Requests != 11 || long.ServerErrors != 1 {
+		t.Errorf("expected the first responses to have left the long window, got %+v", long)
+	}
+	status = m.Status(now.Add(2 * time.Hour))
+	if status[1].Requests != 0 || status[1].ErrorRate != 0 {
+		t.Errorf("expected every response to have aged out, got %+v", status[1])
+	}
+}
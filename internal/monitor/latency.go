@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AckLatencyAlert names the alert raised when order acknowledgement latency breaches its SLO
+const AckLatencyAlert = "order_ack_latency"
+
+// Windows over which latency is summarised. The short window decides when
+// the alert fires; the long window shows whether the breach is sustained.
+const (
+	ShortWindow = 5 * time.Minute
+	LongWindow  = time.Hour
+)
+
+// maxSamples bounds the memory used by the long window; the oldest samples
+// are dropped first under sustained load
+const maxSamples = 200000
+
+// latencySample is one order's acknowledgement latency
+type latencySample struct {
+	latency time.Duration
+	at      time.Time
+}
+
+// WindowStatus summarises latency over a rolling window
+type WindowStatus struct {
+	Window        string  `json:"window"`
+	Count         int     `json:"count"`
+	P50Ms         float64 `json:"p50_ms"`
+	P99Ms         float64 `json:"p99_ms"`
+	MaxMs         float64 `json:"max_ms"`
+	OverThreshold int     `json:"over_threshold"`
+	// BurnRate is the fraction of orders slower than the threshold divided
+	// by the error budget (1 - objective). Above 1 the budget runs out
+	// before the window does.
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// LatencyStatus is the current SLO state
+type LatencyStatus struct {
+	ThresholdMs float64        `json:"threshold_ms"`
+	Objective   float64        `json:"objective"`
+	Alerting    bool           `json:"alerting"`
+	LastAlertAt *time.Time     `json:"last_alert_at,omitempty"`
+	Windows     []WindowStatus `json:"windows"`
+}
+
+// LatencyMonitor tracks the time from HTTP receipt to matching engine
+// acknowledgement for each order, and alerts when the short-window p99
+// exceeds the threshold.
+type LatencyMonitor struct {
+	mu          sync.Mutex
+	threshold   time.Duration
+	objective   float64 // Fraction of orders that must be acknowledged within threshold
+	samples     []latencySample
+	notifier    Notifier
+	alerting    bool
+	lastAlertAt time.Time
+}
+
+// NewLatencyMonitor creates a monitor for a p99 threshold and objective
+func NewLatencyMonitor(threshold time.Duration, objective float64, notifier Notifier) *LatencyMonitor {
+	return &LatencyMonitor{threshold: threshold, objective: objective, notifier: notifier}
+}
+
+// SetThreshold changes the latency threshold
+func (m *LatencyMonitor) SetThreshold(threshold time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.threshold = threshold
+}
+
+// SetNotifier changes where alerts are delivered
+func (m *LatencyMonitor) SetNotifier(notifier Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
+// Record adds an order's acknowledgement latency observed at now
+func (m *LatencyMonitor) Record(latency time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, latencySample{latency: latency, at: now})
+	m.evict(now)
+}
+
+// evict drops samples older than the long window or beyond maxSamples;
+// callers must hold m.mu
+func (m *LatencyMonitor) evict(now time.Time) {
+	m.samples = evictBefore(m.samples, now.Add(-LongWindow), maxSamples)
+}
+
+// summarise computes the status of one window; callers must hold m.mu
+func (m *LatencyMonitor) summarise(name string, window time.Duration, now time.Time) WindowStatus {
+	cutoff := now.Add(-window)
+	start := sort.Search(len(m.samples), func(i int) bool { return m.samples[i].at.After(cutoff) })
+
+	latencies := make([]time.Duration, 0, len(m.samples)-start)
+	status := WindowStatus{Window: name}
+	for _, s := range m.samples[start:] {
+		latencies = append(latencies, s.latency)
+		if s.latency > m.threshold {
+			status.OverThreshold++
+		}
+	}
+	status.Count = len(latencies)
+	if status.Count == 0 {
+		return status
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	status.P50Ms = milliseconds(percentile(latencies, 0.50))
+	status.P99Ms = milliseconds(percentile(latencies, 0.99))
+	status.MaxMs = milliseconds(latencies[len(latencies)-1])
+	if budget := 1 - m.objective; budget > 0 {
+		status.BurnRate = float64(status.OverThreshold) / float64(status.Count) / budget
+	}
+	return status
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Status returns the SLO state at now
+func (m *LatencyMonitor) Status(now time.Time) LatencyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evict(now)
+
+	status := LatencyStatus{
+		ThresholdMs: milliseconds(m.threshold),
+		Objective:   m.objective,
+		Alerting:    m.alerting,
+		Windows: []WindowStatus{
+			m.summarise("5m", ShortWindow, now),
+			m.summarise("1h", LongWindow, now),
+		},
+	}
+	if !m.lastAlertAt.IsZero() {
+		lastAlertAt := m.lastAlertAt
+		status.LastAlertAt = &lastAlertAt
+	}
+	return status
+}
+
+// Evaluate checks the short-window p99 against the threshold and notifies
+// when the alert starts firing or resolves
+func (m *LatencyMonitor) Evaluate(now time.Time) {
+	m.mu.Lock()
+	m.evict(now)
+	short := m.summarise("5m", ShortWindow, now)
+	breached := short.Count > 0 && short.P99Ms > milliseconds(m.threshold)
+	if breached == m.alerting {
+		m.mu.Unlock()
+		return
+	}
+	m.alerting = breached
+	if breached {
+		m.lastAlertAt = now
+	}
+	notifier := m.notifier
+	threshold := m.threshold
+	m.mu.Unlock()
+
+	alert := Alert{Name: AckLatencyAlert, Firing: breached, RaisedAt: now}
+	if breached {
+		alert.Message = fmt.Sprintf("order ack p99 %.1fms exceeds %s over the last 5m (burn rate %.1f)", short.P99Ms, threshold, short.BurnRate)
+	} else {
+		alert.Message = fmt.Sprintf("order ack p99 back within %s", threshold)
+	}
+	if notifier != nil {
+		if err := notifier.Notify(alert); err != nil {
+			log.Printf("Failed to send alert: %v", err)
+		}
+	}
+}
+
+// Run evaluates the SLO every interval until ctx is done
+func (m *LatencyMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Evaluate(now)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the alerts it receives
+type recordingNotifier struct {
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Notify(alert Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestLatencyMonitor_Status(t *testing.T) {
+	m := NewLatencyMonitor(50*time.Millisecond, 0.99, nil)
+	now := time.Now()
+
+	// An old sample only counts towards the long window
+	m.Record(time.Second, now.Add(-30*time.Minute))
+	// 100 recent orders at 0.5..50ms, all within the threshold
+	for i := 1; i <= 100; i++ {
+		m.Record(time.Duration(i)*time.Millisecond/2, now.Add(-time.Minute))
+	}
+
+	status := m.Status(now)
+	short, long := status.Windows[0], status.Windows[1]
+	if short.Count != 100 || long.Count != 101 {
+		t.Fatalf("expected 100 and 101 samples, got %d and %d", short.Count, long.Count)
+	}
+	if short.P99Ms != 49.5 {
+		t.Errorf("expected p99 49.5ms, got %v", short.P99Ms)
+	}
+	if short.P50Ms != 25 {
+		t.Errorf("expected p50 25ms, got %v", short.P50Ms)
+	}
+	if short.OverThreshold != 0 || long.OverThreshold != 1 {
+		t.Errorf("expected 0 and 1 slow orders, got %d and %d", short.OverThreshold, long.OverThreshold)
+	}
+	if long.MaxMs != 1000 {
+		t.Errorf("expected max 1000ms, got %v", long.MaxMs)
+	}
+
+	// Samples age out of the long window
+	status = m.Status(now.Add(2 * time.Hour))
+	if status.Windows[1].Count != 0 {
+		t.Errorf("expected samples to be evicted, got %d", status.Windows[1].Count)
+	}
+}
+
+func TestLatencyMonitor_Evaluate(t *testing.T) {
+	notifier := &recordingNotifier{}
+	m := NewLatencyMonitor(10*time.Millisecond, 0.99, notifier)
+	now := time.Now()
+
+	for i := 0; i < 95; i++ {
+		m.Record(time.Millisecond, now)
+	}
+	m.Evaluate(now)
+	if len(notifier.alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", notifier.alerts)
+	}
+
+	// 5% slow orders push p99 over the threshold
+	for i := 0; i < 5; i++ {
+		m.Record(20*time.Millisecond, now)
+	}
+	m.Evaluate(now)
+	m.Evaluate(now) // Still firing; not notified again
+	if len(notifier.alerts) != 1 || !notifier.alerts[0].Firing {
+		t.Fatalf("expected one firing alert, got %v", notifier.alerts)
+	}
+	status := m.Status(now)
+	if !status.Alerting || status.LastAlertAt == nil {
+		t.Errorf("expected status to show the alert")
+	}
+	if math.Abs(status.Windows[0].BurnRate-5) > 1e-9 {
+		t.Errorf("expected burn rate 5, got %v", status.Windows[0].BurnRate)
+	}
+
+	// Once the slow orders leave the short window the alert resolves
+	later := now.Add(ShortWindow + time.Second)
+	m.Record(time.Millisecond, later)
+	m.Evaluate(later)
+	if len(notifier.alerts) != 2 || notifier.alerts[1].Firing {
+		t.Fatalf("expected a resolved alert, got %v", notifier.alerts)
+	}
+}
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Alert is an operational notification raised by a monitor
+type Alert struct {
+	Name     string    `json:"name"`
+	Firing   bool      `json:"firing"` // False when the condition has resolved
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+// Notifier delivers alerts to operators
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// LogNotifier writes alerts to the server log
+type LogNotifier struct{}
+
+// Notify logs the alert
+func (LogNotifier) Notify(alert Alert) error {
+	state := "RESOLVED"
+	if alert.Firing {
+		state = "FIRING"
+	}
+	log.Printf("ALERT %s [%s]: %s", alert.Name, state, alert.Message)
+	return nil
+}
+
+// WebhookNotifier posts alerts as JSON to a URL, e.g. a chat or paging webhook
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier posting to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Notify posts the alert to the webhook
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MultiNotifier sends alerts to several notifiers
+type MultiNotifier []Notifier
+
+// Notify delivers the alert to every notifier, returning the first error
+func (m MultiNotifier) Notify(alert Alert) error {
+	var firstErr error
+	for _, n := range m {
+		if err := n.Notify(alert); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stages an order passes through between HTTP receipt and its match being
+// recorded. Accept and match together make up the acknowledgement latency.
+const (
+	StageAccept  = "accept"  // Receipt until the order is saved and journaled
+	StageMatch   = "match"   // Waiting for and running the matching engine
+	StagePersist = "persist" // Recording the match's trades and order updates
+)
+
+// Stages lists the stages in the order an order passes through them
+var Stages = []string{StageAccept, StageMatch, StagePersist}
+
+// maxStageSamples bounds the memory each stage uses
+const maxStageSamples = 50000
+
+// StageStatus summarises one stage's latency over the short window
+type StageStatus struct {
+	Stage  string  `json:"stage"`
+	Count  int     `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	// Share is the fraction of the time spent across all stages that was
+	// spent in this one
+	Share float64 `json:"share"`
+	// BudgetShare is the stage's p99 as a fraction of the acknowledgement
+	// latency threshold
+	BudgetShare float64 `json:"budget_share"`
+}
+
+// StageBreakdown shows where order latency went over a window
+type StageBreakdown struct {
+	Window      string        `json:"window"`
+	ThresholdMs float64       `json:"threshold_ms"`
+	Stages      []StageStatus `json:"stages"`
+}
+
+// StageMonitor times each stage of order handling so operators can see
+// which one a slow acknowledgement spent its time in
+type StageMonitor struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	samples   map[string][]latencySample
+}
+
+// NewStageMonitor creates a monitor that budgets stages against the
+// acknowledgement latency threshold
+func NewStageMonitor(threshold time.Duration) *StageMonitor {
+	return &StageMonitor{threshold: threshold, samples: make(map[string][]latencySample)}
+}
+
+// SetThreshold changes the latency threshold stages are budgeted against
+func (m *StageMonitor) SetThreshold(threshold time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.threshold = threshold
+}
+
+// Record adds the time one order spent in a stage, observed at now
+func (m *StageMonitor) Record(stage string, latency time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples[stage] = evictBefore(append(m.samples[stage], latencySample{latency: latency, at: now}), now.Add(-ShortWindow), maxStageSamples)
+}
+
+// evictBefore drops samples at or before cutoff and the oldest beyond max
+func evictBefore(samples []latencySample, cutoff time.Time, max int) []latencySample {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(cutoff) })
+	if over := len(samples) - max; over > i {
+		i = over
+	}
+	if i > 0 {
+		samples = append(samples[:0], samples[i:]...)
+	}
+	return samples
+}
+
+// Status returns the breakdown over the short window ending at now
+func (m *StageMonitor) Status(now time.Time) StageBreakdown {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	breakdown := StageBreakdown{Window: "5m", ThresholdMs: milliseconds(m.threshold)}
+	var total time.Duration
+	totals := make([]time.Duration, len(Stages))
+	for i, stage := range Stages {
+		m.samples[stage] = evictBefore(m.samples[stage], now.Add(-ShortWindow), maxStageSamples)
+		samples := m.samples[stage]
+
+		status := StageStatus{Stage: stage, Count: len(samples)}
+		if len(samples) > 0 {
+			latencies := make([]time.Duration, len(samples))
+			for j, s := range samples {
+				latencies[j] = s.latency
+				totals[i] += s.latency
+			}
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			status.MeanMs = milliseconds(totals[i]) / float64(len(samples))
+			status.P50Ms = milliseconds(percentile(latencies, 0.50))
+			status.P99Ms = milliseconds(percentile(latencies, 0.99))
+			status.MaxMs = milliseconds(latencies[len(latencies)-1])
+			if m.threshold > 0 {
+				status.BudgetShare = status.P99Ms / milliseconds(m.threshold)
+			}
+		}
+		total += totals[i]
+		breakdown.Stages = append(breakdown.Stages, status)
+	}
+	if total > 0 {
+		for i := range breakdown.Stages {
+			breakdown.Stages[i].Share = float64(totals[i]) / float64(total)
+		}
+	}
+	return breakdown
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStageMonitor_Status(t *testing.T) {
+	m := NewStageMonitor(10 * time.Millisecond)
+	now := time.Now()
+
+	// An old sample has left the window
+	m.Record(StageMatch, time.Second, now.Add(-10*time.Minute))
+	for i := 0; i < 10; i++ {
+		m.Record(StageAccept, time.Millisecond, now.Add(-time.Minute))
+		m.Record(StageMatch, 2*time.Millisecond, now.Add(-time.Minute))
+		m.Record(StagePersist, 5*time.Millisecond, now.Add(-time.Minute))
+	}
+
+	status := m.Status(now)
+	if len(status.Stages) != 3 {
+		t.Fatalf("expected 3 stages, got %d", len(status.Stages))
+	}
+	accept, match, persist := status.Stages[0], status.Stages[1], status.Stages[2]
+	if accept.Stage != StageAccept || match.Stage != StageMatch || persist.Stage != StagePersist {
+		t.Fatalf("expected stages in order, got %+v", status.Stages)
+	}
+	if match.Count != 10 || match.MaxMs != 2 {
+		t.Errorf("expected 10 match samples up to 2ms, got %d up to %vms", match.Count, match.MaxMs)
+	}
+	if persist.Share != 0.625 {
+		t.Errorf("expected persist to take 0.625 of the time, got %v", persist.Share)
+	}
+	if persist.BudgetShare != 0.5 {
+		t.Errorf("expected persist p99 to use half the budget, got %v", persist.BudgetShare)
+	}
+
+	// Every sample ages out
+	status = m.Status(now.Add(time.Hour))
+	for _, stage := range status.Stages {
+		if stage.Count != 0 || stage.Share != 0 {
+			t.Errorf("expected %s to be empty, got %+v", stage.Stage, stage)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxBackoff bounds the wait between attempts to reconnect to the broker
+const maxBackoff = time.Minute
+
+// Bridge publishes the latest message for each topic to a broker, retained
+// so a display that subscribes later gets the current values at once.
+// Messages queued faster than they are sent are conflated, and unchanged
+// messages aren't sent again.
+type Bridge struct {
+	Client *Client
+	Prefix string // Prepended to every topic, e.g. "exchange"
+
+	mu     sync.Mutex
+	latest map[string][]byte // Latest message for each topic
+	dirty  map[string]bool   // Topics whose latest message hasn't been sent
+	ready  chan struct{}
+}
+
+// NewBridge creates a bridge publishing through client under prefix
+func NewBridge(client *Client, prefix string) *Bridge {
+	return &Bridge{
+		Client: client,
+		Prefix: prefix,
+		latest: make(map[string][]byte),
+		dirty:  make(map[string]bool),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Topic returns the full topic for a path under the bridge's prefix
+func (b *Bridge) Topic(path string) string {
+	if b.Prefix == "" {
+		return path
+	}
+	return b.Prefix + "/" + path
+}
+
+// Publish queues v, encoded as JSON, for the topic at path, replacing any
+// message still queued for it. It never blocks on the broker, so it can be
+// called from event handlers on the matching path.
+func (b *Bridge) Publish(path string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to marshal MQTT message for %s: %v", path, err)
+		return
+	}
+	topic := b.Topic(path)
+
+	b.mu.Lock()
+	if bytes.Equal(b.latest[topic], data) {
+		b.mu.Unlock()
+		return
+	}
+	b.latest[topic] = data
+	b.dirty[topic] = true
+	b.mu.Unlock()
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Run connects to the broker and sends queued messages until ctx is done,
+// reconnecting with backoff when the connection fails. After reconnecting,
+// the latest message for every topic is sent again.
+func (b *Bridge) Run(ctx context.Context) {
+	defer b.Client.Close()
+	ping := time.NewTicker(b.Client.KeepAlive / 2)
+	defer ping.Stop()
+
+	backoff := time.Second
+	for {
+		if !b.Client.Connected() {
+			if err := b.Client.Connect(ctx); err != nil {
+				log.Printf("Failed to connect to MQTT broker: %v", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, maxBackoff)
+				continue
+			}
+			backoff = time.Second
+			log.Printf("Connected to MQTT broker %s", b.Client.Addr)
+			b.markAllDirty()
+			b.logFlush()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.ready:
+			b.logFlush()
+		case <-ping.C:
+			if err := b.Client.Ping(); err != nil {
+				log.Printf("Failed to ping MQTT broker: %v", err)
+			}
+		}
+	}
+}
+
+// Flush sends the latest message of each topic not yet sent, in topic
+// order. Topics that fail to send stay queued.
+func (b *Bridge) Flush() error {
+	b.mu.Lock()
+	topics := make([]string, 0, len(b.dirty))
+	for topic := range b.dirty {
+		topics = append(topics, topic)
+	}
+	b.mu.Unlock()
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		b.mu.Lock()
+		data := b.latest[topic]
+		delete(b.dirty, topic)
+		b.mu.Unlock()
+
+		if err := b.Client.Publish(topic, data, true); err != nil {
+			b.mu.Lock()
+			b.dirty[topic] = true
+			b.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// logFlush flushes, logging failures; Run reconnects on its next pass
+func (b *Bridge) logFlush() {
+	if err := b.Flush(); err != nil {
+		log.Printf("Failed to publish to MQTT broker: %v", err)
+	}
+}
+
+// markAllDirty queues the latest message of every topic to be sent again
+func (b *Bridge) markAllDirty() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for topic := range b.latest {
+		b.dirty[topic] = true
+	}
+}
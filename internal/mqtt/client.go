@@ -0,0 +1,243 @@
+// Package mqtt publishes market data to an MQTT broker, so hardware tickers
+// and lightweight dashboards can subscribe without speaking the exchange's
+// WebSocket protocol.
+//
+// The client implements just enough of MQTT 3.1.1 to publish: it connects,
+// publishes at QoS 0 and keeps the connection alive. It never subscribes.
+package mqtt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Control packet types, shifted into the high nibble of the first byte
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetPingreq    = 12 << 4
+	packetDisconnect = 14 << 4
+)
+
+// Connect flags
+const (
+	flagCleanSession = 0x02
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// flagRetain asks the broker to keep a published message for future subscribers
+const flagRetain = 0x01
+
+// protocolLevel is MQTT 3.1.1
+const protocolLevel = 4
+
+// maxRemainingLength is the largest packet body MQTT can frame
+const maxRemainingLength = 268435455
+
+// ErrNotConnected is returned when publishing without a connection
+var ErrNotConnected = errors.New("not connected")
+
+// Client is a publish-only MQTT connection to one broker
+type Client struct {
+	Addr      string // host:port
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // Time the broker waits without a packet before dropping us
+	Timeout   time.Duration // Dial, handshake and write timeout
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewClient creates a client for a broker URL of the form
+// mqtt://[user:password@]host[:port]; "tcp" is accepted as a scheme too.
+// The port defaults to 1883.
+func NewClient(brokerURL, clientID string) (*Client, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker URL: %w", err)
+	}
+	if (u.Scheme != "mqtt" && u.Scheme != "tcp") || u.Hostname() == "" {
+		return nil, fmt.Errorf("broker URL must be mqtt://host[:port], got %q", brokerURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "1883"
+	}
+	c := &Client{
+		Addr:      net.JoinHostPort(u.Hostname(), port),
+		ClientID:  clientID,
+		KeepAlive: 30 * time.Second,
+		Timeout:   5 * time.Second,
+	}
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+	return c, nil
+}
+
+// Connect dials the broker and completes the MQTT handshake, replacing any
+// existing connection
+func (c *Client) Connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: c.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to dial broker: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := conn.Write(c.connectPacket()); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send connect: %w", err)
+	}
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read connack: %w", err)
+	}
+	if connack[0] != packetConnack || connack[1] != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected packet %#x from broker", connack[0])
+	}
+	if code := connack[3]; code != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection: return code %d", code)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+	c.mu.Unlock()
+
+	// Nothing is subscribed, so the broker only sends ping responses;
+	// discard them and notice when the connection drops
+	go func() {
+		io.Copy(io.Discard, conn)
+		c.drop(conn)
+	}()
+	return nil
+}
+
+// Connected reports whether the client has a connection
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Publish sends a message at QoS 0, retained by the broker if retain is set
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	header := byte(packetPublish)
+	if retain {
+		header |= flagRetain
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	if len(body) > maxRemainingLength {
+		return fmt.Errorf("message to %s too large", topic)
+	}
+	return c.write(packet(header, body))
+}
+
+// Ping keeps the connection alive while nothing is published
+func (c *Client) Ping() error {
+	return c.write([]byte{packetPingreq, 0})
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	err := c.write([]byte{packetDisconnect, 0})
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	return err
+}
+
+// write sends a packet, dropping the connection if it fails
+func (c *Client) write(p []byte) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	if _, err := conn.Write(p); err != nil {
+		c.drop(conn)
+		return fmt.Errorf("failed to write to broker: %w", err)
+	}
+	return nil
+}
+
+// drop closes conn and forgets it if it is still the current connection
+func (c *Client) drop(conn net.Conn) {
+	conn.Close()
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+}
+
+// connectPacket encodes a CONNECT with a clean session
+func (c *Client) connectPacket() []byte {
+	flags := byte(flagCleanSession)
+	if c.Username != "" {
+		flags |= flagUsername
+		if c.Password != "" {
+			flags |= flagPassword
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.KeepAlive/time.Second))
+	body = appendString(body, c.ClientID)
+	if flags&flagUsername != 0 {
+		body = appendString(body, c.Username)
+	}
+	if flags&flagPassword != 0 {
+		body = appendString(body, c.Password)
+	}
+	return packet(packetConnect, body)
+}
+
+// packet frames a body with a fixed header: the first byte, then the body
+// length as a variable-length integer
+func packet(header byte, body []byte) []byte {
+	p := append(make([]byte, 0, len(body)+5), header)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(p, body...)
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
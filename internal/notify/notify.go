@@ -0,0 +1,148 @@
+// Package notify alerts users to activity on their accounts: fills, GTD
+// orders canceled on expiry and logins from new IPs. Each notification is
+// sent through every configured Sender, unless the user has turned its kind
+// off in their notification preferences.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Kinds of notification, each of which users can turn off
+const (
+	KindFill     = "fill"
+	KindExpiry   = "expiry"
+	KindNewLogin = "new_login"
+)
+
+// queueSize bounds the notifications waiting to be sent. More are dropped
+// rather than hold up the event bus.
+const queueSize = 1024
+
+// Notification is a message to a user about their account
+type Notification struct {
+	UserID  int       `json:"user_id"`
+	Kind    string    `json:"kind"`
+	Email   string    `json:"email,omitempty"` // Where the user wants email sent, if anywhere
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Time    time.Time `json:"time"`
+}
+
+// PreferenceStore loads what users want to be notified of
+type PreferenceStore interface {
+	GetNotificationPreferences(ctx context.Context, userID int) (*models.NotificationPreferences, error)
+}
+
+// Notifier turns account events into notifications and sends them in the
+// background, so slow senders don't hold up whoever published the event
+type Notifier struct {
+	Prefs   PreferenceStore
+	Senders []Sender
+
+	queue chan Notification
+}
+
+// NewNotifier creates a notifier sending through senders to users who want
+// each notification, as prefs says
+func NewNotifier(prefs PreferenceStore, senders ...Sender) *Notifier {
+	return &Notifier{Prefs: prefs, Senders: senders, queue: make(chan Notification, queueSize)}
+}
+
+// Subscribe notifies users of the fills, expiries and logins published on bus
+func (n *Notifier) Subscribe(bus *events.Bus) {
+	bus.Subscribe(events.OrderUpdated, n.onOrderUpdate)
+	bus.Subscribe(events.UserLoggedIn, n.onLogin)
+}
+
+func (n *Notifier) onOrderUpdate(e events.Event) {
+	update, ok := e.Data.(models.OrderUpdate)
+	if !ok {
+		return
+	}
+	order := fmt.Sprintf("Your %s order %d for %g %s at %g", update.Side, update.OrderID, update.Quantity, update.Symbol, update.Price)
+	switch {
+	case update.Event == "filled":
+		n.Notify(Notification{UserID: update.UserID, Kind: KindFill, Time: update.Time,
+			Subject: fmt.Sprintf("Order %d filled", update.OrderID),
+			Body:    order + " has filled."})
+	case update.Event == "partially_filled":
+		n.Notify(Notification{UserID: update.UserID, Kind: KindFill, Time: update.Time,
+			Subject: fmt.Sprintf("Order %d partially filled", update.OrderID),
+			Body:    fmt.Sprintf("%s has filled %g of %g.", order, update.FilledQuantity, update.Quantity)})
+	case update.Event == "canceled" && update.Reason == "expired":
+		n.Notify(Notification{UserID: update.UserID, Kind: KindExpiry, Time: update.Time,
+			Subject: fmt.Sprintf("Order %d expired", update.OrderID),
+			Body:    fmt.Sprintf("%s expired and was canceled with %g filled.", order, update.FilledQuantity)})
+	}
+}
+
+func (n *Notifier) onLogin(e events.Event) {
+	login, ok := e.Data.(models.Login)
+	if !ok || !login.NewIP {
+		return
+	}
+	n.Notify(Notification{UserID: login.UserID, Kind: KindNewLogin, Time: login.CreatedAt,
+		Subject: "New login from " + login.IP,
+		Body: fmt.Sprintf("%s logged in from %s (%s), which hasn't been used with this account before. "+
+			"If this wasn't you, revoke the session and change your password.", login.Username, login.IP, login.UserAgent)})
+}
+
+// Notify queues a notification to be sent, dropping it if the queue is full
+func (n *Notifier) Notify(notification Notification) {
+	select {
+	case n.queue <- notification:
+	default:
+		log.Printf("Notification queue full; dropped %s notification for user %d", notification.Kind, notification.UserID)
+	}
+}
+
+// Run sends queued notifications until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			n.send(ctx, notification)
+		}
+	}
+}
+
+// send delivers a notification through every sender if the user wants it.
+// Failures are logged, as there's no one to report them to.
+func (n *Notifier) send(ctx context.Context, notification Notification) {
+	prefs, err := n.Prefs.GetNotificationPreferences(ctx, notification.UserID)
+	if err != nil {
+		log.Printf("Failed to load notification preferences of user %d: %v", notification.UserID, err)
+		return
+	}
+	if !wants(prefs, notification.Kind) {
+		return
+	}
+	notification.Email = prefs.Email
+	for _, sender := range n.Senders {
+		if err := sender.Send(ctx, notification); err != nil {
+			log.Printf("Failed to send %s notification to user %d: %v", notification.Kind, notification.UserID, err)
+		}
+	}
+}
+
+// wants reports whether prefs turn a kind of notification on
+func wants(prefs *models.NotificationPreferences, kind string) bool {
+	switch kind {
+	case KindFill:
+		return prefs.Fills
+	case KindExpiry:
+		return prefs.Expiries
+	case KindNewLogin:
+		return prefs.NewLogins
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// fakePrefs holds preferences in memory; users without any get everything
+type fakePrefs map[int]models.NotificationPreferences
+
+func (f fakePrefs) GetNotificationPreferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	prefs, ok := f[userID]
+	if !ok {
+		prefs = models.NotificationPreferences{Fills: true, Expiries: true, NewLogins: true}
+	}
+	return &prefs, nil
+}
+
+// recorder is a sender keeping what it's sent
+type recorder struct {
+	sent []Notification
+}
+
+func (r *recorder) Send(ctx context.Context, notification Notification) error {
+	r.sent = append(r.sent, notification)
+	return nil
+}
+
+// drain sends every queued notification
+func drain(n *Notifier) {
+	for {
+		select {
+		case notification := <-n.queue:
+			n.send(context.Background(), notification)
+		default:
+			return
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	sent := &recorder{}
+	n := NewNotifier(fakePrefs{
+		2: {Email: "bob@example.com", Fills: false, Expiries: true, NewLogins: true},
+	}, sent)
+	bus := events.NewBus()
+	n.Subscribe(bus)
+
+	update := func(userID int, event, reason string) {
+		bus.Publish(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{
+			Event: event, OrderID: 7, UserID: userID, Symbol: "BTC-USD", Side: "buy",
+			Price: 100, Quantity: 2, FilledQuantity: 0.5, Reason: reason,
+		}})
+	}
+	update(1, "partially_filled", "")
+	update(1, "canceled", "") // Canceled by the user, so nothing to tell them
+	update(1, "canceled", "expired")
+	update(1, "accepted", "")
+	update(2, "filled", "") // Bob turned fills off
+	update(2, "canceled", "expired")
+	bus.Publish(events.Event{Type: events.UserLoggedIn, Data: models.Login{Session: models.Session{UserID: 2, IP: "192.0.2.1"}, Username: "bob"}})
+	bus.Publish(events.Event{Type: events.UserLoggedIn, Data: models.Login{Session: models.Session{UserID: 2, IP: "198.51.100.7"}, Username: "bob", NewIP: true}})
+	drain(n)
+
+	var got []string
+	for _, notification := range sent.sent {
+		got = append(got, notification.Kind)
+	}
+	if strings.Join(got, ",") != "fill,expiry,expiry,new_login" {
+		t.Fatalf("unexpected notifications %v", got)
+	}
+	if body := sent.sent[0].Body; body != "Your buy order 7 for 2 BTC-USD at 100 has filled 0.5 of 2." {
+		t.Errorf("unexpected body %q", body)
+	}
+	if sent.sent[0].Email != "" || sent.sent[3].Email != "bob@example.com" {
+		t.Errorf("expected only bob's notifications addressed, got %q and %q", sent.sent[0].Email, sent.sent[3].Email)
+	}
+	if !strings.Contains(sent.sent[3].Body, "198.51.100.7") {
+		t.Errorf("expected the new IP in the body, got %q", sent.sent[3].Body)
+	}
+}
+
+func TestNotifier_QueueFull(t *testing.T) {
+	n := NewNotifier(fakePrefs{})
+	for i := 0; i < queueSize+1; i++ {
+		n.Notify(Notification{UserID: 1, Kind: KindFill})
+	}
+	if len(n.queue) != queueSize {
+		t.Errorf("expected the queue to stay at %d, got %d", queueSize, len(n.queue))
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var got Notification
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sender := NewWebhookSender(server.URL)
+	notification := Notification{UserID: 3, Kind: KindExpiry, Subject: "Order 9 expired", Time: time.Now().UTC().Truncate(time.Second)}
+	if err := sender.Send(context.Background(), notification); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != notification {
+		t.Errorf("expected %+v posted, got %+v", notification, got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sender.Send(context.Background(), notification); err == nil {
+		t.Error("expected an error for a 500, got nil")
+	}
+}
+
+func TestSMTPSender_Message(t *testing.T) {
+	sender := &SMTPSender{Addr: "localhost:25", From: "alerts@example.com"}
+	message := string(sender.message(Notification{
+		Email:   "alice@example.com",
+		Subject: "Order 7 filled — at last",
+		Body:    "Your order has filled.",
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}))
+	for _, want := range []string{
+		"From: alerts@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?Order_7_filled_=E2=80=94_at_last?=\r\n",
+		"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n",
+		"\r\n\r\nYour order has filled.\r\n",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("expected %q in message:\n%s", want, message)
+		}
+	}
+
+	// Users without an address aren't emailed
+	if err := sender.Send(context.Background(), Notification{Subject: "No address"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	if _, err := NewSender("smtp", SMTPSender{Addr: "localhost:25"}, ""); err == nil {
+		t.Error("expected an error for smtp without a from address")
+	}
+	if _, err := NewSender("webhook", SMTPSender{}, ""); err == nil {
+		t.Error("expected an error for a webhook without a URL")
+	}
+	if _, err := NewSender("sms", SMTPSender{}, ""); err == nil {
+		t.Error("expected an error for an unknown sender")
+	}
+	if sender, err := NewSender("log", SMTPSender{}, ""); err != nil || sender != (LogSender{}) {
+		t.Errorf("expected the log sender, got %v, %v", sender, err)
+	}
+}
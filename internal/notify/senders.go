@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers notifications over one channel
+type Sender interface {
+	Send(ctx context.Context, notification Notification) error
+}
+
+// NewSender returns the sender named "log", "smtp" or "webhook", the SMTP
+// sender configured as server and the webhook posting to webhookURL
+func NewSender(name string, server SMTPSender, webhookURL string) (Sender, error) {
+	switch name {
+	case "log":
+		return LogSender{}, nil
+	case "smtp":
+		if server.Addr == "" || server.From == "" {
+			return nil, fmt.Errorf("the smtp sender needs a server address and from address")
+		}
+		return &server, nil
+	case "webhook":
+		if webhookURL == "" {
+			return nil, fmt.Errorf("the webhook sender needs a URL")
+		}
+		return NewWebhookSender(webhookURL), nil
+	}
+	return nil, fmt.Errorf("unknown sender %q", name)
+}
+
+// LogSender writes notifications to the server log, for development
+type LogSender struct{}
+
+// Send logs the notification
+func (LogSender) Send(ctx context.Context, notification Notification) error {
+	log.Printf("Notification to user %d [%s]: %s: %s", notification.UserID, notification.Kind, notification.Subject, notification.Body)
+	return nil
+}
+
+// SMTPSender emails notifications to users who have given an address
+type SMTPSender struct {
+	Addr     string // The server's host:port
+	From     string // The address notifications are sent from
+	Username string // Authenticates with PLAIN auth if set; the server must offer TLS
+	Password string
+}
+
+// Send emails the notification, or does nothing if the user has no address
+func (s *SMTPSender) Send(ctx context.Context, notification Notification) error {
+	if notification.Email == "" {
+		return nil
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{notification.Email}, s.message(notification)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// message formats a notification as an email. Addresses are checked when
+// users save them, so only the subject needs encoding.
+func (s *SMTPSender) message(notification Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", notification.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", notification.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(notification.Body + "\r\n")
+	return []byte(b.String())
+}
+
+// WebhookSender posts notifications as JSON to a URL, e.g. a push
+// notification service, which delivers them to users itself
+type WebhookSender struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSender creates a sender posting to url
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Send posts the notification, failing unless the server replies with a 2xx
+// status
+func (s *WebhookSender) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
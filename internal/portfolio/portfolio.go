@@ -0,0 +1,79 @@
+// Package portfolio calculates a user's positions and their profit and loss
+// from the user's fills.
+//
+// Positions are kept by the average cost method: buying into a long
+// position, or selling into a short one, moves the average entry price
+// towards the fill's price, while trading against the position realizes the
+// difference between the fill's price and the average entry price on the
+// quantity closed. A fill larger than the position closes it and opens one
+// the other way at the fill's price. Fees are paid in the quote asset and
+// deducted from realized profit and loss.
+package portfolio
+
+import (
+	"math"
+	"sort"
+
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// epsilon is below the smallest quantity an order can have, so a position
+// within it of zero is flat
+const epsilon = 1e-9
+
+// Calculate returns the user's position in each instrument they have traded,
+// ordered by symbol, from their fills, oldest first. Positions in symbols
+// with a mark price are valued at it.
+func Calculate(fills []models.Fill, marks map[string]float64) []models.Position {
+	bySymbol := make(map[string]*models.Position)
+	for _, fill := range fills {
+		position, ok := bySymbol[fill.Symbol]
+		if !ok {
+			inst, _ := instruments.Lookup(fill.Symbol)
+			position = &models.Position{Symbol: fill.Symbol, Asset: inst.Base}
+			bySymbol[fill.Symbol] = position
+		}
+		apply(position, fill)
+	}
+
+	positions := make([]models.Position, 0, len(bySymbol))
+	for symbol, position := range bySymbol {
+		if mark, ok := marks[symbol]; ok {
+			unrealized := (mark - position.AverageEntryPrice) * position.Quantity
+			position.MarkPrice, position.UnrealizedPnL = &mark, &unrealized
+		}
+		positions = append(positions, *position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions
+}
+
+// apply adds a fill to a position
+func apply(position *models.Position, fill models.Fill) {
+	position.Fees += fill.Fee
+	position.RealizedPnL -= fill.Fee
+
+	quantity := fill.Quantity
+	if fill.Side == "sell" {
+		quantity = -quantity
+	}
+
+	// Close as much of the position as the fill trades against
+	if position.Quantity*quantity < 0 {
+		closed := math.Min(math.Abs(quantity), math.Abs(position.Quantity))
+		position.RealizedPnL += (fill.Price - position.AverageEntryPrice) * math.Copysign(closed, position.Quantity)
+		position.Quantity += math.Copysign(closed, quantity)
+		quantity -= math.Copysign(closed, quantity)
+	}
+	if math.Abs(position.Quantity) < epsilon {
+		position.Quantity, position.AverageEntryPrice = 0, 0
+	}
+
+	// Open or add to the position with the rest
+	if math.Abs(quantity) >= epsilon {
+		total := position.Quantity + quantity
+		position.AverageEntryPrice = (position.AverageEntryPrice*math.Abs(position.Quantity) + fill.Price*math.Abs(quantity)) / math.Abs(total)
+		position.Quantity = total
+	}
+}
@@ -0,0 +1,91 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func fill(side string, price, quantity, fee float64) models.Fill {
+	return models.Fill{Symbol: exchange.DefaultSymbol, Side: side, Price: price, Quantity: quantity, Fee: fee}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name           string
+		fills          []models.Fill
+		wantQuantity   float64
+		wantEntry      float64
+		wantRealized   float64
+		wantUnrealized float64 // At a mark of 120
+	}{
+		{
+			name:           "Long",
+			fills:          []models.Fill{fill("buy", 100, 1, 0), fill("buy", 110, 3, 0)},
+			wantQuantity:   4,
+			wantEntry:      107.5,
+			wantUnrealized: 50,
+		},
+		{
+			name:           "PartlyClosed",
+			fills:          []models.Fill{fill("buy", 100, 2, 0), fill("sell", 130, 0.5, 0)},
+			wantQuantity:   1.5,
+			wantEntry:      100,
+			wantRealized:   15,
+			wantUnrealized: 30,
+		},
+		{
+			name:         "ClosedWithFees",
+			fills:        []models.Fill{fill("buy", 100, 1, 0.2), fill("sell", 90, 1, 0.18)},
+			wantRealized: -10.38,
+		},
+		{
+			name:           "Short",
+			fills:          []models.Fill{fill("sell", 150, 2, 0), fill("buy", 140, 1, 0)},
+			wantQuantity:   -1,
+			wantEntry:      150,
+			wantRealized:   10,
+			wantUnrealized: 30,
+		},
+		{
+			name:           "Reversed",
+			fills:          []models.Fill{fill("buy", 100, 1, 0), fill("sell", 110, 3, 0)},
+			wantQuantity:   -2,
+			wantEntry:      110,
+			wantRealized:   10,
+			wantUnrealized: -20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions := Calculate(tt.fills, map[string]float64{exchange.DefaultSymbol: 120})
+			if len(positions) != 1 {
+				t.Fatalf("expected 1 position, got %d", len(positions))
+			}
+			p := positions[0]
+			if p.Asset != "BTC" || !near(p.Quantity, tt.wantQuantity) || !near(p.AverageEntryPrice, tt.wantEntry) || !near(p.RealizedPnL, tt.wantRealized) {
+				t.Errorf("unexpected position %+v", p)
+			}
+			if p.UnrealizedPnL == nil || !near(*p.UnrealizedPnL, tt.wantUnrealized) {
+				t.Errorf("expected unrealized PnL %g, got %v", tt.wantUnrealized, p.UnrealizedPnL)
+			}
+		})
+	}
+}
+
+func TestCalculate_NoMark(t *testing.T) {
+	positions := Calculate([]models.Fill{fill("buy", 100, 1, 0)}, nil)
+	if len(positions) != 1 || positions[0].MarkPrice != nil || positions[0].UnrealizedPnL != nil {
+		t.Errorf("expected a position without a valuation, got %+v", positions)
+	}
+	if positions := Calculate(nil, nil); len(positions) != 0 {
+		t.Errorf("expected no positions, got %+v", positions)
+	}
+}
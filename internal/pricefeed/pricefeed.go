@@ -0,0 +1,156 @@
+// Package pricefeed ingests index prices of the instruments from an
+// external feed.
+//
+// An Ingester polls a Source, a public price API or a file in development,
+// and records what it gets, so the sandbox can be seeded at realistic prices.
+// It keeps the latest price of each instrument for order entry to check
+// orders against: with a Band, orders priced too far from the index are
+// rejected, so a fat-fingered price can't trade far through the market.
+package pricefeed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Store records ingested prices and loads the latest
+type Store interface {
+	SaveIndexPrices(ctx context.Context, prices []models.IndexPrice) error
+	GetLatestIndexPrice(ctx context.Context, symbol string) (*models.IndexPrice, error)
+}
+
+// Ingester polls a source for the index price of every instrument
+type Ingester struct {
+	Store  Store
+	Source Source
+
+	mu     sync.RWMutex
+	latest map[string]models.IndexPrice // Latest price of each symbol
+}
+
+// NewIngester creates an ingester recording prices from source in store
+func NewIngester(store Store, source Source) *Ingester {
+	return &Ingester{Store: store, Source: source, latest: make(map[string]models.IndexPrice)}
+}
+
+// Load reads the latest recorded price of each instrument, so orders are
+// checked against it before the first poll
+func (i *Ingester) Load(ctx context.Context) error {
+	for _, inst := range instruments.All {
+		price, err := i.Store.GetLatestIndexPrice(ctx, inst.Symbol)
+		if err != nil {
+			return err
+		}
+		if price != nil {
+			i.set(*price)
+		}
+	}
+	return nil
+}
+
+// Poll fetches the index price of every instrument, rounded to its tick,
+// and records them
+func (i *Ingester) Poll(ctx context.Context) error {
+	symbols := make([]string, len(instruments.All))
+	for j, inst := range instruments.All {
+		symbols[j] = inst.Symbol
+	}
+	prices, err := i.Source.Fetch(ctx, symbols)
+	if err != nil {
+		return fmt.Errorf("failed to fetch index prices from %s: %w", i.Source.Name(), err)
+	}
+	for j := range prices {
+		if inst, ok := instruments.Lookup(prices[j].Symbol); ok {
+			prices[j].Price = inst.RoundPrice(prices[j].Price)
+		}
+	}
+	if len(prices) == 0 {
+		return nil
+	}
+	if err := i.Store.SaveIndexPrices(ctx, prices); err != nil {
+		return err
+	}
+	for _, price := range prices {
+		i.set(price)
+	}
+	return nil
+}
+
+// set makes price the symbol's latest unless a later one is known
+func (i *Ingester) set(price models.IndexPrice) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if latest, ok := i.latest[price.Symbol]; !ok || !price.ObservedAt.Before(latest.ObservedAt) {
+		i.latest[price.Symbol] = price
+	}
+}
+
+// Latest returns the latest index price of a symbol, reporting false if
+// none is known
+func (i *Ingester) Latest(symbol string) (models.IndexPrice, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	price, ok := i.latest[symbol]
+	return price, ok
+}
+
+// Run polls every interval until ctx is done. Failures are logged and
+// retried on the next poll.
+func (i *Ingester) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := i.Poll(ctx); err != nil {
+			log.Printf("Failed to ingest index prices: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Band bounds how far from the index price orders may be priced
+type Band struct {
+	Width  float64       // Fraction of the index price either side of it; zero disables the band
+	MaxAge time.Duration // Age an index price is too stale to check against at
+}
+
+// BandError is returned for an order priced outside the band
+type BandError struct {
+	Index     float64 // Index price the band is around
+	Low, High float64 // Lowest and highest prices allowed
+}
+
+func (e *BandError) Error() string {
+	return fmt.Sprintf("Price must be between %g and %g, within the band around the index price %g", e.Low, e.High, e.Index)
+}
+
+// Check returns a *BandError if price is outside the band around the
+// symbol's index price. Orders are let through when there's no index
+// price observed within the band's MaxAge of now, so a stalled feed
+// doesn't stop trading.
+func (i *Ingester) Check(band Band, symbol string, price float64, now time.Time) error {
+	if band.Width == 0 {
+		return nil
+	}
+	index, ok := i.Latest(symbol)
+	if !ok || now.Sub(index.ObservedAt) > band.MaxAge {
+		return nil
+	}
+	low, high := index.Price*(1-band.Width), index.Price*(1+band.Width)
+	if inst, ok := instruments.Lookup(symbol); ok {
+		low, high = inst.RoundPrice(low), inst.RoundPrice(high)
+	}
+	if price < low || price > high {
+		return &BandError{Index: index.Price, Low: low, High: high}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package pricefeed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// memStore keeps index prices in memory
+type memStore struct {
+	saved []models.IndexPrice
+}
+
+func (s *memStore) SaveIndexPrices(ctx context.Context, prices []models.IndexPrice) error {
+	s.saved = append(s.saved, prices...)
+	return nil
+}
+
+func (s *memStore) GetLatestIndexPrice(ctx context.Context, symbol string) (*models.IndexPrice, error) {
+	var latest *models.IndexPrice
+	for i, price := range s.saved {
+		if price.Symbol == symbol && (latest == nil || price.ObservedAt.After(latest.ObservedAt)) {
+			latest = &s.saved[i]
+		}
+	}
+	return latest, nil
+}
+
+// staticSource returns the same prices every time, or an error
+type staticSource struct {
+	prices map[string]float64
+	err    error
+}
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Fetch(ctx context.Context, symbols []string) ([]models.IndexPrice, error) {
+	var prices []models.IndexPrice
+	for _, symbol := range symbols {
+		if price, ok := s.prices[symbol]; ok {
+			prices = append(prices, models.IndexPrice{Symbol: symbol, Source: s.Name(), Price: price, ObservedAt: time.Now()})
+		}
+	}
+	return prices, s.err
+}
+
+func TestIngester_Poll(t *testing.T) {
+	store := &memStore{}
+	i := NewIngester(store, staticSource{prices: map[string]float64{"BTC-USD": 50000.123}})
+	if _, ok := i.Latest("BTC-USD"); ok {
+		t.Fatal("expected no index price before polling")
+	}
+	if err := i.Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.saved) != 1 || store.saved[0].Price != 50000.12 {
+		t.Errorf("expected the price recorded at the instrument's precision, got %+v", store.saved)
+	}
+	if price, ok := i.Latest("BTC-USD"); !ok || price.Price != 50000.12 || price.Source != "static" {
+		t.Errorf("expected the polled price, got %+v, %v", price, ok)
+	}
+
+	i.Source = staticSource{err: errors.New("feed down")}
+	if err := i.Poll(context.Background()); err == nil {
+		t.Error("expected the feed's error")
+	}
+	if price, _ := i.Latest("BTC-USD"); price.Price != 50000.12 {
+		t.Errorf("expected the last price kept, got %+v", price)
+	}
+
+	// A restarted ingester picks up where the last left off
+	restarted := NewIngester(store, staticSource{})
+	if err := restarted.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if price, ok := restarted.Latest("BTC-USD"); !ok || price.Price != 50000.12 {
+		t.Errorf("expected the recorded price loaded, got %+v, %v", price, ok)
+	}
+}
+
+func TestIngester_Check(t *testing.T) {
+	now := time.Now()
+	i := NewIngester(&memStore{}, staticSource{})
+	band := Band{Width: 0.1, MaxAge: 5 * time.Minute}
+	if err := i.Check(band, "BTC-USD", 1, now); err != nil {
+		t.Errorf("expected orders let through without an index price, got %v", err)
+	}
+
+	i.set(models.IndexPrice{Symbol: "BTC-USD", Price: 50000, ObservedAt: now.Add(-time.Minute)})
+	for _, price := range []float64{45000, 50000, 55000} {
+		if err := i.Check(band, "BTC-USD", price, now); err != nil {
+			t.Errorf("expected %v within the band, got %v", price, err)
+		}
+	}
+	var bandErr *BandError
+	if err := i.Check(band, "BTC-USD", 55000.01, now); !errors.As(err, &bandErr) || bandErr.Low != 45000 || bandErr.High != 55000 {
+		t.Errorf("expected a band error, got %v", err)
+	}
+	if err := i.Check(band, "BTC-USD", 44999.99, now); !errors.As(err, &bandErr) {
+		t.Errorf("expected a band error, got %v", err)
+	}
+	if err := i.Check(Band{MaxAge: time.Hour}, "BTC-USD", 1, now); err != nil {
+		t.Errorf("expected no check without a band, got %v", err)
+	}
+	if err := i.Check(band, "BTC-USD", 1, now.Add(5*time.Minute)); err != nil {
+		t.Errorf("expected a stale index price ignored, got %v", err)
+	}
+
+	// An older price arriving late doesn't replace the latest
+	i.set(models.IndexPrice{Symbol: "BTC-USD", Price: 1, ObservedAt: now.Add(-time.Hour)})
+	if price, _ := i.Latest("BTC-USD"); price.Price != 50000 {
+		t.Errorf("expected the latest price kept, got %+v", price)
+	}
+}
+
+func TestCoinbaseSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/prices/BTC-USD/spot" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{"amount":"50123.45","base":"BTC","currency":"USD"}}`))
+	}))
+	defer server.Close()
+
+	source := &CoinbaseSource{URL: server.URL, Client: server.Client()}
+	prices, err := source.Fetch(context.Background(), []string{"BTC-USD"})
+	if err != nil || len(prices) != 1 || prices[0].Price != 50123.45 || prices[0].Source != "coinbase" || prices[0].ObservedAt.IsZero() {
+		t.Errorf("expected the spot price, got %+v, %v", prices, err)
+	}
+	if _, err := source.Fetch(context.Background(), []string{"BTC-USD", "DOGE-USD"}); err == nil {
+		t.Error("expected an error for a pair the feed doesn't have")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"BTC-USD": 48000.5, "ETH-USD": 3000}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewSource("file:" + path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	prices, err := source.Fetch(context.Background(), []string{"BTC-USD", "SOL-USD"})
+	if err != nil || len(prices) != 1 || prices[0].Symbol != "BTC-USD" || prices[0].Price != 48000.5 || prices[0].Source != "file" {
+		t.Errorf("expected the file's BTC-USD price, got %+v, %v", prices, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"BTC-USD": -1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Fetch(context.Background(), []string{"BTC-USD"}); err == nil {
+		t.Error("expected an error for a negative price")
+	}
+	if _, err := (FileSource{Path: filepath.Join(t.TempDir(), "missing.json")}).Fetch(context.Background(), nil); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	if source, err := NewSource("coinbase"); err != nil || source.Name() != "coinbase" {
+		t.Errorf("expected the Coinbase source, got %v, %v", source, err)
+	}
+	for _, feed := range []string{"", "file:", "kraken"} {
+		if _, err := NewSource(feed); err == nil {
+			t.Errorf("expected an error for feed %q", feed)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package pricefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Source fetches the current index prices of instruments
+type Source interface {
+	// Name identifies the feed prices are recorded as coming from
+	Name() string
+	// Fetch returns the price of each symbol the feed has one for
+	Fetch(ctx context.Context, symbols []string) ([]models.IndexPrice, error)
+}
+
+// NewSource returns the source for a feed: "coinbase", or "file:" and the
+// path of a JSON object of prices by symbol
+func NewSource(feed string) (Source, error) {
+	if feed == "coinbase" {
+		return &CoinbaseSource{URL: coinbaseURL, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	}
+	if path, ok := strings.CutPrefix(feed, "file:"); ok && path != "" {
+		return FileSource{Path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown price feed %q", feed)
+}
+
+// coinbaseURL is Coinbase's public API, which needs no key for spot prices
+const coinbaseURL = "https://api.coinbase.com"
+
+// CoinbaseSource polls Coinbase's spot price of each symbol, whose
+// currency pairs are named like the exchange's instruments
+type CoinbaseSource struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name is "coinbase"
+func (s *CoinbaseSource) Name() string {
+	return "coinbase"
+}
+
+// Fetch requests each symbol's spot price in turn, failing if any can't
+// be had
+func (s *CoinbaseSource) Fetch(ctx context.Context, symbols []string) ([]models.IndexPrice, error) {
+	prices := make([]models.IndexPrice, 0, len(symbols))
+	for _, symbol := range symbols {
+		price, err := s.fetch(ctx, symbol)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+		prices = append(prices, models.IndexPrice{Symbol: symbol, Source: s.Name(), Price: price, ObservedAt: time.Now().UTC()})
+	}
+	return prices, nil
+}
+
+// fetch requests one symbol's spot price
+func (s *CoinbaseSource) fetch(ctx context.Context, symbol string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v2/prices/%s/spot", s.URL, symbol), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return 0, fmt.Errorf("price feed returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Amount string `json:"amount"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode price: %w", err)
+	}
+	price, err := strconv.ParseFloat(body.Data.Amount, 64)
+	if err != nil || price <= 0 {
+		return 0, fmt.Errorf("invalid price %q", body.Data.Amount)
+	}
+	return price, nil
+}
+
+// FileSource reads prices from a JSON object of prices by symbol, e.g.
+// {"BTC-USD": 50000}, read again on every fetch so editing the file moves
+// the index. It's meant for development, without network access.
+type FileSource struct {
+	Path string
+}
+
+// Name is "file"
+func (s FileSource) Name() string {
+	return "file"
+}
+
+// Fetch returns the prices in the file of the symbols it has, observed now
+func (s FileSource) Fetch(ctx context.Context, symbols []string) ([]models.IndexPrice, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prices: %w", err)
+	}
+	var bySymbol map[string]float64
+	if err := json.Unmarshal(data, &bySymbol); err != nil {
+		return nil, fmt.Errorf("failed to parse prices in %s: %w", s.Path, err)
+	}
+
+	now := time.Now().UTC()
+	prices := []models.IndexPrice{}
+	for _, symbol := range symbols {
+		price, ok := bySymbol[symbol]
+		if !ok {
+			continue
+		}
+		if price <= 0 {
+			return nil, fmt.Errorf("invalid %s price %v in %s", symbol, price, s.Path)
+		}
+		prices = append(prices, models.IndexPrice{Symbol: symbol, Source: s.Name(), Price: price, ObservedAt: now})
+	}
+	return prices, nil
+}
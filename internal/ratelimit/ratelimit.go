@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are discarded
+const sweepInterval = time.Minute
+
+// bucket is a token bucket for one key
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last refilled
+}
+
+// Limiter is a set of token buckets, one per key, that refill at Rate
+// tokens per second up to Burst. A Limiter with a zero rate allows everything.
+type Limiter struct {
+	Rate  float64
+	Burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter allowing rate requests per second with bursts of burst
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket. If none is available it returns
+// false and how long until one will be.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep discards buckets that have refilled completely, since a new bucket
+// would be identical; callers must hold l.mu
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := New(2, 3) // 2 per second, bursts of 3
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("user:1", now); !ok {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+
+	ok, retryAfter := l.Allow("user:1", now)
+	if ok {
+		t.Fatalf("expected request beyond burst to be limited")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("expected retry after 500ms, got %v", retryAfter)
+	}
+
+	// Other keys have their own budget
+	if ok, _ := l.Allow("user:2", now); !ok {
+		t.Errorf("expected a different key to be allowed")
+	}
+
+	// Tokens refill over time
+	if ok, _ := l.Allow("user:1", now.Add(500*time.Millisecond)); !ok {
+		t.Errorf("expected a refilled token to be allowed")
+	}
+	if ok, _ := l.Allow("user:1", now.Add(500*time.Millisecond)); ok {
+		t.Errorf("expected only one token to have refilled")
+	}
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := New(0, 0)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("ip:127.0.0.1", time.Now()); !ok {
+			t.Fatalf("expected a zero-rate limiter to allow everything")
+		}
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	l := New(10, 5)
+	now := time.Now()
+	l.Allow("user:1", now)
+	l.Allow("user:2", now.Add(2*time.Minute))
+
+	if len(l.buckets) != 1 {
+		t.Errorf("expected the idle bucket to be swept, have %d buckets", len(l.buckets))
+	}
+}
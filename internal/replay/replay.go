@@ -0,0 +1,281 @@
+// Package replay runs the matching engine over a recorded stream of order
+// commands, with order and trade IDs assigned in sequence and a simulated
+// clock, so the same commands always produce the same trade log. Comparing
+// logs from before and after a change to the engine shows whether matching
+// behavior changed.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Epoch is where the simulated clock starts by default
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Tick is how far the clock advances for a command without a time
+const Tick = time.Millisecond
+
+// Command operations
+const (
+	OpPlace   = "place"   // Place an order
+	OpCancel  = "cancel"  // Cancel a resting or queued order
+	OpAmend   = "amend"   // Change an order's price and/or quantity
+	OpPause   = "pause"   // Pause matching, queueing new orders
+	OpResume  = "resume"  // Resume matching, matching queued orders
+	OpExpire  = "expire"  // Cancel GTD orders expired by the clock
+	OpMarket  = "market"  // Move the market to State
+	OpUncross = "uncross" // End an auction, trading the crossing orders at one price
+)
+
+// Command is one line of a command stream
+type Command struct {
+	Op string     `json:"op"`
+	At *time.Time `json:"at,omitempty"` // Sets the clock, which can't go back; otherwise it advances by Tick
+
+	// Orders to place
+	UserID          int        `json:"user_id,omitempty"`
+	Side            string     `json:"side,omitempty"` // "buy" or "sell"
+	Price           float64    `json:"price,omitempty"`
+	Quantity        float64    `json:"quantity,omitempty"`
+	TimeInForce     string     `json:"time_in_force,omitempty"`
+	PostOnly        bool       `json:"post_only,omitempty"`
+	DisplayQuantity float64    `json:"display_quantity,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+
+	// Orders to cancel or amend, numbered from 1 in the order placed
+	OrderID int `json:"order_id,omitempty"`
+
+	State string `json:"state,omitempty"` // Market state to move to
+}
+
+// Event types
+const (
+	EventTrade    = "trade"    // Two orders traded
+	EventCanceled = "canceled" // An order was canceled, by a command or its instructions
+	EventExpired  = "expired"  // A GTD order expired
+	EventRejected = "rejected" // The exchange refused the command
+)
+
+// Event is one line of the trade log
+type Event struct {
+	Command int       `json:"command"` // Number of the command that caused it, from 1
+	Type    string    `json:"type"`
+	At      time.Time `json:"at"`
+	OrderID int       `json:"order_id,omitempty"`
+	Trade   *Trade    `json:"trade,omitempty"`
+}
+
+// Trade is a trade in the log, with the users on each side
+type Trade struct {
+	ID          int     `json:"id"`
+	BuyOrderID  int     `json:"buy_order_id"`
+	SellOrderID int     `json:"sell_order_id"`
+	BuyUserID   int     `json:"buy_user_id"`
+	SellUserID  int     `json:"sell_user_id"`
+	Price       float64 `json:"price"`
+	Quantity    float64 `json:"quantity"`
+	TakerSide   string  `json:"taker_side"`
+}
+
+// Replayer applies commands to an exchange of its own
+type Replayer struct {
+	ex          *exchange.Exchange
+	clock       time.Time
+	command     int // Commands applied
+	lastOrderID int
+	lastTradeID int
+	events      []Event // Events of the command being applied
+	violation   error   // First engine invariant violated
+}
+
+// New returns a replayer over an empty book with the clock at start
+func New(start time.Time) *Replayer {
+	r := &Replayer{ex: exchange.NewExchange(), clock: start}
+	r.ex.SetClock(func() time.Time { return r.clock })
+	r.ex.SetInvariantCheck(func(err error) {
+		if r.violation == nil {
+			r.violation = err
+		}
+	})
+	return r
+}
+
+// Apply applies the next command and returns the events it caused. A
+// command the exchange refuses, like an order while the market is halted or
+// a cancel of an order no longer in the book, gives a rejected event, while
+// a malformed command is an error. So is a command after which the engine's
+// invariants don't hold, and every command after it.
+func (r *Replayer) Apply(cmd Command) ([]Event, error) {
+	if r.violation != nil {
+		return nil, r.violation
+	}
+	clock := r.clock.Add(Tick)
+	if cmd.At != nil {
+		if cmd.At.Before(r.clock) {
+			return nil, fmt.Errorf("time %s is before %s", cmd.At.Format(time.RFC3339Nano), r.clock.Format(time.RFC3339Nano))
+		}
+		clock = *cmd.At
+	}
+
+	var order models.Order
+	switch cmd.Op {
+	case OpPlace:
+		if cmd.Side != "buy" && cmd.Side != "sell" {
+			return nil, fmt.Errorf("invalid side %q", cmd.Side)
+		}
+		if cmd.Price <= 0 || cmd.Quantity <= 0 {
+			return nil, errors.New("price and quantity must be positive")
+		}
+		order = models.Order{
+			UserID:          cmd.UserID,
+			Symbol:          exchange.DefaultSymbol,
+			Type:            cmd.Side,
+			Price:           cmd.Price,
+			Quantity:        cmd.Quantity,
+			Status:          "open",
+			TimeInForce:     cmd.TimeInForce,
+			PostOnly:        cmd.PostOnly,
+			DisplayQuantity: cmd.DisplayQuantity,
+			ExpiresAt:       cmd.ExpiresAt,
+		}
+	case OpCancel, OpAmend:
+		if cmd.OrderID < 1 || cmd.OrderID > r.lastOrderID {
+			return nil, fmt.Errorf("unknown order %d", cmd.OrderID)
+		}
+	case OpMarket:
+		if _, err := exchange.ParseMarketState(cmd.State); err != nil {
+			return nil, err
+		}
+	case OpPause, OpResume, OpExpire, OpUncross:
+	default:
+		return nil, fmt.Errorf("unknown op %q", cmd.Op)
+	}
+
+	r.clock = clock
+	r.command++
+	r.events = nil
+	halted := r.ex.MarketStatus().State == exchange.MarketHalted
+
+	switch cmd.Op {
+	case OpPlace:
+		r.lastOrderID++
+		order.ID = r.lastOrderID
+		order.CreatedAt = clock
+		if halted {
+			r.emit(EventRejected, order.ID)
+			break
+		}
+		trades, _, canceled := r.ex.MatchOrder(order)
+		r.matched(trades, canceled)
+	case OpCancel:
+		if r.ex.RemoveOrder(cmd.OrderID) {
+			r.emit(EventCanceled, cmd.OrderID)
+		} else {
+			r.emit(EventRejected, cmd.OrderID)
+		}
+	case OpAmend:
+		if halted {
+			r.emit(EventRejected, cmd.OrderID)
+			break
+		}
+		trades, _, canceled, ok := r.ex.AmendOrder(cmd.OrderID, cmd.Price, cmd.Quantity)
+		if !ok {
+			r.emit(EventRejected, cmd.OrderID)
+		}
+		r.matched(trades, canceled)
+	case OpPause:
+		if !r.ex.Pause() {
+			r.emit(EventRejected, 0)
+		}
+	case OpResume:
+		trades, _, canceled, _ := r.ex.Resume()
+		r.matched(trades, canceled)
+	case OpExpire:
+		for _, orderID := range r.ex.ExpireOrders(clock) {
+			r.emit(EventExpired, orderID)
+		}
+	case OpMarket:
+		state, _ := exchange.ParseMarketState(cmd.State)
+		if _, err := r.ex.SetMarketState(state, "replay"); err != nil {
+			r.emit(EventRejected, 0)
+		}
+	case OpUncross:
+		result, _, err := r.ex.Uncross(0, "replay")
+		if err != nil {
+			r.emit(EventRejected, 0)
+		}
+		r.matched(result.Trades, result.Canceled)
+	}
+	if r.violation != nil {
+		return nil, r.violation
+	}
+	return r.events, nil
+}
+
+// emit logs an event of the command being applied
+func (r *Replayer) emit(eventType string, orderID int) {
+	r.events = append(r.events, Event{Command: r.command, Type: eventType, At: r.clock, OrderID: orderID})
+}
+
+// matched logs the outcome of a match, numbering its trades
+func (r *Replayer) matched(trades []models.Trade, canceled []int) {
+	for _, trade := range trades {
+		r.lastTradeID++
+		r.events = append(r.events, Event{Command: r.command, Type: EventTrade, At: r.clock, Trade: &Trade{
+			ID:          r.lastTradeID,
+			BuyOrderID:  trade.BuyOrderID,
+			SellOrderID: trade.SellOrderID,
+			BuyUserID:   trade.BuyUserID,
+			SellUserID:  trade.SellUserID,
+			Price:       trade.Price,
+			Quantity:    trade.Quantity,
+			TakerSide:   trade.TakerSide,
+		}})
+	}
+	for _, orderID := range canceled {
+		r.emit(EventCanceled, orderID)
+	}
+}
+
+// Run replays a stream of commands, one JSON object per line, from an empty
+// book with the clock at start, writing each event to out as a line of JSON.
+// Blank lines are skipped and don't count as commands.
+func Run(in io.Reader, out io.Writer, start time.Time) error {
+	r := New(start)
+	scanner := bufio.NewScanner(in)
+	enc := json.NewEncoder(out)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var cmd Command
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cmd); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		events, err := r.Apply(cmd)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read commands: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package replay
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected trade logs in testdata")
+
+// TestRun replays each command stream in testdata and compares the trade
+// log with the .golden file beside it. After an intended change to
+// matching, regenerate them with go test ./internal/replay -update and
+// review the diff.
+func TestRun(t *testing.T) {
+	streams, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if err != nil || len(streams) == 0 {
+		t.Fatalf("no command streams found: %v", err)
+	}
+	for _, path := range streams {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			commands, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := Run(bytes.NewReader(commands), &got, Epoch); err != nil {
+				t.Fatalf("Failed to replay: %v", err)
+			}
+
+			golden := strings.TrimSuffix(path, ".jsonl") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read expected log (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("trade log differs from %s:\ngot:\n%s\nwant:\n%s", golden, got.Bytes(), want)
+			}
+
+			// Replaying again gives the same log
+			var again bytes.Buffer
+			Run(bytes.NewReader(commands), &again, Epoch)
+			if !bytes.Equal(again.Bytes(), got.Bytes()) {
+				t.Error("expected replays of the same commands to match")
+			}
+		})
+	}
+}
+
+func TestRun_InvalidCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands string
+		want     string
+	}{
+		{"unknown op", `{"op":"trade"}`, `line 1: unknown op "trade"`},
+		{"unknown field", `{"op":"place","size":1}`, `line 1: json: unknown field "size"`},
+		{"bad side", `{"op":"place","side":"long","price":1,"quantity":1}`, `line 1: invalid side "long"`},
+		{"unknown order", "{\"op\":\"place\",\"side\":\"buy\",\"price\":1,\"quantity\":1}\n\n{\"op\":\"cancel\",\"order_id\":2}", "line 3: unknown order 2"},
+		{"clock going back", "{\"op\":\"pause\",\"at\":\"2024-01-02T00:00:00Z\"}\n{\"op\":\"resume\",\"at\":\"2024-01-01T00:00:00Z\"}", "line 2: time 2024-01-01T00:00:00Z is before 2024-01-02T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(strings.NewReader(tt.commands), &bytes.Buffer{}, Epoch)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
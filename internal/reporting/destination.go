@@ -0,0 +1,81 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Destination stores report files. Writing a name again replaces the file.
+type Destination interface {
+	Write(ctx context.Context, name string, data []byte) error
+}
+
+// NewDestination returns the destination for a target: an http or https
+// URL reports are PUT under, or otherwise a directory
+func NewDestination(target string) (Destination, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL %q", target)
+		}
+		return &HTTPDestination{URL: strings.TrimSuffix(target, "/"), Client: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	if target == "" {
+		return nil, fmt.Errorf("destination required")
+	}
+	return DirDestination{Path: target}, nil
+}
+
+// DirDestination writes reports as files in a directory, created if needed
+type DirDestination struct {
+	Path string
+}
+
+// Write writes the file under a temporary name and renames it, so readers
+// never see a partial report
+func (d DirDestination) Write(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	path := filepath.Join(d.Path, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// HTTPDestination PUTs reports to URL/name, e.g. a storage bucket or a
+// regulator's upload endpoint
+type HTTPDestination struct {
+	URL    string
+	Client *http.Client
+}
+
+// Write uploads the file, failing unless the server replies with a 2xx status
+func (d *HTTPDestination) Write(ctx context.Context, name string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, d.URL+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("report destination returned status %d for %s", resp.StatusCode, name)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package reporting generates daily regulator-style trade reports.
+//
+// Each report holds the trades executed on one UTC day, laid out in a
+// configurable CSV or XML schema, and is written to a pluggable
+// destination. A day's report is generated shortly after the day ends;
+// admins can regenerate any day, e.g. one missed while the server was down.
+package reporting
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// DayLayout is the layout of report days, e.g. "2024-01-01"
+const DayLayout = "2006-01-02"
+
+// settleDelay is how long after midnight a day's report waits for trades
+// matched just before midnight to be recorded
+const settleDelay = 5 * time.Minute
+
+// Reporter generates daily trade reports
+type Reporter struct {
+	DB          *db.DB
+	Schema      Schema
+	Destination Destination
+
+	mu sync.Mutex // Serializes generation so a day isn't written twice at once
+}
+
+// NewReporter creates a reporter writing reports in schema to destination
+func NewReporter(database *db.DB, schema Schema, destination Destination) *Reporter {
+	return &Reporter{DB: database, Schema: schema, Destination: destination}
+}
+
+// FileName returns the file name of a day's report
+func (r *Reporter) FileName(day string) string {
+	return "trades-" + day + r.Schema.Extension()
+}
+
+// Generate writes the report of the UTC day containing t, replacing any
+// earlier report of that day, and records it
+func (r *Reporter) Generate(ctx context.Context, t time.Time) (*models.TradeReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	day := start.Format(DayLayout)
+	trades, err := r.DB.GetTradesBetween(ctx, start, start.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.Schema.Encode(day, trades)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TradeReport{Day: day, Name: r.FileName(day), Trades: len(trades)}
+	if err := r.Destination.Write(ctx, report.Name, data); err != nil {
+		return nil, err
+	}
+	if err := r.DB.SaveTradeReport(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// generateDue generates the previous day's report if it is settled and
+// hasn't been generated yet
+func (r *Reporter) generateDue(ctx context.Context, now time.Time) error {
+	yesterday := now.UTC().Add(-settleDelay).AddDate(0, 0, -1)
+	existing, err := r.DB.GetTradeReport(ctx, yesterday.Format(DayLayout))
+	if err != nil || existing != nil {
+		return err
+	}
+	report, err := r.Generate(ctx, yesterday)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote trade report %s with %d trades", report.Name, report.Trades)
+	return nil
+}
+
+// Run generates each day's report once it is settled, checking every
+// interval until ctx is done. Failures are retried on the next check.
+func (r *Reporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.generateDue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to generate trade report: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
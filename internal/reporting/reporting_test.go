@@ -0,0 +1,129 @@
+package reporting
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+var testTrades = []models.ReportedTrade{{
+	AccountingTrade: models.AccountingTrade{
+		ID: 7, Symbol: "BTC-USD", BuyOrderID: 3, SellOrderID: 5, BuyUserID: 1, SellUserID: 2,
+		Price: 50000, Quantity: 0.00000001, TakerSide: "buy",
+		ExecutedAt: time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+	},
+	BuyUsername:  "alice",
+	SellUsername: "bob, inc",
+}}
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(FormatCSV, "trade_id=TradeRef, executed_at,sell_username")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Column{{"trade_id", "TradeRef"}, {"executed_at", "executed_at"}, {"sell_username", "sell_username"}}
+	if len(schema.Columns) != len(want) {
+		t.Fatalf("expected %v, got %v", want, schema.Columns)
+	}
+	for i := range want {
+		if schema.Columns[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], schema.Columns[i])
+		}
+	}
+
+	if _, err := ParseSchema(FormatCSV, DefaultFields); err != nil {
+		t.Errorf("expected default fields to parse, got %v", err)
+	}
+	for _, tt := range []struct{ format, fields string }{
+		{"json", "trade_id"},
+		{FormatCSV, "trade_id,password"},
+		{FormatXML, "trade_id=Trade Ref"},
+		{FormatXML, "trade_id=1st"},
+	} {
+		if _, err := ParseSchema(tt.format, tt.fields); err == nil {
+			t.Errorf("expected error for %s %q", tt.format, tt.fields)
+		}
+	}
+}
+
+func TestSchema_Encode(t *testing.T) {
+	schema, _ := ParseSchema(FormatCSV, "trade_id=TradeRef,executed_at,quantity,notional,sell_username")
+	data, err := schema.Encode("2024-01-01", testTrades)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "TradeRef,executed_at,quantity,notional,sell_username\n" +
+		"7,2024-01-01T12:30:00Z,0.00000001,0.0005,\"bob, inc\"\n"
+	if string(data) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, data)
+	}
+
+	schema.Format = FormatXML
+	data, err = schema.Encode("2024-01-01", testTrades)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = `<?xml version="1.0" encoding="UTF-8"?>
+<TradeReport date="2024-01-01" count="1">
+  <Trade>
+    <TradeRef>7</TradeRef>
+    <executed_at>2024-01-01T12:30:00Z</executed_at>
+    <quantity>0.00000001</quantity>
+    <notional>0.0005</notional>
+    <sell_username>bob, inc</sell_username>
+  </Trade>
+</TradeReport>
+`
+	if string(data) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	ctx := context.Background()
+
+	dir := filepath.Join(t.TempDir(), "reports")
+	dest, err := NewDestination(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if err := dest.Write(ctx, "trades-2024-01-01.csv", []byte(body)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "trades-2024-01-01.csv")); string(data) != "second" {
+		t.Errorf("expected the report to be replaced, got %q", data)
+	}
+
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, body = r.Method+" "+r.URL.Path, string(data)
+		if r.URL.Path == "/reports/fail.csv" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	dest, err = NewDestination(server.URL + "/reports/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := dest.Write(ctx, "trades-2024-01-01.xml", []byte("<TradeReport/>")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "PUT /reports/trades-2024-01-01.xml" || body != "<TradeReport/>" {
+		t.Errorf("unexpected upload %s: %s", path, body)
+	}
+	if err := dest.Write(ctx, "fail.csv", nil); err == nil {
+		t.Errorf("expected error for a rejected upload, got nil")
+	}
+}
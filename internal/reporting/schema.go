@@ -0,0 +1,161 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Report formats
+const (
+	FormatCSV = "csv"
+	FormatXML = "xml"
+)
+
+// fields are the trade fields a report can include, by name
+var fields = map[string]func(models.ReportedTrade) string{
+	"trade_id":      func(t models.ReportedTrade) string { return strconv.Itoa(t.ID) },
+	"symbol":        func(t models.ReportedTrade) string { return t.Symbol },
+	"executed_at":   func(t models.ReportedTrade) string { return t.ExecutedAt.UTC().Format(time.RFC3339Nano) },
+	"price":         func(t models.ReportedTrade) string { return formatDecimal(t.Price) },
+	"quantity":      func(t models.ReportedTrade) string { return formatDecimal(t.Quantity) },
+	"notional":      func(t models.ReportedTrade) string { return formatDecimal(t.Price * t.Quantity) },
+	"taker_side":    func(t models.ReportedTrade) string { return t.TakerSide },
+	"buy_order_id":  func(t models.ReportedTrade) string { return strconv.Itoa(t.BuyOrderID) },
+	"sell_order_id": func(t models.ReportedTrade) string { return strconv.Itoa(t.SellOrderID) },
+	"buy_account":   func(t models.ReportedTrade) string { return strconv.Itoa(t.BuyUserID) },
+	"sell_account":  func(t models.ReportedTrade) string { return strconv.Itoa(t.SellUserID) },
+	"buy_username":  func(t models.ReportedTrade) string { return t.BuyUsername },
+	"sell_username": func(t models.ReportedTrade) string { return t.SellUsername },
+	"buy_fee":       func(t models.ReportedTrade) string { return formatDecimal(t.BuyFee) },
+	"sell_fee":      func(t models.ReportedTrade) string { return formatDecimal(t.SellFee) },
+}
+
+// DefaultFields is the schema used when none is configured
+const DefaultFields = "trade_id,executed_at,symbol,price,quantity,notional,taker_side,buy_account,sell_account"
+
+// columnName matches names usable as both CSV headers and XML elements
+var columnName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// formatDecimal formats an amount in plain decimal notation, without exponents
+func formatDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Column is a trade field in a report, under the name the regulator expects
+type Column struct {
+	Field string
+	Name  string
+}
+
+// Schema is the layout of a report: its format and columns, in order
+type Schema struct {
+	Format  string
+	Columns []Column
+}
+
+// ParseSchema parses a format and comma-separated fields, each optionally
+// renamed with field=Name, e.g. "trade_id=TradeRef,executed_at=ExecTime"
+func ParseSchema(format, value string) (Schema, error) {
+	if format != FormatCSV && format != FormatXML {
+		return Schema{}, fmt.Errorf("unknown format %q", format)
+	}
+	schema := Schema{Format: format}
+	for _, item := range strings.Split(value, ",") {
+		field, name, renamed := strings.Cut(strings.TrimSpace(item), "=")
+		if !renamed {
+			name = field
+		}
+		if _, ok := fields[field]; !ok {
+			return Schema{}, fmt.Errorf("unknown field %q", field)
+		}
+		if !columnName.MatchString(name) {
+			return Schema{}, fmt.Errorf("invalid column name %q", name)
+		}
+		schema.Columns = append(schema.Columns, Column{Field: field, Name: name})
+	}
+	return schema, nil
+}
+
+// Extension returns the file extension of the schema's format
+func (s Schema) Extension() string {
+	return "." + s.Format
+}
+
+// Encode writes the trades of a day, a UTC date such as "2024-01-01", in
+// the schema's format
+func (s Schema) Encode(day string, trades []models.ReportedTrade) ([]byte, error) {
+	if s.Format == FormatXML {
+		return s.encodeXML(day, trades)
+	}
+	return s.encodeCSV(trades)
+}
+
+// encodeCSV writes a header row of column names, then a row per trade
+func (s Schema) encodeCSV(trades []models.ReportedTrade) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	row := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		row[i] = column.Name
+	}
+	w.Write(row)
+	for _, trade := range trades {
+		for i, column := range s.Columns {
+			row[i] = fields[column.Field](trade)
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXML writes a TradeReport element for the day holding a Trade
+// element per trade, with an element per column
+func (s Schema) encodeXML(day string, trades []models.ReportedTrade) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+
+	report := xml.StartElement{Name: xml.Name{Local: "TradeReport"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "date"}, Value: day},
+		{Name: xml.Name{Local: "count"}, Value: strconv.Itoa(len(trades))},
+	}}
+	if err := enc.EncodeToken(report); err != nil {
+		return nil, fmt.Errorf("failed to write XML: %w", err)
+	}
+	for _, trade := range trades {
+		element := xml.StartElement{Name: xml.Name{Local: "Trade"}}
+		if err := enc.EncodeToken(element); err != nil {
+			return nil, fmt.Errorf("failed to write XML: %w", err)
+		}
+		for _, column := range s.Columns {
+			err := enc.EncodeElement(fields[column.Field](trade), xml.StartElement{Name: xml.Name{Local: column.Name}})
+			if err != nil {
+				return nil, fmt.Errorf("failed to write XML: %w", err)
+			}
+		}
+		if err := enc.EncodeToken(element.End()); err != nil {
+			return nil, fmt.Errorf("failed to write XML: %w", err)
+		}
+	}
+	if err := enc.EncodeToken(report.End()); err != nil {
+		return nil, fmt.Errorf("failed to write XML: %w", err)
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write XML: %w", err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,164 @@
+// Package rewards accrues interest or points on users' balances, for
+// earn-style programs.
+//
+// Each user's balance in the program's asset is snapshotted periodically.
+// At the end of each accrual period a user is credited the program's annual
+// rate, prorated to the period, of their time-weighted average balance over
+// it, through the ledger from the rewards system account. Each period is
+// accrued once, so accruing again after a restart is safe, and periods
+// missed while the server was down are accrued when it comes back.
+package rewards
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// year is the period the rate of a program is quoted over
+const year = 365 * 24 * time.Hour
+
+// Program describes what balances earn and how it is paid
+type Program struct {
+	Asset       string        // Balances in this asset earn rewards
+	PayoutAsset string        // Asset rewards are credited in: Asset for interest, another such as "POINTS" for points
+	Rate        float64       // Per year, as a fraction of the average balance
+	Period      time.Duration // Accrual period; periods are aligned to multiples of it since the zero time
+}
+
+// Reward returns the reward for holding an average balance over one period,
+// rounded down to the ledger's 8 decimal places
+func (p Program) Reward(average float64) float64 {
+	reward := average * p.Rate * float64(p.Period) / float64(year)
+	return math.Floor(reward*1e8) / 1e8
+}
+
+// TimeWeightedAverage returns the average balance from start until end given
+// a user's snapshots in time order. Each snapshot's balance holds until the
+// next one; snapshots before start give the opening balance, which is zero
+// without one. Negative balances count as zero.
+func TimeWeightedAverage(snapshots []models.BalanceSnapshot, start, end time.Time) float64 {
+	if !end.After(start) {
+		return 0
+	}
+	var weighted float64
+	balance := 0.0
+	at := start
+	for _, snapshot := range snapshots {
+		if snapshot.TakenAt.After(at) {
+			until := snapshot.TakenAt
+			if until.After(end) {
+				until = end
+			}
+			weighted += max(balance, 0) * float64(until.Sub(at))
+			at = until
+		}
+		if !snapshot.TakenAt.Before(end) {
+			break
+		}
+		balance = snapshot.Amount
+	}
+	weighted += max(balance, 0) * float64(end.Sub(at))
+	return weighted / float64(end.Sub(start))
+}
+
+// Accruer snapshots balances and credits rewards for a program
+type Accruer struct {
+	DB      *db.DB
+	Program Program
+}
+
+// NewAccruer creates an accruer for a program
+func NewAccruer(database *db.DB, program Program) *Accruer {
+	return &Accruer{DB: database, Program: program}
+}
+
+// Snapshot records every user's balance in the program's asset
+func (a *Accruer) Snapshot(ctx context.Context, now time.Time) error {
+	_, err := a.DB.SnapshotBalances(ctx, a.Program.Asset, now)
+	return err
+}
+
+// Accrue credits rewards for each period that ended by now and hasn't been
+// accrued, oldest first, starting with the latest one the first time.
+// Returns how many rewards were credited.
+func (a *Accruer) Accrue(ctx context.Context, now time.Time) (int, error) {
+	end := now.Truncate(a.Program.Period)
+	start, err := a.DB.GetLastRewardPeriodEnd(ctx, a.Program.Asset)
+	if err != nil {
+		return 0, err
+	}
+	if start.IsZero() {
+		start = end.Add(-a.Program.Period)
+	}
+
+	credited := 0
+	for ; start.Before(end); start = start.Add(a.Program.Period) {
+		n, err := a.accruePeriod(ctx, start, start.Add(a.Program.Period))
+		if err != nil {
+			return credited, err
+		}
+		credited += n
+	}
+	if err := a.DB.PruneBalanceSnapshots(ctx, a.Program.Asset, end); err != nil {
+		return credited, err
+	}
+	return credited, nil
+}
+
+// accruePeriod credits each user's reward for one period
+func (a *Accruer) accruePeriod(ctx context.Context, start, end time.Time) (int, error) {
+	snapshots, err := a.DB.GetBalanceSnapshots(ctx, a.Program.Asset, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var accruals []models.RewardAccrual
+	for userID, userSnapshots := range snapshots {
+		average := TimeWeightedAverage(userSnapshots, start, end)
+		reward := a.Program.Reward(average)
+		if reward <= 0 {
+			continue
+		}
+		accruals = append(accruals, models.RewardAccrual{
+			UserID:         userID,
+			PayoutAsset:    a.Program.PayoutAsset,
+			AverageBalance: average,
+			Rate:           a.Program.Rate,
+			Amount:         reward,
+		})
+	}
+
+	credited, err := a.DB.CreditRewards(ctx, a.Program.Asset, start, end, accruals)
+	if err != nil || !credited {
+		return 0, err
+	}
+	return len(accruals), nil
+}
+
+// Run snapshots balances every interval, accruing rewards for each period
+// as it ends, until ctx is done. Failures are retried on the next tick.
+func (a *Accruer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := a.Snapshot(ctx, now); err != nil {
+				log.Printf("Failed to snapshot balances: %v", err)
+				continue
+			}
+			if credited, err := a.Accrue(ctx, now); err != nil {
+				log.Printf("Failed to accrue rewards: %v", err)
+			} else if credited > 0 {
+				log.Printf("Credited %d %s rewards", credited, a.Program.PayoutAsset)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package rewards
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestTimeWeightedAverage(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	at := func(hours int, amount float64) models.BalanceSnapshot {
+		return models.BalanceSnapshot{Amount: amount, TakenAt: start.Add(time.Duration(hours) * time.Hour)}
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []models.BalanceSnapshot
+		want      float64
+	}{
+		{"no snapshots", nil, 0},
+		{"opening balance held all period", []models.BalanceSnapshot{at(-5, 100)}, 100},
+		{"deposit halfway", []models.BalanceSnapshot{at(-5, 100), at(12, 300)}, 200},
+		{"first snapshot during period", []models.BalanceSnapshot{at(6, 400)}, 300},
+		{"snapshot at start replaces opening balance", []models.BalanceSnapshot{at(-1, 50), at(0, 100)}, 100},
+		{"negative balance counts as zero", []models.BalanceSnapshot{at(-1, -100), at(12, 100)}, 50},
+		{"snapshot at end is ignored", []models.BalanceSnapshot{at(-1, 100), at(24, 1000)}, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeWeightedAverage(tt.snapshots, start, end); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProgram_Reward(t *testing.T) {
+	program := Program{Asset: "USD", PayoutAsset: "USD", Rate: 0.0365, Period: 24 * time.Hour}
+	if got := program.Reward(1000); math.Abs(got-0.1) > 1e-9 {
+		t.Errorf("expected 0.1, got %v", got)
+	}
+	// Rewards below the ledger's precision aren't credited
+	if got := program.Reward(0.00005); got != 0 {
+		t.Errorf("expected 0, got %v", got)
+	}
+}
@@ -0,0 +1,300 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Window is the rolling period over which traded notional is capped
+const Window = 24 * time.Hour
+
+// LimitError is returned when an order would take a user past their daily notional cap
+type LimitError struct {
+	Limit     float64 // Cap for the user's KYC tier
+	Used      float64 // Notional traded in the current window
+	Reserved  float64 // Notional held for the user's open orders
+	Remaining float64 // Notional still available in the window
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("daily notional limit exceeded: %.2f of %.2f remaining", e.Remaining, e.Limit)
+}
+
+// usageEntry is a fill counted against a user's daily notional
+type usageEntry struct {
+	notional float64
+	at       time.Time
+}
+
+// userUsage holds a user's fills inside the window, oldest first
+type userUsage struct {
+	entries []usageEntry
+	total   float64
+}
+
+// Engine enforces pre-trade risk limits. It tracks how much notional each
+// user has traded in a rolling window by consuming trade events, and holds
+// the notional of orders that passed the check until they trade or end.
+type Engine struct {
+	mu       sync.Mutex
+	limits   map[int]float64 // Daily notional cap by KYC tier
+	usage    map[int]*userUsage
+	reserved map[int]float64      // Notional held for each user's orders
+	holds    map[int]*Reservation // Reservations by order ID
+}
+
+// NewEngine creates a risk engine with the given daily notional caps by KYC tier
+func NewEngine(limits map[int]float64) *Engine {
+	return &Engine{
+		limits:   limits,
+		usage:    make(map[int]*userUsage),
+		reserved: make(map[int]float64),
+		holds:    make(map[int]*Reservation),
+	}
+}
+
+// Reservation is notional held against a user's daily cap for an order
+// that passed the check, so orders checked at once can't all pass on the
+// same allowance. Fills move notional from it to the user's usage, and
+// what's left is released when the order is filled or canceled.
+type Reservation struct {
+	e        *Engine
+	userID   int
+	orderID  int     // Zero until assigned
+	notional float64 // Still held
+}
+
+// Assign ties the reservation to the order it was made for, so the order's
+// fills and end release it. Call it before the order can match. A
+// reservation for an amended order's increase is added to what the order
+// already holds.
+func (r *Reservation) Assign(orderID int) {
+	r.e.mu.Lock()
+	defer r.e.mu.Unlock()
+	if held, ok := r.e.holds[orderID]; ok {
+		held.notional += r.notional
+		r.notional = 0
+		return
+	}
+	r.orderID = orderID
+	r.e.holds[orderID] = r
+}
+
+// Release returns what's left of the reservation to the user's allowance,
+// for an order that was rejected or has ended
+func (r *Reservation) Release() {
+	r.e.mu.Lock()
+	defer r.e.mu.Unlock()
+	r.e.release(r, r.notional)
+	if r.orderID != 0 {
+		delete(r.e.holds, r.orderID)
+	}
+}
+
+// release returns up to notional of a reservation; callers must hold e.mu
+func (e *Engine) release(r *Reservation, notional float64) {
+	notional = min(notional, r.notional)
+	r.notional -= notional
+	e.reserved[r.userID] -= notional
+	if e.reserved[r.userID] <= 1e-9 {
+		delete(e.reserved, r.userID)
+	}
+}
+
+// SetLimits replaces the daily notional caps by KYC tier
+func (e *Engine) SetLimits(limits map[int]float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limits = limits
+}
+
+// OnTrade is an events.Handler counting both sides of an executed trade
+func (e *Engine) OnTrade(ev events.Event) {
+	trade, ok := ev.Data.(models.Trade)
+	if !ok {
+		return
+	}
+	notional := trade.Price * trade.Quantity
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record(trade.BuyUserID, notional, trade.ExecutedAt)
+	if trade.SellUserID != trade.BuyUserID {
+		e.record(trade.SellUserID, notional, trade.ExecutedAt)
+	}
+	// What traded is now usage rather than held
+	for _, orderID := range []int{trade.BuyOrderID, trade.SellOrderID} {
+		if r, ok := e.holds[orderID]; ok {
+			e.release(r, notional)
+		}
+	}
+}
+
+// OnOrderUpdate is an events.Handler releasing the reservations of orders
+// that are filled or canceled, and shrinking those of amended orders to
+// what's left of them
+func (e *Engine) OnOrderUpdate(ev events.Event) {
+	update, ok := ev.Data.(models.OrderUpdate)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.holds[update.OrderID]
+	if !ok {
+		return
+	}
+	switch update.Event {
+	case "filled", "canceled":
+		e.release(r, r.notional)
+		delete(e.holds, update.OrderID)
+	case "amended":
+		// Increases were reserved against the cap before the amend
+		notional := update.Price * math.Max(update.Quantity-update.FilledQuantity, 0)
+		if notional < r.notional {
+			e.release(r, r.notional-notional)
+		}
+	}
+}
+
+// Hold reserves an order's notional without checking it against the cap,
+// for orders already on the book when the engine starts
+func (e *Engine) Hold(userID, orderID int, notional float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.holds[orderID] = &Reservation{e: e, userID: userID, orderID: orderID, notional: notional}
+	e.reserved[userID] += notional
+}
+
+// Record counts traded notional against a user; fills must be recorded in time order
+func (e *Engine) Record(userID int, notional float64, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record(userID, notional, at)
+}
+
+// record counts traded notional against a user; callers must hold e.mu
+func (e *Engine) record(userID int, notional float64, at time.Time) {
+	if userID == 0 {
+		return
+	}
+
+	u, ok := e.usage[userID]
+	if !ok {
+		u = &userUsage{}
+		e.usage[userID] = u
+	}
+	u.entries = append(u.entries, usageEntry{notional: notional, at: at})
+	u.total += notional
+}
+
+// used returns the user's notional in the window ending at now, evicting
+// expired fills; callers must hold e.mu
+func (e *Engine) used(userID int, now time.Time) float64 {
+	u, ok := e.usage[userID]
+	if !ok {
+		return 0
+	}
+
+	cutoff := now.Add(-Window)
+	for len(u.entries) > 0 && !u.entries[0].at.After(cutoff) {
+		u.total -= u.entries[0].notional
+		u.entries = u.entries[1:]
+	}
+	if len(u.entries) == 0 {
+		delete(e.usage, userID)
+		return 0
+	}
+	return u.total
+}
+
+// Used returns the notional the user has traded in the window ending at now
+func (e *Engine) Used(userID int, now time.Time) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.used(userID, now)
+}
+
+// Reserved returns the notional held for the user's open orders
+func (e *Engine) Reserved(userID int) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.reserved[userID]
+}
+
+// Reserve returns a *LimitError if an order of the given notional could take
+// the user past the daily cap for their KYC tier, counting what's held for
+// their open orders. Otherwise it holds the notional until the returned
+// reservation is released, or assigned and its order ends.
+func (e *Engine) Reserve(userID, kycTier int, notional float64, now time.Time) (*Reservation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.reserve(userID, kycTier, notional, now)
+}
+
+// ReserveAmend returns a *LimitError if amending an order so that notional
+// is left of it could take the user past their cap, as Reserve does for a
+// new order. Otherwise it holds the increase over what the order already
+// holds, if any, until the returned reservation is released or assigned to
+// the order.
+func (e *Engine) ReserveAmend(userID, kycTier, orderID int, notional float64, now time.Time) (*Reservation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if held, ok := e.holds[orderID]; ok {
+		notional -= held.notional
+	}
+	return e.reserve(userID, kycTier, math.Max(notional, 0), now)
+}
+
+// reserve holds notional for an order if it keeps the user within their
+// cap; callers must hold e.mu
+func (e *Engine) reserve(userID, kycTier int, notional float64, now time.Time) (*Reservation, error) {
+	if limit, ok := e.limits[kycTier]; ok {
+		used, reserved := e.used(userID, now), e.reserved[userID]
+		if used+reserved+notional > limit {
+			remaining := math.Max(limit-used-reserved, 0)
+			return nil, &LimitError{Limit: limit, Used: used, Reserved: reserved, Remaining: remaining}
+		}
+	}
+	e.reserved[userID] += notional
+	return &Reservation{e: e, userID: userID, notional: notional}, nil
+}
+
+// Per-order limits an OrderLimitError can name
+const (
+	LimitOrderNotional = "max_order_notional"
+	LimitOrderQuantity = "max_order_quantity"
+	LimitOpenOrders    = "max_open_orders"
+)
+
+// OrderLimitError is returned when an order breaks one of a user's per-order limits
+type OrderLimitError struct {
+	Limit string  // Which limit, e.g. LimitOrderQuantity
+	Max   float64 // The user's limit
+	Value float64 // The order's notional or quantity, or the open orders including it
+}
+
+func (e *OrderLimitError) Error() string {
+	return fmt.Sprintf("%s exceeded: %g above %g", e.Limit, e.Value, e.Max)
+}
+
+// CheckOrderLimits returns an *OrderLimitError if an order breaks the user's
+// per-order limits, given how many orders the user already has open
+func CheckOrderLimits(limits models.OrderLimits, price, quantity float64, openOrders int) error {
+	if notional := price * quantity; limits.MaxOrderNotional > 0 && notional > limits.MaxOrderNotional {
+		return &OrderLimitError{Limit: LimitOrderNotional, Max: limits.MaxOrderNotional, Value: notional}
+	}
+	if limits.MaxOrderQuantity > 0 && quantity > limits.MaxOrderQuantity {
+		return &OrderLimitError{Limit: LimitOrderQuantity, Max: limits.MaxOrderQuantity, Value: quantity}
+	}
+	if limits.MaxOpenOrders > 0 && openOrders+1 > limits.MaxOpenOrders {
+		return &OrderLimitError{Limit: LimitOpenOrders, Max: float64(limits.MaxOpenOrders), Value: float64(openOrders + 1)}
+	}
+	return nil
+}
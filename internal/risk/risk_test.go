@@ -0,0 +1,242 @@
+package risk
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestEngine_Reserve(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine(map[int]float64{0: 1000, 1: 5000})
+
+	// User 1 buys 600 from user 2, then 300 more twelve hours later
+	engine.OnTrade(events.Event{Type: events.TradeExecuted, Data: models.Trade{
+		BuyUserID: 1, SellUserID: 2, Price: 100, Quantity: 6, ExecutedAt: start,
+	}})
+	engine.OnTrade(events.Event{Type: events.TradeExecuted, Data: models.Trade{
+		BuyUserID: 1, SellUserID: 2, Price: 100, Quantity: 3, ExecutedAt: start.Add(12 * time.Hour),
+	}})
+
+	tests := []struct {
+		name            string
+		userID          int
+		tier            int
+		notional        float64
+		now             time.Time
+		expectRejection bool
+		expectRemaining float64
+	}{
+		{
+			name:     "WithinLimit",
+			userID:   1,
+			notional: 100,
+			now:      start.Add(13 * time.Hour),
+		},
+		{
+			name:            "ExceedsLimit",
+			userID:          1,
+			notional:        101,
+			now:             start.Add(13 * time.Hour),
+			expectRejection: true,
+			expectRemaining: 100,
+		},
+		{
+			name:     "FirstFillRolledOff",
+			userID:   1,
+			notional: 700,
+			now:      start.Add(25 * time.Hour),
+		},
+		{
+			name:     "HigherTier",
+			userID:   2,
+			tier:     1,
+			notional: 4000,
+			now:      start.Add(13 * time.Hour),
+		},
+		{
+			name:     "UnlimitedTier",
+			userID:   2,
+			tier:     9,
+			notional: 1e9,
+			now:      start.Add(13 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hold, err := engine.Reserve(tt.userID, tt.tier, tt.notional, tt.now)
+			if !tt.expectRejection {
+				if err != nil {
+					t.Fatalf("unexpected rejection: %v", err)
+				}
+				hold.Release()
+				return
+			}
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected LimitError, got %v", err)
+			}
+			if limitErr.Remaining != tt.expectRemaining {
+				t.Errorf("expected %v remaining, got %v", tt.expectRemaining, limitErr.Remaining)
+			}
+		})
+	}
+}
+
+func TestEngine_ReservationsHoldAllowance(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine(map[int]float64{0: 1000})
+
+	// Orders checked before either trades can't both use the allowance
+	first, err := engine.Reserve(1, 0, 600, now)
+	if err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	first.Assign(10)
+	_, err = engine.Reserve(1, 0, 600, now)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	if limitErr.Reserved != 600 || limitErr.Remaining != 400 {
+		t.Errorf("expected 600 reserved and 400 remaining, got %+v", limitErr)
+	}
+
+	// A fill moves notional from the reservation to usage
+	engine.OnTrade(events.Event{Type: events.TradeExecuted, Data: models.Trade{
+		BuyOrderID: 10, BuyUserID: 1, SellOrderID: 20, SellUserID: 2, Price: 100, Quantity: 2, ExecutedAt: now,
+	}})
+	if used, reserved := engine.Used(1, now), engine.Reserved(1); used != 200 || reserved != 400 {
+		t.Errorf("expected 200 used and 400 reserved, got %v and %v", used, reserved)
+	}
+
+	// Canceling the order releases the rest
+	engine.OnOrderUpdate(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: "canceled", OrderID: 10}})
+	if reserved := engine.Reserved(1); reserved != 0 {
+		t.Errorf("expected nothing reserved, got %v", reserved)
+	}
+	second, err := engine.Reserve(1, 0, 800, now)
+	if err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+
+	// A rejected order's reservation is released unassigned
+	second.Release()
+	if reserved := engine.Reserved(1); reserved != 0 {
+		t.Errorf("expected nothing reserved, got %v", reserved)
+	}
+}
+
+func TestEngine_ReserveAmend(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine(map[int]float64{0: 1000})
+
+	hold, err := engine.Reserve(1, 0, 400, now)
+	if err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	hold.Assign(10)
+
+	// Amending up only needs the increase to fit, and it can't take the user
+	// past the cap
+	var limitErr *LimitError
+	if _, err := engine.ReserveAmend(1, 0, 10, 1100, now); !errors.As(err, &limitErr) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	if limitErr.Remaining != 600 {
+		t.Errorf("expected 600 remaining, got %v", limitErr.Remaining)
+	}
+	increase, err := engine.ReserveAmend(1, 0, 10, 900, now)
+	if err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	increase.Assign(10)
+	engine.OnOrderUpdate(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: "amended", OrderID: 10, Price: 100, Quantity: 9}})
+	if reserved := engine.Reserved(1); reserved != 900 {
+		t.Errorf("expected 900 reserved, got %v", reserved)
+	}
+
+	// A rejected amend releases its increase, and amending down shrinks the
+	// order's reservation
+	increase, err = engine.ReserveAmend(1, 0, 10, 1000, now)
+	if err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	increase.Release()
+	engine.OnOrderUpdate(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: "amended", OrderID: 10, Price: 100, Quantity: 5, FilledQuantity: 2}})
+	if reserved := engine.Reserved(1); reserved != 300 {
+		t.Errorf("expected 300 reserved, got %v", reserved)
+	}
+
+	// Canceling the order releases all of it
+	engine.OnOrderUpdate(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: "canceled", OrderID: 10}})
+	if reserved := engine.Reserved(1); reserved != 0 {
+		t.Errorf("expected nothing reserved, got %v", reserved)
+	}
+}
+
+func TestEngine_ConcurrentReservations(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine(map[int]float64{0: 1000})
+
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := engine.Reserve(1, 0, 100, now); err == nil {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if passed.Load() != 10 {
+		t.Errorf("expected 10 orders within the cap, got %d", passed.Load())
+	}
+}
+
+func TestCheckOrderLimits(t *testing.T) {
+	limits := models.OrderLimits{MaxOrderNotional: 1000, MaxOrderQuantity: 5, MaxOpenOrders: 3}
+
+	tests := []struct {
+		name       string
+		limits     models.OrderLimits
+		price      float64
+		quantity   float64
+		openOrders int
+		expected   string // Limit broken, or empty
+	}{
+		{name: "WithinLimits", limits: limits, price: 200, quantity: 5, openOrders: 2},
+		{name: "NotionalAboveLimit", limits: limits, price: 250, quantity: 5, openOrders: 0, expected: LimitOrderNotional},
+		{name: "QuantityAboveLimit", limits: limits, price: 100, quantity: 6, openOrders: 0, expected: LimitOrderQuantity},
+		{name: "TooManyOpenOrders", limits: limits, price: 100, quantity: 1, openOrders: 3, expected: LimitOpenOrders},
+		{name: "Unlimited", price: 1e6, quantity: 1e6, openOrders: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckOrderLimits(tt.limits, tt.price, tt.quantity, tt.openOrders)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			limitErr, ok := err.(*OrderLimitError)
+			if !ok {
+				t.Fatalf("expected *OrderLimitError, got %v", err)
+			}
+			if limitErr.Limit != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, limitErr.Limit)
+			}
+		})
+	}
+}
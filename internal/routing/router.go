@@ -0,0 +1,212 @@
+// Package routing sends order entry to the region hosting the matching
+// leader, so gateways can serve clients from regions other than the
+// leader's.
+//
+// The leader is read from a LeaderSource on every request. There is no HA
+// metadata service yet, so the only source is Static, set from
+// configuration; one backed by HA metadata can replace it without changing
+// the router.
+package routing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Region is a deployment of the exchange gateway
+type Region struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // Base URL of the region's gateway, e.g. "https://eu.exchange.example"
+}
+
+// LeaderSource reports the region currently hosting the matching leader
+type LeaderSource interface {
+	Leader(ctx context.Context) (Region, error)
+}
+
+// Static is a LeaderSource whose leader never changes
+type Static Region
+
+// Leader returns the configured leader
+func (s Static) Leader(ctx context.Context) (Region, error) {
+	return Region(s), nil
+}
+
+// How order entry reaches a remote leader
+const (
+	Forward  = "forward"  // Proxy the request to the leader and relay its response
+	Redirect = "redirect" // Answer 307 so the client resends the request to the leader
+)
+
+// Headers naming the leader, sent with every routed response so clients can
+// send order entry to the leader's region directly
+const (
+	LeaderRegionHeader = "X-Exchange-Leader-Region"
+	LeaderURLHeader    = "X-Exchange-Leader-Url"
+
+	// ForwardedByHeader names the region a request was forwarded from
+	ForwardedByHeader = "X-Exchange-Forwarded-By"
+)
+
+// ErrForwardLoop is returned for a request forwarded from another region to
+// one that isn't the leader either, i.e. when regions disagree on the leader
+var ErrForwardLoop = errors.New("request forwarded to a region that isn't the leader")
+
+// ewmaWeight is the weight of the latest round trip in a region's average
+const ewmaWeight = 0.2
+
+// RegionStats summarizes requests forwarded to a region
+type RegionStats struct {
+	Region      string    `json:"region"`
+	Forwarded   int       `json:"forwarded"`
+	Failed      int       `json:"failed"`     // Requests that got no response from the region
+	LatencyMs   float64   `json:"latency_ms"` // Moving average round trip, including the leader's processing
+	LastLatency float64   `json:"last_latency_ms"`
+	LastAt      time.Time `json:"last_at"`
+}
+
+// Router decides whether order entry is served locally or sent to the
+// leader's region, and measures the round trip of what it forwards
+type Router struct {
+	Local     string // Name of the region this gateway runs in
+	Leader    LeaderSource
+	Mode      string            // Forward or Redirect
+	Transport http.RoundTripper // Used to forward requests; nil uses http.DefaultTransport
+
+	mu    sync.Mutex
+	stats map[string]*RegionStats
+}
+
+// NewRouter creates a router for a gateway in the local region
+func NewRouter(local string, leader LeaderSource, mode string) *Router {
+	return &Router{
+		Local:  local,
+		Leader: leader,
+		Mode:   mode,
+		stats:  make(map[string]*RegionStats),
+	}
+}
+
+// Route returns the leader's region and whether it is this one. Requests
+// already forwarded from another region must be served here, so they return
+// ErrForwardLoop unless this region leads.
+func (rt *Router) Route(r *http.Request) (Region, bool, error) {
+	leader, err := rt.Leader.Leader(r.Context())
+	if err != nil {
+		return Region{}, false, err
+	}
+	if leader.Name == rt.Local {
+		return leader, true, nil
+	}
+	if r.Header.Get(ForwardedByHeader) != "" {
+		return leader, false, ErrForwardLoop
+	}
+	return leader, false, nil
+}
+
+// Hint names the leader in a response's headers
+func Hint(w http.ResponseWriter, leader Region) {
+	w.Header().Set(LeaderRegionHeader, leader.Name)
+	if leader.URL != "" {
+		w.Header().Set(LeaderURLHeader, leader.URL)
+	}
+}
+
+// Send serves a request whose leader is in another region, forwarding it or
+// redirecting the client there depending on the mode
+func (rt *Router) Send(w http.ResponseWriter, r *http.Request, leader Region) {
+	Hint(w, leader)
+	target, err := url.Parse(leader.URL)
+	if err != nil || leader.URL == "" {
+		log.Printf("Invalid URL %q for leader region %s", leader.URL, leader.Name)
+		writeError(w, http.StatusServiceUnavailable, "Matching leader unavailable")
+		return
+	}
+
+	if rt.Mode == Redirect {
+		w.Header().Set("Location", target.JoinPath(r.URL.Path).String()+queryString(r.URL))
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		return
+	}
+
+	failed := false
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(ForwardedByHeader, rt.Local)
+		},
+		Transport: rt.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			failed = true
+			log.Printf("Failed to forward %s %s to region %s: %v", r.Method, r.URL.Path, leader.Name, err)
+			writeError(w, http.StatusBadGateway, "Matching leader unreachable")
+		},
+	}
+	start := time.Now()
+	proxy.ServeHTTP(w, r)
+	rt.record(leader.Name, time.Since(start), failed)
+}
+
+// record adds a forwarded request's round trip to the region's stats
+func (rt *Router) record(region string, elapsed time.Duration, failed bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.stats == nil {
+		rt.stats = make(map[string]*RegionStats)
+	}
+	s, ok := rt.stats[region]
+	if !ok {
+		s = &RegionStats{Region: region}
+		rt.stats[region] = s
+	}
+	if failed {
+		s.Failed++
+		return
+	}
+
+	ms := float64(elapsed) / float64(time.Millisecond)
+	if s.Forwarded == 0 {
+		s.LatencyMs = ms
+	} else {
+		s.LatencyMs += ewmaWeight * (ms - s.LatencyMs)
+	}
+	s.Forwarded++
+	s.LastLatency = ms
+	s.LastAt = time.Now()
+}
+
+// Stats returns the forwarding stats of each region requests were sent to,
+// by region name
+func (rt *Router) Stats() []RegionStats {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	stats := make([]RegionStats, 0, len(rt.stats))
+	for _, s := range rt.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Region < stats[j].Region })
+	return stats
+}
+
+// queryString returns the URL's query with its leading "?", if it has one
+func queryString(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// writeError writes a JSON error response like the API's
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"error":"` + message + `"}`))
+}
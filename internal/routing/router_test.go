@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter_Route(t *testing.T) {
+	router := NewRouter("eu", Static{Name: "us", URL: "https://us.example.com"}, Forward)
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	leader, local, err := router.Route(req)
+	if err != nil || local || leader.Name != "us" {
+		t.Errorf("expected remote leader us, got %+v, local %v, err %v", leader, local, err)
+	}
+
+	// A request forwarded here from another region must not be sent on
+	req.Header.Set(ForwardedByHeader, "ap")
+	if _, _, err := router.Route(req); !errors.Is(err, ErrForwardLoop) {
+		t.Errorf("expected ErrForwardLoop, got %v", err)
+	}
+
+	router.Local = "us"
+	if _, local, err := router.Route(req); err != nil || !local {
+		t.Errorf("expected the leader to serve forwarded requests, got local %v, err %v", local, err)
+	}
+}
+
+func TestRouter_Forward(t *testing.T) {
+	var forwardedBy, body string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(ForwardedByHeader)
+		data, _ := io.ReadAll(r.Body)
+		body = r.Method + " " + r.URL.RequestURI() + " " + string(data)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"order_id":1}`))
+	}))
+	defer leader.Close()
+
+	router := NewRouter("eu", Static{Name: "us", URL: leader.URL}, Forward)
+	req := httptest.NewRequest("POST", "/orders?timestamp=1", strings.NewReader(`{"type":"buy"}`))
+	w := httptest.NewRecorder()
+	router.Send(w, req, Region{Name: "us", URL: leader.URL})
+
+	if w.Code != http.StatusCreated || w.Body.String() != `{"order_id":1}` {
+		t.Errorf("expected the leader's response, got %d %s", w.Code, w.Body.String())
+	}
+	if body != `POST /orders?timestamp=1 {"type":"buy"}` || forwardedBy != "eu" {
+		t.Errorf("unexpected forwarded request %q from %q", body, forwardedBy)
+	}
+	if w.Header().Get(LeaderRegionHeader) != "us" || w.Header().Get(LeaderURLHeader) != leader.URL {
+		t.Errorf("missing leader hints: %v", w.Header())
+	}
+
+	stats := router.Stats()
+	if len(stats) != 1 || stats[0].Region != "us" || stats[0].Forwarded != 1 || stats[0].LatencyMs <= 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// An unreachable leader is reported as a failure
+	leader.Close()
+	w = httptest.NewRecorder()
+	router.Send(w, httptest.NewRequest("POST", "/orders", nil), Region{Name: "us", URL: leader.URL})
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+	if stats := router.Stats(); stats[0].Failed != 1 || stats[0].Forwarded != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestRouter_Redirect(t *testing.T) {
+	router := NewRouter("eu", Static{}, Redirect)
+	req := httptest.NewRequest("DELETE", "/orders/5?timestamp=1", nil)
+	w := httptest.NewRecorder()
+	router.Send(w, req, Region{Name: "us", URL: "https://us.example.com/"})
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("expected 307, got %d", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "https://us.example.com/orders/5?timestamp=1" {
+		t.Errorf("unexpected Location %q", got)
+	}
+	if len(router.Stats()) != 0 {
+		t.Errorf("redirects shouldn't be counted as forwarded")
+	}
+}
@@ -0,0 +1,162 @@
+// Package settlement calculates the official daily settlement price of each
+// instrument.
+//
+// A day's settlement price is the volume-weighted average price of the
+// trades in the closing window, the last Window of the UTC day. If nothing
+// traded in the window it falls back to the day's last trade, and if nothing
+// traded all day to the previous day's settlement. Statements value balances
+// at it and it becomes the close of the day's candle.
+package settlement
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Settlement methods, from preferred to last resort
+const (
+	MethodVWAP      = "vwap"       // Volume-weighted average price of the closing window
+	MethodLastTrade = "last_trade" // Last trade of the day, when none were in the window
+	MethodPrevious  = "previous"   // Previous settlement, when nothing traded all day
+)
+
+// DayLayout is the layout of settlement days, e.g. "2024-01-01"
+const DayLayout = "2006-01-02"
+
+// settleDelay is how long after midnight a day is settled, so trades matched
+// just before midnight are recorded first
+const settleDelay = 5 * time.Minute
+
+// Calculate returns the settlement of an instrument for the day closing at
+// closeAt from its trades that day, oldest first, and the previous
+// settlement, or nil. It reports false if there is no price to settle at.
+func Calculate(inst instruments.Instrument, trades []models.ReportedTrade, closeAt time.Time, window time.Duration, previous *models.Settlement) (models.Settlement, bool) {
+	settlement := models.Settlement{Symbol: inst.Symbol, Day: closeAt.Add(-time.Nanosecond).UTC().Format(DayLayout)}
+
+	var notional float64
+	windowStart := closeAt.Add(-window)
+	for _, trade := range trades {
+		if trade.Symbol != inst.Symbol || trade.ExecutedAt.Before(windowStart) {
+			continue
+		}
+		notional += trade.Price * trade.Quantity
+		settlement.Volume += trade.Quantity
+		settlement.Trades++
+	}
+	if settlement.Trades > 0 {
+		settlement.Price = inst.RoundPrice(notional / settlement.Volume)
+		settlement.Method = MethodVWAP
+		return settlement, true
+	}
+
+	for i := len(trades) - 1; i >= 0; i-- {
+		if trades[i].Symbol == inst.Symbol {
+			settlement.Price = trades[i].Price
+			settlement.Method = MethodLastTrade
+			settlement.Volume = trades[i].Quantity
+			settlement.Trades = 1
+			return settlement, true
+		}
+	}
+
+	if previous == nil {
+		return models.Settlement{}, false
+	}
+	settlement.Price = previous.Price
+	settlement.Method = MethodPrevious
+	return settlement, true
+}
+
+// Settler calculates and records daily settlement prices
+type Settler struct {
+	DB     *db.DB
+	Window time.Duration // Closing window the volume-weighted price is taken over
+
+	mu sync.Mutex // Serializes settling so a day isn't settled twice at once
+}
+
+// NewSettler creates a settler using a closing window
+func NewSettler(database *db.DB, window time.Duration) *Settler {
+	return &Settler{DB: database, Window: window}
+}
+
+// Settle calculates and records the settlement of every instrument for the
+// UTC day containing t, replacing any earlier settlement of that day, and
+// sets the day's candle close to it. Instruments that have never traded
+// aren't settled.
+func (s *Settler) Settle(ctx context.Context, t time.Time) ([]models.Settlement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	trades, err := s.DB.GetTradesBetween(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	settlements := []models.Settlement{}
+	for _, inst := range instruments.All {
+		previous, err := s.DB.GetPreviousSettlement(ctx, inst.Symbol, start.Format(DayLayout))
+		if err != nil {
+			return nil, err
+		}
+		settlement, ok := Calculate(inst, trades, end, s.Window, previous)
+		if !ok {
+			continue
+		}
+		if err := s.DB.SaveSettlement(ctx, &settlement); err != nil {
+			return nil, err
+		}
+		// Candles are only kept for the default instrument
+		if inst.Symbol == exchange.DefaultSymbol {
+			if err := s.DB.SetDailyClose(ctx, start, settlement.Price); err != nil {
+				return nil, err
+			}
+		}
+		settlements = append(settlements, settlement)
+	}
+	return settlements, nil
+}
+
+// SettleDue settles the previous day once it is over, if it hasn't been
+func (s *Settler) SettleDue(ctx context.Context, now time.Time) error {
+	yesterday := now.UTC().Add(-settleDelay).AddDate(0, 0, -1)
+	existing, err := s.DB.GetSettlement(ctx, exchange.DefaultSymbol, yesterday.Format(DayLayout))
+	if err != nil || existing != nil {
+		return err
+	}
+	settlements, err := s.Settle(ctx, yesterday)
+	if err != nil {
+		return err
+	}
+	for _, settlement := range settlements {
+		log.Printf("Settled %s for %s at %g (%s)", settlement.Symbol, settlement.Day, settlement.Price, settlement.Method)
+	}
+	return nil
+}
+
+// Run settles each day once it is over, checking every interval until ctx
+// is done. Failures are retried on the next check.
+func (s *Settler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.SettleDue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to settle: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
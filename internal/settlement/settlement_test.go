@@ -0,0 +1,73 @@
+package settlement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/exchange"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func trade(price, quantity float64, at string) models.ReportedTrade {
+	executedAt, _ := time.Parse(time.RFC3339, at)
+	return models.ReportedTrade{AccountingTrade: models.AccountingTrade{
+		Symbol: exchange.DefaultSymbol, Price: price, Quantity: quantity, ExecutedAt: executedAt,
+	}}
+}
+
+func TestCalculate(t *testing.T) {
+	inst, _ := instruments.Lookup(exchange.DefaultSymbol)
+	closeAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	previous := &models.Settlement{Symbol: exchange.DefaultSymbol, Day: "2023-12-31", Price: 42000}
+
+	tests := []struct {
+		name     string
+		trades   []models.ReportedTrade
+		previous *models.Settlement
+		price    float64
+		method   string
+		volume   float64
+	}{
+		{
+			name: "volume-weighted over the closing window",
+			trades: []models.ReportedTrade{
+				trade(10000, 5, "2024-01-01T12:00:00Z"), // Before the window
+				trade(100, 1, "2024-01-01T23:30:00Z"),
+				trade(103, 2, "2024-01-01T23:59:59Z"),
+			},
+			previous: previous,
+			price:    102, method: MethodVWAP, volume: 3,
+		},
+		{
+			name:   "rounded to the price precision",
+			trades: []models.ReportedTrade{trade(100, 1, "2024-01-01T23:45:00Z"), trade(100.01, 2, "2024-01-01T23:50:00Z")},
+			price:  100.01, method: MethodVWAP, volume: 3,
+		},
+		{
+			name:   "last trade when the window is quiet",
+			trades: []models.ReportedTrade{trade(101, 1, "2024-01-01T09:00:00Z"), trade(99, 0.5, "2024-01-01T18:00:00Z")},
+			price:  99, method: MethodLastTrade, volume: 0.5,
+		},
+		{
+			name:     "previous settlement when nothing traded",
+			previous: previous,
+			price:    42000, method: MethodPrevious,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Calculate(inst, tt.trades, closeAt, 30*time.Minute, tt.previous)
+			if !ok {
+				t.Fatalf("expected a settlement")
+			}
+			if got.Day != "2024-01-01" || got.Price != tt.price || got.Method != tt.method || got.Volume != tt.volume {
+				t.Errorf("expected %s at %v on volume %v, got %+v", tt.method, tt.price, tt.volume, got)
+			}
+		})
+	}
+
+	if got, ok := Calculate(inst, nil, closeAt, 30*time.Minute, nil); ok {
+		t.Errorf("expected no settlement for an instrument that never traded, got %+v", got)
+	}
+}
@@ -0,0 +1,258 @@
+// Package statements generates each user's daily account statement.
+//
+// A statement holds the trades a user made on one UTC day, the fees they
+// paid and their balances at the end of the day, valued at the day's
+// settlement prices. Statements are generated for every user with a balance
+// shortly after the day is settled and kept as generated; admins can
+// generate any day again, e.g. one missed while the server was down.
+package statements
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/instruments"
+	"github.com/xtrntr/exchange/internal/models"
+	"github.com/xtrntr/exchange/internal/settlement"
+)
+
+// generateDelay is how long after midnight a day's statements are
+// generated. It is longer than settlement's delay, so the day they settle
+// is the one statements are generated for.
+const generateDelay = 10 * time.Minute
+
+// Prices returns the prices balances are valued at on a UTC day, in the
+// quote currency of the instruments: each base asset at its instrument's
+// settlement price, if it was settled that day, and the quote currency at
+// par. It also returns the quote currency.
+func Prices(ctx context.Context, database *db.DB, day string) (map[string]float64, string, error) {
+	quote := instruments.All[0].Quote
+	prices := map[string]float64{quote: 1}
+	for _, inst := range instruments.All {
+		if inst.Quote != quote {
+			continue
+		}
+		s, err := database.GetSettlement(ctx, inst.Symbol, day)
+		if err != nil {
+			return nil, "", err
+		}
+		if s != nil {
+			prices[inst.Base] = s.Price
+		}
+	}
+	return prices, quote, nil
+}
+
+// Value returns the statement lines of balances valued at prices, and their
+// total value. Assets without a price aren't valued.
+func Value(balances []models.Balance, prices map[string]float64) ([]models.StatementBalance, float64) {
+	lines := []models.StatementBalance{}
+	var total float64
+	for _, balance := range balances {
+		line := models.StatementBalance{Asset: balance.Asset, Amount: balance.Amount}
+		if price, ok := prices[balance.Asset]; ok {
+			value := balance.Amount * price
+			line.Price, line.Value = &price, &value
+			total += value
+		}
+		lines = append(lines, line)
+	}
+	return lines, total
+}
+
+// Fees totals the fees paid on trades by asset, ordered by asset. Fees are
+// charged in the quote currency of the trade's instrument.
+func Fees(trades []models.UserTrade) []models.Balance {
+	totals := make(map[string]float64)
+	for _, trade := range trades {
+		inst, ok := instruments.Lookup(trade.Symbol)
+		if !ok || trade.Fee == 0 {
+			continue
+		}
+		totals[inst.Quote] += trade.Fee
+	}
+	fees := []models.Balance{}
+	for asset, amount := range totals {
+		fees = append(fees, models.Balance{Asset: asset, Amount: amount})
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Asset < fees[j].Asset })
+	return fees
+}
+
+// Generator generates and stores daily statements
+type Generator struct {
+	DB      *db.DB
+	Settler *settlement.Settler // Settles a day before its statements value balances; nil to rely on it settling first
+
+	mu sync.Mutex // Serializes generation so a day isn't generated twice at once
+}
+
+// NewGenerator creates a generator valuing balances at the prices settler
+// records
+func NewGenerator(database *db.DB, settler *settlement.Settler) *Generator {
+	return &Generator{DB: database, Settler: settler}
+}
+
+// Build returns a user's statement for the UTC day starting at start,
+// without storing it
+func (g *Generator) Build(ctx context.Context, userID int, start time.Time) (models.Statement, error) {
+	end := start.AddDate(0, 0, 1)
+	statement := models.Statement{UserID: userID, Day: start.Format(settlement.DayLayout), Trades: []models.UserTrade{}}
+
+	filter := db.TradeFilter{Since: start, Until: end}
+	for {
+		page := db.Page{Limit: db.MaxPageLimit, Offset: len(statement.Trades)}
+		trades, err := g.DB.GetUserTradeHistory(ctx, userID, filter, page)
+		if err != nil {
+			return models.Statement{}, err
+		}
+		for i := range trades {
+			if inst, ok := instruments.Lookup(trades[i].Symbol); ok {
+				trades[i].FeeCurrency = inst.Quote
+			}
+		}
+		statement.Trades = append(statement.Trades, trades...)
+		if len(trades) < db.MaxPageLimit {
+			break
+		}
+	}
+	statement.Fees = Fees(statement.Trades)
+
+	balances, err := g.DB.GetBalancesAt(ctx, userID, end)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	prices, quote, err := Prices(ctx, g.DB, statement.Day)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	statement.Balances, statement.Value = Value(balances, prices)
+	statement.ValueAsset = quote
+	return statement, nil
+}
+
+// Generate builds and stores the statement of the UTC day containing t for
+// every user with ledger entries by the end of it, replacing any earlier
+// statements of that day. Returns how many were stored.
+func (g *Generator) Generate(ctx context.Context, t time.Time) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	userIDs, err := g.DB.GetLedgerUserIDs(ctx, start.AddDate(0, 0, 1))
+	if err != nil {
+		return 0, err
+	}
+	for i, userID := range userIDs {
+		statement, err := g.Build(ctx, userID, start)
+		if err != nil {
+			return i, err
+		}
+		if err := g.DB.SaveStatement(ctx, &statement); err != nil {
+			return i, err
+		}
+	}
+	return len(userIDs), nil
+}
+
+// generateDue generates the previous day's statements once it is over and
+// settled, if they haven't been
+func (g *Generator) generateDue(ctx context.Context, now time.Time) error {
+	if g.Settler != nil {
+		if err := g.Settler.SettleDue(ctx, now); err != nil {
+			return err
+		}
+	}
+	yesterday := now.UTC().Add(-generateDelay).AddDate(0, 0, -1)
+	day := yesterday.Format(settlement.DayLayout)
+	generated, err := g.DB.StatementsGenerated(ctx, day)
+	if err != nil || generated {
+		return err
+	}
+	n, err := g.Generate(ctx, yesterday)
+	if err != nil {
+		return err
+	}
+	log.Printf("Generated %d statements for %s", n, day)
+	return nil
+}
+
+// Run generates each day's statements once it is over, checking every
+// interval until ctx is done. Failures are retried on the next check.
+func (g *Generator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := g.generateDue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to generate statements: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// csvHeader heads the CSV rendering of statements. Each row is a trade, the
+// total fees in an asset, a balance, or a statement's total value, filling
+// in the columns that apply.
+var csvHeader = []string{"record", "day", "trade_id", "order_id", "executed_at", "symbol", "side", "role", "price", "quantity", "fee", "asset", "amount", "value"}
+
+// WriteCSV renders statements as CSV, one after another under one header
+func WriteCSV(w io.Writer, statements ...models.Statement) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, statement := range statements {
+		row := func(record string, fields map[string]string) {
+			line := make([]string, len(csvHeader))
+			line[0], line[1] = record, statement.Day
+			for i, column := range csvHeader {
+				if v, ok := fields[column]; ok {
+					line[i] = v
+				}
+			}
+			cw.Write(line)
+		}
+
+		for _, trade := range statement.Trades {
+			row("trade", map[string]string{
+				"trade_id":    strconv.Itoa(trade.ID),
+				"order_id":    strconv.Itoa(trade.OrderID),
+				"executed_at": trade.ExecutedAt.UTC().Format(time.RFC3339Nano),
+				"symbol":      trade.Symbol,
+				"side":        trade.Side,
+				"role":        trade.Role,
+				"price":       formatFloat(trade.Price),
+				"quantity":    formatFloat(trade.Quantity),
+				"fee":         formatFloat(trade.Fee),
+			})
+		}
+		for _, fee := range statement.Fees {
+			row("fee", map[string]string{"asset": fee.Asset, "amount": formatFloat(fee.Amount)})
+		}
+		for _, balance := range statement.Balances {
+			fields := map[string]string{"asset": balance.Asset, "amount": formatFloat(balance.Amount)}
+			if balance.Price != nil {
+				fields["price"], fields["value"] = formatFloat(*balance.Price), formatFloat(*balance.Value)
+			}
+			row("balance", fields)
+		}
+		row("total", map[string]string{"asset": statement.ValueAsset, "value": formatFloat(statement.Value)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatFloat formats a number in plain decimals
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
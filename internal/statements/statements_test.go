@@ -0,0 +1,68 @@
+package statements
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestValue(t *testing.T) {
+	balances := []models.Balance{{Asset: "BTC", Amount: 0.5}, {Asset: "POINTS", Amount: 5}, {Asset: "USD", Amount: -100}}
+	lines, total := Value(balances, map[string]float64{"BTC": 50000, "USD": 1})
+	if len(lines) != 3 || total != 24900 {
+		t.Fatalf("expected three lines worth 24900, got %+v worth %v", lines, total)
+	}
+	if lines[0].Value == nil || *lines[0].Value != 25000 || *lines[0].Price != 50000 {
+		t.Errorf("expected BTC valued at 25000, got %+v", lines[0])
+	}
+	if lines[1].Price != nil || lines[1].Value != nil {
+		t.Errorf("expected an asset without a price not to be valued, got %+v", lines[1])
+	}
+}
+
+func TestFees(t *testing.T) {
+	fees := Fees([]models.UserTrade{
+		{Symbol: "BTC-USD", Fee: 0.25},
+		{Symbol: "BTC-USD", Fee: 0.5},
+		{Symbol: "BTC-USD"},
+		{Symbol: "ETH-USD", Fee: 1},
+	})
+	if len(fees) != 1 || fees[0] != (models.Balance{Asset: "USD", Amount: 0.75}) {
+		t.Errorf("expected 0.75 USD of fees from listed instruments, got %+v", fees)
+	}
+	if fees := Fees(nil); fees == nil || len(fees) != 0 {
+		t.Errorf("expected no fees as an empty list, got %#v", fees)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	price, value := 50000.0, 25000.0
+	statement := models.Statement{
+		Day: "2024-01-01",
+		Trades: []models.UserTrade{{
+			ID: 7, OrderID: 3, Symbol: "BTC-USD", Side: "buy", Role: "taker", Price: 50000, Quantity: 0.5, Fee: 0.25,
+			ExecutedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		}},
+		Fees:       []models.Balance{{Asset: "USD", Amount: 0.25}},
+		Balances:   []models.StatementBalance{{Asset: "BTC", Amount: 0.5, Price: &price, Value: &value}, {Asset: "POINTS", Amount: 5}},
+		Value:      25000,
+		ValueAsset: "USD",
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, statement); err != nil {
+		t.Fatal(err)
+	}
+	want := `record,day,trade_id,order_id,executed_at,symbol,side,role,price,quantity,fee,asset,amount,value
+trade,2024-01-01,7,3,2024-01-01T12:00:00Z,BTC-USD,buy,taker,50000,0.5,0.25,,,
+fee,2024-01-01,,,,,,,,,,USD,0.25,
+balance,2024-01-01,,,,,,,50000,,,BTC,0.5,25000
+balance,2024-01-01,,,,,,,,,,POINTS,5,
+total,2024-01-01,,,,,,,,,,USD,,25000
+`
+	if buf.String() != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
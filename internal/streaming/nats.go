@@ -0,0 +1,69 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsBufferSize is how many bytes of messages are buffered while
+// reconnecting to the server before publishing fails
+const natsBufferSize = 32 * 1024 * 1024
+
+// natsFlushTimeout bounds how long a flush waits for the server
+const natsFlushTimeout = 5 * time.Second
+
+// NATSPublisher publishes to a NATS server. The client buffers messages and
+// sends them from its own goroutine, and reconnects for as long as it runs.
+type NATSPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATSPublisher connects to the NATS server at url, identifying as name.
+// It doesn't fail if the server is down, but keeps trying in the background.
+func NewNATSPublisher(url, name string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url,
+		nats.Name(name),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectBufSize(natsBufferSize),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Disconnected from NATS: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", conn.ConnectedUrlRedacted())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &NATSPublisher{conn: conn}, nil
+}
+
+// Publish queues a message for subject. The ID is sent as the Nats-Msg-Id
+// header, which JetStream streams use to discard duplicates.
+func (p *NATSPublisher) Publish(subject, id string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(nats.MsgIdHdr, id)
+	msg.Data = data
+	return p.conn.PublishMsg(msg)
+}
+
+// Flush waits up to natsFlushTimeout for the server to receive every
+// message queued so far
+func (p *NATSPublisher) Flush() error {
+	if err := p.conn.FlushTimeout(natsFlushTimeout); err != nil {
+		return fmt.Errorf("failed to flush NATS messages: %w", err)
+	}
+	return nil
+}
+
+// Close disconnects, dropping any messages still queued
+func (p *NATSPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package streaming publishes exchange activity to a message broker so
+// downstream services, such as analytics and settlement, can consume it
+// without polling the API.
+//
+// Order events and trades are written to an outbox table in the same
+// transaction as the change they describe, and a relay publishes them and
+// marks them delivered once the broker has them. A crash in between delays
+// events rather than losing them, but an event can be published twice, so
+// delivery is at least once and each message carries the outbox event ID
+// for consumers to deduplicate on.
+//
+// Every order event is published to "<prefix>.orders.<event>", e.g.
+// "exchange.orders.accepted", and every trade to "<prefix>.trades". A
+// consumer of everything subscribes to "exchange.>".
+package streaming
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+)
+
+// pageSize is how many outbox events are loaded at a time for publishing
+const pageSize = 500
+
+// Delivered events are kept for outboxRetention, so recent activity can be
+// inspected, and pruned at most every pruneInterval
+const (
+	outboxRetention = 24 * time.Hour
+	pruneInterval   = time.Hour
+)
+
+// Publisher sends messages to a broker. Publish must not block on the
+// broker; Flush waits until the broker has every message published so far.
+type Publisher interface {
+	Publish(subject, id string, data []byte) error
+	Flush() error
+	Close() error
+}
+
+// Relay publishes the outbox to a broker, oldest event first
+type Relay struct {
+	DB        *db.DB
+	Publisher Publisher
+	Prefix    string // Prepended to every subject, e.g. "exchange"
+
+	mu        sync.Mutex // Serializes flushes so events are published in order
+	wake      chan struct{}
+	failing   bool // Whether the last flush failed, so failures are logged once
+	lastPrune time.Time
+}
+
+// NewRelay creates a relay publishing through publisher under prefix
+func NewRelay(database *db.DB, publisher Publisher, prefix string) *Relay {
+	return &Relay{DB: database, Publisher: publisher, Prefix: prefix, wake: make(chan struct{}, 1)}
+}
+
+// Subject returns the full subject for an outbox topic under the relay's
+// prefix
+func (r *Relay) Subject(topic string) string {
+	if r.Prefix == "" {
+		return topic
+	}
+	return r.Prefix + "." + topic
+}
+
+// Subscribe wakes the relay after each order event and trade on bus, so
+// they are published without waiting for the next poll
+func (r *Relay) Subscribe(bus *events.Bus) {
+	wake := func(events.Event) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+	bus.Subscribe(events.OrderUpdated, wake)
+	bus.Subscribe(events.TradeExecuted, wake)
+}
+
+// Flush publishes every undelivered outbox event and marks them delivered,
+// returning how many were published. Events are marked once the broker has
+// them, so a failure part way publishes them again on the next flush.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	published := 0
+	for {
+		outbox, err := r.DB.GetUndeliveredOutboxEvents(ctx, pageSize)
+		if err != nil {
+			return published, err
+		}
+		if len(outbox) == 0 {
+			return published, nil
+		}
+
+		ids := make([]int64, len(outbox))
+		for i, event := range outbox {
+			if err := r.Publisher.Publish(r.Subject(event.Topic), strconv.FormatInt(event.ID, 10), event.Payload); err != nil {
+				return published, err
+			}
+			ids[i] = event.ID
+		}
+		if err := r.Publisher.Flush(); err != nil {
+			return published, err
+		}
+		if err := r.DB.MarkOutboxEventsDelivered(ctx, ids); err != nil {
+			return published, err
+		}
+		published += len(outbox)
+		if len(outbox) < pageSize {
+			return published, nil
+		}
+	}
+}
+
+// prune deletes delivered events older than outboxRetention, at most every
+// pruneInterval
+func (r *Relay) prune(ctx context.Context, now time.Time) error {
+	if now.Sub(r.lastPrune) < pruneInterval {
+		return nil
+	}
+	if _, err := r.DB.PruneOutboxEvents(ctx, now.Add(-outboxRetention)); err != nil {
+		return err
+	}
+	r.lastPrune = now
+	return nil
+}
+
+// Run flushes the outbox when woken and every interval until ctx is done.
+// A failure is logged when flushing starts failing, not on every retry.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := r.Flush(ctx)
+		if err == nil {
+			err = r.prune(ctx, time.Now())
+		}
+		if err != nil && !r.failing && ctx.Err() == nil {
+			log.Printf("Failed to relay outbox events: %v", err)
+		} else if err == nil && r.failing {
+			log.Printf("Relaying outbox events again")
+		}
+		r.failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package streaming
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+)
+
+func TestRelay_Subject(t *testing.T) {
+	relay := NewRelay(nil, nil, "exchange")
+	if subject := relay.Subject(db.OrdersTopic + ".accepted"); subject != "exchange.orders.accepted" {
+		t.Errorf("expected a prefixed subject, got %q", subject)
+	}
+	relay.Prefix = ""
+	if subject := relay.Subject(db.TradesTopic); subject != "trades" {
+		t.Errorf("expected an unprefixed subject, got %q", subject)
+	}
+}
+
+type message struct {
+	subject string
+	id      string
+	data    string
+}
+
+// fakeNATSServer accepts one client, answers its pings and sends each
+// message it publishes with headers on messages
+func fakeNATSServer(t *testing.T) (string, <-chan message) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan message, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576,\"headers\":true}\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			// HPUB <subject> <header size> <total size>
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "PING":
+				fmt.Fprintf(conn, "PONG\r\n")
+			case fields[0] == "HPUB" && len(fields) == 4:
+				headerSize, _ := strconv.Atoi(fields[2])
+				size, _ := strconv.Atoi(fields[3])
+				payload := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, payload); err != nil {
+					return
+				}
+				headers := textproto.NewReader(bufio.NewReader(bytes.NewReader(payload[:headerSize])))
+				headers.ReadLine() // NATS/1.0
+				header, _ := headers.ReadMIMEHeader()
+				messages <- message{fields[1], header.Get("Nats-Msg-Id"), string(payload[headerSize:size])}
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), messages
+}
+
+func TestNATSPublisher(t *testing.T) {
+	url, messages := fakeNATSServer(t)
+	publisher, err := NewNATSPublisher(url, "exchange-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer publisher.Close()
+
+	if err := publisher.Publish("exchange.trades", "42", []byte(`{"id":7}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := publisher.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case got := <-messages:
+		if got != (message{"exchange.trades", "42", `{"id":7}`}) {
+			t.Errorf("unexpected message %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the message to reach the server")
+	}
+}
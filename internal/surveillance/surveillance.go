@@ -0,0 +1,288 @@
+// Package surveillance scans each hour of trading, once it's over, for
+// accounts that look to be abusing the market, and raises alerts for admins
+// to look into:
+//
+//   - self_trade: an account traded with itself in a market at least
+//     SelfTrades times, which inflates volume without changing hands
+//   - order_churn: an account canceled orders soon after placing them, or
+//     amended them, at least Churn times, flooding the book with orders it
+//     never meant to fill
+//   - price_ramp: a market's price moved by at least PriceMove and one
+//     account took at least TakerShare of its volume in the direction of
+//     the move, pushing the price itself
+//
+// Alerts only flag activity worth a look; they don't act on the account.
+package surveillance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Kinds of alert
+const (
+	KindSelfTrade  = "self_trade"
+	KindOrderChurn = "order_churn"
+	KindPriceRamp  = "price_ramp"
+)
+
+// maxCatchUp bounds how far back hours are scanned when none have been, or
+// after the server was down
+const maxCatchUp = 24 * time.Hour
+
+// scanDelay is how long after the end of an hour it's scanned, so trades
+// matched just before then are recorded first
+const scanDelay = time.Minute
+
+// Detect returns the alerts raised by an hour's trades, in execution order,
+// and order churn
+func Detect(rules config.Surveillance, trades []models.ReportedTrade, churn []models.OrderChurn) []models.SurveillanceAlert {
+	var alerts []models.SurveillanceAlert
+	alerts = append(alerts, detectSelfTrades(rules, trades)...)
+	alerts = append(alerts, detectChurn(rules, churn)...)
+	alerts = append(alerts, detectPriceRamps(rules, trades)...)
+	return alerts
+}
+
+// userMarket is one user's trading in one market
+type userMarket struct {
+	userID int
+	symbol string
+}
+
+func detectSelfTrades(rules config.Surveillance, trades []models.ReportedTrade) []models.SurveillanceAlert {
+	if rules.SelfTrades <= 0 {
+		return nil
+	}
+	type activity struct {
+		username           string
+		trades, selfTrades int
+		volume, selfVolume float64
+	}
+	byUser := make(map[userMarket]*activity)
+	get := func(userID int, username, symbol string) *activity {
+		key := userMarket{userID, symbol}
+		if byUser[key] == nil {
+			byUser[key] = &activity{username: username}
+		}
+		return byUser[key]
+	}
+	for _, trade := range trades {
+		buyer := get(trade.BuyUserID, trade.BuyUsername, trade.Symbol)
+		buyer.trades++
+		buyer.volume += trade.Quantity
+		if trade.BuyUserID == trade.SellUserID {
+			buyer.selfTrades++
+			buyer.selfVolume += trade.Quantity
+			continue
+		}
+		seller := get(trade.SellUserID, trade.SellUsername, trade.Symbol)
+		seller.trades++
+		seller.volume += trade.Quantity
+	}
+
+	var alerts []models.SurveillanceAlert
+	for key, a := range byUser {
+		if a.selfTrades < rules.SelfTrades {
+			continue
+		}
+		alerts = append(alerts, models.SurveillanceAlert{
+			UserID: key.userID, Username: a.username, Kind: KindSelfTrade, Symbol: key.symbol,
+			Description: fmt.Sprintf("%s traded with themselves %d times in %s, %g of the %g they traded",
+				a.username, a.selfTrades, key.symbol, a.selfVolume, a.volume),
+			Details: map[string]float64{
+				"self_trades": float64(a.selfTrades),
+				"trades":      float64(a.trades),
+				"self_volume": a.selfVolume,
+				"volume":      a.volume,
+			},
+		})
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+func detectChurn(rules config.Surveillance, churn []models.OrderChurn) []models.SurveillanceAlert {
+	if rules.Churn <= 0 {
+		return nil
+	}
+	var alerts []models.SurveillanceAlert
+	for _, c := range churn {
+		if c.QuickCancels+c.Amends < rules.Churn {
+			continue
+		}
+		alerts = append(alerts, models.SurveillanceAlert{
+			UserID: c.UserID, Kind: KindOrderChurn,
+			Description: fmt.Sprintf("Canceled %d orders within %s of placing them and amended %d, having placed %d",
+				c.QuickCancels, rules.QuickCancel, c.Amends, c.Placed),
+			Details: map[string]float64{
+				"placed":        float64(c.Placed),
+				"quick_cancels": float64(c.QuickCancels),
+				"amends":        float64(c.Amends),
+			},
+		})
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+func detectPriceRamps(rules config.Surveillance, trades []models.ReportedTrade) []models.SurveillanceAlert {
+	if rules.PriceMove <= 0 {
+		return nil
+	}
+	bySymbol := make(map[string][]models.ReportedTrade)
+	for _, trade := range trades {
+		bySymbol[trade.Symbol] = append(bySymbol[trade.Symbol], trade)
+	}
+
+	var alerts []models.SurveillanceAlert
+	for symbol, trades := range bySymbol {
+		from, to := trades[0].Price, trades[len(trades)-1].Price
+		if from <= 0 {
+			continue
+		}
+		move := (to - from) / from
+		if math.Abs(move) < rules.PriceMove {
+			continue
+		}
+		side, verb := "buy", "buying as the price rose"
+		if move < 0 {
+			side, verb = "sell", "selling as the price fell"
+		}
+
+		var volume float64
+		taken := make(map[int]float64)
+		usernames := make(map[int]string)
+		for _, trade := range trades {
+			volume += trade.Quantity
+			if trade.TakerSide != side {
+				continue
+			}
+			userID, username := trade.BuyUserID, trade.BuyUsername
+			if side == "sell" {
+				userID, username = trade.SellUserID, trade.SellUsername
+			}
+			taken[userID] += trade.Quantity
+			usernames[userID] = username
+		}
+		for userID, quantity := range taken {
+			share := quantity / volume
+			if share < rules.TakerShare {
+				continue
+			}
+			alerts = append(alerts, models.SurveillanceAlert{
+				UserID: userID, Username: usernames[userID], Kind: KindPriceRamp, Symbol: symbol,
+				Description: fmt.Sprintf("%s took %.0f%% of %s's volume %s %.1f%% from %g to %g",
+					usernames[userID], share*100, symbol, verb, math.Abs(move)*100, from, to),
+				Details: map[string]float64{
+					"move":        move,
+					"from_price":  from,
+					"to_price":    to,
+					"taken":       quantity,
+					"volume":      volume,
+					"taker_share": share,
+				},
+			})
+		}
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// sortAlerts orders alerts of a kind by user, then market
+func sortAlerts(alerts []models.SurveillanceAlert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].UserID != alerts[j].UserID {
+			return alerts[i].UserID < alerts[j].UserID
+		}
+		return alerts[i].Symbol < alerts[j].Symbol
+	})
+}
+
+// Scanner scans hours of trading and records the alerts they raise
+type Scanner struct {
+	DB    *db.DB
+	Rules config.Surveillance
+
+	mu sync.Mutex // Serializes scans so an hour isn't scanned twice at once
+}
+
+// NewScanner creates a scanner raising alerts by rules
+func NewScanner(database *db.DB, rules config.Surveillance) *Scanner {
+	return &Scanner{DB: database, Rules: rules}
+}
+
+// Scan scans the hour starting at hour, returning how many alerts it raised
+// that hadn't been already
+func (s *Scanner) Scan(ctx context.Context, hour time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := hour.Add(time.Hour)
+	trades, err := s.DB.GetTradesBetween(ctx, hour, end)
+	if err != nil {
+		return 0, err
+	}
+	churn, err := s.DB.GetOrderChurn(ctx, hour, end, s.Rules.QuickCancel)
+	if err != nil {
+		return 0, err
+	}
+	return s.DB.SaveSurveillanceScan(ctx, hour, Detect(s.Rules, trades, churn))
+}
+
+// scanRange returns the hours due to be scanned at now, given the latest
+// hour already scanned: the hours after it through the last one over, going
+// back at most maxCatchUp
+func scanRange(latest, now time.Time) (from, to time.Time) {
+	to = now.Add(-scanDelay).UTC().Truncate(time.Hour)
+	from = to.Add(-maxCatchUp)
+	if next := latest.UTC().Add(time.Hour); next.After(from) {
+		from = next
+	}
+	return from, to
+}
+
+// ScanDue scans the hours that are over and haven't been scanned
+func (s *Scanner) ScanDue(ctx context.Context, now time.Time) error {
+	latest, err := s.DB.GetLatestSurveillanceHour(ctx)
+	if err != nil {
+		return err
+	}
+	from, to := scanRange(latest, now)
+	for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+		raised, err := s.Scan(ctx, hour)
+		if err != nil {
+			return err
+		}
+		if raised > 0 {
+			log.Printf("Surveillance raised %d alerts for the hour from %s", raised, hour.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Run scans each hour once it is over, checking every interval until ctx is
+// done. Failures are retried on the next check.
+func (s *Scanner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.ScanDue(ctx, time.Now()); err != nil {
+			log.Printf("Failed to run surveillance: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package surveillance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/config"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+var rules = config.Surveillance{SelfTrades: 3, Churn: 10, QuickCancel: time.Second, PriceMove: 0.05, TakerShare: 0.5}
+
+func trade(symbol string, buyer, seller int, price, quantity float64, takerSide string) models.ReportedTrade {
+	names := map[int]string{1: "alice", 2: "bob", 3: "carol"}
+	t := models.ReportedTrade{BuyUsername: names[buyer], SellUsername: names[seller]}
+	t.Symbol, t.BuyUserID, t.SellUserID, t.Price, t.Quantity, t.TakerSide = symbol, buyer, seller, price, quantity, takerSide
+	return t
+}
+
+func TestDetect_SelfTrades(t *testing.T) {
+	trades := []models.ReportedTrade{
+		trade("BTC-USD", 1, 1, 100, 1, "buy"),
+		trade("BTC-USD", 1, 1, 100, 1, "sell"),
+		trade("BTC-USD", 1, 2, 100, 2, "buy"),
+		trade("BTC-USD", 1, 1, 100, 1, "buy"),
+		trade("ETH-USD", 2, 2, 10, 1, "buy"), // Below the threshold
+		trade("ETH-USD", 2, 2, 10, 1, "buy"),
+	}
+	alerts := Detect(config.Surveillance{SelfTrades: 3, QuickCancel: time.Second}, trades, nil)
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.UserID != 1 || alert.Kind != KindSelfTrade || alert.Symbol != "BTC-USD" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if alert.Details["self_trades"] != 3 || alert.Details["trades"] != 4 || alert.Details["self_volume"] != 3 || alert.Details["volume"] != 5 {
+		t.Errorf("unexpected details %v", alert.Details)
+	}
+	if alert.Description != "alice traded with themselves 3 times in BTC-USD, 3 of the 5 they traded" {
+		t.Errorf("unexpected description %q", alert.Description)
+	}
+}
+
+func TestDetect_OrderChurn(t *testing.T) {
+	churn := []models.OrderChurn{
+		{UserID: 1, Placed: 20, QuickCancels: 8, Amends: 2},
+		{UserID: 2, Placed: 50, QuickCancels: 9},
+	}
+	alerts := Detect(config.Surveillance{Churn: 10, QuickCancel: time.Second}, nil, churn)
+	if len(alerts) != 1 || alerts[0].UserID != 1 || alerts[0].Kind != KindOrderChurn {
+		t.Fatalf("expected alice's churn flagged, got %+v", alerts)
+	}
+	if alerts[0].Description != "Canceled 8 orders within 1s of placing them and amended 2, having placed 20" {
+		t.Errorf("unexpected description %q", alerts[0].Description)
+	}
+}
+
+func TestDetect_PriceRamps(t *testing.T) {
+	trades := []models.ReportedTrade{
+		// Carol lifts the offers, taking 3 of the 4 traded as the price rises 10%
+		trade("BTC-USD", 3, 2, 100, 1, "buy"),
+		trade("BTC-USD", 1, 2, 101, 1, "sell"),
+		trade("BTC-USD", 3, 2, 105, 1, "buy"),
+		trade("BTC-USD", 3, 1, 110, 1, "buy"),
+		// Sold down 4%, less than the threshold
+		trade("ETH-USD", 1, 2, 10, 5, "sell"),
+		trade("ETH-USD", 1, 2, 9.6, 5, "sell"),
+	}
+	alerts := Detect(rules, trades, nil)
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.UserID != 3 || alert.Kind != KindPriceRamp || alert.Symbol != "BTC-USD" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if alert.Details["taker_share"] != 0.75 || alert.Details["move"] < 0.0999 || alert.Details["move"] > 0.1001 {
+		t.Errorf("unexpected details %v", alert.Details)
+	}
+	if alert.Description != "carol took 75% of BTC-USD's volume buying as the price rose 10.0% from 100 to 110" {
+		t.Errorf("unexpected description %q", alert.Description)
+	}
+
+	// Falling prices are pinned on the sellers
+	trades = []models.ReportedTrade{
+		trade("ETH-USD", 1, 2, 10, 5, "sell"),
+		trade("ETH-USD", 1, 2, 9, 5, "sell"),
+	}
+	if alerts := Detect(rules, trades, nil); len(alerts) != 1 || alerts[0].UserID != 2 || alerts[0].Details["move"] != -0.1 {
+		t.Errorf("expected bob's selling flagged, got %+v", alerts)
+	}
+
+	// Checks with a zero threshold are off
+	if alerts := Detect(config.Surveillance{QuickCancel: time.Second, TakerShare: 0.5}, trades, nil); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %+v", alerts)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)
+
+	// Nothing scanned yet: the last day, through the hour that's just over
+	from, to := scanRange(time.Time{}, now)
+	if !from.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected range %v to %v", from, to)
+	}
+
+	// Picks up after the latest hour scanned
+	from, to = scanRange(time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC), now)
+	if !from.Equal(time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected range %v to %v", from, to)
+	}
+
+	// An hour isn't scanned until a minute after it's over
+	from, to = scanRange(time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 11, 0, 30, 0, time.UTC))
+	if from.Before(to) {
+		t.Errorf("expected nothing due, got %v to %v", from, to)
+	}
+}
@@ -0,0 +1,138 @@
+// Package testutil provides integration tests with a PostgreSQL database of
+// their own, so `go test ./...` runs anywhere Docker does.
+//
+// Each test binary gets an empty schema, named after its package, in
+// EXCHANGE_TEST_DATABASE_URL if that's set, and otherwise in a throwaway
+// PostgreSQL container started for it. Packages are tested in parallel, so
+// a schema apiece keeps one package's truncating and seeding from
+// disturbing another's.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// image is the PostgreSQL image containers are started from, matching
+// docker-compose.yml
+const image = "postgres:latest"
+
+// Database is an empty schema for a package's tests
+type Database struct {
+	// URL connects with the schema on the search path, so the package's
+	// migrations create their tables in it
+	URL string
+
+	schema    string
+	adminURL  string
+	container *postgres.PostgresContainer
+}
+
+// NewDatabase creates an empty schema for the tests of package name, in a
+// container started for it unless EXCHANGE_TEST_DATABASE_URL is set. The
+// tests migrate it themselves, with DB.Migrate; internal/db's can't import
+// anything importing it. Close removes the schema or container.
+func NewDatabase(ctx context.Context, name string) (*Database, error) {
+	d := &Database{schema: fmt.Sprintf("test_%s_%d", name, os.Getpid())}
+	d.adminURL = os.Getenv("EXCHANGE_TEST_DATABASE_URL")
+	if d.adminURL == "" {
+		container, err := startPostgres(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start PostgreSQL, which needs Docker or EXCHANGE_TEST_DATABASE_URL: %w", err)
+		}
+		d.container = container
+		if d.adminURL, err = container.ConnectionString(ctx, "sslmode=disable"); err != nil {
+			d.Close(ctx)
+			return nil, fmt.Errorf("failed to get the container's address: %w", err)
+		}
+	}
+
+	if err := d.exec(ctx, fmt.Sprintf("DROP SCHEMA IF EXISTS %[1]s CASCADE; CREATE SCHEMA %[1]s", d.schema)); err != nil {
+		d.Close(ctx)
+		return nil, err
+	}
+	u, err := url.Parse(d.adminURL)
+	if err != nil {
+		d.Close(ctx)
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("search_path", d.schema)
+	u.RawQuery = query.Encode()
+	d.URL = u.String()
+	return d, nil
+}
+
+// startPostgres starts a PostgreSQL container. testcontainers panics when
+// it can't find Docker, which is returned as an error instead.
+func startPostgres(ctx context.Context) (container *postgres.PostgresContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return postgres.Run(ctx, image,
+		postgres.WithDatabase("exchange_db"),
+		postgres.WithUsername("exchange_user"),
+		postgres.WithPassword("exchange_pass"),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).WithStartupTimeout(time.Minute)))
+}
+
+// Close drops the schema and stops the container, if one was started
+func (d *Database) Close(ctx context.Context) error {
+	if d.container != nil {
+		if err := d.container.Terminate(ctx); err != nil {
+			return fmt.Errorf("failed to stop PostgreSQL: %w", err)
+		}
+		return nil
+	}
+	return d.exec(ctx, fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", d.schema))
+}
+
+// Truncate empties every table the migrations created in pool's schema,
+// bar their version table, and restarts their IDs. Tests call it to start
+// from an empty database without listing tables that later migrations add.
+func Truncate(ctx context.Context, pool *pgxpool.Pool) error {
+	var tables *string
+	err := pool.QueryRow(ctx, `
+		SELECT string_agg(quote_ident(c.relname), ', ')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+		  AND c.relkind IN ('r', 'p')
+		  AND NOT c.relispartition
+		  AND c.relname <> 'schema_version'`).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	if tables == nil {
+		return nil
+	}
+	if _, err := pool.Exec(ctx, "TRUNCATE "+*tables+" RESTART IDENTITY"); err != nil {
+		return fmt.Errorf("failed to truncate tables: %w", err)
+	}
+	return nil
+}
+
+// exec runs statements on a connection of its own, outside the schema
+func (d *Database) exec(ctx context.Context, sql string) error {
+	conn, err := pgx.Connect(ctx, d.adminURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to set up schema %s: %w", d.schema, err)
+	}
+	return nil
+}
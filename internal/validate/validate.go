@@ -0,0 +1,184 @@
+// Package validate checks request bodies against rules declared in their
+// fields' `validate` tags, e.g.
+//
+//	Side  string  `json:"side" validate:"required,oneof=buy sell"`
+//	Price float64 `json:"price" validate:"required,gt=0,decimals=2"`
+//
+// Rules are separated by commas and checked in order, stopping at a field's
+// first violation. Every rule but required passes a zero value, so optional
+// fields need only omit it. Pointers are checked by the value they point to.
+//
+//	required    not the zero value, or for pointers not nil
+//	min=N       numbers at least N; strings and slices at least N long
+//	max=N       numbers at most N; strings and slices at most N long
+//	gt=N        numbers greater than N
+//	oneof=A B   strings equal to one of the space-separated values
+//	decimals=N  numbers with at most N decimal places
+package validate
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Violation is a field breaking one of its rules
+type Violation struct {
+	Field   string `json:"field"` // The field's JSON name
+	Rule    string `json:"rule"`  // e.g. "required" or "oneof"
+	Message string `json:"message"`
+}
+
+// rule is one parsed rule of a field
+type rule struct {
+	name  string
+	param string
+	num   float64  // param as a number, for numeric rules
+	enum  []string // param's values, for oneof
+}
+
+// field is a struct field with rules
+type field struct {
+	index []int
+	name  string
+	rules []rule
+}
+
+// fields caches each struct type's fields with rules
+var fields sync.Map // reflect.Type -> []field
+
+// Struct checks every field of v, a struct or a pointer to one, against its
+// rules, returning the violations in field order. It panics if a tag is
+// malformed, as that is a programming error.
+func Struct(v interface{}) []Violation {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	var violations []Violation
+	for _, f := range typeFields(value.Type()) {
+		fv := value.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv = reflect.Zero(fv.Type().Elem())
+			} else {
+				fv = fv.Elem()
+			}
+		}
+		for _, r := range f.rules {
+			if message, ok := r.check(fv); !ok {
+				violations = append(violations, Violation{Field: f.name, Rule: r.name, Message: f.name + " " + message})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+func typeFields(t reflect.Type) []field {
+	if cached, ok := fields.Load(t); ok {
+		return cached.([]field)
+	}
+	var parsed []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" {
+			name = sf.Name
+		}
+		f := field{index: sf.Index, name: name}
+		for _, spec := range strings.Split(tag, ",") {
+			f.rules = append(f.rules, parseRule(t, sf.Name, spec))
+		}
+		parsed = append(parsed, f)
+	}
+	fields.Store(t, parsed)
+	return parsed
+}
+
+func parseRule(t reflect.Type, fieldName, spec string) rule {
+	name, param, _ := strings.Cut(spec, "=")
+	r := rule{name: name, param: param}
+	switch name {
+	case "required":
+	case "oneof":
+		r.enum = strings.Fields(param)
+	case "min", "max", "gt", "decimals":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s.%s: invalid %s parameter %q", t.Name(), fieldName, name, param))
+		}
+		r.num = n
+	default:
+		panic(fmt.Sprintf("validate: %s.%s: unknown rule %q", t.Name(), fieldName, name))
+	}
+	return r
+}
+
+// check returns why v breaks the rule, or true if it doesn't
+func (r rule) check(v reflect.Value) (string, bool) {
+	if r.name == "required" {
+		return "is required", !v.IsZero()
+	}
+	if v.IsZero() {
+		return "", true
+	}
+
+	switch r.name {
+	case "oneof":
+		return "must be one of " + strings.Join(r.enum, ", "), v.Kind() == reflect.String && slices.Contains(r.enum, v.String())
+	case "decimals":
+		n, ok := number(v)
+		scaled := n * math.Pow10(int(r.num))
+		return fmt.Sprintf("allows at most %s decimal places", r.param), ok && math.Abs(scaled-math.Round(scaled)) < 1e-6
+	}
+
+	if length, unit, ok := size(v); ok {
+		switch r.name {
+		case "min":
+			return fmt.Sprintf("must have at least %s %s", r.param, unit), float64(length) >= r.num
+		case "max":
+			return fmt.Sprintf("must have at most %s %s", r.param, unit), float64(length) <= r.num
+		}
+	}
+	n, ok := number(v)
+	if !ok {
+		return "must be a number", false
+	}
+	switch r.name {
+	case "min":
+		return "must be at least " + r.param, n >= r.num
+	case "max":
+		return "must be at most " + r.param, n <= r.num
+	default: // gt
+		return "must be greater than " + r.param, n > r.num
+	}
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// size returns the length of a string or collection and what it counts
+func size(v reflect.Value) (int, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return len([]rune(v.String())), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), "items", true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,75 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type order struct {
+	Side     string   `json:"side" validate:"required,oneof=buy sell"`
+	Price    float64  `json:"price" validate:"required,gt=0,decimals=2"`
+	Quantity *float64 `json:"quantity,omitempty" validate:"min=0.001,max=100"`
+	Tag      string   `json:"tag,omitempty" validate:"max=8"`
+	Count    int      `validate:"min=0"`
+	Note     string   `json:"note"`
+}
+
+func TestStruct(t *testing.T) {
+	quantity := func(q float64) *float64 { return &q }
+
+	tests := []struct {
+		name     string
+		order    order
+		expected []Violation
+	}{
+		{
+			name:  "Valid",
+			order: order{Side: "buy", Price: 100.25, Quantity: quantity(1), Tag: "bot", Note: "anything"},
+		},
+		{
+			// Rules other than required pass zero values and nil pointers
+			name:  "OptionalFieldsOmitted",
+			order: order{Side: "sell", Price: 1},
+		},
+		{
+			name:  "EveryFieldInvalid",
+			order: order{Side: "hold", Price: -1, Quantity: quantity(1000), Tag: "much too long", Count: -1},
+			expected: []Violation{
+				{Field: "side", Rule: "oneof", Message: "side must be one of buy, sell"},
+				{Field: "price", Rule: "gt", Message: "price must be greater than 0"},
+				{Field: "quantity", Rule: "max", Message: "quantity must be at most 100"},
+				{Field: "tag", Rule: "max", Message: "tag must have at most 8 characters"},
+				{Field: "Count", Rule: "min", Message: "Count must be at least 0"},
+			},
+		},
+		{
+			// Only the first rule a field breaks is reported
+			name:  "MissingAndTooPrecise",
+			order: order{Price: 100.001, Quantity: quantity(0.0001)},
+			expected: []Violation{
+				{Field: "side", Rule: "required", Message: "side is required"},
+				{Field: "price", Rule: "decimals", Message: "price allows at most 2 decimal places"},
+				{Field: "quantity", Rule: "min", Message: "quantity must be at least 0.001"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Struct(&tt.order); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStruct_InvalidTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unknown rule")
+		}
+	}()
+	Struct(struct {
+		Name string `validate:"lowercase"`
+	}{})
+}
@@ -0,0 +1,257 @@
+// Package webhooks posts users' order fills and cancellations to the
+// webhooks they register, signed with each webhook's secret.
+//
+// Each update is stored as a delivery to every one of the user's webhooks
+// in the same transaction as the change it describes, so none are lost if
+// the server stops, and a delivery is retried with exponential backoff
+// until the webhook replies with a 2xx status or MaxAttempts have failed.
+// Webhooks are posted to concurrently, each one delivery at a time, and a
+// webhook that fails has the rest of its deliveries put off until the next
+// flush, so an endpoint that's down doesn't hold up the others.
+// A delivery can be posted more than once, e.g. if a reply is lost, and
+// retries can overtake it, so receivers should ignore delivery IDs they
+// have already processed and order updates by their time.
+//
+// Webhooks may only point at public addresses, checked when they're
+// registered and again each time a delivery connects, and redirects aren't
+// followed.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/auth"
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+// Headers sent with each delivery. The signature is the hex HMAC-SHA256,
+// under the webhook's secret, of the timestamp, a period and the body.
+const (
+	DeliveryIDHeader = "X-Webhook-Delivery-Id"
+	EventHeader      = "X-Webhook-Event"     // The order update's event, e.g. "filled"
+	TimestampHeader  = "X-Webhook-Timestamp" // Unix milliseconds
+	SignatureHeader  = "X-Webhook-Signature"
+)
+
+// Events are the order update events posted to webhooks
+var Events = db.WebhookEvents
+
+// MaxAttempts is how many times a delivery is posted before it fails for
+// good, about 20 minutes after the first attempt
+const MaxAttempts = 8
+
+// Backoff bounds the wait before retrying a delivery: doubling from
+// firstRetry after each failed attempt, up to maxRetry
+const (
+	firstRetry = 10 * time.Second
+	maxRetry   = time.Hour
+)
+
+// pageSize is how many due deliveries are loaded at a time
+const pageSize = 100
+
+// workers is how many webhooks are posted to at once
+const workers = 16
+
+// Sign returns the signature of a delivery body sent at timestamp, in Unix
+// milliseconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	return auth.Sign(secret, strconv.FormatInt(timestamp, 10)+"."+string(body))
+}
+
+// NewSecret generates a random secret for signing a webhook's deliveries
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Backoff returns how long to wait before the next attempt at a delivery
+// that has failed attempts times
+func Backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetry)
+}
+
+// Dispatcher posts the deliveries stored for users' webhooks
+type Dispatcher struct {
+	DB     *db.DB
+	Client *http.Client
+
+	wake chan struct{}
+}
+
+// NewDispatcher creates a dispatcher posting the deliveries stored in
+// database
+func NewDispatcher(database *db.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:     database,
+		Client: NewClient(),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Subscribe wakes the dispatcher for the fills and cancellations published
+// on bus, so their deliveries, already stored, are posted straight away
+func (d *Dispatcher) Subscribe(bus *events.Bus) {
+	bus.Subscribe(events.OrderUpdated, func(e events.Event) {
+		update, ok := e.Data.(models.OrderUpdate)
+		if !ok || !Events[update.Event] {
+			return
+		}
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// post sends one delivery, returning the status the webhook replied with,
+// if it replied
+func (d *Dispatcher) post(ctx context.Context, delivery db.DueWebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := time.Now().UnixMilli()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryIDHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliver posts a delivery and records the outcome, scheduling a retry if it
+// failed and has attempts left. Returns whether it was delivered.
+func (d *Dispatcher) deliver(ctx context.Context, delivery db.DueWebhookDelivery, now time.Time) (bool, error) {
+	code, postErr := d.post(ctx, delivery)
+	if postErr == nil {
+		return true, d.DB.MarkWebhookDelivered(ctx, delivery.ID, code)
+	}
+	var retryAt time.Time
+	if attempts := delivery.Attempts + 1; attempts < MaxAttempts {
+		retryAt = now.Add(Backoff(attempts))
+	}
+	return false, d.DB.MarkWebhookAttemptFailed(ctx, delivery.ID, code, postErr.Error(), retryAt)
+}
+
+// Flush posts every delivery due by now, returning how many were delivered.
+// Failed deliveries are rescheduled, so each is posted at most once, and a
+// webhook's deliveries after one that fails are left for the next flush.
+func (d *Dispatcher) Flush(ctx context.Context, now time.Time) (int, error) {
+	delivered := 0
+	failing := make(map[int]bool) // Webhooks with a failed attempt this flush
+	var afterID int64
+	for {
+		due, err := d.DB.GetDueWebhookDeliveries(ctx, now, afterID, pageSize)
+		if err != nil {
+			return delivered, err
+		}
+		n, err := d.deliverPage(ctx, due, failing, now)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+		if len(due) < pageSize {
+			return delivered, nil
+		}
+		afterID = due[len(due)-1].ID
+	}
+}
+
+// deliverPage posts a page of deliveries, each webhook's in order on one of
+// up to workers goroutines, skipping webhooks in failing and adding those
+// that fail to it. Returns how many were delivered and the first error
+// recording an outcome.
+func (d *Dispatcher) deliverPage(ctx context.Context, due []db.DueWebhookDelivery, failing map[int]bool, now time.Time) (int, error) {
+	var webhookIDs []int
+	byWebhook := make(map[int][]db.DueWebhookDelivery)
+	for _, delivery := range due {
+		if failing[delivery.WebhookID] {
+			continue
+		}
+		if _, ok := byWebhook[delivery.WebhookID]; !ok {
+			webhookIDs = append(webhookIDs, delivery.WebhookID)
+		}
+		byWebhook[delivery.WebhookID] = append(byWebhook[delivery.WebhookID], delivery)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	delivered := 0
+	slots := make(chan struct{}, workers)
+	for _, webhookID := range webhookIDs {
+		deliveries := byWebhook[webhookID]
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			for _, delivery := range deliveries {
+				ok, err := d.deliver(ctx, delivery, now)
+				mu.Lock()
+				if ok {
+					delivered++
+				} else {
+					failing[webhookID] = true
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				if !ok || err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return delivered, firstErr
+}
+
+// Run posts deliveries as they're stored and retries failed ones as they
+// fall due, checking every interval, until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+		if _, err := d.Flush(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xtrntr/exchange/internal/db"
+	"github.com/xtrntr/exchange/internal/events"
+	"github.com/xtrntr/exchange/internal/models"
+)
+
+func TestDispatcher_Post(t *testing.T) {
+	var got http.Header
+	var body []byte
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil)
+	// The test server is on loopback, which the dispatcher's own client
+	// refuses to reach
+	d.Client = server.Client()
+	delivery := db.DueWebhookDelivery{ID: 12, URL: server.URL, Secret: "secret", Event: "filled", Payload: []byte(`{"event":"filled"}`)}
+	code, err := d.post(context.Background(), delivery)
+	if err != nil || code != http.StatusAccepted {
+		t.Fatalf("expected a 202, got %d, %v", code, err)
+	}
+	if string(body) != string(delivery.Payload) {
+		t.Errorf("expected payload as body, got %s", body)
+	}
+	if got.Get(DeliveryIDHeader) != "12" || got.Get(EventHeader) != "filled" {
+		t.Errorf("unexpected headers %v", got)
+	}
+	timestamp, err := strconv.ParseInt(got.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp %q", got.Get(TimestampHeader))
+	}
+	if got.Get(SignatureHeader) != Sign("secret", timestamp, body) {
+		t.Errorf("signature doesn't verify: %q", got.Get(SignatureHeader))
+	}
+
+	status = http.StatusServiceUnavailable
+	if code, err := d.post(context.Background(), delivery); err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("expected an error with the 503, got %d, %v", code, err)
+	}
+}
+
+func TestDispatcher_Subscribe(t *testing.T) {
+	d := NewDispatcher(nil)
+	bus := events.NewBus()
+	d.Subscribe(bus)
+
+	// Only fills and cancellations wake the dispatcher, and wake-ups
+	// coalesce rather than block the bus
+	for _, event := range []string{"accepted", "amended", "rejected"} {
+		bus.Publish(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: event}})
+	}
+	if len(d.wake) != 0 {
+		t.Errorf("expected no wake-up for other events")
+	}
+	for _, event := range []string{"partially_filled", "filled", "canceled"} {
+		bus.Publish(events.Event{Type: events.OrderUpdated, Data: models.OrderUpdate{Event: event}})
+	}
+	if len(d.wake) != 1 {
+		t.Errorf("expected one pending wake-up, got %d", len(d.wake))
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:2800::1":    true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := Allowed(net.ParseIP(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// fakeResolver resolves hosts from a map
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestCheckHost(t *testing.T) {
+	resolver := fakeResolver{
+		"hooks.example.com": {"93.184.216.34"},
+		"metadata.internal": {"169.254.169.254"},
+		"mixed.example.com": {"93.184.216.34", "10.0.0.1"},
+	}
+	for host, want := range map[string]error{
+		"hooks.example.com": nil,
+		"93.184.216.34":     nil,
+		"metadata.internal": ErrForbiddenAddress,
+		"mixed.example.com": ErrForbiddenAddress,
+		"169.254.169.254":   ErrForbiddenAddress,
+		"::1":               ErrForbiddenAddress,
+	} {
+		if err := CheckHost(context.Background(), resolver, host); !errors.Is(err, want) {
+			t.Errorf("CheckHost(%s) = %v, want %v", host, err, want)
+		}
+	}
+	if err := CheckHost(context.Background(), resolver, "missing.example.com"); err == nil || errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("expected a resolution error, got %v", err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// Connections to loopback are refused when dialing
+	d := NewDispatcher(nil)
+	delivery := db.DueWebhookDelivery{ID: 1, URL: server.URL, Secret: "secret", Event: "filled"}
+	if _, err := d.post(context.Background(), delivery); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("expected ErrForbiddenAddress, got %v", err)
+	}
+
+	// Redirects are the reply, not followed
+	d.Client.Transport = server.Client().Transport
+	if code, err := d.post(context.Background(), delivery); err == nil || code != http.StatusFound {
+		t.Errorf("expected the redirect as a failed reply, got %d, %v", code, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		7:  640 * time.Second,
+		20: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, expected %v", attempts, got, want)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil || len(a) != 64 {
+		t.Fatalf("expected a 64-character secret, got %q, %v", a, err)
+	}
+	if b, _ := NewSecret(); a == b {
+		t.Error("expected secrets to differ")
+	}
+}
@@ -1,12 +1,12 @@
 -- Creates the database schema for users, orders, and trades
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE orders (
+CREATE TABLE IF NOT EXISTS orders (
     id SERIAL PRIMARY KEY,
     user_id INT REFERENCES users(id),
     type VARCHAR(4) NOT NULL CHECK (type IN ('buy', 'sell')),
@@ -16,7 +16,7 @@ CREATE TABLE orders (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE trades (
+CREATE TABLE IF NOT EXISTS trades (
     id SERIAL PRIMARY KEY,
     buy_order_id INT REFERENCES orders(id),
     sell_order_id INT REFERENCES orders(id),
@@ -0,0 +1,30 @@
+-- Creates the candles table holding OHLCV bars aggregated from trades
+CREATE TABLE IF NOT EXISTS candles (
+    resolution VARCHAR(3) NOT NULL CHECK (resolution IN ('1m', '5m', '1h', '1d')),
+    open_time TIMESTAMP NOT NULL,
+    open DECIMAL(10, 2) NOT NULL,
+    high DECIMAL(10, 2) NOT NULL,
+    low DECIMAL(10, 2) NOT NULL,
+    close DECIMAL(10, 2) NOT NULL,
+    volume DECIMAL(18, 8) NOT NULL,
+    PRIMARY KEY (resolution, open_time)
+);
+
+-- Backfill candles from trades recorded before this migration
+INSERT INTO candles (resolution, open_time, open, high, low, close, volume)
+SELECT i.resolution,
+       date_bin(i.width, t.executed_at, TIMESTAMP '2000-01-01'),
+       (array_agg(t.price ORDER BY t.executed_at, t.id))[1],
+       MAX(t.price),
+       MIN(t.price),
+       (array_agg(t.price ORDER BY t.executed_at DESC, t.id DESC))[1],
+       SUM(t.quantity)
+FROM trades t
+CROSS JOIN (VALUES
+    ('1m', INTERVAL '1 minute'),
+    ('5m', INTERVAL '5 minutes'),
+    ('1h', INTERVAL '1 hour'),
+    ('1d', INTERVAL '1 day')
+) AS i(resolution, width)
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- Adds a free-form strategy tag to orders so fills can be attributed to strategies
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tag VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_orders_user_tag ON orders (user_id, tag);
@@ -0,0 +1,2 @@
+-- Adds the trading pair to orders; all existing orders belong to BTC-USD
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS symbol VARCHAR(20) NOT NULL DEFAULT 'BTC-USD';
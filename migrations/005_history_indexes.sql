@@ -0,0 +1,6 @@
+-- Indexes backing paginated and filtered order and trade history queries
+CREATE INDEX IF NOT EXISTS idx_orders_user_created ON orders (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_status ON orders (user_id, status);
+CREATE INDEX IF NOT EXISTS idx_trades_buy_order ON trades (buy_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_sell_order ON trades (sell_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_executed_at ON trades (executed_at, id);
@@ -0,0 +1,2 @@
+-- Adds a KYC verification tier to users; tiers determine daily trading limits
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kyc_tier SMALLINT NOT NULL DEFAULT 0 CHECK (kyc_tier >= 0);
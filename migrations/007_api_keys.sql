@@ -0,0 +1,12 @@
+-- Creates API keys used by bots to sign requests with HMAC-SHA256
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    api_key VARCHAR(64) UNIQUE NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    label VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
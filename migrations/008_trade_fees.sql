@@ -0,0 +1,8 @@
+-- Records which side took liquidity and the fee charged to each side of a trade
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS taker_side VARCHAR(4) CHECK (taker_side IN ('buy', 'sell'));
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS buy_fee DECIMAL(18, 8) NOT NULL DEFAULT 0;
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS sell_fee DECIMAL(18, 8) NOT NULL DEFAULT 0;
+
+-- Older trades didn't record the taker; the incoming order is always the newer one
+UPDATE trades SET taker_side = CASE WHEN buy_order_id > sell_order_id THEN 'buy' ELSE 'sell' END
+WHERE taker_side IS NULL;
@@ -0,0 +1,12 @@
+-- Adds time in force and post-only instructions to orders
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS time_in_force VARCHAR(3) NOT NULL DEFAULT 'GTC' CHECK (time_in_force IN ('GTC', 'IOC', 'FOK'));
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS post_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Stores per-user defaults applied to orders that omit those fields
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    default_time_in_force VARCHAR(3) NOT NULL DEFAULT 'GTC' CHECK (default_time_in_force IN ('GTC', 'IOC', 'FOK')),
+    default_post_only BOOLEAN NOT NULL DEFAULT FALSE,
+    confirm_notional_above DECIMAL(20, 8) NOT NULL DEFAULT 0 CHECK (confirm_notional_above >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,19 @@
+-- Makes usernames unique regardless of letter case, so "Alice" and "alice" are the same user.
+-- Usernames registered before this that differ only in case would fail the
+-- index with a bare constraint error, so stop with the users to rename instead.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(names, '; ') INTO duplicates FROM (
+        SELECT string_agg(username || ' (id ' || id || ')', ', ' ORDER BY id) AS names
+        FROM users GROUP BY LOWER(username) HAVING COUNT(*) > 1
+    ) clashes;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'usernames differing only in letter case: %', duplicates
+            USING HINT = 'Rename all but one user of each group, then migrate again.';
+    END IF;
+END;
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
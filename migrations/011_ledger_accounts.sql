@@ -0,0 +1,57 @@
+-- Creates a double-entry ledger. Every movement of an asset is recorded as
+-- entries sharing a reference whose amounts sum to zero per asset. User
+-- accounts have account 'user'; system accounts such as 'fees' have no user.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id),
+    account VARCHAR(32) NOT NULL DEFAULT 'user',
+    asset VARCHAR(10) NOT NULL,
+    amount DECIMAL(28, 8) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    reference VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((account = 'user') = (user_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_user ON ledger_entries (user_id, asset);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_reference ON ledger_entries (reference);
+
+-- Post existing trades to the ledger: the buyer receives the base asset and
+-- pays the notional plus fee, the seller the reverse, and fees go to 'fees'.
+-- All trades so far are BTC-USD.
+INSERT INTO ledger_entries (user_id, account, asset, amount, kind, reference, created_at)
+SELECT e.user_id, e.account, e.asset, e.amount, 'trade', 'trade:' || t.id, t.executed_at
+FROM trades t
+JOIN orders b ON b.id = t.buy_order_id
+JOIN orders s ON s.id = t.sell_order_id
+CROSS JOIN LATERAL (VALUES
+    (b.user_id, 'user', 'BTC', t.quantity),
+    (b.user_id, 'user', 'USD', -(t.price * t.quantity + t.buy_fee)),
+    (s.user_id, 'user', 'BTC', -t.quantity),
+    (s.user_id, 'user', 'USD', t.price * t.quantity - t.sell_fee),
+    (NULL::INT, 'fees', 'USD', t.buy_fee + t.sell_fee)
+) AS e (user_id, account, asset, amount)
+WHERE NOT EXISTS (SELECT 1 FROM ledger_entries l WHERE l.reference = 'trade:' || t.id);
+
+-- Keeps every username a user has had, for audit
+CREATE TABLE IF NOT EXISTS username_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    old_username VARCHAR(50) NOT NULL,
+    new_username VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_changes_user ON username_changes (user_id);
+
+-- Merged accounts can no longer log in; their orders and balances belong to
+-- the account they were merged into
+ALTER TABLE users ADD COLUMN IF NOT EXISTS merged_into INT REFERENCES users(id);
+
+CREATE TABLE IF NOT EXISTS account_merges (
+    id SERIAL PRIMARY KEY,
+    source_user_id INT NOT NULL REFERENCES users(id),
+    target_user_id INT NOT NULL REFERENCES users(id),
+    orders_moved INT NOT NULL,
+    merged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- Adds user roles for the role-protected admin API, and account suspension.
+-- Suspended accounts keep their data but can't log in or use the API.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
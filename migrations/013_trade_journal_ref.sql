@@ -0,0 +1,3 @@
+-- Links trades to the engine journal entry that produced them, so crash
+-- recovery can tell which journaled trades already reached the database
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS journal_ref VARCHAR(40) UNIQUE;
@@ -0,0 +1,11 @@
+-- Stores periodic snapshots of the matching engine's order book. Each holds
+-- the serialized book, the journal sequence number it reflects and the
+-- highest order ID created before it, so startup only needs the journal
+-- entries and orders that follow it.
+CREATE TABLE IF NOT EXISTS book_snapshots (
+    id SERIAL PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    last_order_id INT NOT NULL,
+    state JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,22 @@
+-- Outbox for the accounting integration. Each trade and ledger entry is
+-- claimed by exactly one batch, in the same transaction that stores the
+-- batch's payload, and the batch is then posted until the receiver
+-- acknowledges it.
+CREATE TABLE IF NOT EXISTS accounting_batches (
+    id SERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    trades INT NOT NULL,
+    ledger_entries INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_accounting_batches_undelivered ON accounting_batches (id) WHERE delivered_at IS NULL;
+
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS accounting_batch_id INT REFERENCES accounting_batches(id);
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS accounting_batch_id INT REFERENCES accounting_batches(id);
+
+CREATE INDEX IF NOT EXISTS idx_trades_unbatched ON trades (id) WHERE accounting_batch_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_unbatched ON ledger_entries (id) WHERE accounting_batch_id IS NULL;
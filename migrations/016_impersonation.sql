@@ -0,0 +1,25 @@
+-- Users can let support view their account until a time of their choosing.
+-- Admins then start time-boxed, read-only impersonation sessions, and every
+-- request made in a session is recorded for audit.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS support_access_until TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES users(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_user ON impersonation_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS impersonation_requests (
+    id SERIAL PRIMARY KEY,
+    session_id INT NOT NULL REFERENCES impersonation_sessions(id),
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_requests_session ON impersonation_requests (session_id);
@@ -0,0 +1,6 @@
+-- Service accounts are for bots and internal services. They are created by
+-- admins, have no password (an empty hash, which never matches) and can
+-- only use the API with keys. Keys are scoped; existing keys keep full access.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS service_account BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{read,trade}';
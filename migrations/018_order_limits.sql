@@ -0,0 +1,9 @@
+-- Stores per-user limits on each order, set by admins. A zero limit, or no
+-- row, means unlimited.
+CREATE TABLE IF NOT EXISTS user_order_limits (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    max_order_notional DECIMAL(20, 8) NOT NULL DEFAULT 0 CHECK (max_order_notional >= 0),
+    max_order_quantity DECIMAL(20, 8) NOT NULL DEFAULT 0 CHECK (max_order_quantity >= 0),
+    max_open_orders INT NOT NULL DEFAULT 0 CHECK (max_open_orders >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
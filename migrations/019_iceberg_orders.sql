@@ -0,0 +1,3 @@
+-- Lets GTC orders show only part of their quantity on the book. Zero shows
+-- the whole order.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS display_quantity DECIMAL(10, 8) NOT NULL DEFAULT 0 CHECK (display_quantity >= 0);
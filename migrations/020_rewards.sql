@@ -0,0 +1,41 @@
+-- Stores periodic snapshots of users' balances in the rewards asset, which
+-- rewards are time-weighted from
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    asset VARCHAR(10) NOT NULL,
+    amount DECIMAL(28, 8) NOT NULL,
+    taken_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_snapshots_asset ON balance_snapshots (asset, taken_at);
+
+-- Each accrual period is recorded once, with the rewards credited for it,
+-- so a period is never credited twice
+CREATE TABLE IF NOT EXISTS reward_periods (
+    id SERIAL PRIMARY KEY,
+    asset VARCHAR(10) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    users INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (asset, period_end)
+);
+
+-- Rewards credited to each user, posted to the ledger under reference
+-- 'reward:' || id
+CREATE TABLE IF NOT EXISTS reward_accruals (
+    id SERIAL PRIMARY KEY,
+    period_id INT NOT NULL REFERENCES reward_periods(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    asset VARCHAR(10) NOT NULL,
+    payout_asset VARCHAR(10) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    average_balance DECIMAL(28, 8) NOT NULL,
+    rate DECIMAL(20, 8) NOT NULL,
+    amount DECIMAL(28, 8) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reward_accruals_user ON reward_accruals (user_id, id);
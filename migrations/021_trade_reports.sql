@@ -0,0 +1,8 @@
+-- Records the daily trade reports written for regulators. Regenerating a
+-- day replaces its row.
+CREATE TABLE IF NOT EXISTS trade_reports (
+    day DATE PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    trades INT NOT NULL,
+    generated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,13 @@
+-- Records the official daily settlement price of each instrument. The
+-- method says how it was found: the volume-weighted price of the closing
+-- window, the day's last trade, or the previous settlement carried over.
+CREATE TABLE IF NOT EXISTS settlements (
+    symbol VARCHAR(20) NOT NULL,
+    day DATE NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    method VARCHAR(16) NOT NULL CHECK (method IN ('vwap', 'last_trade', 'previous')),
+    volume DECIMAL(18, 8) NOT NULL,
+    trades INT NOT NULL,
+    calculated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (symbol, day)
+);
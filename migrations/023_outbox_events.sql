@@ -0,0 +1,14 @@
+-- Outbox for event streaming. Order events and trades are written in the
+-- same transaction as the change they describe, and a relay publishes them
+-- to the broker and marks them delivered, so a crash in between delays
+-- events instead of losing them.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_undelivered ON outbox_events (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_delivered ON outbox_events (delivered_at) WHERE delivered_at IS NOT NULL;
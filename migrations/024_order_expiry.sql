@@ -0,0 +1,12 @@
+-- Adds good-till-date orders, which are canceled at expires_at if still
+-- open. Only GTD orders have an expiry.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_time_in_force_check;
+ALTER TABLE orders ADD CONSTRAINT orders_time_in_force_check CHECK (time_in_force IN ('GTC', 'GTD', 'IOC', 'FOK'));
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_expires_at_check;
+ALTER TABLE orders ADD CONSTRAINT orders_expires_at_check CHECK ((time_in_force = 'GTD') = (expires_at IS NOT NULL));
+
+-- Lets the expiry sweep find open orders due to expire
+CREATE INDEX IF NOT EXISTS idx_orders_open_expiry ON orders (expires_at) WHERE status = 'open' AND expires_at IS NOT NULL;
@@ -0,0 +1,27 @@
+-- Records every change to orders and trades, who made it and from where,
+-- for dispute resolution. Entries can't be changed or deleted.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INT,                       -- User who made the change; NULL for the engine and the system
+    source VARCHAR(16) NOT NULL,        -- "api", "grpc", "admin", "engine" or "system"
+    source_ip VARCHAR(45),
+    action VARCHAR(32) NOT NULL,        -- e.g. "order.created", "order.canceled" or "trade.executed"
+    entity_type VARCHAR(16) NOT NULL,   -- "order" or "trade"
+    entity_id BIGINT NOT NULL,
+    before JSONB,                       -- State before the change; NULL when created
+    after JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity_type, entity_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, id) WHERE actor_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log entries cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_immutable ON audit_log;
+CREATE TRIGGER audit_log_immutable BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
@@ -0,0 +1,18 @@
+-- Records deposits and withdrawals of test funds. A completed transfer is
+-- posted to the ledger under reference type || ':' || id, against the
+-- 'custody' system account that stands for funds held outside the exchange.
+-- Pending transfers wait for an admin to approve or reject them.
+CREATE TABLE IF NOT EXISTS transfers (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    type VARCHAR(10) NOT NULL CHECK (type IN ('deposit', 'withdrawal')),
+    asset VARCHAR(10) NOT NULL,
+    amount DECIMAL(28, 8) NOT NULL CHECK (amount > 0),
+    status VARCHAR(10) NOT NULL CHECK (status IN ('pending', 'completed', 'rejected')),
+    reviewed_by INT REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfers_user ON transfers (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_transfers_pending ON transfers (id) WHERE status = 'pending';
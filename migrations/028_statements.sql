@@ -0,0 +1,12 @@
+-- Keeps each user's daily account statement as it was generated: the day's
+-- trades and fees and the balances at its end, so later ledger corrections
+-- don't change a statement already issued.
+CREATE TABLE IF NOT EXISTS statements (
+    user_id INT NOT NULL REFERENCES users(id),
+    day DATE NOT NULL,
+    statement JSONB NOT NULL,
+    generated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_statements_day ON statements (day);
@@ -0,0 +1,14 @@
+-- Records the users on each side of a trade and its symbol, so per-user
+-- trade queries find a user's trades by index instead of joining every
+-- trade to its orders. The orders still hold each side's tag.
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS buyer_user_id INT REFERENCES users(id);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS seller_user_id INT REFERENCES users(id);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS symbol VARCHAR(20);
+
+UPDATE trades t SET buyer_user_id = b.user_id, seller_user_id = s.user_id, symbol = b.symbol
+FROM orders b, orders s
+WHERE b.id = t.buy_order_id AND s.id = t.sell_order_id AND t.symbol IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_trades_buyer ON trades (buyer_user_id, executed_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_seller ON trades (seller_user_id, executed_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol ON trades (symbol, id);
@@ -0,0 +1,5 @@
+-- Indexes open orders in book order, so loading the book reads it in
+-- batches along the index instead of scanning and sorting every order.
+-- Per-user history already has idx_orders_user_created and the trades'
+-- buyer and seller indexes, which keyset pages continue along.
+CREATE INDEX IF NOT EXISTS idx_orders_book ON orders (status, symbol, price, created_at, id);
@@ -0,0 +1,52 @@
+-- Partitions trades by the month they executed in, so time-range queries
+-- only read the months they cover and old months can be detached or dropped
+-- whole. The table is rebuilt once; partitions for the months it already
+-- holds are created here, and the current and coming months by the
+-- migration tooling and the server. A default partition takes any trade
+-- outside them until its month's partition is created.
+--
+-- A partitioned table's unique constraints must include the partition key,
+-- so the primary key becomes (id, executed_at), IDs still coming from the
+-- same sequence, and journal references are indexed but no longer unique;
+-- recording a trade checks for its reference instead.
+DO $$
+DECLARE
+    month TIMESTAMP;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'trades'::regclass) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE trades RENAME TO trades_unpartitioned;
+    ALTER TABLE trades_unpartitioned RENAME CONSTRAINT trades_pkey TO trades_unpartitioned_pkey;
+
+    CREATE TABLE trades (LIKE trades_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+        PARTITION BY RANGE (executed_at);
+    ALTER TABLE trades ADD PRIMARY KEY (id, executed_at);
+    ALTER SEQUENCE trades_id_seq OWNED BY trades.id;
+
+    CREATE TABLE trades_default PARTITION OF trades DEFAULT;
+    FOR month IN SELECT DISTINCT date_trunc('month', executed_at) FROM trades_unpartitioned WHERE executed_at IS NOT NULL LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF trades FOR VALUES FROM (%L) TO (%L)',
+            'trades_' || to_char(month, 'YYYY_MM'), month, month + INTERVAL '1 month');
+    END LOOP;
+
+    INSERT INTO trades SELECT * FROM trades_unpartitioned;
+    DROP TABLE trades_unpartitioned;
+
+    ALTER TABLE trades ADD FOREIGN KEY (buy_order_id) REFERENCES orders(id);
+    ALTER TABLE trades ADD FOREIGN KEY (sell_order_id) REFERENCES orders(id);
+    ALTER TABLE trades ADD FOREIGN KEY (buyer_user_id) REFERENCES users(id);
+    ALTER TABLE trades ADD FOREIGN KEY (seller_user_id) REFERENCES users(id);
+    ALTER TABLE trades ADD FOREIGN KEY (accounting_batch_id) REFERENCES accounting_batches(id);
+END $$;
+
+-- Indexes on the partitioned table are created on every partition
+CREATE INDEX IF NOT EXISTS idx_trades_buy_order ON trades (buy_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_sell_order ON trades (sell_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_executed_at ON trades (executed_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_journal_ref ON trades (journal_ref);
+CREATE INDEX IF NOT EXISTS idx_trades_unbatched ON trades (id) WHERE accounting_batch_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_buyer ON trades (buyer_user_id, executed_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_seller ON trades (seller_user_id, executed_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol ON trades (symbol, id);
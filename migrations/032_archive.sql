@@ -0,0 +1,20 @@
+-- Archives of the orders and trades the archiver moves out of the hot
+-- tables once they are done with: trades older than the retention period
+-- whose orders are both closed, and closed orders of that age with no
+-- trades left in trades. Rows keep their columns in the same order,
+-- followed by when they were archived, so a column added to orders or
+-- trades must be added to its archive too.
+CREATE TABLE IF NOT EXISTS orders_archive (
+    LIKE orders,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS trades_archive (
+    LIKE trades,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_archive_user_created ON orders_archive (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_trades_archive_executed_at ON trades_archive (executed_at, id);
@@ -0,0 +1,12 @@
+-- Hourly rollups of each market's trading: the number of trades, the base
+-- quantity traded and its quote value. Rollups are recalculated from trades,
+-- so an hour can be rolled up again to pick up trades recorded late.
+CREATE TABLE IF NOT EXISTS market_stats_hourly (
+    symbol VARCHAR(20) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    trades INT NOT NULL,
+    volume DECIMAL(18, 8) NOT NULL,
+    notional DECIMAL(24, 8) NOT NULL,
+    rolled_up_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (symbol, hour)
+);
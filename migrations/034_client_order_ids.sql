@@ -0,0 +1,7 @@
+-- Lets clients give orders IDs of their own, unique among each user's
+-- orders, to look them up by. The archive keeps them too; as the column
+-- follows archived_at there, orders are archived by naming their columns.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS client_order_id VARCHAR(64);
+ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS client_order_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_user_client_order_id ON orders (user_id, client_order_id) WHERE client_order_id IS NOT NULL;
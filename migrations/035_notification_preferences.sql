@@ -0,0 +1,13 @@
+-- Users choose which account activity they are notified of, and the
+-- address emailed notifications go to. Users without a row get the defaults.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    email VARCHAR(254) NOT NULL DEFAULT '',
+    fills BOOLEAN NOT NULL DEFAULT TRUE,
+    expiries BOOLEAN NOT NULL DEFAULT TRUE,
+    new_logins BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Finds whether a user has logged in from an IP before
+CREATE INDEX IF NOT EXISTS idx_sessions_user_ip ON sessions (user_id, ip);
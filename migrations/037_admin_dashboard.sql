@@ -0,0 +1,20 @@
+-- Each user's trading over the last 24 hours, for the admin dashboard's top
+-- traders. Totalling every trade by user is too slow to do per request, so
+-- the view is refreshed periodically; as_of is when it last was. The unique
+-- index lets it be refreshed concurrently, without blocking reads.
+CREATE MATERIALIZED VIEW IF NOT EXISTS trader_volume_24h AS
+SELECT user_id, COUNT(*)::INT AS trades, SUM(quantity) AS volume, SUM(price * quantity) AS notional,
+    LOCALTIMESTAMP AS as_of
+FROM (
+    SELECT buyer_user_id AS user_id, price, quantity FROM trades
+    WHERE executed_at > LOCALTIMESTAMP - INTERVAL '24 hours'
+    UNION ALL
+    SELECT seller_user_id, price, quantity FROM trades
+    WHERE executed_at > LOCALTIMESTAMP - INTERVAL '24 hours'
+) sides
+WHERE user_id IS NOT NULL
+GROUP BY user_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trader_volume_24h_user ON trader_volume_24h (user_id);
+CREATE INDEX IF NOT EXISTS idx_trader_volume_24h_notional ON trader_volume_24h (notional DESC);
+
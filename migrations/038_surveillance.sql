@@ -0,0 +1,31 @@
+-- Alerts raised by market surveillance on accounts whose trading in an hour
+-- looks abusive: trading with themselves, churning orders or pushing the
+-- price. An hour is scanned once it's over; scanning it again raises no
+-- duplicate alerts. Admins resolve alerts once they've looked into them.
+CREATE TABLE IF NOT EXISTS surveillance_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    kind VARCHAR(32) NOT NULL,              -- "self_trade", "order_churn" or "price_ramp"
+    symbol VARCHAR(20) NOT NULL DEFAULT '', -- Empty for alerts across markets
+    hour TIMESTAMP NOT NULL,                -- Start of the hour the activity was in
+    description TEXT NOT NULL,
+    details JSONB NOT NULL,                 -- The measurements that raised the alert
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    note TEXT NOT NULL DEFAULT '',
+    resolved_by INT REFERENCES users(id),
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, kind, symbol, hour)
+);
+
+CREATE INDEX IF NOT EXISTS idx_surveillance_alerts_open ON surveillance_alerts (id) WHERE status = 'open';
+
+-- The hours surveillance has scanned
+CREATE TABLE IF NOT EXISTS surveillance_scans (
+    hour TIMESTAMP PRIMARY KEY,
+    alerts INT NOT NULL,
+    scanned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Finds an hour's cancels and amendments without reading the whole log
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created_at);
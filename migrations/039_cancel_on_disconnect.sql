@@ -0,0 +1,4 @@
+-- Lets an API key cancel all of its user's open orders when a WebSocket
+-- connection it authenticated drops, so a bot that loses its connection
+-- doesn't leave stale quotes on the book
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS cancel_on_disconnect BOOLEAN NOT NULL DEFAULT FALSE;
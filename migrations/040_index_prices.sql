@@ -0,0 +1,13 @@
+-- Records reference prices of each instrument ingested from an external
+-- feed, which seed realistic prices and bound how far from the market
+-- orders may be priced. The source names the feed a price came from.
+CREATE TABLE IF NOT EXISTS index_prices (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(20) NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    price DECIMAL(10, 2) NOT NULL CHECK (price > 0),
+    observed_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_index_prices_symbol_observed_at ON index_prices (symbol, observed_at DESC);
@@ -0,0 +1,42 @@
+-- Records each user's position in the lending pool of an asset: what they
+-- have lent to it, including the interest it has earned, and what they owe
+-- it, including the interest accrued. Lent and borrowed funds move through
+-- the ledger against the 'lending' system account, whose balance in an
+-- asset is what's been lent less what's owed. Interest only changes the
+-- positions, so the two always match.
+CREATE TABLE IF NOT EXISTS lending_positions (
+    user_id INT NOT NULL REFERENCES users(id),
+    asset VARCHAR(10) NOT NULL,
+    supplied DECIMAL(28, 8) NOT NULL DEFAULT 0 CHECK (supplied >= 0),
+    borrowed DECIMAL(28, 8) NOT NULL DEFAULT 0 CHECK (borrowed >= 0),
+    interest_earned DECIMAL(28, 8) NOT NULL DEFAULT 0,
+    interest_charged DECIMAL(28, 8) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, asset)
+);
+
+-- Records each hour interest was accrued for in an asset, so an hour is
+-- accrued once however often accrual runs
+CREATE TABLE IF NOT EXISTS lending_accruals (
+    asset VARCHAR(10) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    rate DECIMAL(10, 6) NOT NULL,
+    borrowed DECIMAL(28, 8) NOT NULL,
+    interest DECIMAL(28, 8) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (asset, hour)
+);
+
+-- Records every movement into or out of the lending pools: lending to a
+-- pool, withdrawing from it, borrowing and repaying. Each is posted to the
+-- ledger under reference kind || ':' || id.
+CREATE TABLE IF NOT EXISTS lending_movements (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    asset VARCHAR(10) NOT NULL,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('lend', 'redeem', 'borrow', 'repay')),
+    amount DECIMAL(28, 8) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lending_movements_user ON lending_movements (user_id, id);
@@ -0,0 +1,4 @@
+-- How long a GTC order may rest before the engine takes it off the book,
+-- kept so a restarted engine still expires it. Zero rests it until filled
+-- or canceled.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS lifetime_ms INTEGER NOT NULL DEFAULT 0 CHECK (lifetime_ms >= 0);
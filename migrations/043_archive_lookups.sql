@@ -0,0 +1,6 @@
+-- Lets the Binance-compatible API find orders, and what they traded, after
+-- the archiver has moved them: by client order ID, and the archived fills
+-- of an order.
+CREATE INDEX IF NOT EXISTS idx_orders_archive_user_client_order_id ON orders_archive (user_id, client_order_id) WHERE client_order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_archive_buy_order_id ON trades_archive (buy_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_archive_sell_order_id ON trades_archive (sell_order_id);
@@ -0,0 +1,14 @@
+// Package migrations embeds the database migrations, applied in order of
+// their version, the number each file name starts with.
+//
+// Every migration can be applied again to a database that already has it,
+// so a database set up by running the files by hand can start being
+// migrated by version at any point.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
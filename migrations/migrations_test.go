@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/tern/v2/migrate"
+)
+
+func TestFS(t *testing.T) {
+	// Versions must run from 1 without gaps or duplicates
+	files, err := migrate.FindMigrations(FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) == 0 || files[0] != "001_init.sql" {
+		t.Fatalf("expected migrations starting at 001_init.sql, got %v", files)
+	}
+
+	for _, file := range files {
+		data, err := FS.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Migrations are templates; braces would be evaluated
+		if strings.Contains(string(data), "{{") {
+			t.Errorf("%s contains template braces", file)
+		}
+	}
+}